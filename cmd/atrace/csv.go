@@ -0,0 +1,43 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	"codeberg.org/pwnderpants/vtrace/internal/sink"
+	"codeberg.org/pwnderpants/vtrace/internal/stats"
+)
+
+// csvHeader lists the columns written by --csv
+var csvHeader = []string{
+	"timestamp", "sample", "protocol",
+	"dns_lookup_ms", "tcp_connect_ms", "tls_handshake_ms", "quic_handshake_ms",
+	"ttfb_ms", "total_ms", "proto", "failed_connects",
+}
+
+// csvWriter receives one row per sample when --csv is set
+var csvWriter *sink.CSVWriter
+
+// writeCSVRow records a completed sample in the CSV export
+func writeCSVRow(index int, protocol string, sample stats.AssetSample) {
+	row := []string{
+		time.Now().UTC().Format(time.RFC3339Nano),
+		strconv.Itoa(index + 1),
+		protocol,
+		sink.FormatMillis(sample.DNSLookup),
+		sink.FormatMillis(sample.TCPConnect),
+		sink.FormatMillis(sample.TLSHandshake),
+		sink.FormatMillis(sample.QUICHandshake),
+		sink.FormatMillis(sample.TTFB),
+		sink.FormatMillis(sample.TotalTime),
+		sample.Proto,
+		strconv.Itoa(sample.FailedConnects),
+	}
+
+	// A failed write is reported but never fails the run
+	if err := csvWriter.Write(row); err != nil {
+		fmt.Fprintf(os.Stderr, "warning: %v\n", err)
+	}
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"golang.org/x/net/http/httpguts"
+)
+
+var (
+	headerSpecs []string
+	userAgent   string
+
+	// requestHeader holds the parsed --header and --user-agent values sent with the request
+	requestHeader http.Header
+)
+
+// setupRequestHeaders parses the --header and --user-agent flags
+func setupRequestHeaders() error {
+	header, err := parseHeaders(headerSpecs)
+	if err != nil {
+		return err
+	}
+
+	// --user-agent wins over a User-Agent passed with --header
+	if userAgent != "" {
+		if header == nil {
+			header = make(http.Header)
+		}
+
+		header.Set("User-Agent", userAgent)
+	}
+
+	requestHeader = header
+
+	return nil
+}
+
+// parseHeaders turns "Name: value" entries into a header map, keeping repeated names
+func parseHeaders(specs []string) (http.Header, error) {
+	if len(specs) == 0 {
+		return nil, nil
+	}
+
+	header := make(http.Header)
+
+	for _, spec := range specs {
+		name, value, ok := strings.Cut(spec, ":")
+		name = strings.TrimSpace(name)
+		value = strings.TrimSpace(value)
+
+		if !ok || !httpguts.ValidHeaderFieldName(name) {
+			return nil, fmt.Errorf("invalid --header %q (want \"Name: value\")", spec)
+		}
+
+		if !httpguts.ValidHeaderFieldValue(value) {
+			return nil, fmt.Errorf("invalid value in --header %q", spec)
+		}
+
+		header.Add(name, value)
+	}
+
+	return header, nil
+}
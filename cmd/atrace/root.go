@@ -6,12 +6,14 @@ import (
 	"fmt"
 	"io"
 	"math/rand"
+	"sort"
 	"strings"
 	"time"
 
 	"github.com/spf13/cobra"
 
 	"codeberg.org/pwnderpants/vtrace/internal/probe"
+	"codeberg.org/pwnderpants/vtrace/internal/sink"
 	"codeberg.org/pwnderpants/vtrace/internal/stats"
 )
 
@@ -24,6 +26,13 @@ var (
 	delayRandom     string
 	excludeOutliers bool
 	compare         bool
+	csvPath         string
+)
+
+// Protocol labels used when reporting samples
+const (
+	protocolHTTP12 = "HTTP/1.1-2"
+	protocolHTTP3  = "HTTP/3"
 )
 
 var rootCmd = &cobra.Command{
@@ -42,21 +51,44 @@ func init() {
 	rootCmd.Flags().DurationVarP(&timeout, "timeout", "t", 30*time.Second, "Request timeout")
 	rootCmd.Flags().BoolVarP(&verbose, "verbose", "v", false, "Enable verbose output")
 	rootCmd.Flags().IntVarP(&samples, "samples", "n", 1, "Number of measurement iterations")
+	rootCmd.Flags().StringArrayVarP(&headerSpecs, "header", "H", nil, "Add a request header (\"Name: value\", repeatable)")
+	rootCmd.Flags().StringVar(&userAgent, "user-agent", "", "User-Agent sent with the request")
 	rootCmd.Flags().DurationVarP(&delay, "delay", "d", 5*time.Second, "Fixed delay between samples")
 	rootCmd.Flags().StringVar(&delayRandom, "delay-random", "", "Randomized delay range (e.g., 2s-8s)")
 	rootCmd.Flags().BoolVar(&excludeOutliers, "exclude-outliers", false, "Exclude outliers from average calculation")
 	rootCmd.Flags().BoolVar(&compare, "compare", false, "Compare HTTP/1.1-2 vs HTTP/3 timings")
+	rootCmd.Flags().StringVar(&numberLocale, "locale", "", "Format table numbers for a locale (e.g., de-DE, fr-FR, de-CH)")
+	rootCmd.Flags().StringVar(&decimalSeparator, "decimal-separator", "", "Decimal separator for table numbers (overrides --locale)")
+	rootCmd.Flags().StringVar(&thousandsSeparator, "thousands-separator", "", "Thousands grouping separator for table numbers (overrides --locale)")
+	rootCmd.Flags().IntVar(&numberWidth, "number-width", 0, "Pad every table number to this fixed width (0 for natural width)")
+	rootCmd.Flags().StringVar(&csvPath, "csv", "", "Write one row per sample with all phase durations to this CSV file")
 
 	rootCmd.MarkFlagRequired("url")
 }
 
 // run executes the main TTFB measurement logic
 func run(cmd *cobra.Command, args []string) error {
+	// Normalize the target URL (punycode hosts, IPv6 literals, userinfo)
+	normalized, err := probe.NormalizeURL(url)
+	if err != nil {
+		return fmt.Errorf("invalid URL: %w", err)
+	}
+
+	url = normalized
+
 	// Validate samples flag
 	if samples < 1 {
 		return errors.New("samples must be at least 1")
 	}
 
+	if err := setupNumberFormat(); err != nil {
+		return fmt.Errorf("invalid number format: %w", err)
+	}
+
+	if err := setupRequestHeaders(); err != nil {
+		return err
+	}
+
 	// Parse delay-random if provided
 	var minDelay, maxDelay time.Duration
 
@@ -69,6 +101,16 @@ func run(cmd *cobra.Command, args []string) error {
 		}
 	}
 
+	// Open the CSV export once flags are known to be valid
+	if csvPath != "" {
+		csvWriter, err = sink.NewCSVWriter(csvPath, csvHeader)
+		if err != nil {
+			return err
+		}
+
+		defer csvWriter.Close()
+	}
+
 	// Handle comparison mode
 	if compare {
 		return runCompare(minDelay, maxDelay)
@@ -76,7 +118,7 @@ func run(cmd *cobra.Command, args []string) error {
 
 	// Single sample mode
 	if samples == 1 {
-		sample, trace, err := measureTTFB()
+		sample, trace, err := measureSample(0, protocolHTTP12)
 		if err != nil {
 			return err
 		}
@@ -94,7 +136,7 @@ func run(cmd *cobra.Command, args []string) error {
 			fmt.Printf("\n── Sample %d/%d ──\n", i+1, samples)
 		}
 
-		sample, _, err := measureTTFB()
+		sample, _, err := measureSample(i, protocolHTTP12)
 		if err != nil {
 			return fmt.Errorf("sample %d failed: %w", i+1, err)
 		}
@@ -130,7 +172,7 @@ func runCompare(minDelay, maxDelay time.Duration) error {
 			fmt.Println("── HTTP/1.1-2 ──")
 		}
 
-		http12Sample, http12Trace, err := measureTTFB()
+		http12Sample, http12Trace, err := measureSample(0, protocolHTTP12)
 		if err != nil {
 			return fmt.Errorf("HTTP/1.1-2 measurement failed: %w", err)
 		}
@@ -139,13 +181,15 @@ func runCompare(minDelay, maxDelay time.Duration) error {
 			fmt.Println("\n── HTTP/3 ──")
 		}
 
-		http3Sample, http3Trace, err := measureTTFBHTTP3()
+		http3Sample, http3Trace, err := measureSample(0, protocolHTTP3)
 		if err != nil {
 			return fmt.Errorf("HTTP/3 measurement failed: %w", err)
 		}
 
 		printComparisonResults(url, http12Trace, http3Trace, http12Sample.TTFB, http3Sample.TTFB)
 
+		printProtocolWarnings(protocolWarnings("HTTP/3 arm: ", stats.AssetProtocolCounts([]stats.AssetSample{http3Sample}), true))
+
 		return nil
 	}
 
@@ -164,7 +208,7 @@ func runCompare(minDelay, maxDelay time.Duration) error {
 			fmt.Printf("\n── Sample %d/%d ──\n", i+1, samples)
 		}
 
-		sample, _, err := measureTTFB()
+		sample, _, err := measureSample(i, protocolHTTP12)
 		if err != nil {
 			return fmt.Errorf("HTTP/1.1-2 sample %d failed: %w", i+1, err)
 		}
@@ -197,7 +241,7 @@ func runCompare(minDelay, maxDelay time.Duration) error {
 			fmt.Printf("\n── Sample %d/%d ──\n", i+1, samples)
 		}
 
-		sample, _, err := measureTTFBHTTP3()
+		sample, _, err := measureSample(i, protocolHTTP3)
 		if err != nil {
 			return fmt.Errorf("HTTP/3 sample %d failed: %w", i+1, err)
 		}
@@ -222,15 +266,45 @@ func runCompare(minDelay, maxDelay time.Duration) error {
 
 	printMultiSampleComparisonResults(url, http12Samples, http3Samples)
 
+	warnings := protocolWarnings("HTTP/1.1-2 arm: ", stats.AssetProtocolCounts(http12Samples), false)
+	warnings = append(warnings, protocolWarnings("HTTP/3 arm: ", stats.AssetProtocolCounts(http3Samples), true)...)
+
+	printProtocolWarnings(warnings)
+
 	return nil
 }
 
+// measureSample performs one measurement over the given protocol and runs per-sample hooks
+func measureSample(index int, protocol string) (stats.AssetSample, *probe.Trace, error) {
+	var (
+		sample stats.AssetSample
+		trace  *probe.Trace
+		err    error
+	)
+
+	if protocol == protocolHTTP3 {
+		sample, trace, err = measureTTFBHTTP3()
+	} else {
+		sample, trace, err = measureTTFB()
+	}
+
+	if err != nil {
+		return stats.AssetSample{}, nil, err
+	}
+
+	if csvWriter != nil {
+		writeCSVRow(index, protocol, sample)
+	}
+
+	return sample, trace, nil
+}
+
 // measureTTFBHTTP3 performs a single TTFB measurement using HTTP/3
 func measureTTFBHTTP3() (stats.AssetSample, *probe.Trace, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), timeout)
 	defer cancel()
 
-	client := probe.NewHTTP3Client(timeout)
+	client := probe.NewHTTP3ClientWithOptions(timeout, probe.ClientOptions{Header: requestHeader})
 
 	if verbose {
 		fmt.Printf("Fetching asset (HTTP/3): %s\n", url)
@@ -250,10 +324,12 @@ func measureTTFBHTTP3() (stats.AssetSample, *probe.Trace, error) {
 	}
 
 	sample := stats.AssetSample{
-		DNSLookup:     trace.DNSLookup,
-		QUICHandshake: trace.QUICHandshake,
-		TTFB:          trace.TTFB,
-		TotalTime:     trace.Total,
+		DNSLookup:      trace.DNSLookup,
+		QUICHandshake:  trace.QUICHandshake,
+		TTFB:           trace.TTFB,
+		TotalTime:      trace.Total,
+		Proto:          trace.Proto,
+		FailedConnects: trace.FailedConnects(),
 	}
 
 	return sample, trace, nil
@@ -264,7 +340,7 @@ func measureTTFB() (stats.AssetSample, *probe.Trace, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), timeout)
 	defer cancel()
 
-	client := probe.NewHTTPClient(timeout)
+	client := probe.NewHTTPClientWithOptions(timeout, probe.ClientOptions{Header: requestHeader})
 
 	if verbose {
 		fmt.Printf("Fetching asset: %s\n", url)
@@ -284,11 +360,13 @@ func measureTTFB() (stats.AssetSample, *probe.Trace, error) {
 	}
 
 	sample := stats.AssetSample{
-		DNSLookup:    trace.DNSLookup,
-		TCPConnect:   trace.TCPConnect,
-		TLSHandshake: trace.TLSHandshake,
-		TTFB:         trace.TTFB,
-		TotalTime:    trace.Total,
+		DNSLookup:      trace.DNSLookup,
+		TCPConnect:     trace.TCPConnect,
+		TLSHandshake:   trace.TLSHandshake,
+		TTFB:           trace.TTFB,
+		TotalTime:      trace.Total,
+		Proto:          trace.Proto,
+		FailedConnects: trace.FailedConnects(),
 	}
 
 	return sample, trace, nil
@@ -340,8 +418,15 @@ func printResults(url string, trace *probe.Trace, ttfb time.Duration) {
 	fmt.Printf("DNS Lookup:                  %12s\n", formatDuration(trace.DNSLookup))
 	fmt.Printf("TCP Connect:                 %12s\n", formatDuration(trace.TCPConnect))
 	fmt.Printf("TLS Handshake:               %12s\n", formatDuration(trace.TLSHandshake))
+
+	if verbose {
+		printTLSPhases(trace.TLSPhases)
+	}
+
 	fmt.Println("────────────────────────────────────────────────────")
 	fmt.Printf("Total TTFB:                  %12s\n", formatDuration(ttfb))
+
+	printConnectAttempts("asset", trace)
 }
 
 // printMultiSampleResults outputs aggregate statistics for multiple samples
@@ -410,6 +495,15 @@ func printMultiSampleResults(url string, allSamples []stats.AssetSample) {
 
 		fmt.Println()
 	}
+	printProtocolWarnings(protocolWarnings("", stats.AssetProtocolCounts(allSamples), false))
+
+	failed := make([]int, len(allSamples))
+
+	for i, sample := range allSamples {
+		failed[i] = sample.FailedConnects
+	}
+
+	printFailedConnectSummary(failed)
 }
 
 // printStatRow prints a single row of statistics
@@ -432,23 +526,113 @@ func printStatRow(label string, durations []time.Duration, outliers []stats.Outl
 	)
 }
 
-// formatDuration formats a duration as milliseconds with 2 decimal places
-func formatDuration(d time.Duration) string {
-	ms := float64(d) / float64(time.Millisecond)
+// protocolWarnings describes mixed or unexpected negotiated HTTP versions across samples
+func protocolWarnings(label string, counts map[string]int, expectHTTP3 bool) []string {
+	var warnings []string
+
+	protos := make([]string, 0, len(counts))
+
+	for proto := range counts {
+		protos = append(protos, proto)
+	}
+
+	sort.Strings(protos)
+
+	// Mixed protocols invalidate direct sample comparisons
+	if len(protos) > 1 {
+		parts := make([]string, len(protos))
 
-	return fmt.Sprintf("%.2fms", ms)
+		for i, proto := range protos {
+			parts[i] = fmt.Sprintf("%s (%d)", proto, counts[proto])
+		}
+
+		warnings = append(warnings, fmt.Sprintf("%sprotocol inconsistency across requests: %s", label, strings.Join(parts, ", ")))
+	}
+
+	// HTTP/3 attempts that were answered over another protocol
+	if expectHTTP3 {
+		for _, proto := range protos {
+			if proto != "HTTP/3.0" {
+				warnings = append(warnings, fmt.Sprintf("%sHTTP/3 requests answered over %s (%d)", label, proto, counts[proto]))
+			}
+		}
+	}
+
+	return warnings
 }
 
-// formatDelta formats the difference between two durations with sign
-func formatDelta(http12, http3 time.Duration) string {
-	delta := http3 - http12
-	ms := float64(delta) / float64(time.Millisecond)
+// printProtocolWarnings prints protocol consistency warnings, if any
+func printProtocolWarnings(warnings []string) {
+	if len(warnings) == 0 {
+		return
+	}
+
+	fmt.Println()
+
+	for _, w := range warnings {
+		fmt.Printf("Warning: %s\n", w)
+	}
+}
+
+// printConnectAttempts lists socket connect attempts when more than one was made or any failed
+func printConnectAttempts(label string, trace *probe.Trace) {
+	if len(trace.Connects) < 2 && trace.FailedConnects() == 0 {
+		return
+	}
+
+	fmt.Printf("\nConnect attempts (%s):\n", label)
+
+	for i, c := range trace.Connects {
+		outcome := "ok"
+
+		if c.Err != "" {
+			outcome = "failed: " + c.Err
+		}
+
+		fmt.Printf("  %d. %-4s %-40s %12s  %s\n", i+1, c.Network, c.Addr, formatDuration(c.Duration), outcome)
+	}
+}
+
+// printFailedConnectSummary reports failed connect attempts across samples
+func printFailedConnectSummary(failedPerSample []int) {
+	total := 0
+	affected := 0
+
+	for _, n := range failedPerSample {
+		total += n
+
+		if n > 0 {
+			affected++
+		}
+	}
+
+	if total == 0 {
+		return
+	}
+
+	fmt.Printf("\nFailed connect attempts: %d across %d of %d samples\n", total, affected, len(failedPerSample))
+}
 
-	if delta >= 0 {
-		return fmt.Sprintf("+%.2fms", ms)
+// printTLSPhases prints the message-level TLS handshake breakdown when available
+func printTLSPhases(phases probe.TLSPhases) {
+	if phases == (probe.TLSPhases{}) {
+		return
 	}
 
-	return fmt.Sprintf("%.2fms", ms)
+	fmt.Printf("  ClientHello Sent:          %12s\n", formatDuration(phases.ClientHello))
+	fmt.Printf("  ServerHello Received:      %12s\n", formatDuration(phases.ServerHello))
+	fmt.Printf("  Certificate Flight:        %12s\n", formatDuration(phases.Certificate))
+	fmt.Printf("  Finished:                  %12s\n", formatDuration(phases.Finished))
+}
+
+// formatDuration formats a duration as milliseconds in the configured number format
+func formatDuration(d time.Duration) string {
+	return numberFormat.Millis(d)
+}
+
+// formatDelta formats the difference between two durations with sign
+func formatDelta(http12, http3 time.Duration) string {
+	return numberFormat.SignedMillis(http3 - http12)
 }
 
 // printComparisonResults outputs side-by-side HTTP/1.1-2 vs HTTP/3 comparison
@@ -493,20 +677,11 @@ func printComparisonResults(url string, http12Trace, http3Trace *probe.Trace, ht
 // printMultiSampleComparisonResults outputs aggregate stats for HTTP/1.1-2 vs HTTP/3
 func printMultiSampleComparisonResults(url string, http12Samples, http3Samples []stats.AssetSample) {
 	fmt.Printf("\natrace comparison for: %s (%d samples each)\n", url, len(http12Samples))
-	fmt.Println("────────────────────────────────────────────────────────────────────")
-	fmt.Printf("%-20s %14s %14s %14s\n", "", "HTTP/1.1-2", "HTTP/3", "Delta")
-	fmt.Println("────────────────────────────────────────────────────────────────────")
-
-	// DNS Lookup
-	http12DNS := stats.ComputeStats(stats.ExtractAssetDNSLookup(http12Samples))
-	http3DNS := stats.ComputeStats(stats.ExtractAssetDNSLookup(http3Samples))
+	fmt.Println(compareRule)
+	fmt.Printf("%-20s %14s %14s %14s %-3s %8s\n", "", "HTTP/1.1-2", "HTTP/3", "Delta", "", "p-value")
+	fmt.Println(compareRule)
 
-	fmt.Printf("%-20s %14s %14s %14s\n",
-		"DNS Lookup:",
-		formatDuration(http12DNS.Mean),
-		formatDuration(http3DNS.Mean),
-		formatDelta(http12DNS.Mean, http3DNS.Mean),
-	)
+	printComparisonRow("DNS Lookup:", stats.ExtractAssetDNSLookup(http12Samples), stats.ExtractAssetDNSLookup(http3Samples))
 
 	// TCP Connect (HTTP/1.1-2 only)
 	http12TCP := stats.ComputeStats(stats.ExtractAssetTCPConnect(http12Samples))
@@ -538,16 +713,10 @@ func printMultiSampleComparisonResults(url string, http12Samples, http3Samples [
 		"N/A",
 	)
 
-	fmt.Println("────────────────────────────────────────────────────────────────────")
+	fmt.Println(compareRule)
 
-	// Total TTFB
-	http12TTFB := stats.ComputeStats(stats.ExtractAssetTTFB(http12Samples))
-	http3TTFB := stats.ComputeStats(stats.ExtractAssetTTFB(http3Samples))
+	printComparisonRow("Total TTFB:", stats.ExtractAssetTTFB(http12Samples), stats.ExtractAssetTTFB(http3Samples))
 
-	fmt.Printf("%-20s %14s %14s %14s\n",
-		"Total TTFB:",
-		formatDuration(http12TTFB.Mean),
-		formatDuration(http3TTFB.Mean),
-		formatDelta(http12TTFB.Mean, http3TTFB.Mean),
-	)
+	fmt.Println()
+	fmt.Println(significanceLegend)
 }
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	"codeberg.org/pwnderpants/vtrace/internal/stats"
+)
+
+// significanceLegend explains the markers appended to multi-sample deltas
+const significanceLegend = "Delta markers: * p<0.05, ** p<0.01, *** p<0.001 (two-sided Welch's t-test)"
+
+// compareRule separates sections of the multi-sample comparison table
+var compareRule = strings.Repeat("─", 78)
+
+// printComparisonRow prints the HTTP/1.1-2 and HTTP/3 means of a phase with the significance of their delta
+func printComparisonRow(label string, http12, http3 []time.Duration) {
+	http12Stats := stats.ComputeStats(http12)
+	http3Stats := stats.ComputeStats(http3)
+	welch := stats.WelchTTest(http3, http12)
+
+	fmt.Printf("%-20s %14s %14s %14s %-3s %8s\n",
+		label,
+		formatDuration(http12Stats.Mean),
+		formatDuration(http3Stats.Mean),
+		formatDelta(http12Stats.Mean, http3Stats.Mean),
+		stats.Stars(welch.P),
+		formatPValue(welch.P),
+	)
+}
+
+// formatPValue renders a p-value, or n/a when there are too few samples to test
+func formatPValue(p float64) string {
+	switch {
+	case math.IsNaN(p):
+		return "n/a"
+	case p < 0.001:
+		return "<0.001"
+	}
+
+	return fmt.Sprintf("%.3f", p)
+}
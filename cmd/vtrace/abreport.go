@@ -0,0 +1,217 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"codeberg.org/pwnderpants/vtrace/internal/history"
+	"codeberg.org/pwnderpants/vtrace/internal/stats"
+)
+
+var (
+	abHistoryPath string
+	abMetric      string
+	abControl     string
+	abAlpha       float64
+	abSince       time.Duration
+)
+
+var abReportCmd = &cobra.Command{
+	Use:   "ab-report",
+	Short: "Compare stored experiment arms with significance tests",
+	Long: `ab-report aggregates samples recorded with --experiment and --arm by arm and
+compares each arm against the control arm using Welch's t-test (means) and the
+Mann-Whitney U test (distributions), both two-sided.`,
+	RunE: runABReport,
+}
+
+// armSamples holds the stored outcomes of one experiment arm
+type armSamples struct {
+	name     string
+	values   []time.Duration
+	failures int
+}
+
+// init registers the ab-report subcommand and its flags
+func init() {
+	abReportCmd.Flags().StringVar(&experimentName, "experiment", "", "Experiment name to report on (required)")
+	abReportCmd.Flags().StringVar(&abHistoryPath, "history", defaultHistoryPath, "History store (file path, sqlite:PATH, or postgres:// URL)")
+	abReportCmd.Flags().StringVar(&abMetric, "metric", "total_ttff", "Metric to compare (e.g., total_ttff, manifest_ttfb, segment_total)")
+	abReportCmd.Flags().StringVar(&abControl, "control", "", "Control arm (defaults to the alphabetically first arm)")
+	abReportCmd.Flags().Float64Var(&abAlpha, "alpha", 0.05, "Significance level")
+	abReportCmd.Flags().DurationVar(&abSince, "since", 0, "Only include samples from this far back (0 for all)")
+
+	abReportCmd.MarkFlagRequired("experiment")
+
+	rootCmd.AddCommand(abReportCmd)
+}
+
+// runABReport loads the experiment's samples and prints the per-arm comparison
+func runABReport(cmd *cobra.Command, args []string) error {
+	if abAlpha <= 0 || abAlpha >= 1 {
+		return errors.New("alpha must be between 0 and 1")
+	}
+
+	store, err := openStoredHistory(abHistoryPath)
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	var from time.Time
+
+	if abSince > 0 {
+		from = time.Now().Add(-abSince)
+	}
+
+	records, err := store.Query(from, time.Now())
+	if err != nil {
+		return err
+	}
+
+	arms := groupArms(records)
+
+	if len(arms) == 0 {
+		return fmt.Errorf("no samples stored for experiment %q in %s", experimentName, abHistoryPath)
+	}
+
+	control := arms[0]
+
+	if abControl != "" {
+		control = nil
+
+		for _, arm := range arms {
+			if arm.name == abControl {
+				control = arm
+			}
+		}
+
+		if control == nil {
+			return fmt.Errorf("control arm %q has no samples", abControl)
+		}
+	}
+
+	printArmTable(arms)
+
+	if len(arms) < 2 {
+		fmt.Println("\nOnly one arm has samples; nothing to compare.")
+
+		return nil
+	}
+
+	for _, arm := range arms {
+		if arm != control {
+			printArmComparison(control, arm)
+		}
+	}
+
+	return nil
+}
+
+// groupArms collects the selected metric per arm for the experiment, sorted by arm name
+func groupArms(records []history.Record) []*armSamples {
+	byName := make(map[string]*armSamples)
+
+	for _, record := range records {
+		if record.Experiment != experimentName {
+			continue
+		}
+
+		arm := byName[record.Arm]
+
+		if arm == nil {
+			arm = &armSamples{name: record.Arm}
+			byName[record.Arm] = arm
+		}
+
+		if record.Error != "" {
+			arm.failures++
+
+			continue
+		}
+
+		value, ok := record.Metrics[abMetric]
+		if !ok {
+			continue
+		}
+
+		arm.values = append(arm.values, time.Duration(value*float64(time.Millisecond)))
+	}
+
+	arms := make([]*armSamples, 0, len(byName))
+
+	for _, arm := range byName {
+		arms = append(arms, arm)
+	}
+
+	sort.Slice(arms, func(i, j int) bool {
+		return arms[i].name < arms[j].name
+	})
+
+	return arms
+}
+
+// printArmTable outputs summary statistics for every arm
+func printArmTable(arms []*armSamples) {
+	fmt.Printf("vtrace A/B report for experiment: %s (metric: %s)\n", experimentName, abMetric)
+	fmt.Println("──────────────────────────────────────────────────────────────────────────────────")
+	fmt.Printf("%-10s %8s %8s %12s %12s %12s %12s\n", "Arm", "Samples", "Failed", "Avg", "Median", "Min", "StdDev")
+	fmt.Println("──────────────────────────────────────────────────────────────────────────────────")
+
+	for _, arm := range arms {
+		s := stats.ComputeStats(arm.values)
+
+		fmt.Printf("%-10s %8d %8d %12s %12s %12s %12s\n",
+			arm.name,
+			len(arm.values),
+			arm.failures,
+			formatDuration(s.Mean),
+			formatDuration(s.Median),
+			formatDuration(s.Min),
+			formatDuration(s.StdDev),
+		)
+	}
+}
+
+// printArmComparison outputs the difference and significance tests of one arm against the control
+func printArmComparison(control, arm *armSamples) {
+	controlStats := stats.ComputeStats(control.values)
+	armStats := stats.ComputeStats(arm.values)
+
+	fmt.Printf("\n%s vs %s\n", arm.name, control.name)
+
+	relative := ""
+
+	if controlStats.Mean > 0 {
+		relative = fmt.Sprintf(" (%+.1f%%)", 100*float64(armStats.Mean-controlStats.Mean)/float64(controlStats.Mean))
+	}
+
+	fmt.Printf("  Avg delta:        %s%s\n", formatDelta(controlStats.Mean, armStats.Mean), relative)
+
+	welch := stats.WelchTTest(arm.values, control.values)
+	mannWhitney := stats.MannWhitneyU(arm.values, control.values)
+
+	if math.IsNaN(welch.P) || math.IsNaN(mannWhitney.P) {
+		fmt.Println("  Not enough samples for significance tests (need at least 2 per arm)")
+
+		return
+	}
+
+	fmt.Printf("  Welch's t-test:   t=%.3f df=%.1f p=%.4f\n", welch.T, welch.DF, welch.P)
+	fmt.Printf("  Mann-Whitney U:   U=%.1f z=%.3f p=%.4f\n", mannWhitney.U, mannWhitney.Z, mannWhitney.P)
+
+	verdict := "not significant"
+
+	if welch.P < abAlpha && mannWhitney.P < abAlpha {
+		verdict = "significant (both tests)"
+	} else if welch.P < abAlpha || mannWhitney.P < abAlpha {
+		verdict = "inconclusive (tests disagree)"
+	}
+
+	fmt.Printf("  Result:           %s at α=%g\n", verdict, abAlpha)
+}
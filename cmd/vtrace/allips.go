@@ -0,0 +1,294 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	neturl "net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"codeberg.org/pwnderpants/vtrace/internal/probe"
+	"codeberg.org/pwnderpants/vtrace/internal/stats"
+	"codeberg.org/pwnderpants/vtrace/internal/ttff"
+)
+
+// allIPs measures once per address the manifest host resolves to
+var allIPs bool
+
+// edgePin pins the manifest host to one address during an --all-ips comparison
+var edgePin map[string]string
+
+// ipArm collects the samples measured against one resolved address
+type ipArm struct {
+	Addr     string
+	Names    []string
+	Samples  []ttff.Sample
+	Failures int
+}
+
+// validateAllIPs rejects flags that conflict with --all-ips
+func validateAllIPs() error {
+	if !allIPs {
+		return nil
+	}
+
+	switch {
+	case compare:
+		return errors.New("--all-ips cannot be combined with --compare")
+	case allVariants:
+		return errors.New("--all-ips cannot be combined with --all-variants")
+	case checkMode:
+		return errors.New("--all-ips cannot be combined with --check")
+	case len(resolverSpecs) > 0 || len(interfaceNames) > 0:
+		return errors.New("--all-ips cannot be combined with --resolvers or --interfaces")
+	case urlFile != "":
+		return errors.New("--all-ips cannot be combined with --url-file")
+	case watchMode:
+		return errors.New("--all-ips cannot be combined with --watch")
+	case templatePath != "" || outputFormat == outputInflux:
+		return errors.New("--all-ips cannot be combined with --template or --output influx")
+	case confidenceLevel > 0:
+		return errors.New("--all-ips cannot be combined with --confidence")
+	case slaEnabled():
+		return errors.New("--all-ips cannot be combined with --fail-* thresholds")
+	case proxyURL != nil:
+		return errors.New("--all-ips cannot be combined with --proxy (the proxy resolves the target)")
+	case useHTTPSRR:
+		return errors.New("--all-ips cannot be combined with --use-https-rr")
+	}
+
+	return nil
+}
+
+// manifestDialAddr returns the host and "host:port" dial address of the stream URL
+func manifestDialAddr() (string, string, error) {
+	parsed, err := neturl.Parse(url)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to parse URL: %w", err)
+	}
+
+	port := parsed.Port()
+
+	if port == "" {
+		port = "443"
+
+		if parsed.Scheme == "http" {
+			port = "80"
+		}
+	}
+
+	return parsed.Hostname(), net.JoinHostPort(strings.ToLower(parsed.Hostname()), port), nil
+}
+
+// resolveEdges looks up every A and AAAA record of the manifest host and the reverse
+// DNS names of each address
+func resolveEdges() ([]*ipArm, error) {
+	host, _, err := manifestDialAddr()
+	if err != nil {
+		return nil, err
+	}
+
+	if net.ParseIP(host) != nil {
+		return nil, fmt.Errorf("--all-ips needs a host name, not the address %s", host)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	addrs, err := probe.LookupHost(ctx, host, probe.SystemNameserver())
+	if err != nil {
+		return nil, err
+	}
+
+	arms := make([]*ipArm, len(addrs))
+
+	var wg sync.WaitGroup
+
+	for i, addr := range addrs {
+		arms[i] = &ipArm{Addr: addr}
+
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			// Edges without PTR records are common; the address alone still identifies them
+			names, _ := net.DefaultResolver.LookupAddr(ctx, addr)
+
+			for _, name := range names {
+				arms[i].Names = append(arms[i].Names, strings.TrimSuffix(name, "."))
+			}
+		}()
+	}
+
+	wg.Wait()
+
+	return arms, nil
+}
+
+// reverseName returns the first reverse DNS name of an arm, or "-" without one
+func (a *ipArm) reverseName() string {
+	if len(a.Names) == 0 {
+		return "-"
+	}
+
+	return exportAddr(a.Names[0])
+}
+
+// runAllIPsComparison measures every resolved address of the manifest host in turn,
+// pinning the connection to it, and compares the edges
+func runAllIPsComparison(minDelay, maxDelay time.Duration) error {
+	arms, err := resolveEdges()
+	if err != nil {
+		return err
+	}
+
+	_, dialAddr, err := manifestDialAddr()
+	if err != nil {
+		return err
+	}
+
+	_, port, _ := net.SplitHostPort(dialAddr)
+
+	if verbose {
+		fmt.Printf("%s resolves to %d addresses: %s\n", dialAddr, len(arms), joinAddrs(armAddrs(arms)))
+	}
+
+	// Addresses take turns within each round so network drift affects them equally
+	for i := 0; i < samples; i++ {
+		for _, arm := range arms {
+			edgePin = map[string]string{dialAddr: net.JoinHostPort(arm.Addr, port)}
+
+			if verbose {
+				fmt.Printf("\n── Sample %d/%d via %s ──\n", i+1, samples, exportAddr(arm.Addr))
+			}
+
+			sample, _, _, err := measureSample(context.Background(), url, i, protocolHTTP12)
+			if err != nil {
+				arm.Failures++
+
+				if verbose {
+					fmt.Printf("  Failed: %v\n", err)
+				}
+
+				continue
+			}
+
+			arm.Samples = append(arm.Samples, sample)
+
+			if verbose {
+				fmt.Printf("  TTFF: %s\n", formatDuration(sample.TotalTTFF))
+			}
+		}
+
+		// Apply delay between rounds (skip after last round)
+		if i < samples-1 {
+			sleepDuration := getDelay(minDelay, maxDelay)
+
+			if verbose {
+				fmt.Printf("  Waiting %s before next round...\n", sleepDuration)
+			}
+
+			time.Sleep(sleepDuration)
+		}
+	}
+
+	edgePin = nil
+
+	printAllIPsResults(exportURL(url), arms)
+	printShaping()
+	printConfiguration()
+
+	for _, arm := range arms {
+		if len(arm.Samples) > 0 {
+			return nil
+		}
+	}
+
+	return errors.New("every address failed")
+}
+
+// armAddrs lists the addresses of the arms in order
+func armAddrs(arms []*ipArm) []string {
+	addrs := make([]string, len(arms))
+
+	for i, arm := range arms {
+		addrs[i] = arm.Addr
+	}
+
+	return addrs
+}
+
+// printAllIPsResults outputs the per-address TTFF table with reverse DNS names
+func printAllIPsResults(url string, arms []*ipArm) {
+	summaries := make([]stats.PhaseSummary, len(arms))
+
+	for i, arm := range arms {
+		summaries[i] = stats.SummarizePhases(ttff.Timings(arm.Samples))
+	}
+
+	fastest, slowest := stats.FastestSlowest(summaries)
+
+	width := len("Address")
+
+	for _, arm := range arms {
+		width = max(width, len(exportAddr(arm.Addr)))
+	}
+
+	rule := strings.Repeat("─", width+103)
+
+	noun := "addresses"
+
+	if len(arms) == 1 {
+		noun = "address"
+	}
+
+	fmt.Printf("\nvtrace edge comparison for: %s (%d %s, %d samples each)\n", url, len(arms), noun, samples)
+	fmt.Println(rule)
+	fmt.Printf("%-*s %-30s %12s %12s %12s %12s %12s %6s\n", width, "Address", "Reverse DNS", "TCP Connect", "TLS", "Segment", "Total TTFF", "StdDev", "Failed")
+	fmt.Println(rule)
+
+	for i, arm := range arms {
+		s := summaries[i]
+		name := arm.reverseName()
+
+		if runes := []rune(name); len(runes) > 30 {
+			name = string(runes[:29]) + "…"
+		}
+
+		if s.Count == 0 {
+			fmt.Printf("%-*s %-30s %12s %12s %12s %12s %12s %6d\n", width, exportAddr(arm.Addr), name, "-", "-", "-", "-", "-", arm.Failures)
+
+			continue
+		}
+
+		marker := ""
+
+		switch i {
+		case fastest:
+			marker = "  fastest"
+		case slowest:
+			marker = "  slowest"
+		}
+
+		fmt.Printf("%-*s %-30s %12s %12s %12s %12s %12s %6d%s\n",
+			width,
+			exportAddr(arm.Addr),
+			name,
+			formatDuration(stats.ComputeStats(stats.ExtractTCPConnect(ttff.Timings(arm.Samples))).Mean),
+			formatDuration(stats.ComputeStats(stats.ExtractTLSHandshake(ttff.Timings(arm.Samples))).Mean),
+			formatDuration(s.SegmentTotal.Mean),
+			formatDuration(s.TotalTTFF.Mean),
+			formatDuration(s.TotalTTFF.StdDev),
+			arm.Failures,
+			marker,
+		)
+	}
+
+	fmt.Println(rule)
+	fmt.Println("TCP Connect, TLS, Segment, and Total TTFF are averages.")
+	fmt.Println("Only the manifest host is pinned; segments on other hosts follow normal DNS.")
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"codeberg.org/pwnderpants/vtrace/internal/anomaly"
+	"codeberg.org/pwnderpants/vtrace/internal/prometheus"
+)
+
+var (
+	anomalyZ     float64
+	anomalyAlpha float64
+)
+
+// validateAnomaly checks the anomaly detection flags
+func validateAnomaly() error {
+	if anomalyZ < 0 {
+		return errors.New("--anomaly-z must not be negative")
+	}
+
+	if anomalyAlpha <= 0 || anomalyAlpha >= 1 {
+		return errors.New("--anomaly-alpha must be between 0 and 1")
+	}
+
+	return nil
+}
+
+// newAnomalyDetector returns a detector, or nil when --anomaly-z is 0
+func newAnomalyDetector() *anomaly.Detector {
+	if anomalyZ == 0 {
+		return nil
+	}
+
+	return anomaly.New(anomalyAlpha, anomalyZ, anomaly.DefaultWarmup)
+}
+
+// detectAnomalies scores a sample's metrics, logs and counts anomalies, and returns the flagged metric names
+func detectAnomalies(detector *anomaly.Detector, index int, metrics map[string]float64, at time.Time, exporter *prometheus.Exporter) []string {
+	if detector == nil {
+		return nil
+	}
+
+	var flagged []string
+
+	for _, a := range detector.Observe(metrics) {
+		flagged = append(flagged, a.Metric)
+
+		exporter.ObserveAnomaly(a.Metric)
+
+		fmt.Printf("%s  sample %d anomaly: %s %.1f ms vs baseline %.1f ± %.1f ms (z=%+.1f)\n",
+			at.Format(time.RFC3339), index+1, a.Metric, a.Value, a.Mean, a.StdDev, a.Z)
+	}
+
+	return flagged
+}
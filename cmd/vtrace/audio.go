@@ -0,0 +1,189 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/grafov/m3u8"
+
+	"codeberg.org/pwnderpants/vtrace/internal/decoder"
+	"codeberg.org/pwnderpants/vtrace/internal/probe"
+	"codeberg.org/pwnderpants/vtrace/internal/ttff"
+)
+
+// audioMode also measures time to first audio frame (TTFA)
+var audioMode bool
+
+// validateAudio checks that --audio is used with a measurement it can extend
+func validateAudio() error {
+	if !audioMode {
+		return nil
+	}
+
+	if streamProtocol != streamHLS {
+		return errors.New("--audio requires --protocol hls")
+	}
+
+	if lowLatency {
+		return errors.New("--audio cannot be combined with --ll-hls")
+	}
+
+	return nil
+}
+
+// measureAudio adds the TTFA phases to a sample. When the variant references an
+// EXT-X-MEDIA audio group, its rendition playlist and first segment are fetched;
+// otherwise the first audio frame is found in the already downloaded muxed segment.
+func measureAudio(ctx context.Context, client *http.Client, useHTTP3 bool, bundle *replayBundle, variant *m3u8.Variant, masterBaseURL string, muxedData []byte, sample *ttff.Sample) error {
+	renditionURL, rendition, err := probe.SelectAudioRendition(variant, masterBaseURL)
+	if err != nil {
+		return fmt.Errorf("failed to get audio rendition URL: %w", err)
+	}
+
+	pipeline := newPipeline(client, useHTTP3, bundle)
+
+	// Muxed audio arrives with the video segment
+	if renditionURL == "" {
+		if verbose {
+			fmt.Println("Detecting first audio frame in the muxed segment...")
+		}
+
+		detection, err := detectAudio(ctx, pipeline, muxedData)
+		if err != nil {
+			return err
+		}
+
+		sample.AudioDetection = detection
+		sample.TotalTTFA = sample.TotalTTFF - sample.FrameDetection + detection
+
+		return nil
+	}
+
+	// Rendition segments often share the video's extension, so CMCD is told they are audio
+	ctx = probe.WithCMCDObject(ctx, probe.CMCDAudio)
+
+	fetchPlaylist := probe.FetchPlaylist
+	downloadSegment := probe.DownloadSegment
+	suffix := ""
+
+	if useHTTP3 {
+		fetchPlaylist = probe.FetchPlaylistHTTP3
+		downloadSegment = probe.DownloadSegmentHTTP3
+		suffix = " (HTTP/3)"
+	}
+
+	if verbose {
+		fmt.Printf("Fetching audio rendition%s: %s (%s)\n", suffix, renditionURL, describeRendition(rendition))
+	}
+
+	// Audio files share the bundle with the video path
+	bundle.setPrefix("audio-")
+	defer bundle.setPrefix("")
+
+	phaseCtx, cancelPhase := pipeline.PhaseContext(ctx, ttff.PhaseMedia)
+	result, err := fetchPlaylist(phaseCtx, renditionURL, client)
+	cancelPhase()
+
+	bundle.addPlaylist("media.m3u8", renditionURL, result)
+
+	if err != nil {
+		return fmt.Errorf("failed to fetch audio playlist: %w", pipeline.ClassifyBudget(phaseCtx, ctx, ttff.PhaseMedia, err))
+	}
+
+	baseURL, err := probe.GetBaseURL(renditionURL)
+	if err != nil {
+		return fmt.Errorf("failed to get audio base URL: %w", err)
+	}
+
+	segmentURL, err := probe.GetFirstSegmentURL(result.Media, baseURL)
+	if err != nil {
+		return fmt.Errorf("failed to get audio segment URL: %w", err)
+	}
+
+	key, err := pipeline.FetchKey(ctx, result.Media, baseURL)
+	if err != nil {
+		return fmt.Errorf("failed to fetch audio segment key: %w", err)
+	}
+
+	phaseCtx, cancelPhase = pipeline.PhaseContext(ctx, ttff.PhaseSegment)
+	initData, initTrace, err := pipeline.DownloadInit(ctx, phaseCtx, result.Media, baseURL)
+	cancelPhase()
+
+	if err != nil {
+		return err
+	}
+
+	if verbose {
+		fmt.Printf("Downloading audio segment%s: %s\n", suffix, segmentURL)
+	}
+
+	phaseCtx, cancelPhase = pipeline.PhaseContext(ctx, ttff.PhaseSegment)
+	segmentData, segmentTrace, err := downloadSegment(phaseCtx, segmentURL, client)
+	cancelPhase()
+
+	bundle.add("segment", segmentURL, segmentData, segmentTrace)
+
+	if err != nil {
+		return fmt.Errorf("failed to download audio segment: %w", pipeline.ClassifyBudget(phaseCtx, ctx, ttff.PhaseSegment, err))
+	}
+
+	segmentData, err = key.Decrypt(segmentData)
+	if err != nil {
+		return err
+	}
+
+	if verbose {
+		fmt.Println("Detecting first audio frame...")
+	}
+
+	detection, err := detectAudio(ctx, pipeline, append(initData, segmentData...))
+	if err != nil {
+		return err
+	}
+
+	sample.AudioPlaylist = result.Trace.Total
+	sample.AudioSegment = key.FetchTime() + segmentTrace.Total
+	sample.AudioDetection = detection
+	sample.FailedConnects += result.Trace.FailedConnects() + key.FailedConnects() + segmentTrace.FailedConnects()
+
+	if initTrace != nil {
+		sample.AudioSegment += initTrace.Total
+		sample.FailedConnects += initTrace.FailedConnects()
+	}
+
+	// Players start audio from the master playlist, not after the video segment
+	sample.TotalTTFA = sample.ManifestTotal + sample.AudioPlaylist + sample.AudioSegment + detection
+
+	return nil
+}
+
+// detectAudio finds the first audio frame within the frame detection budget
+func detectAudio(ctx context.Context, pipeline *ttff.Pipeline, data []byte) (time.Duration, error) {
+	phaseCtx, cancelPhase := pipeline.PhaseContext(ctx, ttff.PhaseFrame)
+	defer cancelPhase()
+
+	detection, err := decoder.DetectFirstAudioFrame(phaseCtx, data)
+	if err != nil {
+		return 0, fmt.Errorf("failed to detect first audio frame: %w", pipeline.ClassifyBudget(phaseCtx, ctx, ttff.PhaseFrame, err))
+	}
+
+	return detection, nil
+}
+
+// describeRendition names an audio rendition by its NAME and LANGUAGE attributes
+func describeRendition(rendition *m3u8.Alternative) string {
+	name := rendition.Name
+
+	if name == "" {
+		name = rendition.GroupId
+	}
+
+	if rendition.Language != "" {
+		return name + ", " + rendition.Language
+	}
+
+	return name
+}
@@ -0,0 +1,319 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"codeberg.org/pwnderpants/vtrace/internal/probe"
+	"codeberg.org/pwnderpants/vtrace/internal/stats"
+	"codeberg.org/pwnderpants/vtrace/internal/ttff"
+)
+
+var (
+	urlFile          string
+	batchConcurrency int
+)
+
+// batchTarget is one stream measured by a --url-file run
+type batchTarget struct {
+	URL      string
+	Label    string
+	Samples  []ttff.Sample
+	Failures int
+}
+
+// batchTargets holds the parsed --url-file entries
+var batchTargets []*batchTarget
+
+// batchTargetKey carries the position in batchTargets of the target a sample measures
+type batchTargetKey struct{}
+
+// withBatchTarget marks the samples taken under ctx as measuring the nth batch target
+func withBatchTarget(ctx context.Context, n int) context.Context {
+	return context.WithValue(ctx, batchTargetKey{}, n)
+}
+
+// batchTargetIndex returns the batch target position set by withBatchTarget, if any
+func batchTargetIndex(ctx context.Context) (int, bool) {
+	n, ok := ctx.Value(batchTargetKey{}).(int)
+
+	return n, ok
+}
+
+// validateBatch rejects flags that conflict with --url-file
+func validateBatch() error {
+	if batchConcurrency < 1 {
+		return errors.New("--concurrency must be at least 1")
+	}
+
+	if urlFile == "" {
+		if batchConcurrency > 1 {
+			return errors.New("--concurrency requires --url-file")
+		}
+
+		return nil
+	}
+
+	switch {
+	case compare:
+		return errors.New("--url-file cannot be combined with --compare")
+	case allVariants:
+		return errors.New("--url-file cannot be combined with --all-variants")
+	case checkMode:
+		return errors.New("--url-file cannot be combined with --check")
+	case len(resolverSpecs) > 0:
+		return errors.New("--url-file cannot be combined with --resolvers")
+	case len(interfaceNames) > 0:
+		return errors.New("--url-file cannot be combined with --interfaces")
+	case templatePath != "" || outputFormat == outputInflux:
+		return errors.New("--url-file cannot be combined with --template or --output influx")
+	case confidenceLevel > 0:
+		return errors.New("--url-file cannot be combined with --confidence")
+	case useECH || showHTTPSRR || useHTTPSRR:
+		return errors.New("--url-file cannot be combined with --ech, --https-rr, or --use-https-rr")
+	case limitRateSpec != "" && batchConcurrency > 1:
+		return errors.New("--limit-rate cannot be combined with --concurrency above 1, since parallel targets would drain and refill one shared token bucket")
+	}
+
+	return nil
+}
+
+// loadBatchTargets reads the target list: a URL per line, optionally followed by a
+// label; blank lines and lines starting with # are ignored. The URL set of a config profile
+// takes the place of the file.
+func loadBatchTargets(path string) ([]*batchTarget, error) {
+	if profileURLs != nil {
+		return parseBatchTargets(path, strings.NewReader(strings.Join(profileURLs, "\n")))
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open URL file: %w", err)
+	}
+	defer f.Close()
+
+	return parseBatchTargets(path, f)
+}
+
+// parseBatchTargets reads the lines of a target list named path
+func parseBatchTargets(path string, r io.Reader) ([]*batchTarget, error) {
+	var targets []*batchTarget
+
+	scanner := bufio.NewScanner(r)
+
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+
+		fields := strings.Fields(text)
+
+		normalized, err := probe.NormalizeURL(fields[0])
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: invalid URL: %w", path, line, err)
+		}
+
+		targets = append(targets, &batchTarget{URL: normalized, Label: strings.Join(fields[1:], " ")})
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read URL file: %w", err)
+	}
+
+	if len(targets) == 0 {
+		return nil, fmt.Errorf("%s lists no URLs", path)
+	}
+
+	return targets, nil
+}
+
+// label names a target by its label, or by its (possibly redacted) URL
+func (t *batchTarget) label() string {
+	if t.Label != "" {
+		return t.Label
+	}
+
+	return exportURL(t.URL)
+}
+
+// runBatch measures the targets with up to --concurrency workers and prints a cross-URL summary
+func runBatch(minDelay, maxDelay time.Duration) error {
+	// An interrupt stops the sweep but still summarizes what was measured
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	jobs := make(chan int)
+
+	var wg sync.WaitGroup
+
+	for range min(batchConcurrency, len(batchTargets)) {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			for n := range jobs {
+				measureBatchTarget(ctx, n, minDelay, maxDelay)
+			}
+		}()
+	}
+
+feed:
+	for n := range batchTargets {
+		select {
+		case jobs <- n:
+		case <-ctx.Done():
+			break feed
+		}
+	}
+
+	close(jobs)
+	wg.Wait()
+
+	if ctx.Err() != nil {
+		fmt.Println("\nInterrupted; summarizing the samples measured so far")
+	}
+
+	summaries := make([]stats.PhaseSummary, len(batchTargets))
+
+	for i, target := range batchTargets {
+		summaries[i] = stats.SummarizePhases(ttff.Timings(target.Samples))
+	}
+
+	printBatchResults(summaries)
+
+	if fastest, _ := stats.FastestSlowest(summaries); fastest < 0 {
+		return errors.New("every URL failed")
+	}
+
+	return nil
+}
+
+// measureBatchTarget takes every sample of the nth target under its own context; only
+// this worker touches the target, so its results need no locking
+func measureBatchTarget(parent context.Context, n int, minDelay, maxDelay time.Duration) {
+	ctx, cancel := context.WithCancel(withBatchTarget(parent, n))
+	defer cancel()
+
+	target := batchTargets[n]
+
+	// Progress lines of parallel targets interleave, so each names its target
+	prefix := ""
+
+	if batchConcurrency > 1 {
+		prefix = target.label() + ": "
+	}
+
+	fmt.Printf("[%d/%d] %s\n", n+1, len(batchTargets), target.label())
+
+	for i := 0; i < samples; i++ {
+		if verbose {
+			fmt.Printf("\n── %sSample %d/%d ──\n", prefix, i+1, samples)
+		}
+
+		sample, _, _, err := measureSample(ctx, target.URL, i, protocolHTTP12)
+
+		// Samples cut short by an interrupt are neither failures nor results
+		if ctx.Err() != nil {
+			return
+		}
+
+		// One broken channel must not stop the sweep of the lineup
+		if err != nil {
+			target.Failures++
+
+			fmt.Printf("  %ssample %d failed: %v\n", prefix, i+1, err)
+		} else {
+			target.Samples = append(target.Samples, sample)
+
+			if verbose {
+				fmt.Printf("  %sTTFF: %s\n", prefix, formatDuration(sample.TotalTTFF))
+			}
+		}
+
+		// Apply delay between samples; a sequential sweep also waits between targets
+		if i < samples-1 || (batchConcurrency == 1 && n < len(batchTargets)-1) {
+			sleepDuration := getDelay(minDelay, maxDelay)
+
+			if verbose {
+				fmt.Printf("  %sWaiting %s before next sample...\n", prefix, sleepDuration)
+			}
+
+			select {
+			case <-time.After(sleepDuration):
+			case <-ctx.Done():
+				return
+			}
+		}
+	}
+}
+
+// printBatchResults outputs the per-URL TTFF table
+func printBatchResults(summaries []stats.PhaseSummary) {
+	width := len("Target")
+
+	for _, target := range batchTargets {
+		width = max(width, min(utf8.RuneCountInString(target.label()), 48))
+	}
+
+	rule := strings.Repeat("─", width+85)
+
+	fmt.Printf("\nvtrace batch results for: %s (%d URLs, %d samples each)\n", urlFile, len(batchTargets), samples)
+	fmt.Println(rule)
+	fmt.Printf("%-*s %12s %12s %12s %12s %12s %12s %6s\n", width, "Target", "Manifest", "Segment", "Frame", "Total TTFF", "P95", "StdDev", "Failed")
+	fmt.Println(rule)
+
+	fastest, slowest := stats.FastestSlowest(summaries)
+
+	for i, target := range batchTargets {
+		label := target.label()
+
+		if runes := []rune(label); len(runes) > width {
+			label = string(runes[:width-1]) + "…"
+		}
+
+		s := summaries[i]
+
+		if s.Count == 0 {
+			fmt.Printf("%-*s %12s %12s %12s %12s %12s %12s %6d\n", width, label, "-", "-", "-", "-", "-", "-", target.Failures)
+
+			continue
+		}
+
+		marker := ""
+
+		switch i {
+		case fastest:
+			marker = "  fastest"
+		case slowest:
+			marker = "  slowest"
+		}
+
+		fmt.Printf("%-*s %12s %12s %12s %12s %12s %12s %6d%s\n",
+			width,
+			label,
+			formatDuration(s.ManifestTotal.Mean),
+			formatDuration(s.SegmentTotal.Mean),
+			formatDuration(s.FrameDetection.Mean),
+			formatDuration(s.TotalTTFF.Mean),
+			formatDuration(s.TotalTTFF.Percentile(95)),
+			formatDuration(s.TotalTTFF.StdDev),
+			target.Failures,
+			marker,
+		)
+	}
+
+	fmt.Println(rule)
+	fmt.Println("Manifest, Segment, Frame, and Total TTFF are averages.")
+}
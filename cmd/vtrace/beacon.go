@@ -0,0 +1,114 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"time"
+
+	"codeberg.org/pwnderpants/vtrace/internal/probe"
+	"codeberg.org/pwnderpants/vtrace/internal/sink"
+	"codeberg.org/pwnderpants/vtrace/internal/ttff"
+)
+
+// newRunID generates a random identifier shared by all samples of a run
+func newRunID() string {
+	buf := make([]byte, 8)
+
+	if _, err := rand.Read(buf); err != nil {
+		return fmt.Sprintf("%x", time.Now().UnixNano())
+	}
+
+	return hex.EncodeToString(buf)
+}
+
+// sampleMetrics converts a sample into a map of phase durations in milliseconds
+func sampleMetrics(sample ttff.Sample) map[string]float64 {
+	toMs := func(d time.Duration) float64 {
+		return float64(d) / float64(time.Millisecond)
+	}
+
+	metrics := map[string]float64{
+		"dns_lookup":      toMs(sample.DNSLookup),
+		"tcp_connect":     toMs(sample.TCPConnect),
+		"tls_handshake":   toMs(sample.TLSHandshake),
+		"quic_handshake":  toMs(sample.QUICHandshake),
+		"manifest_ttfb":   toMs(sample.ManifestTTFB),
+		"manifest_total":  toMs(sample.ManifestTotal),
+		"segment_total":   toMs(sample.SegmentTotal),
+		"frame_detection": toMs(sample.FrameDetection),
+		"total_ttff":      toMs(sample.TotalTTFF),
+	}
+
+	// The media playlist is only fetched when the URL named a master playlist
+	if sample.MediaPlaylist > 0 {
+		metrics["media_playlist"] = toMs(sample.MediaPlaylist)
+	}
+
+	// The live edge distance is only reported with --live-edge
+	if sample.LiveEdgeSegments > 0 {
+		metrics["live_edge_distance"] = toMs(sample.LiveEdgeDistance)
+	}
+
+	// Low-Latency HLS phases are only reported when measured
+	if sample.PartDownload > 0 {
+		metrics["part_download"] = toMs(sample.PartDownload)
+	}
+
+	if sample.BlockingReload > 0 {
+		metrics["blocking_reload"] = toMs(sample.BlockingReload)
+	}
+
+	// Key fetch is only reported for AES-128 encrypted playlists
+	if sample.KeyFetch > 0 {
+		metrics["key_fetch"] = toMs(sample.KeyFetch)
+	}
+
+	// Init segments are only reported for fMP4/CMAF streams
+	if sample.InitSegment > 0 {
+		metrics["init_segment"] = toMs(sample.InitSegment)
+	}
+
+	// Audio phases are only reported with --audio; muxed audio has no playlist or segment
+	if sample.TotalTTFA > 0 {
+		metrics["audio_detection"] = toMs(sample.AudioDetection)
+		metrics["total_ttfa"] = toMs(sample.TotalTTFA)
+	}
+
+	if sample.AudioPlaylist > 0 {
+		metrics["audio_playlist"] = toMs(sample.AudioPlaylist)
+		metrics["audio_segment"] = toMs(sample.AudioSegment)
+	}
+
+	// Player join is only reported with --player-cmd when the player signalled readiness
+	if sample.PlayerJoin > 0 {
+		metrics["player_join"] = toMs(sample.PlayerJoin)
+	}
+
+	return metrics
+}
+
+// emitBeacon sends the sample summary of target to the configured beacon URL
+func emitBeacon(target string, index int, protocol string, sample ttff.Sample) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	beacon := sink.Beacon{
+		RunID:     runID,
+		URL:       exportURL(target),
+		Sample:    index + 1,
+		Protocol:  protocol,
+		Timestamp: time.Now().UTC(),
+		Metrics:   sampleMetrics(sample),
+		Decoder:   sample.FrameDecoder,
+
+		Negotiated: sampleNegotiated(sample),
+	}
+
+	// Beacon delivery is best effort and never fails the run
+	if err := sink.SendBeacon(ctx, beaconURL, beacon, probe.NewHTTPClient(timeout)); err != nil {
+		fmt.Fprintf(os.Stderr, "warning: %v\n", err)
+	}
+}
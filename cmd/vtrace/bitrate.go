@@ -0,0 +1,138 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/grafov/m3u8"
+
+	"codeberg.org/pwnderpants/vtrace/internal/decoder"
+	"codeberg.org/pwnderpants/vtrace/internal/ttff"
+)
+
+var (
+	// bitrateMode measures the real bitrate and duration of the first segment
+	bitrateMode bool
+
+	// bitrateTolerance is how far, in percent, the measured bitrate and duration may stray
+	// from the declared BANDWIDTH and EXTINF
+	bitrateTolerance float64
+)
+
+// validateBitrate checks that --bitrate is used with a measurement it can extend
+func validateBitrate() error {
+	if bitrateTolerance < 0 {
+		return errors.New("--bitrate-tolerance must not be negative")
+	}
+
+	if !bitrateMode {
+		return nil
+	}
+
+	if streamProtocol != streamHLS {
+		return errors.New("--bitrate requires --protocol hls")
+	}
+
+	if lowLatency {
+		return errors.New("--bitrate cannot be combined with --ll-hls")
+	}
+
+	return nil
+}
+
+// checkBitrate measures the media time of the first segment from its frame timestamps and
+// derives its real bitrate from the downloaded size, flagging deviations from the variant's
+// BANDWIDTH (or AVERAGE-BANDWIDTH) and the segment's EXTINF. Warnings are flagged on the
+// sample without failing it.
+func checkBitrate(ctx context.Context, variant *m3u8.Variant, media *m3u8.MediaPlaylist, segmentData []byte, sample *ttff.Sample) {
+	cadence := sample.Cadence
+
+	if cadence == nil {
+		var err error
+
+		cadence, err = decoder.DetectCadence(ctx, segmentData)
+		if err != nil {
+			sample.BitrateIssues = []string{fmt.Sprintf("segment duration not read: %v", err)}
+
+			return
+		}
+	}
+
+	sample.SegmentDuration = cadence.Duration
+	sample.SegmentBitrate = float64(sample.SegmentBytes*8) / cadence.Duration.Seconds()
+
+	var issues []string
+
+	if segment := firstSegment(media); segment != nil && segment.Duration > 0 {
+		declared := time.Duration(segment.Duration * float64(time.Second))
+
+		if deviation := percentDeviation(cadence.Duration.Seconds(), segment.Duration); math.Abs(deviation) > bitrateTolerance {
+			issues = append(issues, fmt.Sprintf("segment carries %s of media but EXTINF declares %s (%+.1f%%)", formatSeconds(cadence.Duration), formatSeconds(declared), deviation))
+		}
+	}
+
+	if variant != nil {
+		// AVERAGE-BANDWIDTH is what a segment should carry; BANDWIDTH is a peak it must not exceed
+		if variant.AverageBandwidth > 0 {
+			if deviation := percentDeviation(sample.SegmentBitrate, float64(variant.AverageBandwidth)); math.Abs(deviation) > bitrateTolerance {
+				issues = append(issues, fmt.Sprintf("segment bitrate %s deviates from AVERAGE-BANDWIDTH=%d (%+.1f%%)", formatMbps(sample.SegmentBitrate), variant.AverageBandwidth, deviation))
+			}
+		}
+
+		deviation := percentDeviation(sample.SegmentBitrate, float64(variant.Bandwidth))
+
+		switch {
+		case variant.Bandwidth == 0:
+		case deviation > bitrateTolerance:
+			issues = append(issues, fmt.Sprintf("segment bitrate %s exceeds BANDWIDTH=%d (%+.1f%%)", formatMbps(sample.SegmentBitrate), variant.Bandwidth, deviation))
+		case variant.AverageBandwidth == 0 && -deviation > bitrateTolerance:
+			issues = append(issues, fmt.Sprintf("segment bitrate %s is below BANDWIDTH=%d (%+.1f%%)", formatMbps(sample.SegmentBitrate), variant.Bandwidth, deviation))
+		}
+	}
+
+	sample.BitrateIssues = issues
+}
+
+// firstSegment returns the segment measured in a media playlist
+func firstSegment(media *m3u8.MediaPlaylist) *m3u8.MediaSegment {
+	if media == nil {
+		return nil
+	}
+
+	for _, segment := range media.Segments {
+		if segment != nil && segment.URI != "" {
+			return segment
+		}
+	}
+
+	return nil
+}
+
+// percentDeviation returns how far measured is from declared, in percent of declared
+func percentDeviation(measured, declared float64) float64 {
+	return (measured - declared) / declared * 100
+}
+
+// formatSeconds renders a media duration in seconds with millisecond precision
+func formatSeconds(d time.Duration) string {
+	return fmt.Sprintf("%.3fs", d.Seconds())
+}
+
+// printBitrateChecks summarizes the real bitrate and duration of the segment and their
+// deviations from the playlist across every sample that checked one
+func printBitrateChecks(allSamples []ttff.Sample) {
+	for i := len(allSamples) - 1; i >= 0; i-- {
+		if sample := allSamples[i]; sample.SegmentDuration > 0 {
+			fmt.Printf("Bitrate: %s over %s of media (%s)\n", formatMbps(sample.SegmentBitrate), formatSeconds(sample.SegmentDuration), formatBytes(int(sample.SegmentBytes)))
+
+			break
+		}
+	}
+
+	printVideoIssues("Bitrate", allSamples, func(sample ttff.Sample) ([]string, bool) {
+		return sample.BitrateIssues, sample.SegmentDuration > 0 || len(sample.BitrateIssues) > 0
+	})
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"codeberg.org/pwnderpants/vtrace/internal/ttff"
+)
+
+// phaseBudgets holds the parsed --budget values keyed by phase
+var phaseBudgets map[string]time.Duration
+
+// recordBudgetAbort tallies a budget-aborted sample by phase and reports whether err was one
+func recordBudgetAbort(tally map[string]int, err error) bool {
+	var be *ttff.BudgetError
+
+	if !errors.As(err, &be) {
+		return false
+	}
+
+	tally[be.Phase]++
+
+	return true
+}
+
+// printBudgetSummary outputs how many samples were aborted per phase
+func printBudgetSummary(label string, tally map[string]int, attempted int) {
+	if len(tally) == 0 {
+		return
+	}
+
+	phases := make([]string, 0, len(tally))
+	aborted := 0
+
+	for phase, n := range tally {
+		phases = append(phases, phase)
+		aborted += n
+	}
+
+	sort.Strings(phases)
+
+	parts := make([]string, len(phases))
+
+	for i, phase := range phases {
+		parts[i] = fmt.Sprintf("%s: %d", phase, tally[phase])
+	}
+
+	fmt.Printf("\n%sBudget exceeded: %d of %d samples aborted (%s)\n", label, aborted, attempted, strings.Join(parts, ", "))
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/grafov/m3u8"
+
+	"codeberg.org/pwnderpants/vtrace/internal/decoder"
+	"codeberg.org/pwnderpants/vtrace/internal/ttff"
+)
+
+// frameRateTolerance is how far the measured frame rate may stray from FRAME-RATE
+const frameRateTolerance = 0.01
+
+// cadenceMode measures the frame rate and cadence of the first segment
+var cadenceMode bool
+
+// validateCadence checks that --cadence is used with a measurement it can extend
+func validateCadence() error {
+	if !cadenceMode {
+		return nil
+	}
+
+	if streamProtocol != streamHLS {
+		return errors.New("--cadence requires --protocol hls")
+	}
+
+	if lowLatency {
+		return errors.New("--cadence cannot be combined with --ll-hls")
+	}
+
+	return nil
+}
+
+// checkCadence reconstructs the frame timing of the video segment and warns about frames
+// that would stutter on playback. Warnings are flagged on the sample without failing it.
+func checkCadence(ctx context.Context, variant *m3u8.Variant, segmentData []byte, sample *ttff.Sample) {
+	cadence, err := decoder.DetectCadence(ctx, segmentData)
+	if err != nil {
+		sample.CadenceIssues = []string{fmt.Sprintf("frame timing not read: %v", err)}
+
+		return
+	}
+
+	sample.Cadence = cadence
+
+	var issues []string
+
+	if cadence.Dropped > 0 {
+		issues = append(issues, fmt.Sprintf("%d dropped %s in timestamp gaps", cadence.Dropped, plural(cadence.Dropped, "frame")))
+	}
+
+	if cadence.Duplicated > 0 {
+		issues = append(issues, fmt.Sprintf("%d duplicated %s with repeated timestamps", cadence.Duplicated, plural(cadence.Duplicated, "frame")))
+	}
+
+	if cadence.Irregular > 0 {
+		issues = append(issues, fmt.Sprintf("%d irregular frame %s more than 10%% off %s", cadence.Irregular, plural(cadence.Irregular, "interval"), formatDuration(cadence.Interval)))
+	}
+
+	if cadence.Telecine {
+		issues = append(issues, "3:2 pulldown: frames alternate two- and three-field durations, as in telecined film")
+	}
+
+	// The nominal rate ignores drops, which are reported on their own
+	nominal := float64(time.Second) / float64(cadence.Interval)
+
+	if variant != nil && variant.FrameRate > 0 && !matchesFrameRate(cadence, nominal, variant.FrameRate) {
+		issues = append(issues, fmt.Sprintf("frame rate %.3f fps does not match FRAME-RATE=%.3f", nominal, variant.FrameRate))
+	}
+
+	sample.CadenceIssues = issues
+}
+
+// matchesFrameRate reports whether the nominal rate agrees with FRAME-RATE. Pulldown
+// content may declare either its film rate or the field-pair rate it displays at.
+func matchesFrameRate(cadence *decoder.Cadence, nominal, declared float64) bool {
+	if math.Abs(nominal-declared) <= declared*frameRateTolerance {
+		return true
+	}
+
+	return cadence.Telecine && math.Abs(nominal*5/4-declared) <= declared*frameRateTolerance
+}
+
+// plural appends an s to a noun unless the count is one
+func plural(count int, noun string) string {
+	if count == 1 {
+		return noun
+	}
+
+	return noun + "s"
+}
+
+// printCadenceChecks summarizes the frame timing of the segment and its warnings across
+// every sample that checked one
+func printCadenceChecks(allSamples []ttff.Sample) {
+	var last *decoder.Cadence
+
+	for _, sample := range allSamples {
+		if sample.Cadence != nil {
+			last = sample.Cadence
+		}
+	}
+
+	if last != nil {
+		fmt.Printf("Cadence: %d frames, %.3f fps measured, %s frame interval", last.Frames, last.FrameRate, formatDuration(last.Interval))
+
+		if last.Telecine {
+			fmt.Print(" (3:2 pulldown)")
+		}
+
+		fmt.Println()
+	}
+
+	printVideoIssues("Cadence", allSamples, func(sample ttff.Sample) ([]string, bool) {
+		return sample.CadenceIssues, sample.Cadence != nil || len(sample.CadenceIssues) > 0
+	})
+}
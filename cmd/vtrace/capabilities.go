@@ -0,0 +1,110 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"codeberg.org/pwnderpants/vtrace/internal/probe"
+)
+
+// capabilitiesTimeout bounds each probe; the measurement --timeout has another default
+var capabilitiesTimeout time.Duration
+
+var capabilitiesCmd = &cobra.Command{
+	Use:   "capabilities",
+	Short: "Report the protocol features an endpoint supports",
+	Long: `capabilities probes an endpoint and reports the HTTP versions, negotiated
+ALPN, TLS versions, content codings, range request support, Alt-Svc
+advertisement, and IPv6 reachability it offers. Use it as a quick pre-flight
+check before configuring long measurement campaigns.`,
+	RunE: runCapabilities,
+}
+
+// init registers the capabilities subcommand and its flags
+func init() {
+	capabilitiesCmd.Flags().StringVarP(&url, "url", "u", "", "Endpoint URL (required)")
+	capabilitiesCmd.Flags().DurationVarP(&capabilitiesTimeout, "timeout", "t", 10*time.Second, "Timeout for each probe")
+
+	capabilitiesCmd.MarkFlagRequired("url")
+
+	rootCmd.AddCommand(capabilitiesCmd)
+}
+
+// runCapabilities executes the capability discovery probes
+func runCapabilities(cmd *cobra.Command, args []string) error {
+	// Normalize the target URL (punycode hosts, IPv6 literals, userinfo)
+	normalized, err := probe.NormalizeURL(url)
+	if err != nil {
+		return fmt.Errorf("invalid URL: %w", err)
+	}
+
+	url = normalized
+
+	caps, err := probe.DiscoverCapabilities(context.Background(), url, capabilitiesTimeout)
+	if err != nil {
+		return err
+	}
+
+	printCapabilities(caps)
+
+	return nil
+}
+
+// printCapabilities outputs the capability discovery report
+func printCapabilities(caps *probe.Capabilities) {
+	fmt.Printf("vtrace capabilities for: %s\n", caps.URL)
+	fmt.Println("────────────────────────────────────────────────────")
+	fmt.Printf("%-20s %d\n", "Status:", caps.StatusCode)
+	fmt.Printf("%-20s %s\n", "HTTP/1.1:", yesNo(caps.HTTP11))
+	fmt.Printf("%-20s %s\n", "HTTP/2:", yesNo(caps.HTTP2))
+
+	if caps.HTTP3Err != nil {
+		fmt.Printf("%-20s no (%v)\n", "HTTP/3:", caps.HTTP3Err)
+	} else {
+		fmt.Printf("%-20s %s\n", "HTTP/3:", yesNo(caps.HTTP3))
+	}
+
+	fmt.Printf("%-20s %s\n", "ALPN:", orNone(caps.ALPN))
+	fmt.Printf("%-20s %s\n", "TLS versions:", orNone(strings.Join(caps.TLSVersions, ", ")))
+	fmt.Printf("%-20s %s\n", "Compression:", orNone(strings.Join(caps.Compression, ", ")))
+	fmt.Printf("%-20s %s\n", "Range requests:", yesNo(caps.RangeRequests))
+	fmt.Printf("%-20s %s\n", "Accept-Ranges:", orNone(caps.AcceptRanges))
+	fmt.Printf("%-20s %s\n", "Alt-Svc:", orNone(caps.AltSvc))
+
+	if len(caps.IPv6Addrs) == 0 {
+		fmt.Printf("%-20s %s\n", "IPv6:", "no AAAA records")
+	} else {
+		fmt.Printf("%-20s %s (%s)\n", "IPv6:", reachability(caps.IPv6Reachable), strings.Join(caps.IPv6Addrs, ", "))
+	}
+}
+
+// yesNo formats a boolean capability
+func yesNo(ok bool) string {
+	if ok {
+		return "yes"
+	}
+
+	return "no"
+}
+
+// orNone substitutes a placeholder for empty values
+func orNone(s string) string {
+	if s == "" {
+		return "none"
+	}
+
+	return s
+}
+
+// reachability formats whether an address family accepted connections
+func reachability(ok bool) string {
+	if ok {
+		return "reachable"
+	}
+
+	return "unreachable"
+}
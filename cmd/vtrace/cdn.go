@@ -0,0 +1,312 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"codeberg.org/pwnderpants/vtrace/internal/probe"
+	"codeberg.org/pwnderpants/vtrace/internal/stats"
+	"codeberg.org/pwnderpants/vtrace/internal/ttff"
+)
+
+// describeCDN summarizes the cache verdict of one response with the CDN, POP, and age, noting
+// when the CDN was recognized from its address rather than its headers
+func describeCDN(info *probe.CDNInfo, edge probe.CDNIdentity) string {
+	if info == nil && edge.Provider == "" {
+		return "no CDN identified"
+	}
+
+	verdict := "no cache status"
+
+	if info != nil && info.Cache != "" {
+		verdict = info.Cache
+	}
+
+	var details []string
+
+	if edge.Provider != "" {
+		details = append(details, edge.Provider)
+	}
+
+	if edge.POP != "" {
+		details = append(details, "POP "+edge.POP)
+	}
+
+	if info != nil && info.HasAge {
+		details = append(details, "age "+info.Age.String())
+	}
+
+	if edge.Source != "" && edge.Source != probe.CDNSourceHeaders {
+		details = append(details, "by "+edge.Source)
+	}
+
+	if len(details) == 0 {
+		return verdict
+	}
+
+	return verdict + " (" + strings.Join(details, ", ") + ")"
+}
+
+// describeServerTiming lists the Server-Timing metrics of one response, durations first
+func describeServerTiming(timings []probe.ServerTiming) string {
+	parts := make([]string, 0, len(timings))
+
+	for _, timing := range timings {
+		switch {
+		case timing.HasDuration:
+			parts = append(parts, timing.Name+" "+formatDuration(timing.Duration))
+		case timing.Description != "":
+			parts = append(parts, timing.Name+"="+timing.Description)
+		default:
+			parts = append(parts, timing.Name)
+		}
+	}
+
+	return strings.Join(parts, ", ")
+}
+
+// printSampleCDN prints the CDN, cache verdict, and Server-Timing metrics of a sample's responses
+func printSampleCDN(sample ttff.Sample) {
+	for _, request := range []struct {
+		label string
+		info  *probe.CDNInfo
+		edge  probe.CDNIdentity
+	}{
+		{"manifest", sample.ManifestCDN, sample.ManifestEdge},
+		{"segment", sample.SegmentCDN, sample.SegmentEdge},
+	} {
+		if request.info == nil && request.edge.Provider == "" && request.edge.Host == "" {
+			continue
+		}
+
+		fmt.Printf("CDN (%s): %s\n", request.label, describeCDN(request.info, request.edge))
+
+		if request.edge.Host != "" {
+			fmt.Printf("  Reverse DNS: %s\n", request.edge.Host)
+		}
+
+		if request.info == nil {
+			continue
+		}
+
+		if request.info.CacheHeader != "" {
+			fmt.Printf("  %s\n", request.info.CacheHeader)
+		}
+
+		if len(request.info.Timings) > 0 {
+			fmt.Printf("  Server-Timing: %s\n", describeServerTiming(request.info.Timings))
+		}
+	}
+}
+
+// printCDN reports the CDN, POP, and cache verdict behind the samples' manifest and segment
+// requests, the origin-reported Server-Timing durations, and Total TTFF per segment CDN when
+// several served the run; nothing is printed when no CDN was identified
+func printCDN(allSamples []ttff.Sample) {
+	manifest := make([]*probe.CDNInfo, len(allSamples))
+	segment := make([]*probe.CDNInfo, len(allSamples))
+	manifestEdges := make([]probe.CDNIdentity, len(allSamples))
+	segmentEdges := make([]probe.CDNIdentity, len(allSamples))
+	found := false
+
+	for i, sample := range allSamples {
+		manifest[i], manifestEdges[i] = sample.ManifestCDN, sample.ManifestEdge
+		segment[i], segmentEdges[i] = sample.SegmentCDN, sample.SegmentEdge
+
+		found = found || sample.ManifestCDN != nil || sample.SegmentCDN != nil ||
+			sample.ManifestEdge.Provider != "" || sample.SegmentEdge.Provider != ""
+	}
+
+	if !found {
+		return
+	}
+
+	fmt.Println("\nCDN:")
+	fmt.Printf("  Manifest: %s\n", summarizeCDN(manifest, manifestEdges))
+	fmt.Printf("  Segment:  %s\n", summarizeCDN(segment, segmentEdges))
+
+	for _, request := range []struct {
+		label string
+		infos []*probe.CDNInfo
+	}{
+		{"manifest", manifest},
+		{"segment", segment},
+	} {
+		if timings := summarizeServerTiming(request.infos); timings != "" {
+			fmt.Printf("  Server-Timing (%s): %s\n", request.label, timings)
+		}
+	}
+
+	printTTFFByCDN(allSamples)
+}
+
+// summarizeCDN counts the cache verdicts across samples and names the CDNs and POPs that
+// answered
+func summarizeCDN(infos []*probe.CDNInfo, edges []probe.CDNIdentity) string {
+	if len(infos) == 1 {
+		return describeCDN(infos[0], edges[0])
+	}
+
+	verdicts := make(map[string]int)
+	providers := make(map[string]bool)
+	pops := make(map[string]bool)
+
+	for i, info := range infos {
+		switch {
+		case info == nil:
+			verdicts["no cache headers"]++
+		case info.Cache == "":
+			verdicts["no cache status"]++
+		default:
+			verdicts[info.Cache]++
+		}
+
+		if edges[i].Provider != "" {
+			providers[edges[i].Provider] = true
+		}
+
+		if edges[i].POP != "" {
+			pops[edges[i].POP] = true
+		}
+	}
+
+	names := make([]string, 0, len(verdicts))
+
+	for name := range verdicts {
+		names = append(names, name)
+	}
+
+	// Most frequent verdict first
+	sort.Slice(names, func(i, j int) bool {
+		if verdicts[names[i]] != verdicts[names[j]] {
+			return verdicts[names[i]] > verdicts[names[j]]
+		}
+
+		return names[i] < names[j]
+	})
+
+	parts := make([]string, len(names))
+
+	for i, name := range names {
+		parts[i] = fmt.Sprintf("%s %d", name, verdicts[name])
+	}
+
+	summary := fmt.Sprintf("%s of %d samples", strings.Join(parts, ", "), len(infos))
+
+	var details []string
+
+	if len(providers) > 0 {
+		details = append(details, strings.Join(sortedKeys(providers), ", "))
+	}
+
+	if len(pops) > 0 {
+		details = append(details, plural(len(pops), "POP")+" "+strings.Join(sortedKeys(pops), ", "))
+	}
+
+	if len(details) == 0 {
+		return summary
+	}
+
+	return summary + " (" + strings.Join(details, "; ") + ")"
+}
+
+// printTTFFByCDN breaks Total TTFF down by the CDN and POP that served the segment, when
+// samples were served by more than one
+func printTTFFByCDN(allSamples []ttff.Sample) {
+	var order []string
+
+	groups := make(map[string][]time.Duration)
+
+	for _, sample := range allSamples {
+		edge := sample.SegmentEdge
+		name := edge.Provider
+
+		if name == "" {
+			name = "unidentified"
+		}
+
+		if edge.POP != "" {
+			name += " " + edge.POP
+		}
+
+		if _, ok := groups[name]; !ok {
+			order = append(order, name)
+		}
+
+		groups[name] = append(groups[name], sample.TotalTTFF)
+	}
+
+	if len(groups) < 2 {
+		return
+	}
+
+	sort.Strings(order)
+
+	fmt.Println("  Total TTFF by segment CDN:")
+
+	for _, name := range order {
+		s := stats.ComputeStats(groups[name])
+
+		fmt.Printf("    %-24s %3d %-7s  mean %s  median %s\n", name, len(groups[name]), plural(len(groups[name]), "sample"),
+			formatDuration(s.Mean), formatDuration(s.Median))
+	}
+}
+
+// summarizeServerTiming averages each Server-Timing duration over the samples that reported
+// it, in the order the metrics first appeared
+func summarizeServerTiming(infos []*probe.CDNInfo) string {
+	var order []string
+
+	durations := make(map[string][]time.Duration)
+
+	for _, info := range infos {
+		if info == nil {
+			continue
+		}
+
+		for _, timing := range info.Timings {
+			if !timing.HasDuration {
+				continue
+			}
+
+			if _, ok := durations[timing.Name]; !ok {
+				order = append(order, timing.Name)
+			}
+
+			durations[timing.Name] = append(durations[timing.Name], timing.Duration)
+		}
+	}
+
+	parts := make([]string, len(order))
+
+	for i, name := range order {
+		values := durations[name]
+		mean := stats.ComputeStats(values).Mean
+
+		switch {
+		case len(infos) == 1:
+			parts[i] = name + " " + formatDuration(mean)
+		case len(values) == len(infos):
+			parts[i] = fmt.Sprintf("%s %s mean", name, formatDuration(mean))
+		default:
+			parts[i] = fmt.Sprintf("%s %s mean (%d of %d samples)", name, formatDuration(mean), len(values), len(infos))
+		}
+	}
+
+	return strings.Join(parts, ", ")
+}
+
+// sortedKeys returns the keys of a set in order
+func sortedKeys(set map[string]bool) []string {
+	keys := make([]string, 0, len(set))
+
+	for key := range set {
+		keys = append(keys, key)
+	}
+
+	sort.Strings(keys)
+
+	return keys
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"codeberg.org/pwnderpants/vtrace/internal/probe"
+)
+
+var (
+	cdnRangesPath string
+
+	// cdnIdentifier names the CDN and POP behind each request; created on first use when
+	// setupCDNIdentifier did not run
+	cdnIdentifier *probe.CDNIdentifier
+)
+
+// setupCDNIdentifier loads --cdn-ranges ahead of the built-in CDN address ranges
+func setupCDNIdentifier() error {
+	var extra []probe.CDNRange
+
+	if cdnRangesPath != "" {
+		file, err := os.Open(cdnRangesPath)
+		if err != nil {
+			return fmt.Errorf("failed to open --cdn-ranges: %w", err)
+		}
+		defer file.Close()
+
+		extra, err = probe.ParseCDNRanges(file)
+		if err != nil {
+			return fmt.Errorf("invalid --cdn-ranges: %w", err)
+		}
+	}
+
+	cdnIdentifier = probe.NewCDNIdentifier(extra)
+
+	return nil
+}
+
+// identifyEdge names the CDN and POP that served a traced request; through --proxy the
+// connection address is the proxy's, so only the response headers count
+func identifyEdge(ctx context.Context, trace *probe.Trace) probe.CDNIdentity {
+	if trace == nil {
+		return probe.CDNIdentity{}
+	}
+
+	if cdnIdentifier == nil {
+		cdnIdentifier = probe.NewCDNIdentifier(nil)
+	}
+
+	remoteAddr := trace.Conn.RemoteAddr
+
+	if proxyURL != nil {
+		remoteAddr = ""
+	}
+
+	return cdnIdentifier.Identify(ctx, trace.CDN, remoteAddr)
+}
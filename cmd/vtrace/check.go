@@ -0,0 +1,161 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"codeberg.org/pwnderpants/vtrace/internal/stats"
+	"codeberg.org/pwnderpants/vtrace/internal/ttff"
+)
+
+// checkState is a Nagios plugin status with its conventional exit code
+type checkState int
+
+const (
+	stateOK       checkState = 0
+	stateWarning  checkState = 1
+	stateCritical checkState = 2
+	stateUnknown  checkState = 3
+)
+
+// checkStateNames maps plugin states to their status labels
+var checkStateNames = map[checkState]string{
+	stateOK:       "OK",
+	stateWarning:  "WARNING",
+	stateCritical: "CRITICAL",
+	stateUnknown:  "UNKNOWN",
+}
+
+var (
+	checkMode          bool
+	checkWarnThreshold time.Duration
+	checkCritThreshold time.Duration
+)
+
+// runCheck measures TTFF and reports a single Nagios/Icinga status line with perfdata
+func runCheck(minDelay, maxDelay time.Duration) error {
+	if compare {
+		return checkUnknown(errors.New("--check cannot be combined with --compare"))
+	}
+
+	if checkWarnThreshold > 0 && checkCritThreshold > 0 && checkWarnThreshold > checkCritThreshold {
+		return checkUnknown(errors.New("--warning must not exceed --critical"))
+	}
+
+	var allSamples []ttff.Sample
+
+	budgetAborts := make(map[string]int)
+
+	for i := 0; i < samples; i++ {
+		sample, _, _, err := measureSample(context.Background(), url, i, protocolHTTP12)
+
+		switch {
+		case recordBudgetAbort(budgetAborts, err):
+		case err != nil:
+			return checkResult(stateCritical, fmt.Sprintf("sample %d failed: %v", i+1, err), "")
+		default:
+			allSamples = append(allSamples, sample)
+		}
+
+		// Apply delay between samples (skip after last sample)
+		if i < samples-1 {
+			time.Sleep(getDelay(minDelay, maxDelay))
+		}
+	}
+
+	aborted := samples - len(allSamples)
+
+	if len(allSamples) == 0 {
+		return checkResult(stateCritical, fmt.Sprintf("all %d samples exceeded a phase budget", samples), "")
+	}
+
+	meanTTFF := stats.ComputeStats(stats.ExtractTotalTTFF(ttff.Timings(allSamples))).Mean
+
+	state := stateOK
+
+	switch {
+	case checkCritThreshold > 0 && meanTTFF >= checkCritThreshold:
+		state = stateCritical
+	case checkWarnThreshold > 0 && meanTTFF >= checkWarnThreshold:
+		state = stateWarning
+	case aborted > 0:
+		// Budget aborts mean part of the run was clearly broken
+		state = stateWarning
+	}
+
+	summary := fmt.Sprintf("TTFF %s", formatDuration(meanTTFF))
+
+	if samples > 1 {
+		summary += fmt.Sprintf(" (mean of %d samples)", len(allSamples))
+	}
+
+	if aborted > 0 {
+		summary += fmt.Sprintf(", %d aborted over budget", aborted)
+	}
+
+	return checkResult(state, summary, checkPerfdata(allSamples))
+}
+
+// checkPerfdata formats mean phase timings as Nagios performance data
+func checkPerfdata(allSamples []ttff.Sample) string {
+	timings := ttff.Timings(allSamples)
+
+	mean := func(durations []time.Duration) time.Duration {
+		return stats.ComputeStats(durations).Mean
+	}
+
+	perf := []string{
+		perfValue("ttff", mean(stats.ExtractTotalTTFF(timings)), checkWarnThreshold, checkCritThreshold),
+		perfValue("dns", mean(stats.ExtractDNSLookup(timings)), 0, 0),
+		perfValue("tcp", mean(stats.ExtractTCPConnect(timings)), 0, 0),
+		perfValue("tls", mean(stats.ExtractTLSHandshake(timings)), 0, 0),
+		perfValue("manifest_ttfb", mean(stats.ExtractManifestTTFB(timings)), 0, 0),
+		perfValue("segment", mean(stats.ExtractSegmentTotal(timings)), 0, 0),
+		perfValue("frame", mean(stats.ExtractFrameDetection(timings)), 0, 0),
+	}
+
+	if audioMode {
+		perf = append(perf, perfValue("ttfa", mean(stats.ExtractTotalTTFA(timings)), 0, 0))
+	}
+
+	return strings.Join(perf, " ")
+}
+
+// perfValue formats one perfdata entry in seconds with optional thresholds
+func perfValue(label string, value, warn, crit time.Duration) string {
+	threshold := func(d time.Duration) string {
+		if d <= 0 {
+			return ""
+		}
+
+		return strconv.FormatFloat(d.Seconds(), 'f', -1, 64)
+	}
+
+	return fmt.Sprintf("%s=%.6fs;%s;%s;0;", label, value.Seconds(), threshold(warn), threshold(crit))
+}
+
+// checkResult prints the plugin status line and returns the matching exit code
+func checkResult(state checkState, summary, perfdata string) error {
+	line := fmt.Sprintf("VTRACE %s - %s", checkStateNames[state], summary)
+
+	if perfdata != "" {
+		line += " | " + perfdata
+	}
+
+	fmt.Println(line)
+
+	if state == stateOK {
+		return nil
+	}
+
+	return &exitError{code: int(state), err: errors.New(line)}
+}
+
+// checkUnknown reports a setup or usage failure as UNKNOWN
+func checkUnknown(err error) error {
+	return checkResult(stateUnknown, err.Error(), "")
+}
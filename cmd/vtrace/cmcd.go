@@ -0,0 +1,75 @@
+package main
+
+import (
+	"crypto/rand"
+	"errors"
+	"fmt"
+
+	"codeberg.org/pwnderpants/vtrace/internal/probe"
+)
+
+var (
+	cmcdMode      string
+	cmcdSessionID string
+	cmcdContentID string
+	cmcdStarved   bool
+
+	// cmcdData is attached to every request; nil unless --cmcd is set
+	cmcdData *probe.CMCD
+)
+
+// setupCMCD validates --cmcd and fills in the session ID and streaming format
+func setupCMCD() error {
+	cmcdData = nil
+
+	if cmcdMode == "" {
+		if cmcdSessionID != "" || cmcdContentID != "" || cmcdStarved {
+			return errors.New("--cmcd-sid, --cmcd-cid, and --cmcd-starved require --cmcd")
+		}
+
+		return nil
+	}
+
+	if cmcdMode != probe.CMCDQuery && cmcdMode != probe.CMCDHeader {
+		return fmt.Errorf("invalid --cmcd %q (want %s or %s)", cmcdMode, probe.CMCDQuery, probe.CMCDHeader)
+	}
+
+	sessionID := cmcdSessionID
+
+	if sessionID == "" {
+		sessionID = newSessionID()
+	}
+
+	format := probe.CMCDFormatHLS
+
+	if streamProtocol == streamDASH {
+		format = probe.CMCDFormatDASH
+	}
+
+	cmcdData = &probe.CMCD{
+		Mode:      cmcdMode,
+		SessionID: sessionID,
+		ContentID: cmcdContentID,
+		Format:    format,
+		Starved:   cmcdStarved,
+	}
+
+	if verbose {
+		fmt.Printf("CMCD session: %s (%s)\n", sessionID, cmcdMode)
+	}
+
+	return nil
+}
+
+// newSessionID generates a random (version 4) UUID, the session ID format CTA-5004 recommends
+func newSessionID() string {
+	buf := make([]byte, 16)
+
+	// crypto/rand.Read never returns an error
+	rand.Read(buf)
+
+	buf[6] = buf[6]&0x0f | 0x40
+	buf[8] = buf[8]&0x3f | 0x80
+
+	return fmt.Sprintf("%x-%x-%x-%x-%x", buf[0:4], buf[4:6], buf[6:8], buf[8:10], buf[10:16])
+}
@@ -0,0 +1,189 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/grafov/m3u8"
+
+	"codeberg.org/pwnderpants/vtrace/internal/decoder"
+	"codeberg.org/pwnderpants/vtrace/internal/ttff"
+)
+
+// codecMode checks the codec, profile, and level of the first segment against the
+// variant's CODECS attribute
+var codecMode bool
+
+// validateCodecs checks that --codecs is used with a measurement it can extend
+func validateCodecs() error {
+	if !codecMode {
+		return nil
+	}
+
+	if streamProtocol != streamHLS {
+		return errors.New("--codecs requires --protocol hls")
+	}
+
+	if lowLatency {
+		return errors.New("--codecs cannot be combined with --ll-hls")
+	}
+
+	return nil
+}
+
+// declaredCodec is the profile, tier, and level an H.264/H.265 CODECS entry declares
+type declaredCodec struct {
+	profile  int
+	level    int
+	highTier bool
+}
+
+// parseDeclaredCodec reads an avc1/avc3 (avc1.PPCCLL, or the legacy avc1.PP.LL decimal form)
+// or hvc1/hev1 (hvc1.P.C.TL.CC) codec string, reporting false for anything else
+func parseDeclaredCodec(codec string) (declaredCodec, bool) {
+	parts := strings.Split(codec, ".")
+
+	switch parts[0] {
+	case "avc1", "avc3":
+		if len(parts) == 2 && len(parts[1]) == 6 {
+			value, err := strconv.ParseUint(parts[1], 16, 32)
+			if err != nil {
+				return declaredCodec{}, false
+			}
+
+			return declaredCodec{profile: int(value >> 16), level: int(value & 0xff)}, true
+		}
+
+		if len(parts) == 3 {
+			profile, profileErr := strconv.Atoi(parts[1])
+			level, levelErr := strconv.Atoi(parts[2])
+
+			return declaredCodec{profile: profile, level: level}, profileErr == nil && levelErr == nil
+		}
+	case "hvc1", "hev1":
+		if len(parts) < 4 || parts[3] == "" {
+			return declaredCodec{}, false
+		}
+
+		profile, profileErr := strconv.Atoi(strings.TrimLeft(parts[1], "ABC"))
+		level, levelErr := strconv.Atoi(parts[3][1:])
+		tier := parts[3][0]
+
+		if profileErr != nil || levelErr != nil || (tier != 'L' && tier != 'H') {
+			return declaredCodec{}, false
+		}
+
+		return declaredCodec{profile: profile, level: level, highTier: tier == 'H'}, true
+	}
+
+	return declaredCodec{}, false
+}
+
+// codecIssues compares the codec, profile, tier, and level of the segment with the variant's
+// CODECS attribute. Media playlists measured directly declare nothing.
+func codecIssues(info *decoder.StreamInfo, variant *m3u8.Variant) []string {
+	if variant == nil {
+		return nil
+	}
+
+	if strings.TrimSpace(variant.Codecs) == "" {
+		return []string{fmt.Sprintf("variant declares no CODECS; the segment carries %s", describeCodec(info))}
+	}
+
+	codec, family := videoCodec(variant.Codecs)
+
+	if codec == "" {
+		return []string{fmt.Sprintf("CODECS %q lists no video codec but the segment carries %s", variant.Codecs, describeCodec(info))}
+	}
+
+	if family != info.Codec {
+		return []string{fmt.Sprintf("CODECS %s declares %s but the segment carries %s", codec, codecFamilyName(family), describeCodec(info))}
+	}
+
+	// Dolby Vision entries (dvh1, dvhe) carry their own profile and level numbering
+	declared, ok := parseDeclaredCodec(codec)
+	if !ok || info.Profile == 0 {
+		return nil
+	}
+
+	var issues []string
+
+	if declared.profile != info.Profile {
+		issues = append(issues, fmt.Sprintf("CODECS %s declares %s profile but the segment is %s", codec, decoder.ProfileName(family, declared.profile), decoder.ProfileName(family, info.Profile)))
+	}
+
+	if family == "hevc" && declared.highTier != info.HighTier {
+		issues = append(issues, fmt.Sprintf("CODECS %s declares %s tier but the segment uses %s tier", codec, tierName(declared.highTier), tierName(info.HighTier)))
+	}
+
+	switch {
+	case info.Level > declared.level:
+		issues = append(issues, fmt.Sprintf("segment level %s exceeds level %s declared by CODECS %s", decoder.LevelName(family, info.Level), decoder.LevelName(family, declared.level), codec))
+	case info.Level < declared.level && info.Level > 0:
+		issues = append(issues, fmt.Sprintf("segment level %s is below level %s declared by CODECS %s", decoder.LevelName(family, info.Level), decoder.LevelName(family, declared.level), codec))
+	}
+
+	return issues
+}
+
+// tierName names an H.265 tier
+func tierName(high bool) string {
+	if high {
+		return "High"
+	}
+
+	return "Main"
+}
+
+// codecFamilyName names a codec family for display
+func codecFamilyName(family string) string {
+	switch family {
+	case "h264":
+		return "H.264"
+	case "hevc":
+		return "H.265"
+	default:
+		return strings.ToUpper(family)
+	}
+}
+
+// describeCodec renders the codec string, profile, tier, and level of the segment
+func describeCodec(info *decoder.StreamInfo) string {
+	name := codecFamilyName(info.Codec)
+
+	if info.Profile > 0 {
+		name += " " + decoder.ProfileName(info.Codec, info.Profile)
+	}
+
+	if info.Codec == "hevc" && info.Profile > 0 {
+		name += ", " + tierName(info.HighTier) + " tier"
+	}
+
+	if info.Level > 0 && (info.Codec == "h264" || info.Codec == "hevc") {
+		name += ", level " + decoder.LevelName(info.Codec, info.Level)
+	}
+
+	if info.CodecString != "" {
+		return fmt.Sprintf("%s (%s)", info.CodecString, name)
+	}
+
+	return name
+}
+
+// printCodecChecks summarizes the codec of the segment and any mismatches with the
+// variant's CODECS across every sample that checked one
+func printCodecChecks(allSamples []ttff.Sample) {
+	if !codecMode {
+		return
+	}
+
+	if last := lastStreamInfo(allSamples); last != nil {
+		fmt.Printf("Codec: %s\n", describeCodec(last))
+	}
+
+	printVideoIssues("Codec", allSamples, func(sample ttff.Sample) ([]string, bool) {
+		return sample.CodecIssues, sample.Video != nil || len(sample.CodecIssues) > 0
+	})
+}
@@ -0,0 +1,245 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"codeberg.org/pwnderpants/vtrace/internal/probe"
+	"codeberg.org/pwnderpants/vtrace/internal/stats"
+	"codeberg.org/pwnderpants/vtrace/internal/ttff"
+)
+
+// Connection states a sample can start from
+const (
+	connectionCold = "cold"
+	connectionWarm = "warm"
+)
+
+var (
+	// warmConnections sends a throwaway manifest request before each timed sample
+	warmConnections bool
+
+	// compareColdWarm alternates cold and warm samples and compares them
+	compareColdWarm bool
+
+	// connectionArm forces the state of the current sample during a cold/warm comparison
+	connectionArm string
+)
+
+// validateWarm checks that --warm and --compare-cold-warm are used with measurements
+// that open their own HTTP/1.1-2 connections
+func validateWarm() error {
+	if !warmConnections && !compareColdWarm {
+		return nil
+	}
+
+	flag := "--warm"
+
+	if compareColdWarm {
+		flag = "--compare-cold-warm"
+	}
+
+	switch {
+	case warmConnections && compareColdWarm:
+		return errors.New("--warm cannot be combined with --compare-cold-warm")
+	case compare:
+		return fmt.Errorf("%s cannot be combined with --compare", flag)
+	case freshDNS:
+		return fmt.Errorf("%s cannot be combined with --fresh-dns", flag)
+	case playerCommand != "":
+		return fmt.Errorf("%s cannot be combined with --player-cmd", flag)
+	}
+
+	if !compareColdWarm {
+		return nil
+	}
+
+	switch {
+	case allVariants:
+		return errors.New("--compare-cold-warm cannot be combined with --all-variants")
+	case checkMode:
+		return errors.New("--compare-cold-warm cannot be combined with --check")
+	case len(resolverSpecs) > 0 || len(interfaceNames) > 0:
+		return errors.New("--compare-cold-warm cannot be combined with --resolvers or --interfaces")
+	case allIPs:
+		return errors.New("--compare-cold-warm cannot be combined with --all-ips")
+	case urlFile != "":
+		return errors.New("--compare-cold-warm cannot be combined with --url-file")
+	case watchMode:
+		return errors.New("--compare-cold-warm cannot be combined with --watch")
+	case templatePath != "" || outputFormat == outputInflux:
+		return errors.New("--compare-cold-warm cannot be combined with --template or --output influx")
+	case confidenceLevel > 0:
+		return errors.New("--compare-cold-warm cannot be combined with --confidence")
+	case slaEnabled():
+		return errors.New("--compare-cold-warm cannot be combined with --fail-* thresholds")
+	}
+
+	return nil
+}
+
+// sampleConnection returns the state the next sample starts from: cold, warm, or empty
+// for the default (the shared pool decides)
+func sampleConnection() string {
+	if connectionArm != "" {
+		return connectionArm
+	}
+
+	if warmConnections {
+		return connectionWarm
+	}
+
+	return ""
+}
+
+// warmConnection fetches the manifest once and discards it, leaving an established
+// connection (and TLS session) in the client's pool for the timed requests
+func warmConnection(ctx context.Context, client *http.Client, target string) error {
+	if sampleConnection() != connectionWarm {
+		return nil
+	}
+
+	resp, trace, err := probe.FetchWithTrace(ctx, target, client)
+	if err != nil {
+		return fmt.Errorf("failed to warm up connection: %w", err)
+	}
+
+	_, err = io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+
+	if err != nil {
+		return fmt.Errorf("failed to warm up connection: %w", err)
+	}
+
+	if verbose {
+		fmt.Printf("Warm-up request: %s (%s)\n", formatDuration(trace.Total), trace.Proto)
+	}
+
+	return nil
+}
+
+// runColdWarmComparison alternates cold and warm samples and prints them side by side
+func runColdWarmComparison(minDelay, maxDelay time.Duration) error {
+	var coldSamples, warmSamples []ttff.Sample
+
+	coldAborts := make(map[string]int)
+	warmAborts := make(map[string]int)
+
+	defer func() { connectionArm = "" }()
+
+	for i := 0; i < samples; i++ {
+		arms := []string{connectionCold, connectionWarm}
+
+		// Alternate which state goes first so cache warming on the CDN favors neither
+		if i%2 == 1 {
+			arms[0], arms[1] = arms[1], arms[0]
+		}
+
+		for _, arm := range arms {
+			connectionArm = arm
+
+			if verbose {
+				fmt.Printf("\n── Sample %d/%d (%s) ──\n", i+1, samples, arm)
+			}
+
+			sample, _, _, err := measureSample(context.Background(), url, i, protocolHTTP12)
+
+			aborts := coldAborts
+
+			if arm == connectionWarm {
+				aborts = warmAborts
+			}
+
+			switch {
+			case recordBudgetAbort(aborts, err):
+				if verbose {
+					fmt.Printf("  Aborted: %v\n", err)
+				}
+			case err != nil:
+				return fmt.Errorf("%s sample %d failed: %w", arm, i+1, err)
+			case arm == connectionCold:
+				coldSamples = append(coldSamples, sample)
+			default:
+				warmSamples = append(warmSamples, sample)
+			}
+
+			if err == nil && verbose {
+				fmt.Printf("  TTFF: %s\n", formatDuration(sample.TotalTTFF))
+			}
+		}
+
+		// Apply delay between rounds (skip after last round)
+		if i < samples-1 {
+			sleepDuration := getDelay(minDelay, maxDelay)
+
+			if verbose {
+				fmt.Printf("  Waiting %s before next round...\n", sleepDuration)
+			}
+
+			time.Sleep(sleepDuration)
+		}
+	}
+
+	if len(coldSamples) == 0 || len(warmSamples) == 0 {
+		printBudgetSummary("Cold arm: ", coldAborts, samples)
+		printBudgetSummary("Warm arm: ", warmAborts, samples)
+
+		return fmt.Errorf("every sample of a comparison arm was aborted: %w", ttff.ErrBudgetExceeded)
+	}
+
+	printColdWarmResults(exportURL(url), coldSamples, warmSamples)
+	printShaping()
+	printConfiguration()
+	printBudgetSummary("Cold arm: ", coldAborts, samples)
+	printBudgetSummary("Warm arm: ", warmAborts, samples)
+
+	return nil
+}
+
+// printColdWarmResults outputs the cold vs warm comparison table
+func printColdWarmResults(url string, coldSamples, warmSamples []ttff.Sample) {
+	coldTimings := ttff.Timings(coldSamples)
+	warmTimings := ttff.Timings(warmSamples)
+
+	if len(coldSamples) == len(warmSamples) {
+		fmt.Printf("\nvtrace cold vs warm comparison for: %s (%d samples each)\n", url, len(coldSamples))
+	} else {
+		fmt.Printf("\nvtrace cold vs warm comparison for: %s (%d cold, %d warm samples)\n", url, len(coldSamples), len(warmSamples))
+	}
+
+	fmt.Println(compareRule)
+	fmt.Printf("%-20s %14s %14s %14s %-3s %8s\n", "", "Cold", "Warm", "Delta", "", "p-value")
+	fmt.Println(compareRule)
+
+	printComparisonRow("DNS Lookup:", stats.ExtractDNSLookup(coldTimings), stats.ExtractDNSLookup(warmTimings))
+	printComparisonRow("TCP Connect:", stats.ExtractTCPConnect(coldTimings), stats.ExtractTCPConnect(warmTimings))
+	printComparisonRow("TLS Handshake:", stats.ExtractTLSHandshake(coldTimings), stats.ExtractTLSHandshake(warmTimings))
+	printComparisonRow("Manifest TTFB:", stats.ExtractManifestTTFB(coldTimings), stats.ExtractManifestTTFB(warmTimings))
+
+	if anyNonZero(stats.ExtractKeyFetch(coldTimings), stats.ExtractKeyFetch(warmTimings)) {
+		printComparisonRow("Key Fetch:", stats.ExtractKeyFetch(coldTimings), stats.ExtractKeyFetch(warmTimings))
+	}
+
+	if anyNonZero(stats.ExtractInitSegment(coldTimings), stats.ExtractInitSegment(warmTimings)) {
+		printComparisonRow("Init Segment:", stats.ExtractInitSegment(coldTimings), stats.ExtractInitSegment(warmTimings))
+	}
+
+	printComparisonRow(segmentPhaseLabel(), stats.ExtractSegmentTotal(coldTimings), stats.ExtractSegmentTotal(warmTimings))
+	printComparisonRow("Frame Detection:", stats.ExtractFrameDetection(coldTimings), stats.ExtractFrameDetection(warmTimings))
+
+	fmt.Println(compareRule)
+
+	printComparisonRow("Total TTFF:", stats.ExtractTotalTTFF(coldTimings), stats.ExtractTotalTTFF(warmTimings))
+
+	if audioMode {
+		printComparisonRow("Total TTFA:", stats.ExtractTotalTTFA(coldTimings), stats.ExtractTotalTTFA(warmTimings))
+	}
+
+	fmt.Println()
+	fmt.Println("Cold samples open new connections; warm samples reuse one opened by a throwaway manifest request.")
+	fmt.Println(significanceLegend)
+}
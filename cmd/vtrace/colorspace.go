@@ -0,0 +1,298 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/grafov/m3u8"
+
+	"codeberg.org/pwnderpants/vtrace/internal/decoder"
+	"codeberg.org/pwnderpants/vtrace/internal/ttff"
+)
+
+// colorspaceMode reports the color description of the first segment and checks it
+// against the variant's VIDEO-RANGE and CODECS
+var colorspaceMode bool
+
+// validateColorspace checks that --colorspace is used with a measurement it can extend
+func validateColorspace() error {
+	if !colorspaceMode {
+		return nil
+	}
+
+	if streamProtocol != streamHLS {
+		return errors.New("--colorspace requires --protocol hls")
+	}
+
+	if lowLatency {
+		return errors.New("--colorspace cannot be combined with --ll-hls")
+	}
+
+	return nil
+}
+
+// inspectVideo reads the stream description of the video segment once for --colorspace
+// and --codecs and flags any disagreement with what the master playlist declares.
+// Problems are flagged on the sample without failing it.
+func inspectVideo(ctx context.Context, variant *m3u8.Variant, segmentData []byte, sample *ttff.Sample) {
+	info, err := decoder.DetectStreamInfo(ctx, segmentData)
+	if err != nil {
+		if colorspaceMode {
+			sample.ColorIssues = []string{fmt.Sprintf("color description not read: %v", err)}
+		}
+
+		if codecMode {
+			sample.CodecIssues = []string{fmt.Sprintf("codec not read: %v", err)}
+		}
+
+		return
+	}
+
+	sample.Video = info
+
+	if colorspaceMode {
+		sample.ColorIssues = colorspaceIssues(info, variant)
+	}
+
+	if codecMode {
+		sample.CodecIssues = codecIssues(info, variant)
+	}
+}
+
+// colorspaceIssues compares the segment's dynamic range, bit depth, and primaries with
+// the variant's VIDEO-RANGE and CODECS. Media playlists measured directly declare nothing.
+func colorspaceIssues(info *decoder.StreamInfo, variant *m3u8.Variant) []string {
+	var issues []string
+
+	actual := info.Range()
+	hdr := actual != decoder.RangeSDR
+
+	if variant != nil {
+		declared := strings.ToUpper(variant.VideoRange)
+		label := "VIDEO-RANGE=" + declared
+
+		// The HLS specification treats a missing VIDEO-RANGE as SDR
+		if declared == "" {
+			declared = decoder.RangeSDR
+			label = "no VIDEO-RANGE (SDR)"
+		}
+
+		switch {
+		case declared == actual:
+		case declared == decoder.RangeSDR:
+			issues = append(issues, fmt.Sprintf("SDR-labeled HDR: segment transfer is %s (%s) but the variant declares %s", info.Transfer, actual, label))
+		case info.Transfer == "":
+			issues = append(issues, fmt.Sprintf("%s but the segment does not describe its transfer characteristics", label))
+		default:
+			issues = append(issues, fmt.Sprintf("%s but the segment transfer is %s (%s)", label, describeTransfer(info), actual))
+		}
+
+		if codec, _ := videoCodec(variant.Codecs); hdr && codec != "" && eightBitCodec(codec) {
+			issues = append(issues, fmt.Sprintf("CODECS %s declares an 8-bit profile for %s video", codec, actual))
+		}
+	}
+
+	if !hdr {
+		return issues
+	}
+
+	if info.BitDepth > 0 && info.BitDepth < 10 {
+		issues = append(issues, fmt.Sprintf("%s video coded at %d bits; HDR needs at least 10", actual, info.BitDepth))
+	}
+
+	if info.Primaries != "" && info.Primaries != "bt2020" {
+		issues = append(issues, fmt.Sprintf("%s transfer with %s primaries (expected bt2020)", actual, info.Primaries))
+	}
+
+	return issues
+}
+
+// describeTransfer names the transfer characteristics, including an HLG alternative
+func describeTransfer(info *decoder.StreamInfo) string {
+	transfer := info.Transfer
+
+	if transfer == "" {
+		transfer = "unspecified"
+	}
+
+	if info.AlternativeTransfer != "" {
+		transfer += ", preferred " + info.AlternativeTransfer
+	}
+
+	return transfer
+}
+
+// videoCodecFamilies maps the sample entry of RFC 6381 video codec strings to the
+// codec names ffprobe and the native parser report
+var videoCodecFamilies = map[string]string{
+	"avc1": "h264",
+	"avc3": "h264",
+	"hvc1": "hevc",
+	"hev1": "hevc",
+	"dvh1": "hevc",
+	"dvhe": "hevc",
+	"av01": "av1",
+	"vp09": "vp9",
+	"mp4v": "mpeg4",
+}
+
+// videoCodec returns the first video entry of a CODECS attribute and its codec family
+func videoCodec(codecs string) (string, string) {
+	for _, codec := range strings.Split(codecs, ",") {
+		codec = strings.TrimSpace(codec)
+
+		if family, ok := videoCodecFamilies[strings.SplitN(codec, ".", 2)[0]]; ok {
+			return codec, family
+		}
+	}
+
+	return "", ""
+}
+
+// eightBitCodec reports whether an RFC 6381 codec string names an 8-bit-only profile:
+// H.264 Baseline/Main/High or H.265 Main
+func eightBitCodec(codec string) bool {
+	parts := strings.Split(codec, ".")
+
+	if len(parts) < 2 {
+		return false
+	}
+
+	switch parts[0] {
+	case "avc1", "avc3":
+		if len(parts[1]) < 2 {
+			return false
+		}
+
+		profile, err := strconv.ParseUint(parts[1][:2], 16, 8)
+
+		return err == nil && (profile == 66 || profile == 77 || profile == 88 || profile == 100)
+	case "hvc1", "hev1":
+		// The general profile may carry a profile space prefix (A, B, or C)
+		profile, err := strconv.Atoi(strings.TrimLeft(parts[1], "ABC"))
+
+		return err == nil && profile == 1
+	default:
+		return false
+	}
+}
+
+// printColorspaceChecks summarizes the color description of the segment and any
+// mismatches with the playlist across every sample that checked one
+func printColorspaceChecks(allSamples []ttff.Sample) {
+	if !colorspaceMode {
+		return
+	}
+
+	last := lastStreamInfo(allSamples)
+
+	if last != nil {
+		fmt.Printf("Colorspace: %s\n", describeStreamInfo(last))
+	}
+
+	printVideoIssues("Colorspace", allSamples, func(sample ttff.Sample) ([]string, bool) {
+		return sample.ColorIssues, sample.Video != nil || len(sample.ColorIssues) > 0
+	})
+}
+
+// lastStreamInfo returns the stream description of the last sample that read one
+func lastStreamInfo(allSamples []ttff.Sample) *decoder.StreamInfo {
+	for i := len(allSamples) - 1; i >= 0; i-- {
+		if allSamples[i].Video != nil {
+			return allSamples[i].Video
+		}
+	}
+
+	return nil
+}
+
+// printVideoIssues lists the issues of a video check in the order they were first seen,
+// counting the samples that raised each one when there were several. issuesOf returns a
+// sample's issues and whether the check ran on it.
+func printVideoIssues(title string, allSamples []ttff.Sample, issuesOf func(ttff.Sample) ([]string, bool)) {
+	var (
+		checked int
+		flagged int
+		order   []string
+	)
+
+	issues := make(map[string]int)
+
+	for _, sample := range allSamples {
+		sampleIssues, ran := issuesOf(sample)
+
+		if !ran {
+			continue
+		}
+
+		checked++
+
+		if len(sampleIssues) > 0 {
+			flagged++
+		}
+
+		for _, issue := range sampleIssues {
+			if issues[issue] == 0 {
+				order = append(order, issue)
+			}
+
+			issues[issue]++
+		}
+	}
+
+	if flagged == 0 {
+		return
+	}
+
+	fmt.Printf("%s issues (%d of %d samples flagged):\n", title, flagged, checked)
+
+	for _, issue := range order {
+		if checked > 1 {
+			fmt.Printf("  - %s (%d samples)\n", issue, issues[issue])
+		} else {
+			fmt.Printf("  - %s\n", issue)
+		}
+	}
+}
+
+// describeStreamInfo renders the codec, bit depth, color description, and HDR metadata
+func describeStreamInfo(info *decoder.StreamInfo) string {
+	unspecified := func(name string) string {
+		if name == "" {
+			return "unspecified"
+		}
+
+		return name
+	}
+
+	colorRange := "limited"
+
+	if info.FullRange {
+		colorRange = "full"
+	}
+
+	codec := info.Codec
+
+	if info.BitDepth > 0 {
+		codec = fmt.Sprintf("%s %d-bit", codec, info.BitDepth)
+	}
+
+	parts := []string{
+		codec,
+		fmt.Sprintf("primaries %s, transfer %s, matrix %s (%s range)", unspecified(info.Primaries), describeTransfer(info), unspecified(info.Matrix), colorRange),
+		info.Range(),
+	}
+
+	if info.Mastering != nil {
+		parts = append(parts, fmt.Sprintf("mastering display %g/%g cd/m²", info.Mastering.MaxLuminance, info.Mastering.MinLuminance))
+	}
+
+	if info.LightLevel != nil {
+		parts = append(parts, fmt.Sprintf("MaxCLL %d, MaxFALL %d", info.LightLevel.MaxCLL, info.LightLevel.MaxFALL))
+	}
+
+	return strings.Join(parts, ", ")
+}
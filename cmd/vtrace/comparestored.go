@@ -0,0 +1,260 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"codeberg.org/pwnderpants/vtrace/internal/history"
+	"codeberg.org/pwnderpants/vtrace/internal/stats"
+)
+
+var (
+	storedFilter      string
+	storedAgainst     string
+	storedHistoryPath string
+	storedSince       time.Duration
+)
+
+var compareStoredCmd = &cobra.Command{
+	Use:   "compare-stored",
+	Short: "Compare two cohorts of stored samples with significance tests",
+	Long: `compare-stored selects two cohorts from the history store and runs the
+multi-sample comparison over them instead of live measurements. Filters are
+comma-separated key=value terms on url, protocol, experiment, arm, run_id, config,
+or label (label=name:value, set with --label when measuring). Terms on the same key
+are alternatives; different keys must all match. A trailing * matches a prefix.
+config selects the configuration fingerprint printed with each run; cohorts
+measured under different configurations are flagged.`,
+	RunE: runCompareStored,
+}
+
+// storedPhases are the stored metrics compared row by row, in table order
+var storedPhases = []struct {
+	label  string
+	metric string
+}{
+	{"DNS Lookup:", "dns_lookup"},
+	{"TCP Connect:", "tcp_connect"},
+	{"TLS Handshake:", "tls_handshake"},
+	{"QUIC Handshake:", "quic_handshake"},
+	{"Manifest TTFB:", "manifest_ttfb"},
+	{"Key Fetch:", "key_fetch"},
+	{"Init Segment:", "init_segment"},
+	{"Part Download:", "part_download"},
+	{"Segment Download:", "segment_total"},
+	{"Frame Detection:", "frame_detection"},
+}
+
+// cohort holds the stored outcomes selected by one filter or time window
+type cohort struct {
+	name     string
+	values   map[string][]time.Duration
+	samples  int
+	failures int
+
+	// configs counts the records of each configuration fingerprint
+	configs map[string]int
+}
+
+// init registers the compare-stored subcommand and its flags
+func init() {
+	compareStoredCmd.Flags().StringVar(&storedFilter, "filter", "", "Cohort to evaluate (e.g., url=https://cdn.example.com/*,label=region:eu)")
+	compareStoredCmd.Flags().StringVar(&storedAgainst, "against", "", "Baseline cohort to compare with (same syntax as --filter)")
+	compareStoredCmd.Flags().StringVar(&storedHistoryPath, "history", defaultHistoryPath, "History store (file path, sqlite:PATH, or postgres:// URL)")
+	compareStoredCmd.Flags().DurationVar(&storedSince, "since", 0, "Only include samples from this far back (0 for all)")
+
+	compareStoredCmd.MarkFlagRequired("filter")
+	compareStoredCmd.MarkFlagRequired("against")
+
+	rootCmd.AddCommand(compareStoredCmd)
+}
+
+// runCompareStored loads both cohorts and prints their comparison
+func runCompareStored(cmd *cobra.Command, args []string) error {
+	filter, err := history.ParseFilter(storedFilter)
+	if err != nil {
+		return err
+	}
+
+	against, err := history.ParseFilter(storedAgainst)
+	if err != nil {
+		return err
+	}
+
+	store, err := openStoredHistory(storedHistoryPath)
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	var from time.Time
+
+	if storedSince > 0 {
+		from = time.Now().Add(-storedSince)
+	}
+
+	records, err := store.Query(from, time.Now())
+	if err != nil {
+		return err
+	}
+
+	cohortA := selectCohort(records, filter.Spec, filter.Match)
+	cohortB := selectCohort(records, against.Spec, against.Match)
+
+	for _, c := range []*cohort{cohortA, cohortB} {
+		if len(c.values["total_ttff"]) == 0 {
+			return fmt.Errorf("no successful samples match %q in %s", c.name, storedHistoryPath)
+		}
+	}
+
+	printCohortTable("vtrace stored cohort comparison", cohortA, cohortB)
+	printCohortComparison(cohortA, cohortB)
+	printConfigMismatch(cohortA, cohortB)
+
+	return nil
+}
+
+// selectCohort collects the stored metrics of every record accepted by match; an hourly
+// aggregate contributes its mean once but counts all of its samples
+func selectCohort(records []history.Record, name string, match func(history.Record) bool) *cohort {
+	c := &cohort{name: name, values: make(map[string][]time.Duration), configs: make(map[string]int)}
+
+	for _, record := range records {
+		if !match(record) {
+			continue
+		}
+
+		c.configs[record.Config]++
+
+		if record.IsAggregate() {
+			c.samples += record.Samples
+			c.failures += record.Failures
+		} else {
+			c.samples++
+		}
+
+		if record.Error != "" {
+			if !record.IsAggregate() {
+				c.failures++
+			}
+
+			continue
+		}
+
+		for metric, value := range record.Metrics {
+			c.values[metric] = append(c.values[metric], time.Duration(value*float64(time.Millisecond)))
+		}
+	}
+
+	return c
+}
+
+// printCohortTable outputs the Total TTFF summary of both cohorts
+func printCohortTable(title string, cohortA, cohortB *cohort) {
+	fmt.Println(title)
+	fmt.Printf("  Cohort:   %s\n", cohortA.name)
+	fmt.Printf("  Baseline: %s\n", cohortB.name)
+	fmt.Println()
+	fmt.Println("──────────────────────────────────────────────────────────────────────────────────────────")
+	fmt.Printf("%-10s %8s %8s %12s %12s %12s %12s %12s\n", "Total TTFF", "Samples", "Failed", "Avg", "Median", "P95", "Min", "StdDev")
+	fmt.Println("──────────────────────────────────────────────────────────────────────────────────────────")
+
+	for _, row := range []struct {
+		name string
+		c    *cohort
+	}{{"Cohort", cohortA}, {"Baseline", cohortB}} {
+		s := stats.ComputeStats(row.c.values["total_ttff"])
+
+		fmt.Printf("%-10s %8d %8d %12s %12s %12s %12s %12s\n",
+			row.name,
+			row.c.samples,
+			row.c.failures,
+			formatDuration(s.Mean),
+			formatDuration(s.Median),
+			formatDuration(s.Percentile(95)),
+			formatDuration(s.Min),
+			formatDuration(s.StdDev),
+		)
+	}
+}
+
+// printCohortComparison outputs per-phase means of both cohorts with the significance of each delta
+func printCohortComparison(cohortA, cohortB *cohort) {
+	fmt.Println()
+	fmt.Println(compareRule)
+	fmt.Printf("%-20s %14s %14s %14s %-3s %8s\n", "", "Baseline", "Cohort", "Delta", "", "p-value")
+	fmt.Println(compareRule)
+
+	for _, phase := range storedPhases {
+		baseline, current := cohortB.values[phase.metric], cohortA.values[phase.metric]
+
+		// Phases neither cohort measured (e.g., Key Fetch on clear streams) are left out
+		if !anyNonZero(baseline, current) {
+			continue
+		}
+
+		printComparisonRow(phase.label, baseline, current)
+	}
+
+	fmt.Println(compareRule)
+
+	printComparisonRow("Total TTFF:", cohortB.values["total_ttff"], cohortA.values["total_ttff"])
+
+	if anyNonZero(cohortB.values["total_ttfa"], cohortA.values["total_ttfa"]) {
+		printComparisonRow("Total TTFA:", cohortB.values["total_ttfa"], cohortA.values["total_ttfa"])
+	}
+
+	fmt.Println()
+	fmt.Println(significanceLegend)
+}
+
+// printConfigMismatch warns when the cohorts were not all measured under one configuration,
+// since settings rather than the network may then explain a delta
+func printConfigMismatch(cohortA, cohortB *cohort) {
+	configs := make(map[string]bool)
+
+	for _, c := range []*cohort{cohortA, cohortB} {
+		for config := range c.configs {
+			configs[config] = true
+		}
+	}
+
+	if len(configs) < 2 {
+		return
+	}
+
+	fmt.Println()
+	fmt.Println("Warning: the cohorts mix configurations; add config=FINGERPRINT to both filters to compare like with like")
+	fmt.Printf("  Cohort:   %s\n", describeConfigs(cohortA.configs))
+	fmt.Printf("  Baseline: %s\n", describeConfigs(cohortB.configs))
+}
+
+// describeConfigs lists the fingerprints of a cohort with their record counts
+func describeConfigs(configs map[string]int) string {
+	names := make([]string, 0, len(configs))
+
+	for config := range configs {
+		names = append(names, config)
+	}
+
+	sort.Strings(names)
+
+	parts := make([]string, 0, len(names))
+
+	for _, config := range names {
+		label := config
+
+		// Records stored before fingerprints were recorded have none
+		if label == "" {
+			label = "unrecorded"
+		}
+
+		parts = append(parts, fmt.Sprintf("%s (%d)", label, configs[config]))
+	}
+
+	return strings.Join(parts, ", ")
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+
+	"codeberg.org/pwnderpants/vtrace/internal/stats"
+	"codeberg.org/pwnderpants/vtrace/internal/ttff"
+)
+
+// minAdaptiveSamples is the fewest samples taken before the interval is checked
+const minAdaptiveSamples = 3
+
+var (
+	confidenceLevel float64
+	maxSamples      int
+	ciMargin        float64
+)
+
+// adaptiveSampling reports whether --confidence asked for sampling until the interval converges
+func adaptiveSampling() bool {
+	return confidenceLevel > 0
+}
+
+// validateConfidence rejects adaptive sampling settings that cannot converge or conflict with other modes
+func validateConfidence() error {
+	if !adaptiveSampling() {
+		return nil
+	}
+
+	switch {
+	case confidenceLevel >= 100:
+		return errors.New("--confidence must be between 0 and 100")
+	case ciMargin <= 0:
+		return errors.New("--ci-margin must be positive")
+	case maxSamples < max(samples, minAdaptiveSamples):
+		return fmt.Errorf("--max-samples must be at least %d", max(samples, minAdaptiveSamples))
+	case compare:
+		return errors.New("--confidence cannot be combined with --compare")
+	case allVariants:
+		return errors.New("--confidence cannot be combined with --all-variants")
+	case checkMode:
+		return errors.New("--confidence cannot be combined with --check")
+	case len(resolverSpecs) > 0:
+		return errors.New("--confidence cannot be combined with --resolvers")
+	case len(interfaceNames) > 0:
+		return errors.New("--confidence cannot be combined with --interfaces")
+	}
+
+	return nil
+}
+
+// sampleLimit returns how many samples the multi-sample loop may take
+func sampleLimit() int {
+	if adaptiveSampling() {
+		return maxSamples
+	}
+
+	return samples
+}
+
+// confidenceReached reports whether the Total TTFF interval is already within the margin
+func confidenceReached(allSamples []ttff.Sample) bool {
+	if !adaptiveSampling() || len(allSamples) < max(samples, minAdaptiveSamples) {
+		return false
+	}
+
+	ci := stats.MeanConfidenceInterval(stats.ExtractTotalTTFF(ttff.Timings(allSamples)), confidenceLevel)
+
+	return ci.RelativeMargin()*100 <= ciMargin
+}
+
+// printConfidence reports the final Total TTFF interval and whether it met the margin
+func printConfidence(allSamples []ttff.Sample, attempted int) {
+	if !adaptiveSampling() {
+		return
+	}
+
+	ci := stats.MeanConfidenceInterval(stats.ExtractTotalTTFF(ttff.Timings(allSamples)), confidenceLevel)
+
+	fmt.Printf("\n%g%% confidence interval (Total TTFF): %s ± %s", confidenceLevel, formatDuration(ci.Mean), formatDuration(ci.Margin))
+
+	if ci.Margin >= 0 {
+		fmt.Printf(" (±%.1f%%)", ci.RelativeMargin()*100)
+	}
+
+	fmt.Println()
+
+	if ci.RelativeMargin()*100 <= ciMargin {
+		fmt.Printf("Target margin ±%g%% reached after %d samples\n", ciMargin, attempted)
+
+		return
+	}
+
+	fmt.Printf("Target margin ±%g%% not reached within --max-samples %d\n", ciMargin, maxSamples)
+}
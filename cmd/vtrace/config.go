@@ -0,0 +1,253 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	"github.com/spf13/viper"
+)
+
+// configEnvPrefix prefixes the environment variables that override flags (e.g.,
+// VTRACE_SAMPLES for --samples)
+const configEnvPrefix = "VTRACE"
+
+// Config file settings that are not flags
+const (
+	configProfilesKey = "profiles"
+	configURLsKey     = "urls"
+)
+
+var (
+	configPath  string
+	profileName string
+)
+
+// profileURLs is the URL set of the config file, measured like the lines of a --url-file
+var profileURLs []string
+
+// targetFlags choose what is measured; only one of them, or the urls setting, may come
+// from the config file
+var targetFlags = []string{"url", "url-file", "synthetic"}
+
+// applyConfig fills the flags of the command being run that were not given on the command
+// line from VTRACE_* environment variables, then from the --profile section of --config,
+// then from its top level; settings for flags of other commands are left for them
+func applyConfig(cmd *cobra.Command, args []string) error {
+	flags := cmd.Flags()
+
+	for _, name := range []string{"config", "profile"} {
+		if value, ok := os.LookupEnv(configEnvName(name)); ok && !flags.Changed(name) {
+			if err := flags.Set(name, value); err != nil {
+				return fmt.Errorf("invalid %s: %w", configEnvName(name), err)
+			}
+		}
+	}
+
+	if configPath == "" && profileName != "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return fmt.Errorf("failed to locate ~/.vtrace.yaml: %w", err)
+		}
+
+		configPath = filepath.Join(home, ".vtrace.yaml")
+	}
+
+	settings := make(map[string]any)
+	source := configPath
+
+	if configPath != "" {
+		var err error
+
+		settings, err = readConfig(cmd.Root())
+		if err != nil {
+			return err
+		}
+
+		if profileName != "" {
+			source = fmt.Sprintf("%s (profile %s)", configPath, profileName)
+		}
+	}
+
+	// The command line or the environment naming a target replaces the target of the file,
+	// which would otherwise conflict with it
+	targetOverridden := false
+
+	for _, name := range targetFlags {
+		if _, ok := os.LookupEnv(configEnvName(name)); ok || flags.Changed(name) {
+			targetOverridden = true
+		}
+	}
+
+	var err error
+
+	flags.VisitAll(func(f *pflag.Flag) {
+		if err != nil || f.Changed || f.Name == "config" || f.Name == "profile" || f.Name == "help" {
+			return
+		}
+
+		if value, ok := os.LookupEnv(configEnvName(f.Name)); ok {
+			err = setConfigFlag(flags, f.Name, []string{value}, configEnvName(f.Name))
+
+			return
+		}
+
+		value, ok := settings[f.Name]
+		if !ok || (targetOverridden && isTargetSetting(f.Name)) {
+			return
+		}
+
+		err = setConfigFlag(flags, f.Name, configValues(value), source)
+	})
+
+	if err != nil {
+		return err
+	}
+
+	// A URL set is measured like a --url-file, by the commands that take one
+	if urls, ok := settings[configURLsKey]; ok && !targetOverridden && flags.Lookup("url-file") != nil {
+		profileURLs = configValues(urls)
+
+		if err := flags.Set("url-file", source); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// readConfig loads --config and returns its top-level settings with those of --profile laid
+// over them; a profile that names a target replaces the target of the top level
+func readConfig(root *cobra.Command) (map[string]any, error) {
+	file := viper.New()
+	file.SetConfigFile(configPath)
+
+	if err := file.ReadInConfig(); err != nil {
+		return nil, fmt.Errorf("failed to read config: %w", err)
+	}
+
+	settings := file.AllSettings()
+	delete(settings, configProfilesKey)
+
+	if profileName != "" {
+		profile := file.Sub(configProfilesKey + "." + profileName)
+		if profile == nil {
+			return nil, fmt.Errorf("profile %q not found in %s (profiles: %s)", profileName, configPath, strings.Join(configProfiles(file), ", "))
+		}
+
+		overrides := profile.AllSettings()
+
+		for name := range overrides {
+			if isTargetSetting(name) {
+				for target := range settings {
+					if isTargetSetting(target) {
+						delete(settings, target)
+					}
+				}
+
+				break
+			}
+		}
+
+		for name, value := range overrides {
+			settings[name] = value
+		}
+	}
+
+	targets := 0
+
+	for name := range settings {
+		if isTargetSetting(name) {
+			targets++
+		}
+
+		if name == "config" || name == "profile" || (name != configURLsKey && !isCommandFlag(root, name)) {
+			return nil, fmt.Errorf("unknown setting %q in %s", name, configPath)
+		}
+	}
+
+	if targets > 1 {
+		return nil, fmt.Errorf("set only one of url, url-file, synthetic, or urls in %s", configPath)
+	}
+
+	if urls, ok := settings[configURLsKey]; ok {
+		if _, isList := urls.([]any); !isList {
+			return nil, errors.New("urls must be a list of URLs, each optionally followed by a label")
+		}
+	}
+
+	return settings, nil
+}
+
+// configProfiles lists the profile names of a config file in order
+func configProfiles(file *viper.Viper) []string {
+	names := make([]string, 0)
+
+	for name := range file.GetStringMap(configProfilesKey) {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	return names
+}
+
+// setConfigFlag sets a flag to the values of a setting; list flags take every value, like
+// a repeated flag
+func setConfigFlag(flags *pflag.FlagSet, name string, values []string, source string) error {
+	for _, value := range values {
+		if err := flags.Set(name, value); err != nil {
+			return fmt.Errorf("invalid %s from %s: %w", name, source, err)
+		}
+	}
+
+	return nil
+}
+
+// configValues renders a setting as flag values, one per element of a list
+func configValues(value any) []string {
+	list, ok := value.([]any)
+	if !ok {
+		return []string{fmt.Sprint(value)}
+	}
+
+	values := make([]string, 0, len(list))
+
+	for _, element := range list {
+		values = append(values, fmt.Sprint(element))
+	}
+
+	return values
+}
+
+// configEnvName returns the environment variable that overrides a flag
+func configEnvName(flag string) string {
+	return configEnvPrefix + "_" + strings.ToUpper(strings.ReplaceAll(flag, "-", "_"))
+}
+
+// isCommandFlag reports whether a command or any of its subcommands has a flag, so one
+// config file can hold settings for every command
+func isCommandFlag(cmd *cobra.Command, name string) bool {
+	if cmd.Flags().Lookup(name) != nil || cmd.PersistentFlags().Lookup(name) != nil {
+		return true
+	}
+
+	for _, sub := range cmd.Commands() {
+		if isCommandFlag(sub, name) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// isTargetSetting reports whether a setting chooses what is measured
+func isTargetSetting(name string) bool {
+	return name == configURLsKey || slices.Contains(targetFlags, name)
+}
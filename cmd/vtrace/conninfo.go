@@ -0,0 +1,105 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"codeberg.org/pwnderpants/vtrace/internal/probe"
+	"codeberg.org/pwnderpants/vtrace/internal/ttff"
+)
+
+// describeConn names the remote address of a connection and whether it was reused
+func describeConn(conn probe.ConnInfo) string {
+	if conn.RemoteAddr == "" {
+		return "unknown"
+	}
+
+	if !conn.Reused {
+		return conn.RemoteAddr + " (new connection)"
+	}
+
+	if conn.IdleTime > 0 {
+		return fmt.Sprintf("%s (reused connection, idle %s)", conn.RemoteAddr, formatDuration(conn.IdleTime))
+	}
+
+	return conn.RemoteAddr + " (reused connection)"
+}
+
+// printSampleConnections prints the local and remote addresses of a sample's connections
+func printSampleConnections(sample ttff.Sample) {
+	for _, request := range []struct {
+		label string
+		conn  probe.ConnInfo
+	}{
+		{"manifest", sample.ManifestConn},
+		{"segment", sample.SegmentConn},
+	} {
+		if request.conn.LocalAddr == "" {
+			fmt.Printf("Connection (%s): %s\n", request.label, describeConn(request.conn))
+
+			continue
+		}
+
+		fmt.Printf("Connection (%s): %s from %s\n", request.label, describeConn(request.conn), request.conn.LocalAddr)
+	}
+}
+
+// printConnections reports which addresses served the samples' manifest and segment
+// requests and how many of those requests reused a connection
+func printConnections(prefix string, allSamples []ttff.Sample) {
+	manifest := make([]probe.ConnInfo, len(allSamples))
+	segment := make([]probe.ConnInfo, len(allSamples))
+
+	for i, sample := range allSamples {
+		manifest[i] = sample.ManifestConn
+		segment[i] = sample.SegmentConn
+	}
+
+	fmt.Printf("%sManifest served by: %s\n", prefix, summarizeConns(manifest))
+	fmt.Printf("%sSegment served by:  %s\n", prefix, summarizeConns(segment))
+
+	if proxyURL != nil {
+		fmt.Printf("%sThese are the proxy's addresses; the origin is not visible through --proxy\n", prefix)
+	}
+}
+
+// summarizeConns lists each remote address with its request and reuse counts
+func summarizeConns(conns []probe.ConnInfo) string {
+	if len(conns) == 1 {
+		return describeConn(conns[0])
+	}
+
+	requests := make(map[string]int)
+	reused := make(map[string]int)
+
+	for _, conn := range conns {
+		addr := conn.RemoteAddr
+
+		if addr == "" {
+			addr = "unknown"
+		}
+
+		requests[addr]++
+
+		if conn.Reused {
+			reused[addr]++
+		}
+	}
+
+	addrs := make([]string, 0, len(requests))
+
+	for addr := range requests {
+		addrs = append(addrs, addr)
+	}
+
+	sort.Strings(addrs)
+
+	parts := make([]string, len(addrs))
+
+	for i, addr := range addrs {
+		parts[i] = fmt.Sprintf("%s (%d %s, %d reused)", addr, requests[addr], plural(requests[addr], "sample"), reused[addr])
+	}
+
+	return strings.Join(parts, ", ")
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	"codeberg.org/pwnderpants/vtrace/internal/sink"
+	"codeberg.org/pwnderpants/vtrace/internal/ttff"
+)
+
+// csvHeader lists the columns written by --csv
+var csvHeader = []string{
+	"timestamp", "sample", "protocol",
+	"dns_lookup_ms", "tcp_connect_ms", "tls_handshake_ms", "quic_handshake_ms",
+	"manifest_ttfb_ms", "manifest_total_ms", "segment_total_ms", "frame_detection_ms", "total_ttff_ms",
+	"manifest_proto", "segment_proto", "failed_connects",
+	"part_download_ms", "blocking_reload_ms", "key_fetch_ms",
+	"init_segment_ms",
+	"audio_playlist_ms", "audio_segment_ms", "audio_detection_ms", "total_ttfa_ms",
+	"player_join_ms", "frame_decoder",
+	"manifest_bytes", "segment_bytes", "manifest_throughput_bps", "segment_throughput_bps",
+	"declared_bandwidth_bps",
+	"segment_first_byte_ms", "segment_25pct_ms", "segment_50pct_ms", "segment_75pct_ms", "segment_last_byte_ms",
+	"segment_longest_stall_ms",
+	"segment_first_chunk_ms", "segment_chunks", "segment_longest_chunk_gap_ms",
+}
+
+// csvWriter receives one row per sample when --csv is set
+var csvWriter *sink.CSVWriter
+
+// writeCSVRow records a completed sample in the CSV export
+func writeCSVRow(index int, protocol string, sample ttff.Sample) {
+	row := []string{
+		time.Now().UTC().Format(time.RFC3339Nano),
+		strconv.Itoa(index + 1),
+		protocol,
+		sink.FormatMillis(sample.DNSLookup),
+		sink.FormatMillis(sample.TCPConnect),
+		sink.FormatMillis(sample.TLSHandshake),
+		sink.FormatMillis(sample.QUICHandshake),
+		sink.FormatMillis(sample.ManifestTTFB),
+		sink.FormatMillis(sample.ManifestTotal),
+		sink.FormatMillis(sample.SegmentTotal),
+		sink.FormatMillis(sample.FrameDetection),
+		sink.FormatMillis(sample.TotalTTFF),
+		sample.ManifestProto,
+		sample.SegmentProto,
+		strconv.Itoa(sample.FailedConnects),
+		sink.FormatMillis(sample.PartDownload),
+		sink.FormatMillis(sample.BlockingReload),
+		sink.FormatMillis(sample.KeyFetch),
+		sink.FormatMillis(sample.InitSegment),
+		sink.FormatMillis(sample.AudioPlaylist),
+		sink.FormatMillis(sample.AudioSegment),
+		sink.FormatMillis(sample.AudioDetection),
+		sink.FormatMillis(sample.TotalTTFA),
+		sink.FormatMillis(sample.PlayerJoin),
+		sample.FrameDecoder,
+		strconv.FormatInt(sample.ManifestBytes, 10),
+		strconv.FormatInt(sample.SegmentBytes, 10),
+		strconv.FormatFloat(sample.ManifestThroughput, 'f', 0, 64),
+		strconv.FormatFloat(sample.SegmentThroughput, 'f', 0, 64),
+		strconv.FormatInt(sample.DeclaredBandwidth, 10),
+	}
+
+	// Downloads without a per-read curve leave the progress columns empty
+	progress := make([]string, len(progressRows))
+
+	if sample.SegmentProgress != nil {
+		for i, point := range progressRows {
+			progress[i] = sink.FormatMillis(point.value(sample.SegmentProgress))
+		}
+	}
+
+	row = append(row, progress...)
+
+	// Only segments streamed in CMAF chunks fill the chunk columns
+	chunks := make([]string, 3)
+
+	if sample.Chunks != nil && sample.Chunks.Chunked {
+		chunks = []string{
+			sink.FormatMillis(sample.Chunks.FirstChunk),
+			strconv.Itoa(sample.Chunks.Chunks),
+			sink.FormatMillis(longestGap(sample.Chunks)),
+		}
+	}
+
+	row = append(row, chunks...)
+
+	// A failed write is reported but never fails the run
+	if err := csvWriter.Write(row); err != nil {
+		fmt.Fprintf(os.Stderr, "warning: %v\n", err)
+	}
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"codeberg.org/pwnderpants/vtrace/internal/dash"
+	"codeberg.org/pwnderpants/vtrace/internal/stats"
+	"codeberg.org/pwnderpants/vtrace/internal/ttff"
+)
+
+// Stream manifest formats accepted by --protocol
+const (
+	streamHLS  = "hls"
+	streamDASH = "dash"
+)
+
+// lowLatencyDASH measures LL-DASH start-up from the chunked segment at the live edge
+var lowLatencyDASH bool
+
+// printDASHTiming reports the periods of a multi-period or live MPD, where the first
+// segment sat on its timeline, how its availabilityTimeOffset moved it, and how far behind
+// the live edge the first frame played
+func printDASHTiming(allSamples []ttff.Sample) {
+	var (
+		last        *dash.Timing
+		latencies   []time.Duration
+		firstChunks []time.Duration
+		completes   []time.Duration
+		inProgress  int
+		chunked     int
+	)
+
+	for _, sample := range allSamples {
+		if sample.DASH == nil {
+			continue
+		}
+
+		last = sample.DASH
+
+		if sample.DASH.Dynamic {
+			latencies = append(latencies, sample.LiveLatency)
+		}
+
+		if sample.Chunks != nil {
+			firstChunks = append(firstChunks, sample.Chunks.FirstChunk)
+			completes = append(completes, sample.Chunks.Complete)
+
+			if sample.DASH.InProgress {
+				inProgress++
+			}
+
+			if sample.Chunks.Chunked {
+				chunked++
+			}
+		}
+	}
+
+	if last == nil || (!last.Dynamic && len(last.Periods) == 1) {
+		return
+	}
+
+	presentation := "static"
+
+	if last.Dynamic {
+		presentation = "dynamic"
+	}
+
+	fmt.Printf("DASH periods (%s, %d):\n", presentation, len(last.Periods))
+
+	for i, period := range last.Periods {
+		end := "end of presentation"
+
+		if period.End != 0 {
+			end = period.End.Round(time.Millisecond).String()
+		}
+
+		name := period.ID
+
+		if name == "" {
+			name = fmt.Sprintf("#%d", i+1)
+		}
+
+		marker := ""
+
+		if i == last.Period {
+			marker = "  <- first segment"
+		}
+
+		fmt.Printf("  %-12s %s to %s%s\n", name, period.Start.Round(time.Millisecond), end, marker)
+	}
+
+	fmt.Printf("First segment: period %s, %s\n", last.PeriodName(), ttff.DescribeSegmentPosition(last))
+
+	if !last.Dynamic {
+		return
+	}
+
+	switch {
+	case last.Unbounded:
+		fmt.Println("availabilityTimeOffset: INF, segments are available as soon as they start")
+	case last.AvailabilityTimeOffset > 0:
+		offset := last.AvailabilityTimeOffset.Round(time.Millisecond)
+
+		fmt.Printf("availabilityTimeOffset: %s, segments can be requested %s before they complete (up to %s less latency)\n", offset, offset, offset)
+	}
+
+	if last.PresentationDelay > 0 && lowLatencyDASH {
+		fmt.Printf("suggestedPresentationDelay: %s (not applied; --ll-dash starts at the live edge)\n", last.PresentationDelay.Round(time.Millisecond))
+	} else if last.PresentationDelay > 0 {
+		fmt.Printf("suggestedPresentationDelay: %s\n", last.PresentationDelay.Round(time.Millisecond))
+	}
+
+	// LL-DASH samples start from the first chunk of the segment the origin is still producing
+	if len(firstChunks) > 0 {
+		fmt.Printf("Chunked delivery: first chunk after %s, segment complete after %s (mean); %d of %d %s in progress when requested, %d streamed without a Content-Length\n",
+			formatDuration(stats.ComputeStats(firstChunks).Mean), formatDuration(stats.ComputeStats(completes).Mean), inProgress, len(firstChunks), plural(len(firstChunks), "segment"), chunked)
+	}
+
+	if len(latencies) > 0 {
+		fmt.Printf("Live latency: %s mean behind the live edge at first frame (%d %s)\n", formatDuration(stats.ComputeStats(latencies).Mean), len(latencies), plural(len(latencies), "sample"))
+	}
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"time"
+
+	"codeberg.org/pwnderpants/vtrace/internal/history"
+	"codeberg.org/pwnderpants/vtrace/internal/report"
+)
+
+// diurnalMetric is the stored metric broken down by hour of day and weekday
+const diurnalMetric = "total_ttff"
+
+// diurnalWindow is how much history each diurnal breakdown covers (0 disables it)
+var diurnalWindow time.Duration
+
+// buildDiurnal aggregates the diurnal window ending at `to` in local time
+func buildDiurnal(store history.Store, metric string, to time.Time) ([]report.Diurnal, time.Time, error) {
+	from := to.Add(-diurnalWindow)
+
+	records, err := store.Query(from, to)
+	if err != nil {
+		return nil, from, err
+	}
+
+	return report.BuildDiurnal(reportSamples(records), metric, time.Local), from, nil
+}
+
+// buildDiurnalHTML renders the diurnal heat tables for the window ending at `to`
+func buildDiurnalHTML(store history.Store, to time.Time) ([]byte, error) {
+	diurnals, from, err := buildDiurnal(store, diurnalMetric, to)
+	if err != nil {
+		return nil, err
+	}
+
+	return report.DiurnalHTML(diurnals, from, to, time.Local)
+}
+
+// diurnalHandler serves the diurnal breakdown as HTML, or JSON with ?format=json
+func diurnalHandler(store history.Store) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		metric := r.URL.Query().Get("metric")
+		if metric == "" {
+			metric = diurnalMetric
+		}
+
+		to := time.Now()
+
+		diurnals, from, err := buildDiurnal(store, metric, to)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+
+			return
+		}
+
+		if r.URL.Query().Get("format") == "json" {
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(diurnals)
+
+			return
+		}
+
+		body, err := report.DiurnalHTML(diurnals, from, to, time.Local)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Write(body)
+	})
+}
+
+// diurnalOnSchedule logs the peak-hour degradation per URL once a day at local midnight
+func diurnalOnSchedule(ctx context.Context, store history.Store) {
+	for {
+		next := nextDailyRun(time.Now(), 0)
+		timer := time.NewTimer(time.Until(next))
+
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+
+			return
+		case <-timer.C:
+		}
+
+		diurnals, _, err := buildDiurnal(store, diurnalMetric, next)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "warning: %v\n", err)
+
+			continue
+		}
+
+		for _, d := range diurnals {
+			printDiurnalSummary(d)
+		}
+	}
+}
+
+// printDiurnalSummary prints one URL's peak and quietest hour comparison
+func printDiurnalSummary(d report.Diurnal) {
+	stamp := time.Now().UTC().Format(time.RFC3339)
+
+	if d.PeakHour < 0 {
+		fmt.Printf("%s  diurnal %s: not enough samples per hour yet\n", stamp, d.URL)
+
+		return
+	}
+
+	peak, quiet := d.Hours[d.PeakHour], d.Hours[d.QuietHour]
+
+	fmt.Printf("%s  diurnal %s: peak %02d:00 p95 %.1f ms vs quietest %02d:00 p95 %.1f ms (+%.1f%%)\n",
+		stamp, d.URL, d.PeakHour, peak.P95, d.QuietHour, quiet.P95, d.Degradation)
+}
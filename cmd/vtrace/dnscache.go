@@ -0,0 +1,109 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"codeberg.org/pwnderpants/vtrace/internal/probe"
+)
+
+var (
+	dnsCacheTTL time.Duration
+
+	// dnsResolver answers every client's lookups and counts them; nil unless --dns-cache is set
+	dnsResolver *probe.DNSResolver
+)
+
+// setupDNSCache creates the shared resolver layer for --dns-cache and rejects modes that
+// resolve elsewhere or need every lookup to reach the nameserver
+func setupDNSCache() error {
+	dnsResolver = nil
+
+	if dnsCacheTTL == 0 {
+		return nil
+	}
+
+	switch {
+	case dnsCacheTTL < 0:
+		return errors.New("--dns-cache must be a positive duration")
+	case proxyURL != nil:
+		return errors.New("--dns-cache cannot be combined with --proxy (the proxy resolves the host)")
+	case freshDNS:
+		return errors.New("--dns-cache cannot be combined with --fresh-dns")
+	case len(resolverSpecs) > 0:
+		return errors.New("--dns-cache cannot be combined with --resolvers")
+	}
+
+	dnsResolver = probe.NewDNSResolver(probe.NewAnswerCache(dnsCacheTTL), nil)
+
+	return nil
+}
+
+// dnsQueries returns the latency of every lookup the cache could not answer
+func dnsQueries() []time.Duration {
+	if dnsResolver == nil {
+		return nil
+	}
+
+	return dnsResolver.Stats().Queries
+}
+
+// describeDNSCache summarizes the hits, misses, and failed queries of the run
+func describeDNSCache(s probe.DNSStats) string {
+	lookups := s.Hits + s.Misses
+	summary := fmt.Sprintf("%d %s, %d %s sent to the resolver", s.Hits, plural(s.Hits, "hit"), s.Misses, plural(s.Misses, "lookup"))
+
+	if lookups > 0 {
+		summary += fmt.Sprintf(" (%.0f%% hit ratio)", float64(s.Hits)/float64(lookups)*100)
+	}
+
+	if s.Failures > 0 {
+		summary += fmt.Sprintf(", %d failed", s.Failures)
+	}
+
+	return summary
+}
+
+// printDNSCache reports how often the --dns-cache answered a lookup and, for a single
+// query, its latency; the query distribution is a row of the statistics table
+func printDNSCache() {
+	if dnsResolver == nil {
+		return
+	}
+
+	s := dnsResolver.Stats()
+
+	fmt.Printf("DNS cache: %s, answers kept %s (--dns-cache)\n", describeDNSCache(s), dnsCacheTTL)
+
+	if len(s.Queries) == 1 {
+		fmt.Printf("  DNS query: %s\n", formatDuration(s.Queries[0]))
+	}
+}
+
+// printMonitorDNS adds the cache counters and query latency to the monitor health report
+func printMonitorDNS() {
+	if dnsResolver == nil {
+		return
+	}
+
+	s := dnsResolver.Stats()
+
+	fmt.Printf("%-28s %12d\n", "DNS lookups:", s.Hits+s.Misses)
+	fmt.Printf("  %-26s %12d\n", "cache hits:", s.Hits)
+	fmt.Printf("  %-26s %12d\n", "queries:", s.Misses)
+	fmt.Printf("  %-26s %12d\n", "failed queries:", s.Failures)
+
+	if len(s.Queries) == 0 {
+		return
+	}
+
+	q := computeRowStats(s.Queries)
+
+	fmt.Printf("  %-26s %12s\n", "query median:", formatDuration(q.Median))
+	fmt.Printf("  %-26s %12s\n", "query max:", formatDuration(q.Max))
+
+	for _, p := range q.Percentiles {
+		fmt.Printf("  %-26s %12s\n", fmt.Sprintf("query p%g:", p.Rank), formatDuration(p.Value))
+	}
+}
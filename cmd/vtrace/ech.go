@@ -0,0 +1,101 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"codeberg.org/pwnderpants/vtrace/internal/probe"
+)
+
+// resolveECHConfig extracts the ECH config list published in the target's HTTPS records
+func resolveECHConfig(records []probe.HTTPSRecord) ([]byte, error) {
+	config := probe.ECHConfigFromRecords(records)
+	if config == nil {
+		return nil, fmt.Errorf("no ECH config published for %s", url)
+	}
+
+	if verbose {
+		fmt.Printf("ECH config: %d bytes from HTTPS record\n", len(config))
+	}
+
+	return config, nil
+}
+
+// clientOptions builds the HTTP/1.1-2 transport options from the configured flags
+func clientOptions() probe.ClientOptions {
+	opts := probe.ClientOptions{
+		ECHConfigList: echConfigList,
+		Resolve:       dialPins(),
+		Nameserver:    dnsNameserver,
+		DNS:           dnsResolver,
+		Interface:     bindInterfaceName,
+		ReceiveBuffer: tcpReceiveBuffer,
+		Header:        requestHeader,
+		CMCD:          cmcdData,
+		Proxy:         proxyURL,
+		TLS:           tlsSettings,
+		Throttle:      throttle,
+	}
+
+	if freshDNS {
+		applyFreshDNS(&opts)
+	}
+
+	// Cold samples must not pick up a connection left in the shared pool
+	if sampleConnection() == connectionCold {
+		opts.DisableKeepAlives = true
+	}
+
+	applyResumption(&opts)
+
+	return opts
+}
+
+// newHTTPClient creates the HTTP/1.1-2 client used for measurements
+func newHTTPClient() *http.Client {
+	return probe.NewHTTPClientWithOptions(timeout, clientOptions())
+}
+
+// printECHComparison measures the manifest handshake with and without ECH on fresh connections
+func printECHComparison() error {
+	fetch := func(opts probe.ClientOptions) (*probe.Trace, error) {
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		defer cancel()
+
+		resp, trace, err := probe.FetchWithTrace(ctx, url, probe.NewHTTPClientWithOptions(timeout, opts))
+		if err != nil {
+			return nil, err
+		}
+
+		resp.Body.Close()
+
+		return trace, nil
+	}
+
+	withECH, err := fetch(probe.ClientOptions{ECHConfigList: echConfigList, DisableKeepAlives: true, Proxy: proxyURL, TLS: tlsSettings})
+	if err != nil {
+		return fmt.Errorf("ECH handshake failed: %w", err)
+	}
+
+	withoutECH, err := fetch(probe.ClientOptions{DisableKeepAlives: true, Proxy: proxyURL, TLS: tlsSettings})
+	if err != nil {
+		return fmt.Errorf("baseline handshake failed: %w", err)
+	}
+
+	accepted := "no"
+
+	if withECH.ECHAccepted {
+		accepted = "yes"
+	}
+
+	fmt.Println()
+	fmt.Println("Encrypted Client Hello")
+	fmt.Println("────────────────────────────────────────────────────")
+	fmt.Printf("ECH Accepted:                %12s\n", accepted)
+	fmt.Printf("TLS Handshake (ECH):         %12s\n", formatDuration(withECH.TLSHandshake))
+	fmt.Printf("TLS Handshake (no ECH):      %12s\n", formatDuration(withoutECH.TLSHandshake))
+	fmt.Printf("ECH Delta:                   %12s\n", formatDelta(withoutECH.TLSHandshake, withECH.TLSHandshake))
+
+	return nil
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"codeberg.org/pwnderpants/vtrace/internal/history"
+	"codeberg.org/pwnderpants/vtrace/internal/report"
+	"codeberg.org/pwnderpants/vtrace/internal/sink"
+)
+
+// smtpPasswordEnv names the environment variable holding the SMTP password
+const smtpPasswordEnv = "VTRACE_SMTP_PASSWORD"
+
+var (
+	smtpServer   string
+	smtpFrom     string
+	smtpUsername string
+	emailTo      []string
+	emailAt      string
+)
+
+// emailEnabled reports whether daily report delivery was requested
+func emailEnabled() bool {
+	return len(emailTo) > 0
+}
+
+// validateEmail checks the email flags before the daemon starts
+func validateEmail() (time.Duration, error) {
+	if smtpServer == "" || smtpFrom == "" {
+		return 0, errors.New("--email-to requires --smtp-server and --smtp-from")
+	}
+
+	at, err := time.Parse("15:04", emailAt)
+	if err != nil {
+		return 0, fmt.Errorf("invalid --email-at %q: expected HH:MM", emailAt)
+	}
+
+	return time.Duration(at.Hour())*time.Hour + time.Duration(at.Minute())*time.Minute, nil
+}
+
+// nextDailyRun returns the next local time at the given offset past midnight
+func nextDailyRun(now time.Time, offset time.Duration) time.Time {
+	midnight := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	next := midnight.Add(offset)
+
+	if !next.After(now) {
+		next = time.Date(now.Year(), now.Month(), now.Day()+1, 0, 0, 0, 0, now.Location()).Add(offset)
+	}
+
+	return next
+}
+
+// emailOnSchedule sends the aggregate report for the previous 24 hours once a day
+func emailOnSchedule(ctx context.Context, store history.Store, offset time.Duration) {
+	for {
+		next := nextDailyRun(time.Now(), offset)
+		timer := time.NewTimer(time.Until(next))
+
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+
+			return
+		case <-timer.C:
+		}
+
+		// Delivery failures are reported but never stop the daemon
+		if err := sendDailyReport(store, next); err != nil {
+			fmt.Fprintf(os.Stderr, "warning: %v\n", err)
+
+			continue
+		}
+
+		fmt.Printf("%s  daily report emailed to %d recipient(s)\n", time.Now().UTC().Format(time.RFC3339), len(emailTo))
+	}
+}
+
+// sendDailyReport builds the report for the day ending at `to` and emails it
+func sendDailyReport(store history.Store, to time.Time) error {
+	from := to.Add(-24 * time.Hour)
+
+	records, err := store.Query(from, to)
+	if err != nil {
+		return err
+	}
+
+	daily := report.New(runID, exportURL(url))
+	daily.StartedAt = from.UTC()
+	daily.Config = runConfig
+
+	for _, sample := range reportSamples(records) {
+		daily.Add(sample)
+	}
+
+	daily.Finish()
+	daily.FinishedAt = to.UTC()
+
+	htmlBody, err := daily.HTML()
+	if err != nil {
+		return err
+	}
+
+	csvBody, err := daily.CSV()
+	if err != nil {
+		return err
+	}
+
+	cfg := sink.SMTPConfig{
+		Server:   smtpServer,
+		From:     smtpFrom,
+		To:       emailTo,
+		Username: smtpUsername,
+		Password: os.Getenv(smtpPasswordEnv),
+	}
+
+	subject := fmt.Sprintf("vtrace daily report for %s (%s)", exportURL(url), to.Format("2006-01-02"))
+	attachment := sink.Attachment{
+		Name:        fmt.Sprintf("vtrace-%s.csv", to.Format("2006-01-02")),
+		ContentType: "text/csv; charset=utf-8",
+		Data:        csvBody,
+	}
+
+	attachments := []sink.Attachment{attachment}
+
+	// The diurnal heat table rides along so peak-hour trends arrive with the daily numbers
+	if diurnalWindow > 0 {
+		diurnalBody, err := buildDiurnalHTML(store, to)
+		if err != nil {
+			return err
+		}
+
+		attachments = append(attachments, sink.Attachment{
+			Name:        fmt.Sprintf("vtrace-diurnal-%s.html", to.Format("2006-01-02")),
+			ContentType: "text/html; charset=utf-8",
+			Data:        diurnalBody,
+		})
+	}
+
+	return sink.SendEmail(cfg, subject, htmlBody, attachments)
+}
+
+// reportSamples converts stored history records into report samples
+func reportSamples(records []history.Record) []report.Sample {
+	samples := make([]report.Sample, 0, len(records))
+
+	for i, record := range records {
+		samples = append(samples, report.Sample{
+			Index:    i + 1,
+			Protocol: record.Protocol,
+			Time:     record.Time,
+			URL:      record.URL,
+			Error:    record.Error,
+			Metrics:  record.Metrics,
+		})
+	}
+
+	return samples
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"codeberg.org/pwnderpants/vtrace/internal/history"
+	"codeberg.org/pwnderpants/vtrace/internal/ttff"
+)
+
+// defaultHistoryPath is where samples are stored when no history file is given
+const defaultHistoryPath = "sqlite:vtrace-history.db"
+
+var (
+	experimentName string
+	experimentArm  string
+	runHistoryPath string
+)
+
+// historyStore receives every sample when --history or --experiment is set
+var historyStore history.Store
+
+// openRunHistory validates experiment labels and opens the history store
+func openRunHistory() error {
+	if experimentName != "" && experimentArm == "" {
+		return errors.New("--arm is required with --experiment")
+	}
+
+	if experimentArm != "" && experimentName == "" {
+		return errors.New("--experiment is required with --arm")
+	}
+
+	path := runHistoryPath
+
+	// Experiments always need their samples stored for ab-report
+	if path == "" && experimentName != "" {
+		path = defaultHistoryPath
+	}
+
+	if path == "" {
+		return nil
+	}
+
+	var err error
+
+	historyStore, err = history.Open(path)
+
+	return err
+}
+
+// closeRunHistory releases the history store opened for this run
+func closeRunHistory() {
+	if historyStore == nil {
+		return
+	}
+
+	if err := historyStore.Close(); err != nil {
+		fmt.Fprintf(os.Stderr, "warning: failed to close history store: %v\n", err)
+	}
+}
+
+// recordHistory appends a sample outcome of target, labelled with the experiment arm, to the history store
+func recordHistory(target, protocol string, sample ttff.Sample, sampleErr error) {
+	record := history.Record{
+		RunID:      runID,
+		Time:       time.Now().UTC(),
+		URL:        exportURL(target),
+		Protocol:   protocol,
+		Experiment: experimentName,
+		Arm:        experimentArm,
+		Labels:     recordLabels,
+		Config:     runFingerprint(),
+	}
+
+	if sampleErr != nil {
+		record.Error = exportError(sampleErr)
+	} else {
+		record.Metrics = sampleMetrics(sample)
+	}
+
+	// A failed write is reported but never fails the run
+	if err := historyStore.Append(record); err != nil {
+		fmt.Fprintf(os.Stderr, "warning: %v\n", err)
+	}
+}
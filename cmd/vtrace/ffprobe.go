@@ -0,0 +1,102 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"codeberg.org/pwnderpants/vtrace/internal/decoder"
+	"codeberg.org/pwnderpants/vtrace/internal/ttff"
+)
+
+// detectFFprobe looks up the ffprobe build before measuring, so version probing never
+// lands inside a timed frame detection and skewed builds are visible up front
+func detectFFprobe() {
+	// Builds with -tags libav never spawn ffprobe
+	if libav, ok := decoder.LinkedLibav(); ok {
+		if verbose {
+			fmt.Printf("Frame decoder: native, falling back to %s in-process\n", libav)
+		}
+
+		return
+	}
+
+	info, err := decoder.InstalledFFprobe()
+
+	switch {
+	case errors.Is(err, decoder.ErrFFprobeNotFound):
+		if verbose {
+			fmt.Println("Frame decoder: native only (ffprobe not found)")
+		}
+	case !info.ReadIntervals:
+		fmt.Fprintf(os.Stderr, "warning: %s predates -read_intervals; ffprobe frame detection reads whole segments and is slower\n", info)
+	case verbose:
+		fmt.Printf("Frame decoder: native, falling back to %s\n", info)
+	}
+}
+
+// decoderWarmup runs the frame decoders once before the first timed sample
+var decoderWarmup bool
+
+// warmUpDecoder exercises the native parser and spawns ffprobe on a built-in segment, so
+// cold binaries and page cache on fresh containers do not inflate the first frame detection
+func warmUpDecoder() {
+	if !decoderWarmup {
+		return
+	}
+
+	elapsed, err := decoder.WarmUp(context.Background())
+
+	// A failed warm-up only costs the first sample its head start
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "warning: decoder warm-up failed: %v\n", err)
+
+		return
+	}
+
+	if verbose {
+		fmt.Printf("Decoder warm-up: %s\n", formatDuration(elapsed))
+	}
+}
+
+// printFrameDecoders names the decoders that found the first frame, with sample
+// counts when a run used more than one
+func printFrameDecoders(allSamples []ttff.Sample) {
+	counts := make(map[string]int)
+
+	for _, sample := range allSamples {
+		if sample.FrameDecoder != "" {
+			counts[sample.FrameDecoder]++
+		}
+	}
+
+	switch len(counts) {
+	case 0:
+		return
+	case 1:
+		for name := range counts {
+			fmt.Printf("Frame decoder: %s\n", name)
+		}
+
+		return
+	}
+
+	names := make([]string, 0, len(counts))
+
+	for name := range counts {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	parts := make([]string, len(names))
+
+	for i, name := range names {
+		parts[i] = fmt.Sprintf("%s (%d samples)", name, counts[name])
+	}
+
+	fmt.Printf("Frame decoders: %s\n", strings.Join(parts, ", "))
+}
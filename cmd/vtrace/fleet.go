@@ -0,0 +1,404 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	neturl "net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"codeberg.org/pwnderpants/vtrace/internal/history"
+	"codeberg.org/pwnderpants/vtrace/internal/sink"
+	"codeberg.org/pwnderpants/vtrace/internal/stats"
+)
+
+var (
+	fleetSources []string
+	fleetGroupBy string
+	fleetFilter  string
+	fleetSince   time.Duration
+	fleetCSVPath string
+	fleetTimeout time.Duration
+)
+
+var fleetReportCmd = &cobra.Command{
+	Use:   "fleet-report",
+	Short: "Merge the history of several agents into a per-region TTFF summary",
+	Long: `fleet-report pulls stored samples from every --source, which is either a
+history store (file path, sqlite:PATH, or postgres:// URL) or the address of a
+vtrace serve agent (http(s)://host:port, read from its /history endpoint). Samples
+are merged by URL and by the vantage label named by --group-by (set with --label
+when measuring); samples without that label are attributed to the source they came
+from. Records pulled twice (e.g., an agent listed by file and by address) are
+counted once.`,
+	Args: cobra.NoArgs,
+	RunE: runFleetReport,
+}
+
+// fleetSource holds the records pulled from one agent or store
+type fleetSource struct {
+	name    string
+	records []history.Record
+}
+
+// fleetGroup collects the samples of one URL seen from one vantage point
+type fleetGroup struct {
+	url      string
+	vantage  string
+	agents   map[string]bool
+	ttff     []time.Duration
+	samples  int
+	failures int
+}
+
+// init registers the fleet-report subcommand and its flags
+func init() {
+	fleetReportCmd.Flags().StringArrayVar(&fleetSources, "source", nil, "History store or serve agent address to include (repeatable)")
+	fleetReportCmd.Flags().StringVar(&fleetGroupBy, "group-by", "region", "Label that names the vantage point of each sample")
+	fleetReportCmd.Flags().StringVar(&fleetFilter, "filter", "", "Only include matching samples (e.g., url=https://cdn.example.com/*)")
+	fleetReportCmd.Flags().DurationVar(&fleetSince, "since", 24*time.Hour, "Only include samples from this far back (0 for all)")
+	fleetReportCmd.Flags().StringVar(&fleetCSVPath, "csv", "", "Also write the summary to this CSV file")
+	fleetReportCmd.Flags().DurationVar(&fleetTimeout, "timeout", 30*time.Second, "Time limit for pulling history from each agent")
+
+	fleetReportCmd.MarkFlagRequired("source")
+
+	rootCmd.AddCommand(fleetReportCmd)
+}
+
+// runFleetReport pulls every source, merges the samples, and prints the summary
+func runFleetReport(cmd *cobra.Command, args []string) error {
+	if fleetGroupBy == "" {
+		return errors.New("--group-by must name a label")
+	}
+
+	var filter history.Filter
+
+	if fleetFilter != "" {
+		var err error
+
+		filter, err = history.ParseFilter(fleetFilter)
+		if err != nil {
+			return err
+		}
+	}
+
+	var from time.Time
+
+	if fleetSince > 0 {
+		from = time.Now().Add(-fleetSince)
+	}
+
+	sources := make([]fleetSource, 0, len(fleetSources))
+
+	for _, location := range fleetSources {
+		records, err := pullFleetSource(location, from)
+		if err != nil {
+			return fmt.Errorf("%s: %w", location, err)
+		}
+
+		sources = append(sources, fleetSource{name: fleetSourceName(location), records: records})
+	}
+
+	groups := mergeFleet(sources, filter)
+	if len(groups) == 0 {
+		return errors.New("no samples match in any source")
+	}
+
+	printFleetReport(sources, groups)
+
+	if fleetCSVPath != "" {
+		if err := writeFleetCSV(fleetCSVPath, groups); err != nil {
+			return err
+		}
+
+		fmt.Printf("\nSummary written to %s\n", fleetCSVPath)
+	}
+
+	return nil
+}
+
+// pullFleetSource reads the records since from from a history store or a serve agent
+func pullFleetSource(location string, from time.Time) ([]history.Record, error) {
+	if !isAgentAddress(location) {
+		store, err := openStoredHistory(location)
+		if err != nil {
+			return nil, err
+		}
+		defer store.Close()
+
+		return store.Query(from, time.Now())
+	}
+
+	endpoint, err := neturl.Parse(strings.TrimSuffix(location, "/") + "/history")
+	if err != nil {
+		return nil, fmt.Errorf("invalid agent address: %w", err)
+	}
+
+	if !from.IsZero() {
+		endpoint.RawQuery = neturl.Values{"from": {from.UTC().Format(time.RFC3339)}}.Encode()
+	}
+
+	client := &http.Client{Timeout: fleetTimeout}
+
+	resp, err := client.Get(endpoint.String())
+	if err != nil {
+		return nil, fmt.Errorf("failed to pull history: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to pull history: %s", resp.Status)
+	}
+
+	return decodeRecordLines(resp.Body)
+}
+
+// isAgentAddress reports whether a source names a serve agent rather than a history store
+func isAgentAddress(location string) bool {
+	return strings.HasPrefix(location, "http://") || strings.HasPrefix(location, "https://")
+}
+
+// fleetSourceName shortens a source to the host of an agent or the store location without
+// credentials, which names samples that carry no vantage label
+func fleetSourceName(location string) string {
+	parsed, err := neturl.Parse(location)
+	if err != nil || parsed.Host == "" {
+		return location
+	}
+
+	if isAgentAddress(location) {
+		return parsed.Host
+	}
+
+	return parsed.Redacted()
+}
+
+// decodeRecordLines reads the newline-delimited records written by the /history endpoint
+func decodeRecordLines(r io.Reader) ([]history.Record, error) {
+	var records []history.Record
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+
+	for line := 1; scanner.Scan(); line++ {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+
+		record, err := history.DecodeRecord(scanner.Bytes())
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+
+		records = append(records, record)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read history: %w", err)
+	}
+
+	return records, nil
+}
+
+// mergeFleet groups the matching records of every source by URL and vantage point, ordered
+// by URL and then vantage
+func mergeFleet(sources []fleetSource, filter history.Filter) []*fleetGroup {
+	seen := make(map[string]bool)
+	byKey := make(map[[2]string]*fleetGroup)
+
+	var groups []*fleetGroup
+
+	for _, source := range sources {
+		for _, record := range source.records {
+			if !filter.Match(record) {
+				continue
+			}
+
+			key := history.RecordKey(record)
+
+			if seen[key] {
+				continue
+			}
+
+			seen[key] = true
+
+			vantage := record.Labels[fleetGroupBy]
+			if vantage == "" {
+				vantage = source.name
+			}
+
+			group := byKey[[2]string{record.URL, vantage}]
+
+			if group == nil {
+				group = &fleetGroup{url: record.URL, vantage: vantage, agents: make(map[string]bool)}
+				byKey[[2]string{record.URL, vantage}] = group
+				groups = append(groups, group)
+			}
+
+			group.agents[source.name] = true
+
+			// An hourly aggregate contributes its mean once but counts all of its samples
+			if record.IsAggregate() {
+				group.samples += record.Samples
+				group.failures += record.Failures
+			} else {
+				group.samples++
+
+				if record.Error != "" {
+					group.failures++
+				}
+			}
+
+			if ttff, ok := record.Metrics["total_ttff"]; ok && record.Error == "" {
+				group.ttff = append(group.ttff, time.Duration(ttff*float64(time.Millisecond)))
+			}
+		}
+	}
+
+	sort.Slice(groups, func(i, j int) bool {
+		if groups[i].url != groups[j].url {
+			return groups[i].url < groups[j].url
+		}
+
+		return groups[i].vantage < groups[j].vantage
+	})
+
+	return groups
+}
+
+// printFleetReport outputs the sources and one TTFF table per URL with a row per vantage point
+func printFleetReport(sources []fleetSource, groups []*fleetGroup) {
+	fmt.Println("vtrace fleet report")
+
+	for _, source := range sources {
+		fmt.Printf("  %s: %d %s\n", source.name, len(source.records), plural(len(source.records), "record"))
+	}
+
+	// Vantage points named after a store path can be long; the column widens to fit them
+	width := 16
+
+	for _, group := range groups {
+		width = max(width, len(group.vantage))
+	}
+
+	rule := strings.Repeat("─", width+82)
+
+	for i, group := range groups {
+		if i == 0 || groups[i-1].url != group.url {
+			fmt.Println()
+			fmt.Printf("URL: %s\n", group.url)
+			fmt.Println(rule)
+			fmt.Printf("%-*s %7s %8s %8s %10s %10s %10s %10s %10s\n", width, strings.ToUpper(fleetGroupBy[:1])+fleetGroupBy[1:], "Agents", "Samples", "Failed", "Avg", "Median", "P95", "Min", "StdDev")
+			fmt.Println(rule)
+		}
+
+		if len(group.ttff) == 0 {
+			fmt.Printf("%-*s %7d %8d %8d %10s\n", width, group.vantage, len(group.agents), group.samples, group.failures, "-")
+
+			continue
+		}
+
+		s := stats.ComputeStats(group.ttff)
+
+		fmt.Printf("%-*s %7d %8d %8d %10s %10s %10s %10s %10s\n",
+			width,
+			group.vantage,
+			len(group.agents),
+			group.samples,
+			group.failures,
+			formatDuration(s.Mean),
+			formatDuration(s.Median),
+			formatDuration(s.Percentile(95)),
+			formatDuration(s.Min),
+			formatDuration(s.StdDev),
+		)
+	}
+}
+
+// writeFleetCSV writes one row per URL and vantage point
+func writeFleetCSV(path string, groups []*fleetGroup) error {
+	writer, err := sink.NewCSVWriter(path, []string{
+		"url", fleetGroupBy, "agents", "samples", "failures",
+		"avg_ttff_ms", "median_ttff_ms", "p95_ttff_ms", "min_ttff_ms", "stddev_ttff_ms",
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, group := range groups {
+		row := []string{group.url, group.vantage, strconv.Itoa(len(group.agents)), strconv.Itoa(group.samples), strconv.Itoa(group.failures)}
+
+		if len(group.ttff) == 0 {
+			row = append(row, "", "", "", "", "")
+		} else {
+			s := stats.ComputeStats(group.ttff)
+
+			row = append(row,
+				sink.FormatMillis(s.Mean),
+				sink.FormatMillis(s.Median),
+				sink.FormatMillis(s.Percentile(95)),
+				sink.FormatMillis(s.Min),
+				sink.FormatMillis(s.StdDev),
+			)
+		}
+
+		if err := writer.Write(row); err != nil {
+			writer.Close()
+
+			return err
+		}
+	}
+
+	return writer.Close()
+}
+
+// historyHandler serves the stored records as newline-delimited JSON for fleet-report; the
+// optional from and to parameters (RFC 3339) bound the time range
+func historyHandler(store history.Store) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var from time.Time
+
+		to := time.Now()
+
+		for name, bound := range map[string]*time.Time{"from": &from, "to": &to} {
+			value := r.URL.Query().Get(name)
+			if value == "" {
+				continue
+			}
+
+			parsed, err := time.Parse(time.RFC3339, value)
+			if err != nil {
+				http.Error(w, fmt.Sprintf("invalid %s: %v", name, err), http.StatusBadRequest)
+
+				return
+			}
+
+			*bound = parsed
+		}
+
+		records, err := store.Query(from, to)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/x-ndjson")
+
+		encoder := json.NewEncoder(w)
+
+		for _, record := range records {
+			if err := encoder.Encode(record); err != nil {
+				return
+			}
+		}
+	})
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"codeberg.org/pwnderpants/vtrace/internal/numfmt"
+)
+
+var (
+	numberLocale       string
+	decimalSeparator   string
+	thousandsSeparator string
+	numberWidth        int
+)
+
+// numberFormat renders every duration in the result tables
+var numberFormat = numfmt.Default()
+
+// setupNumberFormat applies the locale and separator flags, explicit separators winning over the locale
+func setupNumberFormat() error {
+	format := numfmt.Default()
+
+	if numberLocale != "" {
+		var err error
+
+		format, err = numfmt.Locale(numberLocale)
+		if err != nil {
+			return err
+		}
+	}
+
+	if decimalSeparator != "" {
+		format.Decimal = decimalSeparator
+	}
+
+	if thousandsSeparator != "" {
+		format.Thousands = thousandsSeparator
+	}
+
+	format.Width = numberWidth
+	numberFormat = format
+
+	return nil
+}
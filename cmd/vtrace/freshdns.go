@@ -0,0 +1,58 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+
+	"codeberg.org/pwnderpants/vtrace/internal/probe"
+)
+
+// freshDNS repeats the DNS lookup and opens new connections for every sample
+var freshDNS bool
+
+// validateFreshDNS rejects modes where the client never resolves the stream host itself
+func validateFreshDNS() error {
+	if !freshDNS {
+		return nil
+	}
+
+	switch {
+	case proxyURL != nil:
+		return errors.New("--fresh-dns cannot be combined with --proxy (the proxy resolves the host)")
+	case len(pinnedHosts) > 0:
+		return errors.New("--fresh-dns cannot be combined with --resolve")
+	case allIPs:
+		return errors.New("--fresh-dns cannot be combined with --all-ips")
+	}
+
+	return nil
+}
+
+// applyFreshDNS disables keep-alives and sends lookups straight to the nameserver, so
+// neither a pooled connection nor the OS resolver cache can answer for a sample
+func applyFreshDNS(opts *probe.ClientOptions) {
+	opts.DisableKeepAlives = true
+
+	if opts.Nameserver == "" {
+		opts.Nameserver = probe.SystemNameserver()
+	}
+}
+
+// printConnectionMode states whether samples reused connections and DNS answers, which
+// explains 0ms DNS, TCP, and TLS phases after the first sample
+func printConnectionMode(count int) {
+	opts := clientOptions()
+
+	switch {
+	case warmConnections:
+		fmt.Println("Connections: warmed by a throwaway manifest request before each sample (--warm)")
+	case freshDNS:
+		fmt.Printf("Connections: fresh DNS lookup via %s and new connections per sample (--fresh-dns)\n", opts.Nameserver)
+	case count > 1 && opts.SharesConnections():
+		fmt.Println("Connections: reused across samples; reused samples show 0ms DNS, TCP, and TLS (--fresh-dns repeats them)")
+	case count > 1 && dnsResolver != nil:
+		fmt.Println("Connections: new per sample; DNS answered by vtrace's cache until answers expire (--dns-cache)")
+	case count > 1:
+		fmt.Println("Connections: new per sample; DNS may be answered from the OS cache (--fresh-dns queries the nameserver)")
+	}
+}
@@ -0,0 +1,378 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	neturl "net/url"
+	"os"
+	"runtime/debug"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"codeberg.org/pwnderpants/vtrace/internal/probe"
+	"codeberg.org/pwnderpants/vtrace/internal/ttff"
+)
+
+// harPath is the HAR 1.2 file written with every request of the run
+var harPath string
+
+// harRecorder collects the traces of every sample while --har is set
+var harRecorder *harCapture
+
+// harCapture holds a page per sample and the traces of the requests made for it. Traces
+// are converted when the file is written, once their bodies have been read.
+type harCapture struct {
+	mu     sync.Mutex
+	pages  []*harPageCapture
+	traces []harTrace
+}
+
+// harPageCapture is one sample; onLoad carries its Total TTFF
+type harPageCapture struct {
+	id      string
+	title   string
+	started time.Time
+	onLoad  time.Duration
+}
+
+// harTrace is a request traced for a page
+type harTrace struct {
+	page  string
+	trace *probe.Trace
+}
+
+// startHARPage opens a page for a sample and returns a context whose traced requests are
+// recorded on it; the context is returned unchanged without --har
+func startHARPage(ctx context.Context, target string, index int, protocol string) (context.Context, *harPageCapture) {
+	if harRecorder == nil {
+		return ctx, nil
+	}
+
+	h := harRecorder
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	page := &harPageCapture{
+		id:      fmt.Sprintf("sample_%d", len(h.pages)+1),
+		title:   fmt.Sprintf("Sample %d (%s): %s", index+1, protocol, target),
+		started: time.Now(),
+	}
+
+	h.pages = append(h.pages, page)
+
+	return probe.WithTraceObserver(ctx, func(trace *probe.Trace) {
+		h.mu.Lock()
+		defer h.mu.Unlock()
+
+		h.traces = append(h.traces, harTrace{page: page.id, trace: trace})
+	}), page
+}
+
+// finish records the Total TTFF of a successful sample as the load time of its page
+func (p *harPageCapture) finish(sample ttff.Sample, err error) {
+	if p == nil || err != nil {
+		return
+	}
+
+	harRecorder.mu.Lock()
+	defer harRecorder.mu.Unlock()
+
+	p.onLoad = sample.TotalTTFF
+}
+
+// The HAR 1.2 document (http://www.softwareishard.com/blog/har-12-spec/)
+type (
+	harFile struct {
+		Log harLog `json:"log"`
+	}
+
+	harLog struct {
+		Version string     `json:"version"`
+		Creator harCreator `json:"creator"`
+		Pages   []harPage  `json:"pages"`
+		Entries []harEntry `json:"entries"`
+	}
+
+	harCreator struct {
+		Name    string `json:"name"`
+		Version string `json:"version"`
+	}
+
+	harPage struct {
+		StartedDateTime string         `json:"startedDateTime"`
+		ID              string         `json:"id"`
+		Title           string         `json:"title"`
+		PageTimings     harPageTimings `json:"pageTimings"`
+	}
+
+	harPageTimings struct {
+		OnContentLoad float64 `json:"onContentLoad"`
+		OnLoad        float64 `json:"onLoad"`
+	}
+
+	harEntry struct {
+		PageRef         string      `json:"pageref"`
+		StartedDateTime string      `json:"startedDateTime"`
+		Time            float64     `json:"time"`
+		Request         harRequest  `json:"request"`
+		Response        harResponse `json:"response"`
+		Cache           struct{}    `json:"cache"`
+		Timings         harTimings  `json:"timings"`
+		ServerIPAddress string      `json:"serverIPAddress,omitempty"`
+		Connection      string      `json:"connection,omitempty"`
+	}
+
+	harRequest struct {
+		Method      string  `json:"method"`
+		URL         string  `json:"url"`
+		HTTPVersion string  `json:"httpVersion"`
+		Cookies     []harNV `json:"cookies"`
+		Headers     []harNV `json:"headers"`
+		QueryString []harNV `json:"queryString"`
+		HeadersSize int     `json:"headersSize"`
+		BodySize    int     `json:"bodySize"`
+	}
+
+	harResponse struct {
+		Status      int        `json:"status"`
+		StatusText  string     `json:"statusText"`
+		HTTPVersion string     `json:"httpVersion"`
+		Cookies     []harNV    `json:"cookies"`
+		Headers     []harNV    `json:"headers"`
+		Content     harContent `json:"content"`
+		RedirectURL string     `json:"redirectURL"`
+		HeadersSize int        `json:"headersSize"`
+		BodySize    int64      `json:"bodySize"`
+	}
+
+	harContent struct {
+		Size     int64  `json:"size"`
+		MimeType string `json:"mimeType"`
+	}
+
+	harNV struct {
+		Name  string `json:"name"`
+		Value string `json:"value"`
+	}
+
+	// harTimings are in milliseconds; -1 marks a phase that did not happen (e.g., DNS and
+	// connect on a reused connection)
+	harTimings struct {
+		Blocked float64 `json:"blocked"`
+		DNS     float64 `json:"dns"`
+		Connect float64 `json:"connect"`
+		Send    float64 `json:"send"`
+		Wait    float64 `json:"wait"`
+		Receive float64 `json:"receive"`
+		SSL     float64 `json:"ssl"`
+	}
+)
+
+// writeHAR writes the pages and requests recorded during the run to --har
+func writeHAR() {
+	if harRecorder == nil {
+		return
+	}
+
+	h := harRecorder
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	doc := harFile{Log: harLog{
+		Version: "1.2",
+		Creator: harCreator{Name: "vtrace", Version: harCreatorVersion()},
+		Pages:   make([]harPage, 0, len(h.pages)),
+		Entries: make([]harEntry, 0, len(h.traces)),
+	}}
+
+	for _, page := range h.pages {
+		onLoad := -1.0
+
+		if page.onLoad > 0 {
+			onLoad = harMillis(page.onLoad)
+		}
+
+		doc.Log.Pages = append(doc.Log.Pages, harPage{
+			StartedDateTime: page.started.Format(time.RFC3339Nano),
+			ID:              page.id,
+			Title:           page.title,
+			PageTimings:     harPageTimings{OnContentLoad: -1, OnLoad: onLoad},
+		})
+	}
+
+	for _, t := range h.traces {
+		doc.Log.Entries = append(doc.Log.Entries, newHAREntry(t.page, t.trace))
+	}
+
+	body, err := json.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "warning: failed to encode HAR: %v\n", err)
+
+		return
+	}
+
+	if err := os.WriteFile(harPath, append(body, '\n'), 0o644); err != nil {
+		fmt.Fprintf(os.Stderr, "warning: failed to write HAR: %v\n", err)
+
+		return
+	}
+
+	fmt.Printf("HAR with %d %s written to %s\n", len(doc.Log.Entries), plural(len(doc.Log.Entries), "request"), harPath)
+}
+
+// newHAREntry converts a traced request. Redirect hops are entries of their own, so the
+// time of the hops before it is taken out of the final request.
+func newHAREntry(page string, trace *probe.Trace) harEntry {
+	request := trace.Request
+
+	if request == nil {
+		request = &probe.RequestInfo{Method: http.MethodGet}
+	}
+
+	timings := harTimings{Blocked: -1, DNS: -1, Connect: -1, Send: 0, SSL: -1}
+
+	if trace.DNSLookup > 0 {
+		timings.DNS = harMillis(trace.DNSLookup)
+	}
+
+	// HAR counts the TLS handshake as part of connect; QUIC does both in one handshake, and
+	// a reused QUIC connection still reports the wait for it
+	switch {
+	case trace.QUICHandshake > 0 && trace.Handshake != nil:
+		timings.Connect = harMillis(trace.QUICHandshake)
+		timings.SSL = timings.Connect
+	case trace.TCPConnect > 0:
+		timings.Connect = harMillis(trace.TCPConnect + trace.TLSHandshake)
+
+		if trace.TLSHandshake > 0 {
+			timings.SSL = harMillis(trace.TLSHandshake)
+		}
+	}
+
+	total := trace.Total - trace.RedirectTime
+	bodySize := int64(-1)
+
+	if trace.Download > 0 {
+		total = trace.Download - trace.RedirectTime
+		bodySize = trace.Bytes
+	}
+
+	wait := trace.TTFB - trace.DNSLookup - trace.TCPConnect - trace.TLSHandshake
+
+	if trace.Handshake != nil {
+		wait -= trace.QUICHandshake
+	}
+	timings.Wait = harMillis(max(wait, 0))
+	timings.Receive = harMillis(max(total-trace.TTFB, 0))
+
+	elapsed := timings.Send + timings.Wait + timings.Receive
+
+	for _, phase := range []float64{timings.DNS, timings.Connect} {
+		if phase > 0 {
+			elapsed += phase
+		}
+	}
+
+	entry := harEntry{
+		PageRef:         page,
+		StartedDateTime: trace.Start.Format(time.RFC3339Nano),
+		Time:            elapsed,
+		Request: harRequest{
+			Method:      request.Method,
+			URL:         request.URL,
+			HTTPVersion: trace.Proto,
+			Cookies:     []harNV{},
+			Headers:     harHeaders(request.Header),
+			QueryString: harQuery(request.URL),
+			HeadersSize: -1,
+			BodySize:    0,
+		},
+		Response: harResponse{
+			Status:      trace.StatusCode,
+			StatusText:  http.StatusText(trace.StatusCode),
+			HTTPVersion: trace.Proto,
+			Cookies:     []harNV{},
+			Headers:     harHeaders(trace.Header),
+			Content:     harContent{Size: max(bodySize, 0), MimeType: trace.Header.Get("Content-Type")},
+			RedirectURL: trace.Header.Get("Location"),
+			HeadersSize: -1,
+			BodySize:    bodySize,
+		},
+		Timings:    timings,
+		Connection: trace.Conn.LocalAddr,
+	}
+
+	if host, _, err := net.SplitHostPort(trace.Conn.RemoteAddr); err == nil {
+		entry.ServerIPAddress = host
+	}
+
+	return entry
+}
+
+// harHeaders lists headers as name/value pairs in name order, one per value
+func harHeaders(header http.Header) []harNV {
+	names := make([]string, 0, len(header))
+
+	for name := range header {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	pairs := []harNV{}
+
+	for _, name := range names {
+		for _, value := range header[name] {
+			pairs = append(pairs, harNV{Name: name, Value: value})
+		}
+	}
+
+	return pairs
+}
+
+// harQuery lists the query parameters of a URL in the order they appear
+func harQuery(raw string) []harNV {
+	pairs := []harNV{}
+
+	parsed, err := neturl.Parse(raw)
+	if err != nil || parsed.RawQuery == "" {
+		return pairs
+	}
+
+	for _, param := range strings.Split(parsed.RawQuery, "&") {
+		name, value, _ := strings.Cut(param, "=")
+
+		if unescaped, err := neturl.QueryUnescape(name); err == nil {
+			name = unescaped
+		}
+
+		if unescaped, err := neturl.QueryUnescape(value); err == nil {
+			value = unescaped
+		}
+
+		pairs = append(pairs, harNV{Name: name, Value: value})
+	}
+
+	return pairs
+}
+
+// harMillis converts a duration to fractional milliseconds
+func harMillis(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
+
+// harCreatorVersion names the vtrace build in the HAR creator
+func harCreatorVersion() string {
+	if info, ok := debug.ReadBuildInfo(); ok {
+		return vtraceVersion(info)
+	}
+
+	return "unknown"
+}
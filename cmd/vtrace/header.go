@@ -0,0 +1,87 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"golang.org/x/net/http/httpguts"
+
+	"codeberg.org/pwnderpants/vtrace/internal/ttff"
+)
+
+var (
+	headerSpecs         []string
+	manifestHeaderSpecs []string
+	segmentHeaderSpecs  []string
+	userAgent           string
+
+	// requestHeader holds the parsed --header and --user-agent values sent with every request
+	requestHeader http.Header
+
+	// phaseHeaders holds the --manifest-header and --segment-header values by phase
+	phaseHeaders = make(map[string]http.Header)
+)
+
+// setupRequestHeaders parses the --header and --user-agent flags
+func setupRequestHeaders() error {
+	header, err := parseHeaders(headerSpecs)
+	if err != nil {
+		return fmt.Errorf("--header: %w", err)
+	}
+
+	// --user-agent wins over a User-Agent passed with --header
+	if userAgent != "" {
+		if header == nil {
+			header = make(http.Header)
+		}
+
+		header.Set("User-Agent", userAgent)
+	}
+
+	requestHeader = header
+
+	manifestHeader, err := parseHeaders(manifestHeaderSpecs)
+	if err != nil {
+		return fmt.Errorf("--manifest-header: %w", err)
+	}
+
+	segmentHeader, err := parseHeaders(segmentHeaderSpecs)
+	if err != nil {
+		return fmt.Errorf("--segment-header: %w", err)
+	}
+
+	// Master and media playlists share the manifest headers; init sections and parts the segment ones
+	phaseHeaders[ttff.PhaseManifest] = manifestHeader
+	phaseHeaders[ttff.PhaseMedia] = manifestHeader
+	phaseHeaders[ttff.PhaseSegment] = segmentHeader
+
+	return nil
+}
+
+// parseHeaders turns "Name: value" entries into a header map, keeping repeated names
+func parseHeaders(specs []string) (http.Header, error) {
+	if len(specs) == 0 {
+		return nil, nil
+	}
+
+	header := make(http.Header)
+
+	for _, spec := range specs {
+		name, value, ok := strings.Cut(spec, ":")
+		name = strings.TrimSpace(name)
+		value = strings.TrimSpace(value)
+
+		if !ok || !httpguts.ValidHeaderFieldName(name) {
+			return nil, fmt.Errorf("invalid header %q (want \"Name: value\")", spec)
+		}
+
+		if !httpguts.ValidHeaderFieldValue(value) {
+			return nil, fmt.Errorf("invalid value in header %q", spec)
+		}
+
+		header.Add(name, value)
+	}
+
+	return header, nil
+}
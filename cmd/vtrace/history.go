@@ -0,0 +1,367 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"codeberg.org/pwnderpants/vtrace/internal/history"
+	"codeberg.org/pwnderpants/vtrace/internal/stats"
+)
+
+var (
+	historyStorePath string
+	historyFilter    string
+	historySince     time.Duration
+	historyRaw       bool
+	historyLimit     int
+	historyWindow    time.Duration
+)
+
+var historyCmd = &cobra.Command{
+	Use:   "history",
+	Short: "Inspect, compare, and prune stored samples",
+	Long: `history works on the store written by --history and serve, so TTFF trends
+for a stream can be tracked over days without extra tooling. Use sqlite:PATH for
+a local SQLite database (requires a build with -tags sqlite).`,
+}
+
+var historyShowCmd = &cobra.Command{
+	Use:   "show",
+	Short: "Print the daily TTFF trend (or the raw samples) per stream",
+	Args:  cobra.NoArgs,
+	RunE:  runHistoryShow,
+}
+
+var historyCompareCmd = &cobra.Command{
+	Use:   "compare",
+	Short: "Compare the latest window of samples with the window before it",
+	Long: `compare splits stored samples into the latest --window (e.g., the last 24h)
+and the window of the same length before it, and runs the multi-sample
+comparison with significance tests over the two.`,
+	Args: cobra.NoArgs,
+	RunE: runHistoryCompare,
+}
+
+var historyPruneCmd = &cobra.Command{
+	Use:   "prune",
+	Short: "Downsample or delete old samples",
+	Args:  cobra.NoArgs,
+	RunE:  runHistoryPrune,
+}
+
+// init registers the history subcommands and their flags
+func init() {
+	historyCmd.PersistentFlags().StringVar(&historyStorePath, "history", defaultHistoryPath, "History store (file path, sqlite:PATH, or postgres:// URL)")
+
+	historyShowCmd.Flags().StringVar(&historyFilter, "filter", "", "Only include matching samples (e.g., url=https://cdn.example.com/*,label=region:eu)")
+	historyShowCmd.Flags().DurationVar(&historySince, "since", 7*24*time.Hour, "Only include samples from this far back (0 for all)")
+	historyShowCmd.Flags().BoolVar(&historyRaw, "raw", false, "List individual samples instead of daily summaries")
+	historyShowCmd.Flags().IntVar(&historyLimit, "limit", 50, "Most recent samples listed with --raw (0 for all)")
+
+	historyCompareCmd.Flags().StringVar(&historyFilter, "filter", "", "Only include matching samples (e.g., url=https://cdn.example.com/*,label=region:eu)")
+	historyCompareCmd.Flags().DurationVar(&historyWindow, "window", 24*time.Hour, "Length of each compared window")
+
+	historyPruneCmd.Flags().DurationVar(&retainRaw, "retain-raw", 0, "Downsample samples older than this into hourly aggregates (0 keeps every sample)")
+	historyPruneCmd.Flags().DurationVar(&retainAggregates, "retain-aggregates", 0, "Delete history older than this, aggregates included (0 keeps it forever)")
+
+	historyCmd.AddCommand(historyShowCmd, historyCompareCmd, historyPruneCmd)
+	rootCmd.AddCommand(historyCmd)
+}
+
+// openStoredHistory opens an existing store for reading; reading a report should never
+// create an empty store
+func openStoredHistory(location string) (history.Store, error) {
+	if path, ok := history.LocalPath(location); ok {
+		if _, err := os.Stat(path); err != nil {
+			return nil, fmt.Errorf("failed to open history file: %w", err)
+		}
+	}
+
+	return history.Open(location)
+}
+
+// parseHistoryFilter parses --filter; an empty filter matches every record
+func parseHistoryFilter() (history.Filter, error) {
+	if historyFilter == "" {
+		return history.Filter{}, nil
+	}
+
+	return history.ParseFilter(historyFilter)
+}
+
+// runHistoryShow prints per-day TTFF statistics for every stored stream
+func runHistoryShow(cmd *cobra.Command, args []string) error {
+	filter, err := parseHistoryFilter()
+	if err != nil {
+		return err
+	}
+
+	store, err := openStoredHistory(historyStorePath)
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	var from time.Time
+
+	if historySince > 0 {
+		from = time.Now().Add(-historySince)
+	}
+
+	records, err := store.Query(from, time.Now())
+	if err != nil {
+		return err
+	}
+
+	var matched []history.Record
+
+	for _, record := range records {
+		if filter.Match(record) {
+			matched = append(matched, record)
+		}
+	}
+
+	if len(matched) == 0 {
+		return fmt.Errorf("no samples match in %s", historyStorePath)
+	}
+
+	if historyRaw {
+		printHistoryRecords(matched)
+
+		return nil
+	}
+
+	printHistoryTrend(matched)
+
+	return nil
+}
+
+// printHistoryRecords lists the most recent samples, oldest first
+func printHistoryRecords(records []history.Record) {
+	if historyLimit > 0 && len(records) > historyLimit {
+		records = records[len(records)-historyLimit:]
+	}
+
+	fmt.Printf("vtrace history for: %s (%d samples)\n", historyStorePath, len(records))
+	fmt.Println("──────────────────────────────────────────────────────────────────────────────")
+
+	for _, record := range records {
+		result := formatDuration(time.Duration(record.Metrics["total_ttff"] * float64(time.Millisecond)))
+
+		switch {
+		case record.IsAggregate():
+			result = fmt.Sprintf("%s (mean of %d, %d failed)", result, record.Samples, record.Failures)
+		case record.Error != "":
+			result = "failed: " + record.Error
+		}
+
+		fmt.Printf("%s  %-10s %s  %s\n", record.Time.Local().Format("2006-01-02 15:04:05"), record.Protocol, record.URL, result)
+	}
+}
+
+// historyDay accumulates one stream's samples for one local calendar day
+type historyDay struct {
+	day      string
+	samples  int
+	failures int
+	ttff     []time.Duration
+}
+
+// printHistoryTrend prints one table per stream with a row per day
+func printHistoryTrend(records []history.Record) {
+	days := make(map[string]map[string]*historyDay)
+
+	var urls []string
+
+	for _, record := range records {
+		byDay, ok := days[record.URL]
+		if !ok {
+			byDay = make(map[string]*historyDay)
+			days[record.URL] = byDay
+			urls = append(urls, record.URL)
+		}
+
+		key := record.Time.Local().Format("2006-01-02")
+
+		day, ok := byDay[key]
+		if !ok {
+			day = &historyDay{day: key}
+			byDay[key] = day
+		}
+
+		// Hourly aggregates contribute their mean once but count all of their samples
+		if record.IsAggregate() {
+			day.samples += record.Samples
+			day.failures += record.Failures
+		} else {
+			day.samples++
+
+			if record.Error != "" {
+				day.failures++
+			}
+		}
+
+		if ttff, ok := record.Metrics["total_ttff"]; ok && record.Error == "" {
+			day.ttff = append(day.ttff, time.Duration(ttff*float64(time.Millisecond)))
+		}
+	}
+
+	sort.Strings(urls)
+
+	for i, streamURL := range urls {
+		if i > 0 {
+			fmt.Println()
+		}
+
+		rows := make([]*historyDay, 0, len(days[streamURL]))
+
+		for _, day := range days[streamURL] {
+			rows = append(rows, day)
+		}
+
+		sort.Slice(rows, func(i, j int) bool {
+			return rows[i].day < rows[j].day
+		})
+
+		fmt.Printf("vtrace TTFF trend for: %s\n", streamURL)
+		fmt.Println("──────────────────────────────────────────────────────────────────────────────")
+		fmt.Printf("%-10s %8s %8s %12s %12s %12s %12s\n", "Day", "Samples", "Failed", "Avg", "Median", "P95", "Max")
+		fmt.Println("──────────────────────────────────────────────────────────────────────────────")
+
+		for _, day := range rows {
+			if len(day.ttff) == 0 {
+				fmt.Printf("%-10s %8d %8d %12s %12s %12s %12s\n", day.day, day.samples, day.failures, "-", "-", "-", "-")
+
+				continue
+			}
+
+			s := stats.ComputeStats(day.ttff)
+
+			fmt.Printf("%-10s %8d %8d %12s %12s %12s %12s\n",
+				day.day,
+				day.samples,
+				day.failures,
+				formatDuration(s.Mean),
+				formatDuration(s.Median),
+				formatDuration(s.Percentile(95)),
+				formatDuration(s.Max),
+			)
+		}
+	}
+}
+
+// runHistoryCompare compares the latest window of stored samples with the one before it
+func runHistoryCompare(cmd *cobra.Command, args []string) error {
+	if historyWindow <= 0 {
+		return errors.New("--window must be positive")
+	}
+
+	filter, err := parseHistoryFilter()
+	if err != nil {
+		return err
+	}
+
+	store, err := openStoredHistory(historyStorePath)
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	now := time.Now()
+	split := now.Add(-historyWindow)
+	start := split.Add(-historyWindow)
+
+	records, err := store.Query(start, now)
+	if err != nil {
+		return err
+	}
+
+	window := formatWindow(historyWindow)
+
+	latest := selectCohort(records, fmt.Sprintf("last %s (since %s)", window, split.Format("2006-01-02 15:04")),
+		func(record history.Record) bool {
+			return filter.Match(record) && !record.Time.Before(split)
+		})
+
+	previous := selectCohort(records, fmt.Sprintf("previous %s (%s to %s)", window, start.Format("2006-01-02 15:04"), split.Format("2006-01-02 15:04")),
+		func(record history.Record) bool {
+			return filter.Match(record) && record.Time.Before(split)
+		})
+
+	for _, c := range []*cohort{latest, previous} {
+		if len(c.values["total_ttff"]) == 0 {
+			return fmt.Errorf("no successful samples in the %s window of %s", c.name, historyStorePath)
+		}
+	}
+
+	title := "vtrace history comparison for: " + historyStorePath
+
+	if historyFilter != "" {
+		title += " (" + historyFilter + ")"
+	}
+
+	printCohortTable(title, latest, previous)
+	printCohortComparison(latest, previous)
+
+	return nil
+}
+
+// formatWindow prints a window without trailing zero units (24h rather than 24h0m0s)
+func formatWindow(d time.Duration) string {
+	s := d.String()
+
+	if strings.HasSuffix(s, "m0s") {
+		s = strings.TrimSuffix(s, "0s")
+	}
+
+	if strings.HasSuffix(s, "h0m") {
+		s = strings.TrimSuffix(s, "0m")
+	}
+
+	return s
+}
+
+// runHistoryPrune applies a one-off retention pass to the store
+func runHistoryPrune(cmd *cobra.Command, args []string) error {
+	if !retentionEnabled() {
+		return errors.New("prune requires --retain-raw or --retain-aggregates")
+	}
+
+	if err := validateRetention(); err != nil {
+		return err
+	}
+
+	store, err := openStoredHistory(historyStorePath)
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	now := time.Now()
+
+	var rawBefore, aggregateBefore time.Time
+
+	if retainRaw > 0 {
+		rawBefore = now.Add(-retainRaw)
+	}
+
+	if retainAggregates > 0 {
+		aggregateBefore = now.Add(-retainAggregates)
+	}
+
+	result, err := store.Compact(rawBefore, aggregateBefore)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Pruned %s: %d raw samples downsampled into %d hourly aggregates, %d records expired\n",
+		historyStorePath, result.Downsampled, result.Aggregates, result.Expired)
+
+	return nil
+}
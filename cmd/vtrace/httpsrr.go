@@ -0,0 +1,148 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	neturl "net/url"
+	"strconv"
+	"strings"
+
+	"codeberg.org/pwnderpants/vtrace/internal/probe"
+)
+
+// lookupHTTPSRecords queries the HTTPS (type 65) records for the target host
+func lookupHTTPSRecords() ([]probe.HTTPSRecord, error) {
+	parsed, err := neturl.Parse(url)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse URL: %w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	records, err := probe.LookupHTTPS(ctx, parsed.Hostname(), probe.SystemNameserver())
+	if err != nil {
+		return nil, fmt.Errorf("HTTPS record lookup for %s failed: %w", parsed.Hostname(), err)
+	}
+
+	return records, nil
+}
+
+// printHTTPSRecords outputs the advertised service bindings
+func printHTTPSRecords(records []probe.HTTPSRecord) {
+	fmt.Println("HTTPS records")
+	fmt.Println("────────────────────────────────────────────────────")
+
+	if len(records) == 0 {
+		fmt.Println("None published; connecting through plain A/AAAA lookups")
+	}
+
+	for _, r := range records {
+		mode := "service"
+
+		if r.Priority == 0 {
+			mode = "alias"
+		}
+
+		fmt.Printf("Priority %d (%s) target %s\n", r.Priority, mode, r.Target)
+
+		if len(r.ALPN) > 0 {
+			fmt.Printf("  ALPN:       %s\n", strings.Join(r.ALPN, ", "))
+		}
+
+		if r.Port != 0 {
+			fmt.Printf("  Port:       %d\n", r.Port)
+		}
+
+		if len(r.IPv4Hints) > 0 {
+			fmt.Printf("  IPv4 hints: %s\n", joinIPs(r.IPv4Hints))
+		}
+
+		if len(r.IPv6Hints) > 0 {
+			fmt.Printf("  IPv6 hints: %s\n", joinIPs(r.IPv6Hints))
+		}
+
+		if len(r.ECHConfig) > 0 {
+			fmt.Printf("  ECH config: %d bytes\n", len(r.ECHConfig))
+		}
+	}
+
+	fmt.Println()
+}
+
+// joinIPs formats a list of addresses
+func joinIPs(ips []net.IP) string {
+	parts := make([]string, len(ips))
+
+	for i, ip := range ips {
+		parts[i] = ip.String()
+	}
+
+	return strings.Join(parts, ", ")
+}
+
+// httpsRecordResolve maps the target host to the address hinted by the best service record
+func httpsRecordResolve(records []probe.HTTPSRecord) (map[string]string, error) {
+	parsed, err := neturl.Parse(url)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse URL: %w", err)
+	}
+
+	port := parsed.Port()
+
+	if port == "" {
+		port = "443"
+
+		if parsed.Scheme == "http" {
+			port = "80"
+		}
+	}
+
+	// Service records with the lowest non-zero priority win
+	var best *probe.HTTPSRecord
+
+	for i := range records {
+		r := &records[i]
+
+		if r.Priority == 0 {
+			continue
+		}
+
+		if best == nil || r.Priority < best.Priority {
+			best = r
+		}
+	}
+
+	if best == nil {
+		return nil, nil
+	}
+
+	var hint net.IP
+
+	if len(best.IPv4Hints) > 0 {
+		hint = best.IPv4Hints[0]
+	} else if len(best.IPv6Hints) > 0 {
+		hint = best.IPv6Hints[0]
+	}
+
+	if hint == nil && best.Port == 0 {
+		return nil, nil
+	}
+
+	dialHost := parsed.Hostname()
+
+	if hint != nil {
+		dialHost = hint.String()
+	}
+
+	dialPort := port
+
+	if best.Port != 0 {
+		dialPort = strconv.Itoa(int(best.Port))
+	}
+
+	return map[string]string{
+		net.JoinHostPort(parsed.Hostname(), port): net.JoinHostPort(dialHost, dialPort),
+	}, nil
+}
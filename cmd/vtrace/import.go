@@ -0,0 +1,190 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"codeberg.org/pwnderpants/vtrace/internal/history"
+)
+
+var (
+	importHistoryPath string
+	importDryRun      bool
+	importSkipInvalid bool
+)
+
+var importCmd = &cobra.Command{
+	Use:   "import FILE...",
+	Short: "Import measurements from JSON lines files into the history store",
+	Long: `import ingests newline-delimited JSON produced elsewhere into the history store,
+so samples from other probes and older vtrace versions can be reported on together.
+Each line may be a stored history record (as written by --history or serve) or a
+beacon/Kafka message (--beacon-url, --kafka-brokers). Lines without a schema version
+are read as version 1, and records already in the store are skipped, so importing
+the same file twice is safe. Use "-" to read from stdin.`,
+	Args: cobra.MinimumNArgs(1),
+	RunE: runImport,
+}
+
+// init registers the import subcommand and its flags
+func init() {
+	importCmd.Flags().StringVar(&importHistoryPath, "history", defaultHistoryPath, "History store to import into (file path, sqlite:PATH, or postgres:// URL)")
+	importCmd.Flags().BoolVar(&importDryRun, "dry-run", false, "Validate the files and report what would be imported without writing")
+	importCmd.Flags().BoolVar(&importSkipInvalid, "skip-invalid", false, "Skip lines that fail to parse instead of aborting the import")
+
+	rootCmd.AddCommand(importCmd)
+}
+
+// runImport decodes every file, then appends the records the store does not have yet
+func runImport(cmd *cobra.Command, args []string) error {
+	var (
+		records []history.Record
+		invalid int
+	)
+
+	for _, path := range args {
+		decoded, skipped, err := readImportFile(path)
+		if err != nil {
+			return err
+		}
+
+		records = append(records, decoded...)
+		invalid += skipped
+	}
+
+	store, err := history.Open(importHistoryPath)
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	existing, err := existingRecordKeys(store, records)
+	if err != nil {
+		return err
+	}
+
+	imported, duplicates := 0, 0
+
+	for _, record := range records {
+		key := history.RecordKey(record)
+
+		if existing[key] {
+			duplicates++
+
+			continue
+		}
+
+		existing[key] = true
+
+		if !importDryRun {
+			if err := store.Append(record); err != nil {
+				return err
+			}
+		}
+
+		imported++
+	}
+
+	verb := "Imported"
+
+	if importDryRun {
+		verb = "Would import"
+	}
+
+	fmt.Printf("%s %d records into %s (%d duplicates skipped", verb, imported, importHistoryPath, duplicates)
+
+	if invalid > 0 {
+		fmt.Printf(", %d invalid lines skipped", invalid)
+	}
+
+	fmt.Println(")")
+
+	return nil
+}
+
+// readImportFile decodes one JSON lines file, or stdin for "-"
+func readImportFile(path string) ([]history.Record, int, error) {
+	var r io.Reader = os.Stdin
+
+	if path != "-" {
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, 0, fmt.Errorf("failed to open import file: %w", err)
+		}
+		defer f.Close()
+
+		r = f
+	}
+
+	var (
+		records []history.Record
+		invalid int
+	)
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+
+	for line := 1; scanner.Scan(); line++ {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+
+		record, err := history.DecodeRecord(scanner.Bytes())
+		if err != nil {
+			if !importSkipInvalid {
+				return nil, 0, fmt.Errorf("%s:%d: %w", path, line, err)
+			}
+
+			fmt.Fprintf(os.Stderr, "warning: %s:%d: %v\n", path, line, err)
+
+			invalid++
+
+			continue
+		}
+
+		records = append(records, record)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, 0, fmt.Errorf("failed to read import file: %w", err)
+	}
+
+	return records, invalid, nil
+}
+
+// existingRecordKeys returns the keys of stored records within the time span being imported
+func existingRecordKeys(store history.Store, records []history.Record) (map[string]bool, error) {
+	keys := make(map[string]bool)
+
+	if len(records) == 0 {
+		return keys, nil
+	}
+
+	from, to := records[0].Time, records[0].Time
+
+	for _, record := range records {
+		if record.Time.Before(from) {
+			from = record.Time
+		}
+
+		if record.Time.After(to) {
+			to = record.Time
+		}
+	}
+
+	stored, err := store.Query(from, to.Add(time.Nanosecond))
+	if err != nil {
+		return nil, err
+	}
+
+	for _, record := range stored {
+		keys[history.RecordKey(record)] = true
+	}
+
+	return keys, nil
+}
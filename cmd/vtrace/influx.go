@@ -0,0 +1,102 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"text/template"
+	"time"
+
+	"codeberg.org/pwnderpants/vtrace/internal/probe"
+	"codeberg.org/pwnderpants/vtrace/internal/sink"
+	"codeberg.org/pwnderpants/vtrace/internal/ttff"
+)
+
+// influxTokenEnv names the environment variable holding the InfluxDB API token
+const influxTokenEnv = "VTRACE_INFLUX_TOKEN"
+
+// Result formats selected with --output
+const (
+	outputTable  = "table"
+	outputInflux = "influx"
+)
+
+// influxOutputTemplate prints one line of line protocol per sample in place of the tables
+const influxOutputTemplate = "{{range .Samples}}{{influx .}}\n{{end}}"
+
+var (
+	outputFormat      string
+	influxURL         string
+	influxBucket      string
+	influxOrg         string
+	influxMeasurement string
+)
+
+// setupOutput checks the --output and --influx-* flags and swaps the tables for line
+// protocol with --output influx
+func setupOutput() error {
+	if influxURL != "" && influxBucket == "" {
+		return errors.New("--influx-bucket is required with --influx-url")
+	}
+
+	if influxMeasurement == "" {
+		return errors.New("--influx-measurement must not be empty")
+	}
+
+	switch outputFormat {
+	case outputTable:
+		return nil
+	case outputInflux:
+	default:
+		return fmt.Errorf("unknown output format %q (must be %s or %s)", outputFormat, outputTable, outputInflux)
+	}
+
+	if templatePath != "" {
+		return errors.New("--output influx cannot be combined with --template")
+	}
+
+	if allVariants || checkMode {
+		return errors.New("--output influx cannot be combined with --all-variants or --check")
+	}
+
+	outputTemplate = template.Must(template.New(outputInflux).Funcs(templateFuncs).Parse(influxOutputTemplate))
+
+	return nil
+}
+
+// influxLine formats a sample as line protocol tagged with its URL (as exported), protocol,
+// variant, and --label values; fields are the phase durations in milliseconds
+func influxLine(streamURL, protocol string, sample ttff.Sample, at time.Time) string {
+	tags := make(map[string]string, len(recordLabels)+3)
+
+	for name, value := range recordLabels {
+		tags[name] = value
+	}
+
+	tags["url"] = streamURL
+	tags["protocol"] = protocol
+	tags["variant"] = sample.Variant
+
+	return sink.InfluxLine(influxMeasurement, tags, sampleMetrics(sample), at)
+}
+
+// emitInflux writes the sample to the configured InfluxDB bucket
+func emitInflux(target, protocol string, sample ttff.Sample) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	config := sink.InfluxConfig{
+		URL:    influxURL,
+		Org:    influxOrg,
+		Bucket: influxBucket,
+		Token:  os.Getenv(influxTokenEnv),
+	}
+
+	line := influxLine(exportURL(target), protocol, sample, time.Now())
+
+	// InfluxDB delivery is best effort and never fails the run
+	if err := sink.WriteInflux(ctx, config, []string{line}, probe.NewHTTPClient(timeout)); err != nil {
+		fmt.Fprintf(os.Stderr, "warning: %v\n", err)
+	}
+}
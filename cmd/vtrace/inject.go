@@ -0,0 +1,116 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"codeberg.org/pwnderpants/vtrace/internal/origin"
+)
+
+var (
+	syntheticMode         bool
+	injectDropSpec        string
+	injectCorruptPlaylist bool
+	injectKeyDelay        time.Duration
+
+	// syntheticOrigin serves the stream measured by --synthetic; nil otherwise
+	syntheticOrigin *origin.Origin
+)
+
+// setupSynthetic starts the synthetic origin for --synthetic with the requested faults
+// and points the run at it
+func setupSynthetic() error {
+	faults, err := parseFaults()
+	if err != nil {
+		return err
+	}
+
+	if !syntheticMode {
+		if faults != (origin.Faults{}) {
+			return errors.New("--inject-drop-after, --inject-corrupt-playlist, and --inject-key-delay require --synthetic")
+		}
+
+		return nil
+	}
+
+	if streamProtocol != streamHLS {
+		return errors.New("--synthetic requires --protocol hls")
+	}
+
+	o, err := origin.StartWithFaults(faults)
+	if err != nil {
+		return fmt.Errorf("failed to start synthetic origin: %w", err)
+	}
+
+	syntheticOrigin = o
+	url = o.URL
+
+	if verbose {
+		fmt.Printf("Synthetic origin: %s (%s)\n", o.URL, describeFaults(faults))
+	}
+
+	return nil
+}
+
+// parseFaults reads the --inject-* flags
+func parseFaults() (origin.Faults, error) {
+	faults := origin.Faults{
+		CorruptPlaylist: injectCorruptPlaylist,
+		KeyDelay:        injectKeyDelay,
+	}
+
+	if injectKeyDelay < 0 {
+		return faults, errors.New("--inject-key-delay must not be negative")
+	}
+
+	if injectDropSpec != "" {
+		size, err := parseByteSize(injectDropSpec)
+		if err != nil {
+			return faults, fmt.Errorf("invalid --inject-drop-after: %w", err)
+		}
+
+		faults.DropAfter = int64(size)
+	}
+
+	return faults, nil
+}
+
+// describeFaults lists the injected faults, or says there are none
+func describeFaults(faults origin.Faults) string {
+	var parts []string
+
+	if faults.DropAfter > 0 {
+		parts = append(parts, "segments dropped after "+formatBytes(int(faults.DropAfter)))
+	}
+
+	if faults.CorruptPlaylist {
+		parts = append(parts, "corrupt media playlist")
+	}
+
+	if faults.KeyDelay > 0 {
+		parts = append(parts, "key delayed "+faults.KeyDelay.String())
+	}
+
+	if len(parts) == 0 {
+		return "no faults injected"
+	}
+
+	return strings.Join(parts, ", ")
+}
+
+// trustSyntheticOrigin adds the synthetic origin's certificate unless --cacert or
+// --insecure already decide verification
+func trustSyntheticOrigin() {
+	if syntheticOrigin != nil && tlsSettings.RootCAs == nil {
+		tlsSettings.RootCAs = syntheticOrigin.RootCAs
+	}
+}
+
+// closeSynthetic stops the synthetic origin, if one was started
+func closeSynthetic() {
+	if syntheticOrigin != nil {
+		syntheticOrigin.Close()
+	}
+}
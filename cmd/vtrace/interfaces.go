@@ -0,0 +1,192 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"codeberg.org/pwnderpants/vtrace/internal/probe"
+	"codeberg.org/pwnderpants/vtrace/internal/stats"
+	"codeberg.org/pwnderpants/vtrace/internal/ttff"
+)
+
+var interfaceNames []string
+
+// bindInterfaceName sends measurement traffic through one interface during a comparison
+var bindInterfaceName string
+
+// interfaceArm collects the samples measured through one local interface
+type interfaceArm struct {
+	Name     string
+	Addr     net.IP
+	Samples  []ttff.Sample
+	Failures int
+}
+
+// validateInterfaces rejects flags that conflict with --interfaces and checks every interface is usable
+func validateInterfaces() error {
+	if len(interfaceNames) == 0 {
+		return nil
+	}
+
+	switch {
+	case len(interfaceNames) < 2:
+		return errors.New("--interfaces needs at least two interfaces to compare")
+	case compare:
+		return errors.New("--interfaces cannot be combined with --compare")
+	case allVariants:
+		return errors.New("--interfaces cannot be combined with --all-variants")
+	case checkMode:
+		return errors.New("--interfaces cannot be combined with --check")
+	case len(resolverSpecs) > 0:
+		return errors.New("--interfaces cannot be combined with --resolvers")
+	case templatePath != "" || outputFormat == outputInflux:
+		return errors.New("--interfaces cannot be combined with --template or --output influx")
+	}
+
+	_, err := parseInterfaces(interfaceNames)
+
+	return err
+}
+
+// parseInterfaces looks up the source address of every named interface
+func parseInterfaces(names []string) ([]*interfaceArm, error) {
+	var arms []*interfaceArm
+
+	for _, name := range names {
+		name = strings.TrimSpace(name)
+
+		if name == "" {
+			continue
+		}
+
+		addr, err := probe.InterfaceAddr(name)
+		if err != nil {
+			return nil, fmt.Errorf("interface %q: %w", name, err)
+		}
+
+		arms = append(arms, &interfaceArm{Name: name, Addr: addr})
+	}
+
+	return arms, nil
+}
+
+// label names an arm by its interface and source address
+func (a *interfaceArm) label() string {
+	return fmt.Sprintf("%s (%s)", a.Name, exportAddr(a.Addr.String()))
+}
+
+// runInterfaceComparison measures through every local interface and compares their TTFF
+func runInterfaceComparison(minDelay, maxDelay time.Duration) error {
+	arms, err := parseInterfaces(interfaceNames)
+	if err != nil {
+		return err
+	}
+
+	// Interfaces take turns within each round so network drift affects them equally
+	for i := 0; i < samples; i++ {
+		for _, arm := range arms {
+			bindInterfaceName = arm.Name
+
+			if verbose {
+				fmt.Printf("\n── Sample %d/%d via %s ──\n", i+1, samples, arm.label())
+			}
+
+			sample, _, _, err := measureSample(context.Background(), url, i, protocolHTTP12)
+			if err != nil {
+				arm.Failures++
+
+				if verbose {
+					fmt.Printf("  Failed: %v\n", err)
+				}
+
+				continue
+			}
+
+			arm.Samples = append(arm.Samples, sample)
+
+			if verbose {
+				fmt.Printf("  TTFF: %s\n", formatDuration(sample.TotalTTFF))
+			}
+		}
+
+		// Apply delay between rounds (skip after last round)
+		if i < samples-1 {
+			sleepDuration := getDelay(minDelay, maxDelay)
+
+			if verbose {
+				fmt.Printf("  Waiting %s before next round...\n", sleepDuration)
+			}
+
+			time.Sleep(sleepDuration)
+		}
+	}
+
+	bindInterfaceName = ""
+
+	printInterfaceResults(exportURL(url), arms)
+	printShaping()
+	printConfiguration()
+
+	for _, arm := range arms {
+		if len(arm.Samples) > 0 {
+			return nil
+		}
+	}
+
+	return errors.New("every interface failed")
+}
+
+// printInterfaceResults outputs the per-interface TTFF table
+func printInterfaceResults(url string, arms []*interfaceArm) {
+	summaries := make([]stats.PhaseSummary, len(arms))
+
+	for i, arm := range arms {
+		summaries[i] = stats.SummarizePhases(ttff.Timings(arm.Samples))
+	}
+
+	fastest, slowest := stats.FastestSlowest(summaries)
+
+	fmt.Printf("\nvtrace interface comparison for: %s (%d samples each)\n", url, samples)
+	fmt.Println("──────────────────────────────────────────────────────────────────────────────────────────────────────────────")
+	fmt.Printf("%-28s %12s %12s %12s %12s %12s %12s %6s\n", "Interface", "TCP Connect", "TLS", "Manifest", "Segment", "Total TTFF", "StdDev", "Failed")
+	fmt.Println("──────────────────────────────────────────────────────────────────────────────────────────────────────────────")
+
+	for i, arm := range arms {
+		s := summaries[i]
+
+		if s.Count == 0 {
+			fmt.Printf("%-28s %12s %12s %12s %12s %12s %12s %6d\n", arm.label(), "-", "-", "-", "-", "-", "-", arm.Failures)
+
+			continue
+		}
+
+		marker := ""
+
+		switch i {
+		case fastest:
+			marker = "  fastest"
+		case slowest:
+			marker = "  slowest"
+		}
+
+		fmt.Printf("%-28s %12s %12s %12s %12s %12s %12s %6d%s\n",
+			arm.label(),
+			formatDuration(stats.ComputeStats(stats.ExtractTCPConnect(ttff.Timings(arm.Samples))).Mean),
+			formatDuration(stats.ComputeStats(stats.ExtractTLSHandshake(ttff.Timings(arm.Samples))).Mean),
+			formatDuration(s.ManifestTotal.Mean),
+			formatDuration(s.SegmentTotal.Mean),
+			formatDuration(s.TotalTTFF.Mean),
+			formatDuration(s.TotalTTFF.StdDev),
+			arm.Failures,
+			marker,
+		)
+	}
+
+	fmt.Println("──────────────────────────────────────────────────────────────────────────────────────────────────────────────")
+	fmt.Println("TCP Connect, TLS, Manifest, Segment, and Total TTFF are averages.")
+	fmt.Println("DNS queries follow the system resolver configuration, not the interface under test.")
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"codeberg.org/pwnderpants/vtrace/internal/sink"
+	"codeberg.org/pwnderpants/vtrace/internal/ttff"
+)
+
+// kafkaPasswordEnv names the environment variable holding the SASL password
+const kafkaPasswordEnv = "VTRACE_KAFKA_PASSWORD"
+
+var (
+	kafkaBrokers  []string
+	kafkaTopic    string
+	kafkaTLS      bool
+	kafkaSASL     string
+	kafkaUsername string
+)
+
+// kafkaProducer publishes one message per sample when --kafka-brokers is set
+var kafkaProducer *sink.KafkaProducer
+
+// openKafkaProducer configures the Kafka sink from flags and the environment
+func openKafkaProducer() (*sink.KafkaProducer, error) {
+	producer, err := sink.NewKafkaProducer(sink.KafkaConfig{
+		Brokers:       kafkaBrokers,
+		Topic:         kafkaTopic,
+		TLS:           kafkaTLS,
+		SASLMechanism: kafkaSASL,
+		Username:      kafkaUsername,
+		Password:      os.Getenv(kafkaPasswordEnv),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to configure Kafka sink: %w", err)
+	}
+
+	return producer, nil
+}
+
+// emitKafka publishes the sample summary keyed by stream URL
+func emitKafka(target string, index int, protocol string, sample ttff.Sample) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	message := sink.Beacon{
+		RunID:     runID,
+		URL:       exportURL(target),
+		Sample:    index + 1,
+		Protocol:  protocol,
+		Timestamp: time.Now().UTC(),
+		Metrics:   sampleMetrics(sample),
+		Decoder:   sample.FrameDecoder,
+
+		Negotiated: sampleNegotiated(sample),
+	}
+
+	// Kafka delivery is best effort and never fails the run
+	if err := kafkaProducer.Send(ctx, exportURL(target), message); err != nil {
+		fmt.Fprintf(os.Stderr, "warning: %v\n", err)
+	}
+}
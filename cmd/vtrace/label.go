@@ -0,0 +1,34 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// labelSpecs are the raw --label values
+var labelSpecs []string
+
+// recordLabels tag every stored sample (e.g., region=eu) for compare-stored filters
+var recordLabels map[string]string
+
+// parseLabels validates the --label flags as name=value pairs
+func parseLabels() error {
+	recordLabels = nil
+
+	for _, spec := range labelSpecs {
+		name, value, ok := strings.Cut(spec, "=")
+		name = strings.TrimSpace(name)
+
+		if !ok || name == "" || strings.ContainsAny(name, ",:") {
+			return fmt.Errorf("invalid label %q (want name=value; the name cannot contain , or :)", spec)
+		}
+
+		if recordLabels == nil {
+			recordLabels = make(map[string]string)
+		}
+
+		recordLabels[name] = strings.TrimSpace(value)
+	}
+
+	return nil
+}
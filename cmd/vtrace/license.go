@@ -0,0 +1,188 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"codeberg.org/pwnderpants/vtrace/internal/probe"
+	"codeberg.org/pwnderpants/vtrace/internal/stats"
+)
+
+var (
+	challengeFile      string
+	licenseContentType string
+)
+
+var licenseCmd = &cobra.Command{
+	Use:   "license",
+	Short: "Measure DRM license server latency",
+	Long: `license POSTs a DRM license challenge read from a file to a license
+endpoint and measures DNS lookup, TCP connect, TLS handshake, time to first
+byte, and total license response time.`,
+	RunE: runLicense,
+}
+
+// init registers the license subcommand and its flags
+func init() {
+	licenseCmd.Flags().StringVarP(&url, "url", "u", "", "License server URL (required)")
+	licenseCmd.Flags().StringVar(&challengeFile, "challenge", "", "File containing the license challenge body (required)")
+	licenseCmd.Flags().StringVar(&licenseContentType, "content-type", "application/octet-stream", "Content-Type of the challenge")
+	licenseCmd.Flags().DurationVarP(&timeout, "timeout", "t", 30*time.Second, "Request timeout")
+	licenseCmd.Flags().BoolVarP(&verbose, "verbose", "v", false, "Enable verbose output")
+	licenseCmd.Flags().StringArrayVarP(&headerSpecs, "header", "H", nil, "Add a request header to every request (\"Name: value\", repeatable)")
+	licenseCmd.Flags().StringVar(&userAgent, "user-agent", "", "User-Agent sent with every request")
+	licenseCmd.Flags().StringVar(&proxySpec, "proxy", "", "Send requests through an HTTP or SOCKS5 proxy (e.g., http://host:3128, socks5://host:1080)")
+	licenseCmd.Flags().StringVar(&tlsMinSpec, "tls-min", "", "Lowest TLS version to offer: 1.0, 1.1, 1.2, or 1.3 (default Go's minimum, 1.2)")
+	licenseCmd.Flags().BoolVar(&insecureTLS, "insecure", false, "Skip TLS certificate verification")
+	licenseCmd.Flags().StringVar(&caCertPath, "cacert", "", "Verify servers against the CA certificates in this PEM file instead of the system roots")
+	licenseCmd.Flags().StringVar(&clientCertPath, "cert", "", "Client certificate (PEM) presented to servers that request one")
+	licenseCmd.Flags().StringVar(&clientKeyPath, "key", "", "Private key (PEM) for --cert (default: read from the --cert file)")
+	licenseCmd.Flags().StringArrayVar(&resolveSpecs, "resolve", nil, "Pin a host and port to an address, like curl (host:port:address, repeatable)")
+	licenseCmd.Flags().IntVarP(&samples, "samples", "n", 1, "Number of measurement iterations")
+	licenseCmd.Flags().DurationVarP(&delay, "delay", "d", 5*time.Second, "Fixed delay between samples")
+	licenseCmd.Flags().Float64SliceVar(&percentileRanks, "percentiles", slices.Clone(stats.DefaultPercentiles), "Percentile columns in multi-sample results (e.g., 50,90,99.9)")
+
+	licenseCmd.MarkFlagRequired("url")
+	licenseCmd.MarkFlagRequired("challenge")
+
+	rootCmd.AddCommand(licenseCmd)
+}
+
+// runLicense executes the license endpoint measurement
+func runLicense(cmd *cobra.Command, args []string) error {
+	// Normalize the target URL (punycode hosts, IPv6 literals, userinfo)
+	normalized, err := probe.NormalizeURL(url)
+	if err != nil {
+		return fmt.Errorf("invalid URL: %w", err)
+	}
+
+	url = normalized
+
+	if err := setupRequestHeaders(); err != nil {
+		return err
+	}
+
+	if err := setupProxy(); err != nil {
+		return err
+	}
+
+	if err := setupTLS(); err != nil {
+		return err
+	}
+
+	if err := setupResolve(); err != nil {
+		return err
+	}
+
+	// Validate samples flag
+	if samples < 1 {
+		return errors.New("samples must be at least 1")
+	}
+
+	if err := validatePercentiles(); err != nil {
+		return err
+	}
+
+	challenge, err := os.ReadFile(challengeFile)
+	if err != nil {
+		return fmt.Errorf("failed to read challenge: %w", err)
+	}
+
+	var allSamples []stats.AssetSample
+
+	for i := 0; i < samples; i++ {
+		if verbose && samples > 1 {
+			fmt.Printf("\n── Sample %d/%d ──\n", i+1, samples)
+		}
+
+		sample, err := measureLicense(challenge)
+		if err != nil {
+			return fmt.Errorf("sample %d failed: %w", i+1, err)
+		}
+
+		allSamples = append(allSamples, sample)
+
+		if verbose {
+			fmt.Printf("  License: %s\n", formatDuration(sample.TotalTime))
+		}
+
+		// Apply delay between samples (skip after last sample)
+		if i < samples-1 {
+			time.Sleep(delay)
+		}
+	}
+
+	if samples == 1 {
+		printLicenseResults(url, allSamples[0])
+
+		return nil
+	}
+
+	printMultiSampleLicenseResults(url, allSamples)
+
+	return nil
+}
+
+// measureLicense performs a single license request measurement
+func measureLicense(challenge []byte) (stats.AssetSample, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	client := newHTTPClient()
+
+	if verbose {
+		fmt.Printf("Requesting license: %s (%d byte challenge)\n", url, len(challenge))
+	}
+
+	result, err := probe.RequestLicense(ctx, url, licenseContentType, challenge, client)
+	if err != nil {
+		return stats.AssetSample{}, err
+	}
+
+	if verbose {
+		fmt.Printf("License response: %d bytes\n", result.ResponseSize)
+	}
+
+	return stats.AssetSample{
+		DNSLookup:    result.Trace.DNSLookup,
+		TCPConnect:   result.Trace.TCPConnect,
+		TLSHandshake: result.Trace.TLSHandshake,
+		TTFB:         result.Trace.TTFB,
+		TotalTime:    result.Trace.Total,
+	}, nil
+}
+
+// printLicenseResults outputs the timing breakdown for a single license request
+func printLicenseResults(url string, sample stats.AssetSample) {
+	fmt.Printf("vtrace license results for: %s\n", url)
+	fmt.Println("────────────────────────────────────────────────────")
+	fmt.Printf("DNS Lookup:                  %12s\n", formatDuration(sample.DNSLookup))
+	fmt.Printf("TCP Connect:                 %12s\n", formatDuration(sample.TCPConnect))
+	fmt.Printf("TLS Handshake:               %12s\n", formatDuration(sample.TLSHandshake))
+	fmt.Printf("License TTFB:                %12s\n", formatDuration(sample.TTFB))
+	fmt.Println("────────────────────────────────────────────────────")
+	fmt.Printf("Total License:               %12s\n", formatDuration(sample.TotalTime))
+}
+
+// printMultiSampleLicenseResults outputs aggregate statistics for multiple license requests
+func printMultiSampleLicenseResults(url string, allSamples []stats.AssetSample) {
+	fmt.Printf("\nvtrace license results for: %s (%d samples)\n", url, len(allSamples))
+	fmt.Println(multiSampleRule())
+	fmt.Printf("%-20s %12s %12s %12s %12s %12s%s\n", "", "Avg", "Min", "Max", "Median", "StdDev", percentileHeader())
+	fmt.Println(multiSampleRule())
+
+	printStatRow("DNS Lookup:", stats.ExtractAssetDNSLookup(allSamples), nil)
+	printStatRow("TCP Connect:", stats.ExtractAssetTCPConnect(allSamples), nil)
+	printStatRow("TLS Handshake:", stats.ExtractAssetTLSHandshake(allSamples), nil)
+	printStatRow("License TTFB:", stats.ExtractAssetTTFB(allSamples), nil)
+
+	fmt.Println(multiSampleRule())
+
+	printStatRow("Total License:", stats.ExtractAssetTotalTime(allSamples), nil)
+}
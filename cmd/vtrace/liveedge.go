@@ -0,0 +1,49 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+
+	"codeberg.org/pwnderpants/vtrace/internal/ttff"
+)
+
+// liveEdge starts live playlists at the segment a joining player would pick instead of the
+// oldest one
+var liveEdge bool
+
+// validateLiveEdge checks that --live-edge applies to a full-segment HLS measurement
+func validateLiveEdge() error {
+	if !liveEdge {
+		return nil
+	}
+
+	switch {
+	case streamProtocol != streamHLS:
+		return errors.New("--live-edge requires --protocol hls")
+	case lowLatency:
+		return errors.New("--live-edge cannot be combined with --ll-hls, which already starts at the live edge")
+	case segmentIndex != 0:
+		return errors.New("--live-edge cannot be combined with --segment-index")
+	}
+
+	return nil
+}
+
+// segmentPosition labels the i-th segment measured after the start segment; with --live-edge
+// the start differs between samples, so positions count from it
+func segmentPosition(i int) string {
+	if liveEdge {
+		return fmt.Sprintf("edge+%d", i)
+	}
+
+	return fmt.Sprintf("#%d", segmentIndex+i)
+}
+
+// printLiveEdge reports how far behind the live edge the measured segment started
+func printLiveEdge(sample ttff.Sample) {
+	if sample.LiveEdgeSegments == 0 {
+		return
+	}
+
+	fmt.Printf("Live Edge Distance:          %12s (%d %s)\n", formatDuration(sample.LiveEdgeDistance), sample.LiveEdgeSegments, plural(sample.LiveEdgeSegments, "segment"))
+}
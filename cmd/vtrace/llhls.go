@@ -0,0 +1,16 @@
+package main
+
+var lowLatency bool
+
+// segmentPhaseLabel names the media download phase in result tables
+func segmentPhaseLabel() string {
+	if lowLatency {
+		return "Part Download:"
+	}
+
+	if lowLatencyDASH {
+		return "First Chunk:"
+	}
+
+	return "Segment Download:"
+}
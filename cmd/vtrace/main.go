@@ -1,11 +1,39 @@
 package main
 
 import (
+	"errors"
 	"os"
+
+	"codeberg.org/pwnderpants/vtrace/internal/decoder"
 )
 
+// exitError carries a specific process exit code out of a command
+type exitError struct {
+	code int
+	err  error
+}
+
+// Error returns the underlying error message
+func (e *exitError) Error() string {
+	return e.err.Error()
+}
+
+// Unwrap exposes the underlying error
+func (e *exitError) Unwrap() error {
+	return e.err
+}
+
 func main() {
+	// A sandboxed ffprobe starts as this binary, which confines itself and execs ffprobe
+	decoder.RunSandboxHelper()
+
 	if err := rootCmd.Execute(); err != nil {
+		var exitErr *exitError
+
+		if errors.As(err, &exitErr) {
+			os.Exit(exitErr.code)
+		}
+
 		os.Exit(1)
 	}
 }
@@ -0,0 +1,366 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"sort"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"codeberg.org/pwnderpants/vtrace/internal/monitor"
+	"codeberg.org/pwnderpants/vtrace/internal/probe"
+	"codeberg.org/pwnderpants/vtrace/internal/stats"
+)
+
+var (
+	monitorDuration time.Duration
+	monitorInterval time.Duration
+	refreshCadence  bool
+)
+
+var monitorCmd = &cobra.Command{
+	Use:   "monitor",
+	Short: "Monitor a live HLS playlist for reload anomalies",
+	Long: `monitor reloads a live media playlist for a fixed window and diffs each
+reload against the previous one, reporting segment duration jumps, missing
+sequence numbers, target duration changes, and discontinuity insertions.
+
+It also validates EXT-X-MEDIA-SEQUENCE progression, the DVR window length,
+and EVENT/VOD/live playlist type consistency across the session. For
+encrypted streams every EXT-X-KEY rotation triggers a timed key fetch.
+
+With --refresh-cadence it also reports whether new segments appear on
+schedule, how often reloads find the playlist stale, and the jitter of
+its updates.`,
+	RunE: runMonitor,
+}
+
+// init registers the monitor subcommand and its flags
+func init() {
+	monitorCmd.Flags().StringVarP(&url, "url", "u", "", "HLS stream URL (required)")
+	monitorCmd.Flags().DurationVarP(&timeout, "timeout", "t", 30*time.Second, "Request timeout")
+	monitorCmd.Flags().BoolVarP(&verbose, "verbose", "v", false, "Enable verbose output")
+	monitorCmd.Flags().StringArrayVarP(&headerSpecs, "header", "H", nil, "Add a request header to every request (\"Name: value\", repeatable)")
+	monitorCmd.Flags().StringVar(&userAgent, "user-agent", "", "User-Agent sent with every request")
+	monitorCmd.Flags().StringVar(&proxySpec, "proxy", "", "Send requests through an HTTP or SOCKS5 proxy (e.g., http://host:3128, socks5://host:1080)")
+	monitorCmd.Flags().StringVar(&tlsMinSpec, "tls-min", "", "Lowest TLS version to offer: 1.0, 1.1, 1.2, or 1.3 (default Go's minimum, 1.2)")
+	monitorCmd.Flags().BoolVar(&insecureTLS, "insecure", false, "Skip TLS certificate verification")
+	monitorCmd.Flags().StringVar(&caCertPath, "cacert", "", "Verify servers against the CA certificates in this PEM file instead of the system roots")
+	monitorCmd.Flags().StringVar(&clientCertPath, "cert", "", "Client certificate (PEM) presented to servers that request one")
+	monitorCmd.Flags().StringVar(&clientKeyPath, "key", "", "Private key (PEM) for --cert (default: read from the --cert file)")
+	monitorCmd.Flags().StringArrayVar(&resolveSpecs, "resolve", nil, "Pin a host and port to an address, like curl (host:port:address, repeatable)")
+	monitorCmd.Flags().DurationVar(&dnsCacheTTL, "dns-cache", 0, "Resolve hosts through vtrace's own cache, keeping answers this long, and report cache hits and query latency")
+	monitorCmd.Flags().BoolVar(&freshDNS, "fresh-dns", false, "Resolve the host again and open new connections for every sample instead of reusing them")
+	monitorCmd.Flags().DurationVar(&monitorDuration, "duration", 5*time.Minute, "How long to monitor the playlist")
+	monitorCmd.Flags().DurationVar(&monitorInterval, "interval", 0, "Reload interval (defaults to the target duration)")
+	monitorCmd.Flags().BoolVar(&refreshCadence, "refresh-cadence", false, "Check that new segments appear on schedule and report stale reloads and update jitter")
+
+	monitorCmd.MarkFlagRequired("url")
+
+	rootCmd.AddCommand(monitorCmd)
+}
+
+// runMonitor reloads the media playlist until the window closes or the user interrupts
+func runMonitor(cmd *cobra.Command, args []string) error {
+	// Normalize the target URL (punycode hosts, IPv6 literals, userinfo)
+	normalized, err := probe.NormalizeURL(url)
+	if err != nil {
+		return fmt.Errorf("invalid URL: %w", err)
+	}
+
+	url = normalized
+
+	if err := setupRequestHeaders(); err != nil {
+		return err
+	}
+
+	if err := setupProxy(); err != nil {
+		return err
+	}
+
+	if err := setupTLS(); err != nil {
+		return err
+	}
+
+	if err := setupResolve(); err != nil {
+		return err
+	}
+
+	if err := validateFreshDNS(); err != nil {
+		return err
+	}
+
+	if err := setupDNSCache(); err != nil {
+		return err
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	client := newHTTPClient()
+
+	mediaURL, err := resolveMediaPlaylistURL(ctx, client)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("vtrace monitor for: %s\n", mediaURL)
+	fmt.Println("────────────────────────────────────────────────────")
+
+	session := monitor.NewSession()
+
+	if refreshCadence {
+		session.Cadence = monitor.NewCadence()
+	}
+	deadline := time.Now().Add(monitorDuration)
+
+	for time.Now().Before(deadline) {
+		fetchCtx, cancel := context.WithTimeout(ctx, timeout)
+		result, err := probe.FetchPlaylist(fetchCtx, mediaURL, client)
+		cancel()
+
+		// Stop promptly when interrupted mid-reload
+		if ctx.Err() != nil {
+			break
+		}
+
+		now := time.Now()
+		wait := monitorInterval
+
+		if err != nil {
+			fmt.Printf("%s  reload failed: %v\n", now.Format(time.RFC3339), err)
+		} else if result.Media == nil {
+			return errors.New("monitor requires a media playlist")
+		} else {
+			for _, a := range session.Observe(result.Media, now) {
+				fmt.Printf("%s  %-24s %s\n", a.Time.Format(time.RFC3339), a.Kind, a.Detail)
+			}
+
+			measureKeyRotations(ctx, session, mediaURL, client)
+
+			if verbose {
+				fmt.Printf("%s  reload %d: %d segments, media sequence %d\n",
+					now.Format(time.RFC3339), session.Reloads, len(monitor.Segments(result.Media)), result.Media.SeqNo)
+			}
+
+			if wait == 0 {
+				wait = time.Duration(result.Media.TargetDuration * float64(time.Second))
+			}
+		}
+
+		// Fall back to a sane interval when the playlist gives no hint
+		if wait <= 0 {
+			wait = 2 * time.Second
+		}
+
+		select {
+		case <-ctx.Done():
+		case <-time.After(wait):
+		}
+
+		if ctx.Err() != nil {
+			break
+		}
+	}
+
+	printMonitorReport(session)
+
+	return nil
+}
+
+// measureKeyRotations times the key endpoint for every newly observed EXT-X-KEY
+func measureKeyRotations(ctx context.Context, session *monitor.Session, mediaURL string, client *http.Client) {
+	baseURL, err := probe.GetBaseURL(mediaURL)
+	if err != nil {
+		return
+	}
+
+	for _, rotation := range session.PendingRotations() {
+		keyURL, err := probe.ResolveURL(baseURL, rotation.URI)
+		if err != nil {
+			rotation.RecordLatency(0, 0, err)
+
+			continue
+		}
+
+		fetchCtx, cancel := context.WithTimeout(ctx, timeout)
+		_, trace, err := probe.FetchKey(fetchCtx, keyURL, client)
+		cancel()
+
+		var latency, ttfb time.Duration
+
+		if trace != nil {
+			latency = trace.Total
+			ttfb = trace.TTFB
+		}
+
+		rotation.RecordLatency(latency, ttfb, err)
+
+		label := "key-rotation"
+
+		if rotation.Initial {
+			label = "key-initial"
+		}
+
+		if err != nil {
+			fmt.Printf("%s  %-24s segment %d %s fetch failed: %v\n",
+				rotation.Time.Format(time.RFC3339), label, rotation.Sequence, keyURL, err)
+
+			continue
+		}
+
+		fmt.Printf("%s  %-24s segment %d %s fetched in %s (TTFB %s)\n",
+			rotation.Time.Format(time.RFC3339), label, rotation.Sequence, keyURL, formatDuration(latency), formatDuration(ttfb))
+	}
+}
+
+// resolveMediaPlaylistURL follows a master playlist to its first variant
+func resolveMediaPlaylistURL(ctx context.Context, client *http.Client) (string, error) {
+	fetchCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	result, err := probe.FetchPlaylist(fetchCtx, url, client)
+	if err != nil {
+		return "", fmt.Errorf("failed to fetch playlist: %w", err)
+	}
+
+	if result.Master == nil {
+		return url, nil
+	}
+
+	baseURL, err := probe.GetBaseURL(url)
+	if err != nil {
+		return "", fmt.Errorf("failed to get base URL: %w", err)
+	}
+
+	variantURL, err := probe.GetFirstVariantURL(result.Master, baseURL)
+	if err != nil {
+		return "", fmt.Errorf("failed to get variant URL: %w", err)
+	}
+
+	return variantURL, nil
+}
+
+// printMonitorReport outputs the health summary for a monitoring session
+func printMonitorReport(session *monitor.Session) {
+	counts := session.CountByKind()
+
+	kinds := make([]string, 0, len(counts))
+
+	for k := range counts {
+		kinds = append(kinds, string(k))
+	}
+
+	sort.Strings(kinds)
+
+	fmt.Println()
+	fmt.Println("Playlist health report")
+	fmt.Println("────────────────────────────────────────────────────")
+	fmt.Printf("%-28s %12s\n", "Monitored for:", time.Since(session.Started).Round(time.Second))
+	fmt.Printf("%-28s %12d\n", "Reloads:", session.Reloads)
+	fmt.Printf("%-28s %11.1fs\n", "Shortest window:", session.WindowMin)
+	fmt.Printf("%-28s %11.1fs\n", "Longest window:", session.WindowMax)
+	fmt.Printf("%-28s %12d\n", "Anomalies:", len(session.Anomalies))
+
+	for _, k := range kinds {
+		fmt.Printf("  %-26s %12d\n", k+":", counts[monitor.AnomalyKind(k)])
+	}
+
+	printMonitorDNS()
+	printKeyRotationReport(session.Rotations)
+	printRefreshCadence(session.Cadence)
+}
+
+// printKeyRotationReport summarizes key endpoint latency across rotations
+func printKeyRotationReport(rotations []monitor.KeyRotation) {
+	if len(rotations) == 0 {
+		return
+	}
+
+	var latencies []time.Duration
+
+	failures := 0
+	changes := 0
+
+	for _, r := range rotations {
+		if !r.Initial {
+			changes++
+		}
+
+		if r.Err != nil {
+			failures++
+
+			continue
+		}
+
+		latencies = append(latencies, r.Latency)
+	}
+
+	s := stats.ComputeStats(latencies)
+
+	fmt.Printf("%-28s %12d\n", "Key rotations:", changes)
+	fmt.Printf("%-28s %12d\n", "Key fetch failures:", failures)
+
+	if len(latencies) > 0 {
+		fmt.Printf("%-28s %12s\n", "Key fetch avg:", formatDuration(s.Mean))
+		fmt.Printf("%-28s %12s\n", "Key fetch max:", formatDuration(s.Max))
+	}
+}
+
+// printRefreshCadence summarizes when new segments appeared across the session
+func printRefreshCadence(cadence *monitor.Cadence) {
+	if cadence == nil {
+		return
+	}
+
+	fmt.Println()
+	fmt.Println("Refresh cadence")
+	fmt.Println("────────────────────────────────────────────────────")
+
+	// The first reload is the baseline the others are compared with
+	if cadence.Reloads < 2 {
+		fmt.Println("Not enough reloads of a live playlist to judge its refresh cadence")
+
+		return
+	}
+
+	reloads := cadence.Reloads - 1
+	updates := len(cadence.Updates)
+	late := cadence.Late()
+
+	fmt.Printf("%-28s %12d\n", "Updates timed:", updates)
+
+	if updates > 0 {
+		fmt.Printf("%-28s %12d (%.1f%%)\n", "On schedule:", updates-late, 100*float64(updates-late)/float64(updates))
+		fmt.Printf("%-28s %12d\n", "Late updates:", late)
+	}
+
+	fmt.Printf("%-28s %12d (%.1f%% of %d)\n", "Stale reloads:", cadence.Stale, 100*float64(cadence.Stale)/float64(reloads), reloads)
+
+	if cadence.LongestStale > 0 {
+		fmt.Printf("%-28s %12s\n", "Longest without update:", formatDuration(cadence.LongestStale))
+	}
+
+	if updates == 0 {
+		return
+	}
+
+	intervals := make([]time.Duration, 0, updates)
+
+	for _, update := range cadence.Updates {
+		intervals = append(intervals, update.Interval)
+	}
+
+	s := stats.ComputeStats(intervals)
+	lateness := stats.ComputeStats(cadence.Lateness())
+
+	fmt.Printf("%-28s %12s\n", "Update interval avg:", formatDuration(s.Mean))
+	fmt.Printf("%-28s %12s\n", "Update interval max:", formatDuration(s.Max))
+	fmt.Printf("%-28s %12s\n", "Lateness max:", formatDuration(lateness.Max))
+	fmt.Printf("%-28s %12s\n", "Update jitter:", formatDuration(lateness.StdDev))
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"fmt"
+
+	"codeberg.org/pwnderpants/vtrace/internal/probe"
+	"codeberg.org/pwnderpants/vtrace/internal/sink"
+	"codeberg.org/pwnderpants/vtrace/internal/ttff"
+)
+
+// negotiated describes the protocols a request ran over for JSON exports
+func negotiated(proto string, info *probe.TLSInfo) sink.Negotiated {
+	result := sink.Negotiated{HTTP: proto}
+
+	if info != nil {
+		result.TLS = info.VersionName()
+		result.CipherSuite = info.CipherSuiteName()
+		result.ALPN = info.ALPN
+	}
+
+	return result
+}
+
+// sampleNegotiated returns the negotiated protocols of a sample's manifest and segment requests
+func sampleNegotiated(sample ttff.Sample) map[string]sink.Negotiated {
+	result := make(map[string]sink.Negotiated)
+
+	if sample.ManifestProto != "" {
+		result["manifest"] = negotiated(sample.ManifestProto, sample.ManifestTLS)
+	}
+
+	if sample.SegmentProto != "" {
+		result["segment"] = negotiated(sample.SegmentProto, sample.SegmentTLS)
+	}
+
+	return result
+}
+
+// describeNegotiated summarizes the HTTP version and TLS parameters of a request
+func describeNegotiated(proto string, info *probe.TLSInfo) string {
+	if info == nil {
+		return proto + " without TLS"
+	}
+
+	alpn := info.ALPN
+
+	// Servers that skip ALPN leave the client on HTTP/1.1 even when it offered h2
+	if alpn == "" {
+		alpn = "none"
+	}
+
+	return fmt.Sprintf("%s over %s (%s, ALPN %s)", proto, info.VersionName(), info.CipherSuiteName(), alpn)
+}
+
+// printNegotiated prints the protocols the sample's manifest and segment requests ran over
+func printNegotiated(sample ttff.Sample) {
+	fmt.Printf("Negotiated (manifest): %s\n", describeNegotiated(sample.ManifestProto, sample.ManifestTLS))
+	fmt.Printf("Negotiated (segment):  %s\n", describeNegotiated(sample.SegmentProto, sample.SegmentTLS))
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"codeberg.org/pwnderpants/vtrace/internal/probe"
+)
+
+var (
+	disableGSO bool
+	disableECN bool
+
+	// quicConnections and gsoConnections count HTTP/3 connections dialed during the run
+	quicConnections int
+	gsoConnections  int
+
+	// ecnStates counts the final ECN validation state of each HTTP/3 connection
+	ecnStates = make(map[string]int)
+)
+
+// setupQUICOffloads applies --disable-gso and --disable-ecn before any QUIC socket is opened
+func setupQUICOffloads() error {
+	if err := probe.DisableQUICOffloads(disableGSO, disableECN); err != nil {
+		return fmt.Errorf("failed to configure QUIC offloads: %w", err)
+	}
+
+	return nil
+}
+
+// observeQUICOffloads tallies the offloads of HTTP/3 connections dialed for a sample
+func observeQUICOffloads(traces ...*probe.Trace) {
+	for _, trace := range traces {
+		offload, ok := trace.QUICOffload()
+		if !ok {
+			continue
+		}
+
+		quicConnections++
+
+		if offload.GSO {
+			gsoConnections++
+		}
+
+		ecnStates[ecnLabel(offload.ECN)]++
+
+		if verbose {
+			fmt.Printf("  QUIC connection: GSO %s, ECN %s\n", onOff(offload.GSO), ecnLabel(offload.ECN))
+		}
+	}
+}
+
+// printQUICOffloads reports how many HTTP/3 connections used GSO and how ECN validation ended
+func printQUICOffloads() {
+	if quicConnections == 0 {
+		return
+	}
+
+	states := make([]string, 0, len(ecnStates))
+
+	for state, count := range ecnStates {
+		states = append(states, fmt.Sprintf("%s %d", state, count))
+	}
+
+	sort.Strings(states)
+
+	fmt.Println("\nQUIC offloads (HTTP/3 connections):")
+	fmt.Printf("  %-5s %d/%d connections%s\n", "GSO", gsoConnections, quicConnections, disabledNote(disableGSO))
+	fmt.Printf("  %-5s %s%s\n", "ECN", strings.Join(states, ", "), disabledNote(disableECN))
+}
+
+// ecnLabel names an ECN validation state, treating an empty state as ECN being off
+func ecnLabel(state string) string {
+	if state == "" {
+		return "off"
+	}
+
+	return state
+}
+
+// onOff renders a boolean as on or off
+func onOff(enabled bool) string {
+	if enabled {
+		return "on"
+	}
+
+	return "off"
+}
+
+// disabledNote marks an offload turned off by flag
+func disabledNote(disabled bool) string {
+	if disabled {
+		return "  (disabled by flag)"
+	}
+
+	return ""
+}
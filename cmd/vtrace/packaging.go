@@ -0,0 +1,196 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"codeberg.org/pwnderpants/vtrace/internal/probe"
+	"codeberg.org/pwnderpants/vtrace/internal/stats"
+	"codeberg.org/pwnderpants/vtrace/internal/ttff"
+)
+
+// compareDASHURL is the MPEG-DASH manifest of the channel whose HLS playlist is the target;
+// when set, HLS and DASH samples alternate and are compared
+var compareDASHURL string
+
+// validateFormatComparison normalizes --compare-dash and rejects modes that cannot run
+// both packaging formats side by side
+func validateFormatComparison() error {
+	if compareDASHURL == "" {
+		return nil
+	}
+
+	normalized, err := probe.NormalizeURL(compareDASHURL)
+	if err != nil {
+		return fmt.Errorf("invalid --compare-dash URL: %w", err)
+	}
+
+	compareDASHURL = normalized
+
+	switch {
+	case streamProtocol != streamHLS:
+		return errors.New("--compare-dash requires --protocol hls (the -u URL is the HLS arm)")
+	case lowLatency || lowLatencyDASH:
+		return errors.New("--compare-dash cannot be combined with --ll-hls or --ll-dash")
+	case compare:
+		return errors.New("--compare-dash cannot be combined with --compare")
+	case compareColdWarm:
+		return errors.New("--compare-dash cannot be combined with --compare-cold-warm")
+	case compareResumption:
+		return errors.New("--compare-dash cannot be combined with --compare-resumption")
+	case allVariants:
+		return errors.New("--compare-dash cannot be combined with --all-variants")
+	case checkMode:
+		return errors.New("--compare-dash cannot be combined with --check")
+	case len(resolverSpecs) > 0 || len(interfaceNames) > 0:
+		return errors.New("--compare-dash cannot be combined with --resolvers or --interfaces")
+	case allIPs:
+		return errors.New("--compare-dash cannot be combined with --all-ips")
+	case urlFile != "":
+		return errors.New("--compare-dash cannot be combined with --url-file")
+	case watchMode:
+		return errors.New("--compare-dash cannot be combined with --watch")
+	case templatePath != "" || outputFormat == outputInflux:
+		return errors.New("--compare-dash cannot be combined with --template or --output influx")
+	case confidenceLevel > 0:
+		return errors.New("--compare-dash cannot be combined with --confidence")
+	case slaEnabled():
+		return errors.New("--compare-dash cannot be combined with --fail-* thresholds")
+	}
+
+	return nil
+}
+
+// runFormatComparison alternates HLS and DASH samples of the same channel and prints them
+// side by side
+func runFormatComparison(minDelay, maxDelay time.Duration) error {
+	var hlsSamples, dashSamples []ttff.Sample
+
+	hlsAborts := make(map[string]int)
+	dashAborts := make(map[string]int)
+
+	// measureSample follows --protocol, so each arm switches it for its samples
+	defer func() { streamProtocol = streamHLS }()
+
+	for i := 0; i < samples; i++ {
+		arms := []string{streamHLS, streamDASH}
+
+		// Alternate which format goes first so cache warming on the CDN favors neither
+		if i%2 == 1 {
+			arms[0], arms[1] = arms[1], arms[0]
+		}
+
+		for _, arm := range arms {
+			streamProtocol = arm
+			target := url
+			aborts := hlsAborts
+
+			if arm == streamDASH {
+				target = compareDASHURL
+				aborts = dashAborts
+			}
+
+			if verbose {
+				fmt.Printf("\n── Sample %d/%d (%s) ──\n", i+1, samples, formatName(arm))
+			}
+
+			sample, _, _, err := measureSample(context.Background(), target, i, protocolHTTP12)
+
+			switch {
+			case recordBudgetAbort(aborts, err):
+				if verbose {
+					fmt.Printf("  Aborted: %v\n", err)
+				}
+			case err != nil:
+				return fmt.Errorf("%s sample %d failed: %w", formatName(arm), i+1, err)
+			case arm == streamHLS:
+				hlsSamples = append(hlsSamples, sample)
+			default:
+				dashSamples = append(dashSamples, sample)
+			}
+
+			if err == nil && verbose {
+				fmt.Printf("  TTFF: %s\n", formatDuration(sample.TotalTTFF))
+			}
+		}
+
+		// Apply delay between rounds (skip after last round)
+		if i < samples-1 {
+			sleepDuration := getDelay(minDelay, maxDelay)
+
+			if verbose {
+				fmt.Printf("  Waiting %s before next round...\n", sleepDuration)
+			}
+
+			time.Sleep(sleepDuration)
+		}
+	}
+
+	if len(hlsSamples) == 0 || len(dashSamples) == 0 {
+		printBudgetSummary("HLS arm: ", hlsAborts, samples)
+		printBudgetSummary("DASH arm: ", dashAborts, samples)
+
+		return fmt.Errorf("every sample of a comparison arm was aborted: %w", ttff.ErrBudgetExceeded)
+	}
+
+	printFormatResults(exportURL(url), exportURL(compareDASHURL), hlsSamples, dashSamples)
+	printShaping()
+	printConfiguration()
+	printBudgetSummary("HLS arm: ", hlsAborts, samples)
+	printBudgetSummary("DASH arm: ", dashAborts, samples)
+
+	return nil
+}
+
+// formatName returns the display name of a --protocol value
+func formatName(protocol string) string {
+	if protocol == streamDASH {
+		return "DASH"
+	}
+
+	return "HLS"
+}
+
+// printFormatResults outputs the HLS vs DASH comparison table
+func printFormatResults(hlsURL, dashURL string, hlsSamples, dashSamples []ttff.Sample) {
+	dashTimings := ttff.Timings(dashSamples)
+	hlsTimings := ttff.Timings(hlsSamples)
+
+	if len(hlsSamples) == len(dashSamples) {
+		fmt.Printf("\nvtrace HLS vs DASH comparison (%d samples each)\n", len(hlsSamples))
+	} else {
+		fmt.Printf("\nvtrace HLS vs DASH comparison (%d HLS, %d DASH samples)\n", len(hlsSamples), len(dashSamples))
+	}
+
+	fmt.Printf("HLS:  %s\n", hlsURL)
+	fmt.Printf("DASH: %s\n", dashURL)
+	fmt.Println(compareRule)
+	fmt.Printf("%-20s %14s %14s %14s %-3s %8s\n", "", "HLS", "DASH", "Delta", "", "p-value")
+	fmt.Println(compareRule)
+
+	printComparisonRow("DNS Lookup:", stats.ExtractDNSLookup(hlsTimings), stats.ExtractDNSLookup(dashTimings))
+	printComparisonRow("TCP Connect:", stats.ExtractTCPConnect(hlsTimings), stats.ExtractTCPConnect(dashTimings))
+	printComparisonRow("TLS Handshake:", stats.ExtractTLSHandshake(hlsTimings), stats.ExtractTLSHandshake(dashTimings))
+	printComparisonRow("Manifest TTFB:", stats.ExtractManifestTTFB(hlsTimings), stats.ExtractManifestTTFB(dashTimings))
+
+	if anyNonZero(stats.ExtractKeyFetch(hlsTimings), stats.ExtractKeyFetch(dashTimings)) {
+		printComparisonRow("Key Fetch:", stats.ExtractKeyFetch(hlsTimings), stats.ExtractKeyFetch(dashTimings))
+	}
+
+	if anyNonZero(stats.ExtractInitSegment(hlsTimings), stats.ExtractInitSegment(dashTimings)) {
+		printComparisonRow("Init Segment:", stats.ExtractInitSegment(hlsTimings), stats.ExtractInitSegment(dashTimings))
+	}
+
+	printComparisonRow("Segment Download:", stats.ExtractSegmentTotal(hlsTimings), stats.ExtractSegmentTotal(dashTimings))
+	printComparisonRow("Frame Detection:", stats.ExtractFrameDetection(hlsTimings), stats.ExtractFrameDetection(dashTimings))
+
+	fmt.Println(compareRule)
+
+	printComparisonRow("Total TTFF:", stats.ExtractTotalTTFF(hlsTimings), stats.ExtractTotalTTFF(dashTimings))
+
+	fmt.Println()
+	fmt.Println("Samples alternate between formats over HTTP/1.1-2; Delta is DASH minus HLS.")
+	fmt.Println(significanceLegend)
+}
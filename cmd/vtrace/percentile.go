@@ -0,0 +1,61 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"codeberg.org/pwnderpants/vtrace/internal/stats"
+)
+
+// percentileRanks are the tail percentiles added as columns to the multi-sample table
+var percentileRanks []float64
+
+// validatePercentiles checks the --percentiles ranks
+func validatePercentiles() error {
+	for _, rank := range percentileRanks {
+		if rank <= 0 || rank > 100 {
+			return fmt.Errorf("invalid percentile %s (want a rank above 0 and at most 100)", percentileLabel(rank))
+		}
+	}
+
+	return nil
+}
+
+// percentileLabel names a percentile column, e.g. P95 or P99.9
+func percentileLabel(rank float64) string {
+	return "P" + strconv.FormatFloat(rank, 'f', -1, 64)
+}
+
+// percentileHeader renders the percentile column headings
+func percentileHeader() string {
+	var b strings.Builder
+
+	for _, rank := range percentileRanks {
+		fmt.Fprintf(&b, " %12s", percentileLabel(rank))
+	}
+
+	return b.String()
+}
+
+// percentileCells renders the percentile values of a stats row
+func percentileCells(s stats.Stats) string {
+	var b strings.Builder
+
+	for _, p := range s.Percentiles {
+		fmt.Fprintf(&b, " %12s", formatDuration(p.Value))
+	}
+
+	return b.String()
+}
+
+// multiSampleRule is the table separator, widened for the percentile columns
+func multiSampleRule() string {
+	return strings.Repeat("─", 82+13*len(percentileRanks))
+}
+
+// computeRowStats computes a table row's statistics including the configured percentiles
+func computeRowStats(durations []time.Duration) stats.Stats {
+	return stats.ComputeStatsWithPercentiles(durations, percentileRanks)
+}
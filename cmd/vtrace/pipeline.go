@@ -0,0 +1,48 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"codeberg.org/pwnderpants/vtrace/internal/ttff"
+)
+
+// newPipeline configures the shared measurement pipeline from the flags, logging progress
+// with --verbose and capturing responses into bundle
+func newPipeline(client *http.Client, useHTTP3 bool, bundle *replayBundle) *ttff.Pipeline {
+	cfg := ttff.Config{
+		HTTP3:          useHTTP3,
+		DASH:           streamProtocol == streamDASH,
+		Variant:        variantStrategy,
+		SegmentIndex:   segmentIndex,
+		Segments:       segmentCount,
+		LiveEdge:       liveEdge,
+		LowLatency:     lowLatency,
+		LowLatencyDASH: lowLatencyDASH,
+		Budgets:        phaseBudgets,
+		Headers:        phaseHeaders,
+	}
+
+	if verbose {
+		cfg.Logf = verboseLog
+	}
+
+	if bundle != nil {
+		cfg.Capture = bundle.add
+	}
+
+	return ttff.New(client, cfg)
+}
+
+// verboseLog prints a pipeline progress message on its own line, with durations in the
+// configured number format
+func verboseLog(format string, args ...any) {
+	for i, arg := range args {
+		if d, ok := arg.(time.Duration); ok {
+			args[i] = formatDuration(d)
+		}
+	}
+
+	fmt.Printf(format+"\n", args...)
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"time"
+
+	"codeberg.org/pwnderpants/vtrace/internal/player"
+	"codeberg.org/pwnderpants/vtrace/internal/stats"
+	"codeberg.org/pwnderpants/vtrace/internal/ttff"
+)
+
+var (
+	playerCommand string
+	playerReady   string
+	playerTimeout time.Duration
+)
+
+// playerReadyPattern is the compiled --player-ready expression (nil waits for exit)
+var playerReadyPattern *regexp.Regexp
+
+// validatePlayer checks the player flags and rejects modes without a single stream to play
+func validatePlayer() error {
+	if playerCommand == "" {
+		if playerReady != "" {
+			return errors.New("--player-ready requires --player-cmd")
+		}
+
+		return nil
+	}
+
+	switch {
+	case compare:
+		return errors.New("--player-cmd cannot be combined with --compare")
+	case urlFile != "":
+		return errors.New("--player-cmd cannot be combined with --url-file")
+	case allVariants:
+		return errors.New("--player-cmd cannot be combined with --all-variants")
+	case checkMode:
+		return errors.New("--player-cmd cannot be combined with --check")
+	case len(resolverSpecs) > 0 || len(interfaceNames) > 0:
+		return errors.New("--player-cmd cannot be combined with --resolvers or --interfaces")
+	}
+
+	if playerTimeout <= 0 {
+		return errors.New("--player-timeout must be positive")
+	}
+
+	playerReadyPattern = nil
+
+	if playerReady != "" {
+		pattern, err := regexp.Compile(playerReady)
+		if err != nil {
+			return fmt.Errorf("invalid --player-ready expression: %w", err)
+		}
+
+		playerReadyPattern = pattern
+	}
+
+	return nil
+}
+
+// measurePlayerJoin launches the external player against target once the synthetic
+// measurement is done; a player failure is reported but never fails the sample
+func measurePlayerJoin(ctx context.Context, target string, sample *ttff.Sample) {
+	ctx, cancel := context.WithTimeout(ctx, playerTimeout)
+	defer cancel()
+
+	args := player.Command(playerCommand, target)
+
+	if verbose {
+		fmt.Printf("Launching player: %s\n", args[0])
+	}
+
+	joined, err := player.Join(ctx, args, playerReadyPattern)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "warning: %v\n", err)
+
+		return
+	}
+
+	sample.PlayerJoin = joined
+}
+
+// playerJoins returns the join times of the samples where the player signalled readiness
+func playerJoins(allSamples []ttff.Sample) []time.Duration {
+	var joins []time.Duration
+
+	for _, join := range stats.ExtractPlayerJoin(ttff.Timings(allSamples)) {
+		if join > 0 {
+			joins = append(joins, join)
+		}
+	}
+
+	return joins
+}
+
+// printPlayerCalibration relates the real player join time to the synthetic TTFF over
+// the samples where both were measured
+func printPlayerCalibration(allSamples []ttff.Sample) {
+	if playerCommand == "" {
+		return
+	}
+
+	var offsets []time.Duration
+
+	ratioSum := 0.0
+
+	for _, sample := range allSamples {
+		if sample.PlayerJoin <= 0 || sample.TotalTTFF <= 0 {
+			continue
+		}
+
+		offsets = append(offsets, sample.PlayerJoin-sample.TotalTTFF)
+		ratioSum += float64(sample.PlayerJoin) / float64(sample.TotalTTFF)
+	}
+
+	fmt.Println()
+
+	if len(offsets) == 0 {
+		fmt.Println("Player calibration: the player never signalled readiness")
+
+		return
+	}
+
+	s := stats.ComputeStats(offsets)
+
+	sign := "+"
+
+	if s.Mean < 0 {
+		sign = ""
+	}
+
+	fmt.Printf("Player calibration (%d of %d samples): join = TTFF %s%s on average (%.2fx), offset StdDev %s\n",
+		len(offsets), len(allSamples), sign, formatDuration(s.Mean), ratioSum/float64(len(offsets)), formatDuration(s.StdDev))
+}
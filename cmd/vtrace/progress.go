@@ -0,0 +1,158 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"codeberg.org/pwnderpants/vtrace/internal/probe"
+	"codeberg.org/pwnderpants/vtrace/internal/stats"
+	"codeberg.org/pwnderpants/vtrace/internal/ttff"
+)
+
+// progressRows are the points of the segment download curve, in table order
+var progressRows = []struct {
+	label string
+	value func(*probe.Progress) time.Duration
+}{
+	{"First Byte:", func(p *probe.Progress) time.Duration { return p.FirstByte }},
+	{"25%:", func(p *probe.Progress) time.Duration { return p.Milestones[0] }},
+	{"50%:", func(p *probe.Progress) time.Duration { return p.Milestones[1] }},
+	{"75%:", func(p *probe.Progress) time.Duration { return p.Milestones[2] }},
+	{"Last Byte:", (*probe.Progress).LastByte},
+	{"Longest Stall:", func(p *probe.Progress) time.Duration { return p.LongestStall }},
+}
+
+// printSegmentProgress shows when the first byte, each quarter, and the last byte of the
+// segment body arrived, so pacing and stalls mid-transfer stand out from the Total
+func printSegmentProgress(allSamples []ttff.Sample) {
+	var progresses []*probe.Progress
+
+	for _, sample := range allSamples {
+		if sample.SegmentProgress != nil {
+			progresses = append(progresses, sample.SegmentProgress)
+		}
+	}
+
+	if len(progresses) == 0 {
+		return
+	}
+
+	if len(progresses) == 1 {
+		p := progresses[0]
+
+		points := []string{"first byte " + formatDuration(p.FirstByte)}
+
+		for i, percent := range probe.ProgressPercents {
+			points = append(points, fmt.Sprintf("%d%% %s", percent, formatDuration(p.Milestones[i])))
+		}
+
+		fmt.Printf("\nSegment Progress: %s (longest stall %s)\n", strings.Join(points, " → "), formatDuration(p.LongestStall))
+
+		return
+	}
+
+	fmt.Println("\nSegment Progress:")
+	fmt.Printf("  %-18s %14s %14s %14s %14s\n", "", "Avg", "Min", "Max", "Median")
+
+	for _, row := range progressRows {
+		values := make([]time.Duration, len(progresses))
+
+		for i, p := range progresses {
+			values[i] = row.value(p)
+		}
+
+		s := stats.ComputeStats(values)
+
+		fmt.Printf("  %-18s %14s %14s %14s %14s\n",
+			row.label,
+			formatDuration(s.Mean),
+			formatDuration(s.Min),
+			formatDuration(s.Max),
+			formatDuration(s.Median),
+		)
+	}
+}
+
+// printChunkedTransfer separates the time to the first CMAF chunk and the gaps between
+// chunks from the whole download for segments streamed without a Content-Length; a
+// low-latency origin streams chunks as it encodes them, so the first one is what start-up
+// waits for
+func printChunkedTransfer(allSamples []ttff.Sample) {
+	var timings []*probe.ChunkTiming
+
+	for _, sample := range allSamples {
+		if sample.Chunks != nil && sample.Chunks.Chunked {
+			timings = append(timings, sample.Chunks)
+		}
+	}
+
+	if len(timings) == 0 {
+		return
+	}
+
+	if len(allSamples) == 1 {
+		t := timings[0]
+
+		fmt.Printf("Chunked Transfer: first chunk after %s, complete after %s (%d %s, longest gap %s)\n",
+			formatDuration(t.FirstChunk), formatDuration(t.Complete), t.Chunks, plural(t.Chunks, "chunk"), formatDuration(longestGap(t)))
+
+		return
+	}
+
+	var (
+		firstChunks []time.Duration
+		completes   []time.Duration
+		gaps        []time.Duration
+		longest     []time.Duration
+		chunks      int
+	)
+
+	for _, t := range timings {
+		firstChunks = append(firstChunks, t.FirstChunk)
+		completes = append(completes, t.Complete)
+		gaps = append(gaps, t.Gaps()...)
+		longest = append(longest, longestGap(t))
+		chunks += t.Chunks
+	}
+
+	fmt.Printf("\nChunked Transfer (%d of %d %s, %s chunks each on average):\n",
+		len(timings), len(allSamples), plural(len(allSamples), "segment"), numberFormat.Number(float64(chunks)/float64(len(timings))))
+	fmt.Printf("  %-18s %14s %14s %14s %14s\n", "", "Avg", "Min", "Max", "Median")
+
+	for _, row := range []struct {
+		label  string
+		values []time.Duration
+	}{
+		{"First Chunk:", firstChunks},
+		{"Complete:", completes},
+		{"Chunk Gap:", gaps},
+		{"Longest Gap:", longest},
+	} {
+		// A segment of a single chunk has no gaps
+		if len(row.values) == 0 {
+			continue
+		}
+
+		s := stats.ComputeStats(row.values)
+
+		fmt.Printf("  %-18s %14s %14s %14s %14s\n",
+			row.label,
+			formatDuration(s.Mean),
+			formatDuration(s.Min),
+			formatDuration(s.Max),
+			formatDuration(s.Median),
+		)
+	}
+}
+
+// longestGap returns the longest wait between two chunks of a segment
+func longestGap(t *probe.ChunkTiming) time.Duration {
+	var longest time.Duration
+
+	for _, gap := range t.Gaps() {
+		longest = max(longest, gap)
+	}
+
+	return longest
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	neturl "net/url"
+	"strings"
+)
+
+var (
+	proxySpec string
+
+	// proxyURL is the parsed --proxy value, or nil to follow the proxy environment variables
+	proxyURL *neturl.URL
+)
+
+// setupProxy parses --proxy and rejects modes that cannot be measured through it
+func setupProxy() error {
+	proxyURL = nil
+
+	if proxySpec == "" {
+		return nil
+	}
+
+	parsed, err := parseProxy(proxySpec)
+	if err != nil {
+		return fmt.Errorf("invalid --proxy: %w", err)
+	}
+
+	switch {
+	case compare:
+		// HTTP/3 runs over QUIC, which neither CONNECT nor SOCKS5 can carry
+		return errors.New("--proxy cannot be combined with --compare (HTTP/3 cannot be proxied)")
+	case len(resolverSpecs) > 0:
+		return errors.New("--proxy cannot be combined with --resolvers (the proxy resolves the target)")
+	case useHTTPSRR:
+		return errors.New("--proxy cannot be combined with --use-https-rr (the proxy picks the address)")
+	}
+
+	proxyURL = parsed
+
+	if verbose {
+		fmt.Printf("Proxy: %s\n", proxyURL.Redacted())
+	}
+
+	return nil
+}
+
+// parseProxy accepts http://, https://, socks5://, and socks5h:// proxy URLs with a host;
+// a bare host:port is treated as an HTTP proxy
+func parseProxy(spec string) (*neturl.URL, error) {
+	spec = strings.TrimSpace(spec)
+
+	if !strings.Contains(spec, "://") {
+		spec = "http://" + spec
+	}
+
+	parsed, err := neturl.Parse(spec)
+	if err != nil {
+		return nil, err
+	}
+
+	switch parsed.Scheme {
+	case "http", "https", "socks5", "socks5h":
+	default:
+		return nil, fmt.Errorf("unsupported scheme %q (want http, https, socks5, or socks5h)", parsed.Scheme)
+	}
+
+	if parsed.Hostname() == "" {
+		return nil, fmt.Errorf("missing proxy host in %q", spec)
+	}
+
+	return parsed, nil
+}
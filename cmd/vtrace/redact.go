@@ -0,0 +1,50 @@
+package main
+
+import (
+	"errors"
+
+	"codeberg.org/pwnderpants/vtrace/internal/redact"
+)
+
+// redactResults hashes URLs and drops tokens and IP addresses from exported results
+var redactResults bool
+
+// validateRedact rejects outputs that would leak raw URLs despite --redact
+func validateRedact() error {
+	if redactResults && replayDir != "" {
+		return errors.New("--redact cannot be combined with --replay-dir (bundles keep raw playlists and headers)")
+	}
+
+	if redactResults && harPath != "" {
+		return errors.New("--redact cannot be combined with --har (HAR files keep raw URLs and headers)")
+	}
+
+	return nil
+}
+
+// exportURL returns the URL as it should appear in exported results
+func exportURL(raw string) string {
+	if !redactResults {
+		return raw
+	}
+
+	return redact.URL(raw)
+}
+
+// exportError returns an error message as it should appear in exported results
+func exportError(err error) string {
+	if !redactResults {
+		return err.Error()
+	}
+
+	return redact.Text(err.Error())
+}
+
+// exportAddr returns a connect address as it should appear in printed results
+func exportAddr(addr string) string {
+	if !redactResults {
+		return addr
+	}
+
+	return redact.Placeholder
+}
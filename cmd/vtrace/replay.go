@@ -0,0 +1,196 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"codeberg.org/pwnderpants/vtrace/internal/probe"
+	"codeberg.org/pwnderpants/vtrace/internal/ttff"
+)
+
+// replayFile holds a single response body captured during a sample
+type replayFile struct {
+	Name   string      `json:"name"`
+	URL    string      `json:"url"`
+	Status int         `json:"status"`
+	Header http.Header `json:"header"`
+	Bytes  int         `json:"bytes"`
+	data   []byte
+}
+
+// replayBundle collects everything the probe saw during a single sample
+type replayBundle struct {
+	Files  []replayFile            `json:"files"`
+	Traces map[string]*probe.Trace `json:"traces"`
+	prefix string
+}
+
+// replayManifest is the trace JSON written alongside the captured files
+type replayManifest struct {
+	RunID     string        `json:"run_id"`
+	URL       string        `json:"url"`
+	Sample    int           `json:"sample"`
+	Protocol  string        `json:"protocol"`
+	Timestamp time.Time     `json:"timestamp"`
+	Error     string        `json:"error,omitempty"`
+	Result    *ttff.Sample  `json:"result,omitempty"`
+	Bundle    *replayBundle `json:"bundle"`
+}
+
+// newReplayBundle returns a bundle when replay capture is enabled, nil otherwise
+func newReplayBundle() *replayBundle {
+	if replayDir == "" {
+		return nil
+	}
+
+	return &replayBundle{Traces: make(map[string]*probe.Trace)}
+}
+
+// addPlaylist records a fetched playlist and its trace
+func (b *replayBundle) addPlaylist(name, playlistURL string, result *probe.PlaylistResult) {
+	if b == nil || result == nil {
+		return
+	}
+
+	b.add(name, playlistURL, result.Body, result.Trace)
+}
+
+// add records a response body and its trace under the given name
+func (b *replayBundle) add(name, fileURL string, data []byte, trace *probe.Trace) {
+	if b == nil {
+		return
+	}
+
+	name = b.prefix + name
+
+	file := replayFile{
+		Name:  name,
+		URL:   fileURL,
+		Bytes: len(data),
+		data:  data,
+	}
+
+	if trace != nil {
+		file.Status = trace.StatusCode
+		file.Header = trace.Header
+
+		b.Traces[name] = trace
+	}
+
+	b.Files = append(b.Files, file)
+}
+
+// setPrefix names the following files apart from the video path (e.g., "audio-")
+func (b *replayBundle) setPrefix(prefix string) {
+	if b == nil {
+		return
+	}
+
+	b.prefix = prefix
+}
+
+// shouldWriteReplay reports whether a sample outcome warrants a replay bundle
+func shouldWriteReplay(sample ttff.Sample, err error) bool {
+	if replayDir == "" {
+		return false
+	}
+
+	if err != nil {
+		return true
+	}
+
+	return replayThreshold > 0 && sample.TotalTTFF > replayThreshold
+}
+
+// replayBundleName names the bundle directory of a sample. Batch runs reuse sample indexes
+// for every target and may list a URL more than once, so their bundles also carry the
+// target's position in the URL file and a hash of its URL.
+func replayBundleName(ctx context.Context, target string, index int, protocol string) string {
+	protoSlug := strings.ReplaceAll(strings.ToLower(protocol), "/", "")
+
+	n, ok := batchTargetIndex(ctx)
+	if !ok {
+		return fmt.Sprintf("%s-%s-sample-%d", runID, protoSlug, index+1)
+	}
+
+	sum := sha256.Sum256([]byte(target))
+
+	return fmt.Sprintf("%s-url%d-%x-%s-sample-%d", runID, n+1, sum[:4], protoSlug, index+1)
+}
+
+// writeReplayBundle writes captured playlists, headers, segment data, and trace JSON of a target sample to disk
+func writeReplayBundle(ctx context.Context, target string, index int, protocol string, bundle *replayBundle, sample ttff.Sample, sampleErr error) (string, error) {
+	dir := filepath.Join(replayDir, replayBundleName(ctx, target, index, protocol))
+
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return "", fmt.Errorf("failed to create replay directory: %w", err)
+	}
+
+	// Write raw response bodies
+	for _, f := range bundle.Files {
+		if err := os.WriteFile(filepath.Join(dir, f.Name), f.data, 0o644); err != nil {
+			return "", fmt.Errorf("failed to write %s: %w", f.Name, err)
+		}
+	}
+
+	// Write response headers in a human-readable form
+	var headers strings.Builder
+
+	for _, f := range bundle.Files {
+		fmt.Fprintf(&headers, "== %s (%s) status %d\n", f.Name, f.URL, f.Status)
+
+		keys := make([]string, 0, len(f.Header))
+
+		for k := range f.Header {
+			keys = append(keys, k)
+		}
+
+		sort.Strings(keys)
+
+		for _, k := range keys {
+			for _, v := range f.Header[k] {
+				fmt.Fprintf(&headers, "%s: %s\n", k, v)
+			}
+		}
+
+		headers.WriteString("\n")
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, "headers.txt"), []byte(headers.String()), 0o644); err != nil {
+		return "", fmt.Errorf("failed to write headers: %w", err)
+	}
+
+	manifest := replayManifest{
+		RunID:     runID,
+		URL:       target,
+		Sample:    index + 1,
+		Protocol:  protocol,
+		Timestamp: time.Now().UTC(),
+		Bundle:    bundle,
+	}
+
+	if sampleErr != nil {
+		manifest.Error = sampleErr.Error()
+	} else {
+		manifest.Result = &sample
+	}
+
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return "", fmt.Errorf("failed to encode trace JSON: %w", err)
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, "trace.json"), data, 0o644); err != nil {
+		return "", fmt.Errorf("failed to write trace JSON: %w", err)
+	}
+
+	return dir, nil
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"codeberg.org/pwnderpants/vtrace/internal/probe"
+	"codeberg.org/pwnderpants/vtrace/internal/ttff"
+)
+
+func TestWriteReplayBundleDuplicateBatchURLs(t *testing.T) {
+	savedDir, savedRunID, savedTargets := replayDir, runID, batchTargets
+
+	t.Cleanup(func() {
+		replayDir, runID, batchTargets = savedDir, savedRunID, savedTargets
+	})
+
+	replayDir = t.TempDir()
+	runID = "run"
+
+	// The same URL listed twice, once per CDN, as a --url-file might
+	batchTargets = []*batchTarget{
+		{URL: "https://example.com/live/master.m3u8", Label: "cdn-a"},
+		{URL: "https://example.com/live/master.m3u8", Label: "cdn-b"},
+	}
+
+	const perTarget = 3
+
+	dirs := make(map[string]bool)
+
+	for n, target := range batchTargets {
+		ctx := withBatchTarget(context.Background(), n)
+
+		for i := range perTarget {
+			for _, protocol := range []string{protocolHTTP12, protocolHTTP3} {
+				bundle := &replayBundle{Traces: make(map[string]*probe.Trace)}
+
+				dir, err := writeReplayBundle(ctx, target.URL, i, protocol, bundle, ttff.Sample{}, errors.New("timeout"))
+				if err != nil {
+					t.Fatalf("writeReplayBundle() error = %v", err)
+				}
+
+				if dirs[dir] {
+					t.Errorf("target %d sample %d (%s) reused bundle %s", n+1, i+1, protocol, dir)
+				}
+
+				dirs[dir] = true
+			}
+		}
+	}
+
+	entries, err := os.ReadDir(replayDir)
+	if err != nil {
+		t.Fatalf("failed to read replay directory: %v", err)
+	}
+
+	if want := len(batchTargets) * perTarget * 2; len(entries) != want {
+		t.Errorf("got %d bundle directories, want %d", len(entries), want)
+	}
+
+	for dir := range dirs {
+		if _, err := os.Stat(filepath.Join(dir, "trace.json")); err != nil {
+			t.Errorf("bundle %s has no trace.json: %v", dir, err)
+		}
+	}
+}
+
+func TestReplayBundleNameKeepsProtocolLabels(t *testing.T) {
+	savedRunID := runID
+
+	t.Cleanup(func() {
+		runID = savedRunID
+	})
+
+	runID = "run"
+
+	tests := []struct {
+		protocol string
+		want     string
+	}{
+		{protocolHTTP12, "run-http1.1-2-sample-1"},
+		{protocolHTTP3, "run-http3-sample-1"},
+	}
+
+	for _, tt := range tests {
+		if got := replayBundleName(context.Background(), "https://example.com/", 0, tt.protocol); got != tt.want {
+			t.Errorf("replayBundleName(%q) = %q, want %q", tt.protocol, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+var (
+	resolveSpecs []string
+
+	// pinnedHosts maps "host:port" dial addresses to the "ip:port" given with --resolve
+	pinnedHosts map[string]string
+)
+
+// setupResolve parses the --resolve pins and rejects modes that would bypass them
+func setupResolve() error {
+	pinnedHosts = nil
+
+	if len(resolveSpecs) == 0 {
+		return nil
+	}
+
+	switch {
+	case proxyURL != nil:
+		return errors.New("--resolve cannot be combined with --proxy (the proxy resolves the target)")
+	case len(resolverSpecs) > 0:
+		return errors.New("--resolve cannot be combined with --resolvers")
+	}
+
+	pins, err := parseResolve(resolveSpecs)
+	if err != nil {
+		return fmt.Errorf("invalid --resolve: %w", err)
+	}
+
+	pinnedHosts = pins
+
+	if verbose {
+		addrs := make([]string, 0, len(pinnedHosts))
+
+		for addr := range pinnedHosts {
+			addrs = append(addrs, addr)
+		}
+
+		sort.Strings(addrs)
+
+		for _, addr := range addrs {
+			fmt.Printf("Pinned %s to %s\n", addr, pinnedHosts[addr])
+		}
+	}
+
+	return nil
+}
+
+// parseResolve reads curl-style host:port:address entries; IPv6 addresses may be bracketed
+func parseResolve(specs []string) (map[string]string, error) {
+	pins := make(map[string]string, len(specs))
+
+	for _, spec := range specs {
+		host, rest, ok := strings.Cut(strings.TrimSpace(spec), ":")
+		port, addr, ok2 := strings.Cut(rest, ":")
+
+		if !ok || !ok2 || host == "" {
+			return nil, fmt.Errorf("%q (want host:port:address, e.g., example.com:443:203.0.113.7)", spec)
+		}
+
+		if n, err := strconv.Atoi(port); err != nil || n < 1 || n > 65535 {
+			return nil, fmt.Errorf("invalid port in %q", spec)
+		}
+
+		ip := net.ParseIP(strings.TrimSuffix(strings.TrimPrefix(addr, "["), "]"))
+		if ip == nil {
+			return nil, fmt.Errorf("invalid IP address in %q", spec)
+		}
+
+		pins[net.JoinHostPort(strings.ToLower(host), port)] = net.JoinHostPort(ip.String(), port)
+	}
+
+	return pins, nil
+}
+
+// dialPins combines the --use-https-rr hint, the --resolve pins, and the address under
+// test in --all-ips mode, each taking precedence over the one before
+func dialPins() map[string]string {
+	var pins map[string]string
+
+	for _, layer := range []map[string]string{httpsResolve, pinnedHosts, edgePin} {
+		if len(layer) == 0 {
+			continue
+		}
+
+		if pins == nil {
+			pins = make(map[string]string)
+		}
+
+		maps.Copy(pins, layer)
+	}
+
+	return pins
+}
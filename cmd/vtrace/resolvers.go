@@ -0,0 +1,330 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	neturl "net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"codeberg.org/pwnderpants/vtrace/internal/probe"
+	"codeberg.org/pwnderpants/vtrace/internal/stats"
+	"codeberg.org/pwnderpants/vtrace/internal/ttff"
+)
+
+var resolverSpecs []string
+
+// dnsNameserver points measurement clients at one resolver during a comparison
+var dnsNameserver string
+
+// resolverArm collects the DNS answers and samples measured through one resolver
+type resolverArm struct {
+	Name       string
+	Nameserver string
+	Answers    []string
+	LookupErr  error
+	Edges      map[string]int
+	Samples    []ttff.Sample
+	Failures   int
+}
+
+// validateResolvers rejects flags that conflict with --resolvers
+func validateResolvers() error {
+	if len(resolverSpecs) == 0 {
+		return nil
+	}
+
+	switch {
+	case len(resolverSpecs) < 2:
+		return errors.New("--resolvers needs at least two resolvers to compare")
+	case compare:
+		return errors.New("--resolvers cannot be combined with --compare")
+	case allVariants:
+		return errors.New("--resolvers cannot be combined with --all-variants")
+	case checkMode:
+		return errors.New("--resolvers cannot be combined with --check")
+	case useHTTPSRR:
+		return errors.New("--resolvers cannot be combined with --use-https-rr")
+	case templatePath != "" || outputFormat == outputInflux:
+		return errors.New("--resolvers cannot be combined with --template or --output influx")
+	}
+
+	_, err := parseResolvers(resolverSpecs)
+
+	return err
+}
+
+// parseResolvers turns entries like "system", "1.1.1.1", or "isp=10.0.0.1:53" into arms
+func parseResolvers(specs []string) ([]*resolverArm, error) {
+	var arms []*resolverArm
+
+	for _, spec := range specs {
+		spec = strings.TrimSpace(spec)
+
+		if spec == "" {
+			continue
+		}
+
+		name, addr, labelled := strings.Cut(spec, "=")
+
+		if !labelled {
+			name, addr = "", spec
+		}
+
+		if addr == "system" {
+			if name == "" {
+				name = "system"
+			}
+
+			arms = append(arms, &resolverArm{Name: name, Nameserver: probe.SystemNameserver()})
+
+			continue
+		}
+
+		nameserver := addr
+
+		if net.ParseIP(addr) != nil {
+			nameserver = net.JoinHostPort(addr, "53")
+		}
+
+		host, _, err := net.SplitHostPort(nameserver)
+		if err != nil || net.ParseIP(host) == nil {
+			return nil, fmt.Errorf("resolver %q must be system or an IP address with an optional port", spec)
+		}
+
+		arms = append(arms, &resolverArm{Name: name, Nameserver: nameserver})
+	}
+
+	return arms, nil
+}
+
+// label names an arm by its label and nameserver address
+func (a *resolverArm) label() string {
+	if a.Name == "" {
+		return exportAddr(a.Nameserver)
+	}
+
+	return fmt.Sprintf("%s (%s)", a.Name, exportAddr(a.Nameserver))
+}
+
+// lookupAnswers resolves the stream host through every resolver in parallel
+func lookupAnswers(arms []*resolverArm) error {
+	parsed, err := neturl.Parse(url)
+	if err != nil {
+		return fmt.Errorf("failed to parse URL: %w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	var wg sync.WaitGroup
+
+	for _, arm := range arms {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			arm.Answers, arm.LookupErr = probe.LookupHost(ctx, parsed.Hostname(), arm.Nameserver)
+		}()
+	}
+
+	wg.Wait()
+
+	return nil
+}
+
+// runResolverComparison measures through every resolver and compares edge mapping and TTFF
+func runResolverComparison(minDelay, maxDelay time.Duration) error {
+	arms, err := parseResolvers(resolverSpecs)
+	if err != nil {
+		return err
+	}
+
+	if err := lookupAnswers(arms); err != nil {
+		return err
+	}
+
+	// Resolvers take turns within each round so network drift affects them equally
+	for i := 0; i < samples; i++ {
+		for _, arm := range arms {
+			dnsNameserver = arm.Nameserver
+
+			if verbose {
+				fmt.Printf("\n── Sample %d/%d via %s ──\n", i+1, samples, arm.label())
+			}
+
+			sample, manifestTrace, segmentTrace, err := measureSample(context.Background(), url, i, protocolHTTP12)
+			if err != nil {
+				arm.Failures++
+
+				if verbose {
+					fmt.Printf("  Failed: %v\n", err)
+				}
+
+				continue
+			}
+
+			arm.Samples = append(arm.Samples, sample)
+
+			if arm.Edges == nil {
+				arm.Edges = make(map[string]int)
+			}
+
+			for _, edge := range connectedEdges(manifestTrace, segmentTrace) {
+				arm.Edges[edge]++
+			}
+
+			if verbose {
+				fmt.Printf("  TTFF: %s\n", formatDuration(sample.TotalTTFF))
+			}
+		}
+
+		// Apply delay between rounds (skip after last round)
+		if i < samples-1 {
+			sleepDuration := getDelay(minDelay, maxDelay)
+
+			if verbose {
+				fmt.Printf("  Waiting %s before next round...\n", sleepDuration)
+			}
+
+			time.Sleep(sleepDuration)
+		}
+	}
+
+	dnsNameserver = ""
+
+	printResolverResults(exportURL(url), arms)
+	printShaping()
+	printConfiguration()
+
+	for _, arm := range arms {
+		if len(arm.Samples) > 0 {
+			return nil
+		}
+	}
+
+	return errors.New("every resolver failed")
+}
+
+// connectedEdges returns the addresses of successful connects made for a sample
+func connectedEdges(traces ...*probe.Trace) []string {
+	var edges []string
+
+	for _, trace := range traces {
+		if trace == nil {
+			continue
+		}
+
+		for _, c := range trace.Connects {
+			if c.Err != "" {
+				continue
+			}
+
+			host, _, err := net.SplitHostPort(c.Addr)
+			if err != nil {
+				host = c.Addr
+			}
+
+			edges = append(edges, host)
+		}
+	}
+
+	return edges
+}
+
+// printResolverResults outputs the per-resolver TTFF table followed by the edge mapping
+func printResolverResults(url string, arms []*resolverArm) {
+	summaries := make([]stats.PhaseSummary, len(arms))
+
+	for i, arm := range arms {
+		summaries[i] = stats.SummarizePhases(ttff.Timings(arm.Samples))
+	}
+
+	fastest, slowest := stats.FastestSlowest(summaries)
+
+	fmt.Printf("\nvtrace resolver comparison for: %s (%d samples each)\n", url, samples)
+	fmt.Println("──────────────────────────────────────────────────────────────────────────────────────────────────")
+	fmt.Printf("%-28s %12s %12s %12s %12s %12s %6s\n", "Resolver", "DNS Lookup", "Manifest", "Segment", "Total TTFF", "StdDev", "Failed")
+	fmt.Println("──────────────────────────────────────────────────────────────────────────────────────────────────")
+
+	for i, arm := range arms {
+		s := summaries[i]
+
+		if s.Count == 0 {
+			fmt.Printf("%-28s %12s %12s %12s %12s %12s %6d\n", arm.label(), "-", "-", "-", "-", "-", arm.Failures)
+
+			continue
+		}
+
+		marker := ""
+
+		switch i {
+		case fastest:
+			marker = "  fastest"
+		case slowest:
+			marker = "  slowest"
+		}
+
+		fmt.Printf("%-28s %12s %12s %12s %12s %12s %6d%s\n",
+			arm.label(),
+			formatDuration(s.DNSLookup.Mean),
+			formatDuration(s.ManifestTotal.Mean),
+			formatDuration(s.SegmentTotal.Mean),
+			formatDuration(s.TotalTTFF.Mean),
+			formatDuration(s.TotalTTFF.StdDev),
+			arm.Failures,
+			marker,
+		)
+	}
+
+	fmt.Println("──────────────────────────────────────────────────────────────────────────────────────────────────")
+	fmt.Println("DNS Lookup, Manifest, Segment, and Total TTFF are averages.")
+
+	fmt.Println("\nEdge mapping:")
+
+	distinct := make(map[string]bool)
+
+	for _, arm := range arms {
+		answers := joinAddrs(arm.Answers)
+
+		if arm.LookupErr != nil {
+			answers = "lookup failed: " + exportError(arm.LookupErr)
+		}
+
+		fmt.Printf("  %-26s answers %s\n", arm.label(), answers)
+
+		edges := make([]string, 0, len(arm.Edges))
+
+		for edge, count := range arm.Edges {
+			edges = append(edges, fmt.Sprintf("%s (%d)", exportAddr(edge), count))
+			distinct[edge] = true
+		}
+
+		sort.Strings(edges)
+
+		if len(edges) > 0 {
+			fmt.Printf("  %-26s connected %s\n", "", strings.Join(edges, ", "))
+		}
+	}
+
+	// Different edges per resolver point at resolver-dependent CDN steering
+	if len(distinct) > 1 {
+		fmt.Printf("\nResolvers were steered to %d different edges; compare their TTFF above.\n", len(distinct))
+	}
+}
+
+// joinAddrs formats resolved addresses for display
+func joinAddrs(addrs []string) string {
+	display := make([]string, len(addrs))
+
+	for i, addr := range addrs {
+		display[i] = exportAddr(addr)
+	}
+
+	return strings.Join(display, ", ")
+}
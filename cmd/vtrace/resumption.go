@@ -0,0 +1,391 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	neturl "net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"codeberg.org/pwnderpants/vtrace/internal/probe"
+	"codeberg.org/pwnderpants/vtrace/internal/stats"
+	"codeberg.org/pwnderpants/vtrace/internal/ttff"
+)
+
+// Handshakes a sample's new connections run during a resumption comparison
+const (
+	handshakeFull    = "full"
+	handshakeResumed = "resumed"
+)
+
+var (
+	// resumeSessions keeps a TLS session cache so new connections resume an earlier session
+	// (and HTTP/3 requests go out as 0-RTT early data) instead of running full handshakes
+	resumeSessions bool
+
+	// compareResumption alternates full-handshake and resumed samples and compares them
+	compareResumption bool
+
+	// handshakeArm forces the handshake of the current sample during a resumption comparison
+	handshakeArm string
+
+	// sessionCache holds the sessions shared by every client of the run
+	sessionCache = sync.OnceValue(func() tls.ClientSessionCache {
+		return tls.NewLRUClientSessionCache(0)
+	})
+
+	// primedSessions records the protocol and host pairs whose session cache was primed
+	primedSessions   = make(map[string]bool)
+	primedSessionsMu sync.Mutex
+)
+
+// validateResumption checks that --resume and --compare-resumption are used with
+// measurements whose connections run their own handshakes
+func validateResumption() error {
+	if !resumeSessions && !compareResumption {
+		return nil
+	}
+
+	flag := "--resume"
+
+	if compareResumption {
+		flag = "--compare-resumption"
+	}
+
+	switch {
+	case resumeSessions && compareResumption:
+		return errors.New("--resume cannot be combined with --compare-resumption")
+	case warmConnections || compareColdWarm:
+		return fmt.Errorf("%s cannot be combined with --warm or --compare-cold-warm", flag)
+	case playerCommand != "":
+		return fmt.Errorf("%s cannot be combined with --player-cmd", flag)
+	}
+
+	if !compareResumption {
+		return nil
+	}
+
+	switch {
+	case !strings.HasPrefix(strings.ToLower(url), "https://"):
+		return errors.New("--compare-resumption requires an https:// URL")
+	case compare:
+		return errors.New("--compare-resumption cannot be combined with --compare (use --resume --compare for HTTP/3 0-RTT)")
+	case allVariants:
+		return errors.New("--compare-resumption cannot be combined with --all-variants")
+	case checkMode:
+		return errors.New("--compare-resumption cannot be combined with --check")
+	case len(resolverSpecs) > 0 || len(interfaceNames) > 0:
+		return errors.New("--compare-resumption cannot be combined with --resolvers or --interfaces")
+	case allIPs:
+		return errors.New("--compare-resumption cannot be combined with --all-ips")
+	case urlFile != "":
+		return errors.New("--compare-resumption cannot be combined with --url-file")
+	case watchMode:
+		return errors.New("--compare-resumption cannot be combined with --watch")
+	case templatePath != "" || outputFormat == outputInflux:
+		return errors.New("--compare-resumption cannot be combined with --template or --output influx")
+	case confidenceLevel > 0:
+		return errors.New("--compare-resumption cannot be combined with --confidence")
+	case slaEnabled():
+		return errors.New("--compare-resumption cannot be combined with --fail-* thresholds")
+	}
+
+	return nil
+}
+
+// resumingSessions reports whether the next sample's connections resume cached sessions
+func resumingSessions() bool {
+	if handshakeArm != "" {
+		return handshakeArm == handshakeResumed
+	}
+
+	return resumeSessions
+}
+
+// applyResumption shares the run's session cache with a client. Comparison arms open a
+// connection per request, so every handshake of a sample is full or resumed.
+func applyResumption(opts *probe.ClientOptions) {
+	if resumingSessions() {
+		opts.SessionCache = sessionCache()
+	}
+
+	if handshakeArm != "" {
+		opts.DisableKeepAlives = true
+	}
+}
+
+// primeSession fetches the manifest once, untimed, so the session cache holds a ticket for
+// the host before the first timed sample of each protocol resumes it
+func primeSession(ctx context.Context, target, protocol string) error {
+	if !resumingSessions() {
+		return nil
+	}
+
+	parsed, err := neturl.Parse(target)
+	if err != nil {
+		return fmt.Errorf("invalid URL: %w", err)
+	}
+
+	key := protocol + "|" + parsed.Host
+
+	primedSessionsMu.Lock()
+	defer primedSessionsMu.Unlock()
+
+	if primedSessions[key] {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	var (
+		resp  *http.Response
+		trace *probe.Trace
+	)
+
+	if protocol == protocolHTTP3 {
+		resp, trace, err = probe.FetchWithTraceHTTP3(ctx, target, newHTTP3Client())
+	} else {
+		resp, trace, err = probe.FetchWithTrace(ctx, target, newHTTPClient())
+	}
+
+	if err != nil {
+		return fmt.Errorf("failed to prime TLS session cache: %w", err)
+	}
+
+	// The session ticket arrives after the handshake, so the body is read to the end
+	_, err = io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+
+	if err != nil {
+		return fmt.Errorf("failed to prime TLS session cache: %w", err)
+	}
+
+	primedSessions[key] = true
+
+	if verbose {
+		fmt.Printf("Primed TLS session cache: %s (%s)\n", formatDuration(trace.Total), describeHandshake(trace.Handshake))
+	}
+
+	return nil
+}
+
+// describeHandshake names the TLS version of a handshake and whether it resumed a session
+func describeHandshake(handshake *probe.Handshake) string {
+	if handshake == nil {
+		return "no new TLS connection"
+	}
+
+	kind := "full handshake"
+
+	if handshake.Resumed {
+		kind = "resumed"
+	}
+
+	if handshake.EarlyData {
+		kind += ", 0-RTT early data"
+	}
+
+	return fmt.Sprintf("%s %s", handshake.VersionName(), kind)
+}
+
+// printResumption reports how many of the samples' new TLS connections resumed a session
+// and how many HTTP/3 connections sent 0-RTT early data
+func printResumption(prefix string, allSamples []ttff.Sample) {
+	if !resumeSessions {
+		return
+	}
+
+	if len(allSamples) == 1 {
+		sample := allSamples[0]
+
+		fmt.Printf("%sTLS resumption: manifest %s; segment %s\n", prefix, describeHandshake(sample.ManifestHandshake), describeHandshake(sample.SegmentHandshake))
+
+		return
+	}
+
+	var connections, resumed, early int
+
+	versions := make(map[string]bool)
+
+	for _, sample := range allSamples {
+		for _, handshake := range []*probe.Handshake{sample.ManifestHandshake, sample.SegmentHandshake} {
+			if handshake == nil {
+				continue
+			}
+
+			connections++
+			versions[handshake.VersionName()] = true
+
+			if handshake.Resumed {
+				resumed++
+			}
+
+			if handshake.EarlyData {
+				early++
+			}
+		}
+	}
+
+	if connections == 0 {
+		fmt.Printf("%sTLS resumption: no new TLS connections were opened\n", prefix)
+
+		return
+	}
+
+	var names []string
+
+	for name := range versions {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	fmt.Printf("%sTLS resumption: %d of %d new %s resumed a session (%s)", prefix, resumed, connections, plural(connections, "connection"), strings.Join(names, ", "))
+
+	if early > 0 {
+		fmt.Printf(", %d with 0-RTT early data", early)
+	}
+
+	fmt.Println()
+}
+
+// runResumptionComparison alternates full-handshake and resumed samples and prints them
+// side by side
+func runResumptionComparison(minDelay, maxDelay time.Duration) error {
+	var fullSamples, resumedSamples []ttff.Sample
+
+	fullAborts := make(map[string]int)
+	resumedAborts := make(map[string]int)
+
+	defer func() { handshakeArm = "" }()
+
+	for i := 0; i < samples; i++ {
+		arms := []string{handshakeFull, handshakeResumed}
+
+		// Alternate which arm goes first so cache warming on the CDN favors neither
+		if i%2 == 1 {
+			arms[0], arms[1] = arms[1], arms[0]
+		}
+
+		for _, arm := range arms {
+			handshakeArm = arm
+
+			if verbose {
+				fmt.Printf("\n── Sample %d/%d (%s handshake) ──\n", i+1, samples, arm)
+			}
+
+			sample, _, _, err := measureSample(context.Background(), url, i, protocolHTTP12)
+
+			aborts := fullAborts
+
+			if arm == handshakeResumed {
+				aborts = resumedAborts
+			}
+
+			switch {
+			case recordBudgetAbort(aborts, err):
+				if verbose {
+					fmt.Printf("  Aborted: %v\n", err)
+				}
+			case err != nil:
+				return fmt.Errorf("%s handshake sample %d failed: %w", arm, i+1, err)
+			case arm == handshakeFull:
+				fullSamples = append(fullSamples, sample)
+			default:
+				resumedSamples = append(resumedSamples, sample)
+			}
+
+			if err == nil && verbose {
+				fmt.Printf("  TTFF: %s (manifest %s)\n", formatDuration(sample.TotalTTFF), describeHandshake(sample.ManifestHandshake))
+			}
+		}
+
+		// Apply delay between rounds (skip after last round)
+		if i < samples-1 {
+			sleepDuration := getDelay(minDelay, maxDelay)
+
+			if verbose {
+				fmt.Printf("  Waiting %s before next round...\n", sleepDuration)
+			}
+
+			time.Sleep(sleepDuration)
+		}
+	}
+
+	if len(fullSamples) == 0 || len(resumedSamples) == 0 {
+		printBudgetSummary("Full arm: ", fullAborts, samples)
+		printBudgetSummary("Resumed arm: ", resumedAborts, samples)
+
+		return fmt.Errorf("every sample of a comparison arm was aborted: %w", ttff.ErrBudgetExceeded)
+	}
+
+	printResumptionResults(exportURL(url), fullSamples, resumedSamples)
+	printShaping()
+	printConfiguration()
+	printBudgetSummary("Full arm: ", fullAborts, samples)
+	printBudgetSummary("Resumed arm: ", resumedAborts, samples)
+
+	return nil
+}
+
+// printResumptionResults outputs the full vs resumed handshake comparison table
+func printResumptionResults(url string, fullSamples, resumedSamples []ttff.Sample) {
+	fullTimings := ttff.Timings(fullSamples)
+	resumedTimings := ttff.Timings(resumedSamples)
+
+	if len(fullSamples) == len(resumedSamples) {
+		fmt.Printf("\nvtrace TLS resumption comparison for: %s (%d samples each)\n", url, len(fullSamples))
+	} else {
+		fmt.Printf("\nvtrace TLS resumption comparison for: %s (%d full, %d resumed samples)\n", url, len(fullSamples), len(resumedSamples))
+	}
+
+	fmt.Println(compareRule)
+	fmt.Printf("%-20s %14s %14s %14s %-3s %8s\n", "", "Full", "Resumed", "Delta", "", "p-value")
+	fmt.Println(compareRule)
+
+	printComparisonRow("TCP Connect:", stats.ExtractTCPConnect(fullTimings), stats.ExtractTCPConnect(resumedTimings))
+	printComparisonRow("TLS Handshake:", stats.ExtractTLSHandshake(fullTimings), stats.ExtractTLSHandshake(resumedTimings))
+	printComparisonRow("Manifest TTFB:", stats.ExtractManifestTTFB(fullTimings), stats.ExtractManifestTTFB(resumedTimings))
+
+	if anyNonZero(stats.ExtractKeyFetch(fullTimings), stats.ExtractKeyFetch(resumedTimings)) {
+		printComparisonRow("Key Fetch:", stats.ExtractKeyFetch(fullTimings), stats.ExtractKeyFetch(resumedTimings))
+	}
+
+	if anyNonZero(stats.ExtractInitSegment(fullTimings), stats.ExtractInitSegment(resumedTimings)) {
+		printComparisonRow("Init Segment:", stats.ExtractInitSegment(fullTimings), stats.ExtractInitSegment(resumedTimings))
+	}
+
+	printComparisonRow(segmentPhaseLabel(), stats.ExtractSegmentTotal(fullTimings), stats.ExtractSegmentTotal(resumedTimings))
+
+	fmt.Println(compareRule)
+
+	printComparisonRow("Total TTFF:", stats.ExtractTotalTTFF(fullTimings), stats.ExtractTotalTTFF(resumedTimings))
+
+	fmt.Println()
+
+	// Servers that issue no tickets leave the resumed arm running full handshakes
+	resumed, connections := 0, 0
+
+	for _, sample := range resumedSamples {
+		for _, handshake := range []*probe.Handshake{sample.ManifestHandshake, sample.SegmentHandshake} {
+			if handshake != nil {
+				connections++
+
+				if handshake.Resumed {
+					resumed++
+				}
+			}
+		}
+	}
+
+	fmt.Printf("Resumed arm: %d of %d new %s resumed a session.\n", resumed, connections, plural(connections, "connection"))
+	fmt.Println("Both arms open a new connection per request; the resumed arm reuses TLS sessions from earlier connections.")
+	fmt.Println(significanceLegend)
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"codeberg.org/pwnderpants/vtrace/internal/history"
+)
+
+// compactInterval is how often serve applies the retention policy
+const compactInterval = time.Hour
+
+var (
+	retainRaw        time.Duration
+	retainAggregates time.Duration
+)
+
+// retentionEnabled reports whether any retention limit is configured
+func retentionEnabled() bool {
+	return retainRaw > 0 || retainAggregates > 0
+}
+
+// validateRetention checks the retention windows
+func validateRetention() error {
+	if retainRaw < 0 || retainAggregates < 0 {
+		return errors.New("--retain-raw and --retain-aggregates must not be negative")
+	}
+
+	if retainRaw > 0 && retainAggregates > 0 && retainAggregates < retainRaw {
+		return errors.New("--retain-aggregates must be at least --retain-raw")
+	}
+
+	return nil
+}
+
+// compactHistory downsamples and expires records relative to now
+func compactHistory(store history.Store, now time.Time) error {
+	var rawBefore, aggregateBefore time.Time
+
+	if retainRaw > 0 {
+		rawBefore = now.Add(-retainRaw)
+	}
+
+	if retainAggregates > 0 {
+		aggregateBefore = now.Add(-retainAggregates)
+	}
+
+	result, err := store.Compact(rawBefore, aggregateBefore)
+	if err != nil {
+		return err
+	}
+
+	if result.Removed > 0 {
+		fmt.Printf("%s  compacted history: %d raw samples into %d hourly aggregates, %d expired\n",
+			now.UTC().Format(time.RFC3339), result.Downsampled, result.Aggregates, result.Expired)
+	}
+
+	return nil
+}
+
+// compactOnSchedule applies the retention policy every compactInterval
+func compactOnSchedule(ctx context.Context, store history.Store) {
+	ticker := time.NewTicker(compactInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		if err := compactHistory(store, time.Now()); err != nil {
+			fmt.Fprintf(os.Stderr, "warning: %v\n", err)
+		}
+	}
+}
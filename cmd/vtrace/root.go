@@ -5,14 +5,20 @@ import (
 	"errors"
 	"fmt"
 	"math/rand"
+	"os"
+	"slices"
+	"sort"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/spf13/cobra"
 
 	"codeberg.org/pwnderpants/vtrace/internal/decoder"
 	"codeberg.org/pwnderpants/vtrace/internal/probe"
+	"codeberg.org/pwnderpants/vtrace/internal/sink"
 	"codeberg.org/pwnderpants/vtrace/internal/stats"
+	"codeberg.org/pwnderpants/vtrace/internal/ttff"
 )
 
 var (
@@ -24,6 +30,32 @@ var (
 	delayRandom     string
 	excludeOutliers bool
 	compare         bool
+	beaconURL       string
+	replayDir       string
+	replayThreshold time.Duration
+	useECH          bool
+	showHTTPSRR     bool
+	useHTTPSRR      bool
+	budgetSpec      string
+	csvPath         string
+	streamProtocol  string
+)
+
+var (
+	// echConfigList holds the ECH config retrieved from DNS when --ech is set
+	echConfigList []byte
+
+	// httpsResolve pins the target host to an HTTPS record address hint when --use-https-rr is set
+	httpsResolve map[string]string
+)
+
+// runID identifies all samples belonging to a single invocation
+var runID = newRunID()
+
+// Protocol labels used when reporting samples
+const (
+	protocolHTTP12 = "HTTP/1.1-2"
+	protocolHTTP3  = "HTTP/3"
 )
 
 var rootCmd = &cobra.Command{
@@ -33,45 +65,167 @@ var rootCmd = &cobra.Command{
 
 It breaks down the latency into DNS lookup, TCP connect, TLS handshake,
 manifest fetch, segment download, and frame detection times.`,
-	RunE: run,
+	PersistentPreRunE: applyConfig,
+	RunE:              run,
 }
 
 // init configures the root command flags
 func init() {
+	rootCmd.PersistentFlags().StringVar(&configPath, "config", "", "Read flag defaults from this YAML, TOML, or JSON file (e.g., ~/.vtrace.yaml)")
+	rootCmd.PersistentFlags().StringVar(&profileName, "profile", "", "Apply this named profile of the config file (config defaults to ~/.vtrace.yaml)")
 	rootCmd.Flags().StringVarP(&url, "url", "u", "", "HLS stream URL (required)")
+	rootCmd.Flags().BoolVar(&syntheticMode, "synthetic", false, "Measure the built-in synthetic HLS origin on the loopback interface instead of --url")
+	rootCmd.Flags().StringVar(&injectDropSpec, "inject-drop-after", "", "With --synthetic, abort every segment response after this many bytes (e.g., 64K)")
+	rootCmd.Flags().BoolVar(&injectCorruptPlaylist, "inject-corrupt-playlist", false, "With --synthetic, serve a truncated media playlist that does not parse")
+	rootCmd.Flags().DurationVar(&injectKeyDelay, "inject-key-delay", 0, "With --synthetic, encrypt the segments and hold every key response this long")
+	rootCmd.Flags().StringVar(&urlFile, "url-file", "", "Measure every URL in this file (one per line, optionally followed by a label) and print a cross-URL summary")
+	rootCmd.Flags().IntVar(&batchConcurrency, "concurrency", 1, "Measure up to this many --url-file targets in parallel")
 	rootCmd.Flags().DurationVarP(&timeout, "timeout", "t", 30*time.Second, "Request timeout")
 	rootCmd.Flags().BoolVarP(&verbose, "verbose", "v", false, "Enable verbose output")
+	rootCmd.Flags().BoolVar(&decoderWarmup, "warmup-decoder", false, "Run the frame decoders once on a built-in segment before the first timed sample")
+	rootCmd.Flags().StringVar(&ffprobeBinaryPath, "ffprobe", "", "ffprobe executable to run instead of the one found in PATH")
+	rootCmd.Flags().BoolVar(&ffprobeSandboxed, "ffprobe-sandbox", false, "Run ffprobe with an empty environment, no_new_privs, and a seccomp filter that denies sockets and ptrace (Linux)")
+	rootCmd.Flags().StringArrayVar(&ffprobeEnvSpecs, "ffprobe-env", nil, "Pass a variable into the --ffprobe-sandbox environment (NAME=value, or NAME to copy it; repeatable)")
+	rootCmd.Flags().DurationVar(&ffprobeTimeout, "ffprobe-timeout", 0, "Kill ffprobe when it runs longer than this")
+	rootCmd.Flags().StringVar(&ffprobeMemorySpec, "ffprobe-memory", "", "Cap the address space of ffprobe (e.g., 512M; Linux)")
+	rootCmd.Flags().DurationVar(&ffprobeCPULimit, "ffprobe-cpu", 0, "Cap the CPU time of ffprobe, in whole seconds (Linux)")
+	rootCmd.Flags().StringVar(&ffprobeCgroup, "ffprobe-cgroup", "", "Start ffprobe in this cgroup v2 directory, whose memory, CPU, and pids limits apply (Linux)")
 	rootCmd.Flags().IntVarP(&samples, "samples", "n", 1, "Number of measurement iterations")
+	rootCmd.Flags().Float64Var(&confidenceLevel, "confidence", 0, "Keep sampling until the Total TTFF confidence interval at this level (e.g., 95) is within --ci-margin")
+	rootCmd.Flags().IntVar(&maxSamples, "max-samples", 50, "Stop adaptive sampling after this many samples")
+	rootCmd.Flags().Float64Var(&ciMargin, "ci-margin", 5, "Target confidence interval half-width as a percentage of the mean")
+	rootCmd.Flags().StringArrayVarP(&headerSpecs, "header", "H", nil, "Add a request header to every request (\"Name: value\", repeatable)")
+	rootCmd.Flags().StringVar(&userAgent, "user-agent", "", "User-Agent sent with every request")
+	rootCmd.Flags().StringVar(&limitRateSpec, "limit-rate", "", "Shape every response body to this many bits per second with a token bucket shared by all requests and comparison arms (e.g., 5M)")
+	rootCmd.Flags().StringVar(&limitBurstSpec, "limit-burst", "", "Token bucket size for --limit-rate (default 64K)")
+	rootCmd.Flags().StringVar(&cmcdMode, "cmcd", "", "Attach CTA-5004 CMCD data to every request as the CMCD query parameter (query) or CMCD-* headers (header)")
+	rootCmd.Flags().StringVar(&cmcdSessionID, "cmcd-sid", "", "CMCD session ID (default a random UUID per run)")
+	rootCmd.Flags().StringVar(&cmcdContentID, "cmcd-cid", "", "CMCD content ID")
+	rootCmd.Flags().BoolVar(&cmcdStarved, "cmcd-starved", false, "Report buffer starvation (CMCD bs) on media requests, like a player recovering from a stall")
+	rootCmd.Flags().StringVar(&proxySpec, "proxy", "", "Send HTTP/1.1-2 requests through an HTTP or SOCKS5 proxy (e.g., http://host:3128, socks5://host:1080)")
+	rootCmd.Flags().StringVar(&tlsMinSpec, "tls-min", "", "Lowest TLS version to offer: 1.0, 1.1, 1.2, or 1.3 (default Go's minimum, 1.2)")
+	rootCmd.Flags().BoolVar(&insecureTLS, "insecure", false, "Skip TLS certificate verification")
+	rootCmd.Flags().StringVar(&caCertPath, "cacert", "", "Verify servers against the CA certificates in this PEM file instead of the system roots")
+	rootCmd.Flags().StringVar(&clientCertPath, "cert", "", "Client certificate (PEM) presented to servers that request one")
+	rootCmd.Flags().StringVar(&clientKeyPath, "key", "", "Private key (PEM) for --cert (default: read from the --cert file)")
+	rootCmd.Flags().StringArrayVar(&resolveSpecs, "resolve", nil, "Pin a host and port to an address, like curl (host:port:address, repeatable)")
+	rootCmd.Flags().StringVar(&cdnRangesPath, "cdn-ranges", "", "Identify CDNs from the \"CIDR provider\" lines of this file before the built-in address ranges")
+	rootCmd.Flags().DurationVar(&dnsCacheTTL, "dns-cache", 0, "Resolve hosts through vtrace's own cache, keeping answers this long, and report cache hits and query latency")
+	rootCmd.Flags().BoolVar(&freshDNS, "fresh-dns", false, "Resolve the host again and open new connections for every sample instead of reusing them")
+	rootCmd.Flags().BoolVar(&warmConnections, "warm", false, "Open the connection with a throwaway manifest request, then measure over the reused connection")
+	rootCmd.Flags().BoolVar(&compareColdWarm, "compare-cold-warm", false, "Alternate cold-start and warm-connection samples and compare them")
+	rootCmd.Flags().StringVar(&compareDASHURL, "compare-dash", "", "MPEG-DASH manifest of the same channel; alternate HLS and DASH samples and compare their start-up phases")
+	rootCmd.Flags().BoolVar(&resumeSessions, "resume", false, "Resume cached TLS sessions on new connections (0-RTT for HTTP/3) and report whether each handshake resumed")
+	rootCmd.Flags().BoolVar(&compareResumption, "compare-resumption", false, "Alternate samples with full and resumed TLS handshakes and compare them")
+	rootCmd.Flags().StringArrayVar(&manifestHeaderSpecs, "manifest-header", nil, "Add a header to playlist and MPD requests only (\"Name: value\", repeatable)")
+	rootCmd.Flags().StringArrayVar(&segmentHeaderSpecs, "segment-header", nil, "Add a header to segment, init section, and part requests only (\"Name: value\", repeatable)")
 	rootCmd.Flags().DurationVarP(&delay, "delay", "d", 5*time.Second, "Fixed delay between samples")
+	rootCmd.Flags().BoolVar(&watchMode, "watch", false, "Measure every --interval until interrupted, printing one line per sample with rolling statistics")
+	rootCmd.Flags().DurationVar(&watchInterval, "interval", 30*time.Second, "Time between sample starts in --watch mode")
+	rootCmd.Flags().IntVar(&watchWindow, "window", 20, "Samples covered by the rolling mean and P95 in --watch mode")
 	rootCmd.Flags().StringVar(&delayRandom, "delay-random", "", "Randomized delay range (e.g., 2s-8s)")
 	rootCmd.Flags().BoolVar(&excludeOutliers, "exclude-outliers", false, "Exclude outliers from average calculation")
+	rootCmd.Flags().Float64SliceVar(&percentileRanks, "percentiles", slices.Clone(stats.DefaultPercentiles), "Percentile columns in multi-sample results (e.g., 50,90,99.9)")
 	rootCmd.Flags().BoolVar(&compare, "compare", false, "Compare HTTP/1.1-2 vs HTTP/3 TTFF timings")
-
-	rootCmd.MarkFlagRequired("url")
+	rootCmd.Flags().StringVar(&variantBandwidth, "variant-bandwidth", "", "Measure the variant with this bandwidth: highest, lowest, or closest to a bitrate (e.g., 3M)")
+	rootCmd.Flags().StringVar(&variantResolution, "variant-resolution", "", "Measure the variant with this resolution: highest, lowest, WIDTHxHEIGHT, or 720p")
+	rootCmd.Flags().IntVar(&variantIndex, "variant-index", -1, "Measure the variant at this zero-based position in the master playlist")
+	rootCmd.Flags().BoolVar(&lowLatency, "ll-hls", false, "Measure Low-Latency HLS time to first partial segment (EXT-X-PART) instead of a full segment")
+	rootCmd.Flags().IntVar(&segmentIndex, "segment-index", 0, "Measure the media segment at this zero-based position in the playlist instead of the first")
+	rootCmd.Flags().BoolVar(&liveEdge, "live-edge", false, "Start live playlists at the segment a joining player would pick (three target durations or HOLD-BACK from the end) and report its distance from the live edge")
+	rootCmd.Flags().IntVar(&segmentCount, "segments", 1, "Download this many consecutive segments and count their average download as the segment phase")
+	rootCmd.Flags().BoolVar(&lowLatencyDASH, "ll-dash", false, "Measure LL-DASH time to first chunk of the in-progress segment at the live edge instead of a full segment")
+	rootCmd.Flags().BoolVar(&audioMode, "audio", false, "Also measure time to first audio frame (TTFA) from the audio rendition or the muxed segment")
+	rootCmd.Flags().BoolVar(&subtitleMode, "subtitles", false, "Validate the first segment of the subtitle rendition (WebVTT or IMSC) and its timing against the video PTS")
+	rootCmd.Flags().BoolVar(&colorspaceMode, "colorspace", false, "Report the color description and HDR metadata of the first segment and check it against the variant's VIDEO-RANGE and CODECS")
+	rootCmd.Flags().BoolVar(&codecMode, "codecs", false, "Check the codec, profile, tier, and level of the first segment against the variant's CODECS attribute")
+	rootCmd.Flags().BoolVar(&cadenceMode, "cadence", false, "Measure the frame rate of the first segment and warn about dropped, duplicated, or telecined frames")
+	rootCmd.Flags().BoolVar(&bitrateMode, "bitrate", false, "Measure the real bitrate and duration of the first segment and check them against BANDWIDTH and EXTINF")
+	rootCmd.Flags().Float64Var(&bitrateTolerance, "bitrate-tolerance", 10, "Percentage the measured bitrate and duration may deviate from the playlist before --bitrate flags them")
+	rootCmd.Flags().StringVar(&playerCommand, "player-cmd", "", "Also time a real player joining the stream, e.g. \"ffplay -autoexit -nodisp {url}\" (URL appended when {url} is absent)")
+	rootCmd.Flags().StringVar(&playerReady, "player-ready", "", "Regular expression on the player's output that marks the join (default: the player exiting successfully)")
+	rootCmd.Flags().DurationVar(&playerTimeout, "player-timeout", 30*time.Second, "Give up on a player that has not joined after this long")
+	rootCmd.Flags().BoolVar(&allVariants, "all-variants", false, "Measure every variant in the master playlist and print a per-variant comparison")
+	rootCmd.Flags().StringSliceVar(&resolverSpecs, "resolvers", nil, "Compare TTFF and edge mapping across DNS resolvers (e.g., system,1.1.1.1,8.8.8.8,isp=10.0.0.1)")
+	rootCmd.Flags().BoolVar(&allIPs, "all-ips", false, "Measure once per A/AAAA record of the manifest host, pinning each connection, and compare the edges")
+	rootCmd.Flags().StringSliceVar(&interfaceNames, "interfaces", nil, "Compare TTFF across local network interfaces, binding each measurement to one (e.g., eth0,wwan0)")
+	rootCmd.Flags().StringVar(&numberLocale, "locale", "", "Format table numbers for a locale (e.g., de-DE, fr-FR, de-CH)")
+	rootCmd.Flags().StringVar(&decimalSeparator, "decimal-separator", "", "Decimal separator for table numbers (overrides --locale)")
+	rootCmd.Flags().StringVar(&thousandsSeparator, "thousands-separator", "", "Thousands grouping separator for table numbers (overrides --locale)")
+	rootCmd.Flags().IntVar(&numberWidth, "number-width", 0, "Pad every table number to this fixed width (0 for natural width)")
+	rootCmd.Flags().StringVar(&tcpReceiveBufferFlag, "tcp-rcvbuf", "", "TCP socket receive buffer size (e.g., 4M); the effective size is reported")
+	rootCmd.Flags().StringVar(&udpReceiveBufferFlag, "udp-rcvbuf", "", "UDP socket receive buffer size for HTTP/3 (e.g., 8M); the effective size is reported")
+	rootCmd.Flags().BoolVar(&disableGSO, "disable-gso", false, "Disable UDP generic segmentation offload (GSO) for HTTP/3")
+	rootCmd.Flags().BoolVar(&disableECN, "disable-ecn", false, "Disable ECN marking and validation for HTTP/3")
+	rootCmd.Flags().StringVar(&streamProtocol, "protocol", streamHLS, "Streaming format of the manifest: hls or dash")
+	rootCmd.Flags().BoolVar(&useECH, "ech", false, "Use Encrypted Client Hello with the config from the target's HTTPS DNS record")
+	rootCmd.Flags().BoolVar(&showHTTPSRR, "https-rr", false, "Report the target's HTTPS (SVCB) DNS records")
+	rootCmd.Flags().BoolVar(&useHTTPSRR, "use-https-rr", false, "Connect using the port and address hints from HTTPS DNS records")
+	rootCmd.Flags().BoolVar(&checkMode, "check", false, "Print a single Nagios/Icinga status line with perfdata and exit with the plugin status code")
+	rootCmd.Flags().DurationVar(&checkWarnThreshold, "warning", 0, "TTFF at or above which --check reports WARNING")
+	rootCmd.Flags().DurationVar(&checkCritThreshold, "critical", 0, "TTFF at or above which --check reports CRITICAL")
+	rootCmd.Flags().StringVar(&budgetSpec, "budget", "", "Per-phase budgets that abort a sample early (e.g., manifest=800ms,segment=2s)")
+	rootCmd.Flags().StringVar(&templatePath, "template", "", "Render results with this Go text/template file instead of the tables")
+	rootCmd.Flags().BoolVar(&showWaterfall, "waterfall", false, "Draw each sample's start-up sequence as a waterfall so the dominant phase stands out")
+	rootCmd.Flags().StringVar(&outputFormat, "output", outputTable, "Result format: table, or influx for one line of InfluxDB line protocol per sample")
+	rootCmd.Flags().BoolVar(&redactResults, "redact", false, "Hash URLs and strip tokens, query strings, and IP addresses from results and exports")
+	rootCmd.Flags().StringVar(&csvPath, "csv", "", "Write one row per sample with all phase durations to this CSV file")
+	rootCmd.Flags().StringVar(&harPath, "har", "", "Write every HTTP request of the run with timings, headers, and sizes to this HAR 1.2 file")
+	rootCmd.Flags().StringVar(&uploadTarget, "upload", "", "Upload JSON and HTML reports to s3://bucket/prefix after the run (credentials from AWS_* env)")
+	rootCmd.Flags().StringVar(&runHistoryPath, "history", "", "Append every sample to this history store (file path, sqlite:PATH, or postgres:// URL)")
+	rootCmd.Flags().StringVar(&experimentName, "experiment", "", "Label samples with an experiment name for ab-report (stored in "+defaultHistoryPath+" unless --history is set)")
+	rootCmd.Flags().StringVar(&experimentArm, "arm", "", "Experiment arm these samples belong to (e.g., A or B)")
+	rootCmd.Flags().StringArrayVar(&labelSpecs, "label", nil, "Tag stored samples with a name=value label for compare-stored (repeatable, e.g., region=eu)")
+	rootCmd.Flags().StringVar(&replayDir, "replay-dir", "", "Write a replay bundle for failed samples to this directory")
+	rootCmd.Flags().DurationVar(&replayThreshold, "replay-threshold", 0, "Also write replay bundles for samples with TTFF above this value")
+	rootCmd.Flags().StringVar(&beaconURL, "beacon-url", "", "POST a JSON beacon with the run ID and summary after each sample")
+	rootCmd.Flags().StringSliceVar(&kafkaBrokers, "kafka-brokers", nil, "Publish one message per sample to these Kafka brokers (comma-separated host:port)")
+	rootCmd.Flags().StringVar(&kafkaTopic, "kafka-topic", "vtrace-samples", "Kafka topic for sample messages")
+	rootCmd.Flags().BoolVar(&kafkaTLS, "kafka-tls", false, "Connect to Kafka brokers over TLS")
+	rootCmd.Flags().StringVar(&kafkaSASL, "kafka-sasl", "", "Kafka SASL mechanism: plain, scram-sha-256, or scram-sha-512 (password from VTRACE_KAFKA_PASSWORD)")
+	rootCmd.Flags().StringVar(&kafkaUsername, "kafka-username", "", "Kafka SASL username")
+	rootCmd.Flags().StringVar(&zabbixServer, "zabbix-server", "", "Push per-metric values to this Zabbix server or proxy (host[:port])")
+	rootCmd.Flags().StringVar(&zabbixHost, "zabbix-host", "", "Host name the items belong to in Zabbix")
+	rootCmd.Flags().StringVar(&zabbixKeyPrefix, "zabbix-key-prefix", "vtrace.", "Prefix for Zabbix item keys (e.g., vtrace.total_ttff)")
+	rootCmd.Flags().StringVar(&influxURL, "influx-url", "", "Write each sample as line protocol to this InfluxDB server (token from VTRACE_INFLUX_TOKEN)")
+	rootCmd.Flags().StringVar(&influxBucket, "influx-bucket", "", "InfluxDB bucket (or database/retention-policy on 1.8) to write samples to")
+	rootCmd.Flags().StringVar(&influxOrg, "influx-org", "", "InfluxDB organization owning the bucket")
+	rootCmd.Flags().StringVar(&influxMeasurement, "influx-measurement", "vtrace", "Measurement name for line protocol written by --influx-url and --output influx")
+
+	registerSLAFlags(rootCmd)
+
+	rootCmd.MarkFlagsOneRequired("url", "url-file", "synthetic")
+	rootCmd.MarkFlagsMutuallyExclusive("url", "url-file", "synthetic")
 }
 
 // run executes the main TTFF measurement logic
 func run(cmd *cobra.Command, args []string) error {
-	// Check ffprobe availability
-	if err := decoder.CheckFFprobe(); err != nil {
-		return fmt.Errorf("ffprobe check failed: %w", err)
+	minDelay, maxDelay, err := prepareRun()
+	defer csvWriter.Close()
+	defer writeHAR()
+	defer kafkaProducer.Close()
+	defer uploadReport()
+	defer closeRunHistory()
+	defer closeSynthetic()
+
+	if err == nil {
+		captureConfig(cmd.Flags())
 	}
 
-	// Validate samples flag
-	if samples < 1 {
-		return errors.New("samples must be at least 1")
-	}
-
-	// Parse delay-random if provided
-	var minDelay, maxDelay time.Duration
-
-	if delayRandom != "" {
-		var err error
+	// Check mode reports every outcome, including setup errors, as one status line
+	if checkMode {
+		cmd.SilenceErrors = true
+		cmd.SilenceUsage = true
 
-		minDelay, maxDelay, err = parseDelayRange(delayRandom)
 		if err != nil {
-			return fmt.Errorf("invalid delay-random format: %w", err)
+			return checkUnknown(err)
 		}
+
+		return runCheck(minDelay, maxDelay)
+	}
+
+	if err != nil {
+		return err
 	}
 
 	// Handle comparison mode
@@ -79,39 +233,117 @@ func run(cmd *cobra.Command, args []string) error {
 		return runCompare(minDelay, maxDelay)
 	}
 
+	// Compare cold starts with samples over an already open connection
+	if compareColdWarm {
+		return runColdWarmComparison(minDelay, maxDelay)
+	}
+
+	// Compare full TLS handshakes with resumed sessions
+	if compareResumption {
+		return runResumptionComparison(minDelay, maxDelay)
+	}
+
+	// Compare HLS and DASH packaging of the same channel
+	if compareDASHURL != "" {
+		return runFormatComparison(minDelay, maxDelay)
+	}
+
+	// Sweep every rendition of the ladder
+	if allVariants {
+		return runSweep(minDelay, maxDelay)
+	}
+
+	// Compare TTFF and edge mapping across DNS resolvers
+	if len(resolverSpecs) > 0 {
+		return runResolverComparison(minDelay, maxDelay)
+	}
+
+	// Compare TTFF across local uplinks
+	if len(interfaceNames) > 0 {
+		return runInterfaceComparison(minDelay, maxDelay)
+	}
+
+	// Compare every address behind the manifest host
+	if allIPs {
+		return runAllIPsComparison(minDelay, maxDelay)
+	}
+
+	// Measure a whole channel lineup
+	if urlFile != "" {
+		return runBatch(minDelay, maxDelay)
+	}
+
+	// Soak a stream until interrupted
+	if watchMode {
+		return runWatch()
+	}
+
 	// Single sample mode
-	if samples == 1 {
-		sample, manifestTrace, segmentTrace, err := measureTTFF()
+	if samples == 1 && !adaptiveSampling() {
+		sample, manifestTrace, segmentTrace, err := measureSample(context.Background(), url, 0, protocolHTTP12)
 		if err != nil {
 			return err
 		}
 
-		printResults(url, manifestTrace, segmentTrace, sample.FrameDetection, sample.TotalTTFF)
+		if outputTemplate != nil {
+			if err := renderTemplate(); err != nil {
+				return err
+			}
 
-		return nil
+			return enforceSLA(cmd, []ttff.Sample{sample})
+		}
+
+		printResults(exportURL(url), manifestTrace, segmentTrace, sample)
+		printReceiveBuffers()
+
+		if useECH {
+			if err := printECHComparison(); err != nil {
+				return err
+			}
+		}
+
+		return enforceSLA(cmd, []ttff.Sample{sample})
 	}
 
 	// Multi-sample mode
-	var allSamples []stats.Sample
+	var allSamples []ttff.Sample
 
-	for i := 0; i < samples; i++ {
+	budgetAborts := make(map[string]int)
+
+	limit := sampleLimit()
+	attempted := 0
+
+	for i := 0; i < limit; i++ {
 		if verbose {
-			fmt.Printf("\n── Sample %d/%d ──\n", i+1, samples)
+			fmt.Printf("\n── Sample %d/%d ──\n", i+1, limit)
 		}
 
-		sample, _, _, err := measureTTFF()
-		if err != nil {
+		sample, _, _, err := measureSample(context.Background(), url, i, protocolHTTP12)
+		attempted++
+
+		// Budget aborts are tallied and the run moves on to the next sample
+		switch {
+		case recordBudgetAbort(budgetAborts, err):
+			if verbose {
+				fmt.Printf("  Aborted: %v\n", err)
+			}
+		case err != nil:
 			return fmt.Errorf("sample %d failed: %w", i+1, err)
-		}
+		default:
+			allSamples = append(allSamples, sample)
 
-		allSamples = append(allSamples, sample)
+			if verbose {
+				fmt.Printf("  TTFF: %s\n", formatDuration(sample.TotalTTFF))
+			}
+		}
 
-		if verbose {
-			fmt.Printf("  TTFF: %s\n", formatDuration(sample.TotalTTFF))
+		// Adaptive sampling stops as soon as the interval is tight enough
+		if confidenceReached(allSamples) {
+			break
 		}
 
 		// Apply delay between samples (skip after last sample)
-		if i < samples-1 {
+		if i < limit-1 {
 			sleepDuration := getDelay(minDelay, maxDelay)
 
 			if verbose {
@@ -122,9 +354,334 @@ func run(cmd *cobra.Command, args []string) error {
 		}
 	}
 
-	printMultiSampleResults(url, allSamples)
+	if len(allSamples) == 0 {
+		printBudgetSummary("", budgetAborts, attempted)
 
-	return nil
+		return fmt.Errorf("all %d samples aborted: %w", attempted, ttff.ErrBudgetExceeded)
+	}
+
+	if outputTemplate != nil {
+		if err := renderTemplate(); err != nil {
+			return err
+		}
+
+		return enforceSLA(cmd, allSamples)
+	}
+
+	printMultiSampleResults(exportURL(url), allSamples)
+	printPlayerCalibration(allSamples)
+	printConfidence(allSamples, attempted)
+	printBudgetSummary("", budgetAborts, attempted)
+	printReceiveBuffers()
+
+	if useECH {
+		if err := printECHComparison(); err != nil {
+			return err
+		}
+	}
+
+	return enforceSLA(cmd, allSamples)
+}
+
+// prepareRun validates flags and resolves DNS-derived settings before measuring
+func prepareRun() (time.Duration, time.Duration, error) {
+	// The synthetic origin replaces --url, so it starts before the URL is checked
+	if err := setupSynthetic(); err != nil {
+		return 0, 0, err
+	}
+
+	// Batch runs measure each listed URL in turn; the first stands in during setup
+	if urlFile != "" {
+		targets, err := loadBatchTargets(urlFile)
+		if err != nil {
+			return 0, 0, err
+		}
+
+		batchTargets = targets
+		url = targets[0].URL
+	}
+
+	// Normalize the target URL (punycode hosts, IPv6 literals, userinfo)
+	normalized, err := probe.NormalizeURL(url)
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid URL: %w", err)
+	}
+
+	url = normalized
+
+	// Validate samples flag
+	if samples < 1 {
+		return 0, 0, errors.New("samples must be at least 1")
+	}
+
+	if streamProtocol != streamHLS && streamProtocol != streamDASH {
+		return 0, 0, fmt.Errorf("unsupported protocol %q (want hls or dash)", streamProtocol)
+	}
+
+	if lowLatency && streamProtocol != streamHLS {
+		return 0, 0, errors.New("--ll-hls requires --protocol hls")
+	}
+
+	if lowLatencyDASH && streamProtocol != streamDASH {
+		return 0, 0, errors.New("--ll-dash requires --protocol dash")
+	}
+
+	if err := validateSegments(); err != nil {
+		return 0, 0, err
+	}
+
+	if err := validateLiveEdge(); err != nil {
+		return 0, 0, err
+	}
+
+	if err := validateFormatComparison(); err != nil {
+		return 0, 0, err
+	}
+
+	if err := validateAudio(); err != nil {
+		return 0, 0, err
+	}
+
+	if err := validateSubtitles(); err != nil {
+		return 0, 0, err
+	}
+
+	if err := validateColorspace(); err != nil {
+		return 0, 0, err
+	}
+
+	if err := validateCodecs(); err != nil {
+		return 0, 0, err
+	}
+
+	if err := validateCadence(); err != nil {
+		return 0, 0, err
+	}
+
+	if err := validateBitrate(); err != nil {
+		return 0, 0, err
+	}
+
+	if err := setupFFprobeSandbox(); err != nil {
+		return 0, 0, err
+	}
+
+	// DASH segments are fMP4, which only ffprobe decodes; MPEG-TS is handled natively
+	if streamProtocol == streamDASH || compareDASHURL != "" {
+		if err := decoder.CheckFFprobe(); err != nil {
+			return 0, 0, fmt.Errorf("ffprobe check failed: %w", err)
+		}
+	}
+
+	detectFFprobe()
+
+	if err := setupNumberFormat(); err != nil {
+		return 0, 0, fmt.Errorf("invalid number format: %w", err)
+	}
+
+	if err := setupReceiveBuffers(); err != nil {
+		return 0, 0, err
+	}
+
+	if err := setupQUICOffloads(); err != nil {
+		return 0, 0, err
+	}
+
+	if err := setupRequestHeaders(); err != nil {
+		return 0, 0, err
+	}
+
+	if err := setupCMCD(); err != nil {
+		return 0, 0, err
+	}
+
+	if err := setupProxy(); err != nil {
+		return 0, 0, err
+	}
+
+	if err := setupTLS(); err != nil {
+		return 0, 0, err
+	}
+
+	trustSyntheticOrigin()
+
+	if err := setupThrottle(); err != nil {
+		return 0, 0, err
+	}
+
+	if err := setupResolve(); err != nil {
+		return 0, 0, err
+	}
+
+	if err := setupCDNIdentifier(); err != nil {
+		return 0, 0, err
+	}
+
+	if err := validateFreshDNS(); err != nil {
+		return 0, 0, err
+	}
+
+	if err := setupDNSCache(); err != nil {
+		return 0, 0, err
+	}
+
+	variantStrategy, err = parseVariantFlags()
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid variant selection: %w", err)
+	}
+
+	if err := validateSweep(); err != nil {
+		return 0, 0, err
+	}
+
+	if err := validateRedact(); err != nil {
+		return 0, 0, err
+	}
+
+	if err := validateResolvers(); err != nil {
+		return 0, 0, err
+	}
+
+	if err := validateInterfaces(); err != nil {
+		return 0, 0, err
+	}
+
+	if err := validateAllIPs(); err != nil {
+		return 0, 0, err
+	}
+
+	if err := validateWarm(); err != nil {
+		return 0, 0, err
+	}
+
+	if err := validateResumption(); err != nil {
+		return 0, 0, err
+	}
+
+	if err := validateBatch(); err != nil {
+		return 0, 0, err
+	}
+
+	if err := validatePlayer(); err != nil {
+		return 0, 0, err
+	}
+
+	if err := validateSLA(); err != nil {
+		return 0, 0, err
+	}
+
+	if err := validateWatch(); err != nil {
+		return 0, 0, err
+	}
+
+	if err := validateWaterfall(); err != nil {
+		return 0, 0, err
+	}
+
+	if err := validatePercentiles(); err != nil {
+		return 0, 0, err
+	}
+
+	if err := validateConfidence(); err != nil {
+		return 0, 0, err
+	}
+
+	if templatePath != "" {
+		if err := loadTemplate(); err != nil {
+			return 0, 0, err
+		}
+	}
+
+	if err := setupOutput(); err != nil {
+		return 0, 0, err
+	}
+
+	// Parse delay-random if provided
+	var minDelay, maxDelay time.Duration
+
+	if delayRandom != "" {
+		minDelay, maxDelay, err = parseDelayRange(delayRandom)
+		if err != nil {
+			return 0, 0, fmt.Errorf("invalid delay-random format: %w", err)
+		}
+	}
+
+	if zabbixServer != "" && zabbixHost == "" {
+		return 0, 0, errors.New("--zabbix-host is required with --zabbix-server")
+	}
+
+	// Parse per-phase budgets if provided
+	if budgetSpec != "" {
+		phaseBudgets, err = ttff.ParseBudgets(budgetSpec)
+		if err != nil {
+			return 0, 0, fmt.Errorf("invalid budget format: %w", err)
+		}
+	}
+
+	// Retrieve HTTPS records (and the ECH config they carry) before any measurement
+	if useECH || showHTTPSRR || useHTTPSRR {
+		// A host without HTTPS records is only fatal to --ech, which needs their ECH config;
+		// reporting them shows none, and connecting falls back to plain address lookups
+		records, err := lookupHTTPSRecords()
+		if err != nil && (useECH || !errors.Is(err, probe.ErrNoHTTPSRecords)) {
+			return 0, 0, err
+		}
+
+		if showHTTPSRR || verbose {
+			printHTTPSRecords(records)
+		}
+
+		if useECH {
+			echConfigList, err = resolveECHConfig(records)
+			if err != nil {
+				return 0, 0, err
+			}
+		}
+
+		if useHTTPSRR {
+			httpsResolve, err = httpsRecordResolve(records)
+			if err != nil {
+				return 0, 0, err
+			}
+		}
+	}
+
+	warmUpDecoder()
+
+	// Open output sinks last so a setup failure leaves no empty file behind
+	if csvPath != "" {
+		csvWriter, err = sink.NewCSVWriter(csvPath, csvHeader)
+		if err != nil {
+			return 0, 0, err
+		}
+	}
+
+	if harPath != "" {
+		harRecorder = &harCapture{}
+	}
+
+	if len(kafkaBrokers) > 0 {
+		kafkaProducer, err = openKafkaProducer()
+		if err != nil {
+			return 0, 0, err
+		}
+	}
+
+	if err := parseLabels(); err != nil {
+		return 0, 0, err
+	}
+
+	if err := openRunHistory(); err != nil {
+		return 0, 0, err
+	}
+
+	if uploadTarget != "" {
+		if err := prepareUpload(); err != nil {
+			return 0, 0, fmt.Errorf("invalid upload target: %w", err)
+		}
+	}
+
+	return minDelay, maxDelay, nil
 }
 
 // runCompare executes comparison mode between HTTP/1.1-2 and HTTP/3 for full TTFF
@@ -135,7 +692,7 @@ func runCompare(minDelay, maxDelay time.Duration) error {
 			fmt.Println("── HTTP/1.1-2 TTFF Measurement ──")
 		}
 
-		http12Sample, http12ManifestTrace, http12SegmentTrace, err := measureTTFF()
+		http12Sample, http12ManifestTrace, http12SegmentTrace, err := measureSample(context.Background(), url, 0, protocolHTTP12)
 		if err != nil {
 			return fmt.Errorf("HTTP/1.1-2 measurement failed: %w", err)
 		}
@@ -144,20 +701,39 @@ func runCompare(minDelay, maxDelay time.Duration) error {
 			fmt.Println("\n── HTTP/3 TTFF Measurement ──")
 		}
 
-		http3Sample, http3ManifestTrace, http3SegmentTrace, err := measureTTFFHTTP3()
+		http3Sample, http3ManifestTrace, http3SegmentTrace, err := measureSample(context.Background(), url, 0, protocolHTTP3)
 		if err != nil {
 			return fmt.Errorf("HTTP/3 measurement failed: %w", err)
 		}
 
-		printTTFFComparisonResults(url, http12Sample, http3Sample, http12ManifestTrace, http3ManifestTrace, http12SegmentTrace, http3SegmentTrace)
+		if outputTemplate != nil {
+			return renderTemplate()
+		}
+
+		printTTFFComparisonResults(exportURL(url), http12Sample, http3Sample, http12ManifestTrace, http3ManifestTrace, http12SegmentTrace, http3SegmentTrace)
+		printWaterfalls("HTTP/1.1-2 ", []ttff.Sample{http12Sample})
+		printWaterfalls("HTTP/3 ", []ttff.Sample{http3Sample})
+		printShaping()
+		printConfiguration()
+
+		printProtocolWarnings(protocolWarnings("HTTP/3 arm: ", stats.ProtocolCounts([]stats.Sample{http3Sample.Sample}), true))
+		printResumption("HTTP/1.1-2 arm: ", []ttff.Sample{http12Sample})
+		printResumption("HTTP/3 arm: ", []ttff.Sample{http3Sample})
+		printConnections("HTTP/1.1-2 arm: ", []ttff.Sample{http12Sample})
+		printConnections("HTTP/3 arm: ", []ttff.Sample{http3Sample})
+		printReceiveBuffers()
+		printQUICOffloads()
 
 		return nil
 	}
 
 	// Multi-sample comparison mode
-	var http12Samples []stats.Sample
+	var http12Samples []ttff.Sample
 
-	var http3Samples []stats.Sample
+	var http3Samples []ttff.Sample
+
+	http12Aborts := make(map[string]int)
+	http3Aborts := make(map[string]int)
 
 	// Collect HTTP/1.1-2 samples
 	if verbose {
@@ -169,15 +745,21 @@ func runCompare(minDelay, maxDelay time.Duration) error {
 			fmt.Printf("\n── Sample %d/%d ──\n", i+1, samples)
 		}
 
-		sample, _, _, err := measureTTFF()
-		if err != nil {
-			return fmt.Errorf("HTTP/1.1-2 sample %d failed: %w", i+1, err)
-		}
+		sample, _, _, err := measureSample(context.Background(), url, i, protocolHTTP12)
 
-		http12Samples = append(http12Samples, sample)
+		switch {
+		case recordBudgetAbort(http12Aborts, err):
+			if verbose {
+				fmt.Printf("  Aborted: %v\n", err)
+			}
+		case err != nil:
+			return fmt.Errorf("HTTP/1.1-2 sample %d failed: %w", i+1, err)
+		default:
+			http12Samples = append(http12Samples, sample)
 
-		if verbose {
-			fmt.Printf("  TTFF: %s\n", formatDuration(sample.TotalTTFF))
+			if verbose {
+				fmt.Printf("  TTFF: %s\n", formatDuration(sample.TotalTTFF))
+			}
 		}
 
 		// Apply delay between samples
@@ -202,15 +784,21 @@ func runCompare(minDelay, maxDelay time.Duration) error {
 			fmt.Printf("\n── Sample %d/%d ──\n", i+1, samples)
 		}
 
-		sample, _, _, err := measureTTFFHTTP3()
-		if err != nil {
-			return fmt.Errorf("HTTP/3 sample %d failed: %w", i+1, err)
-		}
+		sample, _, _, err := measureSample(context.Background(), url, i, protocolHTTP3)
 
-		http3Samples = append(http3Samples, sample)
+		switch {
+		case recordBudgetAbort(http3Aborts, err):
+			if verbose {
+				fmt.Printf("  Aborted: %v\n", err)
+			}
+		case err != nil:
+			return fmt.Errorf("HTTP/3 sample %d failed: %w", i+1, err)
+		default:
+			http3Samples = append(http3Samples, sample)
 
-		if verbose {
-			fmt.Printf("  TTFF: %s\n", formatDuration(sample.TotalTTFF))
+			if verbose {
+				fmt.Printf("  TTFF: %s\n", formatDuration(sample.TotalTTFF))
+			}
 		}
 
 		// Apply delay between samples
@@ -225,219 +813,240 @@ func runCompare(minDelay, maxDelay time.Duration) error {
 		}
 	}
 
-	printMultiSampleTTFFComparisonResults(url, http12Samples, http3Samples)
-
-	return nil
-}
-
-// measureManifestTTFB fetches the manifest using HTTP/1.1-2 and returns timing
-func measureManifestTTFB() (*probe.Trace, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), timeout)
-	defer cancel()
-
-	client := probe.NewHTTPClient(timeout)
+	if len(http12Samples) == 0 || len(http3Samples) == 0 {
+		printBudgetSummary("HTTP/1.1-2 arm: ", http12Aborts, samples)
+		printBudgetSummary("HTTP/3 arm: ", http3Aborts, samples)
 
-	if verbose {
-		fmt.Printf("Fetching manifest: %s\n", url)
+		return fmt.Errorf("every sample of a comparison arm was aborted: %w", ttff.ErrBudgetExceeded)
 	}
 
-	result, err := probe.FetchPlaylist(ctx, url, client)
-	if err != nil {
-		return nil, fmt.Errorf("failed to fetch playlist: %w", err)
+	if outputTemplate != nil {
+		return renderTemplate()
 	}
 
-	return result.Trace, nil
+	printMultiSampleTTFFComparisonResults(exportURL(url), http12Samples, http3Samples)
+	printWaterfalls("HTTP/1.1-2 ", http12Samples)
+	printWaterfalls("HTTP/3 ", http3Samples)
+	printShaping()
+	printConfiguration()
+	printBudgetSummary("HTTP/1.1-2 arm: ", http12Aborts, samples)
+	printBudgetSummary("HTTP/3 arm: ", http3Aborts, samples)
+
+	warnings := protocolWarnings("HTTP/1.1-2 arm: ", stats.ProtocolCounts(ttff.Timings(http12Samples)), false)
+	warnings = append(warnings, protocolWarnings("HTTP/3 arm: ", stats.ProtocolCounts(ttff.Timings(http3Samples)), true)...)
+
+	printProtocolWarnings(warnings)
+	printResumption("HTTP/1.1-2 arm: ", http12Samples)
+	printResumption("HTTP/3 arm: ", http3Samples)
+	printConnections("HTTP/1.1-2 arm: ", http12Samples)
+	printConnections("HTTP/3 arm: ", http3Samples)
+	printReceiveBuffers()
+	printQUICOffloads()
+
+	return nil
 }
 
-// measureManifestTTFBHTTP3 fetches the manifest using HTTP/3 and returns timing
-func measureManifestTTFBHTTP3() (*probe.Trace, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), timeout)
-	defer cancel()
+// sampleHooksMu serializes the per-sample sinks, which concurrent batch workers share
+var sampleHooksMu sync.Mutex
 
-	client := probe.NewHTTP3Client(timeout)
+// measureSample performs one measurement of target over the given protocol and runs per-sample hooks
+func measureSample(ctx context.Context, target string, index int, protocol string) (ttff.Sample, *probe.Trace, *probe.Trace, error) {
+	bundle := newReplayBundle()
+	ctx, harPage := startHARPage(ctx, target, index, protocol)
 
-	if verbose {
-		fmt.Printf("Fetching manifest (HTTP/3): %s\n", url)
+	var (
+		sample        ttff.Sample
+		manifestTrace *probe.Trace
+		segmentTrace  *probe.Trace
+		err           error
+	)
+
+	resetThrottle()
+
+	err = primeSession(ctx, target, protocol)
+
+	if err == nil {
+		sample, manifestTrace, segmentTrace, err = measureTTFF(ctx, target, bundle, protocol == protocolHTTP3)
 	}
 
-	result, err := probe.FetchPlaylistHTTP3(ctx, url, client)
-	if err != nil {
-		return nil, fmt.Errorf("failed to fetch playlist: %w", err)
+	// The player joins after the probe so both see the same CDN cache state
+	if err == nil && playerCommand != "" {
+		measurePlayerJoin(ctx, target, &sample)
 	}
 
-	return result.Trace, nil
-}
+	harPage.finish(sample, err)
 
-// measureTTFF performs a single TTFF measurement
-func measureTTFF() (stats.Sample, *probe.Trace, *probe.Trace, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), timeout)
-	defer cancel()
+	// Identifying the edges may reverse-resolve their addresses, so it follows the timed phases
+	if err == nil {
+		sample.ManifestEdge = identifyEdge(ctx, manifestTrace)
+		sample.SegmentEdge = identifyEdge(ctx, segmentTrace)
+	}
 
-	client := probe.NewHTTPClient(timeout)
+	sampleHooksMu.Lock()
+	defer sampleHooksMu.Unlock()
 
-	// Fetch initial playlist
-	if verbose {
-		fmt.Printf("Fetching playlist: %s\n", url)
+	// Capture what the probe saw for failed or slow samples
+	if shouldWriteReplay(sample, err) {
+		dir, writeErr := writeReplayBundle(ctx, target, index, protocol, bundle, sample, err)
+		if writeErr != nil {
+			fmt.Fprintf(os.Stderr, "warning: %v\n", writeErr)
+		} else if verbose {
+			fmt.Printf("  Replay bundle written to %s\n", dir)
+		}
 	}
 
-	result, err := probe.FetchPlaylist(ctx, url, client)
-	if err != nil {
-		return stats.Sample{}, nil, nil, fmt.Errorf("failed to fetch playlist: %w", err)
+	if historyStore != nil {
+		recordHistory(target, protocol, sample, err)
 	}
 
-	manifestTrace := result.Trace
-
-	baseURL, err := probe.GetBaseURL(url)
 	if err != nil {
-		return stats.Sample{}, nil, nil, fmt.Errorf("failed to get base URL: %w", err)
+		return ttff.Sample{}, nil, nil, err
 	}
 
-	// Handle master playlist by fetching media playlist
-	if result.Master != nil {
-		variantURL, err := probe.GetFirstVariantURL(result.Master, baseURL)
-		if err != nil {
-			return stats.Sample{}, nil, nil, fmt.Errorf("failed to get variant URL: %w", err)
-		}
+	sample.ManifestHandshake = manifestTrace.Handshake
+	sample.SegmentHandshake = segmentTrace.Handshake
+	sample.ManifestTLS = manifestTrace.TLS
+	sample.SegmentTLS = segmentTrace.TLS
+	sample.ManifestConn = manifestTrace.Conn
+	sample.Redirects = manifestTrace.RedirectTime
+	sample.SegmentConn = segmentTrace.Conn
+	sample.ManifestCDN = manifestTrace.CDN
+	sample.SegmentCDN = segmentTrace.CDN
 
-		if verbose {
-			fmt.Printf("Fetching media playlist: %s\n", variantURL)
-		}
+	if verbose {
+		printNegotiated(sample)
+		printSampleConnections(sample)
+		printSampleCDN(sample)
+	}
 
-		result, err = probe.FetchPlaylist(ctx, variantURL, client)
-		if err != nil {
-			return stats.Sample{}, nil, nil, fmt.Errorf("failed to fetch media playlist: %w", err)
-		}
+	observeReceiveBuffers(protocol, manifestTrace, segmentTrace)
+	observeQUICOffloads(manifestTrace, segmentTrace)
+	afterSample(target, index, protocol, sample)
 
-		baseURL, err = probe.GetBaseURL(variantURL)
-		if err != nil {
-			return stats.Sample{}, nil, nil, fmt.Errorf("failed to get variant base URL: %w", err)
-		}
-	}
+	return sample, manifestTrace, segmentTrace, nil
+}
 
-	segmentURL, err := probe.GetFirstSegmentURL(result.Media, baseURL)
-	if err != nil {
-		return stats.Sample{}, nil, nil, fmt.Errorf("failed to get segment URL: %w", err)
+// afterSample runs per-sample reporting hooks once a measurement of target completes
+func afterSample(target string, index int, protocol string, sample ttff.Sample) {
+	if csvWriter != nil {
+		writeCSVRow(index, protocol, sample)
 	}
 
-	if verbose {
-		fmt.Printf("Downloading segment: %s\n", segmentURL)
+	if beaconURL != "" {
+		emitBeacon(target, index, protocol, sample)
 	}
 
-	// Download segment
-	segmentData, segmentTrace, err := probe.DownloadSegment(ctx, segmentURL, client)
-	if err != nil {
-		return stats.Sample{}, nil, nil, fmt.Errorf("failed to download segment: %w", err)
+	if zabbixServer != "" {
+		emitZabbix(sample)
 	}
 
-	if verbose {
-		fmt.Println("Detecting first frame...")
+	if kafkaProducer != nil {
+		emitKafka(target, index, protocol, sample)
 	}
 
-	// Detect first frame
-	frameDetection, err := decoder.DetectFirstFrame(ctx, segmentData)
-	if err != nil {
-		return stats.Sample{}, nil, nil, fmt.Errorf("failed to detect first frame: %w", err)
+	if influxURL != "" {
+		emitInflux(target, protocol, sample)
 	}
 
-	sample := stats.Sample{
-		DNSLookup:      manifestTrace.DNSLookup,
-		TCPConnect:     manifestTrace.TCPConnect,
-		TLSHandshake:   manifestTrace.TLSHandshake,
-		QUICHandshake:  0,
-		ManifestTTFB:   manifestTrace.TTFB,
-		ManifestTotal:  manifestTrace.Total,
-		SegmentTotal:   segmentTrace.Total,
-		FrameDetection: frameDetection,
-		TotalTTFF:      manifestTrace.Total + segmentTrace.Total + frameDetection,
+	if runReport != nil {
+		addReportSample(index, protocol, sample)
 	}
 
-	return sample, manifestTrace, segmentTrace, nil
+	if outputTemplate != nil {
+		addTemplateSample(target, index, protocol, sample)
+	}
 }
 
-// measureTTFFHTTP3 performs a single TTFF measurement using HTTP/3
-func measureTTFFHTTP3() (stats.Sample, *probe.Trace, *probe.Trace, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+// measureManifestTTFB fetches the target manifest using HTTP/1.1-2 and returns timing
+func measureManifestTTFB(ctx context.Context, target string) (*probe.Trace, error) {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
 	defer cancel()
 
-	client := probe.NewHTTP3Client(timeout)
+	client := newHTTPClient()
 
-	// Fetch initial playlist
 	if verbose {
-		fmt.Printf("Fetching playlist (HTTP/3): %s\n", url)
+		fmt.Printf("Fetching manifest: %s\n", target)
 	}
 
-	result, err := probe.FetchPlaylistHTTP3(ctx, url, client)
+	result, err := probe.FetchPlaylist(ctx, target, client)
 	if err != nil {
-		return stats.Sample{}, nil, nil, fmt.Errorf("failed to fetch playlist: %w", err)
+		return nil, fmt.Errorf("failed to fetch playlist: %w", err)
 	}
 
-	manifestTrace := result.Trace
+	return result.Trace, nil
+}
+
+// measureManifestTTFBHTTP3 fetches the target manifest using HTTP/3 and returns timing
+func measureManifestTTFBHTTP3(ctx context.Context, target string) (*probe.Trace, error) {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	client := newHTTP3Client()
+
+	if verbose {
+		fmt.Printf("Fetching manifest (HTTP/3): %s\n", target)
+	}
 
-	baseURL, err := probe.GetBaseURL(url)
+	result, err := probe.FetchPlaylistHTTP3(ctx, target, client)
 	if err != nil {
-		return stats.Sample{}, nil, nil, fmt.Errorf("failed to get base URL: %w", err)
+		return nil, fmt.Errorf("failed to fetch playlist: %w", err)
 	}
 
-	// Handle master playlist by fetching media playlist
-	if result.Master != nil {
-		variantURL, err := probe.GetFirstVariantURL(result.Master, baseURL)
-		if err != nil {
-			return stats.Sample{}, nil, nil, fmt.Errorf("failed to get variant URL: %w", err)
-		}
+	return result.Trace, nil
+}
 
-		if verbose {
-			fmt.Printf("Fetching media playlist (HTTP/3): %s\n", variantURL)
-		}
+// measureTTFF performs a single TTFF measurement of target through the pipeline the library
+// shares, then runs the checks only the CLI offers on the measured segment
+func measureTTFF(ctx context.Context, target string, bundle *replayBundle, useHTTP3 bool) (ttff.Sample, *probe.Trace, *probe.Trace, error) {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
 
-		result, err = probe.FetchPlaylistHTTP3(ctx, variantURL, client)
-		if err != nil {
-			return stats.Sample{}, nil, nil, fmt.Errorf("failed to fetch media playlist: %w", err)
-		}
+	client := newHTTPClient()
 
-		baseURL, err = probe.GetBaseURL(variantURL)
-		if err != nil {
-			return stats.Sample{}, nil, nil, fmt.Errorf("failed to get variant base URL: %w", err)
-		}
+	if useHTTP3 {
+		client = newHTTP3Client()
+	} else if err := warmConnection(ctx, client, target); err != nil {
+		return ttff.Sample{}, nil, nil, err
 	}
 
-	segmentURL, err := probe.GetFirstSegmentURL(result.Media, baseURL)
+	m, err := newPipeline(client, useHTTP3, bundle).Measure(ctx, target)
 	if err != nil {
-		return stats.Sample{}, nil, nil, fmt.Errorf("failed to get segment URL: %w", err)
+		return ttff.Sample{}, nil, nil, err
 	}
 
-	if verbose {
-		fmt.Printf("Downloading segment (HTTP/3): %s\n", segmentURL)
+	sample := m.Sample
+
+	// DASH and LL-HLS measurements end at the first frame
+	if streamProtocol == streamDASH || lowLatency {
+		return sample, m.Manifest, m.Segment, nil
 	}
 
-	// Download segment
-	segmentData, segmentTrace, err := probe.DownloadSegmentHTTP3(ctx, segmentURL, client)
-	if err != nil {
-		return stats.Sample{}, nil, nil, fmt.Errorf("failed to download segment: %w", err)
+	// Audio is measured after the video path, reusing its connections as a player would
+	if audioMode {
+		if err := measureAudio(ctx, client, useHTTP3, bundle, m.Variant, m.MasterBaseURL, m.SegmentData, &sample); err != nil {
+			return ttff.Sample{}, nil, nil, err
+		}
 	}
 
-	if verbose {
-		fmt.Println("Detecting first frame...")
+	if subtitleMode {
+		if err := measureSubtitles(ctx, client, useHTTP3, bundle, m.Variant, m.MasterBaseURL, m.SegmentData, &sample); err != nil {
+			return ttff.Sample{}, nil, nil, err
+		}
 	}
 
-	// Detect first frame
-	frameDetection, err := decoder.DetectFirstFrame(ctx, segmentData)
-	if err != nil {
-		return stats.Sample{}, nil, nil, fmt.Errorf("failed to detect first frame: %w", err)
+	if colorspaceMode || codecMode {
+		inspectVideo(ctx, m.Variant, m.SegmentData, &sample)
 	}
 
-	sample := stats.Sample{
-		DNSLookup:      manifestTrace.DNSLookup,
-		TCPConnect:     0,
-		TLSHandshake:   0,
-		QUICHandshake:  manifestTrace.QUICHandshake,
-		ManifestTTFB:   manifestTrace.TTFB,
-		ManifestTotal:  manifestTrace.Total,
-		SegmentTotal:   segmentTrace.Total,
-		FrameDetection: frameDetection,
-		TotalTTFF:      manifestTrace.Total + segmentTrace.Total + frameDetection,
+	if cadenceMode {
+		checkCadence(ctx, m.Variant, m.SegmentData, &sample)
 	}
 
-	return sample, manifestTrace, segmentTrace, nil
+	if bitrateMode {
+		checkBitrate(ctx, m.Variant, m.Media, m.SegmentData, &sample)
+	}
+
+	return sample, m.Manifest, m.Segment, nil
 }
 
 // parseDelayRange parses a delay range string like "2s-8s"
@@ -480,22 +1089,90 @@ func getDelay(minDelay, maxDelay time.Duration) time.Duration {
 }
 
 // printResults outputs the timing breakdown to stdout
-func printResults(url string, manifest, segment *probe.Trace, frame, total time.Duration) {
+func printResults(url string, manifest, segment *probe.Trace, sample ttff.Sample) {
 	fmt.Printf("vtrace results for: %s\n", url)
 	fmt.Println("────────────────────────────────────────────────────")
 	fmt.Printf("DNS Lookup:                  %12s\n", formatDuration(manifest.DNSLookup))
 	fmt.Printf("TCP Connect:                 %12s\n", formatDuration(manifest.TCPConnect))
 	fmt.Printf("TLS Handshake:               %12s\n", formatDuration(manifest.TLSHandshake))
+
+	if verbose {
+		printTLSPhases(manifest.TLSPhases)
+	}
+
+	if sample.Redirects > 0 {
+		fmt.Printf("Redirects:                   %12s\n", formatDuration(sample.Redirects))
+	}
+
 	fmt.Printf("Manifest TTFB:               %12s\n", formatDuration(manifest.TTFB))
-	fmt.Printf("Segment Download:            %12s\n", formatDuration(segment.Total))
-	fmt.Printf("Frame Detection:             %12s\n", formatDuration(frame))
+	if sample.BlockingReload > 0 {
+		fmt.Printf("Blocking Reload:             %12s\n", formatDuration(sample.BlockingReload))
+	}
+
+	if sample.KeyFetch > 0 {
+		fmt.Printf("Key Fetch:                   %12s\n", formatDuration(sample.KeyFetch))
+	}
+
+	if sample.InitSegment > 0 {
+		fmt.Printf("Init Segment:                %12s\n", formatDuration(sample.InitSegment))
+	}
+
+	fmt.Printf("%-29s%12s\n", segmentPhaseLabel(), formatDuration(sample.SegmentTotal))
+	fmt.Printf("Frame Detection:             %12s\n", formatDuration(sample.FrameDetection))
+
+	if sample.AudioPlaylist > 0 {
+		fmt.Printf("Audio Playlist:              %12s\n", formatDuration(sample.AudioPlaylist))
+		fmt.Printf("Audio Segment:               %12s\n", formatDuration(sample.AudioSegment))
+	}
+
+	if sample.TotalTTFA > 0 {
+		fmt.Printf("Audio Detection:             %12s\n", formatDuration(sample.AudioDetection))
+	}
+
 	fmt.Println("────────────────────────────────────────────────────")
-	fmt.Printf("Total TTFF:                  %12s\n", formatDuration(total))
+	fmt.Printf("Total TTFF:                  %12s\n", formatDuration(sample.TotalTTFF))
+
+	if sample.TotalTTFA > 0 {
+		fmt.Printf("Total TTFA:                  %12s\n", formatDuration(sample.TotalTTFA))
+	}
+
+	printLiveEdge(sample)
+
+	if sample.PlayerJoin > 0 {
+		fmt.Printf("Player Join:                 %12s\n", formatDuration(sample.PlayerJoin))
+		fmt.Printf("Player - TTFF:               %12s\n", formatDelta(sample.TotalTTFF, sample.PlayerJoin))
+	}
+
+	printSegmentDownloads([]ttff.Sample{sample})
+	printWaterfalls("", []ttff.Sample{sample})
+	printThroughput([]ttff.Sample{sample})
+	printSegmentProgress([]ttff.Sample{sample})
+	printChunkedTransfer([]ttff.Sample{sample})
+	printConnectionMode(1)
+	printDNSCache()
+	printShaping()
+	printConfiguration()
+	printConnections("", []ttff.Sample{sample})
+	printCDN([]ttff.Sample{sample})
+	printResumption("", []ttff.Sample{sample})
+	printFrameDecoders([]ttff.Sample{sample})
+	printDASHTiming([]ttff.Sample{sample})
+	printSubtitleChecks([]ttff.Sample{sample})
+	printColorspaceChecks([]ttff.Sample{sample})
+	printCodecChecks([]ttff.Sample{sample})
+	printCadenceChecks([]ttff.Sample{sample})
+	printBitrateChecks([]ttff.Sample{sample})
+
+	printConnectAttempts("manifest", manifest)
+	printConnectAttempts("segment", segment)
+	printRedirects("manifest", manifest)
+	printRedirects("segment", segment)
 }
 
 // printMultiSampleResults outputs aggregate statistics for multiple samples
-func printMultiSampleResults(url string, allSamples []stats.Sample) {
-	ttffDurations := stats.ExtractTotalTTFF(allSamples)
+func printMultiSampleResults(url string, allSamples []ttff.Sample) {
+	timings := ttff.Timings(allSamples)
+	ttffDurations := stats.ExtractTotalTTFF(timings)
 	outliers := stats.DetectOutliers(ttffDurations)
 
 	// Determine which durations to use for stats
@@ -512,30 +1189,74 @@ func printMultiSampleResults(url string, allSamples []stats.Sample) {
 	}
 
 	fmt.Printf("\nvtrace results for: %s (%d samples)\n", url, len(allSamples))
-	fmt.Println("──────────────────────────────────────────────────────────────────────────────────")
-	fmt.Printf("%-20s %12s %12s %12s %12s %12s\n", "", avgLabel, "Min", "Max", "Median", "StdDev")
-	fmt.Println("──────────────────────────────────────────────────────────────────────────────────")
+	fmt.Println(multiSampleRule())
+	fmt.Printf("%-20s %12s %12s %12s %12s %12s%s\n", "", avgLabel, "Min", "Max", "Median", "StdDev", percentileHeader())
+	fmt.Println(multiSampleRule())
+
+	printStatRow("DNS Lookup:", stats.ExtractDNSLookup(timings), outliers)
+	if queries := dnsQueries(); len(queries) > 1 {
+		printStatRow("DNS Query:", queries, nil)
+	}
+
+	printStatRow("TCP Connect:", stats.ExtractTCPConnect(timings), outliers)
+	printStatRow("TLS Handshake:", stats.ExtractTLSHandshake(timings), outliers)
+	if anyNonZero(stats.ExtractRedirects(timings)) {
+		printStatRow("Redirects:", stats.ExtractRedirects(timings), outliers)
+	}
+
+	printStatRow("Manifest TTFB:", stats.ExtractManifestTTFB(timings), outliers)
+	if lowLatency {
+		printStatRow("Blocking Reload:", stats.ExtractBlockingReload(timings), outliers)
+	}
 
-	printStatRow("DNS Lookup:", stats.ExtractDNSLookup(allSamples), outliers)
-	printStatRow("TCP Connect:", stats.ExtractTCPConnect(allSamples), outliers)
-	printStatRow("TLS Handshake:", stats.ExtractTLSHandshake(allSamples), outliers)
-	printStatRow("Manifest TTFB:", stats.ExtractManifestTTFB(allSamples), outliers)
-	printStatRow("Segment Download:", stats.ExtractSegmentTotal(allSamples), outliers)
-	printStatRow("Frame Detection:", stats.ExtractFrameDetection(allSamples), outliers)
+	if anyNonZero(stats.ExtractKeyFetch(timings)) {
+		printStatRow("Key Fetch:", stats.ExtractKeyFetch(timings), outliers)
+	}
+
+	if anyNonZero(stats.ExtractInitSegment(timings)) {
+		printStatRow("Init Segment:", stats.ExtractInitSegment(timings), outliers)
+	}
+
+	printStatRow(segmentPhaseLabel(), stats.ExtractSegmentTotal(timings), outliers)
+	printStatRow("Frame Detection:", stats.ExtractFrameDetection(timings), outliers)
+
+	if anyNonZero(stats.ExtractAudioPlaylist(timings)) {
+		printStatRow("Audio Playlist:", stats.ExtractAudioPlaylist(timings), outliers)
+		printStatRow("Audio Segment:", stats.ExtractAudioSegment(timings), outliers)
+	}
+
+	if audioMode {
+		printStatRow("Audio Detection:", stats.ExtractAudioDetection(timings), outliers)
+	}
 
-	fmt.Println("──────────────────────────────────────────────────────────────────────────────────")
+	fmt.Println(multiSampleRule())
 
-	ttffStats := stats.ComputeStats(durationsForStats)
+	ttffStats := computeRowStats(durationsForStats)
 
-	fmt.Printf("%-20s %12s %12s %12s %12s %12s\n",
+	fmt.Printf("%-20s %12s %12s %12s %12s %12s%s\n",
 		"Total TTFF:",
 		formatDuration(ttffStats.Mean),
 		formatDuration(ttffStats.Min),
 		formatDuration(ttffStats.Max),
 		formatDuration(ttffStats.Median),
 		formatDuration(ttffStats.StdDev),
+		percentileCells(ttffStats),
 	)
 
+	if audioMode {
+		printStatRow("Total TTFA:", stats.ExtractTotalTTFA(timings), outliers)
+	}
+
+	// The live edge distance is a position, not a phase, so TTFF outliers do not apply
+	if liveEdge {
+		printStatRow("Live Edge Distance:", stats.ExtractLiveEdgeDistance(timings), nil)
+	}
+
+	// Only successful joins count; TTFF outliers do not apply to the player's timings
+	if joins := playerJoins(allSamples); len(joins) > 0 {
+		printStatRow("Player Join:", joins, nil)
+	}
+
 	// Print outlier information
 	if len(outliers) > 0 {
 		fmt.Println()
@@ -562,6 +1283,48 @@ func printMultiSampleResults(url string, allSamples []stats.Sample) {
 
 		fmt.Println()
 	}
+
+	printSegmentDownloads(allSamples)
+	printWaterfalls("", allSamples)
+	printThroughput(allSamples)
+	printSegmentProgress(allSamples)
+	printChunkedTransfer(allSamples)
+	printConnectionMode(len(allSamples))
+	printDNSCache()
+	printShaping()
+	printConfiguration()
+	printConnections("", allSamples)
+	printCDN(allSamples)
+	printResumption("", allSamples)
+	printFrameDecoders(allSamples)
+	printDASHTiming(allSamples)
+	printSubtitleChecks(allSamples)
+	printColorspaceChecks(allSamples)
+	printCodecChecks(allSamples)
+	printCadenceChecks(allSamples)
+	printBitrateChecks(allSamples)
+	printProtocolWarnings(protocolWarnings("", stats.ProtocolCounts(timings), false))
+
+	failed := make([]int, len(allSamples))
+
+	for i, sample := range allSamples {
+		failed[i] = sample.FailedConnects
+	}
+
+	printFailedConnectSummary(failed)
+}
+
+// anyNonZero reports whether an optional phase took time in any sample
+func anyNonZero(durationSets ...[]time.Duration) bool {
+	for _, durations := range durationSets {
+		for _, d := range durations {
+			if d > 0 {
+				return true
+			}
+		}
+	}
+
+	return false
 }
 
 // printStatRow prints a single row of statistics
@@ -572,35 +1335,149 @@ func printStatRow(label string, durations []time.Duration, outliers []stats.Outl
 		durationsForStats = stats.ExcludeOutliers(durations, outliers)
 	}
 
-	s := stats.ComputeStats(durationsForStats)
+	s := computeRowStats(durationsForStats)
 
-	fmt.Printf("%-20s %12s %12s %12s %12s %12s\n",
+	fmt.Printf("%-20s %12s %12s %12s %12s %12s%s\n",
 		label,
 		formatDuration(s.Mean),
 		formatDuration(s.Min),
 		formatDuration(s.Max),
 		formatDuration(s.Median),
 		formatDuration(s.StdDev),
+		percentileCells(s),
 	)
 }
 
-// formatDuration formats a duration as milliseconds with 2 decimal places
-func formatDuration(d time.Duration) string {
-	ms := float64(d) / float64(time.Millisecond)
+// protocolWarnings describes mixed or unexpected negotiated HTTP versions across samples
+func protocolWarnings(label string, counts map[string]int, expectHTTP3 bool) []string {
+	var warnings []string
 
-	return fmt.Sprintf("%.2fms", ms)
+	protos := make([]string, 0, len(counts))
+
+	for proto := range counts {
+		protos = append(protos, proto)
+	}
+
+	sort.Strings(protos)
+
+	// Mixed protocols invalidate direct sample comparisons
+	if len(protos) > 1 {
+		parts := make([]string, len(protos))
+
+		for i, proto := range protos {
+			parts[i] = fmt.Sprintf("%s (%d)", proto, counts[proto])
+		}
+
+		warnings = append(warnings, fmt.Sprintf("%sprotocol inconsistency across requests: %s", label, strings.Join(parts, ", ")))
+	}
+
+	// HTTP/3 attempts that were answered over another protocol
+	if expectHTTP3 {
+		for _, proto := range protos {
+			if proto != "HTTP/3.0" {
+				warnings = append(warnings, fmt.Sprintf("%sHTTP/3 requests answered over %s (%d)", label, proto, counts[proto]))
+			}
+		}
+	}
+
+	return warnings
 }
 
-// formatDelta formats the difference between two durations with sign
-func formatDelta(http12, http3 time.Duration) string {
-	delta := http3 - http12
-	ms := float64(delta) / float64(time.Millisecond)
+// printProtocolWarnings prints protocol consistency warnings, if any
+func printProtocolWarnings(warnings []string) {
+	if len(warnings) == 0 {
+		return
+	}
+
+	fmt.Println()
+
+	for _, w := range warnings {
+		fmt.Printf("Warning: %s\n", w)
+	}
+}
+
+// printConnectAttempts lists socket connect attempts when more than one was made or any failed
+func printConnectAttempts(label string, trace *probe.Trace) {
+	if len(trace.Connects) < 2 && trace.FailedConnects() == 0 {
+		return
+	}
+
+	fmt.Printf("\nConnect attempts (%s):\n", label)
+
+	for i, c := range trace.Connects {
+		outcome := "ok"
+
+		if c.Err != "" {
+			outcome = "failed: " + c.Err
+		}
+
+		fmt.Printf("  %d. %-4s %-40s %12s  %s\n", i+1, c.Network, exportAddr(c.Addr), formatDuration(c.Duration), outcome)
+	}
+}
+
+// printRedirects lists the redirect chain followed before a request with the timing of each hop
+func printRedirects(label string, trace *probe.Trace) {
+	if len(trace.Redirects) == 0 {
+		return
+	}
+
+	fmt.Printf("\nRedirects (%s):\n", label)
+
+	for i, hop := range trace.Redirects {
+		fmt.Printf("  %d. %d %s\n", i+1, hop.StatusCode, exportURL(hop.URL))
+		// HTTP/3 hops set up transport and encryption in one QUIC handshake
+		if hop.Trace.QUICHandshake > 0 {
+			fmt.Printf("     DNS %s  QUIC %s  TTFB %s  Total %s\n", formatDuration(hop.Trace.DNSLookup), formatDuration(hop.Trace.QUICHandshake), formatDuration(hop.Trace.TTFB), formatDuration(hop.Trace.Total))
+
+			continue
+		}
 
-	if delta >= 0 {
-		return fmt.Sprintf("+%.2fms", ms)
+		fmt.Printf("     DNS %s  TCP %s  TLS %s  TTFB %s  Total %s\n", formatDuration(hop.Trace.DNSLookup), formatDuration(hop.Trace.TCPConnect), formatDuration(hop.Trace.TLSHandshake), formatDuration(hop.Trace.TTFB), formatDuration(hop.Trace.Total))
 	}
 
-	return fmt.Sprintf("%.2fms", ms)
+	fmt.Printf("  -> %s (%s in redirects)\n", exportURL(trace.Redirects[len(trace.Redirects)-1].Location), formatDuration(trace.RedirectTime))
+}
+
+// printFailedConnectSummary reports failed connect attempts across samples
+func printFailedConnectSummary(failedPerSample []int) {
+	total := 0
+	affected := 0
+
+	for _, n := range failedPerSample {
+		total += n
+
+		if n > 0 {
+			affected++
+		}
+	}
+
+	if total == 0 {
+		return
+	}
+
+	fmt.Printf("\nFailed connect attempts: %d across %d of %d samples\n", total, affected, len(failedPerSample))
+}
+
+// printTLSPhases prints the message-level TLS handshake breakdown when available
+func printTLSPhases(phases probe.TLSPhases) {
+	if phases == (probe.TLSPhases{}) {
+		return
+	}
+
+	fmt.Printf("  ClientHello Sent:          %12s\n", formatDuration(phases.ClientHello))
+	fmt.Printf("  ServerHello Received:      %12s\n", formatDuration(phases.ServerHello))
+	fmt.Printf("  Certificate Flight:        %12s\n", formatDuration(phases.Certificate))
+	fmt.Printf("  Finished:                  %12s\n", formatDuration(phases.Finished))
+}
+
+// formatDuration formats a duration as milliseconds in the configured number format
+func formatDuration(d time.Duration) string {
+	return numberFormat.Millis(d)
+}
+
+// formatDelta formats the difference between two durations with sign
+func formatDelta(http12, http3 time.Duration) string {
+	return numberFormat.SignedMillis(http3 - http12)
 }
 
 // printManifestComparisonResults outputs side-by-side HTTP/1.1-2 vs HTTP/3 manifest comparison
@@ -725,7 +1602,7 @@ func extractTraceDurations(traces []*probe.Trace, extractor func(*probe.Trace) t
 }
 
 // printTTFFComparisonResults outputs side-by-side HTTP/1.1-2 vs HTTP/3 TTFF comparison
-func printTTFFComparisonResults(url string, http12Sample, http3Sample stats.Sample, http12Manifest, http3Manifest, http12Segment, http3Segment *probe.Trace) {
+func printTTFFComparisonResults(url string, http12Sample, http3Sample ttff.Sample, http12Manifest, http3Manifest, http12Segment, http3Segment *probe.Trace) {
 	fmt.Printf("vtrace TTFF comparison for: %s\n", url)
 	fmt.Println("────────────────────────────────────────────────────────────────────")
 	fmt.Printf("%-20s %14s %14s %14s\n", "", "HTTP/1.1-2", "HTTP/3", "Delta")
@@ -760,11 +1637,28 @@ func printTTFFComparisonResults(url string, http12Sample, http3Sample stats.Samp
 		formatDuration(http3Manifest.TTFB),
 		formatDelta(http12Manifest.TTFB, http3Manifest.TTFB),
 	)
+	if http12Sample.KeyFetch > 0 || http3Sample.KeyFetch > 0 {
+		fmt.Printf("%-20s %14s %14s %14s\n",
+			"Key Fetch:",
+			formatDuration(http12Sample.KeyFetch),
+			formatDuration(http3Sample.KeyFetch),
+			formatDelta(http12Sample.KeyFetch, http3Sample.KeyFetch),
+		)
+	}
+
+	if http12Sample.InitSegment > 0 || http3Sample.InitSegment > 0 {
+		fmt.Printf("%-20s %14s %14s %14s\n",
+			"Init Segment:",
+			formatDuration(http12Sample.InitSegment),
+			formatDuration(http3Sample.InitSegment),
+			formatDelta(http12Sample.InitSegment, http3Sample.InitSegment),
+		)
+	}
 	fmt.Printf("%-20s %14s %14s %14s\n",
-		"Segment Download:",
-		formatDuration(http12Segment.Total),
-		formatDuration(http3Segment.Total),
-		formatDelta(http12Segment.Total, http3Segment.Total),
+		segmentPhaseLabel(),
+		formatDuration(http12Sample.SegmentTotal),
+		formatDuration(http3Sample.SegmentTotal),
+		formatDelta(http12Sample.SegmentTotal, http3Sample.SegmentTotal),
 	)
 	fmt.Printf("%-20s %14s %14s %14s\n",
 		"Frame Detection:",
@@ -779,32 +1673,36 @@ func printTTFFComparisonResults(url string, http12Sample, http3Sample stats.Samp
 		formatDuration(http3Sample.TotalTTFF),
 		formatDelta(http12Sample.TotalTTFF, http3Sample.TotalTTFF),
 	)
+
+	if audioMode {
+		fmt.Printf("%-20s %14s %14s %14s\n",
+			"Total TTFA:",
+			formatDuration(http12Sample.TotalTTFA),
+			formatDuration(http3Sample.TotalTTFA),
+			formatDelta(http12Sample.TotalTTFA, http3Sample.TotalTTFA),
+		)
+	}
 }
 
 // printMultiSampleTTFFComparisonResults outputs aggregate stats for HTTP/1.1-2 vs HTTP/3 TTFF
-func printMultiSampleTTFFComparisonResults(url string, http12Samples, http3Samples []stats.Sample) {
-	fmt.Printf("\nvtrace TTFF comparison for: %s (%d samples each)\n", url, len(http12Samples))
-	fmt.Println("────────────────────────────────────────────────────────────────────")
-	fmt.Printf("%-20s %14s %14s %14s\n", "", "HTTP/1.1-2", "HTTP/3", "Delta")
-	fmt.Println("────────────────────────────────────────────────────────────────────")
-
-	// DNS Lookup
-	http12DNS := stats.ExtractDNSLookup(http12Samples)
-	http3DNS := stats.ExtractDNSLookup(http3Samples)
+func printMultiSampleTTFFComparisonResults(url string, http12Samples, http3Samples []ttff.Sample) {
+	http12Timings := ttff.Timings(http12Samples)
+	http3Timings := ttff.Timings(http3Samples)
+
+	// Budget aborts can leave the arms with different sample counts
+	if len(http12Samples) == len(http3Samples) {
+		fmt.Printf("\nvtrace TTFF comparison for: %s (%d samples each)\n", url, len(http12Samples))
+	} else {
+		fmt.Printf("\nvtrace TTFF comparison for: %s (%d HTTP/1.1-2, %d HTTP/3 samples)\n", url, len(http12Samples), len(http3Samples))
+	}
+	fmt.Println(compareRule)
+	fmt.Printf("%-20s %14s %14s %14s %-3s %8s\n", "", "HTTP/1.1-2", "HTTP/3", "Delta", "", "p-value")
+	fmt.Println(compareRule)
 
-	http12DNSStats := stats.ComputeStats(http12DNS)
-	http3DNSStats := stats.ComputeStats(http3DNS)
+	printComparisonRow("DNS Lookup:", stats.ExtractDNSLookup(http12Timings), stats.ExtractDNSLookup(http3Timings))
 
-	fmt.Printf("%-20s %14s %14s %14s\n",
-		"DNS Lookup:",
-		formatDuration(http12DNSStats.Mean),
-		formatDuration(http3DNSStats.Mean),
-		formatDelta(http12DNSStats.Mean, http3DNSStats.Mean),
-	)
-
-	// TCP Connect (HTTP/1.1-2 only)
-	http12TCP := stats.ExtractTCPConnect(http12Samples)
-	http12TCPStats := stats.ComputeStats(http12TCP)
+	// TCP Connect and TLS Handshake (HTTP/1.1-2 only)
+	http12TCPStats := stats.ComputeStats(stats.ExtractTCPConnect(http12Timings))
 
 	fmt.Printf("%-20s %14s %14s %14s\n",
 		"TCP Connect:",
@@ -813,9 +1711,7 @@ func printMultiSampleTTFFComparisonResults(url string, http12Samples, http3Sampl
 		"N/A",
 	)
 
-	// TLS Handshake (HTTP/1.1-2 only)
-	http12TLS := stats.ExtractTLSHandshake(http12Samples)
-	http12TLSStats := stats.ComputeStats(http12TLS)
+	http12TLSStats := stats.ComputeStats(stats.ExtractTLSHandshake(http12Timings))
 
 	fmt.Printf("%-20s %14s %14s %14s\n",
 		"TLS Handshake:",
@@ -825,8 +1721,7 @@ func printMultiSampleTTFFComparisonResults(url string, http12Samples, http3Sampl
 	)
 
 	// QUIC Handshake (HTTP/3 only)
-	http3QUIC := stats.ExtractQUICHandshake(http3Samples)
-	http3QUICStats := stats.ComputeStats(http3QUIC)
+	http3QUICStats := stats.ComputeStats(stats.ExtractQUICHandshake(http3Timings))
 
 	fmt.Printf("%-20s %14s %14s %14s\n",
 		"QUIC Handshake:",
@@ -835,61 +1730,29 @@ func printMultiSampleTTFFComparisonResults(url string, http12Samples, http3Sampl
 		"N/A",
 	)
 
-	// Manifest TTFB
-	http12TTFB := stats.ExtractManifestTTFB(http12Samples)
-	http3TTFB := stats.ExtractManifestTTFB(http3Samples)
-
-	http12TTFBStats := stats.ComputeStats(http12TTFB)
-	http3TTFBStats := stats.ComputeStats(http3TTFB)
-
-	fmt.Printf("%-20s %14s %14s %14s\n",
-		"Manifest TTFB:",
-		formatDuration(http12TTFBStats.Mean),
-		formatDuration(http3TTFBStats.Mean),
-		formatDelta(http12TTFBStats.Mean, http3TTFBStats.Mean),
-	)
-
-	// Segment Download
-	http12Segment := stats.ExtractSegmentTotal(http12Samples)
-	http3Segment := stats.ExtractSegmentTotal(http3Samples)
+	printComparisonRow("Manifest TTFB:", stats.ExtractManifestTTFB(http12Timings), stats.ExtractManifestTTFB(http3Timings))
 
-	http12SegmentStats := stats.ComputeStats(http12Segment)
-	http3SegmentStats := stats.ComputeStats(http3Segment)
+	// Key Fetch (encrypted playlists only)
+	if anyNonZero(stats.ExtractKeyFetch(http12Timings), stats.ExtractKeyFetch(http3Timings)) {
+		printComparisonRow("Key Fetch:", stats.ExtractKeyFetch(http12Timings), stats.ExtractKeyFetch(http3Timings))
+	}
 
-	fmt.Printf("%-20s %14s %14s %14s\n",
-		"Segment Download:",
-		formatDuration(http12SegmentStats.Mean),
-		formatDuration(http3SegmentStats.Mean),
-		formatDelta(http12SegmentStats.Mean, http3SegmentStats.Mean),
-	)
+	// Init Segment (fMP4/CMAF only)
+	if anyNonZero(stats.ExtractInitSegment(http12Timings), stats.ExtractInitSegment(http3Timings)) {
+		printComparisonRow("Init Segment:", stats.ExtractInitSegment(http12Timings), stats.ExtractInitSegment(http3Timings))
+	}
 
-	// Frame Detection
-	http12Frame := stats.ExtractFrameDetection(http12Samples)
-	http3Frame := stats.ExtractFrameDetection(http3Samples)
+	printComparisonRow(segmentPhaseLabel(), stats.ExtractSegmentTotal(http12Timings), stats.ExtractSegmentTotal(http3Timings))
+	printComparisonRow("Frame Detection:", stats.ExtractFrameDetection(http12Timings), stats.ExtractFrameDetection(http3Timings))
 
-	http12FrameStats := stats.ComputeStats(http12Frame)
-	http3FrameStats := stats.ComputeStats(http3Frame)
+	fmt.Println(compareRule)
 
-	fmt.Printf("%-20s %14s %14s %14s\n",
-		"Frame Detection:",
-		formatDuration(http12FrameStats.Mean),
-		formatDuration(http3FrameStats.Mean),
-		formatDelta(http12FrameStats.Mean, http3FrameStats.Mean),
-	)
+	printComparisonRow("Total TTFF:", stats.ExtractTotalTTFF(http12Timings), stats.ExtractTotalTTFF(http3Timings))
 
-	fmt.Println("────────────────────────────────────────────────────────────────────")
-
-	// Total TTFF
-	http12Total := stats.ExtractTotalTTFF(http12Samples)
-	http3Total := stats.ExtractTotalTTFF(http3Samples)
-
-	http12TotalStats := stats.ComputeStats(http12Total)
-	http3TotalStats := stats.ComputeStats(http3Total)
+	if audioMode {
+		printComparisonRow("Total TTFA:", stats.ExtractTotalTTFA(http12Timings), stats.ExtractTotalTTFA(http3Timings))
+	}
 
-	fmt.Printf("%-20s %14s %14s %14s\n",
-		"Total TTFF:",
-		formatDuration(http12TotalStats.Mean),
-		formatDuration(http3TotalStats.Mean),
-		formatDelta(http12TotalStats.Mean, http3TotalStats.Mean),
-	)
+	fmt.Println()
+	fmt.Println(significanceLegend)
 }
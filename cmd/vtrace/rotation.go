@@ -0,0 +1,74 @@
+package main
+
+import (
+	"errors"
+	"maps"
+
+	"github.com/grafov/m3u8"
+
+	"codeberg.org/pwnderpants/vtrace/internal/probe"
+	"codeberg.org/pwnderpants/vtrace/internal/ttff"
+)
+
+// variantLabel is the label that names the rendition a rotated sample measured
+const variantLabel = "variant"
+
+// rotateVariants makes serve measure the next variant of a master playlist on every interval
+var rotateVariants bool
+
+// variantRotation cycles through the ladder one measurement at a time
+type variantRotation struct {
+	next     int
+	selected string
+}
+
+// serveRotation tracks the ladder position when --rotate-variants is set
+var serveRotation *variantRotation
+
+// validateRotation rejects a --label that would be overwritten by the rotation
+func validateRotation() error {
+	if !rotateVariants {
+		return nil
+	}
+
+	if _, ok := recordLabels[variantLabel]; ok {
+		return errors.New("--label variant=... cannot be combined with --rotate-variants")
+	}
+
+	return nil
+}
+
+// strategy picks the variant after the previously measured one, wrapping at the end of
+// the ladder; a sample that fails before reaching the master playlist does not advance it
+func (r *variantRotation) strategy() probe.VariantStrategy {
+	return func(variants []*m3u8.Variant) (int, error) {
+		index := r.next % len(variants)
+
+		r.next = index + 1
+		r.selected = ttff.VariantLabel(variants[index])
+
+		return index, nil
+	}
+}
+
+// begin forgets the previous selection so a failed sample is never mislabelled
+func (r *variantRotation) begin() {
+	r.selected = ""
+}
+
+// labels returns the stored labels plus the variant measured by the latest sample
+func (r *variantRotation) labels(base map[string]string) map[string]string {
+	if r.selected == "" {
+		return base
+	}
+
+	labels := maps.Clone(base)
+
+	if labels == nil {
+		labels = make(map[string]string)
+	}
+
+	labels[variantLabel] = r.selected
+
+	return labels
+}
@@ -0,0 +1,259 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	neturl "net/url"
+	"os"
+	"runtime"
+	"runtime/debug"
+	"sort"
+	"strings"
+
+	"github.com/spf13/pflag"
+
+	"codeberg.org/pwnderpants/vtrace/internal/decoder"
+	"codeberg.org/pwnderpants/vtrace/internal/redact"
+	"codeberg.org/pwnderpants/vtrace/internal/report"
+)
+
+// runConfig is the effective configuration of the invocation, captured once its flags are
+// resolved; nil before then
+var runConfig *report.Config
+
+// unfingerprintedFlags choose what is measured or where results go rather than how the
+// measurement runs, so runs that differ only in them share a fingerprint
+var unfingerprintedFlags = map[string]bool{
+	"url": true, "url-file": true, "compare-dash": true, "segment-index": true, "segments": true,
+	"live-edge": true, "samples": true, "max-samples": true,
+	"confidence": true, "ci-margin": true, "watch": true, "interval": true, "verbose": true,
+	"csv": true, "har": true, "template": true, "upload": true, "history": true, "label": true,
+	"experiment": true, "arm": true, "replay-dir": true, "replay-threshold": true,
+	"beacon-url": true, "kafka-brokers": true, "kafka-topic": true, "kafka-tls": true,
+	"kafka-sasl": true, "kafka-username": true, "zabbix-server": true, "zabbix-host": true,
+	"zabbix-key-prefix": true, "influx-url": true, "influx-bucket": true, "influx-org": true,
+	"influx-measurement": true, "output": true, "email-to": true, "email-at": true, "smtp-server": true,
+	"smtp-from": true, "smtp-username": true, "redact": true, "locale": true,
+	"decimal-separator": true, "thousands-separator": true, "number-width": true, "waterfall": true,
+	"retain-raw": true, "retain-aggregates": true, "listen": true, "config": true, "profile": true,
+}
+
+// headerFlags carry header values that may hold credentials, so only header names are kept
+var headerFlags = map[string]bool{"header": true, "manifest-header": true, "segment-header": true}
+
+// unfingerprintedEnvironment identify the machine rather than how it was configured
+var unfingerprintedEnvironment = map[string]bool{"hostname": true}
+
+// configEnvironment lists the environment variables that change how requests are made
+var configEnvironment = []string{
+	"HTTP_PROXY", "HTTPS_PROXY", "NO_PROXY", "SSL_CERT_FILE", "SSL_CERT_DIR", "GODEBUG", "QUIC_GO_DISABLE_GSO", "QUIC_GO_DISABLE_ECN",
+}
+
+// captureConfig records every resolved flag of the command with the client versions and
+// environment, and attaches the result to the run report
+func captureConfig(flags *pflag.FlagSet) {
+	config := &report.Config{
+		Flags:       make(map[string]string),
+		Versions:    clientVersions(),
+		Environment: configEnvironmentValues(),
+	}
+
+	flags.VisitAll(func(f *pflag.Flag) {
+		config.Flags[f.Name] = configFlagValue(f)
+	})
+
+	config.Fingerprint = configFingerprint(config)
+	runConfig = config
+
+	if runReport != nil {
+		runReport.Config = config
+	}
+
+	if verbose {
+		printConfigBlock(flags)
+	}
+}
+
+// configFlagValue renders a flag's resolved value with header values and URL passwords
+// removed, and URLs redacted when --redact is set
+func configFlagValue(f *pflag.Flag) string {
+	if headerFlags[f.Name] {
+		slice, ok := f.Value.(pflag.SliceValue)
+		if !ok {
+			return redact.Placeholder
+		}
+
+		names := make([]string, 0, len(slice.GetSlice()))
+
+		for _, spec := range slice.GetSlice() {
+			name, _, _ := strings.Cut(spec, ":")
+			names = append(names, strings.TrimSpace(name)+": "+redact.Placeholder)
+		}
+
+		return "[" + strings.Join(names, ",") + "]"
+	}
+
+	return configURLValue(f.Value.String())
+}
+
+// configURLValue hides the password of a URL value (or the whole URL under --redact)
+func configURLValue(value string) string {
+	if !strings.Contains(value, "://") {
+		return value
+	}
+
+	if redactResults {
+		return exportURL(value)
+	}
+
+	parsed, err := neturl.Parse(value)
+	if err != nil {
+		return value
+	}
+
+	return parsed.Redacted()
+}
+
+// clientVersions reports the builds of vtrace, Go, quic-go, and the frame decoder
+func clientVersions() map[string]string {
+	versions := map[string]string{
+		"go": runtime.Version(),
+	}
+
+	if info, ok := debug.ReadBuildInfo(); ok {
+		versions["vtrace"] = vtraceVersion(info)
+
+		for _, dep := range info.Deps {
+			if dep.Path == "github.com/quic-go/quic-go" {
+				versions["quic-go"] = dep.Version
+			}
+		}
+	}
+
+	if libav, ok := decoder.LinkedLibav(); ok {
+		versions["decoder"] = libav
+	} else if info, err := decoder.InstalledFFprobe(); err == nil {
+		versions["decoder"] = info.String()
+	} else {
+		versions["decoder"] = "native"
+	}
+
+	return versions
+}
+
+// vtraceVersion returns the module version, or the VCS revision for development builds
+func vtraceVersion(info *debug.BuildInfo) string {
+	version := info.Main.Version
+	revision, modified := "", false
+
+	for _, setting := range info.Settings {
+		switch setting.Key {
+		case "vcs.revision":
+			revision = setting.Value
+		case "vcs.modified":
+			modified = setting.Value == "true"
+		}
+	}
+
+	if (version == "" || version == "(devel)") && revision != "" {
+		version = revision[:min(12, len(revision))]
+
+		if modified {
+			version += "-dirty"
+		}
+	}
+
+	return version
+}
+
+// configEnvironmentValues reports the platform and any environment variables that change
+// how requests are made
+func configEnvironmentValues() map[string]string {
+	environment := map[string]string{
+		"os":   runtime.GOOS,
+		"arch": runtime.GOARCH,
+		"cpus": fmt.Sprint(runtime.NumCPU()),
+	}
+
+	if hostname, err := os.Hostname(); err == nil && !redactResults {
+		environment["hostname"] = hostname
+	}
+
+	for _, name := range configEnvironment {
+		if value, ok := os.LookupEnv(name); ok {
+			environment[name] = configURLValue(value)
+		}
+	}
+
+	return environment
+}
+
+// configFingerprint hashes the measurement flags, versions, and environment into a short ID
+func configFingerprint(config *report.Config) string {
+	hash := sha256.New()
+
+	write := func(section string, values map[string]string, skip map[string]bool) {
+		keys := make([]string, 0, len(values))
+
+		for key := range values {
+			if !skip[key] {
+				keys = append(keys, key)
+			}
+		}
+
+		sort.Strings(keys)
+
+		for _, key := range keys {
+			fmt.Fprintf(hash, "%s.%s=%s\n", section, key, values[key])
+		}
+	}
+
+	write("flag", config.Flags, unfingerprintedFlags)
+	write("version", config.Versions, nil)
+	write("env", config.Environment, unfingerprintedEnvironment)
+
+	return hex.EncodeToString(hash.Sum(nil))[:12]
+}
+
+// printConfigBlock lists the versions, environment, and flags changed from their defaults
+func printConfigBlock(flags *pflag.FlagSet) {
+	fmt.Printf("Configuration %s:\n", runConfig.Fingerprint)
+
+	for _, section := range []map[string]string{runConfig.Versions, runConfig.Environment} {
+		keys := make([]string, 0, len(section))
+
+		for key := range section {
+			keys = append(keys, key)
+		}
+
+		sort.Strings(keys)
+
+		for _, key := range keys {
+			fmt.Printf("  %s: %s\n", key, section[key])
+		}
+	}
+
+	flags.Visit(func(f *pflag.Flag) {
+		fmt.Printf("  --%s=%s\n", f.Name, runConfig.Flags[f.Name])
+	})
+}
+
+// printConfiguration records the configuration fingerprint below the results so two runs can
+// be checked for like-for-like settings before they are compared
+func printConfiguration() {
+	if runConfig == nil {
+		return
+	}
+
+	fmt.Printf("Configuration: %s (%s, %s/%s; --verbose lists the settings)\n", runConfig.Fingerprint, runConfig.Versions["vtrace"], runConfig.Environment["os"], runConfig.Environment["arch"])
+}
+
+// runFingerprint returns the fingerprint stored with each history record
+func runFingerprint() string {
+	if runConfig == nil {
+		return ""
+	}
+
+	return runConfig.Fingerprint
+}
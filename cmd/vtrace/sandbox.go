@@ -0,0 +1,113 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"codeberg.org/pwnderpants/vtrace/internal/decoder"
+)
+
+var (
+	ffprobeBinaryPath string
+	ffprobeSandboxed  bool
+	ffprobeEnvSpecs   []string
+	ffprobeTimeout    time.Duration
+	ffprobeMemorySpec string
+	ffprobeCPULimit   time.Duration
+	ffprobeCgroup     string
+)
+
+// setupFFprobeSandbox confines the ffprobe child process as the --ffprobe-* flags ask
+func setupFFprobeSandbox() error {
+	sandbox := decoder.Sandbox{
+		Binary:   ffprobeBinaryPath,
+		Timeout:  ffprobeTimeout,
+		CPULimit: ffprobeCPULimit,
+		Cgroup:   ffprobeCgroup,
+		Seccomp:  ffprobeSandboxed,
+	}
+
+	switch {
+	case ffprobeTimeout < 0:
+		return errors.New("--ffprobe-timeout must not be negative")
+	case ffprobeCPULimit < 0:
+		return errors.New("--ffprobe-cpu must not be negative")
+	case len(ffprobeEnvSpecs) > 0 && !ffprobeSandboxed:
+		return errors.New("--ffprobe-env requires --ffprobe-sandbox (ffprobe otherwise inherits the whole environment)")
+	}
+
+	if ffprobeMemorySpec != "" {
+		size, err := parseByteSize(ffprobeMemorySpec)
+		if err != nil {
+			return fmt.Errorf("invalid --ffprobe-memory: %w", err)
+		}
+
+		sandbox.MemoryLimit = uint64(size)
+	}
+
+	// The sandboxed environment holds only what --ffprobe-env passes through
+	if ffprobeSandboxed {
+		sandbox.Env = []string{}
+
+		for _, spec := range ffprobeEnvSpecs {
+			if !strings.Contains(spec, "=") {
+				value, ok := os.LookupEnv(spec)
+				if !ok {
+					continue
+				}
+
+				spec += "=" + value
+			}
+
+			sandbox.Env = append(sandbox.Env, spec)
+		}
+	}
+
+	if err := decoder.SetSandbox(sandbox); err != nil {
+		return fmt.Errorf("invalid ffprobe sandbox: %w", err)
+	}
+
+	if description := describeSandbox(sandbox); verbose && description != "" {
+		fmt.Printf("ffprobe sandbox: %s\n", description)
+	}
+
+	return nil
+}
+
+// describeSandbox lists the restrictions applied to ffprobe
+func describeSandbox(sandbox decoder.Sandbox) string {
+	var parts []string
+
+	if sandbox.Binary != "" {
+		parts = append(parts, sandbox.Binary)
+	}
+
+	if sandbox.Env != nil {
+		parts = append(parts, fmt.Sprintf("%d environment %s", len(sandbox.Env), plural(len(sandbox.Env), "variable")))
+	}
+
+	if sandbox.Seccomp {
+		parts = append(parts, "seccomp (no sockets or ptrace)")
+	}
+
+	if sandbox.Timeout > 0 {
+		parts = append(parts, "killed after "+sandbox.Timeout.String())
+	}
+
+	if sandbox.MemoryLimit > 0 {
+		parts = append(parts, formatBytes(int(sandbox.MemoryLimit))+" address space")
+	}
+
+	if sandbox.CPULimit > 0 {
+		parts = append(parts, sandbox.CPULimit.String()+" CPU")
+	}
+
+	if sandbox.Cgroup != "" {
+		parts = append(parts, "cgroup "+sandbox.Cgroup)
+	}
+
+	return strings.Join(parts, ", ")
+}
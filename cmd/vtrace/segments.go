@@ -0,0 +1,79 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"codeberg.org/pwnderpants/vtrace/internal/stats"
+	"codeberg.org/pwnderpants/vtrace/internal/ttff"
+)
+
+var (
+	segmentIndex int
+	segmentCount int
+)
+
+// validateSegments checks --segment-index and --segments, which pick HLS media segments
+func validateSegments() error {
+	switch {
+	case segmentIndex < 0:
+		return errors.New("--segment-index must not be negative")
+	case segmentCount < 1:
+		return errors.New("--segments must be at least 1")
+	case segmentIndex == 0 && segmentCount == 1:
+		return nil
+	case streamProtocol != streamHLS:
+		return errors.New("--segment-index and --segments require --protocol hls")
+	case lowLatency:
+		return errors.New("--segment-index and --segments cannot be combined with --ll-hls")
+	}
+
+	return nil
+}
+
+// printSegmentDownloads lists the downloads --segments averaged into the segment phase, by
+// their position in the playlist
+func printSegmentDownloads(allSamples []ttff.Sample) {
+	if segmentCount == 1 || len(allSamples) == 0 {
+		return
+	}
+
+	phase := strings.TrimSuffix(segmentPhaseLabel(), ":")
+
+	if len(allSamples) == 1 {
+		downloads := make([]string, 0, len(allSamples[0].SegmentDownloads))
+
+		for i, download := range allSamples[0].SegmentDownloads {
+			downloads = append(downloads, fmt.Sprintf("%s %s", segmentPosition(i), formatDuration(download)))
+		}
+
+		fmt.Printf("\nSegment Downloads: %s (averaged into %s)\n", strings.Join(downloads, ", "), phase)
+
+		return
+	}
+
+	fmt.Printf("\nSegment Downloads (%d per sample, averaged into %s):\n", segmentCount, phase)
+	fmt.Printf("  %-18s %14s %14s %14s %14s\n", "", "Avg", "Min", "Max", "Median")
+
+	for i := 0; i < segmentCount; i++ {
+		var downloads []time.Duration
+
+		for _, sample := range allSamples {
+			if i < len(sample.SegmentDownloads) {
+				downloads = append(downloads, sample.SegmentDownloads[i])
+			}
+		}
+
+		s := stats.ComputeStats(downloads)
+
+		fmt.Printf("  %-18s %14s %14s %14s %14s\n",
+			fmt.Sprintf("Segment %s:", segmentPosition(i)),
+			formatDuration(s.Mean),
+			formatDuration(s.Min),
+			formatDuration(s.Max),
+			formatDuration(s.Median),
+		)
+	}
+}
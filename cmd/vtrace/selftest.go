@@ -0,0 +1,241 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"codeberg.org/pwnderpants/vtrace/internal/decoder"
+	"codeberg.org/pwnderpants/vtrace/internal/origin"
+	"codeberg.org/pwnderpants/vtrace/internal/probe"
+)
+
+// Self-test check outcomes; only failures make the command exit non-zero
+const (
+	selftestPass = "PASS"
+	selftestWarn = "WARN"
+	selftestFail = "FAIL"
+	selftestSkip = "SKIP"
+)
+
+// selftestSlow is the Total TTFF above which a loopback measurement is suspicious
+const selftestSlow = time.Second
+
+// selftestRoute is a public IPv6 address used to ask the kernel for a route; no packet is sent
+const selftestRoute = "[2001:4860:4860::8888]:53"
+
+// selftestTimeout bounds the synthetic measurement; it has its own variable so the default
+// of the root --timeout is left alone
+var selftestTimeout time.Duration
+
+var selftestCmd = &cobra.Command{
+	Use:   "selftest",
+	Short: "Check this installation against a built-in synthetic origin",
+	Long: `selftest starts a synthetic HLS origin on the loopback interface (HTTPS with
+an ephemeral certificate), measures it once like a normal run, and checks that
+every phase was timed and is plausible. It then checks the optional
+dependencies: ffprobe, the UDP receive buffer HTTP/3 needs, and IPv6.
+
+Warnings describe reduced functionality; the command exits non-zero only when
+a check fails.`,
+	RunE: runSelftest,
+}
+
+// selftestCheck is one line of the self-test report
+type selftestCheck struct {
+	name   string
+	status string
+	detail string
+}
+
+// init registers the selftest subcommand and its flags
+func init() {
+	selftestCmd.Flags().DurationVarP(&selftestTimeout, "timeout", "t", 10*time.Second, "Timeout for the synthetic measurement")
+	selftestCmd.Flags().BoolVarP(&verbose, "verbose", "v", false, "Enable verbose output")
+
+	rootCmd.AddCommand(selftestCmd)
+}
+
+// runSelftest runs every check and prints one status line per check
+func runSelftest(cmd *cobra.Command, args []string) error {
+	cmd.SilenceUsage = true
+
+	fmt.Println("vtrace selftest")
+	fmt.Println("────────────────────────────────────────────────────────────────────")
+
+	checks := selftestMeasurement()
+	checks = append(checks, selftestFFprobe(), selftestUDPBuffer(), selftestIPv6())
+
+	failed, warned := 0, 0
+
+	for _, check := range checks {
+		fmt.Printf("%-20s %-5s %s\n", check.name+":", check.status, check.detail)
+
+		switch check.status {
+		case selftestFail:
+			failed++
+		case selftestWarn:
+			warned++
+		}
+	}
+
+	fmt.Println("────────────────────────────────────────────────────────────────────")
+
+	if failed > 0 {
+		return fmt.Errorf("self-test failed: %d of %d checks failed", failed, len(checks))
+	}
+
+	fmt.Printf("Self-test passed (%d %s)\n", warned, plural(warned, "warning"))
+
+	return nil
+}
+
+// selftestMeasurement measures the synthetic origin once and checks every phase
+func selftestMeasurement() []selftestCheck {
+	o, err := origin.Start()
+	if err != nil {
+		return []selftestCheck{{"Synthetic origin", selftestFail, err.Error()}}
+	}
+	defer o.Close()
+
+	checks := []selftestCheck{{"Synthetic origin", selftestPass, o.URL}}
+
+	// The measurement reads the same settings as a run, pointed at the origin
+	url = o.URL
+	timeout = selftestTimeout
+	streamProtocol = streamHLS
+	tlsSettings = probe.TLSSettings{RootCAs: o.RootCAs}
+
+	sample, _, _, err := measureSample(context.Background(), o.URL, 0, protocolHTTP12)
+	if err != nil {
+		return append(checks, selftestCheck{"Measurement", selftestFail, err.Error()})
+	}
+
+	phases := []struct {
+		name  string
+		value time.Duration
+		note  string
+	}{
+		{"DNS Lookup", sample.DNSLookup, ""},
+		{"TCP Connect", sample.TCPConnect, ""},
+		{"TLS Handshake", sample.TLSHandshake, describeTLS(sample.ManifestTLS)},
+		{"Manifest TTFB", sample.ManifestTTFB, sample.ManifestProto},
+		{"Segment Download", sample.SegmentTotal, ""},
+		{"Frame Detection", sample.FrameDetection, sample.FrameDecoder},
+	}
+
+	for _, phase := range phases {
+		check := selftestCheck{name: phase.name, status: selftestPass, detail: formatDuration(phase.value)}
+
+		switch {
+		case phase.value <= 0:
+			check.status, check.detail = selftestFail, "not measured"
+		case phase.value > sample.TotalTTFF:
+			check.status, check.detail = selftestFail, fmt.Sprintf("%s exceeds Total TTFF %s", formatDuration(phase.value), formatDuration(sample.TotalTTFF))
+		case phase.note != "":
+			check.detail += " (" + phase.note + ")"
+		}
+
+		checks = append(checks, check)
+	}
+
+	total := selftestCheck{name: "Total TTFF", status: selftestPass, detail: formatDuration(sample.TotalTTFF)}
+
+	switch {
+	case sample.TotalTTFF <= 0:
+		total.status, total.detail = selftestFail, "not measured"
+	case sample.TotalTTFF > selftestSlow:
+		total.status = selftestWarn
+		total.detail += fmt.Sprintf(" (slow for a loopback origin; expected under %s)", formatDuration(selftestSlow))
+	}
+
+	return append(checks, total)
+}
+
+// describeTLS names the negotiated TLS version, or returns "" when none was recorded
+func describeTLS(info *probe.TLSInfo) string {
+	if info == nil {
+		return ""
+	}
+
+	return info.VersionName()
+}
+
+// selftestFFprobe checks the frame decoder used for fMP4 segments and as a fallback
+func selftestFFprobe() selftestCheck {
+	check := selftestCheck{name: "ffprobe"}
+
+	if libav, ok := decoder.LinkedLibav(); ok {
+		check.status, check.detail = selftestPass, libav+" linked in-process"
+
+		return check
+	}
+
+	info, err := decoder.InstalledFFprobe()
+
+	switch {
+	case errors.Is(err, decoder.ErrFFprobeNotFound):
+		check.status, check.detail = selftestWarn, "not found; --protocol dash and fMP4 HLS segments need it"
+	case err != nil:
+		check.status, check.detail = selftestWarn, err.Error()
+	case !info.ReadIntervals:
+		check.status, check.detail = selftestWarn, info.String()+" predates -read_intervals; frame detection reads whole segments"
+	default:
+		check.status, check.detail = selftestPass, info.String()
+	}
+
+	return check
+}
+
+// selftestUDPBuffer checks that the kernel grants quic-go the UDP receive buffer it asks for
+func selftestUDPBuffer() selftestCheck {
+	check := selftestCheck{name: "UDP receive buffer"}
+
+	effective, err := probe.UDPReceiveBuffer(probe.QUICReceiveBuffer)
+
+	switch {
+	case errors.Is(err, errors.ErrUnsupported):
+		check.status, check.detail = selftestSkip, "not measurable on this platform"
+	case err != nil:
+		check.status, check.detail = selftestWarn, err.Error()
+	case effective < probe.QUICReceiveBuffer:
+		check.status = selftestWarn
+		check.detail = fmt.Sprintf("%s granted of %s requested; HTTP/3 may be slower (%s)", formatBytes(effective), formatBytes(probe.QUICReceiveBuffer), udpBufferRemedy())
+	default:
+		check.status, check.detail = selftestPass, formatBytes(effective)
+	}
+
+	return check
+}
+
+// selftestIPv6 checks for the IPv6 loopback interface and a route to IPv6 destinations
+func selftestIPv6() selftestCheck {
+	check := selftestCheck{name: "IPv6"}
+
+	listener, err := net.Listen("tcp", "[::1]:0")
+	if err != nil {
+		check.status, check.detail = selftestWarn, "no IPv6 loopback; --all-ips and AAAA targets are limited to IPv4"
+
+		return check
+	}
+
+	listener.Close()
+
+	// Connecting a UDP socket only selects a route and source address
+	conn, err := net.Dial("udp6", selftestRoute)
+	if err != nil {
+		check.status, check.detail = selftestWarn, "loopback only; no route to IPv6 destinations"
+
+		return check
+	}
+	defer conn.Close()
+
+	check.status = selftestPass
+	check.detail = "routed from " + conn.LocalAddr().(*net.UDPAddr).IP.String()
+
+	return check
+}
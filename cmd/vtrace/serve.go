@@ -0,0 +1,324 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"codeberg.org/pwnderpants/vtrace/internal/anomaly"
+	"codeberg.org/pwnderpants/vtrace/internal/grafana"
+	"codeberg.org/pwnderpants/vtrace/internal/history"
+	"codeberg.org/pwnderpants/vtrace/internal/probe"
+	"codeberg.org/pwnderpants/vtrace/internal/prometheus"
+)
+
+var (
+	serveListen   string
+	serveInterval time.Duration
+	historyPath   string
+)
+
+var serveCmd = &cobra.Command{
+	Use:   "serve",
+	Short: "Measure TTFF on a schedule and serve the results over HTTP",
+	Long: `serve runs as a long-lived daemon that measures TTFF for a stream on a fixed
+interval, appends every sample to a history store, exposes the latest values
+and histograms on /metrics for Prometheus, and serves the stored time series
+as a Grafana JSON datasource under /grafana. /diurnal breaks TTFF down by
+hour of day and weekday as p50/p95 heat tables. With --anomaly-z it flags
+samples whose phases stray from an adaptive EWMA baseline. With --slo it tracks
+error-budget consumption and multiwindow burn-rate alerts, served on /slo and
+/metrics. --retain-raw and --retain-aggregates bound the history store by
+downsampling old samples into hourly aggregates and expiring the oldest. With --email-to it
+also emails a daily aggregate report (HTML body, CSV attachment) over SMTP.`,
+	RunE: runServe,
+}
+
+// init registers the serve subcommand and its flags
+func init() {
+	serveCmd.Flags().StringVarP(&url, "url", "u", "", "HLS stream URL (required)")
+	serveCmd.Flags().DurationVarP(&timeout, "timeout", "t", 30*time.Second, "Request timeout")
+	serveCmd.Flags().BoolVarP(&verbose, "verbose", "v", false, "Enable verbose output")
+	serveCmd.Flags().BoolVar(&decoderWarmup, "warmup-decoder", false, "Run the frame decoders once on a built-in segment before the first timed sample")
+	serveCmd.Flags().StringVar(&ffprobeBinaryPath, "ffprobe", "", "ffprobe executable to run instead of the one found in PATH")
+	serveCmd.Flags().BoolVar(&ffprobeSandboxed, "ffprobe-sandbox", false, "Run ffprobe with an empty environment, no_new_privs, and a seccomp filter that denies sockets and ptrace (Linux)")
+	serveCmd.Flags().StringArrayVar(&ffprobeEnvSpecs, "ffprobe-env", nil, "Pass a variable into the --ffprobe-sandbox environment (NAME=value, or NAME to copy it; repeatable)")
+	serveCmd.Flags().DurationVar(&ffprobeTimeout, "ffprobe-timeout", 0, "Kill ffprobe when it runs longer than this")
+	serveCmd.Flags().StringVar(&ffprobeMemorySpec, "ffprobe-memory", "", "Cap the address space of ffprobe (e.g., 512M; Linux)")
+	serveCmd.Flags().DurationVar(&ffprobeCPULimit, "ffprobe-cpu", 0, "Cap the CPU time of ffprobe, in whole seconds (Linux)")
+	serveCmd.Flags().StringVar(&ffprobeCgroup, "ffprobe-cgroup", "", "Start ffprobe in this cgroup v2 directory, whose memory, CPU, and pids limits apply (Linux)")
+	serveCmd.Flags().StringArrayVarP(&headerSpecs, "header", "H", nil, "Add a request header to every request (\"Name: value\", repeatable)")
+	serveCmd.Flags().StringVar(&userAgent, "user-agent", "", "User-Agent sent with every request")
+	serveCmd.Flags().StringVar(&proxySpec, "proxy", "", "Send requests through an HTTP or SOCKS5 proxy (e.g., http://host:3128, socks5://host:1080)")
+	serveCmd.Flags().StringVar(&tlsMinSpec, "tls-min", "", "Lowest TLS version to offer: 1.0, 1.1, 1.2, or 1.3 (default Go's minimum, 1.2)")
+	serveCmd.Flags().BoolVar(&insecureTLS, "insecure", false, "Skip TLS certificate verification")
+	serveCmd.Flags().StringVar(&caCertPath, "cacert", "", "Verify servers against the CA certificates in this PEM file instead of the system roots")
+	serveCmd.Flags().StringVar(&clientCertPath, "cert", "", "Client certificate (PEM) presented to servers that request one")
+	serveCmd.Flags().StringVar(&clientKeyPath, "key", "", "Private key (PEM) for --cert (default: read from the --cert file)")
+	serveCmd.Flags().StringArrayVar(&resolveSpecs, "resolve", nil, "Pin a host and port to an address, like curl (host:port:address, repeatable)")
+	serveCmd.Flags().BoolVar(&freshDNS, "fresh-dns", false, "Resolve the host again and open new connections for every sample instead of reusing them")
+	serveCmd.Flags().StringArrayVar(&manifestHeaderSpecs, "manifest-header", nil, "Add a header to playlist and MPD requests only (\"Name: value\", repeatable)")
+	serveCmd.Flags().StringArrayVar(&segmentHeaderSpecs, "segment-header", nil, "Add a header to segment, init section, and part requests only (\"Name: value\", repeatable)")
+	serveCmd.Flags().StringVar(&serveListen, "listen", ":9109", "Address to serve HTTP on")
+	serveCmd.Flags().DurationVar(&serveInterval, "interval", 60*time.Second, "Time between measurements")
+	serveCmd.Flags().BoolVar(&audioMode, "audio", false, "Also measure and export time to first audio frame (TTFA)")
+	serveCmd.Flags().BoolVar(&rotateVariants, "rotate-variants", false, "Measure the next variant of a master playlist on every interval, labelling samples with variant=RESOLUTION@BANDWIDTH")
+	serveCmd.Flags().StringVar(&historyPath, "history", defaultHistoryPath, "History store (file path, sqlite:PATH, or postgres:// URL)")
+	serveCmd.Flags().StringVar(&experimentName, "experiment", "", "Label stored samples with an experiment name for ab-report")
+	serveCmd.Flags().StringVar(&experimentArm, "arm", "", "Experiment arm these samples belong to (e.g., A or B)")
+	serveCmd.Flags().DurationVar(&retainRaw, "retain-raw", 0, "Downsample samples older than this into hourly aggregates (0 keeps every sample)")
+	serveCmd.Flags().DurationVar(&retainAggregates, "retain-aggregates", 0, "Delete history older than this, aggregates included (0 keeps it forever)")
+	serveCmd.Flags().StringArrayVar(&labelSpecs, "label", nil, "Tag stored samples with a name=value label for compare-stored (repeatable, e.g., region=eu)")
+	serveCmd.Flags().BoolVar(&redactResults, "redact", false, "Hash URLs and strip tokens, query strings, and IP addresses from stored samples and metrics")
+	serveCmd.Flags().Float64Var(&anomalyZ, "anomaly-z", 0, "Flag samples whose phases are this many deviations from their rolling baseline (0 to disable)")
+	serveCmd.Flags().Float64Var(&anomalyAlpha, "anomaly-alpha", anomaly.DefaultAlpha, "Weight of each new sample in the anomaly baseline (0-1)")
+	serveCmd.Flags().StringArrayVar(&sloSpecs, "slo", nil, "Track a TTFF objective such as \"95%<1.5s/30d\" (repeatable)")
+	serveCmd.Flags().DurationVar(&diurnalWindow, "diurnal-window", 28*24*time.Hour, "History covered by the hour-of-day/weekday breakdown (0 to disable)")
+	serveCmd.Flags().StringSliceVar(&emailTo, "email-to", nil, "Email the daily report to these addresses")
+	serveCmd.Flags().StringVar(&emailAt, "email-at", "08:00", "Local time of day (HH:MM) to send the daily report")
+	serveCmd.Flags().StringVar(&smtpServer, "smtp-server", "", "SMTP relay host:port (default port 587)")
+	serveCmd.Flags().StringVar(&smtpFrom, "smtp-from", "", "Sender address for report emails")
+	serveCmd.Flags().StringVar(&smtpUsername, "smtp-username", "", "SMTP username (password from "+smtpPasswordEnv+")")
+
+	serveCmd.MarkFlagRequired("url")
+
+	rootCmd.AddCommand(serveCmd)
+}
+
+// runServe starts the HTTP server and the measurement schedule
+func runServe(cmd *cobra.Command, args []string) error {
+	// Normalize the target URL (punycode hosts, IPv6 literals, userinfo)
+	normalized, err := probe.NormalizeURL(url)
+	if err != nil {
+		return fmt.Errorf("invalid URL: %w", err)
+	}
+
+	url = normalized
+
+	if err := setupRequestHeaders(); err != nil {
+		return err
+	}
+
+	if err := setupProxy(); err != nil {
+		return err
+	}
+
+	if err := setupTLS(); err != nil {
+		return err
+	}
+
+	if err := setupResolve(); err != nil {
+		return err
+	}
+
+	if err := validateFreshDNS(); err != nil {
+		return err
+	}
+
+	if err := validateAudio(); err != nil {
+		return err
+	}
+
+	if serveInterval <= 0 {
+		return errors.New("interval must be positive")
+	}
+
+	if (experimentName == "") != (experimentArm == "") {
+		return errors.New("--experiment and --arm must be used together")
+	}
+
+	if err := parseLabels(); err != nil {
+		return err
+	}
+
+	if err := validateRotation(); err != nil {
+		return err
+	}
+
+	if rotateVariants {
+		serveRotation = &variantRotation{}
+		variantStrategy = serveRotation.strategy()
+	}
+
+	if diurnalWindow < 0 {
+		return errors.New("--diurnal-window must not be negative")
+	}
+
+	if err := validateRetention(); err != nil {
+		return err
+	}
+
+	if err := validateSLOs(); err != nil {
+		return err
+	}
+
+	if err := validateAnomaly(); err != nil {
+		return err
+	}
+
+	var emailOffset time.Duration
+
+	if emailEnabled() {
+		emailOffset, err = validateEmail()
+		if err != nil {
+			return err
+		}
+	}
+
+	if err := setupFFprobeSandbox(); err != nil {
+		return err
+	}
+
+	detectFFprobe()
+	warmUpDecoder()
+	captureConfig(cmd.Flags())
+
+	store, err := history.Open(historyPath)
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	if retentionEnabled() {
+		if err := compactHistory(store, time.Now()); err != nil {
+			return err
+		}
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	exporter := prometheus.NewExporter(exportURL(url))
+	tracker := newSLOTracker()
+
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", exporter)
+	mux.Handle("/grafana/", http.StripPrefix("/grafana", grafana.NewHandler(store)))
+	mux.Handle("/history", historyHandler(store))
+
+	if diurnalWindow > 0 {
+		mux.Handle("/diurnal", diurnalHandler(store))
+	}
+
+	if tracker != nil {
+		mux.Handle("/slo", tracker)
+	}
+
+	// Bind up front so an unusable address fails before measuring starts
+	listener, err := net.Listen("tcp", serveListen)
+	if err != nil {
+		return fmt.Errorf("failed to listen: %w", err)
+	}
+
+	server := &http.Server{Handler: mux}
+
+	serverErr := make(chan error, 1)
+
+	go func() {
+		serverErr <- server.Serve(listener)
+	}()
+
+	fmt.Printf("vtrace serve for: %s (every %s, listening on %s)\n", exportURL(url), serveInterval, serveListen)
+
+	if emailEnabled() {
+		go emailOnSchedule(ctx, store, emailOffset)
+	}
+
+	if diurnalWindow > 0 {
+		go diurnalOnSchedule(ctx, store)
+	}
+
+	if retentionEnabled() {
+		go compactOnSchedule(ctx, store)
+	}
+
+	measureOnSchedule(ctx, store, exporter, tracker, newAnomalyDetector())
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		return fmt.Errorf("failed to shut down server: %w", err)
+	}
+
+	if err := <-serverErr; !errors.Is(err, http.ErrServerClosed) {
+		return fmt.Errorf("server failed: %w", err)
+	}
+
+	return nil
+}
+
+// measureOnSchedule takes a sample every interval until the context is cancelled
+func measureOnSchedule(ctx context.Context, store history.Store, exporter *prometheus.Exporter, tracker *sloTracker, detector *anomaly.Detector) {
+	ticker := time.NewTicker(serveInterval)
+	defer ticker.Stop()
+
+	for i := 0; ; i++ {
+		recordServeSample(i, store, exporter, detector)
+		tracker.evaluate(store, exporter)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// recordServeSample measures once and records the outcome in the history store and exporter
+func recordServeSample(index int, store history.Store, exporter *prometheus.Exporter, detector *anomaly.Detector) {
+	record := history.Record{
+		RunID:      runID,
+		Time:       time.Now().UTC(),
+		URL:        exportURL(url),
+		Protocol:   protocolHTTP12,
+		Experiment: experimentName,
+		Arm:        experimentArm,
+		Labels:     recordLabels,
+		Config:     runFingerprint(),
+	}
+
+	if serveRotation != nil {
+		serveRotation.begin()
+	}
+
+	sample, _, _, err := measureSample(context.Background(), url, index, protocolHTTP12)
+
+	variant := ""
+
+	if serveRotation != nil {
+		record.Labels = serveRotation.labels(recordLabels)
+
+		if serveRotation.selected != "" {
+			variant = " (variant " + serveRotation.selected + ")"
+		}
+	}
+
+	if err != nil {
+		record.Error = exportError(err)
+
+		exporter.ObserveFailure()
+
+		fmt.Printf("%s  sample %d%s failed: %v\n", record.Time.Format(time.RFC3339), index+1, variant, err)
+	} else {
+		record.Metrics = sampleMetrics(sample)
+
+		exporter.Observe(record.Metrics, record.Time)
+
+		fmt.Printf("%s  sample %d%s TTFF %s\n", record.Time.Format(time.RFC3339), index+1, variant, formatDuration(sample.TotalTTFF))
+
+		record.Anomalies = detectAnomalies(detector, index, record.Metrics, record.Time, exporter)
+	}
+
+	// A failed write is reported but never stops the daemon
+	if err := store.Append(record); err != nil {
+		fmt.Fprintf(os.Stderr, "warning: %v\n", err)
+	}
+}
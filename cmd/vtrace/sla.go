@@ -0,0 +1,155 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"codeberg.org/pwnderpants/vtrace/internal/stats"
+	"codeberg.org/pwnderpants/vtrace/internal/ttff"
+)
+
+// exitSLAFailed is the exit code of a run that exceeded a --fail-* threshold, apart from
+// the generic failure code 1 so wrappers can tell a slow stream from a broken run
+const exitSLAFailed = 2
+
+// slaThreshold is one --fail-* limit on the mean of a measured phase
+type slaThreshold struct {
+	flag    string
+	label   string
+	limit   time.Duration
+	extract func([]stats.Sample) []time.Duration
+}
+
+// slaThresholds lists every --fail-* flag in report order
+var slaThresholds = []*slaThreshold{
+	{flag: "fail-ttff", label: "Total TTFF", extract: stats.ExtractTotalTTFF},
+	{flag: "fail-ttfb", label: "Manifest TTFB", extract: stats.ExtractManifestTTFB},
+	{flag: "fail-dns", label: "DNS Lookup", extract: stats.ExtractDNSLookup},
+	{flag: "fail-connect", label: "TCP Connect", extract: stats.ExtractTCPConnect},
+	{flag: "fail-tls", label: "TLS Handshake", extract: stats.ExtractTLSHandshake},
+	{flag: "fail-segment", label: "Segment Download", extract: stats.ExtractSegmentTotal},
+	{flag: "fail-frame", label: "Frame Detection", extract: stats.ExtractFrameDetection},
+	{flag: "fail-ttfa", label: "Total TTFA", extract: stats.ExtractTotalTTFA},
+}
+
+// registerSLAFlags adds the --fail-* flags to a command
+func registerSLAFlags(cmd *cobra.Command) {
+	for _, t := range slaThresholds {
+		cmd.Flags().DurationVar(&t.limit, t.flag, 0, fmt.Sprintf("Exit with code %d when the %s (mean in multi-sample mode) exceeds this", exitSLAFailed, t.label))
+	}
+}
+
+// slaEnabled reports whether any --fail-* threshold is set
+func slaEnabled() bool {
+	for _, t := range slaThresholds {
+		if t.limit > 0 {
+			return true
+		}
+	}
+
+	return false
+}
+
+// validateSLA rejects negative thresholds and modes without a single result to judge
+func validateSLA() error {
+	for _, t := range slaThresholds {
+		if t.limit < 0 {
+			return fmt.Errorf("--%s must not be negative", t.flag)
+		}
+	}
+
+	if !slaEnabled() {
+		return nil
+	}
+
+	switch {
+	case checkMode:
+		return errors.New("--fail-* thresholds cannot be combined with --check (use --warning and --critical)")
+	case compare:
+		return errors.New("--fail-* thresholds cannot be combined with --compare")
+	case urlFile != "":
+		return errors.New("--fail-* thresholds cannot be combined with --url-file")
+	case allVariants:
+		return errors.New("--fail-* thresholds cannot be combined with --all-variants")
+	case len(resolverSpecs) > 0 || len(interfaceNames) > 0:
+		return errors.New("--fail-* thresholds cannot be combined with --resolvers or --interfaces")
+	}
+
+	if thresholdFor("fail-ttfa").limit > 0 && !audioMode {
+		return errors.New("--fail-ttfa requires --audio")
+	}
+
+	return nil
+}
+
+// thresholdFor returns the threshold registered under a flag name
+func thresholdFor(flag string) *slaThreshold {
+	for _, t := range slaThresholds {
+		if t.flag == flag {
+			return t
+		}
+	}
+
+	return nil
+}
+
+// enforceSLA prints the PASS/FAIL summary and returns an exitError when any threshold
+// is exceeded; the summary already explains the failure, so cobra prints nothing more
+func enforceSLA(cmd *cobra.Command, allSamples []ttff.Sample) error {
+	if !slaEnabled() {
+		return nil
+	}
+
+	value := "Value"
+
+	if len(allSamples) > 1 {
+		value = "Mean"
+	}
+
+	fmt.Println()
+	fmt.Println("SLA thresholds")
+	fmt.Println("────────────────────────────────────────────────────")
+	fmt.Printf("%-18s %12s %12s\n", "", value, "Limit")
+
+	var failed []string
+
+	checked := 0
+	timings := ttff.Timings(allSamples)
+
+	for _, t := range slaThresholds {
+		if t.limit <= 0 {
+			continue
+		}
+
+		checked++
+
+		mean := stats.ComputeStats(t.extract(timings)).Mean
+		result := "PASS"
+
+		if mean > t.limit {
+			result = "FAIL"
+			failed = append(failed, fmt.Sprintf("%s %s > %s", t.label, formatDuration(mean), formatDuration(t.limit)))
+		}
+
+		fmt.Printf("%-18s %12s %12s %6s\n", t.label+":", formatDuration(mean), formatDuration(t.limit), result)
+	}
+
+	fmt.Println("────────────────────────────────────────────────────")
+
+	if len(failed) == 0 {
+		fmt.Printf("SLA PASS: %d of %d thresholds met\n", checked, checked)
+
+		return nil
+	}
+
+	fmt.Printf("SLA FAIL: %d of %d thresholds exceeded\n", len(failed), checked)
+
+	cmd.SilenceErrors = true
+	cmd.SilenceUsage = true
+
+	return &exitError{code: exitSLAFailed, err: errors.New("SLA failed: " + strings.Join(failed, ", "))}
+}
@@ -0,0 +1,205 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"codeberg.org/pwnderpants/vtrace/internal/history"
+	"codeberg.org/pwnderpants/vtrace/internal/prometheus"
+	"codeberg.org/pwnderpants/vtrace/internal/slo"
+)
+
+// sloMetric is the stored metric SLO thresholds apply to
+const sloMetric = "total_ttff"
+
+var (
+	sloSpecs      []string
+	sloObjectives []slo.Objective
+)
+
+// sloTracker keeps the latest SLO evaluation and which burn alerts are firing
+type sloTracker struct {
+	mu       sync.Mutex
+	statuses []slo.Status
+	firing   map[string]bool
+}
+
+// sloView is the JSON shape of one SLO served on /slo
+type sloView struct {
+	SLO             string             `json:"slo"`
+	Window          string             `json:"window"`
+	Good            int                `json:"good"`
+	Bad             int                `json:"bad"`
+	Compliance      float64            `json:"compliance"`
+	BudgetConsumed  float64            `json:"budget_consumed"`
+	BudgetRemaining float64            `json:"budget_remaining"`
+	BurnRates       map[string]float64 `json:"burn_rates"`
+	Firing          []string           `json:"firing"`
+}
+
+// validateSLOs parses the --slo objectives
+func validateSLOs() error {
+	sloObjectives = nil
+
+	for _, spec := range sloSpecs {
+		objective, err := slo.ParseObjective(spec, sloMetric)
+		if err != nil {
+			return err
+		}
+
+		sloObjectives = append(sloObjectives, objective)
+	}
+
+	return nil
+}
+
+// newSLOTracker returns a tracker, or nil when no SLOs are configured
+func newSLOTracker() *sloTracker {
+	if len(sloObjectives) == 0 {
+		return nil
+	}
+
+	return &sloTracker{firing: make(map[string]bool)}
+}
+
+// evaluate recomputes every SLO from the history store and reports alert transitions
+func (t *sloTracker) evaluate(store history.Store, exporter *prometheus.Exporter) {
+	if t == nil {
+		return
+	}
+
+	now := time.Now().UTC()
+
+	records, err := store.Query(now.Add(-slo.Longest(sloObjectives, slo.DefaultBurnAlerts)), now)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "warning: %v\n", err)
+
+		return
+	}
+
+	// The history file may hold other streams; budgets are tracked for this one only
+	target := exportURL(url)
+	matching := records[:0]
+
+	for _, record := range records {
+		if record.URL == target {
+			matching = append(matching, record)
+		}
+	}
+
+	statuses := make([]slo.Status, 0, len(sloObjectives))
+	exported := make([]prometheus.Objective, 0, len(sloObjectives))
+
+	for _, objective := range sloObjectives {
+		status := slo.Evaluate(objective, matching, now, slo.DefaultBurnAlerts)
+		statuses = append(statuses, status)
+		exported = append(exported, exportObjective(status))
+	}
+
+	exporter.SetObjectives(exported)
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.statuses = statuses
+
+	for _, status := range statuses {
+		for _, alert := range status.Alerts {
+			key := status.Objective.Spec + "|" + alert.Severity
+
+			if alert.Firing == t.firing[key] {
+				continue
+			}
+
+			t.firing[key] = alert.Firing
+
+			printBurnAlert(status, alert)
+		}
+	}
+}
+
+// exportObjective converts an SLO status into exporter gauges
+func exportObjective(status slo.Status) prometheus.Objective {
+	exported := prometheus.Objective{
+		Name:            status.Objective.Spec,
+		Compliance:      status.Compliance,
+		BudgetRemaining: status.BudgetRemaining,
+		BurnRates:       make(map[string]float64),
+		Firing:          make(map[string]bool),
+	}
+
+	for _, rate := range status.BurnRates {
+		exported.BurnRates[slo.FormatWindow(rate.Window)] = rate.Rate
+	}
+
+	for _, alert := range status.Alerts {
+		exported.Firing[alert.Severity] = alert.Firing
+	}
+
+	return exported
+}
+
+// printBurnAlert logs a burn-rate alert starting or clearing
+func printBurnAlert(status slo.Status, alert slo.Alert) {
+	state := "resolved"
+
+	if alert.Firing {
+		state = "FIRING"
+	}
+
+	fmt.Printf("%s  SLO %s %s burn alert %s: budget burning %.1fx over %s (threshold %.1fx), %.0f%% of error budget consumed\n",
+		time.Now().UTC().Format(time.RFC3339), status.Objective.Spec, alert.Severity, state,
+		burnRateFor(status, alert.Long), slo.FormatWindow(alert.Long), alert.Rate, status.BudgetConsumed*100)
+}
+
+// burnRateFor returns the evaluated burn rate over a window
+func burnRateFor(status slo.Status, window time.Duration) float64 {
+	for _, rate := range status.BurnRates {
+		if rate.Window == window {
+			return rate.Rate
+		}
+	}
+
+	return 0
+}
+
+// ServeHTTP serves the latest SLO evaluation as JSON
+func (t *sloTracker) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	views := make([]sloView, 0, len(t.statuses))
+
+	for _, status := range t.statuses {
+		view := sloView{
+			SLO:             status.Objective.Spec,
+			Window:          slo.FormatWindow(status.Objective.Window),
+			Good:            status.Good,
+			Bad:             status.Bad,
+			Compliance:      status.Compliance,
+			BudgetConsumed:  status.BudgetConsumed,
+			BudgetRemaining: status.BudgetRemaining,
+			BurnRates:       make(map[string]float64),
+			Firing:          []string{},
+		}
+
+		for _, rate := range status.BurnRates {
+			view.BurnRates[slo.FormatWindow(rate.Window)] = rate.Rate
+		}
+
+		for _, alert := range status.Alerts {
+			if alert.Firing {
+				view.Firing = append(view.Firing, alert.Severity)
+			}
+		}
+
+		views = append(views, view)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(views)
+}
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"runtime"
+	"strconv"
+	"strings"
+
+	"codeberg.org/pwnderpants/vtrace/internal/probe"
+)
+
+var (
+	tcpReceiveBufferFlag string
+	udpReceiveBufferFlag string
+
+	// tcpReceiveBuffer and udpReceiveBuffer are the parsed sizes in bytes (zero keeps the OS default)
+	tcpReceiveBuffer int
+	udpReceiveBuffer int
+
+	// observedReceiveBuffers holds the latest effective receive buffer per protocol
+	observedReceiveBuffers = make(map[string]int)
+)
+
+// setupReceiveBuffers parses the --tcp-rcvbuf and --udp-rcvbuf sizes
+func setupReceiveBuffers() error {
+	var err error
+
+	if tcpReceiveBuffer, err = parseByteSize(tcpReceiveBufferFlag); err != nil {
+		return fmt.Errorf("invalid --tcp-rcvbuf: %w", err)
+	}
+
+	if udpReceiveBuffer, err = parseByteSize(udpReceiveBufferFlag); err != nil {
+		return fmt.Errorf("invalid --udp-rcvbuf: %w", err)
+	}
+
+	return nil
+}
+
+// parseByteSize parses sizes like 262144, 512K, 4M, or 4MiB using binary multiples
+func parseByteSize(s string) (int, error) {
+	s = strings.TrimSpace(s)
+
+	if s == "" {
+		return 0, nil
+	}
+
+	upper := strings.TrimSuffix(strings.TrimSuffix(strings.ToUpper(s), "B"), "I")
+	multiplier := 1
+
+	switch {
+	case strings.HasSuffix(upper, "K"):
+		multiplier = 1 << 10
+	case strings.HasSuffix(upper, "M"):
+		multiplier = 1 << 20
+	case strings.HasSuffix(upper, "G"):
+		multiplier = 1 << 30
+	}
+
+	if multiplier > 1 {
+		upper = upper[:len(upper)-1]
+	}
+
+	value, err := strconv.ParseFloat(upper, 64)
+	if err != nil || value <= 0 {
+		return 0, fmt.Errorf("expected a positive size such as 4M, got %q", s)
+	}
+
+	return int(value * float64(multiplier)), nil
+}
+
+// newHTTP3Client creates the HTTP/3 client used for measurements
+func newHTTP3Client() *http.Client {
+	opts := probe.ClientOptions{
+		ReceiveBuffer: udpReceiveBuffer,
+		Interface:     bindInterfaceName,
+		Resolve:       dialPins(),
+		DNS:           dnsResolver,
+		Header:        requestHeader,
+		CMCD:          cmcdData,
+		TLS:           tlsSettings,
+		Throttle:      throttle,
+	}
+
+	applyResumption(&opts)
+
+	return probe.NewHTTP3ClientWithOptions(timeout, opts)
+}
+
+// observeReceiveBuffers remembers the effective receive buffer reported by a sample's requests
+func observeReceiveBuffers(protocol string, traces ...*probe.Trace) {
+	for _, trace := range traces {
+		if trace != nil && trace.ReceiveBuffer > 0 {
+			observedReceiveBuffers[protocol] = trace.ReceiveBuffer
+		}
+	}
+}
+
+// printReceiveBuffers reports requested and effective socket receive buffers, and warns
+// when the OS gave HTTP/3 less than quic-go asks for
+func printReceiveBuffers() {
+	if effective, ok := observedReceiveBuffers[protocolHTTP3]; ok && udpReceiveBuffer == 0 && effective < probe.QUICReceiveBuffer {
+		fmt.Printf("\nwarning: UDP receive buffer is %s, below the %s quic-go asks for; HTTP/3 may drop packets at high bitrates (%s)\n",
+			formatBytes(effective), formatBytes(probe.QUICReceiveBuffer), udpBufferRemedy())
+	}
+
+	if tcpReceiveBuffer == 0 && udpReceiveBuffer == 0 && !verbose {
+		return
+	}
+
+	rows := []struct {
+		label     string
+		protocol  string
+		requested int
+	}{
+		{"TCP (HTTP/1.1-2)", protocolHTTP12, tcpReceiveBuffer},
+		{"UDP (HTTP/3)", protocolHTTP3, udpReceiveBuffer},
+	}
+
+	fmt.Println("\nSocket receive buffers:")
+
+	for _, row := range rows {
+		effective, ok := observedReceiveBuffers[row.protocol]
+
+		if !ok {
+			continue
+		}
+
+		requested := "OS default"
+
+		if row.requested > 0 {
+			requested = formatBytes(row.requested)
+		}
+
+		note := ""
+
+		// The kernel silently caps requests at its configured maximum (see udpBufferRemedy)
+		if row.requested > 0 && effective < row.requested {
+			note = "  (capped by the OS limit)"
+		}
+
+		fmt.Printf("  %-18s requested %s, effective %s%s\n", row.label, requested, formatBytes(effective), note)
+	}
+}
+
+// udpBufferRemedy names the OS limit that caps socket receive buffers on this platform and
+// how to raise it
+func udpBufferRemedy() string {
+	switch runtime.GOOS {
+	case "linux":
+		return "raise net.core.rmem_max, e.g. sysctl -w net.core.rmem_max=7500000"
+	case "darwin", "freebsd", "netbsd", "openbsd", "dragonfly":
+		return "raise kern.ipc.maxsockbuf, e.g. sysctl -w kern.ipc.maxsockbuf=8441037"
+	default:
+		return "request a larger buffer with --udp-rcvbuf"
+	}
+}
+
+// formatBytes renders a byte count in KiB or MiB
+func formatBytes(n int) string {
+	switch {
+	case n >= 1<<20:
+		return numberFormat.Number(float64(n)/(1<<20)) + " MiB"
+	case n >= 1<<10:
+		return numberFormat.Number(float64(n)/(1<<10)) + " KiB"
+	default:
+		return strconv.Itoa(n) + " B"
+	}
+}
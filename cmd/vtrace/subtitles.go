@@ -0,0 +1,212 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/grafov/m3u8"
+
+	"codeberg.org/pwnderpants/vtrace/internal/decoder"
+	"codeberg.org/pwnderpants/vtrace/internal/probe"
+	"codeberg.org/pwnderpants/vtrace/internal/stats"
+	"codeberg.org/pwnderpants/vtrace/internal/subtitle"
+	"codeberg.org/pwnderpants/vtrace/internal/ttff"
+)
+
+// subtitleMode also validates the first segment of the variant's subtitle rendition
+var subtitleMode bool
+
+// validateSubtitles checks that --subtitles is used with a measurement it can extend
+func validateSubtitles() error {
+	if !subtitleMode {
+		return nil
+	}
+
+	if streamProtocol != streamHLS {
+		return errors.New("--subtitles requires --protocol hls")
+	}
+
+	if lowLatency {
+		return errors.New("--subtitles cannot be combined with --ll-hls")
+	}
+
+	return nil
+}
+
+// measureSubtitles fetches the first segment of the variant's subtitle rendition, validates
+// its cues, and compares its timestamp map with the first PTS of the video segment. Problems
+// with the subtitles are flagged on the sample; only failed requests fail it.
+func measureSubtitles(ctx context.Context, client *http.Client, useHTTP3 bool, bundle *replayBundle, variant *m3u8.Variant, masterBaseURL string, videoData []byte, sample *ttff.Sample) error {
+	renditionURL, rendition, err := probe.SelectSubtitleRendition(variant, masterBaseURL)
+	if err != nil {
+		return fmt.Errorf("failed to get subtitle rendition URL: %w", err)
+	}
+
+	if renditionURL == "" {
+		if verbose {
+			fmt.Println("No subtitle rendition referenced by the variant")
+		}
+
+		return nil
+	}
+
+	fetchPlaylist := probe.FetchPlaylist
+	downloadSegment := probe.DownloadSegment
+	suffix := ""
+
+	if useHTTP3 {
+		fetchPlaylist = probe.FetchPlaylistHTTP3
+		downloadSegment = probe.DownloadSegmentHTTP3
+		suffix = " (HTTP/3)"
+	}
+
+	if verbose {
+		fmt.Printf("Fetching subtitle rendition%s: %s (%s)\n", suffix, renditionURL, describeRendition(rendition))
+	}
+
+	bundle.setPrefix("subtitles-")
+	defer bundle.setPrefix("")
+
+	result, err := fetchPlaylist(ctx, renditionURL, client)
+
+	bundle.addPlaylist("media.m3u8", renditionURL, result)
+
+	if err != nil {
+		return fmt.Errorf("failed to fetch subtitle playlist: %w", err)
+	}
+
+	baseURL, err := probe.GetBaseURL(renditionURL)
+	if err != nil {
+		return fmt.Errorf("failed to get subtitle base URL: %w", err)
+	}
+
+	segmentURL, err := probe.GetFirstSegmentURL(result.Media, baseURL)
+	if err != nil {
+		return fmt.Errorf("failed to get subtitle segment URL: %w", err)
+	}
+
+	if verbose {
+		fmt.Printf("Downloading subtitle segment%s: %s\n", suffix, segmentURL)
+	}
+
+	segmentData, segmentTrace, err := downloadSegment(ctx, segmentURL, client)
+
+	bundle.add("segment", segmentURL, segmentData, segmentTrace)
+
+	if err != nil {
+		return fmt.Errorf("failed to download subtitle segment: %w", err)
+	}
+
+	sample.FailedConnects += result.Trace.FailedConnects() + segmentTrace.FailedConnects()
+
+	report, err := subtitle.Parse(segmentData)
+	if err != nil {
+		sample.Subtitles = &subtitle.Report{Issues: []string{err.Error()}}
+
+		return nil
+	}
+
+	// Drift needs the video PTS, which only MPEG-TS segments expose natively
+	if pts, err := decoder.FirstVideoPTS(videoData); err == nil {
+		report.CheckDrift(pts)
+	}
+
+	sample.Subtitles = report
+
+	return nil
+}
+
+// printSubtitleChecks summarizes the subtitle validation of every sample that checked one
+func printSubtitleChecks(allSamples []ttff.Sample) {
+	var (
+		checked []*subtitle.Report
+		drifts  []time.Duration
+		flagged int
+	)
+
+	// Issues keep the order they were first seen in, which follows the segment
+	var order []string
+
+	issues := make(map[string]int)
+
+	for _, sample := range allSamples {
+		report := sample.Subtitles
+
+		if report == nil {
+			continue
+		}
+
+		checked = append(checked, report)
+
+		if len(report.Issues) > 0 {
+			flagged++
+		}
+
+		for _, issue := range report.Issues {
+			if issues[issue] == 0 {
+				order = append(order, issue)
+			}
+
+			issues[issue]++
+		}
+
+		if report.HasDrift {
+			drifts = append(drifts, report.Drift)
+		}
+	}
+
+	if len(checked) == 0 {
+		return
+	}
+
+	last := checked[len(checked)-1]
+
+	format := last.Format
+
+	if format == "" {
+		format = "unrecognized"
+	}
+
+	cues := "cues"
+
+	if len(last.Cues) == 1 {
+		cues = "cue"
+	}
+
+	fmt.Printf("Subtitles: %s, %d valid %s", format, len(last.Cues), cues)
+
+	if last.Map != nil {
+		fmt.Printf(", X-TIMESTAMP-MAP MPEGTS:%d LOCAL:%s", last.Map.MPEGTS, formatDuration(last.Map.Local))
+	}
+
+	if len(drifts) > 0 {
+		drift := stats.ComputeStats(drifts).Mean
+
+		sign := "+"
+
+		if drift < 0 {
+			sign = ""
+		}
+
+		fmt.Printf(", drift %s%s vs video PTS", sign, formatDuration(drift))
+	}
+
+	fmt.Println()
+
+	if flagged == 0 {
+		return
+	}
+
+	fmt.Printf("Subtitle issues (%d of %d samples flagged):\n", flagged, len(checked))
+
+	for _, issue := range order {
+		if len(checked) > 1 {
+			fmt.Printf("  - %s (%d samples)\n", issue, issues[issue])
+		} else {
+			fmt.Printf("  - %s\n", issue)
+		}
+	}
+}
@@ -0,0 +1,184 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/grafov/m3u8"
+
+	"codeberg.org/pwnderpants/vtrace/internal/probe"
+	"codeberg.org/pwnderpants/vtrace/internal/stats"
+	"codeberg.org/pwnderpants/vtrace/internal/ttff"
+)
+
+var allVariants bool
+
+// validateSweep rejects flags that conflict with --all-variants
+func validateSweep() error {
+	if !allVariants {
+		return nil
+	}
+
+	switch {
+	case variantBandwidth != "" || variantResolution != "" || variantIndex >= 0:
+		return errors.New("--all-variants cannot be combined with --variant-* flags")
+	case compare:
+		return errors.New("--all-variants cannot be combined with --compare")
+	case checkMode:
+		return errors.New("--all-variants cannot be combined with --check")
+	case streamProtocol != streamHLS:
+		return errors.New("--all-variants requires an HLS master playlist")
+	}
+
+	return nil
+}
+
+// fetchVariants fetches the master playlist and returns its variant ladder
+func fetchVariants() ([]*m3u8.Variant, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	result, err := probe.FetchPlaylist(ctx, url, newHTTPClient())
+	if err != nil {
+		return nil, err
+	}
+
+	if result.Master == nil {
+		return nil, errors.New("--all-variants requires a master playlist, got a media playlist")
+	}
+
+	if len(result.Master.Variants) == 0 {
+		return nil, probe.ErrNoVariants
+	}
+
+	return result.Master.Variants, nil
+}
+
+// runSweep measures every variant in the ladder and prints a per-variant comparison
+func runSweep(minDelay, maxDelay time.Duration) error {
+	variants, err := fetchVariants()
+	if err != nil {
+		return fmt.Errorf("failed to list variants: %w", err)
+	}
+
+	summaries := make([]stats.PhaseSummary, len(variants))
+	failures := make([]int, len(variants))
+
+	for v, variant := range variants {
+		variantStrategy = probe.VariantByIndex(v)
+
+		if verbose {
+			fmt.Printf("\n══ Variant %d/%d (%s) ══\n", v+1, len(variants), describeVariant(variant))
+		}
+
+		var variantSamples []ttff.Sample
+
+		for i := 0; i < samples; i++ {
+			if verbose {
+				fmt.Printf("\n── Sample %d/%d ──\n", i+1, samples)
+			}
+
+			sample, _, _, err := measureSample(context.Background(), url, i, protocolHTTP12)
+
+			// A broken rendition is a finding, so the sweep records it and moves on
+			if err != nil {
+				failures[v]++
+
+				if verbose {
+					fmt.Printf("  Failed: %v\n", err)
+				}
+			} else {
+				variantSamples = append(variantSamples, sample)
+
+				if verbose {
+					fmt.Printf("  TTFF: %s\n", formatDuration(sample.TotalTTFF))
+				}
+			}
+
+			// Apply delay between samples (skip after the very last sample)
+			if i < samples-1 || v < len(variants)-1 {
+				sleepDuration := getDelay(minDelay, maxDelay)
+
+				if verbose {
+					fmt.Printf("  Waiting %s before next sample...\n", sleepDuration)
+				}
+
+				time.Sleep(sleepDuration)
+			}
+		}
+
+		summaries[v] = stats.SummarizePhases(ttff.Timings(variantSamples))
+	}
+
+	printSweepResults(exportURL(url), variants, summaries, failures)
+	printShaping()
+	printConfiguration()
+
+	if fastest, _ := stats.FastestSlowest(summaries); fastest < 0 {
+		return errors.New("every variant failed")
+	}
+
+	return nil
+}
+
+// printSweepResults outputs the per-variant TTFF breakdown table
+func printSweepResults(url string, variants []*m3u8.Variant, summaries []stats.PhaseSummary, failures []int) {
+	fmt.Printf("\nvtrace variant sweep for: %s (%d variants, %d samples each)\n", url, len(variants), samples)
+	fmt.Println("────────────────────────────────────────────────────────────────────────────────────────────────────")
+	fmt.Printf("%-3s %11s %11s %12s %12s %12s %12s %12s %6s\n", "#", "Bandwidth", "Resolution", "Manifest", "Segment", "Frame", "Total TTFF", "StdDev", "Failed")
+	fmt.Println("────────────────────────────────────────────────────────────────────────────────────────────────────")
+
+	fastest, slowest := stats.FastestSlowest(summaries)
+
+	for i, variant := range variants {
+		resolution := variant.Resolution
+
+		if resolution == "" {
+			resolution = "-"
+		}
+
+		s := summaries[i]
+
+		if s.Count == 0 {
+			fmt.Printf("%-3d %11s %11s %12s %12s %12s %12s %12s %6d\n", i, formatBandwidth(variant.Bandwidth), resolution, "-", "-", "-", "-", "-", failures[i])
+
+			continue
+		}
+
+		marker := ""
+
+		switch i {
+		case fastest:
+			marker = "  fastest"
+		case slowest:
+			marker = "  slowest"
+		}
+
+		fmt.Printf("%-3d %11s %11s %12s %12s %12s %12s %12s %6d%s\n",
+			i,
+			formatBandwidth(variant.Bandwidth),
+			resolution,
+			formatDuration(s.ManifestTotal.Mean),
+			formatDuration(s.SegmentTotal.Mean),
+			formatDuration(s.FrameDetection.Mean),
+			formatDuration(s.TotalTTFF.Mean),
+			formatDuration(s.TotalTTFF.StdDev),
+			failures[i],
+			marker,
+		)
+	}
+
+	fmt.Println("────────────────────────────────────────────────────────────────────────────────────────────────────")
+	fmt.Println("Manifest, Segment, Frame, and Total TTFF are averages; # is the --variant-index of each rendition.")
+}
+
+// formatBandwidth renders a bitrate in kbps or Mbps
+func formatBandwidth(bps uint32) string {
+	if bps >= 1_000_000 {
+		return fmt.Sprintf("%.2f Mbps", float64(bps)/1e6)
+	}
+
+	return fmt.Sprintf("%d kbps", bps/1000)
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"text/template"
+	"time"
+
+	"codeberg.org/pwnderpants/vtrace/internal/stats"
+	"codeberg.org/pwnderpants/vtrace/internal/ttff"
+)
+
+var templatePath string
+
+var (
+	// outputTemplate replaces the result tables when --template is set
+	outputTemplate *template.Template
+
+	// templateSamples collects every completed sample for the template
+	templateSamples []templateSample
+)
+
+// templateSample is one completed measurement as seen by --template
+type templateSample struct {
+	Index    int
+	URL      string
+	Protocol string
+	Time     time.Time
+	Metrics  map[string]float64
+	ttff.Sample
+}
+
+// templateData is the root value passed to --template
+type templateData struct {
+	RunID     string
+	URL       string
+	Time      time.Time
+	Samples   []templateSample
+	TTFF      stats.Stats
+	Protocols map[string]stats.Stats
+}
+
+// templateFuncs are helpers available inside --template files
+var templateFuncs = template.FuncMap{
+	"ms": func(d time.Duration) float64 {
+		return float64(d) / float64(time.Millisecond)
+	},
+	"seconds": func(d time.Duration) float64 {
+		return d.Seconds()
+	},
+	"duration": formatDuration,
+	"unix": func(t time.Time) int64 {
+		return t.Unix()
+	},
+	"rfc3339": func(t time.Time) string {
+		return t.UTC().Format(time.RFC3339)
+	},
+	"influx": func(s templateSample) string {
+		return influxLine(s.URL, s.Protocol, s.Sample, s.Time)
+	},
+}
+
+// loadTemplate parses the --template file so syntax errors surface before measuring
+func loadTemplate() error {
+	if allVariants || checkMode {
+		return errors.New("--template cannot be combined with --all-variants or --check")
+	}
+
+	tmpl, err := template.New(filepath.Base(templatePath)).Funcs(templateFuncs).ParseFiles(templatePath)
+	if err != nil {
+		return fmt.Errorf("failed to parse template: %w", err)
+	}
+
+	outputTemplate = tmpl
+
+	return nil
+}
+
+// addTemplateSample records a completed sample for the template
+func addTemplateSample(target string, index int, protocol string, sample ttff.Sample) {
+	templateSamples = append(templateSamples, templateSample{
+		Index:    index + 1,
+		URL:      exportURL(target),
+		Protocol: protocol,
+		Time:     time.Now().UTC(),
+		Metrics:  sampleMetrics(sample),
+		Sample:   sample,
+	})
+}
+
+// renderTemplate executes the --template file over the collected samples
+func renderTemplate() error {
+	data := templateData{
+		RunID:     runID,
+		URL:       exportURL(url),
+		Time:      time.Now().UTC(),
+		Samples:   templateSamples,
+		Protocols: make(map[string]stats.Stats),
+	}
+
+	var all []ttff.Sample
+
+	byProtocol := make(map[string][]ttff.Sample)
+
+	for _, s := range templateSamples {
+		all = append(all, s.Sample)
+		byProtocol[s.Protocol] = append(byProtocol[s.Protocol], s.Sample)
+	}
+
+	data.TTFF = stats.ComputeStats(stats.ExtractTotalTTFF(ttff.Timings(all)))
+
+	for protocol, samples := range byProtocol {
+		data.Protocols[protocol] = stats.ComputeStats(stats.ExtractTotalTTFF(ttff.Timings(samples)))
+	}
+
+	if err := outputTemplate.Execute(os.Stdout, data); err != nil {
+		return fmt.Errorf("failed to render template: %w", err)
+	}
+
+	return nil
+}
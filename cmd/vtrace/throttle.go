@@ -0,0 +1,129 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"codeberg.org/pwnderpants/vtrace/internal/probe"
+	"codeberg.org/pwnderpants/vtrace/internal/report"
+)
+
+// defaultLimitBurst is the token bucket size used when --limit-burst is not given
+const defaultLimitBurst = "64K"
+
+var (
+	limitRateSpec  string
+	limitBurstSpec string
+
+	// throttle is the token bucket every client of the run shares, so both arms of a
+	// comparison are measured over the same shaped link; nil when --limit-rate is unset
+	throttle *probe.Throttle
+)
+
+// setupThrottle parses --limit-rate and --limit-burst into the run's shared token bucket
+func setupThrottle() error {
+	throttle = nil
+
+	if limitRateSpec == "" {
+		if limitBurstSpec != "" {
+			return errors.New("--limit-burst requires --limit-rate")
+		}
+
+		return nil
+	}
+
+	rate, err := parseRate(limitRateSpec)
+	if err != nil {
+		return fmt.Errorf("invalid --limit-rate: %w", err)
+	}
+
+	burstSpec := limitBurstSpec
+
+	if burstSpec == "" {
+		burstSpec = defaultLimitBurst
+	}
+
+	burst, err := parseByteSize(burstSpec)
+	if err != nil {
+		return fmt.Errorf("invalid --limit-burst: %w", err)
+	}
+
+	throttle = probe.NewThrottle(rate, burst)
+
+	if verbose {
+		fmt.Printf("Shaping: %s\n", describeShaping())
+	}
+
+	return nil
+}
+
+// parseRate parses bits per second with an optional k, M, or G suffix (e.g., 5M)
+func parseRate(spec string) (int64, error) {
+	spec = strings.TrimSuffix(strings.TrimSpace(spec), "bps")
+	multiplier := 1.0
+
+	switch {
+	case strings.HasSuffix(spec, "k"), strings.HasSuffix(spec, "K"):
+		multiplier = 1e3
+	case strings.HasSuffix(spec, "m"), strings.HasSuffix(spec, "M"):
+		multiplier = 1e6
+	case strings.HasSuffix(spec, "g"), strings.HasSuffix(spec, "G"):
+		multiplier = 1e9
+	}
+
+	if multiplier > 1 {
+		spec = spec[:len(spec)-1]
+	}
+
+	value, err := strconv.ParseFloat(spec, 64)
+	if err != nil || value*multiplier < 8 {
+		return 0, fmt.Errorf("expected bits per second such as 5M or 800k, got %q", spec)
+	}
+
+	return int64(value * multiplier), nil
+}
+
+// resetThrottle refills the shared bucket so every sample, whichever arm it belongs to,
+// starts from the same shaping state
+func resetThrottle() {
+	if throttle != nil {
+		throttle.Reset()
+	}
+}
+
+// describeShaping summarizes the token bucket parameters
+func describeShaping() string {
+	return fmt.Sprintf("%s token bucket, %s burst, refilled before each sample and shared by every request", formatRate(throttle.BitsPerSecond()), formatBytes(throttle.Burst()))
+}
+
+// printShaping records the shaping parameters below the results so runs can be reproduced
+func printShaping() {
+	if throttle == nil {
+		return
+	}
+
+	fmt.Printf("Shaping: %s (--limit-rate %d --limit-burst %d)\n", describeShaping(), throttle.BitsPerSecond(), throttle.Burst())
+}
+
+// reportShaping returns the shaping parameters for the run report, or nil without shaping
+func reportShaping() *report.Shaping {
+	if throttle == nil {
+		return nil
+	}
+
+	return &report.Shaping{BitsPerSecond: throttle.BitsPerSecond(), BurstBytes: throttle.Burst()}
+}
+
+// formatRate renders bits per second in kbit/s or Mbit/s
+func formatRate(bps int64) string {
+	switch {
+	case bps >= 1e6:
+		return strconv.FormatFloat(float64(bps)/1e6, 'f', -1, 64) + " Mbit/s"
+	case bps >= 1e3:
+		return strconv.FormatFloat(float64(bps)/1e3, 'f', -1, 64) + " kbit/s"
+	}
+
+	return fmt.Sprintf("%d bit/s", bps)
+}
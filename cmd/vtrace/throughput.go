@@ -0,0 +1,76 @@
+package main
+
+import (
+	"fmt"
+
+	"codeberg.org/pwnderpants/vtrace/internal/stats"
+	"codeberg.org/pwnderpants/vtrace/internal/ttff"
+)
+
+// printThroughput lists the sizes and effective download rates of the manifest and segment,
+// and compares the segment rate with the bandwidth the variant declares
+func printThroughput(allSamples []ttff.Sample) {
+	timings := ttff.Timings(allSamples)
+
+	segmentRates := stats.ExtractSegmentThroughput(timings)
+	segmentStats := stats.ComputeValueStats(segmentRates)
+
+	if segmentStats.Max == 0 {
+		return
+	}
+
+	rows := []struct {
+		label string
+		sizes []float64
+		rates []float64
+	}{
+		{"Manifest:", stats.ExtractManifestBytes(timings), stats.ExtractManifestThroughput(timings)},
+		{"Segment:", stats.ExtractSegmentBytes(timings), segmentRates},
+	}
+
+	fmt.Println("\nThroughput:")
+
+	if len(allSamples) == 1 {
+		fmt.Printf("  %-18s %12s %14s\n", "", "Size", "Throughput")
+
+		for _, row := range rows {
+			fmt.Printf("  %-18s %12s %14s\n", row.label, formatBytes(int(row.sizes[0])), formatMbps(row.rates[0]))
+		}
+	} else {
+		fmt.Printf("  %-18s %12s %14s %14s %14s %14s\n", "", "Avg Size", "Avg", "Min", "Max", "Median")
+
+		for _, row := range rows {
+			size := stats.ComputeValueStats(row.sizes)
+			rate := stats.ComputeValueStats(row.rates)
+
+			fmt.Printf("  %-18s %12s %14s %14s %14s %14s\n",
+				row.label,
+				formatBytes(int(size.Mean)),
+				formatMbps(rate.Mean),
+				formatMbps(rate.Min),
+				formatMbps(rate.Max),
+				formatMbps(rate.Median),
+			)
+		}
+	}
+
+	declared := allSamples[0].DeclaredBandwidth
+
+	if declared == 0 {
+		return
+	}
+
+	// A segment arriving slower than the variant's bitrate cannot sustain playback
+	ratio := segmentStats.Mean / float64(declared)
+
+	fmt.Printf("  Declared BANDWIDTH: %s (segment throughput %sx)\n", formatMbps(float64(declared)), numberFormat.Number(ratio))
+
+	if ratio < 1 {
+		fmt.Println("  warning: segments arrive slower than the declared BANDWIDTH; a player would switch down or stall")
+	}
+}
+
+// formatMbps renders a rate in bits per second as megabits per second
+func formatMbps(bps float64) string {
+	return numberFormat.Number(bps/1e6) + " Mbps"
+}
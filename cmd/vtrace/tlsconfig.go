@@ -0,0 +1,105 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"codeberg.org/pwnderpants/vtrace/internal/probe"
+)
+
+var (
+	tlsMinSpec     string
+	insecureTLS    bool
+	caCertPath     string
+	clientCertPath string
+	clientKeyPath  string
+
+	// tlsSettings holds the parsed TLS flags applied to every measurement client
+	tlsSettings probe.TLSSettings
+)
+
+// tlsVersions maps --tls-min values to TLS protocol versions
+var tlsVersions = map[string]uint16{
+	"1.0": tls.VersionTLS10,
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// setupTLS parses --tls-min, --insecure, --cacert, and --cert/--key
+func setupTLS() error {
+	tlsSettings = probe.TLSSettings{InsecureSkipVerify: insecureTLS}
+
+	if tlsMinSpec != "" {
+		version, ok := tlsVersions[strings.TrimPrefix(strings.TrimSpace(tlsMinSpec), "v")]
+		if !ok {
+			return fmt.Errorf("invalid --tls-min %q (want 1.0, 1.1, 1.2, or 1.3)", tlsMinSpec)
+		}
+
+		tlsSettings.MinVersion = version
+	}
+
+	// Like curl, a custom CA bundle replaces the system roots rather than extending them
+	if caCertPath != "" {
+		pem, err := os.ReadFile(caCertPath)
+		if err != nil {
+			return fmt.Errorf("failed to read --cacert: %w", err)
+		}
+
+		pool := x509.NewCertPool()
+
+		if !pool.AppendCertsFromPEM(pem) {
+			return fmt.Errorf("no PEM certificates found in %s", caCertPath)
+		}
+
+		tlsSettings.RootCAs = pool
+	}
+
+	switch {
+	case clientKeyPath != "" && clientCertPath == "":
+		return errors.New("--key requires --cert")
+	case clientCertPath != "":
+		// A single PEM file may hold both the certificate and its key
+		keyPath := clientKeyPath
+
+		if keyPath == "" {
+			keyPath = clientCertPath
+		}
+
+		cert, err := tls.LoadX509KeyPair(clientCertPath, keyPath)
+		if err != nil {
+			return fmt.Errorf("failed to load client certificate: %w", err)
+		}
+
+		tlsSettings.Certificates = []tls.Certificate{cert}
+	}
+
+	if verbose {
+		printTLSSettings()
+	}
+
+	return nil
+}
+
+// printTLSSettings describes the non-default TLS flags in effect
+func printTLSSettings() {
+	if tlsMinSpec != "" {
+		fmt.Printf("Minimum TLS version: %s\n", tls.VersionName(tlsSettings.MinVersion))
+	}
+
+	if insecureTLS {
+		fmt.Println("TLS certificate verification: disabled (--insecure)")
+	}
+
+	if caCertPath != "" {
+		fmt.Printf("TLS roots: %s\n", caCertPath)
+	}
+
+	if clientCertPath != "" {
+		fmt.Printf("Client certificate: %s\n", clientCertPath)
+	}
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"codeberg.org/pwnderpants/vtrace/internal/probe"
+	"codeberg.org/pwnderpants/vtrace/internal/report"
+	"codeberg.org/pwnderpants/vtrace/internal/sink"
+	"codeberg.org/pwnderpants/vtrace/internal/ttff"
+)
+
+var uploadTarget string
+
+var (
+	// runReport collects samples for the uploaded report when --upload is set
+	runReport *report.Report
+
+	// uploadDest and uploadCreds are resolved from --upload and the environment
+	uploadDest  sink.S3Target
+	uploadCreds sink.S3Credentials
+)
+
+// prepareUpload validates the upload target and credentials before measuring
+func prepareUpload() error {
+	var err error
+
+	uploadDest, err = sink.ParseS3URL(uploadTarget)
+	if err != nil {
+		return err
+	}
+
+	uploadCreds, err = sink.S3CredentialsFromEnv()
+	if err != nil {
+		return err
+	}
+
+	runReport = report.New(runID, exportURL(url))
+	runReport.Shaping = reportShaping()
+
+	return nil
+}
+
+// addReportSample records a completed sample in the run report
+func addReportSample(index int, protocol string, sample ttff.Sample) {
+	runReport.Add(report.Sample{
+		Index:    index + 1,
+		Protocol: protocol,
+		Time:     time.Now().UTC(),
+		Metrics:  sampleMetrics(sample),
+
+		Negotiated: sampleNegotiated(sample),
+	})
+}
+
+// uploadReport renders the run report as JSON and HTML and uploads both objects
+func uploadReport() {
+	if runReport == nil {
+		return
+	}
+
+	runReport.Finish()
+
+	jsonBody, err := runReport.JSON()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "warning: %v\n", err)
+
+		return
+	}
+
+	htmlBody, err := runReport.HTML()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "warning: %v\n", err)
+
+		return
+	}
+
+	objects := []struct {
+		name        string
+		contentType string
+		body        []byte
+	}{
+		{"report.json", "application/json", jsonBody},
+		{"report.html", "text/html; charset=utf-8", htmlBody},
+	}
+
+	client := probe.NewHTTPClient(timeout)
+
+	// Upload failures are reported but never fail the run
+	for _, obj := range objects {
+		key := uploadDest.Key(runID + "/" + obj.name)
+
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		err := sink.PutS3Object(ctx, uploadCreds, uploadDest.Bucket, key, obj.contentType, obj.body, client)
+		cancel()
+
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "warning: %v\n", err)
+
+			continue
+		}
+
+		fmt.Printf("Report uploaded to s3://%s/%s\n", uploadDest.Bucket, key)
+	}
+}
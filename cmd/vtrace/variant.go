@@ -0,0 +1,56 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/grafov/m3u8"
+
+	"codeberg.org/pwnderpants/vtrace/internal/probe"
+)
+
+var (
+	variantBandwidth  string
+	variantResolution string
+	variantIndex      int
+)
+
+// variantStrategy picks the rendition to measure from a master playlist
+var variantStrategy = probe.FirstVariant()
+
+// parseVariantFlags builds the variant strategy from the selection flags
+func parseVariantFlags() (probe.VariantStrategy, error) {
+	set := 0
+
+	for _, given := range []bool{variantBandwidth != "", variantResolution != "", variantIndex >= 0} {
+		if given {
+			set++
+		}
+	}
+
+	if set > 1 {
+		return nil, errors.New("use only one of --variant-bandwidth, --variant-resolution, and --variant-index")
+	}
+
+	switch {
+	case variantBandwidth != "":
+		return probe.VariantByBandwidth(variantBandwidth)
+	case variantResolution != "":
+		return probe.VariantByResolution(variantResolution)
+	case variantIndex >= 0:
+		return probe.VariantByIndex(variantIndex), nil
+	}
+
+	return probe.FirstVariant(), nil
+}
+
+// describeVariant summarizes a variant's bandwidth and resolution
+func describeVariant(variant *m3u8.Variant) string {
+	resolution := variant.Resolution
+
+	if resolution == "" {
+		resolution = "unknown resolution"
+	}
+
+	return fmt.Sprintf("%d bps, %s", variant.Bandwidth, resolution)
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"time"
+
+	"codeberg.org/pwnderpants/vtrace/internal/stats"
+	"codeberg.org/pwnderpants/vtrace/internal/ttff"
+)
+
+var (
+	watchMode     bool
+	watchInterval time.Duration
+	watchWindow   int
+)
+
+// validateWatch checks the watch settings and rejects modes that end on their own
+func validateWatch() error {
+	if !watchMode {
+		return nil
+	}
+
+	switch {
+	case watchInterval <= 0:
+		return errors.New("--interval must be positive")
+	case watchWindow < 2:
+		return errors.New("--window must be at least 2 samples")
+	case compare:
+		return errors.New("--watch cannot be combined with --compare")
+	case checkMode:
+		return errors.New("--watch cannot be combined with --check")
+	case urlFile != "":
+		return errors.New("--watch cannot be combined with --url-file")
+	case allVariants:
+		return errors.New("--watch cannot be combined with --all-variants")
+	case len(resolverSpecs) > 0 || len(interfaceNames) > 0:
+		return errors.New("--watch cannot be combined with --resolvers or --interfaces")
+	case templatePath != "" || outputFormat == outputInflux:
+		return errors.New("--watch cannot be combined with --template or --output influx")
+	case confidenceLevel > 0:
+		return errors.New("--watch cannot be combined with --confidence")
+	case slaEnabled():
+		return errors.New("--watch cannot be combined with --fail-* thresholds")
+	}
+
+	return nil
+}
+
+// runWatch measures every --interval until interrupted, printing one line per sample
+// with rolling statistics, then the aggregate report of the whole session
+func runWatch() error {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	fmt.Printf("vtrace watch for: %s (every %s, rolling window of %d samples, Ctrl-C for the report)\n",
+		exportURL(url), watchInterval, watchWindow)
+
+	var (
+		allSamples []ttff.Sample
+		window     []time.Duration
+		failures   int
+	)
+
+	started := time.Now()
+
+	for i := 0; ; i++ {
+		begin := time.Now()
+
+		sample, _, _, err := measureSample(ctx, url, i, protocolHTTP12)
+
+		// A sample cut short by the interrupt is not a failure of the stream
+		if ctx.Err() != nil {
+			break
+		}
+
+		stamp := begin.UTC().Format(time.RFC3339)
+
+		if err != nil {
+			failures++
+
+			fmt.Printf("%s  #%-5d FAILED %v  (%d failed)\n", stamp, i+1, err, failures)
+		} else {
+			allSamples = append(allSamples, sample)
+			window = append(window, sample.TotalTTFF)
+
+			if len(window) > watchWindow {
+				window = window[1:]
+			}
+
+			rolling := stats.ComputeStats(window)
+
+			fmt.Printf("%s  #%-5d TTFF %10s  manifest %10s  segment %10s  frame %10s  | last %d: mean %s p95 %s\n",
+				stamp, i+1,
+				formatDuration(sample.TotalTTFF),
+				formatDuration(sample.ManifestTotal),
+				formatDuration(sample.SegmentTotal),
+				formatDuration(sample.FrameDetection),
+				len(window),
+				formatDuration(rolling.Mean),
+				formatDuration(rolling.Percentile(95)),
+			)
+		}
+
+		// Intervals are measured start to start, so slow samples do not stretch the cadence
+		wait := watchInterval - time.Since(begin)
+
+		if wait > 0 {
+			select {
+			case <-ctx.Done():
+			case <-time.After(wait):
+			}
+		}
+
+		if ctx.Err() != nil {
+			break
+		}
+	}
+
+	fmt.Printf("\nWatched for %s: %d samples, %d failed\n",
+		time.Since(started).Round(time.Second), len(allSamples)+failures, failures)
+
+	if len(allSamples) == 0 {
+		return nil
+	}
+
+	printMultiSampleResults(exportURL(url), allSamples)
+	printReceiveBuffers()
+
+	return nil
+}
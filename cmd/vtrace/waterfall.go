@@ -0,0 +1,140 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"codeberg.org/pwnderpants/vtrace/internal/ttff"
+)
+
+// showWaterfall prints the start-up sequence of every sample as a waterfall
+var showWaterfall bool
+
+// waterfallWidth is the number of cells the longest sample spans
+const waterfallWidth = 48
+
+// waterfallPhase is one step of the start-up sequence, in the order it ran
+type waterfallPhase struct {
+	label    string
+	duration time.Duration
+}
+
+// validateWaterfall rejects modes that print no per-sample tables
+func validateWaterfall() error {
+	if !showWaterfall {
+		return nil
+	}
+
+	switch {
+	case templatePath != "" || outputFormat == outputInflux:
+		return errors.New("--waterfall cannot be combined with --template or --output influx")
+	case checkMode:
+		return errors.New("--waterfall cannot be combined with --check")
+	case watchMode:
+		return errors.New("--waterfall cannot be combined with --watch")
+	}
+
+	return nil
+}
+
+// waterfallPhases splits a sample into the steps a player waits for one after another. The
+// manifest request counts its own connection setup, so the bar for the manifest is what
+// remains of it once DNS, connect, and the handshakes are drawn.
+func waterfallPhases(sample ttff.Sample) []waterfallPhase {
+	setup := sample.Redirects + sample.DNSLookup + sample.TCPConnect + sample.TLSHandshake + sample.QUICHandshake
+
+	phases := []waterfallPhase{
+		{"Redirects", sample.Redirects},
+		{"DNS Lookup", sample.DNSLookup},
+		{"TCP Connect", sample.TCPConnect},
+		{"TLS Handshake", sample.TLSHandshake},
+		{"QUIC Handshake", sample.QUICHandshake},
+		{"Manifest", max(sample.ManifestTotal-setup, 0)},
+		{"Media Playlist", sample.MediaPlaylist},
+		{"Blocking Reload", sample.BlockingReload},
+		{"Key Fetch", sample.KeyFetch},
+		{"Init Segment", sample.InitSegment},
+		{strings.TrimSuffix(segmentPhaseLabel(), ":"), sample.SegmentTotal},
+		{"Frame Detection", sample.FrameDetection},
+	}
+
+	// Phases that did not happen (e.g., DNS on a reused connection) are left out
+	ran := phases[:0]
+
+	for _, phase := range phases {
+		if phase.duration > 0 {
+			ran = append(ran, phase)
+		}
+	}
+
+	return ran
+}
+
+// waterfallSpan returns how long the phases of a sample took end to end
+func waterfallSpan(phases []waterfallPhase) time.Duration {
+	var span time.Duration
+
+	for _, phase := range phases {
+		span += phase.duration
+	}
+
+	return span
+}
+
+// printWaterfalls draws every sample as a waterfall of its phases. All samples share the
+// scale of the longest, so their bars compare across samples.
+func printWaterfalls(prefix string, allSamples []ttff.Sample) {
+	if !showWaterfall || len(allSamples) == 0 {
+		return
+	}
+
+	var scale time.Duration
+
+	for _, sample := range allSamples {
+		scale = max(scale, waterfallSpan(waterfallPhases(sample)))
+	}
+
+	if scale == 0 {
+		return
+	}
+
+	for i, sample := range allSamples {
+		phases := waterfallPhases(sample)
+
+		if len(allSamples) == 1 {
+			fmt.Printf("\n%sWaterfall:\n", prefix)
+		} else {
+			fmt.Printf("\n%sWaterfall, sample %d:\n", prefix, i+1)
+		}
+
+		var offset time.Duration
+
+		for _, phase := range phases {
+			fmt.Printf("  %-18s │%s│ %10s\n", phase.label, waterfallBar(offset, phase.duration, scale), formatDuration(phase.duration))
+
+			offset += phase.duration
+		}
+
+		fmt.Printf("  %-18s  %s  %10s\n", "Total TTFF", strings.Repeat(" ", waterfallWidth), formatDuration(sample.TotalTTFF))
+
+		// The playlist reloads are drawn where they ran but TotalTTFF leaves them out
+		if outside := sample.MediaPlaylist + sample.BlockingReload; outside > 0 {
+			fmt.Printf("  Media playlist fetches (%s) are drawn where they ran but are not part of Total TTFF\n", formatDuration(outside))
+		}
+	}
+}
+
+// waterfallBar draws a phase that starts at offset as a row of cells; a phase too short for
+// a cell of its own still gets one, so every phase that ran shows up
+func waterfallBar(offset, duration, scale time.Duration) string {
+	cell := func(d time.Duration) int {
+		return int((d*waterfallWidth + scale/2) / scale)
+	}
+
+	start := min(cell(offset), waterfallWidth-1)
+	end := min(max(cell(offset+duration), start+1), waterfallWidth)
+
+	return strings.Repeat(" ", start) + strings.Repeat("█", end-start) + strings.Repeat(" ", waterfallWidth-end)
+}
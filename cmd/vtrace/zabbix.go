@@ -0,0 +1,37 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"codeberg.org/pwnderpants/vtrace/internal/sink"
+	"codeberg.org/pwnderpants/vtrace/internal/ttff"
+)
+
+var (
+	zabbixServer    string
+	zabbixHost      string
+	zabbixKeyPrefix string
+)
+
+// emitZabbix pushes the sample's phase timings to the configured Zabbix server
+func emitZabbix(sample ttff.Sample) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	items := sink.ZabbixItems(zabbixHost, zabbixKeyPrefix, sampleMetrics(sample), time.Now())
+
+	// Zabbix delivery is best effort and never fails the run
+	info, err := sink.SendZabbix(ctx, zabbixServer, items)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "warning: %v\n", err)
+
+		return
+	}
+
+	if verbose {
+		fmt.Printf("  Zabbix: %s\n", info)
+	}
+}
@@ -0,0 +1,97 @@
+package anomaly
+
+import (
+	"math"
+	"sort"
+)
+
+// Defaults for the exponentially weighted baseline
+const (
+	DefaultAlpha  = 0.1
+	DefaultWarmup = 20
+)
+
+// Anomaly describes a metric value that strayed from its rolling baseline
+type Anomaly struct {
+	Metric string
+	Value  float64
+	Mean   float64
+	StdDev float64
+	Z      float64
+}
+
+// baseline is an exponentially weighted mean and variance of one metric
+type baseline struct {
+	count    int
+	mean     float64
+	variance float64
+}
+
+// Detector flags metric values whose z-score against an EWMA baseline exceeds a threshold.
+// Baselines adapt as samples arrive, so level shifts become the new normal instead of
+// alerting forever, and no per-stream latency thresholds need to be configured.
+type Detector struct {
+	alpha     float64
+	threshold float64
+	warmup    int
+	baselines map[string]*baseline
+}
+
+// New returns a detector that flags |z| >= threshold once a metric has warmup samples
+func New(alpha, threshold float64, warmup int) *Detector {
+	return &Detector{
+		alpha:     alpha,
+		threshold: threshold,
+		warmup:    warmup,
+		baselines: make(map[string]*baseline),
+	}
+}
+
+// Observe scores one sample's metrics (in milliseconds) against their baselines, then
+// folds them in. Anomalies are returned sorted by metric name.
+func (d *Detector) Observe(metrics map[string]float64) []Anomaly {
+	var anomalies []Anomaly
+
+	for name, value := range metrics {
+		b := d.baselines[name]
+
+		if b == nil {
+			b = &baseline{mean: value}
+			d.baselines[name] = b
+		}
+
+		if b.count >= d.warmup {
+			stddev := b.stddev()
+			z := (value - b.mean) / stddev
+
+			if math.Abs(z) >= d.threshold {
+				anomalies = append(anomalies, Anomaly{Metric: name, Value: value, Mean: b.mean, StdDev: stddev, Z: z})
+			}
+		}
+
+		b.update(value, d.alpha)
+	}
+
+	sort.Slice(anomalies, func(i, j int) bool {
+		return anomalies[i].Metric < anomalies[j].Metric
+	})
+
+	return anomalies
+}
+
+// update folds a value into the exponentially weighted mean and variance
+func (b *baseline) update(value, alpha float64) {
+	b.count++
+
+	diff := value - b.mean
+	increment := alpha * diff
+
+	b.mean += increment
+	b.variance = (1 - alpha) * (b.variance + diff*increment)
+}
+
+// stddev returns the baseline deviation, floored at 5% of the mean and 1ms so
+// near-constant phases do not turn sub-millisecond jitter into huge z-scores
+func (b *baseline) stddev() float64 {
+	return max(math.Sqrt(b.variance), 0.05*math.Abs(b.mean), 1)
+}
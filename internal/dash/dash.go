@@ -0,0 +1,435 @@
+package dash
+
+import (
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"codeberg.org/pwnderpants/vtrace/internal/probe"
+)
+
+var (
+	ErrNoVideo           = errors.New("MPD has no video representation")
+	ErrNoSegments        = errors.New("representation has no addressable segments")
+	ErrInvalidManifest   = errors.New("invalid or unrecognized MPD")
+	ErrUnsupportedFormat = errors.New("unsupported segment template format")
+	ErrNotAvailable      = errors.New("no segment of the live period is available yet")
+	ErrNotLowLatency     = errors.New("MPD is not a low-latency presentation (dynamic with an availabilityTimeOffset)")
+)
+
+// templateIdentifier matches $Identifier$ and $Identifier%0Nd$ in SegmentTemplate URLs
+var templateIdentifier = regexp.MustCompile(`\$(RepresentationID|Number|Bandwidth|Time|SubNumber)(%0(\d+)d)?\$`)
+
+// MPD is the root of a DASH media presentation description
+type MPD struct {
+	XMLName                    xml.Name  `xml:"MPD"`
+	Type                       string    `xml:"type,attr"`
+	AvailabilityStartTime      string    `xml:"availabilityStartTime,attr"`
+	MediaPresentationDuration  string    `xml:"mediaPresentationDuration,attr"`
+	SuggestedPresentationDelay string    `xml:"suggestedPresentationDelay,attr"`
+	BaseURLs                   []BaseURL `xml:"BaseURL"`
+	Periods                    []Period  `xml:"Period"`
+}
+
+// BaseURL is a BaseURL element, whose availabilityTimeOffset adds to those of the levels below it
+type BaseURL struct {
+	URL                    string `xml:",chardata"`
+	AvailabilityTimeOffset string `xml:"availabilityTimeOffset,attr"`
+}
+
+// Period is a single MPD period
+type Period struct {
+	ID              string           `xml:"id,attr"`
+	Start           string           `xml:"start,attr"`
+	Duration        string           `xml:"duration,attr"`
+	BaseURLs        []BaseURL        `xml:"BaseURL"`
+	AdaptationSets  []AdaptationSet  `xml:"AdaptationSet"`
+	SegmentTemplate *SegmentTemplate `xml:"SegmentTemplate"`
+	SegmentList     *SegmentList     `xml:"SegmentList"`
+}
+
+// AdaptationSet groups interchangeable representations of one component
+type AdaptationSet struct {
+	ContentType     string           `xml:"contentType,attr"`
+	MimeType        string           `xml:"mimeType,attr"`
+	BaseURLs        []BaseURL        `xml:"BaseURL"`
+	SegmentTemplate *SegmentTemplate `xml:"SegmentTemplate"`
+	SegmentList     *SegmentList     `xml:"SegmentList"`
+	Representations []Representation `xml:"Representation"`
+}
+
+// Representation is a single encoded version of a component
+type Representation struct {
+	ID              string           `xml:"id,attr"`
+	Bandwidth       uint64           `xml:"bandwidth,attr"`
+	MimeType        string           `xml:"mimeType,attr"`
+	Width           int              `xml:"width,attr"`
+	Height          int              `xml:"height,attr"`
+	BaseURLs        []BaseURL        `xml:"BaseURL"`
+	SegmentTemplate *SegmentTemplate `xml:"SegmentTemplate"`
+	SegmentList     *SegmentList     `xml:"SegmentList"`
+}
+
+// SegmentTemplate addresses segments through URL templates
+type SegmentTemplate struct {
+	Initialization         string           `xml:"initialization,attr"`
+	Media                  string           `xml:"media,attr"`
+	StartNumber            *uint64          `xml:"startNumber,attr"`
+	Timescale              uint64           `xml:"timescale,attr"`
+	Duration               uint64           `xml:"duration,attr"`
+	PresentationTimeOffset uint64           `xml:"presentationTimeOffset,attr"`
+	AvailabilityTimeOffset string           `xml:"availabilityTimeOffset,attr"`
+	SegmentTimeline        *SegmentTimeline `xml:"SegmentTimeline"`
+}
+
+// SegmentTimeline lists explicit segment start times and durations
+type SegmentTimeline struct {
+	S []TimelineEntry `xml:"S"`
+}
+
+// TimelineEntry is a single S element of a SegmentTimeline
+type TimelineEntry struct {
+	T *uint64 `xml:"t,attr"`
+	D uint64  `xml:"d,attr"`
+	R int64   `xml:"r,attr"`
+}
+
+// SegmentList addresses segments through explicit URLs
+type SegmentList struct {
+	Initialization *struct {
+		SourceURL string `xml:"sourceURL,attr"`
+	} `xml:"Initialization"`
+	SegmentURLs []struct {
+		Media string `xml:"media,attr"`
+	} `xml:"SegmentURL"`
+}
+
+// ManifestResult holds the parsed MPD and associated trace data
+type ManifestResult struct {
+	MPD   *MPD
+	Trace *probe.Trace
+	Body  []byte
+}
+
+// Selection identifies the representation chosen for probing
+type Selection struct {
+	PeriodIndex    int
+	Period         *Period
+	AdaptationSet  *AdaptationSet
+	Representation *Representation
+}
+
+// FetchManifest fetches and parses an MPD from the given URL
+func FetchManifest(ctx context.Context, mpdURL string, client *http.Client) (*ManifestResult, error) {
+	resp, trace, err := probe.FetchWithTrace(ctx, mpdURL, client)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch MPD: %w", err)
+	}
+
+	return decodeManifest(resp, trace)
+}
+
+// FetchManifestHTTP3 fetches and parses an MPD using HTTP/3
+func FetchManifestHTTP3(ctx context.Context, mpdURL string, client *http.Client) (*ManifestResult, error) {
+	resp, trace, err := probe.FetchWithTraceHTTP3(ctx, mpdURL, client)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch MPD: %w", err)
+	}
+
+	return decodeManifest(resp, trace)
+}
+
+// maxErrorBody caps how much of an error response is kept for inspection
+const maxErrorBody = 1 << 20
+
+// decodeManifest reads and parses an MPD response body; an MPD that answers with an error
+// status or fails to parse is still returned, with its body and trace, alongside the error
+func decodeManifest(resp *http.Response, trace *probe.Trace) (*ManifestResult, error) {
+	defer resp.Body.Close()
+
+	// Error responses are kept so their body can be inspected
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, maxErrorBody))
+		trace.Bytes = int64(len(body))
+
+		return &ManifestResult{Trace: trace, Body: body}, fmt.Errorf("MPD fetch returned status %d", resp.StatusCode)
+	}
+
+	readStart := time.Now()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return &ManifestResult{Trace: trace, Body: body}, fmt.Errorf("failed to read MPD: %w", err)
+	}
+
+	// Total ends with the response headers; the download runs to the last byte of the body
+	trace.Bytes = int64(len(body))
+	trace.Download = trace.Total + time.Since(readStart)
+
+	result := &ManifestResult{Trace: trace, Body: body}
+
+	var mpd MPD
+
+	if err := xml.Unmarshal(body, &mpd); err != nil {
+		return result, fmt.Errorf("%w: %v", ErrInvalidManifest, err)
+	}
+
+	if len(mpd.Periods) == 0 {
+		return result, fmt.Errorf("%w: no periods", ErrInvalidManifest)
+	}
+
+	result.MPD = &mpd
+
+	return result, nil
+}
+
+// SelectVideo returns the first video representation of the period playback starts in:
+// the first period that has one in a static MPD, and the newest period already begun at now
+// in a dynamic one
+func SelectVideo(mpd *MPD, now time.Time) (*Selection, error) {
+	order, err := periodOrder(mpd, now)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, p := range order {
+		period := &mpd.Periods[p]
+
+		for a := range period.AdaptationSets {
+			set := &period.AdaptationSets[a]
+
+			for r := range set.Representations {
+				rep := &set.Representations[r]
+
+				if isVideo(set, rep) {
+					return &Selection{PeriodIndex: p, Period: period, AdaptationSet: set, Representation: rep}, nil
+				}
+			}
+		}
+	}
+
+	return nil, ErrNoVideo
+}
+
+// isVideo reports whether a representation carries video
+func isVideo(set *AdaptationSet, rep *Representation) bool {
+	if set.ContentType == "video" {
+		return true
+	}
+
+	mimeType := rep.MimeType
+
+	if mimeType == "" {
+		mimeType = set.MimeType
+	}
+
+	return strings.HasPrefix(mimeType, "video/")
+}
+
+// Segment is the initialization and media segment playback starts with
+type Segment struct {
+	InitURL  string
+	MediaURL string
+	Timing   *Timing
+}
+
+// ResolveSegment resolves the initialization segment of a selection and the media segment
+// playback starts with: the first one of a static MPD, or the one at the live edge of a
+// dynamic MPD at now
+func ResolveSegment(mpd *MPD, sel *Selection, mpdURL string, now time.Time) (*Segment, error) {
+	return resolveSegment(mpd, sel, mpdURL, now, false)
+}
+
+// ResolveLiveEdgeSegment resolves the segment at the live edge of a low-latency MPD at now,
+// ignoring suggestedPresentationDelay. Its availabilityTimeOffset makes that the segment
+// still being produced, which the origin delivers chunk by chunk.
+func ResolveLiveEdgeSegment(mpd *MPD, sel *Selection, mpdURL string, now time.Time) (*Segment, error) {
+	segment, err := resolveSegment(mpd, sel, mpdURL, now, true)
+	if err != nil {
+		return nil, err
+	}
+
+	if !segment.Timing.Dynamic || (segment.Timing.AvailabilityTimeOffset == 0 && !segment.Timing.Unbounded) {
+		return nil, ErrNotLowLatency
+	}
+
+	return segment, nil
+}
+
+// resolveSegment resolves the segments of a selection, from the live edge itself when
+// liveEdge is set
+func resolveSegment(mpd *MPD, sel *Selection, mpdURL string, now time.Time, liveEdge bool) (*Segment, error) {
+	base, err := probe.GetBaseURL(mpdURL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get base URL: %w", err)
+	}
+
+	timing, err := newTiming(mpd, sel)
+	if err != nil {
+		return nil, err
+	}
+
+	// BaseURL elements nest from MPD down to Representation
+	for _, level := range [][]BaseURL{mpd.BaseURLs, sel.Period.BaseURLs, sel.AdaptationSet.BaseURLs, sel.Representation.BaseURLs} {
+		if len(level) == 0 {
+			continue
+		}
+
+		base, err = probe.ResolveURL(base, strings.TrimSpace(level[0].URL))
+		if err != nil {
+			return nil, fmt.Errorf("failed to resolve BaseURL: %w", err)
+		}
+
+		if err := timing.addOffset(level[0].AvailabilityTimeOffset); err != nil {
+			return nil, err
+		}
+	}
+
+	rep := sel.Representation
+
+	// The most specific segment addressing wins
+	template := firstTemplate(rep.SegmentTemplate, sel.AdaptationSet.SegmentTemplate, sel.Period.SegmentTemplate)
+	list := firstList(rep.SegmentList, sel.AdaptationSet.SegmentList, sel.Period.SegmentList)
+
+	switch {
+	case template != nil:
+		if err := timing.addOffset(template.AvailabilityTimeOffset); err != nil {
+			return nil, err
+		}
+
+		return templateSegment(mpd, template, rep, base, timing, now, liveEdge)
+	case list != nil:
+		return listSegment(list, base, timing)
+	case len(rep.BaseURLs) > 0:
+		// SegmentBase: the whole representation is one self-initializing file
+		return &Segment{MediaURL: base, Timing: timing}, nil
+	}
+
+	return nil, ErrNoSegments
+}
+
+// templateSegment expands a SegmentTemplate for the media segment playback starts with
+func templateSegment(mpd *MPD, template *SegmentTemplate, rep *Representation, base string, timing *Timing, now time.Time, liveEdge bool) (*Segment, error) {
+	if template.Media == "" {
+		return nil, ErrNoSegments
+	}
+
+	if err := timing.locate(mpd, template, now, liveEdge); err != nil {
+		return nil, err
+	}
+
+	var initURL string
+
+	if template.Initialization != "" {
+		initPath, err := expandTemplate(template.Initialization, rep, timing.Number, timing.Time)
+		if err != nil {
+			return nil, err
+		}
+
+		initURL, err = probe.ResolveURL(base, initPath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to resolve initialization URL: %w", err)
+		}
+	}
+
+	mediaPath, err := expandTemplate(template.Media, rep, timing.Number, timing.Time)
+	if err != nil {
+		return nil, err
+	}
+
+	mediaURL, err := probe.ResolveURL(base, mediaPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve media URL: %w", err)
+	}
+
+	return &Segment{InitURL: initURL, MediaURL: mediaURL, Timing: timing}, nil
+}
+
+// listSegment picks the initialization and first media URL from a SegmentList
+func listSegment(list *SegmentList, base string, timing *Timing) (*Segment, error) {
+	if len(list.SegmentURLs) == 0 {
+		return nil, ErrNoSegments
+	}
+
+	var initURL string
+
+	if list.Initialization != nil && list.Initialization.SourceURL != "" {
+		var err error
+
+		initURL, err = probe.ResolveURL(base, list.Initialization.SourceURL)
+		if err != nil {
+			return nil, fmt.Errorf("failed to resolve initialization URL: %w", err)
+		}
+	}
+
+	mediaURL, err := probe.ResolveURL(base, list.SegmentURLs[0].Media)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve media URL: %w", err)
+	}
+
+	return &Segment{InitURL: initURL, MediaURL: mediaURL, Timing: timing}, nil
+}
+
+// expandTemplate substitutes DASH template identifiers (ISO/IEC 23009-1 5.3.9.4.4)
+func expandTemplate(template string, rep *Representation, number, segmentTime uint64) (string, error) {
+	var expandErr error
+
+	expanded := templateIdentifier.ReplaceAllStringFunc(template, func(match string) string {
+		parts := templateIdentifier.FindStringSubmatch(match)
+		width := 0
+
+		if parts[3] != "" {
+			width, _ = strconv.Atoi(parts[3])
+		}
+
+		switch parts[1] {
+		case "RepresentationID":
+			if width > 0 {
+				expandErr = fmt.Errorf("%w: %s", ErrUnsupportedFormat, match)
+			}
+
+			return rep.ID
+		case "Number":
+			return fmt.Sprintf("%0*d", width, number)
+		case "Bandwidth":
+			return fmt.Sprintf("%0*d", width, rep.Bandwidth)
+		case "Time":
+			return fmt.Sprintf("%0*d", width, segmentTime)
+		}
+
+		expandErr = fmt.Errorf("%w: %s", ErrUnsupportedFormat, match)
+
+		return match
+	})
+
+	return strings.ReplaceAll(expanded, "$$", "$"), expandErr
+}
+
+// firstTemplate returns the first non-nil SegmentTemplate
+func firstTemplate(templates ...*SegmentTemplate) *SegmentTemplate {
+	for _, t := range templates {
+		if t != nil {
+			return t
+		}
+	}
+
+	return nil
+}
+
+// firstList returns the first non-nil SegmentList
+func firstList(lists ...*SegmentList) *SegmentList {
+	for _, l := range lists {
+		if l != nil {
+			return l
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,440 @@
+package dash
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// xsDuration matches the xs:duration values MPD timing attributes use (e.g., PT1H2M3.5S)
+var xsDuration = regexp.MustCompile(`^P(?:(\d+)Y)?(?:(\d+)M)?(?:(\d+)D)?(?:T(?:(\d+)H)?(?:(\d+)M)?(?:(\d+(?:\.\d*)?)S)?)?$`)
+
+// PeriodBounds is the span of one period on the presentation timeline. End is zero for a
+// period that runs until the presentation ends.
+type PeriodBounds struct {
+	ID    string
+	Start time.Duration
+	End   time.Duration
+}
+
+// Timing places the selected media segment on the presentation timeline. Start is relative
+// to the start of its period; wall-clock times are only set for dynamic MPDs.
+type Timing struct {
+	Dynamic bool
+	Periods []PeriodBounds
+	Period  int
+
+	// Number and Time are the $Number$ and $Time$ of the segment
+	Number   uint64
+	Time     uint64
+	Start    time.Duration
+	Duration time.Duration
+
+	// AvailabilityTimeOffset is how long before its end a segment becomes available, summed
+	// over the BaseURL and SegmentTemplate levels. Unbounded marks an offset of INF, where a
+	// segment is available from the moment it starts.
+	AvailabilityTimeOffset time.Duration
+	Unbounded              bool
+
+	// PresentationDelay is the MPD's suggestedPresentationDelay behind the live edge
+	PresentationDelay time.Duration
+
+	// PresentationStart is when the segment's first frame is at the live edge, and
+	// AvailableAt when the segment could first be requested
+	PresentationStart time.Time
+	AvailableAt       time.Time
+
+	// InProgress is set when the segment was still being produced at selection time
+	InProgress bool
+}
+
+// Dynamic reports whether the MPD describes a live presentation
+func (m *MPD) Dynamic() bool {
+	return m.Type == "dynamic"
+}
+
+// PeriodBoundaries returns where each period starts and ends on the presentation timeline.
+// A period without a start attribute follows the one before it.
+func PeriodBoundaries(mpd *MPD) ([]PeriodBounds, error) {
+	bounds := make([]PeriodBounds, len(mpd.Periods))
+
+	var next time.Duration
+
+	for i, period := range mpd.Periods {
+		start := next
+
+		if period.Start != "" {
+			var err error
+
+			start, err = parseDuration(period.Start)
+			if err != nil {
+				return nil, fmt.Errorf("%w: period start: %v", ErrInvalidManifest, err)
+			}
+		}
+
+		bounds[i] = PeriodBounds{ID: period.ID, Start: start}
+		next = start
+
+		if period.Duration != "" {
+			duration, err := parseDuration(period.Duration)
+			if err != nil {
+				return nil, fmt.Errorf("%w: period duration: %v", ErrInvalidManifest, err)
+			}
+
+			bounds[i].End = start + duration
+			next = bounds[i].End
+		}
+	}
+
+	// A period without a duration ends where the next one starts, and the last one with
+	// the presentation
+	for i := range bounds {
+		if bounds[i].End != 0 {
+			continue
+		}
+
+		if i+1 < len(bounds) {
+			bounds[i].End = bounds[i+1].Start
+		} else if mpd.MediaPresentationDuration != "" {
+			duration, err := parseDuration(mpd.MediaPresentationDuration)
+			if err != nil {
+				return nil, fmt.Errorf("%w: mediaPresentationDuration: %v", ErrInvalidManifest, err)
+			}
+
+			bounds[i].End = duration
+		}
+	}
+
+	return bounds, nil
+}
+
+// periodOrder lists the periods to look for video in: every period in order for a static
+// MPD, and those already begun at now, newest first, for a dynamic one
+func periodOrder(mpd *MPD, now time.Time) ([]int, error) {
+	var order []int
+
+	if !mpd.Dynamic() {
+		for p := range mpd.Periods {
+			order = append(order, p)
+		}
+
+		return order, nil
+	}
+
+	bounds, err := PeriodBoundaries(mpd)
+	if err != nil {
+		return nil, err
+	}
+
+	availabilityStart, err := mpd.availabilityStart()
+	if err != nil {
+		return nil, err
+	}
+
+	elapsed := now.Sub(availabilityStart)
+
+	for p := len(bounds) - 1; p >= 0; p-- {
+		if bounds[p].Start <= elapsed {
+			order = append(order, p)
+		}
+	}
+
+	if len(order) == 0 {
+		return nil, fmt.Errorf("%w: the presentation starts at %s", ErrNotAvailable, availabilityStart.Add(bounds[0].Start).Format(time.RFC3339))
+	}
+
+	return order, nil
+}
+
+// availabilityStart parses the anchor of a dynamic MPD's timeline
+func (m *MPD) availabilityStart() (time.Time, error) {
+	if m.AvailabilityStartTime == "" {
+		return time.Time{}, fmt.Errorf("%w: dynamic MPD has no availabilityStartTime", ErrInvalidManifest)
+	}
+
+	start, err := parseDateTime(m.AvailabilityStartTime)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%w: availabilityStartTime: %v", ErrInvalidManifest, err)
+	}
+
+	return start, nil
+}
+
+// newTiming starts the timing of a selection with the MPD's periods and presentation delay
+func newTiming(mpd *MPD, sel *Selection) (*Timing, error) {
+	bounds, err := PeriodBoundaries(mpd)
+	if err != nil {
+		return nil, err
+	}
+
+	timing := &Timing{Dynamic: mpd.Dynamic(), Periods: bounds, Period: sel.PeriodIndex}
+
+	if mpd.SuggestedPresentationDelay != "" {
+		timing.PresentationDelay, err = parseDuration(mpd.SuggestedPresentationDelay)
+		if err != nil {
+			return nil, fmt.Errorf("%w: suggestedPresentationDelay: %v", ErrInvalidManifest, err)
+		}
+	}
+
+	return timing, nil
+}
+
+// addOffset adds one level's availabilityTimeOffset attribute
+func (t *Timing) addOffset(value string) error {
+	value = strings.TrimSpace(value)
+
+	if value == "" {
+		return nil
+	}
+
+	if value == "INF" {
+		t.Unbounded = true
+
+		return nil
+	}
+
+	seconds, err := strconv.ParseFloat(value, 64)
+	if err != nil || seconds < 0 {
+		return fmt.Errorf("%w: availabilityTimeOffset %q", ErrInvalidManifest, value)
+	}
+
+	t.AvailabilityTimeOffset += time.Duration(seconds * float64(time.Second))
+
+	return nil
+}
+
+// locate finds the segment of a template playback starts with: the first one of a static
+// MPD, and for a dynamic MPD the one suggestedPresentationDelay behind the live edge (or at
+// it, with liveEdge), or the newest available one when that is not available yet
+func (t *Timing) locate(mpd *MPD, template *SegmentTemplate, now time.Time, liveEdge bool) error {
+	timescale := template.Timescale
+
+	if timescale == 0 {
+		timescale = 1
+	}
+
+	startNumber := uint64(1)
+
+	if template.StartNumber != nil {
+		startNumber = *template.StartNumber
+	}
+
+	ticks := func(value uint64) time.Duration {
+		return time.Duration(float64(value) / float64(timescale) * float64(time.Second))
+	}
+
+	timeline := template.SegmentTimeline != nil && len(template.SegmentTimeline.S) > 0
+
+	if !t.Dynamic {
+		t.Number = startNumber
+		t.Duration = ticks(template.Duration)
+
+		if timeline {
+			first := template.SegmentTimeline.S[0]
+
+			if first.T != nil {
+				t.Time = *first.T
+			}
+
+			t.Duration = ticks(first.D)
+		}
+
+		t.Start = ticks(t.Time) - ticks(template.PresentationTimeOffset)
+
+		return nil
+	}
+
+	availabilityStart, err := mpd.availabilityStart()
+	if err != nil {
+		return err
+	}
+
+	period := t.Periods[t.Period]
+	periodStart := availabilityStart.Add(period.Start)
+	live := now.Sub(periodStart)
+	target := max(live-t.PresentationDelay, 0)
+
+	if liveEdge {
+		target = live
+	}
+
+	periodLength := time.Duration(math.MaxInt64)
+
+	if period.End > period.Start {
+		periodLength = period.End - period.Start
+	}
+
+	// available reports whether a segment spanning [start, end) of the period can be
+	// requested at now
+	available := func(start, end time.Duration) bool {
+		if start >= periodLength {
+			return false
+		}
+
+		if t.Unbounded {
+			return start <= live
+		}
+
+		return end-t.AvailabilityTimeOffset <= live
+	}
+
+	found := false
+
+	// choose keeps the newest available segment until one covers the target position
+	choose := func(number, segmentTime uint64, start, end time.Duration) {
+		if found && t.Start <= target && target < t.Start+t.Duration {
+			return
+		}
+
+		t.Number, t.Time, t.Start, t.Duration = number, segmentTime, start, end-start
+		found = true
+	}
+
+	if timeline {
+		offset := ticks(template.PresentationTimeOffset)
+
+		walkTimeline(template.SegmentTimeline, func(index, segmentTime, duration uint64) bool {
+			start := ticks(segmentTime) - offset
+			end := ticks(segmentTime+duration) - offset
+
+			if !available(start, end) {
+				return false
+			}
+
+			choose(startNumber+index, segmentTime, start, end)
+
+			return true
+		})
+	} else {
+		if template.Duration == 0 {
+			return ErrNoSegments
+		}
+
+		duration := ticks(template.Duration)
+
+		// The newest available segment is the last one to start (INF) or end by the live edge
+		newest := int64(math.Floor(float64(live+t.AvailabilityTimeOffset)/float64(duration))) - 1
+
+		if t.Unbounded {
+			newest = int64(math.Floor(float64(live) / float64(duration)))
+		}
+
+		if periodLength != time.Duration(math.MaxInt64) {
+			newest = min(newest, int64(math.Ceil(float64(periodLength)/float64(duration)))-1)
+		}
+
+		if newest >= 0 {
+			index := min(newest, int64(target/duration))
+			start := time.Duration(index) * duration
+
+			choose(startNumber+uint64(index), 0, start, start+duration)
+		}
+	}
+
+	if !found {
+		return fmt.Errorf("%w (period %s began %s ago)", ErrNotAvailable, periodName(period, t.Period), live.Round(time.Millisecond))
+	}
+
+	t.InProgress = t.Start+t.Duration > live
+	t.PresentationStart = periodStart.Add(t.Start)
+	t.AvailableAt = periodStart.Add(t.Start + t.Duration - t.AvailabilityTimeOffset)
+
+	if t.Unbounded {
+		t.AvailableAt = t.PresentationStart
+	}
+
+	return nil
+}
+
+// walkTimeline visits the segments of a SegmentTimeline in order with their index, $Time$,
+// and duration until visit returns false. A negative repeat count repeats the entry up to
+// the next S element, or until visit stops it.
+func walkTimeline(timeline *SegmentTimeline, visit func(index, segmentTime, duration uint64) bool) {
+	var (
+		index       uint64
+		segmentTime uint64
+	)
+
+	for i, entry := range timeline.S {
+		if entry.T != nil {
+			segmentTime = *entry.T
+		}
+
+		if entry.D == 0 {
+			return
+		}
+
+		for repeat := int64(0); entry.R < 0 || repeat <= entry.R; repeat++ {
+			if entry.R < 0 && i+1 < len(timeline.S) && timeline.S[i+1].T != nil && segmentTime >= *timeline.S[i+1].T {
+				break
+			}
+
+			if !visit(index, segmentTime, entry.D) {
+				return
+			}
+
+			index++
+			segmentTime += entry.D
+		}
+	}
+}
+
+// periodName identifies a period by its id, or by its position when it has none
+func periodName(period PeriodBounds, index int) string {
+	if period.ID != "" {
+		return strconv.Quote(period.ID)
+	}
+
+	return fmt.Sprintf("#%d", index+1)
+}
+
+// PeriodName identifies the period of the timing by its id, or by its position
+func (t *Timing) PeriodName() string {
+	return periodName(t.Periods[t.Period], t.Period)
+}
+
+// parseDuration parses an xs:duration, counting years as 365 days and months as 30
+func parseDuration(value string) (time.Duration, error) {
+	parts := xsDuration.FindStringSubmatch(strings.TrimSpace(value))
+	if parts == nil || value == "P" || strings.HasSuffix(value, "T") {
+		return 0, fmt.Errorf("invalid duration %q", value)
+	}
+
+	units := []time.Duration{365 * 24 * time.Hour, 30 * 24 * time.Hour, 24 * time.Hour, time.Hour, time.Minute, time.Second}
+
+	var total time.Duration
+
+	for i, unit := range units {
+		if parts[i+1] == "" {
+			continue
+		}
+
+		amount, err := strconv.ParseFloat(parts[i+1], 64)
+		if err != nil {
+			return 0, fmt.Errorf("invalid duration %q", value)
+		}
+
+		total += time.Duration(amount * float64(unit))
+	}
+
+	return total, nil
+}
+
+// parseDateTime parses an xs:dateTime, reading one without a time zone as UTC
+func parseDateTime(value string) (time.Time, error) {
+	value = strings.TrimSpace(value)
+
+	if parsed, err := time.Parse(time.RFC3339Nano, value); err == nil {
+		return parsed, nil
+	}
+
+	parsed, err := time.Parse("2006-01-02T15:04:05.999999999", value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid date and time %q", value)
+	}
+
+	return parsed, nil
+}
@@ -0,0 +1,147 @@
+package decoder
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// PMT stream types of audio codecs with a recognizable frame sync word
+const (
+	streamTypeMPEG1Audio = 0x03
+	streamTypeMPEG2Audio = 0x04
+	streamTypeADTS       = 0x0f
+	streamTypeLATM       = 0x11
+	streamTypeAC3        = 0x81
+	streamTypeEAC3       = 0x87
+)
+
+var ErrNoAudioFound = errors.New("no audio frames found in segment")
+
+// audioTarget finds the first audio frame
+var audioTarget = tsTarget{
+	pick:    pickAudioStream,
+	match:   audioFrameInPES,
+	missing: "no frame in the audio stream",
+}
+
+// DetectFirstAudioFrame detects the first audio frame, natively for MPEG-TS and
+// packed audio (ADTS, AC-3, MP3) segments and through ffprobe (or libav) otherwise
+func DetectFirstAudioFrame(ctx context.Context, segmentData []byte) (time.Duration, error) {
+	start := time.Now()
+
+	err := detectAudioFrame(segmentData)
+	if err == nil {
+		return time.Since(start), nil
+	}
+
+	if !errors.Is(err, ErrUnsupportedSegment) {
+		return 0, err
+	}
+
+	elapsed, _, fallbackErr := decodeFirstFrame(ctx, segmentData, "a:0", ErrNoAudioFound)
+	if errors.Is(fallbackErr, ErrFFprobeNotFound) {
+		return 0, fmt.Errorf("%w (needed because %v)", ErrFFprobeNotFound, err)
+	}
+
+	return elapsed, fallbackErr
+}
+
+// detectAudioFrame checks MPEG-TS segments through the PMT and treats anything
+// else as a packed audio segment (elementary stream with optional ID3 tags)
+func detectAudioFrame(data []byte) error {
+	if len(data) >= tsPacketSize && data[0] == tsSyncByte {
+		return scanTS(data, audioTarget)
+	}
+
+	if audioSyncAt(skipID3(data)) {
+		return nil
+	}
+
+	return fmt.Errorf("%w: not an MPEG-TS or packed audio segment", ErrUnsupportedSegment)
+}
+
+// pickAudioStream returns the first audio stream the native parser recognizes
+func pickAudioStream(streams []tsStream) (tsStream, error) {
+	for _, stream := range streams {
+		switch stream.streamType {
+		case streamTypeMPEG1Audio, streamTypeMPEG2Audio, streamTypeADTS, streamTypeLATM, streamTypeAC3, streamTypeEAC3:
+			return stream, nil
+		case 0x06:
+			// DVB private data may carry AC-3, Opus, or subtitles; only descriptors tell
+			return tsStream{}, fmt.Errorf("%w: private data stream", ErrUnsupportedSegment)
+		}
+	}
+
+	return tsStream{}, ErrNoAudioFound
+}
+
+// audioFrameInPES reports whether a PES packet payload starts an audio frame
+func audioFrameInPES(pes []byte, streamType byte) bool {
+	payload, ok := pesPayload(pes)
+	if !ok {
+		return false
+	}
+
+	// Audio frames need no decoding context, so any synced frame counts
+	for i := range payload {
+		if audioSyncOf(payload[i:], streamType) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// audioSyncOf reports whether data starts with the frame sync word of a stream type
+func audioSyncOf(data []byte, streamType byte) bool {
+	if len(data) < 2 {
+		return false
+	}
+
+	switch streamType {
+	case streamTypeADTS:
+		return data[0] == 0xff && data[1]&0xf6 == 0xf0
+	case streamTypeMPEG1Audio, streamTypeMPEG2Audio:
+		return data[0] == 0xff && data[1]&0xe0 == 0xe0 && data[1]&0x06 != 0
+	case streamTypeLATM:
+		return data[0] == 0x56 && data[1]&0xe0 == 0xe0
+	case streamTypeAC3, streamTypeEAC3:
+		return data[0] == 0x0b && data[1] == 0x77
+	}
+
+	return false
+}
+
+// audioSyncAt reports whether packed audio starts with an ADTS, MPEG audio, or AC-3 frame
+func audioSyncAt(data []byte) bool {
+	for _, streamType := range []byte{streamTypeADTS, streamTypeMPEG1Audio, streamTypeAC3} {
+		if audioSyncOf(data, streamType) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// skipID3 drops the ID3v2 tags packed audio segments start with (they carry the timestamp)
+func skipID3(data []byte) []byte {
+	for len(data) >= 10 && data[0] == 'I' && data[1] == 'D' && data[2] == '3' {
+		// The tag size is a 28-bit syncsafe integer excluding the 10-byte header
+		size := int(data[6]&0x7f)<<21 | int(data[7]&0x7f)<<14 | int(data[8]&0x7f)<<7 | int(data[9]&0x7f)
+
+		// A footer adds another 10 bytes
+		if data[5]&0x10 != 0 {
+			size += 10
+		}
+
+		if 10+size > len(data) {
+			return nil
+		}
+
+		data = data[10+size:]
+	}
+
+	return data
+}
@@ -0,0 +1,245 @@
+package decoder
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"slices"
+	"strconv"
+	"time"
+)
+
+// ptsWrap is the span of the 33-bit MPEG-TS presentation timestamp
+const ptsWrap = 1 << 33
+
+// Cadence describes the frame timing of a segment's video stream, reconstructed from
+// the presentation timestamps of its frames in display order
+type Cadence struct {
+	Frames    int
+	FrameRate float64
+
+	// Interval is the nominal frame interval: the most common gap between frames, or the
+	// mean frame duration of a 3:2 pulldown pattern
+	Interval time.Duration
+
+	// Dropped counts frames missing from gaps of 1.5 intervals or more, Duplicated frames
+	// sharing a timestamp, and Irregular the other intervals more than 10% off nominal
+	Dropped    int
+	Duplicated int
+	Irregular  int
+
+	// Telecine reports alternating two- and three-field frame durations (soft 3:2 pulldown)
+	Telecine bool
+
+	// Duration is the media time the frames cover: the span of their timestamps plus the
+	// display time of the last frame
+	Duration time.Duration
+}
+
+// DetectCadence measures the frame rate and cadence of the video stream, natively from the
+// PES timestamps of H.264/H.265 MPEG-TS segments and through ffprobe's packet list otherwise
+func DetectCadence(ctx context.Context, segmentData []byte) (*Cadence, error) {
+	timestamps, err := videoTimestampsTS(segmentData)
+
+	if errors.Is(err, ErrUnsupportedSegment) {
+		if _, lookErr := ffprobeBinary(); lookErr != nil {
+			return nil, fmt.Errorf("%w (needed because %v)", ErrFFprobeNotFound, err)
+		}
+
+		timestamps, err = probeVideoTimestamps(ctx, segmentData)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return analyzeCadence(timestamps)
+}
+
+// videoTimestampsTS collects the PTS of every video PES packet, assuming one frame per
+// packet as HLS packagers write them, unwrapped relative to the first
+func videoTimestampsTS(data []byte) ([]time.Duration, error) {
+	var (
+		timestamps []time.Duration
+		first      int64 = -1
+	)
+
+	target := tsTarget{
+		pick: pickVideoStream,
+		match: func(pes []byte, _ byte) bool {
+			pts, ok := pesPTS(pes)
+			if !ok {
+				return false
+			}
+
+			if first < 0 {
+				first = pts
+			}
+
+			// Timestamps before the first (B-frames) or across a wrap stay close to it
+			offset := (pts - first + ptsWrap/2) % ptsWrap
+			if offset < 0 {
+				offset += ptsWrap
+			}
+
+			timestamps = append(timestamps, time.Duration(offset-ptsWrap/2)*time.Second/90000)
+
+			return true
+		},
+		missing: "no timestamped video PES packet",
+		all:     true,
+	}
+
+	if err := scanTS(data, target); err != nil {
+		return nil, err
+	}
+
+	return timestamps, nil
+}
+
+// ffprobePackets is the part of ffprobe's -show_packets output with packet timestamps
+type ffprobePackets struct {
+	Packets []struct {
+		PtsTime string `json:"pts_time"`
+	} `json:"packets"`
+}
+
+// probeVideoTimestamps lists the presentation timestamps of the first video stream's
+// packets through ffprobe, which demuxes without decoding
+func probeVideoTimestamps(ctx context.Context, segmentData []byte) ([]time.Duration, error) {
+	stdout, err := runFFprobe(ctx, segmentData, "-v", "error", "-select_streams", "v:0", "-show_packets",
+		"-show_entries", "packet=pts_time", "-print_format", "json", "-i", "pipe:0")
+	if err != nil {
+		return nil, err
+	}
+
+	var output ffprobePackets
+
+	if err := json.Unmarshal(stdout, &output); err != nil {
+		return nil, fmt.Errorf("failed to parse ffprobe output: %w", err)
+	}
+
+	var timestamps []time.Duration
+
+	for _, packet := range output.Packets {
+		seconds, err := strconv.ParseFloat(packet.PtsTime, 64)
+		if err != nil {
+			continue
+		}
+
+		timestamps = append(timestamps, time.Duration(seconds*float64(time.Second)))
+	}
+
+	return timestamps, nil
+}
+
+// analyzeCadence puts the timestamps in display order and classifies the gaps between them
+func analyzeCadence(timestamps []time.Duration) (*Cadence, error) {
+	if len(timestamps) < 3 {
+		return nil, fmt.Errorf("%w: %d timestamped frames, need at least 3", ErrNoFramesFound, len(timestamps))
+	}
+
+	sorted := slices.Clone(timestamps)
+	slices.Sort(sorted)
+
+	var intervals []time.Duration
+
+	for i := 1; i < len(sorted); i++ {
+		intervals = append(intervals, sorted[i]-sorted[i-1])
+	}
+
+	cadence := &Cadence{Frames: len(sorted)}
+
+	nominal := modeInterval(intervals)
+	if nominal <= 0 {
+		return nil, fmt.Errorf("%w: every frame shares one timestamp", ErrNoFramesFound)
+	}
+
+	// Soft pulldown alternates two-field and three-field frames (e.g., 3003 and 4504 ticks)
+	short, long := 0, 0
+
+	for _, interval := range intervals {
+		switch {
+		case near(interval, nominal, 0.05):
+			short++
+		case near(interval, nominal*3/2, 0.05):
+			long++
+		}
+	}
+
+	if long >= len(intervals)/4 && short >= len(intervals)/4 && long > 0 {
+		cadence.Telecine = true
+	}
+
+	for _, interval := range intervals {
+		switch {
+		case interval == 0:
+			cadence.Duplicated++
+		case cadence.Telecine && (near(interval, nominal, 0.05) || near(interval, nominal*3/2, 0.05)):
+		case near(interval, nominal, 0.1):
+		case interval >= nominal*3/2:
+			cadence.Dropped += int(math.Round(float64(interval)/float64(nominal))) - 1
+		default:
+			cadence.Irregular++
+		}
+	}
+
+	cadence.Interval = nominal
+
+	if cadence.Telecine {
+		cadence.Interval = nominal * 5 / 4
+	}
+
+	span := sorted[len(sorted)-1] - sorted[0]
+
+	if span > 0 {
+		cadence.FrameRate = float64(len(sorted)-1) / span.Seconds()
+	}
+
+	cadence.Duration = span + cadence.Interval
+
+	return cadence, nil
+}
+
+// modeInterval returns the most common non-zero interval, treating intervals within
+// a millisecond as equal so rounded timestamps still agree
+func modeInterval(intervals []time.Duration) time.Duration {
+	counts := make(map[time.Duration]int)
+
+	var best time.Duration
+
+	for _, interval := range intervals {
+		if interval <= 0 {
+			continue
+		}
+
+		bucket := interval.Round(time.Millisecond)
+		counts[bucket]++
+
+		if counts[bucket] > counts[best] || (counts[bucket] == counts[best] && bucket < best) {
+			best = bucket
+		}
+	}
+
+	if best == 0 {
+		return 0
+	}
+
+	// Average the members of the winning bucket to recover the exact interval
+	var sum time.Duration
+
+	for _, interval := range intervals {
+		if interval > 0 && interval.Round(time.Millisecond) == best {
+			sum += interval
+		}
+	}
+
+	return sum / time.Duration(counts[best])
+}
+
+// near reports whether a duration is within a relative tolerance of a target
+func near(value, target time.Duration, tolerance float64) bool {
+	return math.Abs(float64(value-target)) <= float64(target)*tolerance
+}
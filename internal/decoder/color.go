@@ -0,0 +1,356 @@
+package decoder
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Dynamic ranges as named by the HLS VIDEO-RANGE attribute
+const (
+	RangeSDR = "SDR"
+	RangePQ  = "PQ"
+	RangeHLG = "HLG"
+)
+
+// Transfer characteristics (ffprobe names) that select a dynamic range
+const (
+	transferPQ  = "smpte2084"
+	transferHLG = "arib-std-b67"
+)
+
+// StreamInfo describes the coded video of a segment as signalled in its sequence parameter
+// set and SEI messages. Color fields use ffprobe's names (e.g., "bt2020", "smpte2084") and
+// are empty when the stream does not describe them.
+type StreamInfo struct {
+	Codec    string
+	BitDepth int
+
+	// Profile and Level are the profile_idc and level_idc of H.264, or the general
+	// profile and level of H.265 (30 times the level number)
+	Profile  int
+	Level    int
+	HighTier bool
+
+	// CodecString is the RFC 6381 codec the parameter set describes (e.g., avc1.640028),
+	// empty when ffprobe read the stream
+	CodecString string
+
+	Primaries string
+	Transfer  string
+	Matrix    string
+	FullRange bool
+
+	// AlternativeTransfer is the preferred transfer of an alternative transfer characteristics
+	// SEI, which signals HLG on streams whose VUI declares an SDR-compatible transfer
+	AlternativeTransfer string
+
+	Mastering  *MasteringDisplay
+	LightLevel *ContentLightLevel
+}
+
+// MasteringDisplay is the SMPTE ST 2086 mastering display luminance range in cd/m²
+type MasteringDisplay struct {
+	MaxLuminance float64
+	MinLuminance float64
+}
+
+// ContentLightLevel is the CTA-861.3 content light level in cd/m²
+type ContentLightLevel struct {
+	MaxCLL  int
+	MaxFALL int
+}
+
+// Range returns the dynamic range the transfer characteristics select: PQ, HLG, or SDR
+func (s *StreamInfo) Range() string {
+	switch {
+	case s.Transfer == transferPQ:
+		return RangePQ
+	case s.Transfer == transferHLG, s.AlternativeTransfer == transferHLG:
+		return RangeHLG
+	default:
+		return RangeSDR
+	}
+}
+
+// DetectStreamInfo reads the video stream description of a segment, natively from the
+// H.264/H.265 parameter sets of MPEG-TS segments and through ffprobe for everything else
+func DetectStreamInfo(ctx context.Context, segmentData []byte) (*StreamInfo, error) {
+	info, err := streamInfoTS(segmentData)
+	if err == nil {
+		return info, nil
+	}
+
+	if !errors.Is(err, ErrUnsupportedSegment) {
+		return nil, err
+	}
+
+	if _, lookErr := ffprobeBinary(); lookErr != nil {
+		return nil, fmt.Errorf("%w (needed because %v)", ErrFFprobeNotFound, err)
+	}
+
+	return probeStreamInfo(ctx, segmentData)
+}
+
+// streamInfoTS follows the video stream of an MPEG-TS segment to its first sequence
+// parameter set, collecting the HDR SEI messages of the access units up to and including it
+func streamInfoTS(data []byte) (*StreamInfo, error) {
+	info := &StreamInfo{}
+
+	var parseErr error
+
+	target := tsTarget{
+		pick: pickVideoStream,
+		match: func(pes []byte, streamType byte) bool {
+			payload, ok := pesPayload(pes)
+			if !ok {
+				return false
+			}
+
+			found := false
+
+			for _, nal := range annexBNALs(payload) {
+				switch {
+				case streamType == streamTypeH264 && nal[0]&0x1f == nalH264SPS:
+					parseErr = parseH264SPS(nal, info)
+					found = true
+				case streamType == streamTypeH264 && nal[0]&0x1f == nalH264SEI:
+					parseSEI(nal, 1, info)
+				case streamType == streamTypeH265 && (nal[0]>>1)&0x3f == nalH265SPS && len(nal) > 2:
+					parseErr = parseHEVCSPS(nal, info)
+					found = true
+				case streamType == streamTypeH265 && (nal[0]>>1)&0x3f == nalH265PrefixSEI:
+					parseSEI(nal, 2, info)
+				}
+			}
+
+			return found
+		},
+		missing: "no sequence parameter set in the video stream",
+	}
+
+	if err := scanTS(data, target); err != nil {
+		return nil, err
+	}
+
+	if parseErr != nil {
+		return nil, fmt.Errorf("failed to parse sequence parameter set: %w", parseErr)
+	}
+
+	return info, nil
+}
+
+// ffprobeStreams is the part of ffprobe's -show_streams -show_frames output describing color
+type ffprobeStreams struct {
+	Streams []struct {
+		CodecName      string `json:"codec_name"`
+		Profile        string `json:"profile"`
+		Level          int    `json:"level"`
+		PixFmt         string `json:"pix_fmt"`
+		ColorRange     string `json:"color_range"`
+		ColorSpace     string `json:"color_space"`
+		ColorTransfer  string `json:"color_transfer"`
+		ColorPrimaries string `json:"color_primaries"`
+	} `json:"streams"`
+	Frames []struct {
+		SideData []struct {
+			Type         string `json:"side_data_type"`
+			MaxLuminance string `json:"max_luminance"`
+			MinLuminance string `json:"min_luminance"`
+			MaxContent   int    `json:"max_content"`
+			MaxAverage   int    `json:"max_average"`
+		} `json:"side_data_list"`
+	} `json:"frames"`
+}
+
+// probeStreamInfo asks ffprobe for the color description of the first video stream and
+// the HDR side data of its first frame
+func probeStreamInfo(ctx context.Context, segmentData []byte) (*StreamInfo, error) {
+	info, err := InstalledFFprobe()
+	if err != nil {
+		return nil, err
+	}
+
+	args := []string{"-v", "error", "-select_streams", "v:0", "-show_streams", "-show_frames", "-print_format", "json"}
+
+	if info.ReadIntervals {
+		args = append(args, "-read_intervals", "%+#1")
+	}
+
+	stdout, err := runFFprobe(ctx, segmentData, append(args, "-i", "pipe:0")...)
+	if err != nil {
+		return nil, err
+	}
+
+	var output ffprobeStreams
+
+	if err := json.Unmarshal(stdout, &output); err != nil {
+		return nil, fmt.Errorf("failed to parse ffprobe output: %w", err)
+	}
+
+	if len(output.Streams) == 0 {
+		return nil, ErrNoFramesFound
+	}
+
+	stream := output.Streams[0]
+
+	result := &StreamInfo{
+		Codec:     stream.CodecName,
+		Profile:   profileIDC(stream.CodecName, stream.Profile),
+		Level:     stream.Level,
+		BitDepth:  pixFmtDepth(stream.PixFmt),
+		Primaries: knownName(stream.ColorPrimaries),
+		Transfer:  knownName(stream.ColorTransfer),
+		Matrix:    knownName(stream.ColorSpace),
+		FullRange: stream.ColorRange == "pc",
+	}
+
+	for _, frame := range output.Frames {
+		for _, side := range frame.SideData {
+			switch side.Type {
+			case "Mastering display metadata":
+				result.Mastering = &MasteringDisplay{
+					MaxLuminance: parseRational(side.MaxLuminance),
+					MinLuminance: parseRational(side.MinLuminance),
+				}
+			case "Content light level metadata":
+				result.LightLevel = &ContentLightLevel{MaxCLL: side.MaxContent, MaxFALL: side.MaxAverage}
+			}
+		}
+	}
+
+	return result, nil
+}
+
+// pixFmtDepth derives the luma bit depth from an ffprobe pixel format (e.g., yuv420p10le)
+func pixFmtDepth(pixFmt string) int {
+	if pixFmt == "" {
+		return 0
+	}
+
+	index := strings.LastIndex(pixFmt, "p")
+	if index < 0 {
+		return 8
+	}
+
+	digits := strings.TrimRight(strings.TrimSuffix(strings.TrimSuffix(pixFmt[index+1:], "le"), "be"), "abcdefghijklmnopqrstuvwxyz")
+
+	depth, err := strconv.Atoi(digits)
+	if err != nil {
+		return 8
+	}
+
+	return depth
+}
+
+// profileIDC maps ffprobe's H.264/H.265 profile names back to their profile_idc
+func profileIDC(codec, profile string) int {
+	names := map[string]int{
+		"h264/Baseline": 66, "h264/Constrained Baseline": 66, "h264/Main": 77, "h264/Extended": 88,
+		"h264/High": 100, "h264/High 10": 110, "h264/High 4:2:2": 122, "h264/High 4:4:4 Predictive": 244,
+		"hevc/Main": 1, "hevc/Main 10": 2, "hevc/Main Still Picture": 3, "hevc/Rext": 4,
+	}
+
+	return names[codec+"/"+profile]
+}
+
+// ProfileName names an H.264 or H.265 profile_idc
+func ProfileName(codec string, profile int) string {
+	names := map[string]string{
+		"h264/66": "Baseline", "h264/77": "Main", "h264/88": "Extended", "h264/100": "High",
+		"h264/110": "High 10", "h264/122": "High 4:2:2", "h264/244": "High 4:4:4 Predictive",
+		"hevc/1": "Main", "hevc/2": "Main 10", "hevc/3": "Main Still Picture", "hevc/4": "Range Extensions",
+	}
+
+	if name, ok := names[fmt.Sprintf("%s/%d", codec, profile)]; ok {
+		return name
+	}
+
+	return fmt.Sprintf("profile %d", profile)
+}
+
+// LevelName formats an H.264 level_idc or H.265 general_level_idc as a level number (e.g., 4.1)
+func LevelName(codec string, level int) string {
+	if codec == "hevc" {
+		return fmt.Sprintf("%d.%d", level/30, level%30/3)
+	}
+
+	return fmt.Sprintf("%d.%d", level/10, level%10)
+}
+
+// parseRational parses ffprobe's "num/den" values
+func parseRational(value string) float64 {
+	num, den, found := strings.Cut(value, "/")
+
+	n, err := strconv.ParseFloat(num, 64)
+	if err != nil {
+		return 0
+	}
+
+	if !found {
+		return n
+	}
+
+	d, err := strconv.ParseFloat(den, 64)
+	if err != nil || d == 0 {
+		return 0
+	}
+
+	return n / d
+}
+
+// knownName drops ffprobe's placeholder for values the stream leaves unspecified
+func knownName(name string) string {
+	if name == "unknown" || name == "reserved" {
+		return ""
+	}
+
+	return name
+}
+
+// colorPrimariesName names an ISO/IEC 23091-2 ColourPrimaries code as ffprobe does
+func colorPrimariesName(code int) string {
+	names := map[int]string{
+		1: "bt709", 4: "bt470m", 5: "bt470bg", 6: "smpte170m", 7: "smpte240m", 8: "film",
+		9: "bt2020", 10: "smpte428", 11: "smpte431", 12: "smpte432", 22: "jedec-p22",
+	}
+
+	return codeName(names, code)
+}
+
+// transferName names an ISO/IEC 23091-2 TransferCharacteristics code as ffprobe does
+func transferName(code int) string {
+	names := map[int]string{
+		1: "bt709", 4: "gamma22", 5: "gamma28", 6: "smpte170m", 7: "smpte240m", 8: "linear",
+		9: "log100", 10: "log316", 11: "iec61966-2-4", 12: "bt1361e", 13: "iec61966-2-1",
+		14: "bt2020-10", 15: "bt2020-12", 16: transferPQ, 17: "smpte428", 18: transferHLG,
+	}
+
+	return codeName(names, code)
+}
+
+// matrixName names an ISO/IEC 23091-2 MatrixCoefficients code as ffprobe does
+func matrixName(code int) string {
+	names := map[int]string{
+		0: "gbr", 1: "bt709", 4: "fcc", 5: "bt470bg", 6: "smpte170m", 7: "smpte240m",
+		8: "ycgco", 9: "bt2020nc", 10: "bt2020c", 11: "smpte2085", 14: "ictcp",
+	}
+
+	return codeName(names, code)
+}
+
+// codeName looks up a code, leaving unspecified (2) codes empty and flagging unknown ones
+func codeName(names map[int]string, code int) string {
+	if code == 2 {
+		return ""
+	}
+
+	if name, ok := names[code]; ok {
+		return name
+	}
+
+	return fmt.Sprintf("reserved (%d)", code)
+}
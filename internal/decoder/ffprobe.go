@@ -1,12 +1,10 @@
 package decoder
 
 import (
-	"bytes"
 	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
-	"os/exec"
 	"time"
 )
 
@@ -15,7 +13,7 @@ var (
 	ErrFFprobeNotFound = errors.New("ffprobe not found in PATH")
 )
 
-// Frame represents a video frame from ffprobe output
+// Frame represents a video or audio frame from ffprobe output
 type Frame struct {
 	MediaType string `json:"media_type"`
 	KeyFrame  int    `json:"key_frame"`
@@ -28,36 +26,92 @@ type FFprobeOutput struct {
 	Frames []Frame `json:"frames"`
 }
 
-// DetectFirstFrame pipes segment data to ffprobe and detects the first video frame
+// DetectFirstFrame detects the first video frame, natively for H.264/H.265 MPEG-TS
+// segments and through ffprobe for everything the native parser cannot handle
 func DetectFirstFrame(ctx context.Context, segmentData []byte) (time.Duration, error) {
-	// Check if ffprobe is available
-	if _, err := exec.LookPath("ffprobe"); err != nil {
-		return 0, ErrFFprobeNotFound
-	}
+	elapsed, _, err := DetectFirstFrameDecoder(ctx, segmentData)
+
+	return elapsed, err
+}
 
+// DetectFirstFrameDecoder detects the first video frame like DetectFirstFrame and also
+// names the decoder that found it: DecoderNative, the ffprobe build (see FFprobeInfo), or
+// the linked libav
+func DetectFirstFrameDecoder(ctx context.Context, segmentData []byte) (time.Duration, string, error) {
 	start := time.Now()
 
-	// Build ffprobe command
-	cmd := exec.CommandContext(ctx,
-		"ffprobe",
-		"-show_frames",
-		"-select_streams", "v:0",
-		"-print_format", "json",
-		"-read_intervals", "%+#1",
-		"-i", "pipe:0",
-	)
+	err := detectKeyframeTS(segmentData)
+	if err == nil {
+		return time.Since(start), DecoderNative, nil
+	}
+
+	if !errors.Is(err, ErrUnsupportedSegment) {
+		return 0, "", err
+	}
+
+	elapsed, name, fallbackErr := decodeFirstFrame(ctx, segmentData, "v:0", ErrNoFramesFound)
+	if errors.Is(fallbackErr, ErrFFprobeNotFound) {
+		return 0, "", fmt.Errorf("%w (needed because %v)", ErrFFprobeNotFound, err)
+	}
+
+	return elapsed, name, fallbackErr
+}
+
+// decodeFirstFrame hands segments the native parsers cannot handle to the linked libav
+// in libav builds and to ffprobe otherwise, naming the decoder that ran
+func decodeFirstFrame(ctx context.Context, segmentData []byte, stream string, noFrames error) (time.Duration, string, error) {
+	if libavLinked {
+		elapsed, err := libavFirstFrame(ctx, segmentData, stream, noFrames)
+		if err != nil {
+			return 0, "", err
+		}
+
+		return elapsed, libavVersion(), nil
+	}
+
+	elapsed, err := probeFirstFrame(ctx, segmentData, stream, noFrames)
+	if err != nil {
+		return 0, "", err
+	}
+
+	info, _ := InstalledFFprobe()
 
-	// Set up pipes
-	cmd.Stdin = bytes.NewReader(segmentData)
+	return elapsed, info.String(), nil
+}
 
-	var stdout, stderr bytes.Buffer
+// LinkedLibav names the FFmpeg libraries linked for in-process decoding (built with
+// -tags libav), reporting false when segments go to the ffprobe binary instead
+func LinkedLibav() (string, bool) {
+	return libavVersion(), libavLinked
+}
 
-	cmd.Stdout = &stdout
-	cmd.Stderr = &stderr
+// probeFirstFrame pipes segment data to ffprobe and detects the first frame of the
+// selected stream (e.g., "v:0"), returning noFrames when the stream has none
+func probeFirstFrame(ctx context.Context, segmentData []byte, stream string, noFrames error) (time.Duration, error) {
+	// Check if ffprobe is available
+	if _, err := ffprobeBinary(); err != nil {
+		return 0, err
+	}
 
-	// Run ffprobe
-	if err := cmd.Run(); err != nil {
-		return 0, fmt.Errorf("ffprobe failed: %w (stderr: %s)", err, stderr.String())
+	// The version is detected once, outside the timed region
+	info, err := InstalledFFprobe()
+	if err != nil {
+		return 0, err
+	}
+
+	start := time.Now()
+
+	// Build ffprobe command; builds without -read_intervals demux the whole segment
+	args := []string{"-show_frames", "-select_streams", stream, "-print_format", "json"}
+
+	if info.ReadIntervals {
+		args = append(args, "-read_intervals", "%+#1")
+	}
+
+	// Run ffprobe with the segment piped to it
+	stdout, err := runFFprobe(ctx, segmentData, append(args, "-i", "pipe:0")...)
+	if err != nil {
+		return 0, err
 	}
 
 	elapsed := time.Since(start)
@@ -65,22 +119,26 @@ func DetectFirstFrame(ctx context.Context, segmentData []byte) (time.Duration, e
 	// Parse JSON output
 	var output FFprobeOutput
 
-	if err := json.Unmarshal(stdout.Bytes(), &output); err != nil {
+	if err := json.Unmarshal(stdout, &output); err != nil {
 		return 0, fmt.Errorf("failed to parse ffprobe output: %w", err)
 	}
 
 	// Check if we found any frames
 	if len(output.Frames) == 0 {
-		return 0, ErrNoFramesFound
+		return 0, noFrames
 	}
 
 	return elapsed, nil
 }
 
-// CheckFFprobe verifies that ffprobe is available
+// CheckFFprobe verifies that ffprobe is available, or that libav is linked in its place
 func CheckFFprobe() error {
-	if _, err := exec.LookPath("ffprobe"); err != nil {
-		return ErrFFprobeNotFound
+	if libavLinked {
+		return nil
+	}
+
+	if _, err := ffprobeBinary(); err != nil {
+		return err
 	}
 
 	return nil
@@ -0,0 +1,246 @@
+//go:build libav && cgo
+
+package decoder
+
+/*
+#cgo pkg-config: libavformat libavcodec libavutil
+
+#include <stdlib.h>
+#include <string.h>
+#include <libavformat/avformat.h>
+#include <libavcodec/avcodec.h>
+#include <libavutil/avutil.h>
+
+#define VTRACE_IO_BUFFER 65536
+
+// vtrace_buffer is the in-memory segment read through a custom AVIOContext
+typedef struct {
+	const uint8_t *data;
+	size_t size;
+	size_t pos;
+} vtrace_buffer;
+
+static int vtrace_read(void *opaque, uint8_t *buf, int size) {
+	vtrace_buffer *b = opaque;
+	size_t left = b->size - b->pos;
+
+	if (left == 0) {
+		return AVERROR_EOF;
+	}
+
+	if ((size_t)size > left) {
+		size = (int)left;
+	}
+
+	memcpy(buf, b->data + b->pos, size);
+	b->pos += size;
+
+	return size;
+}
+
+static int vtrace_interrupted(void *opaque) {
+	return *(volatile int *)opaque;
+}
+
+// vtrace_first_frame demuxes and decodes until the first frame of the best stream of
+// media_type, returning 0 on a frame, 1 when there is none, or a negative AVERROR
+static int vtrace_first_frame(const uint8_t *data, size_t size, int media_type, int *cancel) {
+	vtrace_buffer buffer = {data, size, 0};
+	AVFormatContext *format = NULL;
+	AVIOContext *avio = NULL;
+	AVCodecContext *codec = NULL;
+	const AVCodec *decoder = NULL;
+	AVPacket *packet = NULL;
+	AVFrame *frame = NULL;
+	unsigned char *io = NULL;
+	int eof = 0;
+	int stream;
+	int ret;
+
+	io = av_malloc(VTRACE_IO_BUFFER);
+	if (!io) {
+		return AVERROR(ENOMEM);
+	}
+
+	avio = avio_alloc_context(io, VTRACE_IO_BUFFER, 0, &buffer, vtrace_read, NULL, NULL);
+	if (!avio) {
+		av_free(io);
+		return AVERROR(ENOMEM);
+	}
+
+	format = avformat_alloc_context();
+	if (!format) {
+		ret = AVERROR(ENOMEM);
+		goto done;
+	}
+
+	format->pb = avio;
+	format->interrupt_callback.callback = vtrace_interrupted;
+	format->interrupt_callback.opaque = cancel;
+
+	// On failure avformat_open_input frees the context and clears the pointer
+	ret = avformat_open_input(&format, NULL, NULL, NULL);
+	if (ret < 0) {
+		goto done;
+	}
+
+	ret = avformat_find_stream_info(format, NULL);
+	if (ret < 0) {
+		goto done;
+	}
+
+	stream = av_find_best_stream(format, media_type, -1, -1, &decoder, 0);
+	if (stream == AVERROR_STREAM_NOT_FOUND) {
+		ret = 1;
+		goto done;
+	}
+
+	if (stream < 0) {
+		ret = stream;
+		goto done;
+	}
+
+	codec = avcodec_alloc_context3(decoder);
+	packet = av_packet_alloc();
+	frame = av_frame_alloc();
+
+	if (!codec || !packet || !frame) {
+		ret = AVERROR(ENOMEM);
+		goto done;
+	}
+
+	ret = avcodec_parameters_to_context(codec, format->streams[stream]->codecpar);
+	if (ret < 0) {
+		goto done;
+	}
+
+	ret = avcodec_open2(codec, decoder, NULL);
+	if (ret < 0) {
+		goto done;
+	}
+
+	for (;;) {
+		if (!eof) {
+			ret = av_read_frame(format, packet);
+
+			if (ret == AVERROR_EOF) {
+				// Flush the pictures the decoder still holds
+				eof = 1;
+				avcodec_send_packet(codec, NULL);
+			} else if (ret < 0) {
+				goto done;
+			} else if (packet->stream_index != stream) {
+				av_packet_unref(packet);
+				continue;
+			} else {
+				ret = avcodec_send_packet(codec, packet);
+				av_packet_unref(packet);
+
+				if (ret < 0 && ret != AVERROR(EAGAIN) && ret != AVERROR_INVALIDDATA) {
+					goto done;
+				}
+			}
+		}
+
+		ret = avcodec_receive_frame(codec, frame);
+
+		if (ret == 0) {
+			goto done;
+		}
+
+		if (ret == AVERROR_EOF || (eof && ret == AVERROR(EAGAIN))) {
+			ret = 1;
+			goto done;
+		}
+
+		if (ret != AVERROR(EAGAIN)) {
+			goto done;
+		}
+	}
+
+done:
+	av_frame_free(&frame);
+	av_packet_free(&packet);
+	avcodec_free_context(&codec);
+	avformat_close_input(&format);
+
+	// Custom I/O is never freed by libavformat; the buffer may have been reallocated
+	av_freep(&avio->buffer);
+	avio_context_free(&avio);
+
+	return ret;
+}
+
+static void vtrace_error(int code, char *buf, size_t size) {
+	av_strerror(code, buf, size);
+}
+*/
+import "C"
+
+import (
+	"context"
+	"fmt"
+	"time"
+	"unsafe"
+)
+
+// libavLinked reports whether this build decodes in-process through libavformat/libavcodec
+const libavLinked = true
+
+// libavFirstFrame decodes the first frame of the selected stream ("v:0" or "a:0")
+// in-process, with no process spawn or stdin pipe, returning noFrames when the
+// stream has none
+func libavFirstFrame(ctx context.Context, segmentData []byte, stream string, noFrames error) (time.Duration, error) {
+	if len(segmentData) == 0 {
+		return 0, noFrames
+	}
+
+	mediaType := C.int(C.AVMEDIA_TYPE_VIDEO)
+
+	if stream[0] == 'a' {
+		mediaType = C.int(C.AVMEDIA_TYPE_AUDIO)
+	}
+
+	// The interrupt flag lives in C memory so the demuxer can poll it during the call
+	cancel := (*C.int)(C.calloc(1, C.size_t(unsafe.Sizeof(C.int(0)))))
+	defer C.free(unsafe.Pointer(cancel))
+
+	fired := make(chan struct{})
+	stop := context.AfterFunc(ctx, func() {
+		*cancel = 1
+		close(fired)
+	})
+
+	start := time.Now()
+
+	ret := C.vtrace_first_frame((*C.uint8_t)(unsafe.Pointer(&segmentData[0])), C.size_t(len(segmentData)), mediaType, cancel)
+
+	elapsed := time.Since(start)
+
+	// Wait for a running interrupt before the flag is freed
+	if !stop() {
+		<-fired
+	}
+
+	switch {
+	case ret == 0:
+		return elapsed, nil
+	case ret == 1:
+		return 0, noFrames
+	case ctx.Err() != nil:
+		return 0, ctx.Err()
+	}
+
+	var message [256]C.char
+
+	C.vtrace_error(ret, &message[0], C.size_t(len(message)))
+
+	return 0, fmt.Errorf("libav failed: %s", C.GoString(&message[0]))
+}
+
+// libavVersion names the linked FFmpeg libraries, e.g., "libav 6.1.1 (libavformat 60.16.100)"
+func libavVersion() string {
+	version := uint32(C.avformat_version())
+
+	return fmt.Sprintf("libav %s (libavformat %d.%d.%d)", C.GoString(C.av_version_info()), version>>16, version>>8&0xff, version&0xff)
+}
@@ -0,0 +1,22 @@
+//go:build !libav || !cgo
+
+package decoder
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// libavLinked reports whether this build decodes in-process through libavformat/libavcodec
+const libavLinked = false
+
+// libavFirstFrame is unavailable without the libav build tag
+func libavFirstFrame(_ context.Context, _ []byte, _ string, _ error) (time.Duration, error) {
+	return 0, errors.ErrUnsupported
+}
+
+// libavVersion is empty without the libav build tag
+func libavVersion() string {
+	return ""
+}
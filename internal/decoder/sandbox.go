@@ -0,0 +1,232 @@
+package decoder
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrFFprobeTimeout reports an ffprobe killed by the sandbox timeout
+var ErrFFprobeTimeout = errors.New("ffprobe exceeded its time limit")
+
+// sandboxHelper is the first argument that makes the vtrace binary confine itself and
+// exec ffprobe; see RunSandboxHelper
+const sandboxHelper = "__ffprobe-sandbox"
+
+// Sandbox restricts the ffprobe child process, which otherwise runs from PATH with the
+// operator's full environment. The zero value keeps that behavior.
+type Sandbox struct {
+	// Binary is the ffprobe executable; empty looks "ffprobe" up in PATH
+	Binary string
+
+	// Env replaces the environment of ffprobe; nil inherits vtrace's, an empty slice clears it
+	Env []string
+
+	// Timeout kills ffprobe after this long; zero leaves it to the caller's context
+	Timeout time.Duration
+
+	// MemoryLimit caps the address space of ffprobe in bytes (RLIMIT_AS); zero is unlimited
+	MemoryLimit uint64
+
+	// CPULimit caps the CPU time of ffprobe, rounded up to whole seconds (RLIMIT_CPU)
+	CPULimit time.Duration
+
+	// Seccomp installs a filter that fails socket creation and ptrace, and sets no_new_privs
+	Seccomp bool
+
+	// Cgroup starts ffprobe in this cgroup v2 directory, whose controllers (memory.max,
+	// cpu.max, pids.max) the operator configures
+	Cgroup string
+}
+
+var (
+	sandboxMu sync.RWMutex
+	sandbox   Sandbox
+)
+
+// SetSandbox confines every ffprobe started afterwards. Limits this platform cannot enforce
+// are rejected. MemoryLimit, CPULimit, and Seccomp re-execute the running binary, which must
+// call RunSandboxHelper first thing in main.
+func SetSandbox(s Sandbox) error {
+	if s.confined() || s.Cgroup != "" {
+		if err := sandboxSupported(); err != nil {
+			return err
+		}
+	}
+
+	if s.Cgroup != "" {
+		if info, err := os.Stat(s.Cgroup); err != nil || !info.IsDir() {
+			return fmt.Errorf("cgroup %s is not a directory", s.Cgroup)
+		}
+	}
+
+	if s.Binary != "" {
+		if _, err := exec.LookPath(s.Binary); err != nil {
+			return fmt.Errorf("ffprobe binary %s is not executable: %w", s.Binary, err)
+		}
+	}
+
+	sandboxMu.Lock()
+	defer sandboxMu.Unlock()
+
+	sandbox = s
+
+	return nil
+}
+
+// currentSandbox returns the sandbox in force
+func currentSandbox() Sandbox {
+	sandboxMu.RLock()
+	defer sandboxMu.RUnlock()
+
+	return sandbox
+}
+
+// confined reports whether ffprobe must be started through the sandbox helper
+func (s Sandbox) confined() bool {
+	return s.MemoryLimit > 0 || s.CPULimit > 0 || s.Seccomp
+}
+
+// limits encodes the limits the helper applies as "mem=N,cpu=N,seccomp"
+func (s Sandbox) limits() string {
+	var parts []string
+
+	if s.MemoryLimit > 0 {
+		parts = append(parts, "mem="+strconv.FormatUint(s.MemoryLimit, 10))
+	}
+
+	if s.CPULimit > 0 {
+		seconds := (s.CPULimit + time.Second - 1) / time.Second
+		parts = append(parts, "cpu="+strconv.FormatInt(int64(seconds), 10))
+	}
+
+	if s.Seccomp {
+		parts = append(parts, "seccomp")
+	}
+
+	return strings.Join(parts, ",")
+}
+
+// ffprobeBinary resolves the ffprobe executable
+func ffprobeBinary() (string, error) {
+	name := currentSandbox().Binary
+
+	if name == "" {
+		name = "ffprobe"
+	}
+
+	path, err := exec.LookPath(name)
+	if err != nil {
+		return "", ErrFFprobeNotFound
+	}
+
+	return path, nil
+}
+
+// runFFprobe runs ffprobe inside the sandbox with stdin as its input and returns its output
+func runFFprobe(ctx context.Context, stdin []byte, args ...string) ([]byte, error) {
+	s := currentSandbox()
+
+	path, err := ffprobeBinary()
+	if err != nil {
+		return nil, err
+	}
+
+	runCtx := ctx
+
+	if s.Timeout > 0 {
+		var cancel context.CancelFunc
+
+		runCtx, cancel = context.WithTimeout(ctx, s.Timeout)
+		defer cancel()
+	}
+
+	name, argv := path, args
+
+	// The helper applies the limits to itself and then becomes ffprobe
+	if s.confined() {
+		self, err := os.Executable()
+		if err != nil {
+			return nil, fmt.Errorf("failed to locate the sandbox helper: %w", err)
+		}
+
+		name, argv = self, append([]string{sandboxHelper, s.limits(), path}, args...)
+	}
+
+	cmd := exec.CommandContext(runCtx, name, argv...)
+	cmd.Env = s.Env
+	cmd.WaitDelay = time.Second
+
+	if stdin != nil {
+		cmd.Stdin = bytes.NewReader(stdin)
+	}
+
+	var stdout, stderr bytes.Buffer
+
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	release, err := startInCgroup(cmd, s.Cgroup)
+	if err != nil {
+		return nil, err
+	}
+
+	err = cmd.Run()
+	release()
+
+	switch {
+	case err != nil && runCtx.Err() != nil && ctx.Err() == nil:
+		return nil, fmt.Errorf("%w (%s)", ErrFFprobeTimeout, s.Timeout)
+	case err != nil:
+		return nil, fmt.Errorf("ffprobe failed: %w (stderr: %s)", err, stderr.String())
+	}
+
+	return stdout.Bytes(), nil
+}
+
+// RunSandboxHelper turns the process into a confined ffprobe when it was started as the
+// sandbox helper, and returns immediately otherwise. Binaries that set Sandbox limits must
+// call it before doing anything else.
+func RunSandboxHelper() {
+	if len(os.Args) < 4 || os.Args[1] != sandboxHelper {
+		return
+	}
+
+	err := enterSandbox(os.Args[2], os.Args[3], os.Args[3:])
+
+	// enterSandbox only returns when it could not exec ffprobe
+	fmt.Fprintf(os.Stderr, "ffprobe sandbox: %v\n", err)
+	os.Exit(126)
+}
+
+// parseLimits decodes the limits written by Sandbox.limits
+func parseLimits(spec string) (memory, cpu uint64, seccomp bool, err error) {
+	for _, part := range strings.Split(spec, ",") {
+		key, value, _ := strings.Cut(part, "=")
+
+		switch key {
+		case "":
+		case "mem":
+			memory, err = strconv.ParseUint(value, 10, 64)
+		case "cpu":
+			cpu, err = strconv.ParseUint(value, 10, 64)
+		case "seccomp":
+			seccomp = true
+		default:
+			err = fmt.Errorf("unknown limit %q", key)
+		}
+
+		if err != nil {
+			return 0, 0, false, err
+		}
+	}
+
+	return memory, cpu, seccomp, nil
+}
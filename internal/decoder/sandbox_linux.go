@@ -0,0 +1,139 @@
+//go:build linux && (amd64 || arm64)
+
+package decoder
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"syscall"
+	"unsafe"
+)
+
+// prctl options and seccomp constants from linux/prctl.h and linux/seccomp.h
+const (
+	prSetNoNewPrivs   = 38
+	prSetSeccomp      = 22
+	seccompModeFilter = 2
+
+	seccompRetKillProcess = 0x80000000
+	seccompRetErrno       = 0x00050000
+	seccompRetAllow       = 0x7fff0000
+
+	// x32 system calls share the x86-64 audit architecture but set this bit
+	x32SyscallBit = 0x40000000
+)
+
+// deniedSyscalls fail with EPERM inside the sandbox: ffprobe reads segments from a pipe, so
+// it never needs a socket, and it has no business tracing other processes
+var deniedSyscalls = []uint32{
+	syscall.SYS_SOCKET,
+	syscall.SYS_PTRACE,
+}
+
+// sandboxSupported reports whether this platform can enforce the sandbox limits
+func sandboxSupported() error {
+	return nil
+}
+
+// startInCgroup places the command in the cgroup as it is cloned and kills it if vtrace
+// dies; the returned function releases the cgroup descriptor once the command finished
+func startInCgroup(cmd *exec.Cmd, cgroup string) (func(), error) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Pdeathsig: syscall.SIGKILL}
+
+	if cgroup == "" {
+		return func() {}, nil
+	}
+
+	dir, err := os.Open(cgroup)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open cgroup: %w", err)
+	}
+
+	cmd.SysProcAttr.UseCgroupFD = true
+	cmd.SysProcAttr.CgroupFD = int(dir.Fd())
+
+	return func() { dir.Close() }, nil
+}
+
+// enterSandbox applies the resource limits and seccomp filter to this process and execs
+// ffprobe with the inherited (already sanitized) environment
+func enterSandbox(spec, path string, argv []string) error {
+	memory, cpu, seccomp, err := parseLimits(spec)
+	if err != nil {
+		return err
+	}
+
+	if memory > 0 {
+		if err := syscall.Setrlimit(syscall.RLIMIT_AS, &syscall.Rlimit{Cur: memory, Max: memory}); err != nil {
+			return fmt.Errorf("failed to limit memory: %w", err)
+		}
+	}
+
+	if cpu > 0 {
+		if err := syscall.Setrlimit(syscall.RLIMIT_CPU, &syscall.Rlimit{Cur: cpu, Max: cpu}); err != nil {
+			return fmt.Errorf("failed to limit CPU time: %w", err)
+		}
+	}
+
+	// The filter and no_new_privs apply to the calling thread, which must be the one to exec
+	runtime.LockOSThread()
+
+	if seccomp {
+		if err := installSeccomp(); err != nil {
+			return err
+		}
+	}
+
+	return syscall.Exec(path, argv, os.Environ())
+}
+
+// installSeccomp sets no_new_privs and loads a filter that denies deniedSyscalls and kills
+// the process on a foreign architecture or x32 call
+func installSeccomp() error {
+	arch := uint32(0xc000003e) // AUDIT_ARCH_X86_64
+
+	if runtime.GOARCH == "arm64" {
+		arch = 0xc00000b7 // AUDIT_ARCH_AARCH64
+	}
+
+	n := uint8(len(deniedSyscalls))
+
+	filter := []syscall.SockFilter{
+		// seccomp_data.arch
+		{Code: syscall.BPF_LD | syscall.BPF_W | syscall.BPF_ABS, K: 4},
+		{Code: syscall.BPF_JMP | syscall.BPF_JEQ | syscall.BPF_K, Jt: 1, K: arch},
+		{Code: syscall.BPF_RET | syscall.BPF_K, K: seccompRetKillProcess},
+		// seccomp_data.nr
+		{Code: syscall.BPF_LD | syscall.BPF_W | syscall.BPF_ABS, K: 0},
+		{Code: syscall.BPF_JMP | syscall.BPF_JGE | syscall.BPF_K, Jf: 1, K: x32SyscallBit},
+		{Code: syscall.BPF_RET | syscall.BPF_K, K: seccompRetKillProcess},
+	}
+
+	// Each match jumps over the remaining comparisons and the allow to the deny
+	for i, nr := range deniedSyscalls {
+		filter = append(filter, syscall.SockFilter{
+			Code: syscall.BPF_JMP | syscall.BPF_JEQ | syscall.BPF_K,
+			Jt:   n - uint8(i),
+			K:    nr,
+		})
+	}
+
+	filter = append(filter,
+		syscall.SockFilter{Code: syscall.BPF_RET | syscall.BPF_K, K: seccompRetAllow},
+		syscall.SockFilter{Code: syscall.BPF_RET | syscall.BPF_K, K: seccompRetErrno | uint32(syscall.EPERM)},
+	)
+
+	prog := syscall.SockFprog{Len: uint16(len(filter)), Filter: &filter[0]}
+
+	if _, _, errno := syscall.RawSyscall(syscall.SYS_PRCTL, prSetNoNewPrivs, 1, 0); errno != 0 {
+		return fmt.Errorf("failed to set no_new_privs: %w", errno)
+	}
+
+	if _, _, errno := syscall.RawSyscall(syscall.SYS_PRCTL, prSetSeccomp, seccompModeFilter, uintptr(unsafe.Pointer(&prog))); errno != 0 {
+		return fmt.Errorf("failed to install seccomp filter: %w", errno)
+	}
+
+	return nil
+}
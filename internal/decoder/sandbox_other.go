@@ -0,0 +1,25 @@
+//go:build !linux || !(amd64 || arm64)
+
+package decoder
+
+import (
+	"errors"
+	"fmt"
+	"os/exec"
+)
+
+// sandboxSupported reports that resource limits, seccomp, and cgroups need Linux on
+// amd64 or arm64
+func sandboxSupported() error {
+	return fmt.Errorf("ffprobe resource limits, seccomp, and cgroups need linux/amd64 or linux/arm64: %w", errors.ErrUnsupported)
+}
+
+// startInCgroup is never reached with a cgroup on this platform
+func startInCgroup(_ *exec.Cmd, _ string) (func(), error) {
+	return func() {}, nil
+}
+
+// enterSandbox is unavailable on this platform
+func enterSandbox(_, _ string, _ []string) error {
+	return errors.ErrUnsupported
+}
@@ -0,0 +1,553 @@
+package decoder
+
+import (
+	"errors"
+	"fmt"
+	"math/bits"
+	"strings"
+)
+
+var errTruncated = errors.New("truncated parameter set")
+
+// SEI payload types carrying HDR metadata (shared by H.264 and H.265)
+const (
+	seiMasteringDisplay    = 137
+	seiContentLightLevel   = 144
+	seiAlternativeTransfer = 147
+)
+
+// NAL unit types of parameter sets and SEI messages
+const (
+	nalH264SEI       = 6
+	nalH264SPS       = 7
+	nalH265SPS       = 33
+	nalH265PrefixSEI = 39
+)
+
+// bitReader reads big-endian bit fields and Exp-Golomb codes from an RBSP
+type bitReader struct {
+	data []byte
+	pos  int
+	err  error
+}
+
+// u reads an n-bit unsigned field (n <= 32)
+func (r *bitReader) u(n int) uint32 {
+	var value uint32
+
+	for i := 0; i < n; i++ {
+		if r.pos >= len(r.data)*8 {
+			r.err = errTruncated
+
+			return 0
+		}
+
+		bit := r.data[r.pos/8] >> (7 - r.pos%8) & 1
+		value = value<<1 | uint32(bit)
+		r.pos++
+	}
+
+	return value
+}
+
+// flag reads a single bit as a boolean
+func (r *bitReader) flag() bool {
+	return r.u(1) == 1
+}
+
+// skip advances over n bits
+func (r *bitReader) skip(n int) {
+	if r.pos+n > len(r.data)*8 {
+		r.err = errTruncated
+		r.pos = len(r.data) * 8
+
+		return
+	}
+
+	r.pos += n
+}
+
+// ue reads an unsigned Exp-Golomb code
+func (r *bitReader) ue() uint32 {
+	zeros := 0
+
+	for !r.flag() {
+		if r.err != nil || zeros > 31 {
+			r.err = errTruncated
+
+			return 0
+		}
+
+		zeros++
+	}
+
+	return 1<<zeros - 1 + r.u(zeros)
+}
+
+// se reads a signed Exp-Golomb code
+func (r *bitReader) se() int32 {
+	code := r.ue()
+
+	if code%2 == 1 {
+		return int32((code + 1) / 2)
+	}
+
+	return -int32(code / 2)
+}
+
+// unescapeRBSP removes the emulation prevention bytes (00 00 03) from a NAL unit
+func unescapeRBSP(nal []byte) []byte {
+	out := make([]byte, 0, len(nal))
+	zeros := 0
+
+	for _, b := range nal {
+		if zeros >= 2 && b == 0x03 {
+			zeros = 0
+
+			continue
+		}
+
+		if b == 0 {
+			zeros++
+		} else {
+			zeros = 0
+		}
+
+		out = append(out, b)
+	}
+
+	return out
+}
+
+// parseH264SPS reads the profile, level, bit depth, and VUI video signal type of an
+// H.264 sequence parameter set (NAL header included)
+func parseH264SPS(nal []byte, info *StreamInfo) error {
+	r := &bitReader{data: unescapeRBSP(nal[1:])}
+
+	profile := r.u(8)
+	constraints := r.u(8)
+	level := r.u(8)
+	r.ue() // seq_parameter_set_id
+
+	info.Codec = "h264"
+	info.BitDepth = 8
+	info.Profile = int(profile)
+	info.Level = int(level)
+	info.CodecString = fmt.Sprintf("avc1.%02x%02x%02x", profile, constraints, level)
+
+	switch profile {
+	case 100, 110, 122, 244, 44, 83, 86, 118, 128, 138, 139, 134, 135:
+		chromaFormat := r.ue()
+
+		if chromaFormat == 3 {
+			r.skip(1) // separate_colour_plane_flag
+		}
+
+		info.BitDepth = int(r.ue()) + 8
+		r.ue()    // bit_depth_chroma_minus8
+		r.skip(1) // qpprime_y_zero_transform_bypass_flag
+
+		if r.flag() {
+			lists := 8
+
+			if chromaFormat == 3 {
+				lists = 12
+			}
+
+			for i := 0; i < lists; i++ {
+				if !r.flag() {
+					continue
+				}
+
+				size := 16
+
+				if i >= 6 {
+					size = 64
+				}
+
+				skipH264ScalingList(r, size)
+			}
+		}
+	}
+
+	r.ue() // log2_max_frame_num_minus4
+
+	switch r.ue() {
+	case 0:
+		r.ue() // log2_max_pic_order_cnt_lsb_minus4
+	case 1:
+		r.skip(1) // delta_pic_order_always_zero_flag
+		r.se()    // offset_for_non_ref_pic
+		r.se()    // offset_for_top_to_bottom_field
+
+		cycle := r.ue()
+
+		for i := uint32(0); i < cycle && r.err == nil; i++ {
+			r.se()
+		}
+	}
+
+	r.ue()    // max_num_ref_frames
+	r.skip(1) // gaps_in_frame_num_value_allowed_flag
+	r.ue()    // pic_width_in_mbs_minus1
+	r.ue()    // pic_height_in_map_units_minus1
+
+	if !r.flag() {
+		r.skip(1) // mb_adaptive_frame_field_flag
+	}
+
+	r.skip(1) // direct_8x8_inference_flag
+
+	if r.flag() {
+		r.ue()
+		r.ue()
+		r.ue()
+		r.ue()
+	}
+
+	if r.flag() {
+		parseVUIColor(r, info)
+	}
+
+	return r.err
+}
+
+// skipH264ScalingList skips one scaling_list() of the given size
+func skipH264ScalingList(r *bitReader, size int) {
+	last, next := int32(8), int32(8)
+
+	for j := 0; j < size && r.err == nil; j++ {
+		if next != 0 {
+			next = (last + r.se() + 256) % 256
+		}
+
+		if next != 0 {
+			last = next
+		}
+	}
+}
+
+// parseHEVCSPS reads the profile, tier, level, bit depth, and VUI video signal type of
+// an H.265 sequence parameter set (NAL header included)
+func parseHEVCSPS(nal []byte, info *StreamInfo) error {
+	r := &bitReader{data: unescapeRBSP(nal[2:])}
+
+	r.skip(4) // sps_video_parameter_set_id
+
+	maxSubLayers := int(r.u(3))
+
+	r.skip(1) // sps_temporal_id_nesting_flag
+
+	parseProfileTierLevel(r, maxSubLayers, info)
+
+	r.ue() // sps_seq_parameter_set_id
+
+	if r.ue() == 3 {
+		r.skip(1) // separate_colour_plane_flag
+	}
+
+	r.ue() // pic_width_in_luma_samples
+	r.ue() // pic_height_in_luma_samples
+
+	if r.flag() {
+		r.ue()
+		r.ue()
+		r.ue()
+		r.ue()
+	}
+
+	info.BitDepth = int(r.ue()) + 8
+
+	r.ue() // bit_depth_chroma_minus8
+
+	pocBits := int(r.ue()) + 4
+
+	first := maxSubLayers
+
+	if r.flag() {
+		first = 0
+	}
+
+	for i := first; i <= maxSubLayers && r.err == nil; i++ {
+		r.ue()
+		r.ue()
+		r.ue()
+	}
+
+	for i := 0; i < 6; i++ {
+		r.ue() // coding and transform block sizes, transform hierarchy depths
+	}
+
+	if r.flag() && r.flag() {
+		skipHEVCScalingLists(r)
+	}
+
+	r.skip(2) // amp_enabled_flag, sample_adaptive_offset_enabled_flag
+
+	if r.flag() {
+		r.skip(8) // pcm sample bit depths
+		r.ue()
+		r.ue()
+		r.skip(1)
+	}
+
+	sets := int(r.ue())
+	deltaPOCs := make([]int, sets)
+
+	for i := 0; i < sets && r.err == nil; i++ {
+		deltaPOCs[i] = skipShortTermRefPicSet(r, i, deltaPOCs)
+	}
+
+	if r.flag() {
+		count := r.ue()
+
+		for i := uint32(0); i < count && r.err == nil; i++ {
+			r.skip(pocBits + 1)
+		}
+	}
+
+	r.skip(2) // sps_temporal_mvp_enabled_flag, strong_intra_smoothing_enabled_flag
+
+	if r.flag() {
+		parseVUIColor(r, info)
+	}
+
+	return r.err
+}
+
+// parseProfileTierLevel reads the general profile, tier, and level of an H.265
+// profile_tier_level() with profilePresentFlag set, skipping the sub-layers
+func parseProfileTierLevel(r *bitReader, maxSubLayers int, info *StreamInfo) {
+	space := r.u(2)
+	info.HighTier = r.flag()
+	info.Profile = int(r.u(5))
+	compatibility := r.u(32)
+
+	constraints := make([]byte, 6)
+
+	for i := range constraints {
+		constraints[i] = byte(r.u(8))
+	}
+
+	info.Level = int(r.u(8))
+	info.Codec = "hevc"
+	info.CodecString = hevcCodecString(space, info.Profile, compatibility, info.HighTier, info.Level, constraints)
+
+	profilePresent := make([]bool, maxSubLayers)
+	levelPresent := make([]bool, maxSubLayers)
+
+	for i := 0; i < maxSubLayers; i++ {
+		profilePresent[i] = r.flag()
+		levelPresent[i] = r.flag()
+	}
+
+	if maxSubLayers > 0 {
+		r.skip(2 * (8 - maxSubLayers))
+	}
+
+	for i := 0; i < maxSubLayers; i++ {
+		if profilePresent[i] {
+			r.skip(88)
+		}
+
+		if levelPresent[i] {
+			r.skip(8)
+		}
+	}
+}
+
+// hevcCodecString formats the RFC 6381 codec string of an H.265 profile_tier_level (ISO/IEC
+// 14496-15 Annex E): compatibility flags bit-reversed in hex, trailing zero constraint bytes dropped
+func hevcCodecString(space uint32, profile int, compatibility uint32, highTier bool, level int, constraints []byte) string {
+	prefix := ""
+
+	if space > 0 {
+		prefix = string(rune('A' + space - 1))
+	}
+
+	tier := "L"
+
+	if highTier {
+		tier = "H"
+	}
+
+	codec := fmt.Sprintf("hvc1.%s%d.%X.%s%d", prefix, profile, bits.Reverse32(compatibility), tier, level)
+
+	for len(constraints) > 0 && constraints[len(constraints)-1] == 0 {
+		constraints = constraints[:len(constraints)-1]
+	}
+
+	var suffix strings.Builder
+
+	for _, b := range constraints {
+		fmt.Fprintf(&suffix, ".%X", b)
+	}
+
+	return codec + suffix.String()
+}
+
+// skipHEVCScalingLists skips an H.265 scaling_list_data()
+func skipHEVCScalingLists(r *bitReader) {
+	for size := 0; size < 4; size++ {
+		step := 1
+
+		if size == 3 {
+			step = 3
+		}
+
+		for matrix := 0; matrix < 6; matrix += step {
+			if !r.flag() {
+				r.ue() // scaling_list_pred_matrix_id_delta
+
+				continue
+			}
+
+			coefficients := 1 << (4 + size<<1)
+
+			if coefficients > 64 {
+				coefficients = 64
+			}
+
+			if size > 1 {
+				r.se() // scaling_list_dc_coef_minus8
+			}
+
+			for i := 0; i < coefficients && r.err == nil; i++ {
+				r.se()
+			}
+		}
+	}
+}
+
+// skipShortTermRefPicSet skips st_ref_pic_set(index) and returns its NumDeltaPocs
+func skipShortTermRefPicSet(r *bitReader, index int, deltaPOCs []int) int {
+	if index != 0 && r.flag() {
+		r.skip(1) // delta_rps_sign
+		r.ue()    // abs_delta_rps_minus1
+
+		count := 0
+
+		for j := 0; j <= deltaPOCs[index-1] && r.err == nil; j++ {
+			used := r.flag()
+
+			if used || r.flag() {
+				count++
+			}
+		}
+
+		return count
+	}
+
+	negative := r.ue()
+	positive := r.ue()
+
+	for i := uint32(0); i < negative+positive && r.err == nil; i++ {
+		r.ue()    // delta_poc_minus1
+		r.skip(1) // used_by_curr_pic_flag
+	}
+
+	return int(negative + positive)
+}
+
+// parseVUIColor reads the video signal type at the start of vui_parameters(), which
+// is laid out identically in H.264 and H.265
+func parseVUIColor(r *bitReader, info *StreamInfo) {
+	if r.flag() && r.u(8) == 255 {
+		r.skip(32) // sar_width, sar_height
+	}
+
+	if r.flag() {
+		r.skip(1) // overscan_appropriate_flag
+	}
+
+	if !r.flag() {
+		return
+	}
+
+	r.skip(3) // video_format
+
+	info.FullRange = r.flag()
+
+	if !r.flag() {
+		return
+	}
+
+	info.Primaries = colorPrimariesName(int(r.u(8)))
+	info.Transfer = transferName(int(r.u(8)))
+	info.Matrix = matrixName(int(r.u(8)))
+}
+
+// parseSEI reads the HDR metadata messages of an SEI NAL unit whose header is headerSize bytes
+func parseSEI(nal []byte, headerSize int, info *StreamInfo) {
+	if len(nal) <= headerSize {
+		return
+	}
+
+	rbsp := unescapeRBSP(nal[headerSize:])
+
+	for offset := 0; offset < len(rbsp); {
+		payloadType, payloadSize := 0, 0
+
+		for offset < len(rbsp) && rbsp[offset] == 0xff {
+			payloadType += 255
+			offset++
+		}
+
+		if offset >= len(rbsp) {
+			return
+		}
+
+		payloadType += int(rbsp[offset])
+		offset++
+
+		for offset < len(rbsp) && rbsp[offset] == 0xff {
+			payloadSize += 255
+			offset++
+		}
+
+		if offset >= len(rbsp) {
+			return
+		}
+
+		payloadSize += int(rbsp[offset])
+		offset++
+
+		if offset+payloadSize > len(rbsp) {
+			return
+		}
+
+		payload := &bitReader{data: rbsp[offset : offset+payloadSize]}
+
+		switch payloadType {
+		case seiMasteringDisplay:
+			payload.skip(128) // display primaries and white point
+			maxLuminance := payload.u(32)
+			minLuminance := payload.u(32)
+
+			if payload.err == nil {
+				info.Mastering = &MasteringDisplay{
+					MaxLuminance: float64(maxLuminance) / 10000,
+					MinLuminance: float64(minLuminance) / 10000,
+				}
+			}
+		case seiContentLightLevel:
+			maxCLL := payload.u(16)
+			maxFALL := payload.u(16)
+
+			if payload.err == nil {
+				info.LightLevel = &ContentLightLevel{MaxCLL: int(maxCLL), MaxFALL: int(maxFALL)}
+			}
+		case seiAlternativeTransfer:
+			if preferred := payload.u(8); payload.err == nil {
+				info.AlternativeTransfer = transferName(int(preferred))
+			}
+		}
+
+		offset += payloadSize
+
+		// The RBSP trailing bits end the message list
+		if offset < len(rbsp) && rbsp[offset] == 0x80 {
+			return
+		}
+	}
+}
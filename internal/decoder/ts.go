@@ -0,0 +1,369 @@
+package decoder
+
+import (
+	"errors"
+	"fmt"
+)
+
+// MPEG-TS layout constants
+const (
+	tsPacketSize = 188
+	tsSyncByte   = 0x47
+	tsPATPID     = 0x0000
+	tsNullPID    = 0x1fff
+)
+
+// PMT stream types with NAL units the native parser understands
+const (
+	streamTypeH264 = 0x1b
+	streamTypeH265 = 0x24
+)
+
+var ErrUnsupportedSegment = errors.New("segment not supported by the native parser")
+
+// tsStream is an elementary stream announced in the PMT
+type tsStream struct {
+	pid        uint16
+	streamType byte
+}
+
+// tsTarget describes which elementary stream to follow and what to look for in it
+type tsTarget struct {
+	// pick chooses the stream from the PMT entries, or explains why none fits
+	pick func(streams []tsStream) (tsStream, error)
+
+	// match reports whether a complete PES packet contains the wanted frame
+	match func(pes []byte, streamType byte) bool
+
+	// missing describes the failure when no PES packet matched
+	missing string
+
+	// all walks every PES packet of the stream instead of stopping at the first match;
+	// the scan then succeeds once the stream is found
+	all bool
+}
+
+// videoTarget finds the first H.264/H.265 keyframe
+var videoTarget = tsTarget{
+	pick:    pickVideoStream,
+	match:   keyframeInPES,
+	missing: "no keyframe in the video stream",
+}
+
+// detectKeyframeTS walks MPEG-TS packets, follows PAT and PMT to the first video
+// stream, and reports whether one of its PES packets starts a keyframe. Anything
+// outside H.264/H.265 in MPEG-TS returns ErrUnsupportedSegment.
+func detectKeyframeTS(data []byte) error {
+	return scanTS(data, videoTarget)
+}
+
+// FirstVideoPTS returns the presentation timestamp (90 kHz ticks) of the first
+// timestamped PES packet of the H.264/H.265 stream in an MPEG-TS segment
+func FirstVideoPTS(data []byte) (int64, error) {
+	var pts int64
+
+	target := tsTarget{
+		pick: pickVideoStream,
+		match: func(pes []byte, _ byte) bool {
+			found, ok := pesPTS(pes)
+			pts = found
+
+			return ok
+		},
+		missing: "no timestamped video PES packet",
+	}
+
+	if err := scanTS(data, target); err != nil {
+		return 0, err
+	}
+
+	return pts, nil
+}
+
+// scanTS follows PAT and PMT to the stream chosen by the target and checks its
+// PES packets in order until one matches
+func scanTS(data []byte, target tsTarget) error {
+	if len(data) < tsPacketSize || data[0] != tsSyncByte {
+		return fmt.Errorf("%w: not an MPEG-TS segment", ErrUnsupportedSegment)
+	}
+
+	pmtPID := -1
+
+	var stream *tsStream
+
+	var pes []byte
+
+	for offset := 0; offset+tsPacketSize <= len(data); offset += tsPacketSize {
+		packet := data[offset : offset+tsPacketSize]
+
+		if packet[0] != tsSyncByte {
+			return fmt.Errorf("%w: lost MPEG-TS sync at byte %d", ErrUnsupportedSegment, offset)
+		}
+
+		pid := uint16(packet[1]&0x1f)<<8 | uint16(packet[2])
+		start := packet[1]&0x40 != 0
+
+		if pid == tsNullPID {
+			continue
+		}
+
+		payload, ok := tsPayload(packet)
+		if !ok {
+			continue
+		}
+
+		switch {
+		case pid == tsPATPID && start:
+			if found, ok := parsePAT(payload); ok {
+				pmtPID = int(found)
+			}
+		case int(pid) == pmtPID && start && stream == nil:
+			streams, err := parsePMT(payload)
+			if err != nil {
+				return err
+			}
+
+			picked, err := target.pick(streams)
+			if err != nil {
+				return err
+			}
+
+			stream = &picked
+		case stream != nil && pid == stream.pid:
+			// A new PES packet starts; check the one just completed
+			if start && len(pes) > 0 {
+				if target.match(pes, stream.streamType) && !target.all {
+					return nil
+				}
+
+				pes = pes[:0]
+			}
+
+			if start || len(pes) > 0 {
+				pes = append(pes, payload...)
+			}
+		}
+	}
+
+	if stream == nil {
+		return fmt.Errorf("%w: no PAT/PMT found", ErrUnsupportedSegment)
+	}
+
+	if len(pes) > 0 && target.match(pes, stream.streamType) || target.all {
+		return nil
+	}
+
+	// Open-GOP streams may start on a non-IDR picture; let ffprobe decide
+	return fmt.Errorf("%w: %s", ErrUnsupportedSegment, target.missing)
+}
+
+// pickVideoStream returns the first video stream; non-H.264/H.265 video is unsupported
+func pickVideoStream(streams []tsStream) (tsStream, error) {
+	for _, stream := range streams {
+		switch stream.streamType {
+		case streamTypeH264, streamTypeH265:
+			return stream, nil
+		case 0x01, 0x02, 0x10, 0x1e, 0x20, 0x33:
+			// MPEG-1/2, MPEG-4 Part 2, and VVC video need a real decoder
+			return tsStream{}, fmt.Errorf("%w: video stream type 0x%02x", ErrUnsupportedSegment, stream.streamType)
+		}
+	}
+
+	return tsStream{}, ErrNoFramesFound
+}
+
+// tsPayload returns the payload of a TS packet, skipping any adaptation field
+func tsPayload(packet []byte) ([]byte, bool) {
+	control := (packet[3] >> 4) & 0x03
+
+	if control&0x01 == 0 {
+		return nil, false
+	}
+
+	offset := 4
+
+	if control&0x02 != 0 {
+		offset += 1 + int(packet[4])
+	}
+
+	if offset >= len(packet) {
+		return nil, false
+	}
+
+	return packet[offset:], true
+}
+
+// psiSection strips the pointer field and returns a PSI section with its declared length
+func psiSection(payload []byte) ([]byte, bool) {
+	if len(payload) < 1 {
+		return nil, false
+	}
+
+	start := 1 + int(payload[0])
+
+	if start+3 > len(payload) {
+		return nil, false
+	}
+
+	section := payload[start:]
+	length := int(section[1]&0x0f)<<8 | int(section[2])
+
+	if 3+length > len(section) || length < 9 {
+		return nil, false
+	}
+
+	// Drop the trailing CRC32
+	return section[:3+length-4], true
+}
+
+// parsePAT returns the PMT PID of the first program in a PAT
+func parsePAT(payload []byte) (uint16, bool) {
+	section, ok := psiSection(payload)
+	if !ok || section[0] != 0x00 {
+		return 0, false
+	}
+
+	for entry := 8; entry+4 <= len(section); entry += 4 {
+		program := uint16(section[entry])<<8 | uint16(section[entry+1])
+
+		// Program 0 points at the network information table
+		if program == 0 {
+			continue
+		}
+
+		return uint16(section[entry+2]&0x1f)<<8 | uint16(section[entry+3]), true
+	}
+
+	return 0, false
+}
+
+// parsePMT returns every elementary stream listed in a PMT, in order
+func parsePMT(payload []byte) ([]tsStream, error) {
+	section, ok := psiSection(payload)
+
+	// The fixed PMT header runs through program_info_length at bytes 10-11
+	if !ok || len(section) < 12 || section[0] != 0x02 {
+		return nil, fmt.Errorf("%w: malformed PMT", ErrUnsupportedSegment)
+	}
+
+	programInfoLength := int(section[10]&0x0f)<<8 | int(section[11])
+
+	if 12+programInfoLength > len(section) {
+		return nil, fmt.Errorf("%w: PMT program info overruns the section", ErrUnsupportedSegment)
+	}
+
+	var streams []tsStream
+
+	for entry := 12 + programInfoLength; entry+5 <= len(section); {
+		streamType := section[entry]
+		pid := uint16(section[entry+1]&0x1f)<<8 | uint16(section[entry+2])
+		infoLength := int(section[entry+3]&0x0f)<<8 | int(section[entry+4])
+
+		if entry+5+infoLength > len(section) {
+			return nil, fmt.Errorf("%w: PMT stream info overruns the section", ErrUnsupportedSegment)
+		}
+
+		streams = append(streams, tsStream{pid: pid, streamType: streamType})
+
+		entry += 5 + infoLength
+	}
+
+	return streams, nil
+}
+
+// keyframeInPES reports whether a PES packet carries an IDR (H.264) or IRAP (H.265) picture
+func keyframeInPES(pes []byte, streamType byte) bool {
+	payload, ok := pesPayload(pes)
+	if !ok {
+		return false
+	}
+
+	for _, nal := range annexBNALs(payload) {
+		switch streamType {
+		case streamTypeH264:
+			if nal[0]&0x1f == 5 {
+				return true
+			}
+		case streamTypeH265:
+			if t := (nal[0] >> 1) & 0x3f; t >= 16 && t <= 21 {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// pesPayload strips the PES header from a complete PES packet
+func pesPayload(pes []byte) ([]byte, bool) {
+	if len(pes) < 9 || pes[0] != 0 || pes[1] != 0 || pes[2] != 1 {
+		return nil, false
+	}
+
+	headerEnd := 9 + int(pes[8])
+
+	if headerEnd > len(pes) {
+		return nil, false
+	}
+
+	return pes[headerEnd:], true
+}
+
+// pesPTS reads the 33-bit PTS from a PES header when one is present
+func pesPTS(pes []byte) (int64, bool) {
+	if len(pes) < 14 || pes[0] != 0 || pes[1] != 0 || pes[2] != 1 || pes[7]&0x80 == 0 {
+		return 0, false
+	}
+
+	pts := int64(pes[9]>>1&0x07)<<30 |
+		int64(pes[10])<<22 |
+		int64(pes[11]>>1)<<15 |
+		int64(pes[12])<<7 |
+		int64(pes[13]>>1)
+
+	return pts, true
+}
+
+// annexBNALs splits an Annex B byte stream into NAL units (without start codes)
+func annexBNALs(stream []byte) [][]byte {
+	var nals [][]byte
+
+	begin := -1
+
+	for i := 0; i+2 < len(stream); i++ {
+		if stream[i] != 0 || stream[i+1] != 0 || stream[i+2] != 1 {
+			continue
+		}
+
+		if begin >= 0 && i > begin {
+			nals = append(nals, trimZeros(stream[begin:i]))
+		}
+
+		begin = i + 3
+		i += 2
+	}
+
+	if begin >= 0 && begin < len(stream) {
+		nals = append(nals, stream[begin:])
+	}
+
+	// Drop empty units left by four-byte start codes
+	kept := nals[:0]
+
+	for _, nal := range nals {
+		if len(nal) > 0 {
+			kept = append(kept, nal)
+		}
+	}
+
+	return kept
+}
+
+// trimZeros drops the leading zero of a following four-byte start code
+func trimZeros(nal []byte) []byte {
+	for len(nal) > 0 && nal[len(nal)-1] == 0 {
+		nal = nal[:len(nal)-1]
+	}
+
+	return nal
+}
@@ -0,0 +1,219 @@
+package decoder
+
+import (
+	"errors"
+	"testing"
+)
+
+// psiPayload wraps a PSI section in a pointer field and a placeholder CRC32, the way
+// tsPayload hands it to parsePAT and parsePMT
+func psiPayload(section ...byte) []byte {
+	payload := append([]byte{0x00}, section...)
+
+	return append(payload, 0xde, 0xad, 0xbe, 0xef)
+}
+
+func TestParsePAT(t *testing.T) {
+	tests := []struct {
+		name    string
+		payload []byte
+		want    uint16
+		wantOK  bool
+	}{
+		{
+			name: "one program",
+			payload: psiPayload(
+				0x00, 0xb0, 0x0d,
+				0x00, 0x01, 0xc1, 0x00, 0x00,
+				0x00, 0x01, 0xf0, 0x00,
+			),
+			want:   0x1000,
+			wantOK: true,
+		},
+		{
+			name: "network information table first",
+			payload: psiPayload(
+				0x00, 0xb0, 0x11,
+				0x00, 0x01, 0xc1, 0x00, 0x00,
+				0x00, 0x00, 0xe0, 0x10,
+				0x00, 0x01, 0xe1, 0x00,
+			),
+			want:   0x0100,
+			wantOK: true,
+		},
+		{
+			name:    "section length 9 without programs",
+			payload: psiPayload(0x00, 0xb0, 0x09, 0x00, 0x01, 0xc1, 0x00, 0x00),
+		},
+		{
+			name:    "section length below 9",
+			payload: psiPayload(0x00, 0xb0, 0x05, 0x00),
+		},
+		{
+			name:    "truncated section",
+			payload: []byte{0x00, 0x00, 0xb0, 0x0d, 0x00, 0x01, 0xc1},
+		},
+		{
+			name:    "pointer field past the payload",
+			payload: []byte{0x10, 0x00, 0xb0},
+		},
+		{
+			name:    "empty payload",
+			payload: nil,
+		},
+		{
+			name: "wrong table ID",
+			payload: psiPayload(
+				0x02, 0xb0, 0x0d,
+				0x00, 0x01, 0xc1, 0x00, 0x00,
+				0x00, 0x01, 0xf0, 0x00,
+			),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := parsePAT(tt.payload)
+			if ok != tt.wantOK || got != tt.want {
+				t.Errorf("parsePAT() = 0x%04x, %v, want 0x%04x, %v", got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestParsePMT(t *testing.T) {
+	tests := []struct {
+		name    string
+		payload []byte
+		want    []tsStream
+		wantErr error
+	}{
+		{
+			name: "one H.264 stream",
+			payload: psiPayload(
+				0x02, 0xb0, 0x12,
+				0x00, 0x01, 0xc1, 0x00, 0x00,
+				0xe1, 0x00,
+				0xf0, 0x00,
+				streamTypeH264, 0xe1, 0x00, 0xf0, 0x00,
+			),
+			want: []tsStream{{pid: 0x0100, streamType: streamTypeH264}},
+		},
+		{
+			name: "program and stream descriptors",
+			payload: psiPayload(
+				0x02, 0xb0, 0x1a,
+				0x00, 0x01, 0xc1, 0x00, 0x00,
+				0xe1, 0x00,
+				0xf0, 0x02, 0x05, 0x00,
+				streamTypeH265, 0xe1, 0x00, 0xf0, 0x00,
+				0x0f, 0xe1, 0x01, 0xf0, 0x01, 0x0a,
+			),
+			want: []tsStream{
+				{pid: 0x0100, streamType: streamTypeH265},
+				{pid: 0x0101, streamType: 0x0f},
+			},
+		},
+		{
+			name:    "section length 9",
+			payload: psiPayload(0x02, 0xb0, 0x09, 0x00, 0x01, 0xc1, 0x00, 0x00, 0xe1),
+			wantErr: ErrUnsupportedSegment,
+		},
+		{
+			name:    "section length 12",
+			payload: psiPayload(0x02, 0xb0, 0x0c, 0x00, 0x01, 0xc1, 0x00, 0x00, 0xe1, 0x00, 0xf0, 0x00),
+			wantErr: ErrUnsupportedSegment,
+		},
+		{
+			name: "section length 13 without streams",
+			payload: psiPayload(
+				0x02, 0xb0, 0x0d,
+				0x00, 0x01, 0xc1, 0x00, 0x00,
+				0xe1, 0x00,
+				0xf0, 0x00,
+			),
+		},
+		{
+			name: "program info overruns the section",
+			payload: psiPayload(
+				0x02, 0xb0, 0x12,
+				0x00, 0x01, 0xc1, 0x00, 0x00,
+				0xe1, 0x00,
+				0xff, 0xff,
+				streamTypeH264, 0xe1, 0x00, 0xf0, 0x00,
+			),
+			wantErr: ErrUnsupportedSegment,
+		},
+		{
+			name: "stream info overruns the section",
+			payload: psiPayload(
+				0x02, 0xb0, 0x12,
+				0x00, 0x01, 0xc1, 0x00, 0x00,
+				0xe1, 0x00,
+				0xf0, 0x00,
+				streamTypeH264, 0xe1, 0x00, 0xf0, 0x40,
+			),
+			wantErr: ErrUnsupportedSegment,
+		},
+		{
+			name:    "truncated section",
+			payload: []byte{0x00, 0x02, 0xb0, 0x12, 0x00, 0x01, 0xc1, 0x00},
+			wantErr: ErrUnsupportedSegment,
+		},
+		{
+			name: "wrong table ID",
+			payload: psiPayload(
+				0x00, 0xb0, 0x12,
+				0x00, 0x01, 0xc1, 0x00, 0x00,
+				0xe1, 0x00,
+				0xf0, 0x00,
+				streamTypeH264, 0xe1, 0x00, 0xf0, 0x00,
+			),
+			wantErr: ErrUnsupportedSegment,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parsePMT(tt.payload)
+
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("parsePMT() error = %v, want %v", err, tt.wantErr)
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("parsePMT() error = %v", err)
+			}
+
+			if len(got) != len(tt.want) {
+				t.Fatalf("parsePMT() = %v, want %v", got, tt.want)
+			}
+
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Errorf("parsePMT()[%d] = %+v, want %+v", i, got[i], tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestDetectKeyframeTSShortPMT(t *testing.T) {
+	segment := warmupSegment()
+
+	if err := detectKeyframeTS(segment); err != nil {
+		t.Fatalf("detectKeyframeTS(warm-up segment) error = %v", err)
+	}
+
+	// Replace the PMT with one whose section ends right after the CRC-stripped header
+	pmt := psiPacket(warmupPMTPID, []byte{0x02, 0xb0, 0x09, 0x00, 0x01, 0xc1, 0x00, 0x00, 0xe1})
+	copy(segment[tsPacketSize:], pmt)
+
+	if err := detectKeyframeTS(segment); !errors.Is(err, ErrUnsupportedSegment) {
+		t.Errorf("detectKeyframeTS(short PMT) error = %v, want %v", err, ErrUnsupportedSegment)
+	}
+}
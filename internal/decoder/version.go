@@ -0,0 +1,121 @@
+package decoder
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// DecoderNative names the built-in MPEG-TS and packed audio parsers
+const DecoderNative = "native"
+
+// FFprobeInfo describes the installed ffprobe build
+type FFprobeInfo struct {
+	// Version is the reported version, e.g., "6.1.1-3ubuntu5" or "N-113348-g0a5813fc68"
+	Version string
+
+	// Major and Minor are zero for git snapshots, which are treated as current
+	Major int
+	Minor int
+
+	// LibAVFormat is the demuxer library version, e.g., "60.16.100"
+	LibAVFormat string
+
+	// ReadIntervals reports support for -read_intervals with packet counts (%+#N),
+	// which stops ffprobe after the first frame instead of demuxing the whole segment
+	ReadIntervals bool
+}
+
+// String names the build for results, e.g., "ffprobe 6.1.1 (libavformat 60.16.100)"
+func (i FFprobeInfo) String() string {
+	if i.LibAVFormat == "" {
+		return "ffprobe " + i.Version
+	}
+
+	return fmt.Sprintf("ffprobe %s (libavformat %s)", i.Version, i.LibAVFormat)
+}
+
+var (
+	versionLine     = regexp.MustCompile(`^ffprobe version (\S+)`)
+	releaseVersion  = regexp.MustCompile(`^n?(\d+)\.(\d+)`)
+	libavformatLine = regexp.MustCompile(`^libavformat\s+(\d+)\.\s*(\d+)\.\s*(\d+)`)
+)
+
+// unknownFFprobe stands in for builds that cannot report their version; they are
+// assumed to be current
+var unknownFFprobe = FFprobeInfo{Version: "unknown", ReadIntervals: true}
+
+// installedFFprobe detects the ffprobe build once per process
+var installedFFprobe = sync.OnceValues(func() (FFprobeInfo, error) {
+	info, err := DetectFFprobe(context.Background())
+	if err != nil && !errors.Is(err, ErrFFprobeNotFound) {
+		return unknownFFprobe, nil
+	}
+
+	return info, err
+})
+
+// DetectFFprobe runs ffprobe -version and reports the build and its capabilities
+func DetectFFprobe(ctx context.Context) (FFprobeInfo, error) {
+	if _, err := ffprobeBinary(); err != nil {
+		return FFprobeInfo{}, err
+	}
+
+	out, err := runFFprobe(ctx, nil, "-version")
+	if err != nil {
+		return FFprobeInfo{}, fmt.Errorf("failed to query ffprobe version: %w", err)
+	}
+
+	// Unrecognized banners (vendor forks) are assumed to be current builds
+	info, ok := parseFFprobeVersion(string(out))
+	if !ok {
+		return unknownFFprobe, nil
+	}
+
+	return info, nil
+}
+
+// InstalledFFprobe returns the ffprobe build detected at first use
+func InstalledFFprobe() (FFprobeInfo, error) {
+	return installedFFprobe()
+}
+
+// parseFFprobeVersion reads the version banner and library versions
+func parseFFprobeVersion(output string) (FFprobeInfo, bool) {
+	var (
+		info  FFprobeInfo
+		found bool
+	)
+
+	scanner := bufio.NewScanner(strings.NewReader(output))
+
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+
+		if m := versionLine.FindStringSubmatch(line); m != nil {
+			info.Version = m[1]
+			found = true
+
+			if v := releaseVersion.FindStringSubmatch(m[1]); v != nil {
+				info.Major, _ = strconv.Atoi(v[1])
+				info.Minor, _ = strconv.Atoi(v[2])
+			}
+
+			continue
+		}
+
+		if m := libavformatLine.FindStringSubmatch(line); m != nil {
+			info.LibAVFormat = m[1] + "." + m[2] + "." + m[3]
+		}
+	}
+
+	// -read_intervals arrived in FFmpeg 2.1; snapshots (no release number) are newer
+	info.ReadIntervals = info.Major == 0 || info.Major > 2 || (info.Major == 2 && info.Minor >= 1)
+
+	return info, found
+}
@@ -0,0 +1,126 @@
+package decoder
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// Layout of the built-in warm-up segment
+const (
+	warmupPMTPID   = 0x1000
+	warmupVideoPID = 0x0100
+)
+
+// WarmUp runs both frame detection paths on a tiny built-in MPEG-TS segment so the
+// first timed sample does not pay for cold binaries: the native parser is exercised
+// and, when installed, ffprobe is spawned once to page in its executable and
+// libraries (libav builds initialize the linked demuxers instead). It returns how
+// long the warm-up took.
+func WarmUp(ctx context.Context) (time.Duration, error) {
+	start := time.Now()
+
+	segment := warmupSegment()
+
+	if err := detectKeyframeTS(segment); err != nil {
+		return 0, err
+	}
+
+	if err := CheckFFprobe(); err != nil {
+		return time.Since(start), nil
+	}
+
+	// The sample carries no decodable picture, so ffprobe finding no frame is expected
+	_, _, err := decodeFirstFrame(ctx, segment, "v:0", ErrNoFramesFound)
+	if err != nil && !errors.Is(err, ErrNoFramesFound) {
+		return 0, err
+	}
+
+	return time.Since(start), nil
+}
+
+// warmupSegment builds a three-packet MPEG-TS segment: a PAT, a PMT announcing one
+// H.264 stream, and a PES packet holding an access unit delimiter and an IDR slice
+func warmupSegment() []byte {
+	pat := psiPacket(tsPATPID, []byte{
+		0x00, 0xb0, 0x0d, // table_id, section_length = 13
+		0x00, 0x01, 0xc1, 0x00, 0x00, // transport_stream_id, version, section numbers
+		0x00, 0x01, 0xe0 | warmupPMTPID>>8, warmupPMTPID & 0xff, // program 1 -> PMT
+	})
+
+	pmt := psiPacket(warmupPMTPID, []byte{
+		0x02, 0xb0, 0x12, // table_id, section_length = 18
+		0x00, 0x01, 0xc1, 0x00, 0x00, // program_number, version, section numbers
+		0xe0 | warmupVideoPID>>8, warmupVideoPID & 0xff, // PCR PID
+		0xf0, 0x00, // program_info_length
+		streamTypeH264, 0xe0 | warmupVideoPID>>8, warmupVideoPID & 0xff, 0xf0, 0x00,
+	})
+
+	pes := []byte{
+		0x00, 0x00, 0x01, 0xe0, 0x00, 0x00, // start code, video stream id, unbounded length
+		0x80, 0x80, 0x05, // flags, PTS only, header length
+		0x21, 0x00, 0x01, 0x00, 0x01, // PTS = 0
+		0x00, 0x00, 0x00, 0x01, 0x09, 0xf0, // access unit delimiter
+		0x00, 0x00, 0x00, 0x01, 0x65, 0x88, 0x84, 0x00, // IDR slice
+	}
+
+	video := tsPacket(warmupVideoPID, pes)
+
+	segment := make([]byte, 0, 3*tsPacketSize)
+	segment = append(segment, pat...)
+	segment = append(segment, pmt...)
+
+	return append(segment, video...)
+}
+
+// psiPacket wraps a PSI section (without its CRC) in a TS packet, appending the CRC32
+func psiPacket(pid uint16, section []byte) []byte {
+	crc := mpegCRC32(section)
+
+	payload := append([]byte{0x00}, section...)
+	payload = append(payload, byte(crc>>24), byte(crc>>16), byte(crc>>8), byte(crc))
+
+	return tsPacket(pid, payload)
+}
+
+// tsPacket builds a payload-unit-start TS packet, padding the payload with an
+// adaptation field so it ends exactly at the packet boundary
+func tsPacket(pid uint16, payload []byte) []byte {
+	packet := []byte{tsSyncByte, 0x40 | byte(pid>>8), byte(pid), 0x30}
+
+	stuffing := tsPacketSize - 4 - len(payload)
+
+	// The adaptation field length byte plus flags take two bytes of the stuffing
+	packet = append(packet, byte(stuffing-1), 0x00)
+
+	for i := 2; i < stuffing; i++ {
+		packet = append(packet, 0xff)
+	}
+
+	return append(packet, payload...)
+}
+
+// mpegCRC32 computes the CRC32/MPEG-2 checksum that terminates PSI sections
+func mpegCRC32(data []byte) uint32 {
+	crc := uint32(0xffffffff)
+
+	for _, b := range data {
+		crc ^= uint32(b) << 24
+
+		for i := 0; i < 8; i++ {
+			if crc&0x80000000 != 0 {
+				crc = crc<<1 ^ 0x04c11db7
+			} else {
+				crc <<= 1
+			}
+		}
+	}
+
+	return crc
+}
+
+// SyntheticSegment returns the built-in warm-up segment, whose IDR slice the native
+// parser detects; the self-test origin serves it as every media segment
+func SyntheticSegment() []byte {
+	return warmupSegment()
+}
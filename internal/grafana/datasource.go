@@ -0,0 +1,252 @@
+package grafana
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"codeberg.org/pwnderpants/vtrace/internal/history"
+)
+
+// defaultRange is the query window used when a request does not specify one
+const defaultRange = 6 * time.Hour
+
+// queryRequest is the subset of the Grafana JSON datasource query body vtrace uses
+type queryRequest struct {
+	Range struct {
+		From time.Time `json:"from"`
+		To   time.Time `json:"to"`
+	} `json:"range"`
+	Targets []struct {
+		Target string `json:"target"`
+	} `json:"targets"`
+	MaxDataPoints int `json:"maxDataPoints"`
+}
+
+// timeSeries is a single Grafana series of [value, unix-ms] pairs
+type timeSeries struct {
+	Target     string       `json:"target"`
+	Datapoints [][2]float64 `json:"datapoints"`
+}
+
+// point is a flat time-series row suited to the Infinity plugin
+type point struct {
+	Time     time.Time `json:"time"`
+	URL      string    `json:"url"`
+	Protocol string    `json:"protocol"`
+	Metric   string    `json:"metric"`
+	Value    float64   `json:"value"`
+}
+
+// NewHandler returns an http.Handler implementing the Grafana JSON datasource API
+// (/, /search, /query) plus a flat /series endpoint for the Infinity plugin
+func NewHandler(store history.Store) http.Handler {
+	mux := http.NewServeMux()
+
+	// Grafana calls the root path to test the datasource connection
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/" {
+			http.NotFound(w, r)
+
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+	})
+
+	mux.HandleFunc("/search", func(w http.ResponseWriter, r *http.Request) {
+		records, err := store.Query(time.Time{}, time.Now())
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+
+			return
+		}
+
+		writeJSON(w, metricNames(records))
+	})
+
+	mux.HandleFunc("/query", func(w http.ResponseWriter, r *http.Request) {
+		var req queryRequest
+
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, fmt.Sprintf("invalid query: %v", err), http.StatusBadRequest)
+
+			return
+		}
+
+		from, to := req.Range.From, req.Range.To
+
+		if to.IsZero() {
+			to = time.Now()
+		}
+
+		if from.IsZero() {
+			from = to.Add(-defaultRange)
+		}
+
+		records, err := store.Query(from, to)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+
+			return
+		}
+
+		var series []timeSeries
+
+		for _, t := range req.Targets {
+			series = append(series, buildSeries(records, t.Target, req.MaxDataPoints)...)
+		}
+
+		if series == nil {
+			series = []timeSeries{}
+		}
+
+		writeJSON(w, series)
+	})
+
+	mux.HandleFunc("/series", func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+
+		to := time.Now()
+		from := to.Add(-defaultRange)
+
+		if v := query.Get("from"); v != "" {
+			parsed, err := parseTime(v)
+			if err != nil {
+				http.Error(w, fmt.Sprintf("invalid from: %v", err), http.StatusBadRequest)
+
+				return
+			}
+
+			from = parsed
+		}
+
+		if v := query.Get("to"); v != "" {
+			parsed, err := parseTime(v)
+			if err != nil {
+				http.Error(w, fmt.Sprintf("invalid to: %v", err), http.StatusBadRequest)
+
+				return
+			}
+
+			to = parsed
+		}
+
+		metric := query.Get("metric")
+
+		if metric == "" {
+			metric = "total_ttff"
+		}
+
+		records, err := store.Query(from, to)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+
+			return
+		}
+
+		points := []point{}
+
+		for _, record := range records {
+			value, ok := record.Metrics[metric]
+			if !ok {
+				continue
+			}
+
+			points = append(points, point{
+				Time:     record.Time,
+				URL:      record.URL,
+				Protocol: record.Protocol,
+				Metric:   metric,
+				Value:    value,
+			})
+		}
+
+		writeJSON(w, points)
+	})
+
+	return mux
+}
+
+// metricNames returns the sorted set of metric keys present in the records
+func metricNames(records []history.Record) []string {
+	seen := make(map[string]bool)
+
+	for _, record := range records {
+		for name := range record.Metrics {
+			seen[name] = true
+		}
+	}
+
+	names := make([]string, 0, len(seen))
+
+	for name := range seen {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	return names
+}
+
+// buildSeries groups a metric's values by URL, emitting one series per URL
+func buildSeries(records []history.Record, metric string, maxPoints int) []timeSeries {
+	byURL := make(map[string]*timeSeries)
+
+	var order []string
+
+	for _, record := range records {
+		value, ok := record.Metrics[metric]
+		if !ok {
+			continue
+		}
+
+		s, ok := byURL[record.URL]
+		if !ok {
+			s = &timeSeries{Target: metric, Datapoints: [][2]float64{}}
+			byURL[record.URL] = s
+			order = append(order, record.URL)
+		}
+
+		s.Datapoints = append(s.Datapoints, [2]float64{value, float64(record.Time.UnixMilli())})
+	}
+
+	series := make([]timeSeries, 0, len(order))
+
+	for _, u := range order {
+		s := byURL[u]
+
+		// Label series by URL only when several streams share the store
+		if len(order) > 1 {
+			s.Target = metric + " " + u
+		}
+
+		// Keep the most recent points when Grafana caps the series length
+		if maxPoints > 0 && len(s.Datapoints) > maxPoints {
+			s.Datapoints = s.Datapoints[len(s.Datapoints)-maxPoints:]
+		}
+
+		series = append(series, *s)
+	}
+
+	return series
+}
+
+// parseTime accepts RFC 3339 timestamps or Unix milliseconds
+func parseTime(v string) (time.Time, error) {
+	if ms, err := strconv.ParseInt(v, 10, 64); err == nil {
+		return time.UnixMilli(ms), nil
+	}
+
+	return time.Parse(time.RFC3339, v)
+}
+
+// writeJSON encodes a response body as JSON
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+
+	json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,174 @@
+package history
+
+import (
+	"math"
+	"sort"
+	"strings"
+	"time"
+)
+
+// AggregateInterval is the bucket width raw records are downsampled into
+const AggregateInterval = time.Hour
+
+// maxTime is the latest time a query bound can express
+var maxTime = time.Unix(0, math.MaxInt64).UTC()
+
+// CompactResult counts what a compaction pass changed
+type CompactResult struct {
+	Downsampled int
+	Aggregates  int
+	Expired     int
+	Removed     int
+}
+
+// aggregateKey groups raw records that share an hourly bucket
+type aggregateKey struct {
+	hour       int64
+	url        string
+	protocol   string
+	experiment string
+	arm        string
+	labels     string
+	config     string
+}
+
+// aggregateBucket accumulates the raw records of one bucket
+type aggregateBucket struct {
+	record Record
+	sums   map[string]float64
+	counts map[string]int
+	errors map[string]int
+}
+
+// compact applies retention to records: raw records before rawBefore become hourly
+// aggregates (mean metrics over successful samples), and anything before
+// aggregateBefore is dropped. It returns the surviving records, oldest first.
+func compact(records []Record, rawBefore, aggregateBefore time.Time) ([]Record, CompactResult) {
+	var (
+		result  CompactResult
+		kept    []Record
+		buckets = map[aggregateKey]*aggregateBucket{}
+		order   []aggregateKey
+	)
+
+	for _, record := range records {
+		if !aggregateBefore.IsZero() && record.Time.Before(aggregateBefore) {
+			result.Expired++
+
+			continue
+		}
+
+		if record.IsAggregate() || rawBefore.IsZero() || !record.Time.Before(rawBefore) {
+			kept = append(kept, record)
+
+			continue
+		}
+
+		result.Downsampled++
+
+		start := record.Time.Truncate(AggregateInterval)
+
+		key := aggregateKey{
+			hour:       start.UnixNano(),
+			url:        record.URL,
+			protocol:   record.Protocol,
+			experiment: record.Experiment,
+			arm:        record.Arm,
+			labels:     labelKey(record.Labels),
+			config:     record.Config,
+		}
+
+		bucket, ok := buckets[key]
+		if !ok {
+			bucket = &aggregateBucket{
+				record: Record{
+					SchemaVersion: SchemaVersion,
+					Time:          start,
+					URL:           record.URL,
+					Protocol:      record.Protocol,
+					Experiment:    record.Experiment,
+					Arm:           record.Arm,
+					Labels:        record.Labels,
+					Config:        record.Config,
+				},
+				sums:   map[string]float64{},
+				counts: map[string]int{},
+				errors: map[string]int{},
+			}
+			buckets[key] = bucket
+			order = append(order, key)
+		}
+
+		bucket.record.Samples++
+
+		if record.Error != "" {
+			bucket.record.Failures++
+			bucket.errors[record.Error]++
+
+			continue
+		}
+
+		for name, value := range record.Metrics {
+			bucket.sums[name] += value
+			bucket.counts[name]++
+		}
+	}
+
+	for _, key := range order {
+		kept = append(kept, buckets[key].finish())
+	}
+
+	result.Aggregates = len(order)
+	result.Removed = result.Downsampled + result.Expired
+
+	sort.SliceStable(kept, func(i, j int) bool {
+		return kept[i].Time.Before(kept[j].Time)
+	})
+
+	return kept, result
+}
+
+// labelKey renders labels in a canonical order for grouping
+func labelKey(labels map[string]string) string {
+	keys := make([]string, 0, len(labels))
+
+	for key := range labels {
+		keys = append(keys, key)
+	}
+
+	sort.Strings(keys)
+
+	var b strings.Builder
+
+	for _, key := range keys {
+		b.WriteString(key + "=" + labels[key] + "\x00")
+	}
+
+	return b.String()
+}
+
+// finish averages the bucket's metrics; a bucket with no successful sample keeps
+// its most frequent error instead
+func (b *aggregateBucket) finish() Record {
+	record := b.record
+
+	if record.Failures == record.Samples {
+		best := 0
+
+		for message, count := range b.errors {
+			if count > best || (count == best && message < record.Error) {
+				record.Error, best = message, count
+			}
+		}
+
+		return record
+	}
+
+	record.Metrics = make(map[string]float64, len(b.sums))
+
+	for name, sum := range b.sums {
+		record.Metrics[name] = sum / float64(b.counts[name])
+	}
+
+	return record
+}
@@ -0,0 +1,6 @@
+//go:build postgres
+
+package history
+
+// The pgx database/sql adapter registers itself as "pgx"
+import _ "github.com/jackc/pgx/v5/stdlib"
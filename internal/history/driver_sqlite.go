@@ -0,0 +1,4 @@
+package history
+
+// The pure-Go SQLite driver registers itself as "sqlite"
+import _ "modernc.org/sqlite"
@@ -0,0 +1,186 @@
+package history
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// FileStore persists records as newline-delimited JSON in a single file
+type FileStore struct {
+	path string
+	mu   sync.Mutex
+}
+
+// OpenFile prepares a history file for appending, creating it if needed
+func OpenFile(path string) (*FileStore, error) {
+	if dir := filepath.Dir(path); dir != "." {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return nil, fmt.Errorf("failed to create history directory: %w", err)
+		}
+	}
+
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open history file: %w", err)
+	}
+
+	f.Close()
+
+	return &FileStore{path: path}, nil
+}
+
+// Append writes a record to the end of the history file
+func (s *FileStore) Append(record Record) error {
+	if record.SchemaVersion == 0 {
+		record.SchemaVersion = SchemaVersion
+	}
+
+	line, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("failed to encode history record: %w", err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	f, err := os.OpenFile(s.path, os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		return fmt.Errorf("failed to open history file: %w", err)
+	}
+	defer f.Close()
+
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		return fmt.Errorf("failed to write history record: %w", err)
+	}
+
+	return nil
+}
+
+// Query returns records with timestamps in [from, to], oldest first
+func (s *FileStore) Query(from, to time.Time) ([]Record, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.query(from, to)
+}
+
+// query reads matching records; the caller holds the lock
+func (s *FileStore) query(from, to time.Time) ([]Record, error) {
+	f, err := os.Open(s.path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open history file: %w", err)
+	}
+	defer f.Close()
+
+	var records []Record
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+
+	for scanner.Scan() {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+
+		var record Record
+
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			return nil, fmt.Errorf("failed to decode history record: %w", err)
+		}
+
+		if record.SchemaVersion > SchemaVersion {
+			return nil, fmt.Errorf("%w: %d", ErrUnsupportedSchema, record.SchemaVersion)
+		}
+
+		if record.Time.Before(from) || record.Time.After(to) {
+			continue
+		}
+
+		records = append(records, record)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read history file: %w", err)
+	}
+
+	// Imported records are appended after newer ones
+	sort.SliceStable(records, func(i, j int) bool {
+		return records[i].Time.Before(records[j].Time)
+	})
+
+	return records, nil
+}
+
+// Compact downsamples raw records older than rawBefore into hourly aggregates and
+// drops aggregates older than aggregateBefore, rewriting the file atomically
+func (s *FileStore) Compact(rawBefore, aggregateBefore time.Time) (CompactResult, error) {
+	// Only whole hours are downsampled so each bucket is aggregated exactly once
+	rawBefore = rawBefore.Truncate(AggregateInterval)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	records, err := s.query(time.Time{}, maxTime)
+	if err != nil {
+		return CompactResult{}, err
+	}
+
+	kept, result := compact(records, rawBefore, aggregateBefore)
+
+	if result.Removed == 0 {
+		return result, nil
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(s.path), filepath.Base(s.path)+".compact-*")
+	if err != nil {
+		return CompactResult{}, fmt.Errorf("failed to create compacted history file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	// CreateTemp uses 0600; keep the permissions OpenFile gives new history files
+	if err := tmp.Chmod(0o644); err != nil {
+		tmp.Close()
+
+		return CompactResult{}, fmt.Errorf("failed to create compacted history file: %w", err)
+	}
+
+	w := bufio.NewWriter(tmp)
+
+	for _, record := range kept {
+		line, err := json.Marshal(record)
+		if err != nil {
+			tmp.Close()
+
+			return CompactResult{}, fmt.Errorf("failed to encode history record: %w", err)
+		}
+
+		w.Write(append(line, '\n'))
+	}
+
+	if err := w.Flush(); err != nil {
+		tmp.Close()
+
+		return CompactResult{}, fmt.Errorf("failed to write compacted history file: %w", err)
+	}
+
+	if err := tmp.Close(); err != nil {
+		return CompactResult{}, fmt.Errorf("failed to write compacted history file: %w", err)
+	}
+
+	if err := os.Rename(tmp.Name(), s.path); err != nil {
+		return CompactResult{}, fmt.Errorf("failed to replace history file: %w", err)
+	}
+
+	return result, nil
+}
+
+// Close is a no-op; the file is reopened for every append and query
+func (s *FileStore) Close() error {
+	return nil
+}
@@ -0,0 +1,127 @@
+package history
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+var ErrInvalidFilter = errors.New("invalid history filter")
+
+// filterKeys lists the record fields a filter term can select on
+var filterKeys = []string{"url", "protocol", "experiment", "arm", "run_id", "config", "label"}
+
+// filterTerm matches one record field against a value ("*" at the end matches a prefix)
+type filterTerm struct {
+	key   string
+	label string
+	value string
+}
+
+// Filter selects stored records; terms on the same field are alternatives (OR)
+// and terms on different fields must all match (AND)
+type Filter struct {
+	Spec  string
+	terms []filterTerm
+}
+
+// ParseFilter parses a comma-separated list of key=value terms, such as
+// "url=https://cdn.example.com/*,label=region:eu"
+func ParseFilter(spec string) (Filter, error) {
+	filter := Filter{Spec: spec}
+
+	for _, entry := range strings.Split(spec, ",") {
+		entry = strings.TrimSpace(entry)
+
+		if entry == "" {
+			continue
+		}
+
+		key, value, ok := strings.Cut(entry, "=")
+		if !ok {
+			return Filter{}, fmt.Errorf("%w: expected key=value, got %q", ErrInvalidFilter, entry)
+		}
+
+		term := filterTerm{key: strings.ToLower(strings.TrimSpace(key)), value: strings.TrimSpace(value)}
+
+		known := false
+
+		for _, k := range filterKeys {
+			known = known || k == term.key
+		}
+
+		if !known {
+			return Filter{}, fmt.Errorf("%w: unknown key %q (want %s)", ErrInvalidFilter, term.key, strings.Join(filterKeys, ", "))
+		}
+
+		if term.key == "label" {
+			term.label, term.value, ok = strings.Cut(term.value, ":")
+			if !ok || term.label == "" {
+				return Filter{}, fmt.Errorf("%w: expected label=name:value, got %q", ErrInvalidFilter, entry)
+			}
+		}
+
+		filter.terms = append(filter.terms, term)
+	}
+
+	if len(filter.terms) == 0 {
+		return Filter{}, fmt.Errorf("%w: no terms in %q", ErrInvalidFilter, spec)
+	}
+
+	return filter, nil
+}
+
+// Match reports whether a record satisfies the filter
+func (f Filter) Match(record Record) bool {
+	// Group the outcome by field (labels by name) so alternatives on one field are ORed
+	matched := make(map[string]bool)
+
+	for _, term := range f.terms {
+		group := term.key + ":" + term.label
+
+		if !matched[group] {
+			matched[group] = term.matches(record)
+		}
+	}
+
+	for _, ok := range matched {
+		if !ok {
+			return false
+		}
+	}
+
+	return true
+}
+
+// matches compares the term's field of a record with its value
+func (t filterTerm) matches(record Record) bool {
+	var field string
+
+	switch t.key {
+	case "url":
+		field = record.URL
+	case "protocol":
+		field = record.Protocol
+	case "experiment":
+		field = record.Experiment
+	case "arm":
+		field = record.Arm
+	case "run_id":
+		field = record.RunID
+	case "config":
+		field = record.Config
+	case "label":
+		value, ok := record.Labels[t.label]
+		if !ok {
+			return false
+		}
+
+		field = value
+	}
+
+	if prefix, ok := strings.CutSuffix(t.value, "*"); ok {
+		return strings.HasPrefix(field, prefix)
+	}
+
+	return field == t.value
+}
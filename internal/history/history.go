@@ -0,0 +1,96 @@
+package history
+
+import (
+	"errors"
+	"strings"
+	"time"
+)
+
+// SchemaVersion identifies the layout of stored records
+const SchemaVersion = 1
+
+var (
+	ErrUnsupportedSchema  = errors.New("unsupported history schema version")
+	ErrBackendUnavailable = errors.New("history backend not compiled in")
+)
+
+// Record is a single stored measurement
+type Record struct {
+	SchemaVersion int                `json:"schema_version"`
+	RunID         string             `json:"run_id"`
+	Time          time.Time          `json:"time"`
+	URL           string             `json:"url"`
+	Protocol      string             `json:"protocol"`
+	Experiment    string             `json:"experiment,omitempty"`
+	Arm           string             `json:"arm,omitempty"`
+	Labels        map[string]string  `json:"labels,omitempty"`
+	Error         string             `json:"error,omitempty"`
+	Metrics       map[string]float64 `json:"metrics_ms,omitempty"`
+	Anomalies     []string           `json:"anomalies,omitempty"`
+	Samples       int                `json:"samples,omitempty"`
+	Failures      int                `json:"failures,omitempty"`
+	Config        string             `json:"config,omitempty"`
+}
+
+// IsAggregate reports whether the record was downsampled from several raw records
+func (r Record) IsAggregate() bool {
+	return r.Samples > 0
+}
+
+// Store appends and queries stored measurements
+type Store interface {
+	// Append writes a record to the store
+	Append(record Record) error
+
+	// Query returns records with timestamps in [from, to], oldest first
+	Query(from, to time.Time) ([]Record, error)
+
+	// Compact downsamples raw records older than rawBefore into hourly aggregates
+	// and deletes aggregates older than aggregateBefore; zero times skip a step
+	Compact(rawBefore, aggregateBefore time.Time) (CompactResult, error)
+
+	// Close releases the backend's resources
+	Close() error
+}
+
+// Open selects a backend from the location: "sqlite:PATH" for SQLite,
+// "postgres://..." (or "postgresql://...") for PostgreSQL, and anything else
+// (optionally prefixed with "file:") for a newline-delimited JSON file
+func Open(location string) (Store, error) {
+	switch {
+	case strings.HasPrefix(location, "sqlite:"):
+		return openSQL(dialectSQLite, sqlitePath(location))
+	case isPostgres(location):
+		return openSQL(dialectPostgres, location)
+	}
+
+	return OpenFile(FilePath(location))
+}
+
+// isPostgres reports whether a location is a PostgreSQL connection URL
+func isPostgres(location string) bool {
+	return strings.HasPrefix(location, "postgres://") || strings.HasPrefix(location, "postgresql://")
+}
+
+// sqlitePath returns the database file a "sqlite:" location points at
+func sqlitePath(location string) string {
+	return strings.TrimPrefix(strings.TrimPrefix(location, "sqlite:"), "//")
+}
+
+// LocalPath returns the file a flat-file or SQLite location stores its history in; it
+// reports false for PostgreSQL, whose history lives on a server
+func LocalPath(location string) (string, bool) {
+	switch {
+	case strings.HasPrefix(location, "sqlite:"):
+		return sqlitePath(location), true
+	case isPostgres(location):
+		return "", false
+	}
+
+	return FilePath(location), true
+}
+
+// FilePath returns the file a flat-file location points at
+func FilePath(location string) string {
+	return strings.TrimPrefix(location, "file:")
+}
@@ -0,0 +1,60 @@
+package history
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+var ErrInvalidRecord = errors.New("invalid history record")
+
+// importedRecord accepts stored records as well as the beacon and Kafka message
+// layout, which carries "timestamp" instead of "time"
+type importedRecord struct {
+	Record
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// DecodeRecord parses one JSON line produced by another probe or an older version.
+// Records without a schema version predate versioning and are read as version 1.
+func DecodeRecord(line []byte) (Record, error) {
+	var imported importedRecord
+
+	if err := json.Unmarshal(line, &imported); err != nil {
+		return Record{}, fmt.Errorf("%w: %v", ErrInvalidRecord, err)
+	}
+
+	record := imported.Record
+
+	if record.SchemaVersion > SchemaVersion {
+		return Record{}, fmt.Errorf("%w: %d", ErrUnsupportedSchema, record.SchemaVersion)
+	}
+
+	if record.SchemaVersion == 0 {
+		record.SchemaVersion = SchemaVersion
+	}
+
+	if record.Time.IsZero() {
+		record.Time = imported.Timestamp
+	}
+
+	switch {
+	case record.Time.IsZero():
+		return Record{}, fmt.Errorf("%w: missing time", ErrInvalidRecord)
+	case record.URL == "":
+		return Record{}, fmt.Errorf("%w: missing url", ErrInvalidRecord)
+	case record.Error == "" && len(record.Metrics) == 0:
+		return Record{}, fmt.Errorf("%w: no metrics and no error", ErrInvalidRecord)
+	}
+
+	record.Time = record.Time.UTC()
+
+	return record, nil
+}
+
+// RecordKey identifies a measurement so the same file can be imported twice safely
+func RecordKey(record Record) string {
+	return strconv.FormatInt(record.Time.UnixNano(), 10) + "\x00" + record.RunID + "\x00" + record.URL + "\x00" + record.Protocol
+}
@@ -0,0 +1,321 @@
+package history
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"math"
+	"slices"
+	"strings"
+	"time"
+)
+
+// sqlDialect describes how one database/sql backend is linked and queried
+type sqlDialect struct {
+	name        string
+	drivers     []string
+	tag         string
+	placeholder func(n int) string
+}
+
+var (
+	dialectSQLite = sqlDialect{
+		name:        "sqlite",
+		drivers:     []string{"sqlite", "sqlite3"},
+		tag:         "sqlite",
+		placeholder: func(int) string { return "?" },
+	}
+	dialectPostgres = sqlDialect{
+		name:        "postgres",
+		drivers:     []string{"pgx", "postgres"},
+		tag:         "postgres",
+		placeholder: func(n int) string { return fmt.Sprintf("$%d", n) },
+	}
+)
+
+// sqlSchema creates the history table; times are Unix nanoseconds so range queries
+// behave the same on every backend, and metrics are stored as JSON text
+var sqlSchema = []string{
+	`CREATE TABLE IF NOT EXISTS vtrace_history (
+	time_ns BIGINT NOT NULL,
+	schema_version INTEGER NOT NULL,
+	run_id TEXT NOT NULL,
+	url TEXT NOT NULL,
+	protocol TEXT NOT NULL,
+	experiment TEXT NOT NULL DEFAULT '',
+	arm TEXT NOT NULL DEFAULT '',
+	labels TEXT NOT NULL DEFAULT '{}',
+	error TEXT NOT NULL DEFAULT '',
+	metrics TEXT NOT NULL DEFAULT '{}',
+	anomalies TEXT NOT NULL DEFAULT '[]',
+	samples INTEGER NOT NULL DEFAULT 0,
+	failures INTEGER NOT NULL DEFAULT 0,
+	config TEXT NOT NULL DEFAULT ''
+)`,
+	`CREATE INDEX IF NOT EXISTS vtrace_history_time ON vtrace_history (time_ns)`,
+}
+
+// sqlMigrations adds columns introduced after a history table was first created; each is
+// applied only when selecting the column fails
+var sqlMigrations = []struct {
+	column     string
+	definition string
+}{
+	{"samples", "INTEGER NOT NULL DEFAULT 0"},
+	{"failures", "INTEGER NOT NULL DEFAULT 0"},
+	{"config", "TEXT NOT NULL DEFAULT ''"},
+}
+
+// sqlColumns lists the history columns in insert and select order
+const sqlColumns = "time_ns, schema_version, run_id, url, protocol, experiment, arm, labels, error, metrics, anomalies, samples, failures, config"
+
+// SQLStore persists records in a SQLite or PostgreSQL table
+type SQLStore struct {
+	db      *sql.DB
+	dialect sqlDialect
+}
+
+// openSQL connects to a database through the first registered driver of the dialect
+func openSQL(dialect sqlDialect, dsn string) (*SQLStore, error) {
+	registered := sql.Drivers()
+
+	driver := ""
+
+	for _, name := range dialect.drivers {
+		if slices.Contains(registered, name) {
+			driver = name
+
+			break
+		}
+	}
+
+	if driver == "" {
+		return nil, fmt.Errorf("%w: %s (rebuild with -tags %s)", ErrBackendUnavailable, dialect.name, dialect.tag)
+	}
+
+	db, err := sql.Open(driver, dsn)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s history: %w", dialect.name, err)
+	}
+
+	for _, statement := range sqlSchema {
+		if _, err := db.Exec(statement); err != nil {
+			db.Close()
+
+			return nil, fmt.Errorf("failed to create %s history table: %w", dialect.name, err)
+		}
+	}
+
+	for _, migration := range sqlMigrations {
+		if _, err := db.Exec("SELECT " + migration.column + " FROM vtrace_history WHERE 1 = 0"); err == nil {
+			continue
+		}
+
+		if _, err := db.Exec("ALTER TABLE vtrace_history ADD COLUMN " + migration.column + " " + migration.definition); err != nil {
+			db.Close()
+
+			return nil, fmt.Errorf("failed to migrate %s history table: %w", dialect.name, err)
+		}
+	}
+
+	return &SQLStore{db: db, dialect: dialect}, nil
+}
+
+// sqlExecer is satisfied by both *sql.DB and *sql.Tx
+type sqlExecer interface {
+	Exec(query string, args ...any) (sql.Result, error)
+	Query(query string, args ...any) (*sql.Rows, error)
+}
+
+// Append inserts a record into the history table
+func (s *SQLStore) Append(record Record) error {
+	return s.insert(s.db, record)
+}
+
+// insert writes one record through a connection or transaction
+func (s *SQLStore) insert(db sqlExecer, record Record) error {
+	if record.SchemaVersion == 0 {
+		record.SchemaVersion = SchemaVersion
+	}
+
+	labels, err := json.Marshal(record.Labels)
+	if err != nil {
+		return fmt.Errorf("failed to encode history record: %w", err)
+	}
+
+	metrics, err := json.Marshal(record.Metrics)
+	if err != nil {
+		return fmt.Errorf("failed to encode history record: %w", err)
+	}
+
+	anomalies, err := json.Marshal(record.Anomalies)
+	if err != nil {
+		return fmt.Errorf("failed to encode history record: %w", err)
+	}
+
+	placeholders := make([]string, 14)
+
+	for i := range placeholders {
+		placeholders[i] = s.dialect.placeholder(i + 1)
+	}
+
+	query := "INSERT INTO vtrace_history (" + sqlColumns + ") VALUES (" + strings.Join(placeholders, ", ") + ")"
+
+	if _, err := db.Exec(query,
+		record.Time.UnixNano(),
+		record.SchemaVersion,
+		record.RunID,
+		record.URL,
+		record.Protocol,
+		record.Experiment,
+		record.Arm,
+		string(labels),
+		record.Error,
+		string(metrics),
+		string(anomalies),
+		record.Samples,
+		record.Failures,
+		record.Config,
+	); err != nil {
+		return fmt.Errorf("failed to write history record: %w", err)
+	}
+
+	return nil
+}
+
+// Query returns records with timestamps in [from, to], oldest first
+func (s *SQLStore) Query(from, to time.Time) ([]Record, error) {
+	query := "SELECT " + sqlColumns + " FROM vtrace_history WHERE time_ns >= " + s.dialect.placeholder(1) +
+		" AND time_ns <= " + s.dialect.placeholder(2) + " ORDER BY time_ns"
+
+	return s.query(s.db, query, unixNanos(from), unixNanos(to))
+}
+
+// query runs a SELECT over sqlColumns and decodes the rows
+func (s *SQLStore) query(db sqlExecer, query string, args ...any) ([]Record, error) {
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query history: %w", err)
+	}
+	defer rows.Close()
+
+	var records []Record
+
+	for rows.Next() {
+		var (
+			record    Record
+			timeNs    int64
+			labels    string
+			metrics   string
+			anomalies string
+		)
+
+		if err := rows.Scan(&timeNs, &record.SchemaVersion, &record.RunID, &record.URL, &record.Protocol,
+			&record.Experiment, &record.Arm, &labels, &record.Error, &metrics, &anomalies,
+			&record.Samples, &record.Failures, &record.Config); err != nil {
+			return nil, fmt.Errorf("failed to read history record: %w", err)
+		}
+
+		if record.SchemaVersion > SchemaVersion {
+			return nil, fmt.Errorf("%w: %d", ErrUnsupportedSchema, record.SchemaVersion)
+		}
+
+		record.Time = time.Unix(0, timeNs).UTC()
+
+		if err := json.Unmarshal([]byte(labels), &record.Labels); err != nil {
+			return nil, fmt.Errorf("failed to decode history record: %w", err)
+		}
+
+		if err := json.Unmarshal([]byte(metrics), &record.Metrics); err != nil {
+			return nil, fmt.Errorf("failed to decode history record: %w", err)
+		}
+
+		if err := json.Unmarshal([]byte(anomalies), &record.Anomalies); err != nil {
+			return nil, fmt.Errorf("failed to decode history record: %w", err)
+		}
+
+		records = append(records, record)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read history: %w", err)
+	}
+
+	return records, nil
+}
+
+// Compact expires old rows and replaces old raw rows with hourly aggregates in one transaction
+func (s *SQLStore) Compact(rawBefore, aggregateBefore time.Time) (CompactResult, error) {
+	// Only whole hours are downsampled so each bucket is aggregated exactly once
+	rawBefore = rawBefore.Truncate(AggregateInterval)
+
+	var result CompactResult
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return result, fmt.Errorf("failed to compact history: %w", err)
+	}
+	defer tx.Rollback()
+
+	if !aggregateBefore.IsZero() {
+		deleted, err := tx.Exec("DELETE FROM vtrace_history WHERE time_ns < "+s.dialect.placeholder(1), unixNanos(aggregateBefore))
+		if err != nil {
+			return result, fmt.Errorf("failed to expire history: %w", err)
+		}
+
+		if n, err := deleted.RowsAffected(); err == nil {
+			result.Expired = int(n)
+		}
+	}
+
+	if !rawBefore.IsZero() {
+		raw, err := s.query(tx, "SELECT "+sqlColumns+" FROM vtrace_history WHERE samples = 0 AND time_ns < "+
+			s.dialect.placeholder(1)+" ORDER BY time_ns", unixNanos(rawBefore))
+		if err != nil {
+			return result, err
+		}
+
+		aggregates, downsampled := compact(raw, rawBefore, time.Time{})
+
+		if downsampled.Downsampled > 0 {
+			if _, err := tx.Exec("DELETE FROM vtrace_history WHERE samples = 0 AND time_ns < "+s.dialect.placeholder(1),
+				unixNanos(rawBefore)); err != nil {
+				return result, fmt.Errorf("failed to downsample history: %w", err)
+			}
+
+			for _, record := range aggregates {
+				if err := s.insert(tx, record); err != nil {
+					return result, err
+				}
+			}
+		}
+
+		result.Downsampled = downsampled.Downsampled
+		result.Aggregates = downsampled.Aggregates
+	}
+
+	if err := tx.Commit(); err != nil {
+		return CompactResult{}, fmt.Errorf("failed to compact history: %w", err)
+	}
+
+	result.Removed = result.Downsampled + result.Expired
+
+	return result, nil
+}
+
+// Close closes the database connection pool
+func (s *SQLStore) Close() error {
+	return s.db.Close()
+}
+
+// unixNanos converts a query bound to Unix nanoseconds, clamping times outside the int64 range
+func unixNanos(t time.Time) int64 {
+	switch {
+	case t.Before(time.Unix(0, math.MinInt64)):
+		return math.MinInt64
+	case t.After(time.Unix(0, math.MaxInt64)):
+		return math.MaxInt64
+	}
+
+	return t.UnixNano()
+}
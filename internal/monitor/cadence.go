@@ -0,0 +1,189 @@
+package monitor
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/grafov/m3u8"
+)
+
+// lateFactor is how many target durations past its schedule a segment may appear, and how
+// long a playlist may go without a new segment, before players waiting on it stall
+const lateFactor = 1.5
+
+// Update is a reload that found new segments at the end of the playlist
+type Update struct {
+	Time     time.Time
+	Segments int
+
+	// Interval is the time since the previous update
+	Interval time.Duration
+
+	// Lateness is how long after it was due the first new segment appeared; a live origin
+	// publishes in real time, so each segment is due its EXTINF duration after the one before
+	Lateness time.Duration
+	Late     bool
+}
+
+// Cadence tracks when new segments appear across reloads of a live playlist
+type Cadence struct {
+	Reloads int
+	Stale   int
+	Updates []Update
+
+	// LongestStale is the longest time the playlist went without a new segment
+	LongestStale time.Duration
+
+	lastSeq    uint64
+	lastUpdate time.Time
+	lastDue    time.Time
+	scheduled  bool
+	flagged    bool
+}
+
+// NewCadence creates an empty cadence tracker
+func NewCadence() *Cadence {
+	return &Cadence{}
+}
+
+// Observe records a reload and returns a late-update anomaly when it found a segment more
+// than 1.5 target durations after it was due, or a stale-playlist anomaly the first time a
+// run of unchanged reloads outlasts 1.5 target durations. Playlists with EXT-X-ENDLIST no
+// longer update and are ignored. Staleness counts from the first reload, so a playlist that
+// never grows is flagged too; the reload that first sees the playlist grow only anchors the
+// schedule, since when it grew before that is unknown.
+func (c *Cadence) Observe(media *m3u8.MediaPlaylist, at time.Time) []Anomaly {
+	if media == nil || media.Closed {
+		return nil
+	}
+
+	segments := Segments(media)
+	if len(segments) == 0 {
+		return nil
+	}
+
+	c.Reloads++
+
+	last := segments[len(segments)-1].Sequence
+
+	// The first reload establishes the end of the playlist and stands in for its last update
+	if c.Reloads == 1 {
+		c.lastSeq = last
+		c.lastUpdate = at
+
+		return nil
+	}
+
+	if last <= c.lastSeq {
+		return c.observeStale(media, at)
+	}
+
+	update := Update{Time: at, Interval: at.Sub(c.lastUpdate)}
+	due := c.lastDue
+
+	for _, seg := range segments {
+		if seg.Sequence <= c.lastSeq {
+			continue
+		}
+
+		due = due.Add(time.Duration(seg.Duration * float64(time.Second)))
+
+		if update.Segments == 0 {
+			update.Lateness = at.Sub(due)
+		}
+
+		update.Segments++
+	}
+
+	c.lastSeq = last
+	c.lastUpdate = at
+	c.lastDue = due
+	c.flagged = false
+
+	c.LongestStale = max(c.LongestStale, update.Interval)
+
+	// A segment that appeared before it was due shows the schedule started late
+	if !c.scheduled || at.Before(due) {
+		c.lastDue = at
+	}
+
+	if !c.scheduled {
+		c.scheduled = true
+
+		return nil
+	}
+
+	update.Lateness = max(update.Lateness, 0)
+	update.Late = update.Lateness.Seconds() > lateFactor*media.TargetDuration
+	c.Updates = append(c.Updates, update)
+
+	if !update.Late {
+		return nil
+	}
+
+	return []Anomaly{{
+		Time:     at,
+		Kind:     AnomalyLateUpdate,
+		Sequence: last - uint64(update.Segments) + 1,
+		Detail: fmt.Sprintf("segment %d appeared %.3fs after it was due (%d new %s, %.3fs since the previous update)",
+			last-uint64(update.Segments)+1, update.Lateness.Seconds(), update.Segments, segmentNoun(update.Segments), update.Interval.Seconds()),
+	}}
+}
+
+// observeStale records a reload that found no new segment
+func (c *Cadence) observeStale(media *m3u8.MediaPlaylist, at time.Time) []Anomaly {
+	c.Stale++
+
+	elapsed := at.Sub(c.lastUpdate)
+	c.LongestStale = max(c.LongestStale, elapsed)
+
+	limit := time.Duration(lateFactor * media.TargetDuration * float64(time.Second))
+
+	if c.flagged || elapsed <= limit {
+		return nil
+	}
+
+	c.flagged = true
+
+	return []Anomaly{{
+		Time:     at,
+		Kind:     AnomalyStalePlaylist,
+		Sequence: c.lastSeq,
+		Detail: fmt.Sprintf("no new segment for %.3fs (target duration %.0fs), last was segment %d",
+			elapsed.Seconds(), media.TargetDuration, c.lastSeq),
+	}}
+}
+
+// Lateness returns how long after it was due each update arrived; their spread is the
+// update jitter
+func (c *Cadence) Lateness() []time.Duration {
+	lateness := make([]time.Duration, 0, len(c.Updates))
+
+	for _, update := range c.Updates {
+		lateness = append(lateness, update.Lateness)
+	}
+
+	return lateness
+}
+
+// Late counts the updates that arrived late
+func (c *Cadence) Late() int {
+	late := 0
+
+	for _, update := range c.Updates {
+		if update.Late {
+			late++
+		}
+	}
+
+	return late
+}
+
+// segmentNoun returns "segment" or "segments" for a count
+func segmentNoun(count int) string {
+	if count == 1 {
+		return "segment"
+	}
+
+	return "segments"
+}
@@ -0,0 +1,123 @@
+package monitor
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/grafov/m3u8"
+)
+
+// livePlaylist builds a live playlist of one-second segments whose newest segment is last
+func livePlaylist(t *testing.T, last uint64, window int) *m3u8.MediaPlaylist {
+	t.Helper()
+
+	media, err := m3u8.NewMediaPlaylist(uint(window), uint(window))
+	if err != nil {
+		t.Fatalf("failed to create playlist: %v", err)
+	}
+
+	first := last + 1 - uint64(window)
+
+	media.TargetDuration = 1
+	media.SeqNo = first
+
+	for seq := first; seq <= last; seq++ {
+		if err := media.Append(fmt.Sprintf("seg%d.ts", seq), 1, ""); err != nil {
+			t.Fatalf("failed to append segment: %v", err)
+		}
+	}
+
+	return media
+}
+
+func TestCadence(t *testing.T) {
+	start := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name        string
+		lasts       []uint64
+		wantKinds   []AnomalyKind
+		wantStale   int
+		wantUpdates int
+		wantLate    int
+		wantLongest time.Duration
+	}{
+		{
+			name:        "on schedule",
+			lasts:       []uint64{10, 11, 12, 13, 14},
+			wantUpdates: 3,
+			wantLongest: time.Second,
+		},
+		{
+			name:        "frozen live playlist",
+			lasts:       []uint64{10, 10, 10, 10, 10},
+			wantKinds:   []AnomalyKind{AnomalyStalePlaylist},
+			wantStale:   4,
+			wantLongest: 4 * time.Second,
+		},
+		{
+			name:        "stall then catch up",
+			lasts:       []uint64{10, 11, 12, 12, 12, 15, 16},
+			wantKinds:   []AnomalyKind{AnomalyStalePlaylist, AnomalyLateUpdate},
+			wantStale:   2,
+			wantUpdates: 3,
+			wantLate:    1,
+			wantLongest: 3 * time.Second,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cadence := NewCadence()
+
+			var kinds []AnomalyKind
+
+			for i, last := range tt.lasts {
+				at := start.Add(time.Duration(i) * time.Second)
+
+				for _, anomaly := range cadence.Observe(livePlaylist(t, last, 5), at) {
+					kinds = append(kinds, anomaly.Kind)
+				}
+			}
+
+			if fmt.Sprint(kinds) != fmt.Sprint(tt.wantKinds) {
+				t.Errorf("anomalies = %v, want %v", kinds, tt.wantKinds)
+			}
+
+			if cadence.Stale != tt.wantStale {
+				t.Errorf("stale reloads = %d, want %d", cadence.Stale, tt.wantStale)
+			}
+
+			if len(cadence.Updates) != tt.wantUpdates {
+				t.Errorf("timed updates = %d, want %d", len(cadence.Updates), tt.wantUpdates)
+			}
+
+			if cadence.Late() != tt.wantLate {
+				t.Errorf("late updates = %d, want %d", cadence.Late(), tt.wantLate)
+			}
+
+			if cadence.LongestStale != tt.wantLongest {
+				t.Errorf("longest without update = %s, want %s", cadence.LongestStale, tt.wantLongest)
+			}
+		})
+	}
+}
+
+func TestCadenceIgnoresClosedPlaylists(t *testing.T) {
+	cadence := NewCadence()
+	start := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	for i := range 5 {
+		media := livePlaylist(t, 10, 5)
+		media.Close()
+
+		if found := cadence.Observe(media, start.Add(time.Duration(i)*time.Second)); len(found) > 0 {
+			t.Fatalf("closed playlist reported %v", found)
+		}
+	}
+
+	if cadence.Reloads != 0 || cadence.Stale != 0 {
+		t.Errorf("closed playlist counted %d reloads, %d stale", cadence.Reloads, cadence.Stale)
+	}
+}
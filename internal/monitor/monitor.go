@@ -0,0 +1,392 @@
+package monitor
+
+import (
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/grafov/m3u8"
+)
+
+// AnomalyKind identifies the category of a playlist anomaly
+type AnomalyKind string
+
+const (
+	AnomalyDurationJump         AnomalyKind = "segment-duration-jump"
+	AnomalyMissingSequence      AnomalyKind = "missing-sequence"
+	AnomalyTargetDurationChange AnomalyKind = "target-duration-change"
+	AnomalyDiscontinuity        AnomalyKind = "discontinuity"
+	AnomalySequenceRegression   AnomalyKind = "sequence-regression"
+	AnomalySequenceMismatch     AnomalyKind = "sequence-mismatch"
+	AnomalyWindowTooShort       AnomalyKind = "window-too-short"
+	AnomalyPlaylistType         AnomalyKind = "playlist-type"
+	AnomalyLateUpdate           AnomalyKind = "late-update"
+	AnomalyStalePlaylist        AnomalyKind = "stale-playlist"
+)
+
+// minWindowTargets is the minimum live window length in target durations (RFC 8216 6.2.2)
+const minWindowTargets = 3
+
+// durationJumpTolerance is the fraction of the target duration a segment may
+// differ from its predecessor before being reported
+const durationJumpTolerance = 0.5
+
+// Anomaly describes an unexpected change observed between playlist reloads
+type Anomaly struct {
+	Time     time.Time
+	Kind     AnomalyKind
+	Sequence uint64
+	Detail   string
+}
+
+// KeyRotation records an EXT-X-KEY change and the key endpoint latency at that moment
+type KeyRotation struct {
+	Time     time.Time
+	Sequence uint64
+	Method   string
+	URI      string
+	IV       string
+	Initial  bool
+	Latency  time.Duration
+	TTFB     time.Duration
+	Err      error
+	measured bool
+}
+
+// Segment is a media segment paired with its media sequence number
+type Segment struct {
+	Sequence uint64
+	*m3u8.MediaSegment
+}
+
+// Session tracks successive reloads of a live media playlist
+type Session struct {
+	Started   time.Time
+	Reloads   int
+	Anomalies []Anomaly
+	WindowMin float64
+	WindowMax float64
+	Rotations []KeyRotation
+	Cadence   *Cadence
+	prev      *m3u8.MediaPlaylist
+	lastSeq   uint64
+	lastDur   float64
+	lastKey   *m3u8.Key
+}
+
+// NewSession creates an empty monitoring session
+func NewSession() *Session {
+	return &Session{Started: time.Now()}
+}
+
+// Segments returns the non-nil segments of a media playlist with their sequence numbers
+func Segments(media *m3u8.MediaPlaylist) []Segment {
+	var segments []Segment
+
+	if media == nil {
+		return nil
+	}
+
+	for _, seg := range media.Segments {
+		if seg == nil {
+			continue
+		}
+
+		segments = append(segments, Segment{
+			Sequence:     media.SeqNo + uint64(len(segments)),
+			MediaSegment: seg,
+		})
+	}
+
+	return segments
+}
+
+// Observe records a playlist reload and returns anomalies relative to the previous reload
+func (s *Session) Observe(media *m3u8.MediaPlaylist, at time.Time) []Anomaly {
+	segments := Segments(media)
+
+	s.Reloads++
+	s.trackWindow(segments)
+
+	// Refresh cadence is only tracked when the session has a cadence tracker
+	var cadence []Anomaly
+
+	if s.Cadence != nil {
+		cadence = s.Cadence.Observe(media, at)
+	}
+
+	// First reload only establishes the baseline
+	if s.prev == nil {
+		s.prev = media
+
+		if len(segments) > 0 {
+			last := segments[len(segments)-1]
+			s.lastSeq = last.Sequence
+			s.lastDur = last.Duration
+
+			keys := effectiveKeys(segments)
+			s.lastKey = keys[len(keys)-1]
+
+			if isEncrypted(s.lastKey) {
+				s.addRotation(s.lastKey, last.Sequence, at, true)
+			}
+		}
+
+		s.Anomalies = append(s.Anomalies, cadence...)
+
+		return cadence
+	}
+
+	var found []Anomaly
+
+	// Check for target duration changes
+	if media.TargetDuration != s.prev.TargetDuration {
+		found = append(found, Anomaly{
+			Time:   at,
+			Kind:   AnomalyTargetDurationChange,
+			Detail: fmt.Sprintf("target duration changed from %.0fs to %.0fs", s.prev.TargetDuration, media.TargetDuration),
+		})
+	}
+
+	// Check for sequence numbers that slid out of the window unseen
+	if len(segments) > 0 && segments[0].Sequence > s.lastSeq+1 {
+		found = append(found, Anomaly{
+			Time:     at,
+			Kind:     AnomalyMissingSequence,
+			Sequence: s.lastSeq + 1,
+			Detail:   fmt.Sprintf("sequence numbers %d-%d never observed", s.lastSeq+1, segments[0].Sequence-1),
+		})
+	}
+
+	found = append(found, checkSequence(s.prev, media, at)...)
+	found = append(found, checkPlaylistType(s.prev, media, at)...)
+
+	// Live windows must span at least three target durations
+	if window := windowLength(segments); !media.Closed && media.MediaType != m3u8.VOD &&
+		window < media.TargetDuration*minWindowTargets {
+		found = append(found, Anomaly{
+			Time:   at,
+			Kind:   AnomalyWindowTooShort,
+			Detail: fmt.Sprintf("playlist window %.1fs is below %d target durations", window, minWindowTargets),
+		})
+	}
+
+	keys := effectiveKeys(segments)
+
+	// Inspect segments appended since the previous reload
+	for i, seg := range segments {
+		if seg.Sequence <= s.lastSeq {
+			continue
+		}
+
+		if !sameKey(keys[i], s.lastKey) {
+			if isEncrypted(keys[i]) {
+				s.addRotation(keys[i], seg.Sequence, at, false)
+			}
+
+			s.lastKey = keys[i]
+		}
+
+		if seg.Discontinuity {
+			found = append(found, Anomaly{
+				Time:     at,
+				Kind:     AnomalyDiscontinuity,
+				Sequence: seg.Sequence,
+				Detail:   fmt.Sprintf("discontinuity inserted before segment %d", seg.Sequence),
+			})
+		}
+
+		if s.lastDur > 0 && math.Abs(seg.Duration-s.lastDur) > media.TargetDuration*durationJumpTolerance {
+			found = append(found, Anomaly{
+				Time:     at,
+				Kind:     AnomalyDurationJump,
+				Sequence: seg.Sequence,
+				Detail:   fmt.Sprintf("segment %d duration %.3fs after %.3fs", seg.Sequence, seg.Duration, s.lastDur),
+			})
+		}
+
+		s.lastSeq = seg.Sequence
+		s.lastDur = seg.Duration
+	}
+
+	found = append(found, cadence...)
+
+	s.prev = media
+	s.Anomalies = append(s.Anomalies, found...)
+
+	return found
+}
+
+// PendingRotations returns key rotations whose endpoint latency has not been measured yet
+func (s *Session) PendingRotations() []*KeyRotation {
+	var pending []*KeyRotation
+
+	for i := range s.Rotations {
+		if !s.Rotations[i].measured {
+			pending = append(pending, &s.Rotations[i])
+		}
+	}
+
+	return pending
+}
+
+// RecordLatency stores the key endpoint timing for a rotation
+func (r *KeyRotation) RecordLatency(latency, ttfb time.Duration, err error) {
+	r.Latency = latency
+	r.TTFB = ttfb
+	r.Err = err
+	r.measured = true
+}
+
+// addRotation appends a key rotation event
+func (s *Session) addRotation(key *m3u8.Key, seq uint64, at time.Time, initial bool) {
+	s.Rotations = append(s.Rotations, KeyRotation{
+		Time:     at,
+		Sequence: seq,
+		Method:   key.Method,
+		URI:      key.URI,
+		IV:       key.IV,
+		Initial:  initial,
+	})
+}
+
+// effectiveKeys returns the EXT-X-KEY in force for each segment
+func effectiveKeys(segments []Segment) []*m3u8.Key {
+	keys := make([]*m3u8.Key, len(segments))
+
+	var current *m3u8.Key
+
+	for i, seg := range segments {
+		if seg.Key != nil {
+			current = seg.Key
+		}
+
+		keys[i] = current
+	}
+
+	return keys
+}
+
+// isEncrypted reports whether a key describes actual encryption
+func isEncrypted(key *m3u8.Key) bool {
+	return key != nil && key.Method != "" && key.Method != "NONE"
+}
+
+// sameKey compares the identity of two keys
+func sameKey(a, b *m3u8.Key) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+
+	return a.Method == b.Method && a.URI == b.URI && a.IV == b.IV
+}
+
+// trackWindow records the shortest and longest playlist window observed
+func (s *Session) trackWindow(segments []Segment) {
+	window := windowLength(segments)
+
+	if s.Reloads == 1 || window < s.WindowMin {
+		s.WindowMin = window
+	}
+
+	if window > s.WindowMax {
+		s.WindowMax = window
+	}
+}
+
+// windowLength sums segment durations to get the playlist (DVR) window length in seconds
+func windowLength(segments []Segment) float64 {
+	var total float64
+
+	for _, seg := range segments {
+		total += seg.Duration
+	}
+
+	return total
+}
+
+// checkSequence validates EXT-X-MEDIA-SEQUENCE progression between reloads
+func checkSequence(prev, cur *m3u8.MediaPlaylist, at time.Time) []Anomaly {
+	if cur.SeqNo < prev.SeqNo {
+		return []Anomaly{{
+			Time:     at,
+			Kind:     AnomalySequenceRegression,
+			Sequence: cur.SeqNo,
+			Detail:   fmt.Sprintf("media sequence went backwards from %d to %d", prev.SeqNo, cur.SeqNo),
+		}}
+	}
+
+	// The segment carrying the new media sequence must match what the previous reload listed
+	prevSegments := Segments(prev)
+	curSegments := Segments(cur)
+	offset := cur.SeqNo - prev.SeqNo
+
+	if len(curSegments) == 0 || offset >= uint64(len(prevSegments)) {
+		return nil
+	}
+
+	if prevSegments[offset].URI != curSegments[0].URI {
+		return []Anomaly{{
+			Time:     at,
+			Kind:     AnomalySequenceMismatch,
+			Sequence: cur.SeqNo,
+			Detail: fmt.Sprintf("segment %d is %q but was %q in the previous reload",
+				cur.SeqNo, curSegments[0].URI, prevSegments[offset].URI),
+		}}
+	}
+
+	return nil
+}
+
+// checkPlaylistType validates EVENT/VOD/live semantics between reloads
+func checkPlaylistType(prev, cur *m3u8.MediaPlaylist, at time.Time) []Anomaly {
+	var found []Anomaly
+
+	violation := func(detail string) {
+		found = append(found, Anomaly{Time: at, Kind: AnomalyPlaylistType, Detail: detail})
+	}
+
+	if prev.MediaType != cur.MediaType {
+		violation(fmt.Sprintf("playlist type changed from %s to %s", playlistTypeName(prev), playlistTypeName(cur)))
+	}
+
+	if prev.Closed && !cur.Closed {
+		violation("EXT-X-ENDLIST disappeared after being published")
+	}
+
+	switch prev.MediaType {
+	case m3u8.VOD:
+		if cur.SeqNo != prev.SeqNo || len(Segments(cur)) != len(Segments(prev)) {
+			violation("VOD playlist changed between reloads")
+		}
+	case m3u8.EVENT:
+		if cur.SeqNo != prev.SeqNo {
+			violation("EVENT playlist removed segments from its head")
+		}
+	}
+
+	return found
+}
+
+// playlistTypeName returns a readable EXT-X-PLAYLIST-TYPE label
+func playlistTypeName(media *m3u8.MediaPlaylist) string {
+	switch media.MediaType {
+	case m3u8.EVENT:
+		return "EVENT"
+	case m3u8.VOD:
+		return "VOD"
+	}
+
+	return "live"
+}
+
+// CountByKind tallies recorded anomalies per kind
+func (s *Session) CountByKind() map[AnomalyKind]int {
+	counts := make(map[AnomalyKind]int)
+
+	for _, a := range s.Anomalies {
+		counts[a.Kind]++
+	}
+
+	return counts
+}
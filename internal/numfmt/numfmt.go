@@ -0,0 +1,136 @@
+package numfmt
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// Format controls how numbers are rendered in table output
+type Format struct {
+	Decimal   string
+	Thousands string
+	Width     int
+	Precision int
+}
+
+// localeSeparators maps language (or language-region) tags to decimal and grouping separators
+var localeSeparators = map[string][2]string{
+	"en":    {".", ","},
+	"ja":    {".", ","},
+	"zh":    {".", ","},
+	"de":    {",", "."},
+	"es":    {",", "."},
+	"it":    {",", "."},
+	"nl":    {",", "."},
+	"pt":    {",", "."},
+	"tr":    {",", "."},
+	"fr":    {",", " "},
+	"ru":    {",", " "},
+	"pl":    {",", " "},
+	"cs":    {",", " "},
+	"sv":    {",", " "},
+	"fi":    {",", " "},
+	"nb":    {",", " "},
+	"de-ch": {".", "'"},
+	"fr-ch": {".", "'"},
+	"it-ch": {".", "'"},
+}
+
+// Default returns the plain format used when no options are given
+func Default() Format {
+	return Format{Decimal: ".", Precision: 2}
+}
+
+// Locale returns the separators conventional for a locale tag such as de-DE or fr_FR
+func Locale(tag string) (Format, error) {
+	f := Default()
+
+	normalized := strings.ToLower(strings.ReplaceAll(tag, "_", "-"))
+
+	// Drop any encoding suffix, as in de_DE.UTF-8
+	normalized, _, _ = strings.Cut(normalized, ".")
+
+	separators, ok := localeSeparators[normalized]
+	if !ok {
+		language, _, _ := strings.Cut(normalized, "-")
+
+		separators, ok = localeSeparators[language]
+	}
+
+	if !ok {
+		return f, fmt.Errorf("unknown locale %q", tag)
+	}
+
+	f.Decimal = separators[0]
+	f.Thousands = separators[1]
+
+	return f, nil
+}
+
+// Number renders a value with the configured precision and separators
+func (f Format) Number(v float64) string {
+	s := strconv.FormatFloat(math.Abs(v), 'f', f.Precision, 64)
+
+	integer, fraction, _ := strings.Cut(s, ".")
+
+	if f.Thousands != "" && len(integer) > 3 {
+		var b strings.Builder
+
+		lead := len(integer) % 3
+
+		if lead > 0 {
+			b.WriteString(integer[:lead])
+		}
+
+		for i := lead; i < len(integer); i += 3 {
+			if b.Len() > 0 {
+				b.WriteString(f.Thousands)
+			}
+
+			b.WriteString(integer[i : i+3])
+		}
+
+		integer = b.String()
+	}
+
+	if fraction != "" {
+		integer += f.Decimal + fraction
+	}
+
+	if v < 0 && s != strconv.FormatFloat(0, 'f', f.Precision, 64) {
+		integer = "-" + integer
+	}
+
+	return integer
+}
+
+// Millis renders a duration in milliseconds with an "ms" suffix
+func (f Format) Millis(d time.Duration) string {
+	return f.Pad(f.Number(float64(d)/float64(time.Millisecond)) + "ms")
+}
+
+// SignedMillis renders a duration in milliseconds with an explicit sign
+func (f Format) SignedMillis(d time.Duration) string {
+	s := f.Number(float64(d)/float64(time.Millisecond)) + "ms"
+
+	if !strings.HasPrefix(s, "-") {
+		s = "+" + s
+	}
+
+	return f.Pad(s)
+}
+
+// Pad right-aligns s to the fixed width, if one is set
+func (f Format) Pad(s string) string {
+	padding := f.Width - utf8.RuneCountInString(s)
+
+	if padding <= 0 {
+		return s
+	}
+
+	return strings.Repeat(" ", padding) + s
+}
@@ -0,0 +1,287 @@
+package origin
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math/big"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"codeberg.org/pwnderpants/vtrace/internal/decoder"
+)
+
+// Segments is the number of media segments in the synthetic VOD playlist
+const Segments = 3
+
+// masterPlaylist announces the single synthetic rendition
+const masterPlaylist = `#EXTM3U
+#EXT-X-VERSION:3
+#EXT-X-STREAM-INF:BANDWIDTH=800000,RESOLUTION=640x360,CODECS="avc1.64001e"
+media.m3u8
+`
+
+// Faults are failures the origin injects so alerting and retry settings can be exercised
+// end to end; the zero value serves the stream normally
+type Faults struct {
+	// DropAfter aborts each segment response after this many body bytes; zero serves whole segments
+	DropAfter int64
+
+	// CorruptPlaylist serves a truncated media playlist without its #EXTM3U header
+	CorruptPlaylist bool
+
+	// KeyDelay encrypts the segments with AES-128 and holds each key response this long
+	KeyDelay time.Duration
+}
+
+// Origin is a synthetic HLS origin on the loopback interface: a master playlist, a VOD
+// media playlist, and the built-in MPEG-TS segment, served over HTTPS (HTTP/2) with an
+// ephemeral self-signed certificate
+type Origin struct {
+	// URL is the master playlist, addressed by the name localhost so a lookup is measured
+	URL string
+
+	// RootCAs trusts the origin's certificate
+	RootCAs *x509.CertPool
+
+	// IPv6 reports whether the origin also listens on the IPv6 loopback address
+	IPv6 bool
+
+	server *http.Server
+}
+
+// Start listens on an ephemeral port of 127.0.0.1 (and ::1 when available) and serves
+// the synthetic stream until Close
+func Start() (*Origin, error) {
+	return StartWithFaults(Faults{})
+}
+
+// StartWithFaults starts the origin like Start, injecting the given faults
+func StartWithFaults(faults Faults) (*Origin, error) {
+	handler, err := newHandler(faults)
+	if err != nil {
+		return nil, err
+	}
+
+	cert, pool, err := selfSignedCertificate()
+	if err != nil {
+		return nil, err
+	}
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen on loopback: %w", err)
+	}
+
+	port := listener.Addr().(*net.TCPAddr).Port
+
+	o := &Origin{
+		URL:     "https://localhost:" + strconv.Itoa(port) + "/master.m3u8",
+		RootCAs: pool,
+		server: &http.Server{
+			Handler:           handler,
+			TLSConfig:         &tls.Config{Certificates: []tls.Certificate{cert}},
+			ReadHeaderTimeout: 10 * time.Second,
+		},
+	}
+
+	listeners := []net.Listener{listener}
+
+	// localhost may resolve to ::1 first, so the same port is served there too
+	if listener6, err := net.Listen("tcp", net.JoinHostPort("::1", strconv.Itoa(port))); err == nil {
+		listeners = append(listeners, listener6)
+		o.IPv6 = true
+	}
+
+	for _, l := range listeners {
+		go o.server.ServeTLS(l, "", "")
+	}
+
+	return o, nil
+}
+
+// Close stops the origin and its listeners
+func (o *Origin) Close() error {
+	if err := o.server.Close(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return fmt.Errorf("failed to stop synthetic origin: %w", err)
+	}
+
+	return nil
+}
+
+// newHandler serves the playlists, segments, and (when encrypted) key of the synthetic stream
+func newHandler(faults Faults) (http.Handler, error) {
+	segments := make([][]byte, Segments)
+
+	for i := range segments {
+		segments[i] = decoder.SyntheticSegment()
+	}
+
+	media := "#EXTM3U\n#EXT-X-VERSION:3\n#EXT-X-TARGETDURATION:2\n#EXT-X-MEDIA-SEQUENCE:0\n#EXT-X-PLAYLIST-TYPE:VOD\n"
+
+	mux := http.NewServeMux()
+
+	// A key delay needs a key request, so the segments are encrypted with a random key
+	if faults.KeyDelay > 0 {
+		key := make([]byte, aes.BlockSize)
+
+		if _, err := rand.Read(key); err != nil {
+			return nil, fmt.Errorf("failed to generate segment key: %w", err)
+		}
+
+		for i := range segments {
+			encrypted, err := encryptSegment(segments[i], key, uint64(i))
+			if err != nil {
+				return nil, err
+			}
+
+			segments[i] = encrypted
+		}
+
+		media += "#EXT-X-KEY:METHOD=AES-128,URI=\"key.bin\"\n"
+
+		mux.Handle("GET /key.bin", delayed(serve("application/octet-stream", key), faults.KeyDelay))
+	}
+
+	for i := 0; i < Segments; i++ {
+		media += fmt.Sprintf("#EXTINF:2.000,\nsegment%d.ts\n", i)
+	}
+
+	media += "#EXT-X-ENDLIST\n"
+
+	// A playlist cut off mid-transfer by a broken cache: no header and half the body
+	if faults.CorruptPlaylist {
+		media = strings.TrimPrefix(media, "#EXTM3U\n")
+		media = media[:len(media)/2]
+	}
+
+	mux.Handle("GET /master.m3u8", serve("application/vnd.apple.mpegurl", []byte(masterPlaylist)))
+	mux.Handle("GET /media.m3u8", serve("application/vnd.apple.mpegurl", []byte(media)))
+
+	for i, segment := range segments {
+		handler := serve("video/mp2t", segment)
+
+		if faults.DropAfter > 0 {
+			handler = dropAfter(segment, faults.DropAfter)
+		}
+
+		mux.Handle(fmt.Sprintf("GET /segment%d.ts", i), handler)
+	}
+
+	return mux, nil
+}
+
+// serve answers with a fixed body
+func serve(contentType string, body []byte) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", contentType)
+		w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+		w.Header().Set("Cache-Control", "no-store")
+
+		if r.Method != http.MethodHead {
+			w.Write(body)
+		}
+	}
+}
+
+// delayed holds each request for delay before handing it to next
+func delayed(next http.HandlerFunc, delay time.Duration) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		timer := time.NewTimer(delay)
+		defer timer.Stop()
+
+		select {
+		case <-timer.C:
+			next(w, r)
+		case <-r.Context().Done():
+		}
+	}
+}
+
+// dropAfter announces the whole segment but aborts the response after n body bytes, which
+// closes the connection (HTTP/1.1) or resets the stream (HTTP/2)
+func dropAfter(segment []byte, n int64) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "video/mp2t")
+		w.Header().Set("Content-Length", strconv.Itoa(len(segment)))
+		w.Header().Set("Cache-Control", "no-store")
+
+		w.Write(segment[:min(n, int64(len(segment)))])
+
+		if flusher, ok := w.(http.Flusher); ok {
+			flusher.Flush()
+		}
+
+		panic(http.ErrAbortHandler)
+	}
+}
+
+// encryptSegment encrypts a segment with AES-128-CBC and PKCS#7 padding, using the media
+// sequence number as the IV as HLS does when EXT-X-KEY has none
+func encryptSegment(segment, key []byte, sequence uint64) ([]byte, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create segment cipher: %w", err)
+	}
+
+	iv := make([]byte, aes.BlockSize)
+	binary.BigEndian.PutUint64(iv[8:], sequence)
+
+	padding := aes.BlockSize - len(segment)%aes.BlockSize
+	data := append(append([]byte(nil), segment...), bytes.Repeat([]byte{byte(padding)}, padding)...)
+
+	cipher.NewCBCEncrypter(block, iv).CryptBlocks(data, data)
+
+	return data, nil
+}
+
+// selfSignedCertificate creates a short-lived certificate for localhost and the loopback
+// addresses, and a pool that trusts it
+func selfSignedCertificate() (tls.Certificate, *x509.CertPool, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return tls.Certificate{}, nil, fmt.Errorf("failed to generate origin key: %w", err)
+	}
+
+	now := time.Now()
+
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(now.UnixNano()),
+		Subject:               pkix.Name{CommonName: "vtrace synthetic origin"},
+		DNSNames:              []string{"localhost"},
+		IPAddresses:           []net.IP{net.IPv4(127, 0, 0, 1), net.IPv6loopback},
+		NotBefore:             now.Add(-time.Minute),
+		NotAfter:              now.Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return tls.Certificate{}, nil, fmt.Errorf("failed to create origin certificate: %w", err)
+	}
+
+	leaf, err := x509.ParseCertificate(der)
+	if err != nil {
+		return tls.Certificate{}, nil, fmt.Errorf("failed to parse origin certificate: %w", err)
+	}
+
+	pool := x509.NewCertPool()
+	pool.AddCert(leaf)
+
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key, Leaf: leaf}, pool, nil
+}
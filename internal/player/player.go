@@ -0,0 +1,135 @@
+package player
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// URLPlaceholder is replaced by the stream URL in player command arguments
+const URLPlaceholder = "{url}"
+
+var (
+	ErrPlayerNotFound = errors.New("player command not found in PATH")
+	ErrNotReady       = errors.New("player exited before signalling readiness")
+)
+
+// Command builds the argument list for one join: the command line is split on whitespace
+// and every {url} is replaced by the stream URL, which is appended when no argument has it
+func Command(commandLine, url string) []string {
+	args := strings.Fields(commandLine)
+	found := false
+
+	for i, arg := range args {
+		if strings.Contains(arg, URLPlaceholder) {
+			args[i] = strings.ReplaceAll(arg, URLPlaceholder, url)
+			found = true
+		}
+	}
+
+	if !found {
+		args = append(args, url)
+	}
+
+	return args
+}
+
+// Join launches a player and measures its join time: the time until a line of its
+// stdout or stderr matches ready, or until it exits successfully when ready is nil.
+// A player that is still running once ready is stopped.
+func Join(ctx context.Context, args []string, ready *regexp.Regexp) (time.Duration, error) {
+	if len(args) == 0 {
+		return 0, errors.New("empty player command")
+	}
+
+	if _, err := exec.LookPath(args[0]); err != nil {
+		return 0, fmt.Errorf("%w: %s", ErrPlayerNotFound, args[0])
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	// Both streams share one pipe so readiness lines are seen in the order they are written
+	r, w, err := os.Pipe()
+	if err != nil {
+		return 0, fmt.Errorf("failed to create player pipe: %w", err)
+	}
+	defer r.Close()
+
+	cmd := exec.CommandContext(ctx, args[0], args[1:]...)
+	cmd.Stdout = w
+	cmd.Stderr = w
+
+	start := time.Now()
+
+	if err := cmd.Start(); err != nil {
+		w.Close()
+
+		return 0, fmt.Errorf("failed to start player: %w", err)
+	}
+
+	w.Close()
+
+	// Children of the player may hold the pipe open after it is killed
+	go func() {
+		<-ctx.Done()
+		r.Close()
+	}()
+
+	var (
+		joined  time.Duration
+		matched bool
+		tail    string
+	)
+
+	scanner := bufio.NewScanner(r)
+
+	for scanner.Scan() {
+		line := scanner.Text()
+
+		if strings.TrimSpace(line) != "" {
+			tail = line
+		}
+
+		if ready != nil && ready.MatchString(line) {
+			joined = time.Since(start)
+			matched = true
+
+			break
+		}
+	}
+
+	if matched {
+		cmd.Process.Kill()
+		cmd.Wait()
+
+		return joined, nil
+	}
+
+	waitErr := cmd.Wait()
+	elapsed := time.Since(start)
+
+	if ctxErr := ctx.Err(); ctxErr != nil {
+		return 0, fmt.Errorf("player did not join: %w", ctxErr)
+	}
+
+	if waitErr != nil {
+		if tail != "" {
+			return 0, fmt.Errorf("player failed: %w: %s", waitErr, tail)
+		}
+
+		return 0, fmt.Errorf("player failed: %w", waitErr)
+	}
+
+	if ready != nil {
+		return 0, ErrNotReady
+	}
+
+	return elapsed, nil
+}
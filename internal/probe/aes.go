@@ -0,0 +1,115 @@
+package probe
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/grafov/m3u8"
+)
+
+var (
+	ErrUnsupportedKeyMethod = errors.New("unsupported EXT-X-KEY method")
+	ErrInvalidKey           = errors.New("AES-128 key must be 16 bytes")
+	ErrInvalidPadding       = errors.New("invalid PKCS#7 padding in decrypted segment")
+)
+
+// SegmentKey describes the encryption in force for a segment
+type SegmentKey struct {
+	Method string
+	URI    string
+	IV     []byte
+}
+
+// FirstSegmentKey returns the EXT-X-KEY in force for the first segment, or nil when it is unencrypted
+func FirstSegmentKey(media *m3u8.MediaPlaylist, baseURL string) (*SegmentKey, error) {
+	if media == nil {
+		return nil, ErrNoSegments
+	}
+
+	key := media.Key
+
+	for i, seg := range media.Segments {
+		if seg == nil || seg.URI == "" {
+			continue
+		}
+
+		if seg.Key != nil {
+			key = seg.Key
+		}
+
+		if key == nil || key.Method == "" || key.Method == "NONE" {
+			return nil, nil
+		}
+
+		if key.Method != "AES-128" {
+			return nil, fmt.Errorf("%w: %s", ErrUnsupportedKeyMethod, key.Method)
+		}
+
+		keyURL, err := ResolveURL(baseURL, key.URI)
+		if err != nil {
+			return nil, fmt.Errorf("failed to resolve key URL: %w", err)
+		}
+
+		iv, err := segmentIV(key.IV, media.SeqNo+uint64(i))
+		if err != nil {
+			return nil, err
+		}
+
+		return &SegmentKey{Method: key.Method, URI: keyURL, IV: iv}, nil
+	}
+
+	return nil, ErrNoSegments
+}
+
+// DecryptAES128 decrypts an AES-128-CBC segment and strips its PKCS#7 padding
+func DecryptAES128(data, key, iv []byte) ([]byte, error) {
+	if len(key) != aes.BlockSize {
+		return nil, ErrInvalidKey
+	}
+
+	if len(data) == 0 || len(data)%aes.BlockSize != 0 {
+		return nil, fmt.Errorf("encrypted segment length %d is not a multiple of %d", len(data), aes.BlockSize)
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create cipher: %w", err)
+	}
+
+	plain := make([]byte, len(data))
+	cipher.NewCBCDecrypter(block, iv).CryptBlocks(plain, data)
+
+	// Strip PKCS#7 padding
+	pad := int(plain[len(plain)-1])
+
+	if pad == 0 || pad > aes.BlockSize || !bytes.Equal(plain[len(plain)-pad:], bytes.Repeat([]byte{byte(pad)}, pad)) {
+		return nil, ErrInvalidPadding
+	}
+
+	return plain[:len(plain)-pad], nil
+}
+
+// segmentIV parses an explicit IV attribute or derives it from the media sequence number
+func segmentIV(attr string, seq uint64) ([]byte, error) {
+	if attr == "" {
+		iv := make([]byte, aes.BlockSize)
+		binary.BigEndian.PutUint64(iv[8:], seq)
+
+		return iv, nil
+	}
+
+	digits := strings.TrimPrefix(strings.TrimPrefix(attr, "0x"), "0X")
+
+	iv, err := hex.DecodeString(digits)
+	if err != nil || len(iv) != aes.BlockSize {
+		return nil, fmt.Errorf("invalid EXT-X-KEY IV %q", attr)
+	}
+
+	return iv, nil
+}
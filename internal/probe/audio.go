@@ -0,0 +1,70 @@
+package probe
+
+import (
+	"github.com/grafov/m3u8"
+)
+
+// SelectAudioRendition returns the URL of the audio rendition a variant plays with:
+// the DEFAULT=YES member of its EXT-X-MEDIA TYPE=AUDIO group, else the first listed.
+// It returns an empty URL when the variant has no separate audio (muxed audio).
+func SelectAudioRendition(variant *m3u8.Variant, baseURL string) (string, *m3u8.Alternative, error) {
+	if variant == nil || variant.Audio == "" {
+		return "", nil, nil
+	}
+
+	var chosen *m3u8.Alternative
+
+	for _, alt := range variant.Alternatives {
+		// Renditions without a URI are carried in the variant's own segments
+		if alt == nil || alt.Type != "AUDIO" || alt.GroupId != variant.Audio || alt.URI == "" {
+			continue
+		}
+
+		if chosen == nil || (alt.Default && !chosen.Default) {
+			chosen = alt
+		}
+	}
+
+	if chosen == nil {
+		return "", nil, nil
+	}
+
+	renditionURL, err := ResolveURL(baseURL, chosen.URI)
+	if err != nil {
+		return "", nil, err
+	}
+
+	return renditionURL, chosen, nil
+}
+
+// SelectSubtitleRendition returns the URL of the subtitle rendition a variant offers: the
+// DEFAULT=YES member of its EXT-X-MEDIA TYPE=SUBTITLES group, else the first listed. It
+// returns an empty URL when the variant has no subtitle group.
+func SelectSubtitleRendition(variant *m3u8.Variant, baseURL string) (string, *m3u8.Alternative, error) {
+	if variant == nil || variant.Subtitles == "" {
+		return "", nil, nil
+	}
+
+	var chosen *m3u8.Alternative
+
+	for _, alt := range variant.Alternatives {
+		if alt == nil || alt.Type != "SUBTITLES" || alt.GroupId != variant.Subtitles || alt.URI == "" {
+			continue
+		}
+
+		if chosen == nil || (alt.Default && !chosen.Default) {
+			chosen = alt
+		}
+	}
+
+	if chosen == nil {
+		return "", nil, nil
+	}
+
+	renditionURL, err := ResolveURL(baseURL, chosen.URI)
+	if err != nil {
+		return "", nil, err
+	}
+
+	return renditionURL, chosen, nil
+}
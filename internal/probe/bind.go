@@ -0,0 +1,84 @@
+package probe
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"syscall"
+)
+
+var (
+	ErrInterfaceDown      = errors.New("network interface is down")
+	ErrInterfaceNoAddress = errors.New("network interface has no usable address")
+)
+
+// InterfaceAddr returns the address connections bound to the named interface dial from,
+// preferring IPv4 as quic-go does
+func InterfaceAddr(name string) (net.IP, error) {
+	iface, err := net.InterfaceByName(name)
+	if err != nil {
+		return nil, err
+	}
+
+	if iface.Flags&net.FlagUp == 0 {
+		return nil, ErrInterfaceDown
+	}
+
+	addrs, err := iface.Addrs()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list interface addresses: %w", err)
+	}
+
+	var fallback net.IP
+
+	for _, addr := range addrs {
+		ipNet, ok := addr.(*net.IPNet)
+		if !ok || ipNet.IP.IsLinkLocalUnicast() {
+			continue
+		}
+
+		if ipNet.IP.To4() != nil {
+			return ipNet.IP, nil
+		}
+
+		if fallback == nil {
+			fallback = ipNet.IP
+		}
+	}
+
+	if fallback == nil {
+		return nil, ErrInterfaceNoAddress
+	}
+
+	return fallback, nil
+}
+
+// bindInterface pins a socket of the given network (tcp4, udp6, ...) to the named interface
+// where the platform supports it; elsewhere the interface's source address alone selects the uplink
+func bindInterface(c syscall.RawConn, network, name string) error {
+	if name == "" {
+		return nil
+	}
+
+	iface, err := net.InterfaceByName(name)
+	if err != nil {
+		return err
+	}
+
+	ipv6 := strings.HasSuffix(network, "6")
+
+	var sockErr error
+
+	if err := c.Control(func(fd uintptr) {
+		sockErr = bindToDevice(fd, iface, ipv6)
+	}); err != nil {
+		return err
+	}
+
+	if sockErr != nil {
+		return fmt.Errorf("failed to bind socket to %s: %w", name, sockErr)
+	}
+
+	return nil
+}
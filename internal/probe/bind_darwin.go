@@ -0,0 +1,18 @@
+//go:build darwin
+
+package probe
+
+import (
+	"net"
+	"syscall"
+)
+
+// bindToDevice sets IP_BOUND_IF (IPV6_BOUND_IF for IPv6 sockets) so traffic leaves through
+// the interface even when the routing table prefers another uplink
+func bindToDevice(fd uintptr, iface *net.Interface, ipv6 bool) error {
+	if ipv6 {
+		return syscall.SetsockoptInt(int(fd), syscall.IPPROTO_IPV6, syscall.IPV6_BOUND_IF, iface.Index)
+	}
+
+	return syscall.SetsockoptInt(int(fd), syscall.IPPROTO_IP, syscall.IP_BOUND_IF, iface.Index)
+}
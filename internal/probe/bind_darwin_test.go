@@ -0,0 +1,58 @@
+//go:build darwin
+
+package probe
+
+import (
+	"net"
+	"syscall"
+	"testing"
+)
+
+func TestBindToDevice(t *testing.T) {
+	iface := loopbackInterface(t)
+
+	tests := []struct {
+		name    string
+		network string
+		addr    string
+		level   int
+		opt     int
+	}{
+		{name: "IPv4", network: "udp4", addr: "127.0.0.1:0", level: syscall.IPPROTO_IP, opt: syscall.IP_BOUND_IF},
+		{name: "IPv6", network: "udp6", addr: "[::1]:0", level: syscall.IPPROTO_IPV6, opt: syscall.IPV6_BOUND_IF},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conn, err := net.ListenPacket(tt.network, tt.addr)
+			if err != nil {
+				t.Skipf("no %s loopback: %v", tt.name, err)
+			}
+			defer conn.Close()
+
+			raw, err := conn.(*net.UDPConn).SyscallConn()
+			if err != nil {
+				t.Fatalf("failed to get raw connection: %v", err)
+			}
+
+			var got int
+
+			if err := raw.Control(func(fd uintptr) {
+				if err := bindToDevice(fd, iface, tt.network == "udp6"); err != nil {
+					t.Fatalf("bindToDevice() error = %v", err)
+				}
+
+				got, err = syscall.GetsockoptInt(int(fd), tt.level, tt.opt)
+				if err != nil {
+					t.Fatalf("failed to read the bound interface: %v", err)
+				}
+			}); err != nil {
+				t.Fatalf("failed to control socket: %v", err)
+			}
+
+			if got != iface.Index {
+				t.Errorf("bound interface = %d, want %d", got, iface.Index)
+			}
+		})
+	}
+}
@@ -0,0 +1,13 @@
+//go:build linux
+
+package probe
+
+import (
+	"net"
+	"syscall"
+)
+
+// bindToDevice sets SO_BINDTODEVICE so traffic leaves through the interface
+func bindToDevice(fd uintptr, iface *net.Interface, _ bool) error {
+	return syscall.BindToDevice(int(fd), iface.Name)
+}
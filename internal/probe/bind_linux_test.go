@@ -0,0 +1,50 @@
+//go:build linux
+
+package probe
+
+import (
+	"errors"
+	"net"
+	"syscall"
+	"testing"
+
+	"golang.org/x/sys/unix"
+)
+
+func TestBindToDevice(t *testing.T) {
+	iface := loopbackInterface(t)
+
+	conn, err := net.ListenPacket("udp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to open UDP socket: %v", err)
+	}
+	defer conn.Close()
+
+	raw, err := conn.(*net.UDPConn).SyscallConn()
+	if err != nil {
+		t.Fatalf("failed to get raw connection: %v", err)
+	}
+
+	var got string
+
+	if err := raw.Control(func(fd uintptr) {
+		if err := bindToDevice(fd, iface, false); err != nil {
+			if errors.Is(err, syscall.EPERM) {
+				t.Skip("SO_BINDTODEVICE needs CAP_NET_RAW")
+			}
+
+			t.Fatalf("bindToDevice() error = %v", err)
+		}
+
+		got, err = unix.GetsockoptString(int(fd), unix.SOL_SOCKET, unix.SO_BINDTODEVICE)
+		if err != nil {
+			t.Fatalf("failed to read the bound interface: %v", err)
+		}
+	}); err != nil {
+		t.Fatalf("failed to control socket: %v", err)
+	}
+
+	if got != iface.Name {
+		t.Errorf("bound interface = %q, want %q", got, iface.Name)
+	}
+}
@@ -0,0 +1,10 @@
+//go:build !linux && !darwin && !windows
+
+package probe
+
+import "net"
+
+// bindToDevice is a no-op; binding to the interface's source address selects the uplink
+func bindToDevice(_ uintptr, _ *net.Interface, _ bool) error {
+	return nil
+}
@@ -0,0 +1,26 @@
+package probe
+
+import (
+	"net"
+	"testing"
+)
+
+// loopbackInterface returns the loopback interface, skipping the test without one
+func loopbackInterface(t *testing.T) *net.Interface {
+	t.Helper()
+
+	ifaces, err := net.Interfaces()
+	if err != nil {
+		t.Fatalf("failed to list interfaces: %v", err)
+	}
+
+	for _, iface := range ifaces {
+		if iface.Flags&net.FlagLoopback != 0 && iface.Flags&net.FlagUp != 0 {
+			return &iface
+		}
+	}
+
+	t.Skip("no loopback interface is up")
+
+	return nil
+}
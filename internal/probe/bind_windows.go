@@ -0,0 +1,31 @@
+//go:build windows
+
+package probe
+
+import (
+	"net"
+	"syscall"
+)
+
+// IP_UNICAST_IF and IPV6_UNICAST_IF from ws2ipdef.h, which the syscall package does not define
+const (
+	ipUnicastIF   = 31
+	ipv6UnicastIF = 31
+)
+
+// bindToDevice sets IP_UNICAST_IF (IPV6_UNICAST_IF for IPv6 sockets) so traffic leaves
+// through the interface even when the routing table prefers another uplink
+func bindToDevice(fd uintptr, iface *net.Interface, ipv6 bool) error {
+	if ipv6 {
+		return syscall.SetsockoptInt(syscall.Handle(fd), syscall.IPPROTO_IPV6, ipv6UnicastIF, iface.Index)
+	}
+
+	return syscall.SetsockoptInt(syscall.Handle(fd), syscall.IPPROTO_IP, ipUnicastIF, unicastIFIndex(iface.Index))
+}
+
+// unicastIFIndex converts an interface index to the network byte order IP_UNICAST_IF takes
+func unicastIFIndex(index int) int {
+	n := uint32(index)
+
+	return int(int32(n>>24 | n>>8&0xff00 | n<<8&0xff0000 | n<<24))
+}
@@ -0,0 +1,80 @@
+//go:build windows
+
+package probe
+
+import (
+	"net"
+	"syscall"
+	"testing"
+)
+
+func TestUnicastIFIndex(t *testing.T) {
+	tests := []struct {
+		index int
+		want  int
+	}{
+		{index: 0, want: 0},
+		{index: 1, want: 0x01000000},
+		{index: 0x12, want: 0x12000000},
+		{index: 0x0102, want: 0x02010000},
+		{index: 0x010203, want: 0x03020100},
+		{index: 0x7f, want: 0x7f000000},
+		{index: 0x80, want: -0x80000000},
+	}
+
+	for _, tt := range tests {
+		if got := unicastIFIndex(tt.index); got != tt.want {
+			t.Errorf("unicastIFIndex(%#x) = %#x, want %#x", tt.index, got, tt.want)
+		}
+	}
+}
+
+func TestBindToDevice(t *testing.T) {
+	iface := loopbackInterface(t)
+
+	tests := []struct {
+		name    string
+		network string
+		addr    string
+		level   int
+		opt     int
+		want    int
+	}{
+		{name: "IPv4", network: "udp4", addr: "127.0.0.1:0", level: syscall.IPPROTO_IP, opt: ipUnicastIF, want: unicastIFIndex(iface.Index)},
+		{name: "IPv6", network: "udp6", addr: "[::1]:0", level: syscall.IPPROTO_IPV6, opt: ipv6UnicastIF, want: iface.Index},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conn, err := net.ListenPacket(tt.network, tt.addr)
+			if err != nil {
+				t.Skipf("no %s loopback: %v", tt.name, err)
+			}
+			defer conn.Close()
+
+			raw, err := conn.(*net.UDPConn).SyscallConn()
+			if err != nil {
+				t.Fatalf("failed to get raw connection: %v", err)
+			}
+
+			var got int
+
+			if err := raw.Control(func(fd uintptr) {
+				if err := bindToDevice(fd, iface, tt.network == "udp6"); err != nil {
+					t.Fatalf("bindToDevice() error = %v", err)
+				}
+
+				got, err = syscall.GetsockoptInt(syscall.Handle(fd), tt.level, tt.opt)
+				if err != nil {
+					t.Fatalf("failed to read the bound interface: %v", err)
+				}
+			}); err != nil {
+				t.Fatalf("failed to control socket: %v", err)
+			}
+
+			if got != tt.want {
+				t.Errorf("bound interface = %#x, want %#x", got, tt.want)
+			}
+		})
+	}
+}
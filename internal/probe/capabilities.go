@@ -0,0 +1,238 @@
+package probe
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// compressionEncodings are the content codings offered during capability discovery
+var compressionEncodings = []string{"gzip", "br", "zstd"}
+
+// tlsVersions are the protocol versions probed during capability discovery
+var tlsVersions = []struct {
+	Name    string
+	Version uint16
+}{
+	{"TLS 1.0", tls.VersionTLS10},
+	{"TLS 1.1", tls.VersionTLS11},
+	{"TLS 1.2", tls.VersionTLS12},
+	{"TLS 1.3", tls.VersionTLS13},
+}
+
+// Capabilities describes the protocol features an endpoint supports
+type Capabilities struct {
+	URL           string
+	StatusCode    int
+	HTTP11        bool
+	HTTP2         bool
+	HTTP3         bool
+	HTTP3Err      error
+	ALPN          string
+	TLSVersions   []string
+	Compression   []string
+	RangeRequests bool
+	AcceptRanges  string
+	AltSvc        string
+	IPv6Addrs     []string
+	IPv6Reachable bool
+}
+
+// DiscoverCapabilities probes an endpoint for supported HTTP versions, TLS
+// versions, ALPN, compression, range requests, Alt-Svc, and IPv6 reachability
+func DiscoverCapabilities(ctx context.Context, targetURL string, timeout time.Duration) (*Capabilities, error) {
+	parsed, err := url.Parse(targetURL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse URL: %w", err)
+	}
+
+	caps := &Capabilities{URL: targetURL}
+	secure := parsed.Scheme == "https"
+
+	host := parsed.Hostname()
+	port := parsed.Port()
+
+	if port == "" {
+		port = "80"
+
+		if secure {
+			port = "443"
+		}
+	}
+
+	// A plain HTTP/1.1 request establishes reachability and collects headers
+	resp, err := probeRequest(ctx, targetURL, newHTTP11Client(timeout), nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to reach endpoint: %w", err)
+	}
+
+	caps.HTTP11 = true
+	caps.StatusCode = resp.StatusCode
+	caps.AltSvc = resp.Header.Get("Alt-Svc")
+	caps.AcceptRanges = resp.Header.Get("Accept-Ranges")
+
+	// Check range support with a single-byte request
+	rangeResp, err := probeRequest(ctx, targetURL, newHTTP11Client(timeout), http.Header{"Range": {"bytes=0-0"}})
+	if err == nil && rangeResp.StatusCode == http.StatusPartialContent {
+		caps.RangeRequests = true
+	}
+
+	// Offer each content coding on its own to see which the server applies
+	for _, encoding := range compressionEncodings {
+		encResp, err := probeRequest(ctx, targetURL, newHTTP11Client(timeout), http.Header{"Accept-Encoding": {encoding}})
+		if err == nil && encResp.Header.Get("Content-Encoding") == encoding {
+			caps.Compression = append(caps.Compression, encoding)
+		}
+	}
+
+	if secure {
+		address := net.JoinHostPort(host, port)
+
+		caps.ALPN = negotiateALPN(ctx, address, host, timeout)
+		caps.HTTP2 = caps.ALPN == "h2"
+		caps.TLSVersions = supportedTLSVersions(ctx, address, host, timeout)
+
+		h3Client := NewHTTP3Client(timeout)
+
+		if _, err := probeRequest(ctx, targetURL, h3Client, nil); err != nil {
+			caps.HTTP3Err = err
+		} else {
+			caps.HTTP3 = true
+		}
+	}
+
+	caps.IPv6Addrs, caps.IPv6Reachable = probeIPv6(ctx, host, port, timeout)
+
+	return caps, nil
+}
+
+// probeRequest performs a GET with extra headers and discards the body
+func probeRequest(ctx context.Context, targetURL string, client *http.Client, header http.Header) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, targetURL, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	for k, v := range header {
+		req.Header[k] = v
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	io.Copy(io.Discard, resp.Body)
+
+	return resp, nil
+}
+
+// newHTTP11Client creates a client restricted to HTTP/1.1 that leaves content codings intact
+func newHTTP11Client(timeout time.Duration) *http.Client {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.ForceAttemptHTTP2 = false
+	transport.DisableCompression = true
+	transport.DisableKeepAlives = true
+	transport.TLSNextProto = map[string]func(string, *tls.Conn) http.RoundTripper{}
+
+	return &http.Client{
+		Timeout:   timeout,
+		Transport: transport,
+	}
+}
+
+// negotiateALPN returns the protocol the server selects when offered h2 and http/1.1
+func negotiateALPN(ctx context.Context, address, serverName string, timeout time.Duration) string {
+	state, err := tlsHandshake(ctx, address, &tls.Config{
+		ServerName: serverName,
+		NextProtos: []string{"h2", "http/1.1"},
+	}, timeout)
+	if err != nil {
+		return ""
+	}
+
+	return state.NegotiatedProtocol
+}
+
+// supportedTLSVersions attempts a handshake pinned to each TLS version
+func supportedTLSVersions(ctx context.Context, address, serverName string, timeout time.Duration) []string {
+	var supported []string
+
+	for _, v := range tlsVersions {
+		_, err := tlsHandshake(ctx, address, &tls.Config{
+			ServerName: serverName,
+			MinVersion: v.Version,
+			MaxVersion: v.Version,
+		}, timeout)
+		if err == nil {
+			supported = append(supported, v.Name)
+		}
+	}
+
+	return supported
+}
+
+// tlsHandshake dials an address and completes a TLS handshake with the given config
+func tlsHandshake(ctx context.Context, address string, config *tls.Config, timeout time.Duration) (tls.ConnectionState, error) {
+	dialCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	dialer := &tls.Dialer{Config: config}
+
+	conn, err := dialer.DialContext(dialCtx, "tcp", address)
+	if err != nil {
+		return tls.ConnectionState{}, err
+	}
+	defer conn.Close()
+
+	return conn.(*tls.Conn).ConnectionState(), nil
+}
+
+// probeIPv6 resolves AAAA records for a host and checks whether any accept a TCP connection
+func probeIPv6(ctx context.Context, host, port string, timeout time.Duration) ([]string, bool) {
+	var addrs []string
+
+	// IP literals need no resolution
+	if ip := net.ParseIP(host); ip != nil {
+		if ip.To4() != nil {
+			return nil, false
+		}
+
+		addrs = []string{ip.String()}
+	} else {
+		lookupCtx, cancel := context.WithTimeout(ctx, timeout)
+		defer cancel()
+
+		ips, err := net.DefaultResolver.LookupIP(lookupCtx, "ip6", host)
+		if err != nil {
+			return nil, false
+		}
+
+		for _, ip := range ips {
+			addrs = append(addrs, ip.String())
+		}
+	}
+
+	for _, addr := range addrs {
+		dialCtx, cancel := context.WithTimeout(ctx, timeout)
+
+		var dialer net.Dialer
+
+		conn, err := dialer.DialContext(dialCtx, "tcp6", net.JoinHostPort(addr, port))
+		cancel()
+
+		if err == nil {
+			conn.Close()
+
+			return addrs, true
+		}
+	}
+
+	return addrs, false
+}
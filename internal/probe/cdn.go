@@ -0,0 +1,340 @@
+package probe
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// CDNInfo is what a response's headers reveal about the CDN that served it
+type CDNInfo struct {
+	Provider string // CDN named by its headers, e.g., "Cloudflare"
+	POP      string // edge location that answered, e.g., "IAD"
+
+	// Cache is the normalized verdict of the cache closest to the client (HIT, MISS,
+	// REVALIDATED, STALE, EXPIRED, BYPASS, ...) and CacheHeader the header it came from
+	Cache       string
+	CacheHeader string
+
+	Age    time.Duration // Age header: how long the response sat in caches
+	HasAge bool
+
+	// Timings are the Server-Timing metrics, in header order
+	Timings []ServerTiming
+}
+
+// ServerTiming is one metric of a Server-Timing header
+type ServerTiming struct {
+	Name        string
+	Duration    time.Duration
+	HasDuration bool
+	Description string
+}
+
+// empty reports whether no analyzer recognized anything
+func (c *CDNInfo) empty() bool {
+	return c.Provider == "" && c.POP == "" && c.Cache == "" && !c.HasAge && len(c.Timings) == 0
+}
+
+// setCache records a cache verdict unless an earlier analyzer already did
+func (c *CDNInfo) setCache(header, value string) {
+	if c.Cache != "" {
+		return
+	}
+
+	if verdict := cacheVerdict(value); verdict != "" {
+		c.Cache = verdict
+		c.CacheHeader = header + ": " + value
+	}
+}
+
+// setProvider records the CDN and edge location unless an earlier analyzer already did
+func (c *CDNInfo) setProvider(provider, pop string) {
+	if c.Provider == "" {
+		c.Provider = provider
+	}
+
+	if c.POP == "" {
+		c.POP = pop
+	}
+}
+
+// HeaderAnalyzer recognizes CDN response headers. Analyzers run in order over every
+// manifest and segment response and should only fill fields an earlier analyzer left empty.
+type HeaderAnalyzer interface {
+	// AnalyzeHeader records what the response headers reveal in info
+	AnalyzeHeader(header http.Header, info *CDNInfo)
+}
+
+// HeaderAnalyzerFunc adapts a function to the HeaderAnalyzer interface
+type HeaderAnalyzerFunc func(header http.Header, info *CDNInfo)
+
+// AnalyzeHeader calls f(header, info)
+func (f HeaderAnalyzerFunc) AnalyzeHeader(header http.Header, info *CDNInfo) {
+	f(header, info)
+}
+
+var (
+	headerAnalyzersMu sync.RWMutex
+
+	// headerAnalyzers run provider-specific headers first, then the generic ones
+	headerAnalyzers = []HeaderAnalyzer{
+		HeaderAnalyzerFunc(analyzeCloudflare),
+		HeaderAnalyzerFunc(analyzeCloudFront),
+		HeaderAnalyzerFunc(analyzeFastly),
+		HeaderAnalyzerFunc(analyzeAkamai),
+		HeaderAnalyzerFunc(analyzeCacheStatus),
+		HeaderAnalyzerFunc(analyzeXCache),
+		HeaderAnalyzerFunc(analyzeServerTiming),
+		HeaderAnalyzerFunc(analyzeAge),
+	}
+)
+
+// RegisterHeaderAnalyzer adds an analyzer that runs before the built-in ones, so it can
+// claim the headers of a CDN they do not know or misread
+func RegisterHeaderAnalyzer(analyzer HeaderAnalyzer) {
+	headerAnalyzersMu.Lock()
+	defer headerAnalyzersMu.Unlock()
+
+	headerAnalyzers = append([]HeaderAnalyzer{analyzer}, headerAnalyzers...)
+}
+
+// AnalyzeHeaders runs every analyzer over response headers, returning nil when none
+// recognized anything
+func AnalyzeHeaders(header http.Header) *CDNInfo {
+	if len(header) == 0 {
+		return nil
+	}
+
+	headerAnalyzersMu.RLock()
+	defer headerAnalyzersMu.RUnlock()
+
+	info := &CDNInfo{}
+
+	for _, analyzer := range headerAnalyzers {
+		analyzer.AnalyzeHeader(header, info)
+	}
+
+	if info.empty() {
+		return nil
+	}
+
+	return info
+}
+
+// analyzeCloudflare reads CF-Cache-Status and the data center suffix of CF-Ray
+func analyzeCloudflare(header http.Header, info *CDNInfo) {
+	status, ray := header.Get("CF-Cache-Status"), header.Get("CF-Ray")
+
+	if status == "" && ray == "" {
+		return
+	}
+
+	pop := ""
+
+	if i := strings.LastIndex(ray, "-"); i >= 0 {
+		pop = ray[i+1:]
+	}
+
+	info.setProvider("Cloudflare", pop)
+	info.setCache("CF-Cache-Status", status)
+}
+
+// analyzeCloudFront reads X-Amz-Cf-Pop and X-Cache values such as "Hit from cloudfront"
+func analyzeCloudFront(header http.Header, info *CDNInfo) {
+	pop, cache := header.Get("X-Amz-Cf-Pop"), header.Get("X-Cache")
+
+	if pop == "" && !strings.Contains(strings.ToLower(cache), "cloudfront") {
+		return
+	}
+
+	info.setProvider("CloudFront", pop)
+	info.setCache("X-Cache", cache)
+}
+
+// analyzeFastly reads X-Served-By cache node names (cache-<node>-<POP>), whose last entry
+// is the edge closest to the client
+func analyzeFastly(header http.Header, info *CDNInfo) {
+	servedBy := header.Get("X-Served-By")
+
+	if !strings.HasPrefix(servedBy, "cache-") {
+		return
+	}
+
+	nodes := strings.Split(servedBy, ",")
+	edge := strings.TrimSpace(nodes[len(nodes)-1])
+	pop := ""
+
+	if i := strings.LastIndex(edge, "-"); i >= 0 {
+		pop = edge[i+1:]
+	}
+
+	info.setProvider("Fastly", pop)
+	info.setCache("X-Cache", header.Get("X-Cache"))
+}
+
+// analyzeAkamai reads X-Cache values such as "TCP_MEM_HIT from a23-1-2-3 (AkamaiGHost/...)"
+func analyzeAkamai(header http.Header, info *CDNInfo) {
+	cache := header.Get("X-Cache")
+
+	if !strings.Contains(cache, "AkamaiGHost") && !strings.HasPrefix(cache, "TCP_") {
+		return
+	}
+
+	info.setProvider("Akamai", "")
+	info.setCache("X-Cache", cache)
+}
+
+// analyzeCacheStatus reads the RFC 9211 Cache-Status header, whose last entry is the cache
+// closest to the client (e.g., `"Origin Shield"; fwd=uri-miss, EdgeCache; hit`)
+func analyzeCacheStatus(header http.Header, info *CDNInfo) {
+	value := header.Get("Cache-Status")
+
+	if value == "" {
+		return
+	}
+
+	entries := splitQuoted(value, ',')
+	params := splitQuoted(entries[len(entries)-1], ';')
+	name := strings.Trim(strings.TrimSpace(params[0]), `"`)
+	verdict := ""
+
+	for _, param := range params[1:] {
+		key, val, _ := strings.Cut(strings.TrimSpace(param), "=")
+
+		switch {
+		case key == "hit":
+			verdict = "HIT"
+		case key == "fwd" && val == "stale":
+			verdict = "REVALIDATED"
+		case key == "fwd" && val == "bypass":
+			verdict = "BYPASS"
+		case key == "fwd":
+			verdict = "MISS"
+		}
+	}
+
+	info.setProvider(name, "")
+
+	if info.Cache == "" && verdict != "" {
+		info.Cache = verdict
+		info.CacheHeader = "Cache-Status: " + value
+	}
+}
+
+// analyzeXCache reads the generic cache headers set by Varnish, nginx, and most CDNs
+func analyzeXCache(header http.Header, info *CDNInfo) {
+	for _, name := range []string{"X-Cache", "X-Cache-Status", "X-Proxy-Cache"} {
+		info.setCache(name, header.Get(name))
+	}
+}
+
+// analyzeServerTiming reads Server-Timing metrics, taking cache verdicts and edge locations
+// from the cdn-cache and cdn-pop metrics that Akamai and CloudFront report
+func analyzeServerTiming(header http.Header, info *CDNInfo) {
+	timings := parseServerTiming(header.Values("Server-Timing"))
+
+	for _, timing := range timings {
+		switch strings.ToLower(timing.Name) {
+		case "cdn-cache":
+			info.setCache("Server-Timing", timing.Name+"; desc="+timing.Description)
+		case "cdn-cache-hit", "cdn-cache-miss", "cdn-cache-refresh":
+			info.setCache("Server-Timing", timing.Name)
+		case "cdn-pop":
+			info.setProvider("", timing.Description)
+		}
+	}
+
+	info.Timings = append(info.Timings, timings...)
+}
+
+// analyzeAge reads the Age header
+func analyzeAge(header http.Header, info *CDNInfo) {
+	seconds, err := strconv.ParseInt(strings.TrimSpace(header.Get("Age")), 10, 64)
+	if err != nil || seconds < 0 {
+		return
+	}
+
+	info.Age = time.Duration(seconds) * time.Second
+	info.HasAge = true
+}
+
+// cacheVerdict normalizes a cache header value; for lists such as Fastly's "MISS, HIT" the
+// last entry, from the cache closest to the client, decides
+func cacheVerdict(value string) string {
+	entries := strings.Split(value, ",")
+	v := strings.ToUpper(strings.TrimSpace(entries[len(entries)-1]))
+
+	switch {
+	case v == "":
+		return ""
+	case strings.Contains(v, "REFRESH"), strings.Contains(v, "REVALIDATED"):
+		return "REVALIDATED"
+	case strings.Contains(v, "STALE"):
+		return "STALE"
+	case strings.Contains(v, "HIT"):
+		return "HIT"
+	case strings.Contains(v, "MISS"):
+		return "MISS"
+	}
+
+	return strings.Fields(v)[0]
+}
+
+// parseServerTiming parses Server-Timing metrics (name;dur=12.5;desc="text", ...)
+func parseServerTiming(values []string) []ServerTiming {
+	var timings []ServerTiming
+
+	for _, value := range values {
+		for _, metric := range splitQuoted(value, ',') {
+			params := splitQuoted(metric, ';')
+			timing := ServerTiming{Name: strings.TrimSpace(params[0])}
+
+			if timing.Name == "" {
+				continue
+			}
+
+			for _, param := range params[1:] {
+				key, val, _ := strings.Cut(param, "=")
+				val = strings.Trim(strings.TrimSpace(val), `"`)
+
+				switch strings.ToLower(strings.TrimSpace(key)) {
+				case "dur":
+					if ms, err := strconv.ParseFloat(val, 64); err == nil && ms >= 0 {
+						timing.Duration = time.Duration(ms * float64(time.Millisecond))
+						timing.HasDuration = true
+					}
+				case "desc":
+					timing.Description = val
+				}
+			}
+
+			timings = append(timings, timing)
+		}
+	}
+
+	return timings
+}
+
+// splitQuoted splits s on sep outside double-quoted strings
+func splitQuoted(s string, sep byte) []string {
+	var parts []string
+
+	quoted, start := false, 0
+
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '"':
+			quoted = !quoted
+		case sep:
+			if !quoted {
+				parts = append(parts, s[start:i])
+				start = i + 1
+			}
+		}
+	}
+
+	return append(parts, s[start:])
+}
@@ -0,0 +1,312 @@
+package probe
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/netip"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// How a CDN was identified, most reliable first
+const (
+	CDNSourceHeaders    = "headers"
+	CDNSourceReverseDNS = "reverse DNS"
+	CDNSourceIPRange    = "IP range"
+)
+
+// reverseLookupTimeout bounds each PTR lookup; identification runs after the timed phases
+const reverseLookupTimeout = 2 * time.Second
+
+// CDNIdentity names the CDN and edge POP that served a request
+type CDNIdentity struct {
+	Provider string
+	POP      string
+	Source   string // how Provider was recognized: headers, reverse DNS, or IP range
+	Host     string // reverse DNS name of the edge address, when it has one
+}
+
+// CDNRange maps an address block to the CDN that serves from it
+type CDNRange struct {
+	Prefix   netip.Prefix
+	Provider string
+}
+
+// builtinCDNRanges is a snapshot of the largest blocks the major CDNs publish or announce;
+// it is not exhaustive and ages, so ParseCDNRanges lets callers add their own
+const builtinCDNRanges = `
+173.245.48.0/20 Cloudflare
+103.21.244.0/22 Cloudflare
+103.22.200.0/22 Cloudflare
+103.31.4.0/22 Cloudflare
+141.101.64.0/18 Cloudflare
+108.162.192.0/18 Cloudflare
+190.93.240.0/20 Cloudflare
+188.114.96.0/20 Cloudflare
+197.234.240.0/22 Cloudflare
+198.41.128.0/17 Cloudflare
+162.158.0.0/15 Cloudflare
+104.16.0.0/13 Cloudflare
+104.24.0.0/14 Cloudflare
+172.64.0.0/13 Cloudflare
+131.0.72.0/22 Cloudflare
+2400:cb00::/32 Cloudflare
+2606:4700::/32 Cloudflare
+2803:f800::/32 Cloudflare
+2405:b500::/32 Cloudflare
+2405:8100::/32 Cloudflare
+2a06:98c0::/29 Cloudflare
+2c0f:f248::/32 Cloudflare
+23.235.32.0/20 Fastly
+43.249.72.0/22 Fastly
+103.244.50.0/24 Fastly
+103.245.222.0/23 Fastly
+103.245.224.0/24 Fastly
+104.156.80.0/20 Fastly
+140.248.64.0/18 Fastly
+140.248.128.0/17 Fastly
+146.75.0.0/17 Fastly
+151.101.0.0/16 Fastly
+157.52.64.0/18 Fastly
+167.82.0.0/17 Fastly
+172.111.64.0/18 Fastly
+185.31.16.0/22 Fastly
+199.27.72.0/21 Fastly
+199.232.0.0/16 Fastly
+2a04:4e40::/32 Fastly
+2a04:4e42::/32 Fastly
+13.32.0.0/15 CloudFront
+13.224.0.0/14 CloudFront
+13.249.0.0/16 CloudFront
+18.64.0.0/14 CloudFront
+18.154.0.0/15 CloudFront
+18.160.0.0/15 CloudFront
+18.164.0.0/15 CloudFront
+18.238.0.0/15 CloudFront
+18.244.0.0/15 CloudFront
+52.84.0.0/15 CloudFront
+52.222.128.0/17 CloudFront
+54.182.0.0/16 CloudFront
+54.192.0.0/16 CloudFront
+54.230.0.0/16 CloudFront
+54.239.128.0/18 CloudFront
+99.84.0.0/16 CloudFront
+99.86.0.0/16 CloudFront
+108.138.0.0/15 CloudFront
+108.156.0.0/14 CloudFront
+130.176.0.0/16 CloudFront
+143.204.0.0/16 CloudFront
+205.251.192.0/19 CloudFront
+2600:9000::/28 CloudFront
+2.16.0.0/13 Akamai
+23.0.0.0/12 Akamai
+23.32.0.0/11 Akamai
+23.64.0.0/14 Akamai
+23.72.0.0/13 Akamai
+72.246.0.0/15 Akamai
+88.221.0.0/16 Akamai
+95.100.0.0/15 Akamai
+96.6.0.0/15 Akamai
+104.64.0.0/10 Akamai
+184.24.0.0/13 Akamai
+184.50.0.0/15 Akamai
+184.84.0.0/14 Akamai
+2600:1400::/24 Akamai
+2a02:26f0::/29 Akamai
+`
+
+// reverseDNSProviders maps PTR name suffixes to the CDN that names its edges that way
+var reverseDNSProviders = []struct {
+	suffix   string
+	provider string
+}{
+	{".cloudfront.net", "CloudFront"},
+	{".akamaitechnologies.com", "Akamai"},
+	{".akamaiedge.net", "Akamai"},
+	{".akamai.net", "Akamai"},
+	{".fastly.net", "Fastly"},
+	{".cloudflare.com", "Cloudflare"},
+	{".1e100.net", "Google"},
+	{".llnw.net", "Edgio"},
+	{".llnwd.net", "Edgio"},
+	{".edgecastcdn.net", "Edgio"},
+	{".b-cdn.net", "Bunny"},
+	{".bunnyinfra.net", "Bunny"},
+	{".cdn77.com", "CDN77"},
+	{".footprint.net", "Lumen"},
+}
+
+// cloudFrontPOP extracts the airport code of CloudFront edge names such as
+// server-13-32-1-2.iad89.r.cloudfront.net
+var cloudFrontPOP = regexp.MustCompile(`\.([a-z]{3})\d+(?:-[a-z0-9]+)?\.r\.cloudfront\.net$`)
+
+// CDNIdentifier recognizes the CDN serving a request from its response headers, the
+// reverse DNS name of its address, and known address blocks, in that order of trust.
+// Reverse lookups are cached per address.
+type CDNIdentifier struct {
+	ranges []CDNRange
+
+	mu  sync.Mutex
+	ptr map[netip.Addr]string
+}
+
+// NewCDNIdentifier creates an identifier that checks extra ranges before the built-in ones
+func NewCDNIdentifier(extra []CDNRange) *CDNIdentifier {
+	builtin, _ := ParseCDNRanges(strings.NewReader(builtinCDNRanges))
+
+	return &CDNIdentifier{
+		ranges: append(append([]CDNRange(nil), extra...), builtin...),
+		ptr:    make(map[netip.Addr]string),
+	}
+}
+
+// ParseCDNRanges reads "CIDR provider" lines; blank lines and # comments are skipped
+func ParseCDNRanges(r io.Reader) ([]CDNRange, error) {
+	var ranges []CDNRange
+
+	scanner := bufio.NewScanner(r)
+	line := 0
+
+	for scanner.Scan() {
+		line++
+
+		text := strings.TrimSpace(scanner.Text())
+
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+
+		cidr, provider, ok := strings.Cut(text, " ")
+		if !ok || strings.TrimSpace(provider) == "" {
+			return nil, fmt.Errorf("line %d: expected \"CIDR provider\", got %q", line, text)
+		}
+
+		prefix, err := netip.ParsePrefix(cidr)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+
+		ranges = append(ranges, CDNRange{Prefix: prefix.Masked(), Provider: strings.TrimSpace(provider)})
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read CDN ranges: %w", err)
+	}
+
+	return ranges, nil
+}
+
+// Identify combines the CDN headers of a response with the address that served it; an
+// empty remoteAddr (e.g., through a proxy) limits identification to the headers
+func (c *CDNIdentifier) Identify(ctx context.Context, info *CDNInfo, remoteAddr string) CDNIdentity {
+	var id CDNIdentity
+
+	if info != nil && info.Provider != "" {
+		id = CDNIdentity{Provider: info.Provider, POP: info.POP, Source: CDNSourceHeaders}
+	}
+
+	addr, ok := parseRemoteAddr(remoteAddr)
+	if !ok {
+		return id
+	}
+
+	if id.Provider == "" || id.POP == "" {
+		id.Host = c.reverseName(ctx, addr)
+
+		provider, pop := matchReverseName(id.Host)
+
+		if id.Provider == "" && provider != "" {
+			id.Provider, id.Source = provider, CDNSourceReverseDNS
+		}
+
+		if id.POP == "" && provider == id.Provider {
+			id.POP = pop
+		}
+	}
+
+	if id.Provider == "" {
+		if provider := c.matchRange(addr); provider != "" {
+			id.Provider, id.Source = provider, CDNSourceIPRange
+		}
+	}
+
+	return id
+}
+
+// reverseName returns the first PTR name of an address, caching the answer (or its absence)
+func (c *CDNIdentifier) reverseName(ctx context.Context, addr netip.Addr) string {
+	c.mu.Lock()
+	name, ok := c.ptr[addr]
+	c.mu.Unlock()
+
+	if ok {
+		return name
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, reverseLookupTimeout)
+	defer cancel()
+
+	if names, err := net.DefaultResolver.LookupAddr(ctx, addr.String()); err == nil && len(names) > 0 {
+		name = strings.TrimSuffix(strings.ToLower(names[0]), ".")
+	}
+
+	c.mu.Lock()
+	c.ptr[addr] = name
+	c.mu.Unlock()
+
+	return name
+}
+
+// matchRange returns the provider of the most specific range containing the address
+func (c *CDNIdentifier) matchRange(addr netip.Addr) string {
+	provider, bits := "", -1
+
+	for _, r := range c.ranges {
+		if r.Prefix.Bits() > bits && r.Prefix.Contains(addr) {
+			provider, bits = r.Provider, r.Prefix.Bits()
+		}
+	}
+
+	return provider
+}
+
+// matchReverseName recognizes CDN edge names, with the POP when the name carries one
+func matchReverseName(name string) (string, string) {
+	for _, known := range reverseDNSProviders {
+		if !strings.HasSuffix(name, known.suffix) {
+			continue
+		}
+
+		pop := ""
+
+		if m := cloudFrontPOP.FindStringSubmatch(name); m != nil {
+			pop = strings.ToUpper(m[1])
+		}
+
+		return known.provider, pop
+	}
+
+	return "", ""
+}
+
+// parseRemoteAddr extracts the IP address of a host:port connection address
+func parseRemoteAddr(remoteAddr string) (netip.Addr, bool) {
+	addrPort, err := netip.ParseAddrPort(remoteAddr)
+	if err != nil {
+		return netip.Addr{}, false
+	}
+
+	addr := addrPort.Addr().Unmap()
+
+	// Loopback and private edges (test origins, on-net caches) are not in public ranges
+	if addr.IsLoopback() || addr.IsPrivate() {
+		return netip.Addr{}, false
+	}
+
+	return addr, true
+}
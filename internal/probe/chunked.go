@@ -0,0 +1,190 @@
+package probe
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"time"
+)
+
+// ChunkTiming records how an in-progress CMAF segment arrived as the origin produced it.
+// FirstChunk and Complete are measured from the start of the request.
+type ChunkTiming struct {
+	FirstChunk time.Duration
+	Complete   time.Duration
+	Chunks     int
+
+	// Arrivals are when each chunk had arrived completely; the first is FirstChunk
+	Arrivals []time.Duration
+
+	// Chunked is set when the response streamed without a Content-Length, as chunked
+	// transfer encoding (or an HTTP/2 or HTTP/3 body of unknown length) does
+	Chunked bool
+}
+
+// DownloadChunked downloads an in-progress segment, timing when its first complete CMAF
+// chunk (a moof box and the mdat after it) arrives. It returns the whole segment and the
+// bytes up to the end of the first chunk, which decode on their own after the init segment.
+func DownloadChunked(ctx context.Context, segmentURL string, client *http.Client, useHTTP3 bool) ([]byte, []byte, *ChunkTiming, *Trace, error) {
+	fetch := FetchWithTrace
+
+	if useHTTP3 {
+		fetch = FetchWithTraceHTTP3
+	}
+
+	start := time.Now()
+
+	resp, trace, err := fetch(ctx, segmentURL, client)
+	if err != nil {
+		return nil, nil, nil, nil, fmt.Errorf("failed to download segment: %w", err)
+	}
+	defer resp.Body.Close()
+
+	// Check for HTTP errors
+	if resp.StatusCode != http.StatusOK {
+		return nil, nil, nil, nil, fmt.Errorf("segment download returned status %d", resp.StatusCode)
+	}
+
+	timing := &ChunkTiming{Chunked: streamedBody(resp)}
+
+	var (
+		data       []byte
+		firstChunk []byte
+		scanned    int
+		inChunk    bool
+	)
+
+	body := newProgressReader(resp.Body, start)
+	buf := make([]byte, 32*1024)
+
+	for {
+		n, readErr := body.Read(buf)
+		data = append(data, buf[:n]...)
+
+		// Walk the top-level boxes completed by this read; each mdat after a moof ends a chunk
+		for {
+			boxType, end, ok := completeBox(data, scanned)
+			if !ok {
+				break
+			}
+
+			switch boxType {
+			case "moof":
+				inChunk = true
+			case "mdat":
+				if inChunk {
+					timing.Chunks++
+					timing.Arrivals = append(timing.Arrivals, time.Since(start))
+					inChunk = false
+
+					if firstChunk == nil {
+						timing.FirstChunk = timing.Arrivals[0]
+						firstChunk = data[:end:end]
+					}
+				}
+			}
+
+			scanned = end
+		}
+
+		if errors.Is(readErr, io.EOF) {
+			break
+		}
+
+		// Partial data is returned alongside read errors for inspection
+		if readErr != nil {
+			return data, firstChunk, timing, trace, fmt.Errorf("failed to read segment data: %w", readErr)
+		}
+	}
+
+	timing.Complete = time.Since(start)
+	trace.Bytes = int64(len(data))
+	trace.Download = timing.Complete
+	trace.Progress = body.progress()
+
+	// A segment without CMAF chunks only decodes once it is complete
+	if firstChunk == nil {
+		timing.FirstChunk = timing.Complete
+		firstChunk = data
+	}
+
+	return data, firstChunk, timing, trace, nil
+}
+
+// Gaps returns the waits between consecutive chunks
+func (c *ChunkTiming) Gaps() []time.Duration {
+	var gaps []time.Duration
+
+	for i := 1; i < len(c.Arrivals); i++ {
+		gaps = append(gaps, c.Arrivals[i]-c.Arrivals[i-1])
+	}
+
+	return gaps
+}
+
+// streamedBody reports whether a response streams without a Content-Length, as chunked
+// transfer encoding (or an HTTP/2 or HTTP/3 body of unknown length) does
+func streamedBody(resp *http.Response) bool {
+	return resp.ContentLength < 0 || slices.Contains(resp.TransferEncoding, "chunked")
+}
+
+// chunkEnds returns the offsets at which each CMAF chunk (a moof box and the mdat after it)
+// of a complete segment ends
+func chunkEnds(data []byte) []int {
+	var (
+		ends    []int
+		inChunk bool
+	)
+
+	for offset := 0; ; {
+		boxType, end, ok := completeBox(data, offset)
+		if !ok {
+			return ends
+		}
+
+		switch boxType {
+		case "moof":
+			inChunk = true
+		case "mdat":
+			if inChunk {
+				ends = append(ends, end)
+				inChunk = false
+			}
+		}
+
+		offset = end
+	}
+}
+
+// completeBox returns the type and end offset of the ISO BMFF box starting at offset when
+// all of it has arrived
+func completeBox(data []byte, offset int) (string, int, bool) {
+	if len(data)-offset < 8 {
+		return "", 0, false
+	}
+
+	size := uint64(binary.BigEndian.Uint32(data[offset:]))
+	boxType := string(data[offset+4 : offset+8])
+
+	switch size {
+	case 0:
+		// The box runs to the end of the file, so it is only complete at EOF
+		return "", 0, false
+	case 1:
+		if len(data)-offset < 16 {
+			return "", 0, false
+		}
+
+		size = binary.BigEndian.Uint64(data[offset+8:])
+	}
+
+	if size < 8 || size > uint64(len(data)-offset) {
+		return "", 0, false
+	}
+
+	return boxType, offset + int(size), true
+}
@@ -0,0 +1,212 @@
+package probe
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// CMCD object types (CTA-5004 "ot") of the requests vtrace makes
+const (
+	CMCDManifest = "m"
+	CMCDAudio    = "a"
+	CMCDVideo    = "v"
+	CMCDInit     = "i"
+	CMCDCaption  = "c"
+	CMCDKey      = "k"
+	CMCDOther    = "o"
+)
+
+// CMCD streaming formats ("sf")
+const (
+	CMCDFormatHLS  = "h"
+	CMCDFormatDASH = "d"
+)
+
+// CMCD transmission modes
+const (
+	CMCDQuery  = "query"
+	CMCDHeader = "header"
+)
+
+// cmcdHeaders assigns each key to the CMCD header that carries it in header mode
+var cmcdHeaders = map[string]string{
+	"br": "CMCD-Object", "d": "CMCD-Object", "ot": "CMCD-Object", "tb": "CMCD-Object",
+	"bl": "CMCD-Request", "dl": "CMCD-Request", "mtp": "CMCD-Request", "nor": "CMCD-Request", "nrr": "CMCD-Request", "su": "CMCD-Request",
+	"cid": "CMCD-Session", "pr": "CMCD-Session", "sf": "CMCD-Session", "sid": "CMCD-Session", "st": "CMCD-Session", "v": "CMCD-Session",
+	"bs": "CMCD-Status", "rtp": "CMCD-Status",
+}
+
+// CMCD describes the Common Media Client Data (CTA-5004) attached to every request, so
+// probes show up in CDN and origin CMCD analytics like a starting player
+type CMCD struct {
+	// Mode sends the data as the CMCD query parameter (CMCDQuery) or as CMCD-* headers (CMCDHeader)
+	Mode string
+	// SessionID identifies the playback session ("sid")
+	SessionID string
+	// ContentID identifies the content ("cid"); empty omits it
+	ContentID string
+	// Format is the streaming format ("sf"): CMCDFormatHLS or CMCDFormatDASH
+	Format string
+	// Starved reports buffer starvation ("bs") on media requests, emulating a player that
+	// stalled before the request
+	Starved bool
+}
+
+// cmcdObjectKey carries the object type of the requests made with a context
+type cmcdObjectKey struct{}
+
+// WithCMCDObject returns a context whose requests report object type ot instead of the
+// type inferred from the URL
+func WithCMCDObject(ctx context.Context, ot string) context.Context {
+	return context.WithValue(ctx, cmcdObjectKey{}, ot)
+}
+
+// cmcdObject returns the object type set on the context, or infers it from the URL path
+func cmcdObject(req *http.Request) string {
+	if ot, ok := req.Context().Value(cmcdObjectKey{}).(string); ok {
+		return ot
+	}
+
+	name := strings.ToLower(path.Base(req.URL.Path))
+
+	if strings.Contains(name, "init") {
+		return CMCDInit
+	}
+
+	switch path.Ext(name) {
+	case ".m3u8", ".m3u", ".mpd":
+		return CMCDManifest
+	case ".ts", ".m4s", ".mp4", ".m4v", ".cmfv":
+		return CMCDVideo
+	case ".aac", ".m4a", ".mp3", ".ac3", ".ec3", ".cmfa":
+		return CMCDAudio
+	case ".vtt", ".webvtt", ".ttml", ".srt", ".cmft":
+		return CMCDCaption
+	case ".key":
+		return CMCDKey
+	}
+
+	return CMCDOther
+}
+
+// keys returns the CMCD key-value pairs of a request with object type ot; boolean keys
+// that are true carry no value and false ones are omitted
+func (c *CMCD) keys(ot string) map[string]string {
+	keys := map[string]string{
+		"ot":  ot,
+		"sid": strconv.Quote(c.SessionID),
+		// Every vtrace sample measures a start-up
+		"su": "",
+	}
+
+	if c.ContentID != "" {
+		keys["cid"] = strconv.Quote(c.ContentID)
+	}
+
+	if c.Format != "" {
+		keys["sf"] = c.Format
+	}
+
+	// Media requests start with an empty buffer
+	if ot == CMCDVideo || ot == CMCDAudio || ot == CMCDInit {
+		keys["bl"] = "0"
+
+		if c.Starved {
+			keys["bs"] = ""
+		}
+	}
+
+	return keys
+}
+
+// encodeCMCD serializes key-value pairs in alphabetical key order, as CTA-5004 requires
+func encodeCMCD(keys map[string]string) string {
+	names := make([]string, 0, len(keys))
+
+	for name := range keys {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	parts := make([]string, len(names))
+
+	for i, name := range names {
+		parts[i] = name
+
+		if keys[name] != "" {
+			parts[i] += "=" + keys[name]
+		}
+	}
+
+	return strings.Join(parts, ",")
+}
+
+// cmcdTransport attaches CMCD data to every request before handing it to the wrapped transport
+type cmcdTransport struct {
+	base http.RoundTripper
+	cmcd *CMCD
+}
+
+// withCMCD wraps base so every request carries cmcd, returning base unchanged when cmcd is nil
+func withCMCD(base http.RoundTripper, cmcd *CMCD) http.RoundTripper {
+	if cmcd == nil {
+		return base
+	}
+
+	return &cmcdTransport{base: base, cmcd: cmcd}
+}
+
+// RoundTrip adds the CMCD query parameter or headers to a copy of the request
+func (t *cmcdTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	keys := t.cmcd.keys(cmcdObject(req))
+
+	if t.cmcd.Mode == CMCDHeader {
+		grouped := make(map[string]map[string]string)
+
+		for name, value := range keys {
+			header := cmcdHeaders[name]
+
+			if grouped[header] == nil {
+				grouped[header] = make(map[string]string)
+			}
+
+			grouped[header][name] = value
+		}
+
+		for header, group := range grouped {
+			req.Header.Set(header, encodeCMCD(group))
+		}
+
+		return t.base.RoundTrip(req)
+	}
+
+	// The parameter is appended so the existing query keeps its exact encoding
+	if _, ok := req.URL.Query()["CMCD"]; !ok {
+		u := *req.URL
+		param := "CMCD=" + url.QueryEscape(encodeCMCD(keys))
+
+		if u.RawQuery == "" {
+			u.RawQuery = param
+		} else {
+			u.RawQuery += "&" + param
+		}
+
+		req.URL = &u
+	}
+
+	return t.base.RoundTrip(req)
+}
+
+// CloseIdleConnections closes idle connections of the wrapped transport
+func (t *cmcdTransport) CloseIdleConnections() {
+	if closer, ok := t.base.(interface{ CloseIdleConnections() }); ok {
+		closer.CloseIdleConnections()
+	}
+}
@@ -0,0 +1,402 @@
+package probe
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// typeHTTPS is the DNS resource record type for HTTPS service bindings (RFC 9460)
+const typeHTTPS = dnsmessage.Type(65)
+
+// SvcParam keys defined by RFC 9460
+const (
+	svcParamALPN     = 1
+	svcParamPort     = 3
+	svcParamIPv4Hint = 4
+	svcParamECH      = 5
+	svcParamIPv6Hint = 6
+)
+
+// ednsPayloadSize is the UDP payload size advertised with EDNS0, the DNS Flag Day 2020
+// default that avoids IP fragmentation
+const ednsPayloadSize = 1232
+
+// fallbackNameserver is used when no system resolver configuration is found
+const fallbackNameserver = "1.1.1.1:53"
+
+var ErrNoHTTPSRecords = errors.New("no HTTPS records published")
+
+// HTTPSRecord holds the parsed fields of a DNS HTTPS (type 65) record
+type HTTPSRecord struct {
+	Priority  uint16
+	Target    string
+	ALPN      []string
+	Port      uint16
+	IPv4Hints []net.IP
+	IPv6Hints []net.IP
+	ECHConfig []byte
+}
+
+// SystemNameserver returns the first nameserver from /etc/resolv.conf as host:port
+func SystemNameserver() string {
+	f, err := os.Open("/etc/resolv.conf")
+	if err != nil {
+		return fallbackNameserver
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+
+		if len(fields) >= 2 && fields[0] == "nameserver" {
+			return net.JoinHostPort(fields[1], "53")
+		}
+	}
+
+	return fallbackNameserver
+}
+
+// NewResolver returns a resolver that sends every query to the given nameserver (host:port)
+func NewResolver(nameserver string) *net.Resolver {
+	return &net.Resolver{
+		PreferGo: true,
+		Dial: func(ctx context.Context, network, _ string) (net.Conn, error) {
+			var dialer net.Dialer
+
+			return dialer.DialContext(ctx, network, nameserver)
+		},
+	}
+}
+
+// LookupHost resolves a host to its sorted addresses through the given nameserver
+func LookupHost(ctx context.Context, host, nameserver string) ([]string, error) {
+	addrs, err := NewResolver(nameserver).LookupHost(ctx, host)
+	if err != nil {
+		return nil, fmt.Errorf("lookup of %s via %s failed: %w", host, nameserver, err)
+	}
+
+	sort.Strings(addrs)
+
+	return addrs, nil
+}
+
+// LookupHTTPS queries the HTTPS records for a host from the given nameserver
+func LookupHTTPS(ctx context.Context, host, nameserver string) ([]HTTPSRecord, error) {
+	name, err := dnsmessage.NewName(dnsName(host))
+	if err != nil {
+		return nil, fmt.Errorf("invalid host name: %w", err)
+	}
+
+	// Advertise an EDNS0 payload so records carrying ECH configs fit in one UDP answer
+	var opt dnsmessage.ResourceHeader
+
+	if err := opt.SetEDNS0(ednsPayloadSize, dnsmessage.RCodeSuccess, false); err != nil {
+		return nil, fmt.Errorf("failed to build DNS query: %w", err)
+	}
+
+	query := dnsmessage.Message{
+		Header: dnsmessage.Header{ID: uint16(rand.Intn(1 << 16)), RecursionDesired: true},
+		Questions: []dnsmessage.Question{{
+			Name:  name,
+			Type:  typeHTTPS,
+			Class: dnsmessage.ClassINET,
+		}},
+		Additionals: []dnsmessage.Resource{{Header: opt, Body: &dnsmessage.OPTResource{}}},
+	}
+
+	packed, err := query.Pack()
+	if err != nil {
+		return nil, fmt.Errorf("failed to build DNS query: %w", err)
+	}
+
+	response, err := exchangeDNS(ctx, nameserver, packed, query.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	var parser dnsmessage.Parser
+
+	header, err := parser.Start(response)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse DNS response: %w", err)
+	}
+
+	if header.RCode != dnsmessage.RCodeSuccess {
+		return nil, fmt.Errorf("DNS query returned %s", header.RCode)
+	}
+
+	if err := parser.SkipAllQuestions(); err != nil {
+		return nil, fmt.Errorf("failed to parse DNS response: %w", err)
+	}
+
+	var records []HTTPSRecord
+
+	for {
+		rh, err := parser.AnswerHeader()
+		if errors.Is(err, dnsmessage.ErrSectionDone) {
+			break
+		}
+
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse DNS answer: %w", err)
+		}
+
+		// Skip CNAMEs and anything else preceding the HTTPS answers
+		if rh.Type != typeHTTPS {
+			if err := parser.SkipAnswer(); err != nil {
+				return nil, fmt.Errorf("failed to parse DNS answer: %w", err)
+			}
+
+			continue
+		}
+
+		res, err := parser.UnknownResource()
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse HTTPS record: %w", err)
+		}
+
+		record, err := parseHTTPSRecord(res.Data)
+		if err != nil {
+			return nil, err
+		}
+
+		records = append(records, record)
+	}
+
+	if len(records) == 0 {
+		return nil, ErrNoHTTPSRecords
+	}
+
+	return records, nil
+}
+
+// exchangeDNS sends a packed DNS query over UDP and returns the raw response to it,
+// repeating the query over TCP when the UDP answer is truncated
+func exchangeDNS(ctx context.Context, nameserver string, query []byte, id uint16) ([]byte, error) {
+	response, err := exchangeDNSUDP(ctx, nameserver, query, id)
+	if err != nil {
+		return nil, err
+	}
+
+	var parser dnsmessage.Parser
+
+	header, err := parser.Start(response)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse DNS response: %w", err)
+	}
+
+	if !header.Truncated {
+		return response, nil
+	}
+
+	return exchangeDNSTCP(ctx, nameserver, query, id)
+}
+
+// exchangeDNSUDP sends a query over UDP and waits for the response carrying its ID,
+// discarding stray or spoofed datagrams with other IDs
+func exchangeDNSUDP(ctx context.Context, nameserver string, query []byte, id uint16) ([]byte, error) {
+	var dialer net.Dialer
+
+	conn, err := dialer.DialContext(ctx, "udp", nameserver)
+	if err != nil {
+		return nil, fmt.Errorf("failed to contact nameserver: %w", err)
+	}
+	defer conn.Close()
+
+	conn.SetDeadline(dnsDeadline(ctx))
+
+	if _, err := conn.Write(query); err != nil {
+		return nil, fmt.Errorf("failed to send DNS query: %w", err)
+	}
+
+	buf := make([]byte, 4096)
+
+	for {
+		n, err := conn.Read(buf)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read DNS response: %w", err)
+		}
+
+		if matchesID(buf[:n], id) {
+			return buf[:n], nil
+		}
+	}
+}
+
+// exchangeDNSTCP sends a query over TCP with its two-byte length prefix and returns the response
+func exchangeDNSTCP(ctx context.Context, nameserver string, query []byte, id uint16) ([]byte, error) {
+	var dialer net.Dialer
+
+	conn, err := dialer.DialContext(ctx, "tcp", nameserver)
+	if err != nil {
+		return nil, fmt.Errorf("failed to contact nameserver over TCP: %w", err)
+	}
+	defer conn.Close()
+
+	conn.SetDeadline(dnsDeadline(ctx))
+
+	framed := binary.BigEndian.AppendUint16(make([]byte, 0, 2+len(query)), uint16(len(query)))
+
+	if _, err := conn.Write(append(framed, query...)); err != nil {
+		return nil, fmt.Errorf("failed to send DNS query over TCP: %w", err)
+	}
+
+	var length [2]byte
+
+	if _, err := io.ReadFull(conn, length[:]); err != nil {
+		return nil, fmt.Errorf("failed to read DNS response over TCP: %w", err)
+	}
+
+	response := make([]byte, binary.BigEndian.Uint16(length[:]))
+
+	if _, err := io.ReadFull(conn, response); err != nil {
+		return nil, fmt.Errorf("failed to read DNS response over TCP: %w", err)
+	}
+
+	if !matchesID(response, id) {
+		return nil, errors.New("DNS response over TCP does not match the query ID")
+	}
+
+	return response, nil
+}
+
+// dnsDeadline returns the context deadline, or five seconds from now without one
+func dnsDeadline(ctx context.Context) time.Time {
+	if deadline, ok := ctx.Deadline(); ok {
+		return deadline
+	}
+
+	return time.Now().Add(5 * time.Second)
+}
+
+// matchesID reports whether a DNS response carries the ID of its query
+func matchesID(response []byte, id uint16) bool {
+	return len(response) >= 2 && binary.BigEndian.Uint16(response) == id
+}
+
+// parseHTTPSRecord decodes the RDATA of an HTTPS record
+func parseHTTPSRecord(data []byte) (HTTPSRecord, error) {
+	var record HTTPSRecord
+
+	if len(data) < 3 {
+		return record, errors.New("truncated HTTPS record")
+	}
+
+	record.Priority = binary.BigEndian.Uint16(data)
+
+	target, off, err := parseUncompressedName(data, 2)
+	if err != nil {
+		return record, err
+	}
+
+	record.Target = target
+
+	// Walk the SvcParams key/value list
+	for off+4 <= len(data) {
+		key := binary.BigEndian.Uint16(data[off:])
+		length := int(binary.BigEndian.Uint16(data[off+2:]))
+		off += 4
+
+		if off+length > len(data) {
+			return record, errors.New("truncated HTTPS SvcParam")
+		}
+
+		value := data[off : off+length]
+		off += length
+
+		switch key {
+		case svcParamALPN:
+			for i := 0; i < len(value); {
+				n := int(value[i])
+
+				if i+1+n > len(value) {
+					break
+				}
+
+				record.ALPN = append(record.ALPN, string(value[i+1:i+1+n]))
+				i += 1 + n
+			}
+		case svcParamPort:
+			if len(value) == 2 {
+				record.Port = binary.BigEndian.Uint16(value)
+			}
+		case svcParamIPv4Hint:
+			for i := 0; i+4 <= len(value); i += 4 {
+				record.IPv4Hints = append(record.IPv4Hints, net.IP(append([]byte(nil), value[i:i+4]...)))
+			}
+		case svcParamECH:
+			record.ECHConfig = append([]byte(nil), value...)
+		case svcParamIPv6Hint:
+			for i := 0; i+16 <= len(value); i += 16 {
+				record.IPv6Hints = append(record.IPv6Hints, net.IP(append([]byte(nil), value[i:i+16]...)))
+			}
+		}
+	}
+
+	return record, nil
+}
+
+// parseUncompressedName reads a wire-format domain name without compression pointers
+func parseUncompressedName(data []byte, off int) (string, int, error) {
+	var labels []string
+
+	for {
+		if off >= len(data) {
+			return "", 0, errors.New("truncated HTTPS target name")
+		}
+
+		n := int(data[off])
+		off++
+
+		if n == 0 {
+			break
+		}
+
+		if off+n > len(data) {
+			return "", 0, errors.New("truncated HTTPS target label")
+		}
+
+		labels = append(labels, string(data[off:off+n]))
+		off += n
+	}
+
+	if len(labels) == 0 {
+		return ".", off, nil
+	}
+
+	return strings.Join(labels, ".") + ".", off, nil
+}
+
+// dnsName returns a fully-qualified DNS name for a host
+func dnsName(host string) string {
+	if strings.HasSuffix(host, ".") {
+		return host
+	}
+
+	return host + "."
+}
+
+// ECHConfigFromRecords returns the first ECH config list advertised in HTTPS records
+func ECHConfigFromRecords(records []HTTPSRecord) []byte {
+	for _, r := range records {
+		if len(r.ECHConfig) > 0 {
+			return r.ECHConfig
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,195 @@
+package probe
+
+import (
+	"context"
+	"encoding/binary"
+	"io"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// dnsStub answers HTTPS queries on one loopback port over UDP and TCP
+type dnsStub struct {
+	udp *net.UDPConn
+	tcp *net.TCPListener
+
+	// truncate sets TC on UDP answers so clients must retry over TCP
+	truncate bool
+
+	// payload is the EDNS0 UDP payload size of the last query, 0 without OPT
+	payload atomic.Int64
+}
+
+// newDNSStub listens on a loopback port free for both UDP and TCP
+func newDNSStub(t *testing.T, truncate bool) *dnsStub {
+	t.Helper()
+
+	for range 10 {
+		udp, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+		if err != nil {
+			t.Fatalf("failed to listen on UDP: %v", err)
+		}
+
+		tcp, err := net.ListenTCP("tcp", &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1), Port: udp.LocalAddr().(*net.UDPAddr).Port})
+		if err != nil {
+			udp.Close()
+
+			continue
+		}
+
+		stub := &dnsStub{udp: udp, tcp: tcp, truncate: truncate}
+
+		t.Cleanup(func() {
+			udp.Close()
+			tcp.Close()
+		})
+
+		go stub.serveUDP(t)
+		go stub.serveTCP(t)
+
+		return stub
+	}
+
+	t.Skip("no loopback port free for both UDP and TCP")
+
+	return nil
+}
+
+// addr returns the stub's host:port
+func (s *dnsStub) addr() string {
+	return s.udp.LocalAddr().String()
+}
+
+// serveUDP sends an empty answer with the wrong ID before each real one
+func (s *dnsStub) serveUDP(t *testing.T) {
+	buf := make([]byte, 4096)
+
+	for {
+		n, peer, err := s.udp.ReadFromUDP(buf)
+		if err != nil {
+			return
+		}
+
+		query := s.parseQuery(t, buf[:n])
+
+		// The stray answer has no records, so accepting it fails the lookup
+		stray := s.answer(t, dnsmessage.Message{Header: dnsmessage.Header{ID: query.ID + 1}}, false)
+		s.udp.WriteToUDP(stray, peer)
+
+		s.udp.WriteToUDP(s.answer(t, query, s.truncate), peer)
+	}
+}
+
+// serveTCP answers length-prefixed queries in full
+func (s *dnsStub) serveTCP(t *testing.T) {
+	for {
+		conn, err := s.tcp.Accept()
+		if err != nil {
+			return
+		}
+
+		var length [2]byte
+
+		if _, err := io.ReadFull(conn, length[:]); err != nil {
+			conn.Close()
+
+			continue
+		}
+
+		packed := make([]byte, binary.BigEndian.Uint16(length[:]))
+
+		if _, err := io.ReadFull(conn, packed); err != nil {
+			conn.Close()
+
+			continue
+		}
+
+		response := s.answer(t, s.parseQuery(t, packed), false)
+		conn.Write(append(binary.BigEndian.AppendUint16(nil, uint16(len(response))), response...))
+		conn.Close()
+	}
+}
+
+// parseQuery decodes a query and records its EDNS0 payload size
+func (s *dnsStub) parseQuery(t *testing.T, packed []byte) dnsmessage.Message {
+	var query dnsmessage.Message
+
+	if err := query.Unpack(packed); err != nil {
+		t.Errorf("failed to parse query: %v", err)
+
+		return query
+	}
+
+	payload := int64(0)
+
+	for _, additional := range query.Additionals {
+		if additional.Header.Type == dnsmessage.TypeOPT {
+			payload = int64(additional.Header.Class)
+		}
+	}
+
+	s.payload.Store(payload)
+
+	return query
+}
+
+// answer builds a response with one HTTPS record, or an empty truncated one
+func (s *dnsStub) answer(t *testing.T, query dnsmessage.Message, truncated bool) []byte {
+	response := dnsmessage.Message{
+		Header:    dnsmessage.Header{ID: query.ID, Response: true, RecursionDesired: true, Truncated: truncated},
+		Questions: query.Questions,
+	}
+
+	if !truncated && len(query.Questions) > 0 {
+		// Priority 1, target ".", alpn=h3
+		rdata := []byte{0, 1, 0, 0, svcParamALPN, 0, 3, 2, 'h', '3'}
+
+		response.Answers = []dnsmessage.Resource{{
+			Header: dnsmessage.ResourceHeader{Name: query.Questions[0].Name, Type: typeHTTPS, Class: dnsmessage.ClassINET, TTL: 60},
+			Body:   &dnsmessage.UnknownResource{Type: typeHTTPS, Data: rdata},
+		}}
+	}
+
+	packed, err := response.Pack()
+	if err != nil {
+		t.Errorf("failed to build response: %v", err)
+	}
+
+	return packed
+}
+
+func TestLookupHTTPS(t *testing.T) {
+	tests := []struct {
+		name     string
+		truncate bool
+	}{
+		{name: "UDP answer"},
+		{name: "truncated UDP answer retried over TCP", truncate: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stub := newDNSStub(t, tt.truncate)
+
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+
+			records, err := LookupHTTPS(ctx, "example.com", stub.addr())
+			if err != nil {
+				t.Fatalf("LookupHTTPS() error = %v", err)
+			}
+
+			if len(records) != 1 || records[0].Priority != 1 || len(records[0].ALPN) != 1 || records[0].ALPN[0] != "h3" {
+				t.Errorf("LookupHTTPS() = %+v, want one priority 1 record with ALPN h3", records)
+			}
+
+			if payload := stub.payload.Load(); payload != ednsPayloadSize {
+				t.Errorf("EDNS0 payload = %d, want %d", payload, ednsPayloadSize)
+			}
+		})
+	}
+}
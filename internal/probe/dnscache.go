@@ -0,0 +1,216 @@
+package probe
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http/httptrace"
+	"net/netip"
+	"sync"
+	"time"
+)
+
+// AnswerCache stores DNS answers between lookups. Implementations must be safe for
+// concurrent use; a cache that never returns an answer turns the resolver into a pass-through
+// that still records every query.
+type AnswerCache interface {
+	// Get returns the cached addresses of host, or false when the host must be queried
+	Get(host string) ([]netip.Addr, bool)
+	// Put stores the addresses a query returned for host
+	Put(host string, addrs []netip.Addr)
+}
+
+// memoryCache keeps answers in memory for a fixed time
+type memoryCache struct {
+	ttl time.Duration
+
+	mu      sync.Mutex
+	answers map[string]cachedAnswer
+}
+
+// cachedAnswer is one stored answer and when it stops being served
+type cachedAnswer struct {
+	addrs   []netip.Addr
+	expires time.Time
+}
+
+// NewAnswerCache returns an in-memory cache that serves each answer for ttl; the resolver
+// API does not expose record TTLs, so one lifetime applies to every host
+func NewAnswerCache(ttl time.Duration) AnswerCache {
+	return &memoryCache{ttl: ttl, answers: make(map[string]cachedAnswer)}
+}
+
+// Get returns an answer that has not expired
+func (c *memoryCache) Get(host string) ([]netip.Addr, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	answer, ok := c.answers[host]
+	if !ok {
+		return nil, false
+	}
+
+	if time.Now().After(answer.expires) {
+		delete(c.answers, host)
+
+		return nil, false
+	}
+
+	return answer.addrs, true
+}
+
+// Put stores an answer for the cache's ttl
+func (c *memoryCache) Put(host string, addrs []netip.Addr) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.answers[host] = cachedAnswer{addrs: addrs, expires: time.Now().Add(c.ttl)}
+}
+
+// DNSStats counts the lookups a DNSResolver answered since it was created
+type DNSStats struct {
+	Hits     int // answered from the cache
+	Misses   int // sent to the resolver
+	Failures int // misses the resolver could not answer
+
+	// Queries holds the latency of every miss, in query order
+	Queries []time.Duration
+}
+
+// DNSResolver resolves the hosts both transports dial, answering from a pluggable cache
+// and recording hits, misses, and the latency of each query sent to the nameserver. One
+// resolver shared by every client of a run accumulates the run's DNS behavior.
+type DNSResolver struct {
+	cache    AnswerCache
+	resolver *net.Resolver
+
+	mu    sync.Mutex
+	stats DNSStats
+}
+
+// NewDNSResolver creates a resolver layer over cache; a nil resolver uses the system one
+func NewDNSResolver(cache AnswerCache, resolver *net.Resolver) *DNSResolver {
+	if resolver == nil {
+		resolver = net.DefaultResolver
+	}
+
+	return &DNSResolver{cache: cache, resolver: resolver}
+}
+
+// Stats returns a copy of the counters recorded so far
+func (r *DNSResolver) Stats() DNSStats {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	stats := r.stats
+	stats.Queries = append([]time.Duration(nil), r.stats.Queries...)
+
+	return stats
+}
+
+// Lookup returns the addresses of host from the cache or, on a miss, from the resolver
+func (r *DNSResolver) Lookup(ctx context.Context, host string) ([]netip.Addr, error) {
+	if addrs, ok := r.cache.Get(host); ok {
+		r.mu.Lock()
+		r.stats.Hits++
+		r.mu.Unlock()
+
+		return addrs, nil
+	}
+
+	start := time.Now()
+	ips, err := r.resolver.LookupNetIP(ctx, "ip", host)
+	latency := time.Since(start)
+
+	r.mu.Lock()
+	r.stats.Misses++
+	r.stats.Queries = append(r.stats.Queries, latency)
+
+	if err != nil {
+		r.stats.Failures++
+	}
+
+	r.mu.Unlock()
+
+	if err != nil {
+		return nil, err
+	}
+
+	addrs := make([]netip.Addr, len(ips))
+
+	for i, ip := range ips {
+		addrs[i] = ip.Unmap()
+	}
+
+	r.cache.Put(host, addrs)
+
+	return addrs, nil
+}
+
+// lookupTraced resolves host like Lookup while reporting the lookup to the request's
+// ClientTrace, so the DNS phase of a sample is the layer's answer time
+func (r *DNSResolver) lookupTraced(ctx context.Context, host string) ([]netip.Addr, error) {
+	trace := httptrace.ContextClientTrace(ctx)
+
+	if trace != nil && trace.DNSStart != nil {
+		trace.DNSStart(httptrace.DNSStartInfo{Host: host})
+	}
+
+	addrs, err := r.Lookup(ctx, host)
+
+	if trace != nil && trace.DNSDone != nil {
+		info := httptrace.DNSDoneInfo{Err: err}
+
+		for _, addr := range addrs {
+			info.Addrs = append(info.Addrs, net.IPAddr{IP: addr.AsSlice(), Zone: addr.Zone()})
+		}
+
+		trace.DNSDone(info)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	if len(addrs) == 0 {
+		return nil, fmt.Errorf("no addresses found for %s", host)
+	}
+
+	return addrs, nil
+}
+
+// dialResolved resolves the host of addr through the layer and dials its addresses in turn,
+// returning the first connection; IP literals are dialed directly
+func (r *DNSResolver) dialResolved(ctx context.Context, network, addr string, dial func(context.Context, string, string) (net.Conn, error)) (net.Conn, error) {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := netip.ParseAddr(host); err == nil {
+		return dial(ctx, network, addr)
+	}
+
+	addrs, err := r.lookupTraced(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+
+	var errs []error
+
+	for _, ip := range addrs {
+		conn, err := dial(ctx, network, net.JoinHostPort(ip.String(), port))
+		if err == nil {
+			return conn, nil
+		}
+
+		errs = append(errs, err)
+
+		if ctx.Err() != nil {
+			break
+		}
+	}
+
+	return nil, errors.Join(errs...)
+}
@@ -0,0 +1,83 @@
+package probe
+
+import (
+	"context"
+	"net/http"
+)
+
+// requestHeaderKey carries headers for the requests made with a context
+type requestHeaderKey struct{}
+
+// WithRequestHeader returns a context whose traced requests carry header, taking precedence
+// over client-wide headers with the same name
+func WithRequestHeader(ctx context.Context, header http.Header) context.Context {
+	if len(header) == 0 {
+		return ctx
+	}
+
+	return context.WithValue(ctx, requestHeaderKey{}, header)
+}
+
+// contextHeader returns the headers carried by ctx, or nil
+func contextHeader(ctx context.Context) http.Header {
+	header, _ := ctx.Value(requestHeaderKey{}).(http.Header)
+
+	return header
+}
+
+// applyRequestHeader sets the headers carried by the request context
+func applyRequestHeader(req *http.Request) {
+	for name, values := range contextHeader(req.Context()) {
+		if name == "Host" {
+			req.Host = values[len(values)-1]
+
+			continue
+		}
+
+		req.Header[name] = values
+	}
+}
+
+// headerTransport adds fixed request headers before handing the request to the wrapped transport
+type headerTransport struct {
+	base   http.RoundTripper
+	header http.Header
+}
+
+// withHeader wraps base so every request carries header, returning base unchanged when header is empty
+func withHeader(base http.RoundTripper, header http.Header) http.RoundTripper {
+	if len(header) == 0 {
+		return base
+	}
+
+	return &headerTransport{base: base, header: header}
+}
+
+// RoundTrip sets the configured headers on a copy of the request, keeping any set per request
+func (t *headerTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+
+	for name, values := range t.header {
+		// Host is carried on the request rather than in its header map
+		if name == "Host" {
+			if _, ok := contextHeader(req.Context())["Host"]; !ok {
+				req.Host = values[len(values)-1]
+			}
+
+			continue
+		}
+
+		if _, ok := req.Header[name]; !ok {
+			req.Header[name] = values
+		}
+	}
+
+	return t.base.RoundTrip(req)
+}
+
+// CloseIdleConnections closes idle connections of the wrapped transport
+func (t *headerTransport) CloseIdleConnections() {
+	if closer, ok := t.base.(interface{ CloseIdleConnections() }); ok {
+		closer.CloseIdleConnections()
+	}
+}
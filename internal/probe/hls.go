@@ -1,6 +1,7 @@
 package probe
 
 import (
+	"bytes"
 	"context"
 	"errors"
 	"fmt"
@@ -8,6 +9,7 @@ import (
 	"net/http"
 	"net/url"
 	"strings"
+	"time"
 
 	"github.com/grafov/m3u8"
 )
@@ -23,59 +25,64 @@ type PlaylistResult struct {
 	Master *m3u8.MasterPlaylist
 	Media  *m3u8.MediaPlaylist
 	Trace  *Trace
+	Body   []byte
 }
 
-// FetchPlaylist fetches and parses an HLS playlist from the given URL
+// maxErrorBody caps how much of an error response is kept for inspection
+const maxErrorBody = 1 << 20
+
+// FetchPlaylist fetches and parses an HLS playlist from the given URL. A playlist that
+// answers with an error status or fails to parse is still returned, with its body and
+// trace, alongside the error.
 func FetchPlaylist(ctx context.Context, hlsURL string, client *http.Client) (*PlaylistResult, error) {
-	resp, trace, err := FetchWithTrace(ctx, hlsURL, client)
+	resp, trace, err := FetchWithTrace(WithCMCDObject(ctx, CMCDManifest), hlsURL, client)
 	if err != nil {
 		return nil, fmt.Errorf("failed to fetch playlist: %w", err)
 	}
-	defer resp.Body.Close()
-
-	// Check for HTTP errors
-	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("playlist fetch returned status %d", resp.StatusCode)
-	}
-
-	playlist, listType, err := m3u8.DecodeFrom(resp.Body, true)
-	if err != nil {
-		return nil, fmt.Errorf("failed to parse playlist: %w", err)
-	}
-
-	result := &PlaylistResult{Trace: trace}
 
-	switch listType {
-	case m3u8.MASTER:
-		result.Master = playlist.(*m3u8.MasterPlaylist)
-	case m3u8.MEDIA:
-		result.Media = playlist.(*m3u8.MediaPlaylist)
-	default:
-		return nil, ErrInvalidPlaylist
-	}
-
-	return result, nil
+	return decodePlaylist(resp, trace)
 }
 
-// FetchPlaylistHTTP3 fetches and parses an HLS playlist using HTTP/3
+// FetchPlaylistHTTP3 fetches and parses an HLS playlist using HTTP/3, returning failed
+// playlists alongside the error like FetchPlaylist
 func FetchPlaylistHTTP3(ctx context.Context, hlsURL string, client *http.Client) (*PlaylistResult, error) {
-	resp, trace, err := FetchWithTraceHTTP3(ctx, hlsURL, client)
+	resp, trace, err := FetchWithTraceHTTP3(WithCMCDObject(ctx, CMCDManifest), hlsURL, client)
 	if err != nil {
 		return nil, fmt.Errorf("failed to fetch playlist: %w", err)
 	}
+
+	return decodePlaylist(resp, trace)
+}
+
+// decodePlaylist reads and parses a playlist response body
+func decodePlaylist(resp *http.Response, trace *Trace) (*PlaylistResult, error) {
 	defer resp.Body.Close()
 
-	// Check for HTTP errors
+	// Error responses are kept so their body can be inspected
 	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("playlist fetch returned status %d", resp.StatusCode)
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, maxErrorBody))
+		trace.Bytes = int64(len(body))
+
+		return &PlaylistResult{Trace: trace, Body: body}, fmt.Errorf("playlist fetch returned status %d", resp.StatusCode)
 	}
 
-	playlist, listType, err := m3u8.DecodeFrom(resp.Body, true)
+	readStart := time.Now()
+
+	body, err := io.ReadAll(resp.Body)
 	if err != nil {
-		return nil, fmt.Errorf("failed to parse playlist: %w", err)
+		return &PlaylistResult{Trace: trace, Body: body}, fmt.Errorf("failed to read playlist: %w", err)
 	}
 
-	result := &PlaylistResult{Trace: trace}
+	// Total ends with the response headers; the download runs to the last byte of the body
+	trace.Bytes = int64(len(body))
+	trace.Download = trace.Total + time.Since(readStart)
+
+	result := &PlaylistResult{Trace: trace, Body: body}
+
+	playlist, listType, err := m3u8.Decode(*bytes.NewBuffer(body), true)
+	if err != nil {
+		return result, fmt.Errorf("failed to parse playlist: %w", err)
+	}
 
 	switch listType {
 	case m3u8.MASTER:
@@ -83,7 +90,7 @@ func FetchPlaylistHTTP3(ctx context.Context, hlsURL string, client *http.Client)
 	case m3u8.MEDIA:
 		result.Media = playlist.(*m3u8.MediaPlaylist)
 	default:
-		return nil, ErrInvalidPlaylist
+		return result, ErrInvalidPlaylist
 	}
 
 	return result, nil
@@ -91,13 +98,9 @@ func FetchPlaylistHTTP3(ctx context.Context, hlsURL string, client *http.Client)
 
 // GetFirstVariantURL extracts the URL of the first variant from a master playlist
 func GetFirstVariantURL(master *m3u8.MasterPlaylist, baseURL string) (string, error) {
-	if master == nil || len(master.Variants) == 0 {
-		return "", ErrNoVariants
-	}
-
-	variantURI := master.Variants[0].URI
+	variantURL, _, err := SelectVariant(master, baseURL, FirstVariant())
 
-	return resolveURL(baseURL, variantURI)
+	return variantURL, err
 }
 
 // GetFirstSegmentURL extracts the URL of the first segment from a media playlist
@@ -109,29 +112,156 @@ func GetFirstSegmentURL(media *m3u8.MediaPlaylist, baseURL string) (string, erro
 	// Find the first non-nil segment
 	for _, seg := range media.Segments {
 		if seg != nil && seg.URI != "" {
-			return resolveURL(baseURL, seg.URI)
+			return ResolveURL(baseURL, seg.URI)
 		}
 	}
 
 	return "", ErrNoSegments
 }
 
-// DownloadSegment downloads a segment and returns the body as bytes
+// MediaFrom returns a view of a media playlist that starts at its index-th segment (counting
+// from zero), carrying the media sequence number, EXT-X-KEY, and EXT-X-MAP in force for that
+// segment, so code that measures the first segment of a playlist measures that one instead
+func MediaFrom(media *m3u8.MediaPlaylist, index int) (*m3u8.MediaPlaylist, error) {
+	if media == nil {
+		return nil, ErrNoSegments
+	}
+
+	view := *media
+	seen := 0
+
+	for i, seg := range media.Segments {
+		if seg == nil || seg.URI == "" {
+			continue
+		}
+
+		if seg.Map != nil {
+			view.Map = seg.Map
+		}
+
+		if seen == index {
+			view.Segments = media.Segments[i:]
+			view.SeqNo = media.SeqNo + uint64(i)
+
+			return &view, nil
+		}
+
+		// The key of the segment itself is found by FirstSegmentKey; earlier ones carry over
+		if seg.Key != nil {
+			view.Key = seg.Key
+		}
+
+		seen++
+	}
+
+	return nil, fmt.Errorf("%w at index %d (it has %d)", ErrNoSegments, index, seen)
+}
+
+// LiveEdge is where a player joining a live playlist starts: the position of the segment,
+// how many segments from it to the end of the playlist, and how much media that is
+type LiveEdge struct {
+	Index    int
+	Segments int
+	Distance time.Duration
+}
+
+// LiveStart picks the segment a player joining a live playlist starts at. An EXT-X-START
+// offset decides when the playlist has one; otherwise it is the last segment that starts at
+// least holdBack from the end of the playlist (RFC 8216 section 6.3.3 asks for three target
+// durations), or the first segment when the playlist is shorter than that.
+func LiveStart(media *m3u8.MediaPlaylist, holdBack time.Duration) (LiveEdge, error) {
+	if media == nil {
+		return LiveEdge{}, ErrNoSegments
+	}
+
+	var durations []time.Duration
+
+	for _, seg := range media.Segments {
+		if seg != nil && seg.URI != "" {
+			durations = append(durations, time.Duration(seg.Duration*float64(time.Second)))
+		}
+	}
+
+	if len(durations) == 0 {
+		return LiveEdge{}, ErrNoSegments
+	}
+
+	var total time.Duration
+
+	for _, d := range durations {
+		total += d
+	}
+
+	// The latest point a player may start from, measured from the start of the playlist
+	latest := total - holdBack
+
+	if media.StartTime != 0 {
+		offset := time.Duration(media.StartTime * float64(time.Second))
+
+		if offset < 0 {
+			offset += total
+		}
+
+		latest = min(max(offset, 0), total)
+	}
+
+	// A playlist shorter than the hold-back starts at its first segment
+	edge := LiveEdge{Distance: total}
+
+	var start time.Duration
+
+	for i, d := range durations {
+		if start > latest {
+			break
+		}
+
+		edge.Index = i
+		edge.Distance = total - start
+		start += d
+	}
+
+	edge.Segments = len(durations) - edge.Index
+
+	return edge, nil
+}
+
+// DownloadSegment downloads a segment and returns the body as bytes; error responses are
+// returned with their body and trace alongside the error
 func DownloadSegment(ctx context.Context, segmentURL string, client *http.Client) ([]byte, *Trace, error) {
+	start := time.Now()
+
 	resp, trace, err := FetchWithTrace(ctx, segmentURL, client)
 	if err != nil {
 		return nil, nil, fmt.Errorf("failed to download segment: %w", err)
 	}
 	defer resp.Body.Close()
 
-	// Check for HTTP errors
+	// Error responses are returned with their body and trace for inspection
 	if resp.StatusCode != http.StatusOK {
-		return nil, nil, fmt.Errorf("segment download returned status %d", resp.StatusCode)
+		data, _ := io.ReadAll(io.LimitReader(resp.Body, maxErrorBody))
+		trace.Total = time.Since(start)
+		trace.Bytes = int64(len(data))
+
+		return data, trace, fmt.Errorf("segment download returned status %d", resp.StatusCode)
 	}
 
-	data, err := io.ReadAll(resp.Body)
+	body := newProgressReader(resp.Body, start)
+
+	// Partial data is returned alongside read errors for inspection
+	data, err := io.ReadAll(body)
 	if err != nil {
-		return nil, nil, fmt.Errorf("failed to read segment data: %w", err)
+		return data, trace, fmt.Errorf("failed to read segment data: %w", err)
+	}
+
+	// The download ends with the last byte of the body, not the response headers
+	trace.Total = time.Since(start)
+	trace.Bytes = int64(len(data))
+	trace.Download = trace.Total
+	trace.Progress = body.progress()
+
+	// CMAF chunks streamed without a Content-Length are timed as the origin produced them
+	if streamedBody(resp) {
+		trace.Chunks = body.chunkTiming(data)
 	}
 
 	return data, trace, nil
@@ -139,44 +269,73 @@ func DownloadSegment(ctx context.Context, segmentURL string, client *http.Client
 
 // DownloadSegmentHTTP3 downloads a segment using HTTP/3 and returns the body as bytes
 func DownloadSegmentHTTP3(ctx context.Context, segmentURL string, client *http.Client) ([]byte, *Trace, error) {
+	start := time.Now()
+
 	resp, trace, err := FetchWithTraceHTTP3(ctx, segmentURL, client)
 	if err != nil {
 		return nil, nil, fmt.Errorf("failed to download segment: %w", err)
 	}
 	defer resp.Body.Close()
 
-	// Check for HTTP errors
+	// Error responses are returned with their body and trace for inspection
 	if resp.StatusCode != http.StatusOK {
-		return nil, nil, fmt.Errorf("segment download returned status %d", resp.StatusCode)
+		data, _ := io.ReadAll(io.LimitReader(resp.Body, maxErrorBody))
+		trace.Total = time.Since(start)
+		trace.Bytes = int64(len(data))
+
+		return data, trace, fmt.Errorf("segment download returned status %d", resp.StatusCode)
 	}
 
-	data, err := io.ReadAll(resp.Body)
+	body := newProgressReader(resp.Body, start)
+
+	// Partial data is returned alongside read errors for inspection
+	data, err := io.ReadAll(body)
 	if err != nil {
-		return nil, nil, fmt.Errorf("failed to read segment data: %w", err)
+		return data, trace, fmt.Errorf("failed to read segment data: %w", err)
+	}
+
+	// The download ends with the last byte of the body, not the response headers
+	trace.Total = time.Since(start)
+	trace.Bytes = int64(len(data))
+	trace.Download = trace.Total
+	trace.Progress = body.progress()
+
+	// CMAF chunks streamed without a Content-Length are timed as the origin produced them
+	if streamedBody(resp) {
+		trace.Chunks = body.chunkTiming(data)
 	}
 
 	return data, trace, nil
 }
 
-// resolveURL resolves a potentially relative URL against a base URL
-func resolveURL(baseURL, ref string) (string, error) {
-	// Check if ref is already absolute
-	if strings.HasPrefix(ref, "http://") || strings.HasPrefix(ref, "https://") {
-		return ref, nil
+// ResolveURL resolves a potentially relative URL against a base URL
+func ResolveURL(baseURL, ref string) (string, error) {
+	refURL, err := url.Parse(ref)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse reference URL: %w", err)
 	}
 
-	base, err := url.Parse(baseURL)
-	if err != nil {
-		return "", fmt.Errorf("failed to parse base URL: %w", err)
+	// Absolute references only need their host normalized
+	if refURL.IsAbs() {
+		if err := normalizeHost(refURL); err != nil {
+			return "", err
+		}
+
+		return refURL.String(), nil
 	}
 
-	refURL, err := url.Parse(ref)
+	base, err := url.Parse(baseURL)
 	if err != nil {
-		return "", fmt.Errorf("failed to parse reference URL: %w", err)
+		return "", fmt.Errorf("failed to parse base URL: %w", err)
 	}
 
 	resolved := base.ResolveReference(refURL)
 
+	// Protocol-relative references may introduce a new host
+	if err := normalizeHost(resolved); err != nil {
+		return "", err
+	}
+
 	return resolved.String(), nil
 }
 
@@ -187,11 +346,22 @@ func GetBaseURL(fullURL string) (string, error) {
 		return "", fmt.Errorf("failed to parse URL: %w", err)
 	}
 
-	// Remove the last path component (the filename)
-	lastSlash := strings.LastIndex(parsed.Path, "/")
+	// Remove the last path component (the filename), keeping any escaping intact
+	escaped := parsed.EscapedPath()
+
+	lastSlash := strings.LastIndex(escaped, "/")
 	if lastSlash >= 0 {
-		parsed.Path = parsed.Path[:lastSlash+1]
+		escaped = escaped[:lastSlash+1]
+	}
+
+	parsed.Path, err = url.PathUnescape(escaped)
+	if err != nil {
+		return "", fmt.Errorf("failed to unescape path: %w", err)
 	}
 
+	parsed.RawPath = escaped
+	parsed.RawQuery = ""
+	parsed.Fragment = ""
+
 	return parsed.String(), nil
 }
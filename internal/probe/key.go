@@ -0,0 +1,61 @@
+package probe
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+// FetchKey downloads an EXT-X-KEY payload and returns it with timing metrics
+func FetchKey(ctx context.Context, keyURL string, client *http.Client) ([]byte, *Trace, error) {
+	start := time.Now()
+
+	resp, trace, err := FetchWithTrace(WithCMCDObject(ctx, CMCDKey), keyURL, client)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to fetch key: %w", err)
+	}
+	defer resp.Body.Close()
+
+	// Check for HTTP errors
+	if resp.StatusCode != http.StatusOK {
+		return nil, trace, fmt.Errorf("key fetch returned status %d", resp.StatusCode)
+	}
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, trace, fmt.Errorf("failed to read key: %w", err)
+	}
+
+	// Include the body read in the total
+	trace.Total = time.Since(start)
+
+	return data, trace, nil
+}
+
+// FetchKeyHTTP3 downloads an EXT-X-KEY payload over HTTP/3 and returns it with timing metrics
+func FetchKeyHTTP3(ctx context.Context, keyURL string, client *http.Client) ([]byte, *Trace, error) {
+	start := time.Now()
+
+	resp, trace, err := FetchWithTraceHTTP3(WithCMCDObject(ctx, CMCDKey), keyURL, client)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to fetch key: %w", err)
+	}
+	defer resp.Body.Close()
+
+	// Check for HTTP errors
+	if resp.StatusCode != http.StatusOK {
+		return nil, trace, fmt.Errorf("key fetch returned status %d", resp.StatusCode)
+	}
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, trace, fmt.Errorf("failed to read key: %w", err)
+	}
+
+	// Include the body read in the total
+	trace.Total = time.Since(start)
+
+	return data, trace, nil
+}
@@ -0,0 +1,54 @@
+package probe
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+// LicenseResult holds the outcome of a DRM license request
+type LicenseResult struct {
+	Trace        *Trace
+	StatusCode   int
+	ResponseSize int
+}
+
+// RequestLicense POSTs a license challenge and returns timing including the response body
+func RequestLicense(ctx context.Context, licenseURL, contentType string, challenge []byte, client *http.Client) (*LicenseResult, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, licenseURL, bytes.NewReader(challenge))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create license request: %w", err)
+	}
+
+	req.Header.Set("Content-Type", contentType)
+
+	start := time.Now()
+
+	resp, trace, err := DoWithTrace(req, client)
+	if err != nil {
+		return nil, fmt.Errorf("failed to request license: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read license response: %w", err)
+	}
+
+	// Total covers the complete license response, not just the headers
+	trace.Total = time.Since(start)
+
+	// Check for HTTP errors
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("license request returned status %d", resp.StatusCode)
+	}
+
+	return &LicenseResult{
+		Trace:        trace,
+		StatusCode:   resp.StatusCode,
+		ResponseSize: len(body),
+	}, nil
+}
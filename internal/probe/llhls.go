@@ -0,0 +1,176 @@
+package probe
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+var ErrNoParts = errors.New("media playlist has no EXT-X-PART tags (not a Low-Latency HLS stream)")
+
+// Part is a single EXT-X-PART partial segment
+type Part struct {
+	URI         string
+	Duration    float64
+	Independent bool
+	MSN         uint64
+	Index       int
+}
+
+// LowLatencyInfo holds the Low-Latency HLS tags of a media playlist
+type LowLatencyInfo struct {
+	CanBlockReload bool
+	HoldBack       float64
+	PartTarget     float64
+	Parts          []Part
+	PreloadHint    string
+}
+
+// ParseLowLatency extracts EXT-X-PART, EXT-X-PRELOAD-HINT, and server control tags
+// from a media playlist body, numbering parts by media sequence and position
+func ParseLowLatency(body []byte) (*LowLatencyInfo, error) {
+	info := &LowLatencyInfo{}
+
+	var (
+		msn       uint64
+		partIndex int
+	)
+
+	scanner := bufio.NewScanner(bytes.NewReader(body))
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+
+		tag, value, _ := strings.Cut(line, ":")
+
+		switch {
+		case tag == "#EXT-X-MEDIA-SEQUENCE":
+			n, err := strconv.ParseUint(value, 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("%w: bad media sequence %q", ErrInvalidPlaylist, value)
+			}
+
+			msn = n
+		case tag == "#EXT-X-SERVER-CONTROL":
+			attrs := parseAttributes(value)
+
+			info.CanBlockReload = attrs["CAN-BLOCK-RELOAD"] == "YES"
+			info.HoldBack, _ = strconv.ParseFloat(attrs["HOLD-BACK"], 64)
+		case tag == "#EXT-X-PART-INF":
+			info.PartTarget, _ = strconv.ParseFloat(parseAttributes(value)["PART-TARGET"], 64)
+		case tag == "#EXT-X-PART":
+			attrs := parseAttributes(value)
+
+			if attrs["URI"] == "" {
+				return nil, fmt.Errorf("%w: EXT-X-PART without URI", ErrInvalidPlaylist)
+			}
+
+			duration, _ := strconv.ParseFloat(attrs["DURATION"], 64)
+
+			info.Parts = append(info.Parts, Part{
+				URI:         attrs["URI"],
+				Duration:    duration,
+				Independent: attrs["INDEPENDENT"] == "YES",
+				MSN:         msn,
+				Index:       partIndex,
+			})
+
+			partIndex++
+		case tag == "#EXT-X-PRELOAD-HINT":
+			attrs := parseAttributes(value)
+
+			if attrs["TYPE"] == "PART" {
+				info.PreloadHint = attrs["URI"]
+			}
+		case line != "" && !strings.HasPrefix(line, "#"):
+			// A segment URI completes the current media sequence number
+			msn++
+			partIndex = 0
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read playlist: %w", err)
+	}
+
+	return info, nil
+}
+
+// LatestIndependentPart returns the newest part a player can start decoding from
+func (info *LowLatencyInfo) LatestIndependentPart() (Part, error) {
+	if len(info.Parts) == 0 {
+		return Part{}, ErrNoParts
+	}
+
+	for i := len(info.Parts) - 1; i >= 0; i-- {
+		if info.Parts[i].Independent {
+			return info.Parts[i], nil
+		}
+	}
+
+	// Without INDEPENDENT attributes every part is assumed to start with a keyframe
+	return info.Parts[len(info.Parts)-1], nil
+}
+
+// NextPart returns the media sequence number and part index following the last listed part
+func (info *LowLatencyInfo) NextPart() (uint64, int, error) {
+	if len(info.Parts) == 0 {
+		return 0, 0, ErrNoParts
+	}
+
+	last := info.Parts[len(info.Parts)-1]
+
+	return last.MSN, last.Index + 1, nil
+}
+
+// BlockingReloadURL adds the _HLS_msn and _HLS_part delivery directives to a media playlist URL
+func BlockingReloadURL(mediaURL string, msn uint64, part int) (string, error) {
+	parsed, err := url.Parse(mediaURL)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse media playlist URL: %w", err)
+	}
+
+	query := parsed.Query()
+	query.Set("_HLS_msn", strconv.FormatUint(msn, 10))
+	query.Set("_HLS_part", strconv.Itoa(part))
+
+	parsed.RawQuery = query.Encode()
+
+	return parsed.String(), nil
+}
+
+// parseAttributes splits an HLS attribute list, unquoting quoted-string values
+func parseAttributes(list string) map[string]string {
+	attrs := make(map[string]string)
+
+	for list != "" {
+		name, rest, found := strings.Cut(list, "=")
+		if !found {
+			break
+		}
+
+		var value string
+
+		if strings.HasPrefix(rest, `"`) {
+			end := strings.Index(rest[1:], `"`)
+			if end < 0 {
+				value, rest = rest[1:], ""
+			} else {
+				value, rest = rest[1:end+1], rest[end+2:]
+			}
+		} else {
+			value, rest, _ = strings.Cut(rest, ",")
+			rest = "," + rest
+		}
+
+		attrs[strings.TrimSpace(name)] = value
+		list = strings.TrimPrefix(rest, ",")
+	}
+
+	return attrs
+}
@@ -0,0 +1,30 @@
+package probe
+
+import "crypto/tls"
+
+// TLSInfo describes the TLS parameters of the connection that served a request, whether it
+// was dialed for the request or reused from the pool
+type TLSInfo struct {
+	Version     uint16
+	CipherSuite uint16
+	ALPN        string
+}
+
+// newTLSInfo extracts the negotiated parameters of a TLS connection
+func newTLSInfo(state tls.ConnectionState) *TLSInfo {
+	return &TLSInfo{
+		Version:     state.Version,
+		CipherSuite: state.CipherSuite,
+		ALPN:        state.NegotiatedProtocol,
+	}
+}
+
+// VersionName names the negotiated TLS version (e.g., "TLS 1.3")
+func (t *TLSInfo) VersionName() string {
+	return tls.VersionName(t.Version)
+}
+
+// CipherSuiteName names the negotiated cipher suite (e.g., "TLS_AES_128_GCM_SHA256")
+func (t *TLSInfo) CipherSuiteName() string {
+	return tls.CipherSuiteName(t.CipherSuite)
+}
@@ -0,0 +1,92 @@
+package probe
+
+import (
+	"context"
+	"net/http"
+)
+
+// RequestInfo is a request as it went out, after the client added its configured headers
+// and CMCD data
+type RequestInfo struct {
+	Method string
+	URL    string
+	Header http.Header
+}
+
+// traceObserverKey carries the function told about every traced request made with a context
+type traceObserverKey struct{}
+
+// WithTraceObserver returns a context whose traced requests, redirect hops included, are
+// passed to observe once their response headers arrived. The fetch keeps filling in the
+// trace (Bytes, Download, Progress) while it reads the body, so observers that need those
+// should read the trace after the measurement finished.
+func WithTraceObserver(ctx context.Context, observe func(*Trace)) context.Context {
+	return context.WithValue(ctx, traceObserverKey{}, observe)
+}
+
+// observeTrace passes a trace to the observer of its request context, if any
+func observeTrace(ctx context.Context, trace *Trace) {
+	if observe, ok := ctx.Value(traceObserverKey{}).(func(*Trace)); ok {
+		observe(trace)
+	}
+}
+
+// sentRequestKey carries the slot for the request a traced request went out as
+type sentRequestKey struct{}
+
+// withSentRequestSlot returns a context that records the request as the transport sent it
+func withSentRequestSlot(ctx context.Context) (context.Context, *RequestInfo) {
+	slot := new(RequestInfo)
+
+	return context.WithValue(ctx, sentRequestKey{}, slot), slot
+}
+
+// sentRequest returns the request recorded in the slot, or the request itself when the
+// client's transport does not record it
+func sentRequest(slot *RequestInfo, req *http.Request) *RequestInfo {
+	if slot.Method == "" {
+		recordRequest(slot, req)
+	}
+
+	return slot
+}
+
+// recordRequest copies the method, URL, and headers of req into slot; the Host of the
+// request is listed as a header, as it is sent
+func recordRequest(slot *RequestInfo, req *http.Request) {
+	slot.Method = req.Method
+	slot.URL = req.URL.String()
+	slot.Header = req.Header.Clone()
+
+	if slot.Header == nil {
+		slot.Header = make(http.Header)
+	}
+
+	host := req.Host
+
+	if host == "" {
+		host = req.URL.Host
+	}
+
+	slot.Header.Set("Host", host)
+}
+
+// sentRequestTransport records each request in the slot of its context as it reaches the
+// connection, so headers added by the wrapping transports are included
+type sentRequestTransport struct {
+	base http.RoundTripper
+}
+
+// withSentRequest wraps the transport closest to the connection
+func withSentRequest(base http.RoundTripper) http.RoundTripper {
+	return &sentRequestTransport{base: base}
+}
+
+// RoundTrip records the request and passes it on unchanged
+func (t *sentRequestTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if slot, ok := req.Context().Value(sentRequestKey{}).(*RequestInfo); ok {
+		recordRequest(slot, req)
+	}
+
+	return t.base.RoundTrip(req)
+}
@@ -0,0 +1,137 @@
+package probe
+
+import (
+	"context"
+	"os"
+	"sync"
+
+	"github.com/quic-go/quic-go"
+	"github.com/quic-go/quic-go/qlog"
+	"github.com/quic-go/quic-go/qlogwriter"
+)
+
+// quic-go reads these when it opens a UDP socket, so they apply process-wide
+const (
+	disableGSOEnv = "QUIC_GO_DISABLE_GSO"
+	disableECNEnv = "QUIC_GO_DISABLE_ECN"
+)
+
+// QUICOffload describes the UDP offloads in use on a QUIC connection
+type QUICOffload struct {
+	GSO bool   // generic segmentation offload used for sending
+	ECN string // ECN validation state: testing, unknown, capable, or failed; empty when ECN is off
+}
+
+// DisableQUICOffloads turns off GSO and/or ECN for QUIC sockets opened afterwards
+func DisableQUICOffloads(gso, ecn bool) error {
+	if gso {
+		if err := os.Setenv(disableGSOEnv, "true"); err != nil {
+			return err
+		}
+	}
+
+	if ecn {
+		if err := os.Setenv(disableECNEnv, "true"); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// quicConnKey carries the slot for the QUIC connection dialed for a traced request
+type quicConnKey struct{}
+
+// quicConnSlot holds a dialed QUIC connection and the latest ECN state reported for it
+type quicConnSlot struct {
+	mu   sync.Mutex
+	conn *quic.Conn
+	ecn  string
+}
+
+// withQUICConnSlot returns a context that records the QUIC connection dialed for it
+func withQUICConnSlot(ctx context.Context) (context.Context, *quicConnSlot) {
+	slot := &quicConnSlot{}
+
+	return context.WithValue(ctx, quicConnKey{}, slot), slot
+}
+
+// recordQUICConn stores the QUIC connection dialed for a traced request
+func recordQUICConn(ctx context.Context, conn *quic.Conn) {
+	if slot, ok := ctx.Value(quicConnKey{}).(*quicConnSlot); ok {
+		slot.mu.Lock()
+		slot.conn = conn
+		slot.mu.Unlock()
+	}
+}
+
+// dialed reports whether a connection was dialed for the request
+func (s *quicConnSlot) dialed() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.conn != nil
+}
+
+// usedEarlyData reports whether the dialed connection sent 0-RTT data the server accepted
+func (s *quicConnSlot) usedEarlyData() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.conn != nil && s.conn.ConnectionState().Used0RTT
+}
+
+// QUICOffload reports the offloads of the QUIC connection dialed for the request. It is read
+// at call time, so ECN validation completed by later requests on the connection is included
+func (t *Trace) QUICOffload() (QUICOffload, bool) {
+	if t == nil || t.quic == nil {
+		return QUICOffload{}, false
+	}
+
+	t.quic.mu.Lock()
+	defer t.quic.mu.Unlock()
+
+	return QUICOffload{GSO: t.quic.conn.ConnectionState().GSO, ECN: t.quic.ecn}, true
+}
+
+// ecnTracer is a quic.Config Tracer that keeps only ECN state changes, for the dialing request
+func ecnTracer(ctx context.Context, _ bool, _ quic.ConnectionID) qlogwriter.Trace {
+	slot, ok := ctx.Value(quicConnKey{}).(*quicConnSlot)
+	if !ok {
+		return nil
+	}
+
+	return ecnRecorder{slot: slot}
+}
+
+// ecnRecorder implements qlogwriter.Trace and Recorder, dropping every event but ECN updates
+type ecnRecorder struct {
+	slot *quicConnSlot
+}
+
+// AddProducer returns the recorder itself
+func (r ecnRecorder) AddProducer() qlogwriter.Recorder {
+	return r
+}
+
+// SupportsSchemas declines every schema so HTTP/3 skips its own qlog events
+func (r ecnRecorder) SupportsSchemas(string) bool {
+	return false
+}
+
+// RecordEvent stores ECN state transitions
+func (r ecnRecorder) RecordEvent(ev qlogwriter.Event) {
+	update, ok := ev.(qlog.ECNStateUpdated)
+	if !ok {
+		return
+	}
+
+	r.slot.mu.Lock()
+	r.slot.ecn = string(update.State)
+	r.slot.mu.Unlock()
+}
+
+// Close is a no-op; there is nothing to flush
+func (r ecnRecorder) Close() error {
+	return nil
+}
@@ -0,0 +1,108 @@
+package probe
+
+import (
+	"io"
+	"time"
+)
+
+// ProgressPercents are the shares of the body whose arrival Progress.Milestones record
+var ProgressPercents = [4]int{25, 50, 75, 100}
+
+// Progress records when the body of a segment arrived, measured from sending the request
+// like Trace.Total, so CDN pacing and stalls mid-transfer show up where Total alone hides them
+type Progress struct {
+	// FirstByte is when the first byte of the body was read; the last milestone is the last byte
+	FirstByte  time.Duration
+	Milestones [len(ProgressPercents)]time.Duration
+
+	// LongestStall is the longest wait between two reads of the body after its first byte
+	LongestStall time.Duration
+}
+
+// LastByte returns when the last byte of the body was read
+func (p *Progress) LastByte() time.Duration {
+	return p.Milestones[len(p.Milestones)-1]
+}
+
+// progressReader counts the bytes read from a body and notes when each read returned
+type progressReader struct {
+	r     io.Reader
+	start time.Time
+	total int64
+	reads []progressRead
+}
+
+// progressRead is the body size read so far and when the read that completed it returned
+type progressRead struct {
+	bytes int64
+	at    time.Duration
+}
+
+// newProgressReader wraps a body whose request was sent at start
+func newProgressReader(r io.Reader, start time.Time) *progressReader {
+	return &progressReader{r: r, start: start}
+}
+
+// Read reads from the body and records the arrival of any bytes it returns
+func (p *progressReader) Read(b []byte) (int, error) {
+	n, err := p.r.Read(b)
+
+	if n > 0 {
+		p.total += int64(n)
+		p.reads = append(p.reads, progressRead{bytes: p.total, at: time.Since(p.start)})
+	}
+
+	return n, err
+}
+
+// progress derives the milestones once the whole body was read; the share of the body is
+// only known at the end, since a chunked response announces no length
+func (p *progressReader) progress() *Progress {
+	if len(p.reads) == 0 {
+		return nil
+	}
+
+	progress := &Progress{FirstByte: p.reads[0].at}
+	next := 0
+
+	for i, read := range p.reads {
+		if i > 0 {
+			progress.LongestStall = max(progress.LongestStall, read.at-p.reads[i-1].at)
+		}
+
+		for next < len(ProgressPercents) && read.bytes*100 >= p.total*int64(ProgressPercents[next]) {
+			progress.Milestones[next] = read.at
+			next++
+		}
+	}
+
+	return progress
+}
+
+// chunkTiming times the CMAF chunks of a completely read body by the read that delivered
+// the last byte of each; nil when the body holds no chunks
+func (p *progressReader) chunkTiming(data []byte) *ChunkTiming {
+	ends := chunkEnds(data)
+	if len(ends) == 0 || len(p.reads) == 0 {
+		return nil
+	}
+
+	timing := &ChunkTiming{
+		Complete: p.reads[len(p.reads)-1].at,
+		Chunks:   len(ends),
+		Chunked:  true,
+	}
+
+	next := 0
+
+	for _, read := range p.reads {
+		for next < len(ends) && read.bytes >= int64(ends[next]) {
+			timing.Arrivals = append(timing.Arrivals, read.at)
+			next++
+		}
+	}
+
+	timing.FirstChunk = timing.Arrivals[0]
+
+	return timing
+}
@@ -0,0 +1,85 @@
+package probe
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+// maxRedirects matches the limit http.Client applies when it follows redirects itself
+const maxRedirects = 10
+
+// Redirect is one hop of a redirect chain and the timing of its request
+type Redirect struct {
+	URL        string
+	StatusCode int
+	Location   string
+	Trace      *Trace
+}
+
+// followRedirects fetches target with do, following redirects one request at a time so each
+// hop is traced on its own. The returned trace times the final request, except that Total
+// also covers the redirect hops.
+func followRedirects(ctx context.Context, target string, client *http.Client, do func(*http.Request, *http.Client) (*http.Response, *Trace, error)) (*http.Response, *Trace, error) {
+	single := *client
+	single.CheckRedirect = func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}
+
+	var (
+		hops    []Redirect
+		elapsed time.Duration
+	)
+
+	for {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		resp, trace, err := do(req, &single)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		location := resp.Header.Get("Location")
+
+		if !isRedirect(resp.StatusCode) || location == "" {
+			trace.Redirects = hops
+			trace.RedirectTime = elapsed
+			trace.Total += elapsed
+
+			return resp, trace, nil
+		}
+
+		next, err := resp.Request.URL.Parse(location)
+
+		// Drain the redirect body so the connection can carry the next hop
+		_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+		resp.Body.Close()
+
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid redirect location %q: %w", location, err)
+		}
+
+		if len(hops) == maxRedirects {
+			return nil, nil, fmt.Errorf("stopped after %d redirects", maxRedirects)
+		}
+
+		hops = append(hops, Redirect{URL: target, StatusCode: resp.StatusCode, Location: next.String(), Trace: trace})
+		elapsed += trace.Total
+		target = next.String()
+	}
+}
+
+// isRedirect reports whether a status code asks the client to fetch another URL
+func isRedirect(status int) bool {
+	switch status {
+	case http.StatusMovedPermanently, http.StatusFound, http.StatusSeeOther, http.StatusTemporaryRedirect, http.StatusPermanentRedirect:
+		return true
+	}
+
+	return false
+}
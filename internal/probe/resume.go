@@ -0,0 +1,57 @@
+package probe
+
+import (
+	"crypto/tls"
+	"net/http"
+
+	"github.com/quic-go/quic-go/http3"
+)
+
+// Handshake describes the TLS handshake of a connection dialed for a request
+type Handshake struct {
+	Version     uint16
+	CipherSuite uint16
+	ALPN        string
+
+	// Resumed is set when the connection resumed a cached session instead of running a full
+	// handshake, and EarlyData when an HTTP/3 request went out as QUIC 0-RTT data
+	Resumed   bool
+	EarlyData bool
+}
+
+// newHandshake extracts the handshake details of a completed TLS connection
+func newHandshake(state tls.ConnectionState) *Handshake {
+	return &Handshake{
+		Version:     state.Version,
+		CipherSuite: state.CipherSuite,
+		ALPN:        state.NegotiatedProtocol,
+		Resumed:     state.DidResume,
+	}
+}
+
+// VersionName names the negotiated TLS version (e.g., "TLS 1.3")
+func (h *Handshake) VersionName() string {
+	return tls.VersionName(h.Version)
+}
+
+// earlyDataTransport sends GET and HEAD requests as HTTP/3 0-RTT requests, which go out
+// with the first flight when the connection resumes a session that allows early data
+type earlyDataTransport struct {
+	http.RoundTripper
+}
+
+// RoundTrip rewrites idempotent methods to their 0-RTT forms on a copy of the request
+func (t earlyDataTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	early := *req
+
+	switch req.Method {
+	case http.MethodGet, "":
+		early.Method = http3.MethodGet0RTT
+	case http.MethodHead:
+		early.Method = http3.MethodHead0RTT
+	default:
+		return t.RoundTripper.RoundTrip(req)
+	}
+
+	return t.RoundTripper.RoundTrip(&early)
+}
@@ -0,0 +1,212 @@
+package probe
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/netip"
+	"os"
+	"sync"
+	"sync/atomic"
+	"syscall"
+
+	"github.com/quic-go/quic-go"
+)
+
+// receiveBufferKey carries the slot for the effective receive buffer of a traced request
+type receiveBufferKey struct{}
+
+// withReceiveBufferSlot returns a context that records the receive buffer of sockets dialed for it
+func withReceiveBufferSlot(ctx context.Context) (context.Context, *atomic.Int64) {
+	slot := new(atomic.Int64)
+
+	return context.WithValue(ctx, receiveBufferKey{}, slot), slot
+}
+
+// recordReceiveBuffer stores the effective receive buffer of a socket dialed for a traced request
+func recordReceiveBuffer(ctx context.Context, size int) {
+	if slot, ok := ctx.Value(receiveBufferKey{}).(*atomic.Int64); ok {
+		slot.Store(int64(size))
+	}
+}
+
+// QUICReceiveBuffer is the UDP receive buffer quic-go asks for; smaller buffers drop packets
+// at high bitrates and slow HTTP/3 transfers down
+const QUICReceiveBuffer = 7 << 20
+
+// quic-go logs a warning on stderr when the OS caps the buffer it asks for. The effective
+// size is recorded on every HTTP/3 trace instead, so callers report it with their results.
+const disableBufferWarningEnv = "QUIC_GO_DISABLE_RECEIVE_BUFFER_WARNING"
+
+// quietBufferWarning silences quic-go's receive buffer warning unless the environment
+// already decides it
+func quietBufferWarning() {
+	if _, ok := os.LookupEnv(disableBufferWarningEnv); !ok {
+		os.Setenv(disableBufferWarningEnv, "true")
+	}
+}
+
+// UDPReceiveBuffer opens a loopback UDP socket, requests size bytes of receive buffer, and
+// returns the size the kernel applied (Linux reports twice the granted size)
+func UDPReceiveBuffer(size int) (int, error) {
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		return 0, fmt.Errorf("failed to open UDP socket: %w", err)
+	}
+	defer conn.Close()
+
+	raw, err := conn.SyscallConn()
+	if err != nil {
+		return 0, fmt.Errorf("failed to open UDP socket: %w", err)
+	}
+
+	effective, err := socketReceiveBuffer(raw, size)
+	if err != nil {
+		return 0, fmt.Errorf("failed to size UDP receive buffer: %w", err)
+	}
+
+	return effective, nil
+}
+
+// quicDialer matches the http3.Transport Dial hook
+type quicDialer func(ctx context.Context, addr string, tlsCfg *tls.Config, cfg *quic.Config) (*quic.Conn, error)
+
+// newQUICDialer dials QUIC from one UDP socket per client, sizing its receive buffer when size
+// is positive, binding it to iface when set, dialing pinned addresses from resolve instead of
+// looking the host up, resolving through dns when set, and recording the connection for
+// offload reporting
+func newQUICDialer(size int, iface string, resolve map[string]string, dns *DNSResolver) quicDialer {
+	var (
+		mu        sync.Mutex
+		udpConn   *net.UDPConn
+		transport *quic.Transport
+	)
+
+	quietBufferWarning()
+
+	return func(ctx context.Context, addr string, tlsCfg *tls.Config, cfg *quic.Config) (*quic.Conn, error) {
+		mu.Lock()
+
+		if transport == nil {
+			conn, err := listenUDP(ctx, iface)
+			if err != nil {
+				mu.Unlock()
+
+				return nil, fmt.Errorf("failed to open UDP socket: %w", err)
+			}
+
+			udpConn = conn
+			transport = &quic.Transport{Conn: conn}
+		}
+
+		mu.Unlock()
+
+		if pinned, ok := resolve[addr]; ok {
+			addr = pinned
+		}
+
+		udpAddr, err := resolveUDPAddr(ctx, addr, dns)
+		if err != nil {
+			return nil, err
+		}
+
+		conn, err := transport.DialEarly(ctx, udpAddr, tlsCfg, cfg)
+		if err != nil {
+			return nil, err
+		}
+
+		recordQUICConn(ctx, conn)
+
+		// quic-go resizes the socket on first use, so the requested size is applied afterwards;
+		// without one, the size quic-go obtained is recorded
+		if raw, err := udpConn.SyscallConn(); err == nil {
+			if effective, err := socketReceiveBuffer(raw, size); err == nil {
+				recordReceiveBuffer(ctx, effective)
+			}
+		}
+
+		return conn, nil
+	}
+}
+
+// listenUDP opens the client UDP socket, bound to the interface's address and device when iface is set
+func listenUDP(ctx context.Context, iface string) (*net.UDPConn, error) {
+	if iface == "" {
+		return net.ListenUDP("udp", nil)
+	}
+
+	ip, err := InterfaceAddr(iface)
+	if err != nil {
+		return nil, err
+	}
+
+	lc := net.ListenConfig{
+		Control: func(network, _ string, c syscall.RawConn) error {
+			return bindInterface(c, network, iface)
+		},
+	}
+
+	conn, err := lc.ListenPacket(ctx, "udp", net.JoinHostPort(ip.String(), "0"))
+	if err != nil {
+		return nil, err
+	}
+
+	return conn.(*net.UDPConn), nil
+}
+
+// resolveUDPAddr resolves host:port to a UDP address, preferring IPv4 as quic-go does; a nil
+// dns uses the system resolver
+func resolveUDPAddr(ctx context.Context, addr string, dns *DNSResolver) (*net.UDPAddr, error) {
+	host, portStr, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, err
+	}
+
+	port, err := net.LookupPort("udp", portStr)
+	if err != nil {
+		return nil, err
+	}
+
+	if dns != nil {
+		if _, err := netip.ParseAddr(host); err != nil {
+			addrs, err := dns.lookupTraced(ctx, host)
+			if err != nil {
+				return nil, err
+			}
+
+			ip := addrs[0]
+
+			for _, candidate := range addrs {
+				if candidate.Is4() {
+					ip = candidate
+
+					break
+				}
+			}
+
+			return net.UDPAddrFromAddrPort(netip.AddrPortFrom(ip, uint16(port))), nil
+		}
+	}
+
+	ips, err := net.DefaultResolver.LookupIPAddr(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(ips) == 0 {
+		return nil, fmt.Errorf("no addresses found for %s", host)
+	}
+
+	ip := ips[0]
+
+	for _, candidate := range ips {
+		if candidate.IP.To4() != nil {
+			ip = candidate
+
+			break
+		}
+	}
+
+	return &net.UDPAddr{IP: ip.IP, Port: port, Zone: ip.Zone}, nil
+}
@@ -0,0 +1,13 @@
+//go:build !unix && !windows
+
+package probe
+
+import (
+	"errors"
+	"syscall"
+)
+
+// socketReceiveBuffer is not supported on this platform
+func socketReceiveBuffer(_ syscall.RawConn, _ int) (int, error) {
+	return 0, errors.ErrUnsupported
+}
@@ -0,0 +1,28 @@
+//go:build unix
+
+package probe
+
+import "syscall"
+
+// socketReceiveBuffer sets SO_RCVBUF when size is positive and returns the size the kernel applied
+func socketReceiveBuffer(c syscall.RawConn, size int) (int, error) {
+	var (
+		effective int
+		sockErr   error
+	)
+
+	err := c.Control(func(fd uintptr) {
+		if size > 0 {
+			if sockErr = syscall.SetsockoptInt(int(fd), syscall.SOL_SOCKET, syscall.SO_RCVBUF, size); sockErr != nil {
+				return
+			}
+		}
+
+		effective, sockErr = syscall.GetsockoptInt(int(fd), syscall.SOL_SOCKET, syscall.SO_RCVBUF)
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return effective, sockErr
+}
@@ -0,0 +1,55 @@
+//go:build windows
+
+package probe
+
+import (
+	"net"
+	"testing"
+)
+
+func TestSocketReceiveBuffer(t *testing.T) {
+	const size = 64 << 10
+
+	// Winsock reports the size as set
+	want := size
+
+	got, err := UDPReceiveBuffer(size)
+	if err != nil {
+		t.Fatalf("UDPReceiveBuffer(%d) error = %v", size, err)
+	}
+
+	if got != want {
+		t.Errorf("UDPReceiveBuffer(%d) = %d, want %d", size, got, want)
+	}
+}
+
+func TestSocketReceiveBufferReadsWithoutSize(t *testing.T) {
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatalf("failed to open UDP socket: %v", err)
+	}
+	defer conn.Close()
+
+	raw, err := conn.SyscallConn()
+	if err != nil {
+		t.Fatalf("failed to get raw connection: %v", err)
+	}
+
+	before, err := socketReceiveBuffer(raw, 0)
+	if err != nil {
+		t.Fatalf("socketReceiveBuffer(0) error = %v", err)
+	}
+
+	if before <= 0 {
+		t.Fatalf("socketReceiveBuffer(0) = %d, want the current size", before)
+	}
+
+	after, err := socketReceiveBuffer(raw, 0)
+	if err != nil {
+		t.Fatalf("socketReceiveBuffer(0) error = %v", err)
+	}
+
+	if after != before {
+		t.Errorf("socketReceiveBuffer(0) changed the buffer from %d to %d", before, after)
+	}
+}
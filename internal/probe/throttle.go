@@ -0,0 +1,129 @@
+package probe
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Throttle is a token bucket that limits how fast response bodies are read, which TCP and
+// QUIC flow control turn into a limit on the transfer itself. Clients that share a Throttle
+// share one link: every body they read drains the same bucket.
+type Throttle struct {
+	bytesPerSecond float64
+	burst          float64
+
+	mu     sync.Mutex
+	tokens float64
+	last   time.Time
+}
+
+// NewThrottle creates a full bucket refilling at bitsPerSecond and holding up to burst bytes
+func NewThrottle(bitsPerSecond int64, burst int) *Throttle {
+	t := &Throttle{
+		bytesPerSecond: float64(bitsPerSecond) / 8,
+		burst:          float64(burst),
+	}
+
+	t.Reset()
+
+	return t
+}
+
+// BitsPerSecond returns the refill rate of the bucket
+func (t *Throttle) BitsPerSecond() int64 {
+	return int64(t.bytesPerSecond * 8)
+}
+
+// Burst returns the bucket size in bytes
+func (t *Throttle) Burst() int {
+	return int(t.burst)
+}
+
+// Reset refills the bucket so the next transfer starts from the same state as any other
+func (t *Throttle) Reset() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.tokens = t.burst
+	t.last = time.Now()
+}
+
+// take spends n bytes of tokens, returning how long the reader must wait before the bucket
+// has paid for them
+func (t *Throttle) take(n int) time.Duration {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := time.Now()
+
+	t.tokens = min(t.burst, t.tokens+now.Sub(t.last).Seconds()*t.bytesPerSecond)
+	t.last = now
+	t.tokens -= float64(n)
+
+	if t.tokens >= 0 {
+		return 0
+	}
+
+	return time.Duration(-t.tokens / t.bytesPerSecond * float64(time.Second))
+}
+
+// throttleTransport wraps every response body in a reader paced by a shared Throttle
+type throttleTransport struct {
+	base     http.RoundTripper
+	throttle *Throttle
+}
+
+// withThrottle wraps base so response bodies are read no faster than throttle allows,
+// returning base unchanged when throttle is nil
+func withThrottle(base http.RoundTripper, throttle *Throttle) http.RoundTripper {
+	if throttle == nil {
+		return base
+	}
+
+	return &throttleTransport{base: base, throttle: throttle}
+}
+
+// RoundTrip paces the body of the response
+func (t *throttleTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.base.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+
+	resp.Body = &throttledBody{ReadCloser: resp.Body, ctx: req.Context(), throttle: t.throttle}
+
+	return resp, nil
+}
+
+// throttledBody sleeps after each read until the bucket has paid for the bytes read
+type throttledBody struct {
+	io.ReadCloser
+
+	ctx      context.Context
+	throttle *Throttle
+}
+
+// Read reads at most a burst of bytes and waits for the tokens they cost
+func (b *throttledBody) Read(p []byte) (int, error) {
+	if burst := b.throttle.Burst(); len(p) > burst {
+		p = p[:burst]
+	}
+
+	n, err := b.ReadCloser.Read(p)
+
+	if wait := b.throttle.take(n); wait > 0 {
+		timer := time.NewTimer(wait)
+		defer timer.Stop()
+
+		select {
+		case <-timer.C:
+		case <-b.ctx.Done():
+			return n, b.ctx.Err()
+		}
+	}
+
+	return n, err
+}
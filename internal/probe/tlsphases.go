@@ -0,0 +1,114 @@
+package probe
+
+import (
+	"net"
+	"sync"
+	"time"
+)
+
+// tlsMessageStateKey is the context key carrying TLS message timing state to the dialer
+type tlsMessageStateKey struct{}
+
+// tlsMessageState records socket activity while a TLS handshake is in progress
+type tlsMessageState struct {
+	mu          sync.Mutex
+	active      bool
+	start       time.Time
+	clientHello time.Time
+	firstRead   time.Time
+	lastRead    time.Time
+	done        time.Time
+}
+
+// begin marks the start of the TLS handshake
+func (s *tlsMessageState) begin(at time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.active = true
+	s.start = at
+}
+
+// finish marks the completion of the TLS handshake
+func (s *tlsMessageState) finish(at time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.active = false
+	s.done = at
+}
+
+// wrote records an outgoing write during the handshake
+func (s *tlsMessageState) wrote(at time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// The first handshake write carries the ClientHello
+	if s.active && s.clientHello.IsZero() {
+		s.clientHello = at
+	}
+}
+
+// read records incoming bytes during the handshake
+func (s *tlsMessageState) read(at time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.active || s.clientHello.IsZero() {
+		return
+	}
+
+	if s.firstRead.IsZero() {
+		s.firstRead = at
+	}
+
+	s.lastRead = at
+}
+
+// phases converts the recorded timestamps into handshake intervals
+func (s *tlsMessageState) phases() TLSPhases {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var p TLSPhases
+
+	// Phases are only meaningful when every message boundary was observed
+	if s.clientHello.IsZero() || s.firstRead.IsZero() || s.done.IsZero() {
+		return p
+	}
+
+	p.ClientHello = s.clientHello.Sub(s.start)
+	p.ServerHello = s.firstRead.Sub(s.clientHello)
+	p.Certificate = s.lastRead.Sub(s.firstRead)
+	p.Finished = s.done.Sub(s.lastRead)
+
+	return p
+}
+
+// timingConn wraps a connection to timestamp handshake reads and writes
+type timingConn struct {
+	net.Conn
+	state *tlsMessageState
+}
+
+// Read reads from the connection and records the arrival time
+func (c *timingConn) Read(b []byte) (int, error) {
+	n, err := c.Conn.Read(b)
+
+	if n > 0 {
+		c.state.read(time.Now())
+	}
+
+	return n, err
+}
+
+// Write writes to the connection and records the send time
+func (c *timingConn) Write(b []byte) (int, error) {
+	n, err := c.Conn.Write(b)
+
+	if n > 0 {
+		c.state.wrote(time.Now())
+	}
+
+	return n, err
+}
@@ -3,10 +3,16 @@ package probe
 import (
 	"context"
 	"crypto/tls"
+	"crypto/x509"
+	"net"
 	"net/http"
 	"net/http/httptrace"
+	"net/url"
+	"sync"
+	"syscall"
 	"time"
 
+	"github.com/quic-go/quic-go"
 	"github.com/quic-go/quic-go/http3"
 )
 
@@ -14,10 +20,105 @@ import (
 type Trace struct {
 	DNSLookup     time.Duration
 	TCPConnect    time.Duration
+	Connects      []ConnectAttempt
 	TLSHandshake  time.Duration
+	TLSPhases     TLSPhases
 	QUICHandshake time.Duration
 	TTFB          time.Duration
 	Total         time.Duration
+	StatusCode    int
+	Proto         string
+	TLS           *TLSInfo // negotiated TLS parameters of the connection that served the request; nil without TLS
+	ECHAccepted   bool
+	Handshake     *Handshake // TLS handshake of a connection dialed for the request; nil when reused
+	Conn          ConnInfo   // connection that served the request
+	ReceiveBuffer int        // effective SO_RCVBUF of a socket dialed for the request; zero when reused
+	Header        http.Header
+	CDN           *CDNInfo // what the response headers reveal about the CDN; nil when nothing was recognized
+
+	// Redirects are the hops followed before the final request, and RedirectTime their
+	// combined duration; Total includes it while the other phases time the final request
+	Redirects    []Redirect
+	RedirectTime time.Duration
+
+	// Bytes is the size of the response body when the fetch read it, and Download the time
+	// from sending the request to its last byte
+	Bytes    int64
+	Download time.Duration
+
+	// Progress is when the body of a segment arrived; nil for other fetches
+	Progress *Progress
+
+	// Start is when the request was sent, and Request what went out once the client added
+	// its configured headers
+	Start   time.Time
+	Request *RequestInfo
+
+	// Chunks times the CMAF chunks of a segment streamed without a Content-Length; nil when
+	// the response had a length or held no chunks
+	Chunks *ChunkTiming
+
+	quic *quicConnSlot // QUIC connection dialed for an HTTP/3 request; nil when reused
+}
+
+// ConnInfo identifies the connection that served a request. Through a proxy, RemoteAddr
+// is the proxy's address.
+type ConnInfo struct {
+	RemoteAddr string
+	LocalAddr  string
+	Reused     bool
+	IdleTime   time.Duration // how long a reused connection sat idle in the pool
+}
+
+// newConnInfo extracts the addresses and reuse state reported when a request got its connection
+func newConnInfo(info httptrace.GotConnInfo) ConnInfo {
+	conn := ConnInfo{Reused: info.Reused, IdleTime: info.IdleTime}
+
+	if info.Conn != nil {
+		conn.RemoteAddr = info.Conn.RemoteAddr().String()
+		conn.LocalAddr = info.Conn.LocalAddr().String()
+	}
+
+	return conn
+}
+
+// ConnectAttempt records a single socket connect made while serving a request
+type ConnectAttempt struct {
+	Network  string
+	Addr     string
+	Duration time.Duration
+	Err      string
+}
+
+// FailedConnects counts connect attempts that did not succeed
+func (t *Trace) FailedConnects() int {
+	failed := 0
+
+	for _, c := range t.Connects {
+		if c.Err != "" {
+			failed++
+		}
+	}
+
+	return failed
+}
+
+// Throughput is the effective rate of the response body in bits per second, or zero when
+// the fetch did not read a body
+func (t *Trace) Throughput() float64 {
+	if t.Bytes == 0 || t.Download <= 0 {
+		return 0
+	}
+
+	return float64(t.Bytes*8) / t.Download.Seconds()
+}
+
+// TLSPhases breaks the TLS handshake into message-level intervals
+type TLSPhases struct {
+	ClientHello time.Duration // handshake start until ClientHello was written
+	ServerHello time.Duration // ClientHello sent until first server bytes (RTT + server work)
+	Certificate time.Duration // first until last server handshake bytes (certificate flight)
+	Finished    time.Duration // last server bytes until handshake completion (client verify + Finished)
 }
 
 // traceState holds intermediate timestamps during request tracing
@@ -30,12 +131,25 @@ type traceState struct {
 	tlsHandshakeStart time.Time
 	tlsHandshakeDone  time.Time
 	firstByte         time.Time
+	handshake         *Handshake
+	conn              ConnInfo
+	tls               tlsMessageState
+	connMu            sync.Mutex
+	connectStarts     map[string]time.Time
+	connects          []ConnectAttempt
 }
 
-// FetchWithTrace performs an HTTP GET request and returns timing metrics
+// FetchWithTrace performs an HTTP GET request, tracing each redirect hop, and returns timing metrics
 func FetchWithTrace(ctx context.Context, url string, client *http.Client) (*http.Response, *Trace, error) {
+	return followRedirects(ctx, url, client, DoWithTrace)
+}
+
+// DoWithTrace performs an arbitrary HTTP request and returns timing metrics
+func DoWithTrace(req *http.Request, client *http.Client) (*http.Response, *Trace, error) {
 	state := &traceState{}
 
+	applyRequestHeader(req)
+
 	clientTrace := &httptrace.ClientTrace{
 		DNSStart: func(_ httptrace.DNSStartInfo) {
 			state.dnsStart = time.Now()
@@ -43,29 +157,36 @@ func FetchWithTrace(ctx context.Context, url string, client *http.Client) (*http
 		DNSDone: func(_ httptrace.DNSDoneInfo) {
 			state.dnsDone = time.Now()
 		},
-		ConnectStart: func(_, _ string) {
-			state.connectStart = time.Now()
+		ConnectStart: func(network, addr string) {
+			state.connectStarted(network, addr, time.Now())
+		},
+		ConnectDone: func(network, addr string, err error) {
+			state.connectFinished(network, addr, err, time.Now())
 		},
-		ConnectDone: func(_, _ string, _ error) {
-			state.connectDone = time.Now()
+		GotConn: func(info httptrace.GotConnInfo) {
+			state.conn = newConnInfo(info)
 		},
 		TLSHandshakeStart: func() {
 			state.tlsHandshakeStart = time.Now()
+			state.tls.begin(state.tlsHandshakeStart)
 		},
-		TLSHandshakeDone: func(_ tls.ConnectionState, _ error) {
+		TLSHandshakeDone: func(connState tls.ConnectionState, err error) {
 			state.tlsHandshakeDone = time.Now()
+			state.tls.finish(state.tlsHandshakeDone)
+
+			if err == nil {
+				state.handshake = newHandshake(connState)
+			}
 		},
 		GotFirstResponseByte: func() {
 			state.firstByte = time.Now()
 		},
 	}
 
-	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
-	if err != nil {
-		return nil, nil, err
-	}
-
-	req = req.WithContext(httptrace.WithClientTrace(req.Context(), clientTrace))
+	ctx := context.WithValue(req.Context(), tlsMessageStateKey{}, &state.tls)
+	ctx, receiveBuffer := withReceiveBufferSlot(ctx)
+	ctx, sent := withSentRequestSlot(ctx)
+	req = req.WithContext(httptrace.WithClientTrace(ctx, clientTrace))
 
 	state.start = time.Now()
 
@@ -75,10 +196,62 @@ func FetchWithTrace(ctx context.Context, url string, client *http.Client) (*http
 	}
 
 	trace := buildTrace(state)
+	trace.Start = state.start
+	trace.Request = sentRequest(sent, req)
+	trace.Handshake = state.handshake
+	trace.ReceiveBuffer = int(receiveBuffer.Load())
+	trace.StatusCode = resp.StatusCode
+	trace.Proto = resp.Proto
+	trace.Header = resp.Header
+	trace.CDN = AnalyzeHeaders(resp.Header)
+	trace.Conn = state.conn
+
+	if resp.TLS != nil {
+		trace.TLS = newTLSInfo(*resp.TLS)
+		trace.ECHAccepted = resp.TLS.ECHAccepted
+	}
+
+	observeTrace(ctx, trace)
 
 	return resp, trace, nil
 }
 
+// connectStarted records the start of a socket connect attempt
+func (s *traceState) connectStarted(network, addr string, at time.Time) {
+	s.connMu.Lock()
+	defer s.connMu.Unlock()
+
+	if s.connectStarts == nil {
+		s.connectStarts = make(map[string]time.Time)
+	}
+
+	if s.connectStart.IsZero() {
+		s.connectStart = at
+	}
+
+	s.connectStarts[network+"|"+addr] = at
+}
+
+// connectFinished records the outcome of a socket connect attempt
+func (s *traceState) connectFinished(network, addr string, err error, at time.Time) {
+	s.connMu.Lock()
+	defer s.connMu.Unlock()
+
+	attempt := ConnectAttempt{Network: network, Addr: addr}
+
+	if started, ok := s.connectStarts[network+"|"+addr]; ok {
+		attempt.Duration = at.Sub(started)
+	}
+
+	if err != nil {
+		attempt.Err = err.Error()
+	} else if s.connectDone.IsZero() {
+		s.connectDone = at
+	}
+
+	s.connects = append(s.connects, attempt)
+}
+
 // buildTrace calculates durations from captured timestamps
 func buildTrace(state *traceState) *Trace {
 	trace := &Trace{}
@@ -88,14 +261,21 @@ func buildTrace(state *traceState) *Trace {
 		trace.DNSLookup = state.dnsDone.Sub(state.dnsStart)
 	}
 
-	// Calculate TCP connect duration
+	// Calculate TCP connect duration from the first attempt to the successful one
+	state.connMu.Lock()
+
 	if !state.connectStart.IsZero() && !state.connectDone.IsZero() {
 		trace.TCPConnect = state.connectDone.Sub(state.connectStart)
 	}
 
+	trace.Connects = append([]ConnectAttempt(nil), state.connects...)
+
+	state.connMu.Unlock()
+
 	// Calculate TLS handshake duration
 	if !state.tlsHandshakeStart.IsZero() && !state.tlsHandshakeDone.IsZero() {
 		trace.TLSHandshake = state.tlsHandshakeDone.Sub(state.tlsHandshakeStart)
+		trace.TLSPhases = state.tls.phases()
 	}
 
 	// Calculate time to first byte from request start
@@ -109,20 +289,215 @@ func buildTrace(state *traceState) *Trace {
 	return trace
 }
 
+// sharedTransport is reused by all HTTP/1.1-2 clients and records TLS message timing
+var sharedTransport = newTimingTransport(nil, ClientOptions{})
+
+// newTimingTransport clones the default transport with a dialer that observes handshake traffic.
+// A nil resolver uses the system resolver; opts supplies the receive buffer and interface binding.
+func newTimingTransport(resolver *net.Resolver, opts ClientOptions) *http.Transport {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	dialer := net.Dialer{
+		Timeout:   30 * time.Second,
+		KeepAlive: 30 * time.Second,
+		Resolver:  resolver,
+		// The buffer is sized before connect so TCP window scaling can use it
+		ControlContext: func(ctx context.Context, network, _ string, c syscall.RawConn) error {
+			if effective, err := socketReceiveBuffer(c, opts.ReceiveBuffer); err == nil {
+				recordReceiveBuffer(ctx, effective)
+			}
+
+			return bindInterface(c, network, opts.Interface)
+		},
+	}
+
+	transport.DialContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
+		dialer := dialer
+
+		// The interface address is looked up per dial so address changes on the uplink are followed
+		if opts.Interface != "" {
+			ip, err := InterfaceAddr(opts.Interface)
+			if err != nil {
+				return nil, err
+			}
+
+			dialer.LocalAddr = &net.TCPAddr{IP: ip}
+		}
+
+		var (
+			conn net.Conn
+			err  error
+		)
+
+		if opts.DNS != nil {
+			conn, err = opts.DNS.dialResolved(ctx, network, addr, dialer.DialContext)
+		} else {
+			conn, err = dialer.DialContext(ctx, network, addr)
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		// Wrap connections dialed on behalf of a traced request
+		if state, ok := ctx.Value(tlsMessageStateKey{}).(*tlsMessageState); ok {
+			return &timingConn{Conn: conn, state: state}, nil
+		}
+
+		return conn, nil
+	}
+
+	return transport
+}
+
+// ClientOptions customizes the HTTP/1.1-2 transport used for a measurement
+type ClientOptions struct {
+	// ECHConfigList enables Encrypted Client Hello with the given config list
+	ECHConfigList []byte
+	// DisableKeepAlives forces a dedicated transport with no connection reuse
+	DisableKeepAlives bool
+	// Resolve maps a "host:port" dial address to the "ip:port" actually dialed
+	Resolve map[string]string
+	// Nameserver sends DNS queries to this "ip:port" instead of the system resolver
+	Nameserver string
+	// DNS resolves dialed hosts through a cache that records hits, misses, and query
+	// latency; it queries its own resolver, so Nameserver does not apply to it
+	DNS *DNSResolver
+	// ReceiveBuffer sets the socket receive buffer (SO_RCVBUF) in bytes; zero keeps the OS default
+	ReceiveBuffer int
+	// Interface sends traffic through the named network interface instead of the default route
+	Interface string
+	// Header is added to every request, overriding defaults such as User-Agent
+	Header http.Header
+	// CMCD attaches Common Media Client Data to every request; nil sends none
+	CMCD *CMCD
+	// Proxy sends requests through an HTTP, HTTPS, or SOCKS5 proxy; nil follows the
+	// HTTP_PROXY, HTTPS_PROXY, and NO_PROXY environment variables
+	Proxy *url.URL
+	// SessionCache lets new connections resume earlier TLS sessions, and HTTP/3 requests
+	// go out as 0-RTT early data when a resumed session allows it; nil disables resumption
+	SessionCache tls.ClientSessionCache
+	// TLS adjusts certificate verification, client certificates, and the minimum TLS version
+	TLS TLSSettings
+	// Throttle paces response bodies; clients sharing one Throttle share its bandwidth
+	Throttle *Throttle
+}
+
+// TLSSettings configures the TLS side of both transports
+type TLSSettings struct {
+	// MinVersion is the lowest TLS version offered; zero keeps Go's default (TLS 1.2)
+	MinVersion uint16
+	// InsecureSkipVerify accepts any server certificate
+	InsecureSkipVerify bool
+	// RootCAs replaces the system roots when verifying server certificates
+	RootCAs *x509.CertPool
+	// Certificates are presented to servers that request a client certificate (mTLS)
+	Certificates []tls.Certificate
+}
+
+// isDefault reports whether the settings leave Go's TLS defaults unchanged
+func (s TLSSettings) isDefault() bool {
+	return s.MinVersion == 0 && !s.InsecureSkipVerify && s.RootCAs == nil && len(s.Certificates) == 0
+}
+
+// tlsConfig builds the client TLS configuration shared by the HTTP/1.1-2 and HTTP/3 transports
+func (o ClientOptions) tlsConfig() *tls.Config {
+	return &tls.Config{
+		MinVersion:                     o.TLS.MinVersion,
+		InsecureSkipVerify:             o.TLS.InsecureSkipVerify,
+		RootCAs:                        o.TLS.RootCAs,
+		Certificates:                   o.TLS.Certificates,
+		EncryptedClientHelloConfigList: o.ECHConfigList,
+		ClientSessionCache:             o.SessionCache,
+	}
+}
+
+// isDefault reports whether the options leave the transport unchanged (Header and CMCD only wrap it)
+func (o ClientOptions) isDefault() bool {
+	return o.ECHConfigList == nil && !o.DisableKeepAlives && len(o.Resolve) == 0 && o.Nameserver == "" && o.DNS == nil && o.ReceiveBuffer == 0 && o.Interface == "" && o.Proxy == nil && o.SessionCache == nil && o.TLS.isDefault()
+}
+
+// SharesConnections reports whether clients built with the options draw from the shared
+// pool, so later measurements reuse the connections (and skip the DNS lookups) of earlier ones
+func (o ClientOptions) SharesConnections() bool {
+	return o.isDefault()
+}
+
 // NewHTTPClient creates an HTTP client with the specified timeout
 func NewHTTPClient(timeout time.Duration) *http.Client {
 	return &http.Client{
-		Timeout: timeout,
+		Timeout:   timeout,
+		Transport: sharedTransport,
+	}
+}
+
+// NewHTTPClientWithOptions creates an HTTP client with a transport customized by opts
+func NewHTTPClientWithOptions(timeout time.Duration, opts ClientOptions) *http.Client {
+	// Default options share the pooled transport
+	if opts.isDefault() {
+		client := NewHTTPClient(timeout)
+		client.Transport = withThrottle(withHeader(withCMCD(withSentRequest(client.Transport), opts.CMCD), opts.Header), opts.Throttle)
+
+		return client
+	}
+
+	var resolver *net.Resolver
+
+	if opts.Nameserver != "" {
+		resolver = NewResolver(opts.Nameserver)
+	}
+
+	transport := newTimingTransport(resolver, opts)
+	dial := transport.DialContext
+
+	// Pin dial addresses while keeping the original host for TLS and Host headers
+	if len(opts.Resolve) > 0 {
+		transport.DialContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
+			if pinned, ok := opts.Resolve[addr]; ok {
+				addr = pinned
+			}
+
+			return dial(ctx, network, addr)
+		}
+	}
+
+	// HTTPS targets are tunneled with CONNECT, so TLS still runs end to end with the origin
+	if opts.Proxy != nil {
+		transport.Proxy = http.ProxyURL(opts.Proxy)
+	}
+
+	transport.DisableKeepAlives = opts.DisableKeepAlives
+	transport.TLSClientConfig = opts.tlsConfig()
+
+	return &http.Client{
+		Timeout:   timeout,
+		Transport: withThrottle(withHeader(withCMCD(withSentRequest(transport), opts.CMCD), opts.Header), opts.Throttle),
 	}
 }
 
 // NewHTTP3Client creates an HTTP/3 client with the specified timeout
 func NewHTTP3Client(timeout time.Duration) *http.Client {
+	return NewHTTP3ClientWithOptions(timeout, ClientOptions{})
+}
+
+// NewHTTP3ClientWithOptions creates an HTTP/3 client; only ReceiveBuffer (sizing the UDP socket),
+// Interface, Resolve, DNS, Header, CMCD, SessionCache, TLS, and Throttle apply
+func NewHTTP3ClientWithOptions(timeout time.Duration, opts ClientOptions) *http.Client {
+	tlsConfig := opts.tlsConfig()
+	tlsConfig.EncryptedClientHelloConfigList = nil
+
+	var transport http.RoundTripper = &http3.Transport{
+		TLSClientConfig: tlsConfig,
+		QUICConfig:      &quic.Config{Tracer: ecnTracer},
+		Dial:            newQUICDialer(opts.ReceiveBuffer, opts.Interface, opts.Resolve, opts.DNS),
+	}
+
+	if opts.SessionCache != nil {
+		transport = earlyDataTransport{RoundTripper: transport}
+	}
+
 	return &http.Client{
-		Timeout: timeout,
-		Transport: &http3.Transport{
-			TLSClientConfig: &tls.Config{},
-		},
+		Timeout:   timeout,
+		Transport: withThrottle(withHeader(withCMCD(withSentRequest(transport), opts.CMCD), opts.Header), opts.Throttle),
 	}
 }
 
@@ -133,10 +508,17 @@ type http3TraceState struct {
 	dnsDone   time.Time
 	gotConn   time.Time
 	firstByte time.Time
+	conn      ConnInfo
 }
 
-// FetchWithTraceHTTP3 performs an HTTP/3 GET request and returns timing metrics
+// FetchWithTraceHTTP3 performs an HTTP/3 GET request, tracing each redirect hop, and returns
+// timing metrics
 func FetchWithTraceHTTP3(ctx context.Context, url string, client *http.Client) (*http.Response, *Trace, error) {
+	return followRedirects(ctx, url, client, doWithTraceHTTP3)
+}
+
+// doWithTraceHTTP3 performs a single HTTP/3 request and returns timing metrics
+func doWithTraceHTTP3(req *http.Request, client *http.Client) (*http.Response, *Trace, error) {
 	state := &http3TraceState{}
 
 	clientTrace := &httptrace.ClientTrace{
@@ -146,20 +528,21 @@ func FetchWithTraceHTTP3(ctx context.Context, url string, client *http.Client) (
 		DNSDone: func(_ httptrace.DNSDoneInfo) {
 			state.dnsDone = time.Now()
 		},
-		GotConn: func(_ httptrace.GotConnInfo) {
+		GotConn: func(info httptrace.GotConnInfo) {
 			state.gotConn = time.Now()
+			state.conn = newConnInfo(info)
 		},
 		GotFirstResponseByte: func() {
 			state.firstByte = time.Now()
 		},
 	}
 
-	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
-	if err != nil {
-		return nil, nil, err
-	}
+	applyRequestHeader(req)
 
-	req = req.WithContext(httptrace.WithClientTrace(req.Context(), clientTrace))
+	ctx, receiveBuffer := withReceiveBufferSlot(req.Context())
+	ctx, quicConn := withQUICConnSlot(ctx)
+	ctx, sent := withSentRequestSlot(ctx)
+	req = req.WithContext(httptrace.WithClientTrace(ctx, clientTrace))
 
 	state.start = time.Now()
 
@@ -169,6 +552,30 @@ func FetchWithTraceHTTP3(ctx context.Context, url string, client *http.Client) (
 	}
 
 	trace := buildHTTP3Trace(state)
+	trace.Start = state.start
+	trace.Request = sentRequest(sent, req)
+	trace.ReceiveBuffer = int(receiveBuffer.Load())
+
+	if quicConn.dialed() {
+		trace.quic = quicConn
+
+		if resp.TLS != nil {
+			trace.Handshake = newHandshake(*resp.TLS)
+			trace.Handshake.EarlyData = quicConn.usedEarlyData()
+		}
+	}
+
+	trace.StatusCode = resp.StatusCode
+	trace.Proto = resp.Proto
+	trace.Header = resp.Header
+	trace.CDN = AnalyzeHeaders(resp.Header)
+	trace.Conn = state.conn
+
+	if resp.TLS != nil {
+		trace.TLS = newTLSInfo(*resp.TLS)
+	}
+
+	observeTrace(ctx, trace)
 
 	return resp, trace, nil
 }
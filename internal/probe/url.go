@@ -0,0 +1,65 @@
+package probe
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+
+	"golang.org/x/net/idna"
+)
+
+var ErrUnsupportedScheme = errors.New("URL scheme must be http or https")
+
+// NormalizeURL validates a target URL and converts internationalized hosts to punycode.
+// IPv6 literals (including zones) and userinfo are preserved.
+func NormalizeURL(rawURL string) (string, error) {
+	parsed, err := url.Parse(strings.TrimSpace(rawURL))
+	if err != nil {
+		return "", fmt.Errorf("failed to parse URL: %w", err)
+	}
+
+	parsed.Scheme = strings.ToLower(parsed.Scheme)
+
+	if parsed.Scheme != "http" && parsed.Scheme != "https" {
+		return "", ErrUnsupportedScheme
+	}
+
+	if parsed.Hostname() == "" {
+		return "", errors.New("URL has no host")
+	}
+
+	if err := normalizeHost(parsed); err != nil {
+		return "", err
+	}
+
+	return parsed.String(), nil
+}
+
+// normalizeHost rewrites the URL host into its ASCII form, leaving IP literals untouched
+func normalizeHost(u *url.URL) error {
+	hostname := u.Hostname()
+
+	if hostname == "" {
+		return nil
+	}
+
+	// IP literals (with optional IPv6 zone) need no conversion
+	if ip := net.ParseIP(strings.SplitN(hostname, "%", 2)[0]); ip != nil {
+		return nil
+	}
+
+	ascii, err := idna.Lookup.ToASCII(hostname)
+	if err != nil {
+		return fmt.Errorf("invalid host %q: %w", hostname, err)
+	}
+
+	if port := u.Port(); port != "" {
+		u.Host = net.JoinHostPort(ascii, port)
+	} else {
+		u.Host = ascii
+	}
+
+	return nil
+}
@@ -0,0 +1,213 @@
+package probe
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/grafov/m3u8"
+)
+
+var ErrNoMatchingVariant = errors.New("no variant matches the selection")
+
+// VariantStrategy picks the index of one variant from a master playlist
+type VariantStrategy func(variants []*m3u8.Variant) (int, error)
+
+// SelectVariant resolves the URL of the variant chosen by strategy
+func SelectVariant(master *m3u8.MasterPlaylist, baseURL string, strategy VariantStrategy) (string, *m3u8.Variant, error) {
+	if master == nil || len(master.Variants) == 0 {
+		return "", nil, ErrNoVariants
+	}
+
+	index, err := strategy(master.Variants)
+	if err != nil {
+		return "", nil, err
+	}
+
+	variant := master.Variants[index]
+
+	variantURL, err := ResolveURL(baseURL, variant.URI)
+	if err != nil {
+		return "", nil, err
+	}
+
+	return variantURL, variant, nil
+}
+
+// FirstVariant selects the first listed variant
+func FirstVariant() VariantStrategy {
+	return func(variants []*m3u8.Variant) (int, error) {
+		return 0, nil
+	}
+}
+
+// VariantByIndex selects the variant at a zero-based position in the master playlist
+func VariantByIndex(index int) VariantStrategy {
+	return func(variants []*m3u8.Variant) (int, error) {
+		if index < 0 || index >= len(variants) {
+			return 0, fmt.Errorf("%w: index %d out of range (0-%d)", ErrNoMatchingVariant, index, len(variants)-1)
+		}
+
+		return index, nil
+	}
+}
+
+// VariantByBandwidth selects by bandwidth: "highest", "lowest", or the variant
+// closest to a target in bits per second (e.g., 3000000 or 3M)
+func VariantByBandwidth(spec string) (VariantStrategy, error) {
+	switch strings.ToLower(spec) {
+	case "highest", "max":
+		return extremeVariant(func(v *m3u8.Variant) int64 { return int64(v.Bandwidth) }, true), nil
+	case "lowest", "min":
+		return extremeVariant(func(v *m3u8.Variant) int64 { return int64(v.Bandwidth) }, false), nil
+	}
+
+	target, err := parseBitrate(spec)
+	if err != nil {
+		return nil, err
+	}
+
+	return func(variants []*m3u8.Variant) (int, error) {
+		best := 0
+		bestDistance := int64(-1)
+
+		for i, v := range variants {
+			distance := int64(v.Bandwidth) - target
+			if distance < 0 {
+				distance = -distance
+			}
+
+			if bestDistance < 0 || distance < bestDistance {
+				best = i
+				bestDistance = distance
+			}
+		}
+
+		return best, nil
+	}, nil
+}
+
+// VariantByResolution selects by resolution: "highest", "lowest", an exact
+// WIDTHxHEIGHT, or a height such as 720p
+func VariantByResolution(spec string) (VariantStrategy, error) {
+	pixels := func(v *m3u8.Variant) int64 {
+		width, height, ok := parseResolution(v.Resolution)
+		if !ok {
+			return -1
+		}
+
+		return int64(width) * int64(height)
+	}
+
+	switch strings.ToLower(spec) {
+	case "highest", "max":
+		return extremeVariant(pixels, true), nil
+	case "lowest", "min":
+		return extremeVariant(pixels, false), nil
+	}
+
+	var match func(width, height int) bool
+
+	if height, ok := strings.CutSuffix(strings.ToLower(spec), "p"); ok {
+		h, err := strconv.Atoi(height)
+		if err != nil {
+			return nil, fmt.Errorf("invalid resolution %q", spec)
+		}
+
+		match = func(width, height int) bool { return height == h }
+	} else {
+		w, h, ok := parseResolution(spec)
+		if !ok {
+			return nil, fmt.Errorf("invalid resolution %q (want WIDTHxHEIGHT, 720p, highest, or lowest)", spec)
+		}
+
+		match = func(width, height int) bool { return width == w && height == h }
+	}
+
+	return func(variants []*m3u8.Variant) (int, error) {
+		best := -1
+
+		// Among equal resolutions prefer the highest bandwidth
+		for i, v := range variants {
+			width, height, ok := parseResolution(v.Resolution)
+			if !ok || !match(width, height) {
+				continue
+			}
+
+			if best < 0 || v.Bandwidth > variants[best].Bandwidth {
+				best = i
+			}
+		}
+
+		if best < 0 {
+			return 0, fmt.Errorf("%w: resolution %s", ErrNoMatchingVariant, spec)
+		}
+
+		return best, nil
+	}, nil
+}
+
+// extremeVariant selects the variant with the highest or lowest key, ignoring negative keys
+func extremeVariant(key func(*m3u8.Variant) int64, highest bool) VariantStrategy {
+	return func(variants []*m3u8.Variant) (int, error) {
+		best := -1
+
+		for i, v := range variants {
+			k := key(v)
+			if k < 0 {
+				continue
+			}
+
+			if best < 0 || (highest && k > key(variants[best])) || (!highest && k < key(variants[best])) {
+				best = i
+			}
+		}
+
+		if best < 0 {
+			return 0, ErrNoMatchingVariant
+		}
+
+		return best, nil
+	}
+}
+
+// parseResolution splits a WIDTHxHEIGHT attribute
+func parseResolution(resolution string) (int, int, bool) {
+	w, h, found := strings.Cut(strings.ToLower(resolution), "x")
+	if !found {
+		return 0, 0, false
+	}
+
+	width, err := strconv.Atoi(w)
+	if err != nil {
+		return 0, 0, false
+	}
+
+	height, err := strconv.Atoi(h)
+	if err != nil {
+		return 0, 0, false
+	}
+
+	return width, height, true
+}
+
+// parseBitrate parses bits per second with an optional k or M suffix
+func parseBitrate(spec string) (int64, error) {
+	multiplier := 1.0
+	number := spec
+
+	switch {
+	case strings.HasSuffix(spec, "k"), strings.HasSuffix(spec, "K"):
+		multiplier, number = 1e3, spec[:len(spec)-1]
+	case strings.HasSuffix(spec, "m"), strings.HasSuffix(spec, "M"):
+		multiplier, number = 1e6, spec[:len(spec)-1]
+	}
+
+	value, err := strconv.ParseFloat(number, 64)
+	if err != nil || value <= 0 {
+		return 0, fmt.Errorf("invalid bandwidth %q (want highest, lowest, or bits per second such as 3000000 or 3M)", spec)
+	}
+
+	return int64(value * multiplier), nil
+}
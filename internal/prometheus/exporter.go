@@ -0,0 +1,268 @@
+package prometheus
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultBuckets are histogram upper bounds in seconds, spanning fast CDN hits to stalled starts
+var DefaultBuckets = []float64{0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30}
+
+// metricNames maps sample metric keys (milliseconds) to exported metric stems (seconds)
+var metricNames = map[string]string{
+	"total_ttff":      "ttff",
+	"dns_lookup":      "dns",
+	"tcp_connect":     "tcp_connect",
+	"tls_handshake":   "tls_handshake",
+	"quic_handshake":  "quic_handshake",
+	"manifest_ttfb":   "manifest_ttfb",
+	"manifest_total":  "manifest",
+	"segment_total":   "segment_download",
+	"frame_detection": "frame_detection",
+	"part_download":   "part_download",
+	"blocking_reload": "blocking_reload",
+	"key_fetch":       "key_fetch",
+	"init_segment":    "init_segment",
+	"total_ttfa":      "ttfa",
+	"audio_playlist":  "audio_playlist",
+	"audio_segment":   "audio_segment_download",
+	"audio_detection": "audio_frame_detection",
+}
+
+// histogram is a cumulative Prometheus histogram
+type histogram struct {
+	counts []uint64
+	count  uint64
+	sum    float64
+}
+
+// Objective is the exported state of one SLO
+type Objective struct {
+	Name            string
+	Compliance      float64
+	BudgetRemaining float64
+	BurnRates       map[string]float64
+	Firing          map[string]bool
+}
+
+// Exporter keeps the latest value and a histogram per metric for one stream
+type Exporter struct {
+	url     string
+	buckets []float64
+
+	mu          sync.Mutex
+	latest      map[string]float64
+	histograms  map[string]*histogram
+	successes   uint64
+	failures    uint64
+	lastSuccess time.Time
+	objectives  []Objective
+	anomalies   map[string]uint64
+}
+
+// NewExporter creates an exporter labelling every series with the stream URL
+func NewExporter(url string) *Exporter {
+	return &Exporter{
+		url:        url,
+		buckets:    DefaultBuckets,
+		latest:     make(map[string]float64),
+		histograms: make(map[string]*histogram),
+		anomalies:  make(map[string]uint64),
+	}
+}
+
+// Observe records a successful sample given metrics in milliseconds
+func (e *Exporter) Observe(metrics map[string]float64, at time.Time) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.successes++
+	e.lastSuccess = at
+
+	for key, ms := range metrics {
+		name, ok := metricNames[key]
+		if !ok {
+			continue
+		}
+
+		seconds := ms / 1000
+
+		e.latest[name] = seconds
+
+		h := e.histograms[name]
+
+		if h == nil {
+			h = &histogram{counts: make([]uint64, len(e.buckets))}
+			e.histograms[name] = h
+		}
+
+		for i, bound := range e.buckets {
+			if seconds <= bound {
+				h.counts[i]++
+			}
+		}
+
+		h.count++
+		h.sum += seconds
+	}
+}
+
+// ObserveFailure records a failed sample
+func (e *Exporter) ObserveFailure() {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.failures++
+}
+
+// ObserveAnomaly counts a sample flagged as anomalous for a metric
+func (e *Exporter) ObserveAnomaly(key string) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if name, ok := metricNames[key]; ok {
+		e.anomalies[name]++
+	}
+}
+
+// SetObjectives replaces the exported SLO state
+func (e *Exporter) SetObjectives(objectives []Objective) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.objectives = objectives
+}
+
+// ServeHTTP writes all series in the Prometheus text exposition format
+func (e *Exporter) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	var b strings.Builder
+
+	label := fmt.Sprintf(`url="%s"`, escapeLabel(e.url))
+
+	b.WriteString("# HELP vtrace_samples_total Measurements taken, by result.\n")
+	b.WriteString("# TYPE vtrace_samples_total counter\n")
+	fmt.Fprintf(&b, "vtrace_samples_total{%s,result=\"success\"} %d\n", label, e.successes)
+	fmt.Fprintf(&b, "vtrace_samples_total{%s,result=\"failure\"} %d\n", label, e.failures)
+
+	if !e.lastSuccess.IsZero() {
+		b.WriteString("# HELP vtrace_last_success_timestamp_seconds Unix time of the latest successful measurement.\n")
+		b.WriteString("# TYPE vtrace_last_success_timestamp_seconds gauge\n")
+		fmt.Fprintf(&b, "vtrace_last_success_timestamp_seconds{%s} %d\n", label, e.lastSuccess.Unix())
+	}
+
+	if len(e.anomalies) > 0 {
+		b.WriteString("# HELP vtrace_anomalies_total Samples flagged as anomalous against the rolling baseline, by phase.\n")
+		b.WriteString("# TYPE vtrace_anomalies_total counter\n")
+
+		for _, name := range sortedKeys(e.anomalies) {
+			fmt.Fprintf(&b, "vtrace_anomalies_total{%s,phase=\"%s\"} %d\n", label, name, e.anomalies[name])
+		}
+	}
+
+	names := make([]string, 0, len(e.histograms))
+
+	for name := range e.histograms {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	for _, name := range names {
+		h := e.histograms[name]
+		metric := "vtrace_" + name
+
+		fmt.Fprintf(&b, "# HELP %s_latest_seconds Latest measured %s duration.\n", metric, name)
+		fmt.Fprintf(&b, "# TYPE %s_latest_seconds gauge\n", metric)
+		fmt.Fprintf(&b, "%s_latest_seconds{%s} %s\n", metric, label, formatFloat(e.latest[name]))
+
+		fmt.Fprintf(&b, "# HELP %s_seconds Distribution of measured %s durations.\n", metric, name)
+		fmt.Fprintf(&b, "# TYPE %s_seconds histogram\n", metric)
+
+		for i, bound := range e.buckets {
+			fmt.Fprintf(&b, "%s_seconds_bucket{%s,le=\"%s\"} %d\n", metric, label, formatFloat(bound), h.counts[i])
+		}
+
+		fmt.Fprintf(&b, "%s_seconds_bucket{%s,le=\"+Inf\"} %d\n", metric, label, h.count)
+		fmt.Fprintf(&b, "%s_seconds_sum{%s} %s\n", metric, label, formatFloat(h.sum))
+		fmt.Fprintf(&b, "%s_seconds_count{%s} %d\n", metric, label, h.count)
+	}
+
+	if len(e.objectives) > 0 {
+		writeObjectives(&b, label, e.objectives)
+	}
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	w.Write([]byte(b.String()))
+}
+
+// writeObjectives writes compliance, error budget, burn rate, and alert series per SLO
+func writeObjectives(b *strings.Builder, label string, objectives []Objective) {
+	b.WriteString("# HELP vtrace_slo_compliance_ratio Fraction of samples meeting the SLO over its window.\n")
+	b.WriteString("# TYPE vtrace_slo_compliance_ratio gauge\n")
+
+	for _, o := range objectives {
+		fmt.Fprintf(b, "vtrace_slo_compliance_ratio{%s,slo=\"%s\"} %s\n", label, escapeLabel(o.Name), formatFloat(o.Compliance))
+	}
+
+	b.WriteString("# HELP vtrace_slo_error_budget_remaining_ratio Fraction of the SLO error budget left (negative once exhausted).\n")
+	b.WriteString("# TYPE vtrace_slo_error_budget_remaining_ratio gauge\n")
+
+	for _, o := range objectives {
+		fmt.Fprintf(b, "vtrace_slo_error_budget_remaining_ratio{%s,slo=\"%s\"} %s\n", label, escapeLabel(o.Name), formatFloat(o.BudgetRemaining))
+	}
+
+	b.WriteString("# HELP vtrace_slo_burn_rate Error budget burn rate over a trailing window.\n")
+	b.WriteString("# TYPE vtrace_slo_burn_rate gauge\n")
+
+	for _, o := range objectives {
+		for _, window := range sortedKeys(o.BurnRates) {
+			fmt.Fprintf(b, "vtrace_slo_burn_rate{%s,slo=\"%s\",window=\"%s\"} %s\n", label, escapeLabel(o.Name), window, formatFloat(o.BurnRates[window]))
+		}
+	}
+
+	b.WriteString("# HELP vtrace_slo_alert_firing Whether a burn-rate alert is firing (1) or not (0).\n")
+	b.WriteString("# TYPE vtrace_slo_alert_firing gauge\n")
+
+	for _, o := range objectives {
+		for _, severity := range sortedKeys(o.Firing) {
+			firing := 0
+
+			if o.Firing[severity] {
+				firing = 1
+			}
+
+			fmt.Fprintf(b, "vtrace_slo_alert_firing{%s,slo=\"%s\",severity=\"%s\"} %d\n", label, escapeLabel(o.Name), severity, firing)
+		}
+	}
+}
+
+// sortedKeys returns map keys in a stable order
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+
+	for key := range m {
+		keys = append(keys, key)
+	}
+
+	sort.Strings(keys)
+
+	return keys
+}
+
+// formatFloat renders a sample value the way Prometheus expects
+func formatFloat(v float64) string {
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+// escapeLabel escapes a label value for the text exposition format
+func escapeLabel(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(value)
+}
@@ -0,0 +1,82 @@
+package redact
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net"
+	"net/url"
+	"path"
+	"regexp"
+	"strings"
+)
+
+// Placeholder replaces values that cannot be hashed meaningfully
+const Placeholder = "[redacted]"
+
+var (
+	urlPattern  = regexp.MustCompile(`[a-zA-Z][a-zA-Z0-9+.-]*://[^\s"'<>]+`)
+	ipv4Pattern = regexp.MustCompile(`\b(?:\d{1,3}\.){3}\d{1,3}\b`)
+	ipv6Pattern = regexp.MustCompile(`\[?[0-9a-fA-F]{0,4}(?::[0-9a-fA-F]{0,4}){2,7}(?:%[0-9a-zA-Z]+)?\]?`)
+)
+
+// URL returns a stable, shareable stand-in for a URL. Userinfo, query strings,
+// fragments, and path segments that look like tokens are dropped, then the
+// host and path are replaced by short hashes. The file extension is kept so
+// playlists and segments remain distinguishable.
+func URL(raw string) string {
+	parsed, err := url.Parse(raw)
+	if err != nil || parsed.Host == "" {
+		return Placeholder
+	}
+
+	var kept []string
+
+	for _, segment := range strings.Split(parsed.Path, "/") {
+		if segment == "" || isToken(segment) {
+			continue
+		}
+
+		kept = append(kept, segment)
+	}
+
+	cleanPath := "/" + strings.Join(kept, "/")
+
+	return parsed.Scheme + "://host-" + shortHash(strings.ToLower(parsed.Hostname())) + "/" + shortHash(cleanPath) + path.Ext(cleanPath)
+}
+
+// Text redacts every URL and IP address embedded in free-form text such as error messages
+func Text(s string) string {
+	s = urlPattern.ReplaceAllStringFunc(s, URL)
+	s = ipv4Pattern.ReplaceAllString(s, Placeholder)
+
+	return ipv6Pattern.ReplaceAllStringFunc(s, func(match string) string {
+		candidate := strings.Trim(match, "[]")
+
+		if i := strings.IndexByte(candidate, '%'); i >= 0 {
+			candidate = candidate[:i]
+		}
+
+		if net.ParseIP(candidate) == nil {
+			return match
+		}
+
+		return Placeholder
+	})
+}
+
+// isToken reports whether a path segment carries credentials rather than content,
+// such as CDN token segments (hdnts=exp=...~hmac=...) or long opaque signatures
+func isToken(segment string) bool {
+	if strings.ContainsAny(segment, "=~") {
+		return true
+	}
+
+	return len(segment) >= 32 && !strings.Contains(segment, ".")
+}
+
+// shortHash returns the first 12 hex digits of the SHA-256 of s
+func shortHash(s string) string {
+	sum := sha256.Sum256([]byte(s))
+
+	return hex.EncodeToString(sum[:6])
+}
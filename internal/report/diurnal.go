@@ -0,0 +1,266 @@
+package report
+
+import (
+	"bytes"
+	"fmt"
+	"html/template"
+	"sort"
+	"time"
+
+	"codeberg.org/pwnderpants/vtrace/internal/stats"
+)
+
+// DiurnalMinSamples is the fewest samples a bucket needs to be ranked as peak or quietest
+const DiurnalMinSamples = 3
+
+// DiurnalCell holds the p50/p95 of one hour-of-day or weekday bucket in milliseconds
+type DiurnalCell struct {
+	Count int     `json:"count"`
+	P50   float64 `json:"p50_ms"`
+	P95   float64 `json:"p95_ms"`
+}
+
+// Diurnal holds the hour-of-day and day-of-week breakdown of one metric for one URL
+type Diurnal struct {
+	URL      string          `json:"url"`
+	Metric   string          `json:"metric"`
+	Hours    [24]DiurnalCell `json:"hours"`
+	Weekdays [7]DiurnalCell  `json:"weekdays"`
+
+	// PeakHour and QuietHour are the hours with the highest and lowest p95 (-1 when unknown)
+	PeakHour  int `json:"peak_hour"`
+	QuietHour int `json:"quiet_hour"`
+
+	// Degradation is how much slower the peak hour p95 is than the quietest, in percent
+	Degradation float64 `json:"degradation_pct"`
+}
+
+// weekdayNames labels Diurnal.Weekdays, which starts on Monday
+var weekdayNames = [7]string{"Mon", "Tue", "Wed", "Thu", "Fri", "Sat", "Sun"}
+
+// BuildDiurnal buckets successful samples per URL by local hour of day and weekday in loc
+func BuildDiurnal(samples []Sample, metric string, loc *time.Location) []Diurnal {
+	type buckets struct {
+		hours    [24][]time.Duration
+		weekdays [7][]time.Duration
+	}
+
+	byURL := make(map[string]*buckets)
+
+	for _, s := range samples {
+		if s.Error != "" {
+			continue
+		}
+
+		ms, ok := s.Metrics[metric]
+		if !ok {
+			continue
+		}
+
+		b := byURL[s.URL]
+		if b == nil {
+			b = &buckets{}
+			byURL[s.URL] = b
+		}
+
+		local := s.Time.In(loc)
+		value := time.Duration(ms * float64(time.Millisecond))
+
+		// time.Weekday starts on Sunday; shift so Monday is first
+		weekday := (int(local.Weekday()) + 6) % 7
+
+		b.hours[local.Hour()] = append(b.hours[local.Hour()], value)
+		b.weekdays[weekday] = append(b.weekdays[weekday], value)
+	}
+
+	diurnals := make([]Diurnal, 0, len(byURL))
+
+	for u, b := range byURL {
+		d := Diurnal{URL: u, Metric: metric}
+
+		for hour, values := range b.hours {
+			d.Hours[hour] = diurnalCell(values)
+		}
+
+		for weekday, values := range b.weekdays {
+			d.Weekdays[weekday] = diurnalCell(values)
+		}
+
+		d.rankHours()
+
+		diurnals = append(diurnals, d)
+	}
+
+	sort.Slice(diurnals, func(i, j int) bool {
+		return diurnals[i].URL < diurnals[j].URL
+	})
+
+	return diurnals
+}
+
+// diurnalCell computes the p50/p95 of one bucket
+func diurnalCell(values []time.Duration) DiurnalCell {
+	if len(values) == 0 {
+		return DiurnalCell{}
+	}
+
+	toMs := func(d time.Duration) float64 {
+		return float64(d) / float64(time.Millisecond)
+	}
+
+	s := stats.ComputeStatsWithPercentiles(values, []float64{50, 95})
+
+	return DiurnalCell{
+		Count: len(values),
+		P50:   toMs(s.Percentile(50)),
+		P95:   toMs(s.Percentile(95)),
+	}
+}
+
+// rankHours finds the peak and quietest hours among buckets with enough samples
+func (d *Diurnal) rankHours() {
+	d.PeakHour = -1
+	d.QuietHour = -1
+
+	for hour, cell := range d.Hours {
+		if cell.Count < DiurnalMinSamples {
+			continue
+		}
+
+		if d.PeakHour < 0 || cell.P95 > d.Hours[d.PeakHour].P95 {
+			d.PeakHour = hour
+		}
+
+		if d.QuietHour < 0 || cell.P95 < d.Hours[d.QuietHour].P95 {
+			d.QuietHour = hour
+		}
+	}
+
+	if d.PeakHour < 0 || d.Hours[d.QuietHour].P95 <= 0 {
+		return
+	}
+
+	d.Degradation = (d.Hours[d.PeakHour].P95/d.Hours[d.QuietHour].P95 - 1) * 100
+}
+
+// heatCell is one rendered table cell with its background colour
+type heatCell struct {
+	Label string
+	DiurnalCell
+	Color template.CSS
+}
+
+// heatTable is one URL's rendered hour-of-day and weekday rows
+type heatTable struct {
+	Diurnal
+	Hours    []heatCell
+	Weekdays []heatCell
+}
+
+var diurnalTemplate = template.Must(template.New("diurnal").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>vtrace diurnal report</title>
+<style>
+body { font-family: sans-serif; margin: 2em; }
+table { border-collapse: collapse; margin-bottom: 1em; }
+th, td { border: 1px solid #ccc; padding: 4px 6px; text-align: right; font-size: 0.9em; }
+th:first-child, td:first-child { text-align: left; }
+</style>
+</head>
+<body>
+<h1>vtrace diurnal report</h1>
+<p>Window: {{.From.Format "2006-01-02 15:04 MST"}} to {{.To.Format "2006-01-02 15:04 MST"}}<br>
+Times are local to {{.Location}}; cells are shaded from the fastest (green) to the slowest (red) p95.</p>
+{{range .Tables}}<h2>{{.URL}}</h2>
+<p>Metric: {{.Metric}}{{if ge .PeakHour 0}}<br>
+Peak hour {{printf "%02d" .PeakHour}}:00 p95 is {{printf "%.1f" .Degradation}}% slower than the quietest hour {{printf "%02d" .QuietHour}}:00{{end}}</p>
+<table>
+<tr><th>Hour</th>{{range .Hours}}<th>{{.Label}}</th>{{end}}</tr>
+<tr><td>p50 (ms)</td>{{range .Hours}}<td style="{{.Color}}">{{if .Count}}{{printf "%.0f" .P50}}{{end}}</td>{{end}}</tr>
+<tr><td>p95 (ms)</td>{{range .Hours}}<td style="{{.Color}}">{{if .Count}}{{printf "%.0f" .P95}}{{end}}</td>{{end}}</tr>
+<tr><td>Samples</td>{{range .Hours}}<td>{{.Count}}</td>{{end}}</tr>
+</table>
+<table>
+<tr><th>Day</th>{{range .Weekdays}}<th>{{.Label}}</th>{{end}}</tr>
+<tr><td>p50 (ms)</td>{{range .Weekdays}}<td style="{{.Color}}">{{if .Count}}{{printf "%.0f" .P50}}{{end}}</td>{{end}}</tr>
+<tr><td>p95 (ms)</td>{{range .Weekdays}}<td style="{{.Color}}">{{if .Count}}{{printf "%.0f" .P95}}{{end}}</td>{{end}}</tr>
+<tr><td>Samples</td>{{range .Weekdays}}<td>{{.Count}}</td>{{end}}</tr>
+</table>
+{{else}}<p>No successful samples in this window.</p>
+{{end}}</body>
+</html>
+`))
+
+// DiurnalHTML renders the breakdowns as a standalone HTML page of p50/p95 heat tables
+func DiurnalHTML(diurnals []Diurnal, from, to time.Time, loc *time.Location) ([]byte, error) {
+	tables := make([]heatTable, 0, len(diurnals))
+
+	for _, d := range diurnals {
+		table := heatTable{Diurnal: d}
+		low, high := d.p95Range()
+
+		for hour, cell := range d.Hours {
+			table.Hours = append(table.Hours, heatCell{Label: fmt.Sprintf("%02d", hour), DiurnalCell: cell, Color: heatColor(cell, low, high)})
+		}
+
+		for weekday, cell := range d.Weekdays {
+			table.Weekdays = append(table.Weekdays, heatCell{Label: weekdayNames[weekday], DiurnalCell: cell, Color: heatColor(cell, low, high)})
+		}
+
+		tables = append(tables, table)
+	}
+
+	var buf bytes.Buffer
+
+	if err := diurnalTemplate.Execute(&buf, struct {
+		From     time.Time
+		To       time.Time
+		Location *time.Location
+		Tables   []heatTable
+	}{from.In(loc), to.In(loc), loc, tables}); err != nil {
+		return nil, fmt.Errorf("failed to render diurnal report: %w", err)
+	}
+
+	return buf.Bytes(), nil
+}
+
+// p95Range returns the lowest and highest hour-of-day p95 across populated buckets
+func (d Diurnal) p95Range() (float64, float64) {
+	low, high := -1.0, -1.0
+
+	for _, cell := range d.Hours {
+		if cell.Count == 0 {
+			continue
+		}
+
+		if low < 0 || cell.P95 < low {
+			low = cell.P95
+		}
+
+		if cell.P95 > high {
+			high = cell.P95
+		}
+	}
+
+	return low, high
+}
+
+// heatColor shades a cell from green (low) to red (high) by its p95
+func heatColor(cell DiurnalCell, low, high float64) template.CSS {
+	if cell.Count == 0 {
+		return ""
+	}
+
+	position := 0.0
+
+	if high > low {
+		position = (cell.P95 - low) / (high - low)
+		position = min(max(position, 0), 1)
+	}
+
+	hue := 120 * (1 - position)
+
+	return template.CSS(fmt.Sprintf("background-color: hsl(%.0f, 70%%, 80%%)", hue))
+}
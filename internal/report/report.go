@@ -0,0 +1,268 @@
+package report
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"sort"
+	"strconv"
+	"time"
+
+	"codeberg.org/pwnderpants/vtrace/internal/sink"
+	"codeberg.org/pwnderpants/vtrace/internal/stats"
+)
+
+// Sample is a single measurement recorded in the run report
+type Sample struct {
+	Index    int                `json:"sample"`
+	Protocol string             `json:"protocol"`
+	Time     time.Time          `json:"time"`
+	URL      string             `json:"url,omitempty"`
+	Error    string             `json:"error,omitempty"`
+	Metrics  map[string]float64 `json:"metrics_ms,omitempty"`
+
+	// Negotiated holds the protocols of the "manifest" and "segment" requests
+	Negotiated map[string]sink.Negotiated `json:"negotiated,omitempty"`
+}
+
+// Summary holds aggregate statistics for one metric in milliseconds
+type Summary struct {
+	Count  int     `json:"count"`
+	Mean   float64 `json:"mean_ms"`
+	Median float64 `json:"median_ms"`
+	Min    float64 `json:"min_ms"`
+	Max    float64 `json:"max_ms"`
+	StdDev float64 `json:"stddev_ms"`
+}
+
+// Report describes a complete run for export
+type Report struct {
+	RunID      string                        `json:"run_id"`
+	URL        string                        `json:"url"`
+	StartedAt  time.Time                     `json:"started_at"`
+	FinishedAt time.Time                     `json:"finished_at"`
+	Samples    []Sample                      `json:"samples"`
+	Summary    map[string]map[string]Summary `json:"summary"`
+
+	// Shaping is the bandwidth limit every sample was measured under, if any
+	Shaping *Shaping `json:"shaping,omitempty"`
+
+	// Config is the effective configuration of the run, so two reports can be checked
+	// for like-for-like settings before they are compared
+	Config *Config `json:"config,omitempty"`
+}
+
+// Shaping records the token bucket that limited the run's response bodies
+type Shaping struct {
+	BitsPerSecond int64 `json:"rate_bps"`
+	BurstBytes    int   `json:"burst_bytes"`
+}
+
+// Config records every resolved flag, the client versions, and the environment of a run
+type Config struct {
+	// Fingerprint hashes the measurement settings, versions, and platform; runs with the
+	// same fingerprint were measured the same way
+	Fingerprint string            `json:"fingerprint"`
+	Flags       map[string]string `json:"flags"`
+	Versions    map[string]string `json:"versions"`
+	Environment map[string]string `json:"environment"`
+}
+
+// New starts a report for a run
+func New(runID, url string) *Report {
+	return &Report{
+		RunID:     runID,
+		URL:       url,
+		StartedAt: time.Now().UTC(),
+		Samples:   []Sample{},
+	}
+}
+
+// Add records a completed sample
+func (r *Report) Add(sample Sample) {
+	if r == nil {
+		return
+	}
+
+	r.Samples = append(r.Samples, sample)
+}
+
+// Finish stamps the end time and computes per-protocol, per-metric summaries
+func (r *Report) Finish() {
+	r.FinishedAt = time.Now().UTC()
+	r.Summary = make(map[string]map[string]Summary)
+
+	values := make(map[string]map[string][]time.Duration)
+
+	for _, s := range r.Samples {
+		if values[s.Protocol] == nil {
+			values[s.Protocol] = make(map[string][]time.Duration)
+		}
+
+		for name, ms := range s.Metrics {
+			values[s.Protocol][name] = append(values[s.Protocol][name], time.Duration(ms*float64(time.Millisecond)))
+		}
+	}
+
+	toMs := func(d time.Duration) float64 {
+		return float64(d) / float64(time.Millisecond)
+	}
+
+	for protocol, metrics := range values {
+		r.Summary[protocol] = make(map[string]Summary)
+
+		for name, durations := range metrics {
+			s := stats.ComputeStats(durations)
+
+			r.Summary[protocol][name] = Summary{
+				Count:  len(durations),
+				Mean:   toMs(s.Mean),
+				Median: toMs(s.Median),
+				Min:    toMs(s.Min),
+				Max:    toMs(s.Max),
+				StdDev: toMs(s.StdDev),
+			}
+		}
+	}
+}
+
+// JSON renders the report as indented JSON
+func (r *Report) JSON() ([]byte, error) {
+	data, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode report: %w", err)
+	}
+
+	return data, nil
+}
+
+// htmlRow is one summary table row
+type htmlRow struct {
+	Protocol string
+	Metric   string
+	Summary
+}
+
+var htmlTemplate = template.Must(template.New("report").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>vtrace report {{.Report.RunID}}</title>
+<style>
+body { font-family: sans-serif; margin: 2em; }
+table { border-collapse: collapse; }
+th, td { border: 1px solid #ccc; padding: 4px 10px; text-align: right; }
+th:first-child, td:first-child, th:nth-child(2), td:nth-child(2) { text-align: left; }
+</style>
+</head>
+<body>
+<h1>vtrace report</h1>
+<p>URL: {{.Report.URL}}<br>
+Run ID: {{.Report.RunID}}<br>
+Started: {{.Report.StartedAt.Format "2006-01-02 15:04:05 MST"}}<br>
+Finished: {{.Report.FinishedAt.Format "2006-01-02 15:04:05 MST"}}<br>
+Samples: {{len .Report.Samples}}{{if .Failed}} ({{.Failed}} failed){{end}}</p>
+<table>
+<tr><th>Protocol</th><th>Metric</th><th>Count</th><th>Mean (ms)</th><th>Median (ms)</th><th>Min (ms)</th><th>Max (ms)</th><th>StdDev (ms)</th></tr>
+{{range .Rows}}<tr><td>{{.Protocol}}</td><td>{{.Metric}}</td><td>{{.Count}}</td><td>{{printf "%.2f" .Mean}}</td><td>{{printf "%.2f" .Median}}</td><td>{{printf "%.2f" .Min}}</td><td>{{printf "%.2f" .Max}}</td><td>{{printf "%.2f" .StdDev}}</td></tr>
+{{end}}</table>
+</body>
+</html>
+`))
+
+// HTML renders the report summary as a standalone HTML page
+func (r *Report) HTML() ([]byte, error) {
+	var rows []htmlRow
+
+	for protocol, metrics := range r.Summary {
+		for name, summary := range metrics {
+			rows = append(rows, htmlRow{Protocol: protocol, Metric: name, Summary: summary})
+		}
+	}
+
+	sort.Slice(rows, func(i, j int) bool {
+		if rows[i].Protocol != rows[j].Protocol {
+			return rows[i].Protocol < rows[j].Protocol
+		}
+
+		return rows[i].Metric < rows[j].Metric
+	})
+
+	failed := 0
+
+	for _, s := range r.Samples {
+		if s.Error != "" {
+			failed++
+		}
+	}
+
+	var buf bytes.Buffer
+
+	if err := htmlTemplate.Execute(&buf, struct {
+		Report *Report
+		Rows   []htmlRow
+		Failed int
+	}{r, rows, failed}); err != nil {
+		return nil, fmt.Errorf("failed to render report: %w", err)
+	}
+
+	return buf.Bytes(), nil
+}
+
+// CSV renders every sample as a CSV row with one column per metric
+func (r *Report) CSV() ([]byte, error) {
+	seen := make(map[string]bool)
+
+	for _, s := range r.Samples {
+		for name := range s.Metrics {
+			seen[name] = true
+		}
+	}
+
+	metrics := make([]string, 0, len(seen))
+
+	for name := range seen {
+		metrics = append(metrics, name)
+	}
+
+	sort.Strings(metrics)
+
+	var buf bytes.Buffer
+
+	w := csv.NewWriter(&buf)
+
+	header := []string{"time", "sample", "url", "protocol", "error"}
+
+	for _, name := range metrics {
+		header = append(header, name+"_ms")
+	}
+
+	w.Write(header)
+
+	for _, s := range r.Samples {
+		row := []string{s.Time.Format(time.RFC3339), strconv.Itoa(s.Index), s.URL, s.Protocol, s.Error}
+
+		for _, name := range metrics {
+			value, ok := s.Metrics[name]
+			if !ok {
+				row = append(row, "")
+
+				continue
+			}
+
+			row = append(row, strconv.FormatFloat(value, 'f', 3, 64))
+		}
+
+		w.Write(row)
+	}
+
+	w.Flush()
+
+	if err := w.Error(); err != nil {
+		return nil, fmt.Errorf("failed to render CSV: %w", err)
+	}
+
+	return buf.Bytes(), nil
+}
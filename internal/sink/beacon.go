@@ -0,0 +1,61 @@
+package sink
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// Beacon holds the summary payload emitted after each sample
+type Beacon struct {
+	RunID     string             `json:"run_id"`
+	URL       string             `json:"url"`
+	Sample    int                `json:"sample"`
+	Protocol  string             `json:"protocol"`
+	Timestamp time.Time          `json:"timestamp"`
+	Metrics   map[string]float64 `json:"metrics_ms"`
+	Decoder   string             `json:"frame_decoder,omitempty"`
+
+	// Negotiated holds the protocols of the "manifest" and "segment" requests
+	Negotiated map[string]Negotiated `json:"negotiated,omitempty"`
+}
+
+// Negotiated describes the HTTP version, TLS version, cipher suite, and ALPN protocol a
+// request actually ran over
+type Negotiated struct {
+	HTTP        string `json:"http"`
+	TLS         string `json:"tls,omitempty"`
+	CipherSuite string `json:"cipher_suite,omitempty"`
+	ALPN        string `json:"alpn,omitempty"`
+}
+
+// SendBeacon posts the beacon as JSON to the collector URL
+func SendBeacon(ctx context.Context, beaconURL string, beacon Beacon, client *http.Client) error {
+	payload, err := json.Marshal(beacon)
+	if err != nil {
+		return fmt.Errorf("failed to encode beacon: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, beaconURL, bytes.NewReader(payload))
+	if err != nil {
+		return fmt.Errorf("failed to create beacon request: %w", err)
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to send beacon: %w", err)
+	}
+	defer resp.Body.Close()
+
+	// Collectors commonly answer with 200 or 204
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("beacon collector returned status %d", resp.StatusCode)
+	}
+
+	return nil
+}
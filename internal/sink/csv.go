@@ -0,0 +1,66 @@
+package sink
+
+import (
+	"encoding/csv"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+)
+
+// CSVWriter streams one row per sample to a CSV file
+type CSVWriter struct {
+	file   *os.File
+	writer *csv.Writer
+}
+
+// NewCSVWriter creates (or truncates) a CSV file and writes the header row
+func NewCSVWriter(path string, header []string) (*CSVWriter, error) {
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create CSV file: %w", err)
+	}
+
+	w := &CSVWriter{file: f, writer: csv.NewWriter(f)}
+
+	if err := w.Write(header); err != nil {
+		f.Close()
+
+		return nil, err
+	}
+
+	return w, nil
+}
+
+// Write appends a row and flushes it so partial runs still leave usable data
+func (w *CSVWriter) Write(row []string) error {
+	if w == nil {
+		return nil
+	}
+
+	if err := w.writer.Write(row); err != nil {
+		return fmt.Errorf("failed to write CSV row: %w", err)
+	}
+
+	w.writer.Flush()
+
+	if err := w.writer.Error(); err != nil {
+		return fmt.Errorf("failed to write CSV row: %w", err)
+	}
+
+	return nil
+}
+
+// Close closes the underlying file
+func (w *CSVWriter) Close() error {
+	if w == nil {
+		return nil
+	}
+
+	return w.file.Close()
+}
+
+// FormatMillis renders a duration as fractional milliseconds for CSV cells
+func FormatMillis(d time.Duration) string {
+	return strconv.FormatFloat(float64(d)/float64(time.Millisecond), 'f', 3, 64)
+}
@@ -0,0 +1,124 @@
+package sink
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"mime"
+	"net"
+	"net/smtp"
+	"strings"
+	"time"
+)
+
+var ErrNoRecipients = errors.New("at least one email recipient is required")
+
+// SMTPConfig describes the relay used to deliver reports
+type SMTPConfig struct {
+	Server   string
+	From     string
+	To       []string
+	Username string
+	Password string
+}
+
+// Attachment is a file attached to an email
+type Attachment struct {
+	Name        string
+	ContentType string
+	Data        []byte
+}
+
+// SendEmail delivers an HTML message with attachments through an SMTP relay
+func SendEmail(cfg SMTPConfig, subject string, htmlBody []byte, attachments []Attachment) error {
+	if len(cfg.To) == 0 {
+		return ErrNoRecipients
+	}
+
+	server := cfg.Server
+
+	// Default to the submission port when none is given
+	if _, _, err := net.SplitHostPort(server); err != nil {
+		server = net.JoinHostPort(server, "587")
+	}
+
+	host, _, _ := net.SplitHostPort(server)
+
+	var auth smtp.Auth
+
+	if cfg.Username != "" {
+		auth = smtp.PlainAuth("", cfg.Username, cfg.Password, host)
+	}
+
+	message, err := buildMessage(cfg, subject, htmlBody, attachments, time.Now())
+	if err != nil {
+		return err
+	}
+
+	// smtp.SendMail upgrades to STARTTLS whenever the server offers it
+	if err := smtp.SendMail(server, auth, cfg.From, cfg.To, message); err != nil {
+		return fmt.Errorf("failed to send email: %w", err)
+	}
+
+	return nil
+}
+
+// buildMessage assembles a multipart/mixed MIME message
+func buildMessage(cfg SMTPConfig, subject string, htmlBody []byte, attachments []Attachment, now time.Time) ([]byte, error) {
+	boundary, err := mimeBoundary()
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+
+	fmt.Fprintf(&buf, "From: %s\r\n", cfg.From)
+	fmt.Fprintf(&buf, "To: %s\r\n", strings.Join(cfg.To, ", "))
+	fmt.Fprintf(&buf, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", subject))
+	fmt.Fprintf(&buf, "Date: %s\r\n", now.Format(time.RFC1123Z))
+	fmt.Fprintf(&buf, "MIME-Version: 1.0\r\n")
+	fmt.Fprintf(&buf, "Content-Type: multipart/mixed; boundary=%q\r\n\r\n", boundary)
+
+	fmt.Fprintf(&buf, "--%s\r\n", boundary)
+	fmt.Fprintf(&buf, "Content-Type: text/html; charset=utf-8\r\n")
+	fmt.Fprintf(&buf, "Content-Transfer-Encoding: base64\r\n\r\n")
+	writeBase64(&buf, htmlBody)
+
+	for _, a := range attachments {
+		fmt.Fprintf(&buf, "--%s\r\n", boundary)
+		fmt.Fprintf(&buf, "Content-Type: %s\r\n", a.ContentType)
+		fmt.Fprintf(&buf, "Content-Disposition: attachment; filename=%q\r\n", a.Name)
+		fmt.Fprintf(&buf, "Content-Transfer-Encoding: base64\r\n\r\n")
+		writeBase64(&buf, a.Data)
+	}
+
+	fmt.Fprintf(&buf, "--%s--\r\n", boundary)
+
+	return buf.Bytes(), nil
+}
+
+// writeBase64 writes data as base64 wrapped at 76 characters per line
+func writeBase64(buf *bytes.Buffer, data []byte) {
+	encoded := base64.StdEncoding.EncodeToString(data)
+
+	for len(encoded) > 76 {
+		buf.WriteString(encoded[:76] + "\r\n")
+		encoded = encoded[76:]
+	}
+
+	buf.WriteString(encoded + "\r\n")
+}
+
+// mimeBoundary returns a random multipart boundary
+func mimeBoundary() (string, error) {
+	b := make([]byte, 12)
+
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate MIME boundary: %w", err)
+	}
+
+	return "vtrace-" + hex.EncodeToString(b), nil
+}
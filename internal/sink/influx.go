@@ -0,0 +1,123 @@
+package sink
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	neturl "net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// influxMaxError caps how much of a rejected write's response body is reported
+const influxMaxError = 512
+
+var (
+	// influxMeasurementEscaper escapes the characters with meaning in a measurement name
+	influxMeasurementEscaper = strings.NewReplacer(`,`, `\,`, ` `, `\ `, "\n", `\n`)
+
+	// influxTagEscaper escapes the characters with meaning in tag keys, tag values, and field keys
+	influxTagEscaper = strings.NewReplacer(`,`, `\,`, `=`, `\=`, ` `, `\ `, "\n", `\n`)
+)
+
+// InfluxConfig addresses an InfluxDB 2.x (or 1.8+ with the v2 API) write endpoint
+type InfluxConfig struct {
+	URL    string
+	Org    string
+	Bucket string
+	Token  string
+}
+
+// InfluxLine formats a point in InfluxDB line protocol with nanosecond precision; tags with
+// empty values are left out, since line protocol cannot carry them
+func InfluxLine(measurement string, tags map[string]string, fields map[string]float64, at time.Time) string {
+	var b strings.Builder
+
+	b.WriteString(influxMeasurementEscaper.Replace(measurement))
+
+	for _, key := range sortedNames(tags) {
+		if tags[key] == "" {
+			continue
+		}
+
+		b.WriteString(",")
+		b.WriteString(influxTagEscaper.Replace(key))
+		b.WriteString("=")
+		b.WriteString(influxTagEscaper.Replace(tags[key]))
+	}
+
+	for i, key := range sortedNames(fields) {
+		if i == 0 {
+			b.WriteString(" ")
+		} else {
+			b.WriteString(",")
+		}
+
+		b.WriteString(influxTagEscaper.Replace(key))
+		b.WriteString("=")
+		b.WriteString(strconv.FormatFloat(fields[key], 'f', -1, 64))
+	}
+
+	b.WriteString(" ")
+	b.WriteString(strconv.FormatInt(at.UnixNano(), 10))
+
+	return b.String()
+}
+
+// WriteInflux posts lines of line protocol to the write endpoint of the configured bucket
+func WriteInflux(ctx context.Context, config InfluxConfig, lines []string, client *http.Client) error {
+	endpoint, err := neturl.Parse(strings.TrimSuffix(config.URL, "/") + "/api/v2/write")
+	if err != nil {
+		return fmt.Errorf("invalid influx url: %w", err)
+	}
+
+	query := neturl.Values{"bucket": {config.Bucket}, "precision": {"ns"}}
+
+	if config.Org != "" {
+		query.Set("org", config.Org)
+	}
+
+	endpoint.RawQuery = query.Encode()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint.String(), strings.NewReader(strings.Join(lines, "\n")+"\n"))
+	if err != nil {
+		return fmt.Errorf("failed to create influx request: %w", err)
+	}
+
+	req.Header.Set("Content-Type", "text/plain; charset=utf-8")
+
+	if config.Token != "" {
+		req.Header.Set("Authorization", "Token "+config.Token)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to write to influx: %w", err)
+	}
+	defer resp.Body.Close()
+
+	// A successful write answers 204; errors carry a JSON message worth showing
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, influxMaxError))
+
+		return fmt.Errorf("influx returned status %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+
+	return nil
+}
+
+// sortedNames returns the keys of a map in order, so lines are stable between samples
+func sortedNames[V any](m map[string]V) []string {
+	names := make([]string, 0, len(m))
+
+	for name := range m {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	return names
+}
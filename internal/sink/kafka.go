@@ -0,0 +1,109 @@
+package sink
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+	"github.com/segmentio/kafka-go/sasl"
+	"github.com/segmentio/kafka-go/sasl/plain"
+	"github.com/segmentio/kafka-go/sasl/scram"
+)
+
+var ErrUnknownSASLMechanism = errors.New("unknown SASL mechanism")
+
+// KafkaConfig describes how to reach the Kafka cluster
+type KafkaConfig struct {
+	Brokers       []string
+	Topic         string
+	TLS           bool
+	SASLMechanism string
+	Username      string
+	Password      string
+}
+
+// KafkaProducer publishes one message per sample to a topic
+type KafkaProducer struct {
+	writer *kafka.Writer
+}
+
+// NewKafkaProducer creates a synchronous producer for the configured topic
+func NewKafkaProducer(cfg KafkaConfig) (*KafkaProducer, error) {
+	if len(cfg.Brokers) == 0 {
+		return nil, errors.New("at least one Kafka broker is required")
+	}
+
+	if cfg.Topic == "" {
+		return nil, errors.New("a Kafka topic is required")
+	}
+
+	mechanism, err := saslMechanism(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	transport := &kafka.Transport{SASL: mechanism}
+
+	if cfg.TLS {
+		transport.TLS = &tls.Config{MinVersion: tls.VersionTLS12}
+	}
+
+	writer := &kafka.Writer{
+		Addr:         kafka.TCP(cfg.Brokers...),
+		Topic:        cfg.Topic,
+		Balancer:     &kafka.Hash{},
+		RequiredAcks: kafka.RequireOne,
+		BatchTimeout: 10 * time.Millisecond,
+		Transport:    transport,
+	}
+
+	return &KafkaProducer{writer: writer}, nil
+}
+
+// Send publishes a JSON-encoded value keyed for partitioning
+func (p *KafkaProducer) Send(ctx context.Context, key string, value any) error {
+	payload, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Errorf("failed to encode Kafka message: %w", err)
+	}
+
+	err = p.writer.WriteMessages(ctx, kafka.Message{
+		Key:   []byte(key),
+		Value: payload,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to publish Kafka message: %w", err)
+	}
+
+	return nil
+}
+
+// Close flushes pending messages and releases connections
+func (p *KafkaProducer) Close() error {
+	if p == nil {
+		return nil
+	}
+
+	return p.writer.Close()
+}
+
+// saslMechanism builds the SASL authenticator named in the config
+func saslMechanism(cfg KafkaConfig) (sasl.Mechanism, error) {
+	switch strings.ToLower(cfg.SASLMechanism) {
+	case "":
+		return nil, nil
+	case "plain":
+		return plain.Mechanism{Username: cfg.Username, Password: cfg.Password}, nil
+	case "scram-sha-256":
+		return scram.Mechanism(scram.SHA256, cfg.Username, cfg.Password)
+	case "scram-sha-512":
+		return scram.Mechanism(scram.SHA512, cfg.Username, cfg.Password)
+	}
+
+	return nil, fmt.Errorf("%w: %s", ErrUnknownSASLMechanism, cfg.SASLMechanism)
+}
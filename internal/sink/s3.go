@@ -0,0 +1,210 @@
+package sink
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+var (
+	ErrInvalidS3URL     = errors.New("upload target must look like s3://bucket/prefix")
+	ErrMissingS3Secrets = errors.New("AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY must be set")
+)
+
+// S3Target identifies a bucket and key prefix
+type S3Target struct {
+	Bucket string
+	Prefix string
+}
+
+// S3Credentials holds the settings needed to sign S3 requests
+type S3Credentials struct {
+	AccessKeyID     string
+	SecretAccessKey string
+	SessionToken    string
+	Region          string
+	Endpoint        string
+}
+
+// ParseS3URL splits an s3://bucket/prefix URL
+func ParseS3URL(raw string) (S3Target, error) {
+	parsed, err := url.Parse(raw)
+	if err != nil || parsed.Scheme != "s3" || parsed.Host == "" {
+		return S3Target{}, ErrInvalidS3URL
+	}
+
+	return S3Target{
+		Bucket: parsed.Host,
+		Prefix: strings.Trim(parsed.Path, "/"),
+	}, nil
+}
+
+// S3CredentialsFromEnv reads credentials and endpoint settings from the standard AWS variables
+func S3CredentialsFromEnv() (S3Credentials, error) {
+	creds := S3Credentials{
+		AccessKeyID:     os.Getenv("AWS_ACCESS_KEY_ID"),
+		SecretAccessKey: os.Getenv("AWS_SECRET_ACCESS_KEY"),
+		SessionToken:    os.Getenv("AWS_SESSION_TOKEN"),
+		Region:          os.Getenv("AWS_REGION"),
+		Endpoint:        os.Getenv("AWS_ENDPOINT_URL_S3"),
+	}
+
+	if creds.AccessKeyID == "" || creds.SecretAccessKey == "" {
+		return creds, ErrMissingS3Secrets
+	}
+
+	if creds.Region == "" {
+		creds.Region = os.Getenv("AWS_DEFAULT_REGION")
+	}
+
+	if creds.Region == "" {
+		creds.Region = "us-east-1"
+	}
+
+	if creds.Endpoint == "" {
+		creds.Endpoint = os.Getenv("AWS_ENDPOINT_URL")
+	}
+
+	return creds, nil
+}
+
+// Key joins the target prefix with an object name
+func (t S3Target) Key(name string) string {
+	if t.Prefix == "" {
+		return name
+	}
+
+	return t.Prefix + "/" + name
+}
+
+// PutS3Object uploads a single object using an AWS Signature Version 4 signed PUT
+func PutS3Object(ctx context.Context, creds S3Credentials, bucket, key, contentType string, body []byte, client *http.Client) error {
+	objectURL, err := s3ObjectURL(creds, bucket, key)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, objectURL.String(), bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create upload request: %w", err)
+	}
+
+	req.Header.Set("Content-Type", contentType)
+
+	signS3Request(req, creds, body, time.Now().UTC())
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to upload %s: %w", key, err)
+	}
+	defer resp.Body.Close()
+
+	// Check for HTTP errors
+	if resp.StatusCode != http.StatusOK {
+		detail, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+
+		return fmt.Errorf("upload of %s returned status %d: %s", key, resp.StatusCode, strings.TrimSpace(string(detail)))
+	}
+
+	return nil
+}
+
+// s3ObjectURL builds a virtual-hosted AWS URL or a path-style URL for custom endpoints
+func s3ObjectURL(creds S3Credentials, bucket, key string) (*url.URL, error) {
+	escapedKey := s3EscapePath(key)
+
+	if creds.Endpoint == "" {
+		return url.Parse(fmt.Sprintf("https://%s.s3.%s.amazonaws.com/%s", bucket, creds.Region, escapedKey))
+	}
+
+	endpoint, err := url.Parse(strings.TrimRight(creds.Endpoint, "/"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid S3 endpoint: %w", err)
+	}
+
+	return url.Parse(fmt.Sprintf("%s/%s/%s", endpoint.String(), bucket, escapedKey))
+}
+
+// signS3Request adds SigV4 authentication headers to an S3 request
+func signS3Request(req *http.Request, creds S3Credentials, body []byte, now time.Time) {
+	amzDate := now.Format("20060102T150405Z")
+	date := now.Format("20060102")
+	payloadHash := sha256Hex(body)
+
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+
+	signedHeaders := "host;x-amz-content-sha256;x-amz-date"
+	canonicalHeaders := fmt.Sprintf("host:%s\nx-amz-content-sha256:%s\nx-amz-date:%s\n", req.URL.Host, payloadHash, amzDate)
+
+	if creds.SessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", creds.SessionToken)
+
+		signedHeaders += ";x-amz-security-token"
+		canonicalHeaders += fmt.Sprintf("x-amz-security-token:%s\n", creds.SessionToken)
+	}
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		req.URL.RawQuery,
+		canonicalHeaders,
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	scope := fmt.Sprintf("%s/%s/s3/aws4_request", date, creds.Region)
+	stringToSign := strings.Join([]string{"AWS4-HMAC-SHA256", amzDate, scope, sha256Hex([]byte(canonicalRequest))}, "\n")
+
+	key := hmacSHA256([]byte("AWS4"+creds.SecretAccessKey), date)
+	key = hmacSHA256(key, creds.Region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		creds.AccessKeyID, scope, signedHeaders, signature))
+}
+
+// s3EscapePath percent-encodes an object key as SigV4 expects, keeping slashes
+func s3EscapePath(key string) string {
+	var b strings.Builder
+
+	for _, c := range []byte(key) {
+		switch {
+		case c >= 'A' && c <= 'Z', c >= 'a' && c <= 'z', c >= '0' && c <= '9',
+			c == '-', c == '_', c == '.', c == '~', c == '/':
+			b.WriteByte(c)
+		default:
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+
+	return b.String()
+}
+
+// sha256Hex returns the hex-encoded SHA-256 of data
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+
+	return hex.EncodeToString(sum[:])
+}
+
+// hmacSHA256 computes an HMAC-SHA256 of data with key
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+
+	return mac.Sum(nil)
+}
@@ -0,0 +1,164 @@
+package sink
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// zabbixHeader prefixes every Zabbix protocol message (magic plus version 1)
+var zabbixHeader = []byte("ZBXD\x01")
+
+// zabbixDefaultPort is the trapper port used when the server has no port
+const zabbixDefaultPort = "10051"
+
+// zabbixMaxResponse caps the size of a server reply we are willing to read
+const zabbixMaxResponse = 1 << 20
+
+var ErrZabbixRejected = errors.New("zabbix server rejected the data")
+
+// ZabbixItem is a single trapper item value
+type ZabbixItem struct {
+	Host  string `json:"host"`
+	Key   string `json:"key"`
+	Value string `json:"value"`
+	Clock int64  `json:"clock"`
+}
+
+// zabbixRequest is the sender data payload
+type zabbixRequest struct {
+	Request string       `json:"request"`
+	Data    []ZabbixItem `json:"data"`
+	Clock   int64        `json:"clock"`
+}
+
+// zabbixResponse is the server reply to a sender request
+type zabbixResponse struct {
+	Response string `json:"response"`
+	Info     string `json:"info"`
+}
+
+// ZabbixItems builds one trapper item per metric using keyPrefix+name as the item key
+func ZabbixItems(host, keyPrefix string, metrics map[string]float64, at time.Time) []ZabbixItem {
+	names := make([]string, 0, len(metrics))
+
+	for name := range metrics {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	items := make([]ZabbixItem, 0, len(names))
+
+	for _, name := range names {
+		items = append(items, ZabbixItem{
+			Host:  host,
+			Key:   keyPrefix + name,
+			Value: strconv.FormatFloat(metrics[name], 'f', -1, 64),
+			Clock: at.Unix(),
+		})
+	}
+
+	return items
+}
+
+// SendZabbix pushes item values to a Zabbix server or proxy using the sender protocol
+func SendZabbix(ctx context.Context, server string, items []ZabbixItem) (string, error) {
+	if _, _, err := net.SplitHostPort(server); err != nil {
+		server = net.JoinHostPort(server, zabbixDefaultPort)
+	}
+
+	payload, err := json.Marshal(zabbixRequest{
+		Request: "sender data",
+		Data:    items,
+		Clock:   time.Now().Unix(),
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to encode zabbix data: %w", err)
+	}
+
+	var dialer net.Dialer
+
+	conn, err := dialer.DialContext(ctx, "tcp", server)
+	if err != nil {
+		return "", fmt.Errorf("failed to connect to zabbix server: %w", err)
+	}
+	defer conn.Close()
+
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+
+	if _, err := conn.Write(zabbixFrame(payload)); err != nil {
+		return "", fmt.Errorf("failed to send zabbix data: %w", err)
+	}
+
+	body, err := readZabbixFrame(conn)
+	if err != nil {
+		return "", err
+	}
+
+	var resp zabbixResponse
+
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return "", fmt.Errorf("failed to decode zabbix response: %w", err)
+	}
+
+	if resp.Response != "success" {
+		return resp.Info, fmt.Errorf("%w: %s", ErrZabbixRejected, resp.Info)
+	}
+
+	// Items with unknown host/key pairs are counted as failed, not rejected
+	if strings.Contains(resp.Info, "failed: ") && !strings.Contains(resp.Info, "failed: 0;") {
+		return resp.Info, fmt.Errorf("%w: %s", ErrZabbixRejected, resp.Info)
+	}
+
+	return resp.Info, nil
+}
+
+// zabbixFrame wraps a payload in the Zabbix protocol header and length
+func zabbixFrame(payload []byte) []byte {
+	var buf bytes.Buffer
+
+	buf.Write(zabbixHeader)
+	binary.Write(&buf, binary.LittleEndian, uint64(len(payload)))
+	buf.Write(payload)
+
+	return buf.Bytes()
+}
+
+// readZabbixFrame reads and unwraps a single Zabbix protocol message
+func readZabbixFrame(r io.Reader) ([]byte, error) {
+	header := make([]byte, len(zabbixHeader)+8)
+
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, fmt.Errorf("failed to read zabbix response: %w", err)
+	}
+
+	if !bytes.Equal(header[:4], zabbixHeader[:4]) {
+		return nil, errors.New("invalid zabbix response header")
+	}
+
+	length := binary.LittleEndian.Uint64(header[len(zabbixHeader):])
+
+	if length > zabbixMaxResponse {
+		return nil, fmt.Errorf("zabbix response too large (%d bytes)", length)
+	}
+
+	body := make([]byte, length)
+
+	if _, err := io.ReadFull(r, body); err != nil {
+		return nil, fmt.Errorf("failed to read zabbix response: %w", err)
+	}
+
+	return body, nil
+}
@@ -0,0 +1,253 @@
+package slo
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"codeberg.org/pwnderpants/vtrace/internal/history"
+)
+
+// DefaultWindow is the compliance period used when an objective does not name one
+const DefaultWindow = 30 * 24 * time.Hour
+
+var (
+	ErrInvalidObjective = errors.New("invalid SLO")
+	ErrInvalidTarget    = errors.New("SLO target must be between 0 and 100 percent (exclusive)")
+	ErrInvalidThreshold = errors.New("SLO threshold must be positive")
+)
+
+// Objective requires Target of samples to finish under Threshold over Window
+type Objective struct {
+	Spec      string
+	Metric    string
+	Target    float64
+	Threshold time.Duration
+	Window    time.Duration
+}
+
+// BurnAlert is a multiwindow burn-rate rule: it fires when the error budget burns
+// faster than Rate over both the long and the short window
+type BurnAlert struct {
+	Severity string
+	Long     time.Duration
+	Short    time.Duration
+	Rate     float64
+}
+
+// DefaultBurnAlerts are the usual fast (page) and slow (ticket) burn rules for a 30-day budget
+var DefaultBurnAlerts = []BurnAlert{
+	{Severity: "page", Long: time.Hour, Short: 5 * time.Minute, Rate: 14.4},
+	{Severity: "ticket", Long: 6 * time.Hour, Short: 30 * time.Minute, Rate: 6},
+}
+
+// BurnRate is the budget burn rate measured over one window
+type BurnRate struct {
+	Window time.Duration
+	Rate   float64
+}
+
+// Alert is the evaluated state of one burn-rate rule
+type Alert struct {
+	BurnAlert
+	Firing bool
+}
+
+// Status is the evaluated state of one objective
+type Status struct {
+	Objective       Objective
+	Good            int
+	Bad             int
+	Compliance      float64
+	BudgetConsumed  float64
+	BudgetRemaining float64
+	BurnRates       []BurnRate
+	Alerts          []Alert
+}
+
+// ParseObjective parses "95%<1.5s" with an optional "/30d" window into an objective
+// on metric. Windows accept Go durations or a whole number of days ("30d").
+func ParseObjective(spec, metric string) (Objective, error) {
+	objective := Objective{Spec: spec, Metric: metric, Window: DefaultWindow}
+
+	rest := strings.TrimSpace(spec)
+
+	if body, window, ok := strings.Cut(rest, "/"); ok {
+		parsed, err := parseWindow(strings.TrimSpace(window))
+		if err != nil {
+			return Objective{}, fmt.Errorf("%w %q: %w", ErrInvalidObjective, spec, err)
+		}
+
+		objective.Window = parsed
+		rest = strings.TrimSpace(body)
+	}
+
+	target, threshold, ok := strings.Cut(rest, "<")
+	if !ok {
+		return Objective{}, fmt.Errorf("%w %q: expected TARGET%%<THRESHOLD[/WINDOW], e.g. 95%%<1.5s/30d", ErrInvalidObjective, spec)
+	}
+
+	percent, err := strconv.ParseFloat(strings.TrimSuffix(strings.TrimSpace(target), "%"), 64)
+	if err != nil {
+		return Objective{}, fmt.Errorf("%w %q: %w", ErrInvalidObjective, spec, err)
+	}
+
+	if percent <= 0 || percent >= 100 {
+		return Objective{}, fmt.Errorf("%w: %q", ErrInvalidTarget, spec)
+	}
+
+	objective.Target = percent / 100
+
+	objective.Threshold, err = time.ParseDuration(strings.TrimSpace(threshold))
+	if err != nil {
+		return Objective{}, fmt.Errorf("%w %q: %w", ErrInvalidObjective, spec, err)
+	}
+
+	if objective.Threshold <= 0 {
+		return Objective{}, fmt.Errorf("%w: %q", ErrInvalidThreshold, spec)
+	}
+
+	return objective, nil
+}
+
+// parseWindow accepts a Go duration or a number of days such as "30d"
+func parseWindow(value string) (time.Duration, error) {
+	if days, ok := strings.CutSuffix(value, "d"); ok {
+		n, err := strconv.Atoi(days)
+		if err != nil || n <= 0 {
+			return 0, fmt.Errorf("invalid window %q", value)
+		}
+
+		return time.Duration(n) * 24 * time.Hour, nil
+	}
+
+	window, err := time.ParseDuration(value)
+	if err != nil || window <= 0 {
+		return 0, fmt.Errorf("invalid window %q", value)
+	}
+
+	return window, nil
+}
+
+// ErrorBudget is the fraction of samples allowed to miss the threshold
+func (o Objective) ErrorBudget() float64 {
+	return 1 - o.Target
+}
+
+// bad reports whether a record misses the objective; failed samples always do
+func (o Objective) bad(record history.Record) bool {
+	if record.Error != "" {
+		return true
+	}
+
+	ms, ok := record.Metrics[o.Metric]
+	if !ok {
+		return false
+	}
+
+	return time.Duration(ms*float64(time.Millisecond)) > o.Threshold
+}
+
+// counts returns good and bad samples with timestamps in (now-window, now]
+func (o Objective) counts(records []history.Record, now time.Time, window time.Duration) (int, int) {
+	good, bad := 0, 0
+	from := now.Add(-window)
+
+	for _, record := range records {
+		if !record.Time.After(from) || record.Time.After(now) {
+			continue
+		}
+
+		if _, ok := record.Metrics[o.Metric]; !ok && record.Error == "" {
+			continue
+		}
+
+		if o.bad(record) {
+			bad++
+		} else {
+			good++
+		}
+	}
+
+	return good, bad
+}
+
+// burnRate is how many times faster than sustainable the budget burned over a window
+func (o Objective) burnRate(records []history.Record, now time.Time, window time.Duration) float64 {
+	good, bad := o.counts(records, now, window)
+	if good+bad == 0 {
+		return 0
+	}
+
+	return float64(bad) / float64(good+bad) / o.ErrorBudget()
+}
+
+// Evaluate computes compliance, budget consumption, and burn-rate alerts at now
+func Evaluate(o Objective, records []history.Record, now time.Time, alerts []BurnAlert) Status {
+	status := Status{Objective: o, BudgetRemaining: 1}
+
+	status.Good, status.Bad = o.counts(records, now, o.Window)
+
+	if total := status.Good + status.Bad; total > 0 {
+		status.Compliance = float64(status.Good) / float64(total)
+		status.BudgetConsumed = float64(status.Bad) / float64(total) / o.ErrorBudget()
+		status.BudgetRemaining = 1 - status.BudgetConsumed
+	}
+
+	rates := make(map[time.Duration]float64)
+
+	rate := func(window time.Duration) float64 {
+		if r, ok := rates[window]; ok {
+			return r
+		}
+
+		r := o.burnRate(records, now, window)
+		rates[window] = r
+
+		status.BurnRates = append(status.BurnRates, BurnRate{Window: window, Rate: r})
+
+		return r
+	}
+
+	for _, alert := range alerts {
+		long, short := rate(alert.Long), rate(alert.Short)
+
+		status.Alerts = append(status.Alerts, Alert{
+			BurnAlert: alert,
+			Firing:    long >= alert.Rate && short >= alert.Rate,
+		})
+	}
+
+	return status
+}
+
+// Longest returns the longest window any objective or alert needs, for querying history
+func Longest(objectives []Objective, alerts []BurnAlert) time.Duration {
+	var longest time.Duration
+
+	for _, o := range objectives {
+		longest = max(longest, o.Window)
+	}
+
+	for _, a := range alerts {
+		longest = max(longest, a.Long, a.Short)
+	}
+
+	return longest
+}
+
+// FormatWindow renders a window compactly, e.g. "30d", "6h", or "5m"
+func FormatWindow(window time.Duration) string {
+	switch {
+	case window%(24*time.Hour) == 0:
+		return fmt.Sprintf("%dd", window/(24*time.Hour))
+	case window%time.Hour == 0:
+		return fmt.Sprintf("%dh", window/time.Hour)
+	case window%time.Minute == 0:
+		return fmt.Sprintf("%dm", window/time.Minute)
+	}
+
+	return window.String()
+}
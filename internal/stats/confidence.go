@@ -0,0 +1,65 @@
+package stats
+
+import (
+	"math"
+	"time"
+)
+
+// ConfidenceInterval is a two-sided Student t interval for a sample mean
+type ConfidenceInterval struct {
+	Level  float64
+	Mean   time.Duration
+	Margin time.Duration
+}
+
+// MeanConfidenceInterval returns the interval around the mean at level percent (e.g. 95).
+// With fewer than two samples the margin is unknown and reported as -1.
+func MeanConfidenceInterval(durations []time.Duration, level float64) ConfidenceInterval {
+	ci := ConfidenceInterval{Level: level, Margin: -1}
+
+	if len(durations) == 0 {
+		return ci
+	}
+
+	ci.Mean = computeMean(durations)
+
+	if len(durations) < 2 {
+		return ci
+	}
+
+	mean, variance := meanVariance(durations)
+	n := float64(len(durations))
+	t := StudentTQuantile(1-level/100, n-1)
+
+	ci.Mean = time.Duration(mean * float64(time.Millisecond))
+	ci.Margin = time.Duration(t * math.Sqrt(variance/n) * float64(time.Millisecond))
+
+	return ci
+}
+
+// RelativeMargin returns the margin as a fraction of the mean, or +Inf when unknown
+func (c ConfidenceInterval) RelativeMargin() float64 {
+	if c.Margin < 0 || c.Mean <= 0 {
+		return math.Inf(1)
+	}
+
+	return float64(c.Margin) / float64(c.Mean)
+}
+
+// StudentTQuantile returns the critical t value whose two-sided tail probability is alpha
+func StudentTQuantile(alpha, df float64) float64 {
+	// The two-sided tail probability falls monotonically as t grows, so bisect on it
+	low, high := 0.0, 1e6
+
+	for range 200 {
+		mid := (low + high) / 2
+
+		if regIncompleteBeta(df/2, 0.5, df/(df+mid*mid)) > alpha {
+			low = mid
+		} else {
+			high = mid
+		}
+	}
+
+	return (low + high) / 2
+}
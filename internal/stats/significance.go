@@ -0,0 +1,261 @@
+package stats
+
+import (
+	"math"
+	"sort"
+	"time"
+)
+
+// TTestResult holds the outcome of a two-sided Welch's t-test
+type TTestResult struct {
+	T  float64
+	DF float64
+	P  float64
+}
+
+// UTestResult holds the outcome of a two-sided Mann-Whitney U test
+type UTestResult struct {
+	U float64
+	Z float64
+	P float64
+}
+
+// WelchTTest compares the means of two samples without assuming equal variances
+func WelchTTest(a, b []time.Duration) TTestResult {
+	if len(a) < 2 || len(b) < 2 {
+		return TTestResult{P: math.NaN()}
+	}
+
+	na, nb := float64(len(a)), float64(len(b))
+	meanA, varA := meanVariance(a)
+	meanB, varB := meanVariance(b)
+
+	seA := varA / na
+	seB := varB / nb
+	se := math.Sqrt(seA + seB)
+
+	// Identical constant samples cannot be told apart
+	if se == 0 {
+		if meanA == meanB {
+			return TTestResult{P: 1}
+		}
+
+		return TTestResult{T: math.Inf(sign(meanA - meanB)), P: 0}
+	}
+
+	t := (meanA - meanB) / se
+	df := (seA + seB) * (seA + seB) / (seA*seA/(na-1) + seB*seB/(nb-1))
+
+	// Two-sided p-value from the Student t distribution
+	p := regIncompleteBeta(df/2, 0.5, df/(df+t*t))
+
+	return TTestResult{T: t, DF: df, P: p}
+}
+
+// MannWhitneyU compares the distributions of two samples using ranks, with a
+// tie-corrected normal approximation and continuity correction
+func MannWhitneyU(a, b []time.Duration) UTestResult {
+	if len(a) == 0 || len(b) == 0 {
+		return UTestResult{P: math.NaN()}
+	}
+
+	type ranked struct {
+		value time.Duration
+		fromA bool
+	}
+
+	all := make([]ranked, 0, len(a)+len(b))
+
+	for _, d := range a {
+		all = append(all, ranked{d, true})
+	}
+
+	for _, d := range b {
+		all = append(all, ranked{d, false})
+	}
+
+	sort.Slice(all, func(i, j int) bool {
+		return all[i].value < all[j].value
+	})
+
+	var rankSumA, tieTerm float64
+
+	// Tied values share the average of the ranks they span
+	for i := 0; i < len(all); {
+		j := i
+
+		for j < len(all) && all[j].value == all[i].value {
+			j++
+		}
+
+		rank := float64(i+j+1) / 2
+		ties := float64(j - i)
+		tieTerm += ties*ties*ties - ties
+
+		for k := i; k < j; k++ {
+			if all[k].fromA {
+				rankSumA += rank
+			}
+		}
+
+		i = j
+	}
+
+	na, nb := float64(len(a)), float64(len(b))
+	n := na + nb
+	u := rankSumA - na*(na+1)/2
+	mu := na * nb / 2
+	sigma := math.Sqrt(na * nb / 12 * ((n + 1) - tieTerm/(n*(n-1))))
+
+	if sigma == 0 {
+		return UTestResult{U: u, P: 1}
+	}
+
+	diff := u - mu
+
+	if diff > 0 {
+		diff = math.Max(diff-0.5, 0)
+	} else {
+		diff = math.Min(diff+0.5, 0)
+	}
+
+	z := diff / sigma
+
+	return UTestResult{U: u, Z: z, P: math.Erfc(math.Abs(z) / math.Sqrt2)}
+}
+
+// meanVariance returns the mean and sample variance in milliseconds
+func meanVariance(durations []time.Duration) (float64, float64) {
+	var sum float64
+
+	for _, d := range durations {
+		sum += toMillis(d)
+	}
+
+	mean := sum / float64(len(durations))
+
+	var sumSquares float64
+
+	for _, d := range durations {
+		diff := toMillis(d) - mean
+		sumSquares += diff * diff
+	}
+
+	return mean, sumSquares / float64(len(durations)-1)
+}
+
+// toMillis converts a duration to fractional milliseconds
+func toMillis(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
+
+// sign returns 1 for non-negative values and -1 otherwise
+func sign(x float64) int {
+	if x < 0 {
+		return -1
+	}
+
+	return 1
+}
+
+// regIncompleteBeta evaluates the regularized incomplete beta function I_x(a, b)
+func regIncompleteBeta(a, b, x float64) float64 {
+	if x <= 0 {
+		return 0
+	}
+
+	if x >= 1 {
+		return 1
+	}
+
+	lgA, _ := math.Lgamma(a)
+	lgB, _ := math.Lgamma(b)
+	lgAB, _ := math.Lgamma(a + b)
+
+	front := math.Exp(lgAB - lgA - lgB + a*math.Log(x) + b*math.Log(1-x))
+
+	// The continued fraction converges quickly only below the mean
+	if x < (a+1)/(a+b+2) {
+		return front * betaContinuedFraction(a, b, x) / a
+	}
+
+	return 1 - front*betaContinuedFraction(b, a, 1-x)/b
+}
+
+// betaContinuedFraction evaluates the incomplete beta continued fraction (modified Lentz)
+func betaContinuedFraction(a, b, x float64) float64 {
+	const (
+		maxIterations = 300
+		epsilon       = 1e-14
+		tiny          = 1e-300
+	)
+
+	c := 1.0
+	d := 1 - (a+b)*x/(a+1)
+
+	if math.Abs(d) < tiny {
+		d = tiny
+	}
+
+	d = 1 / d
+	h := d
+
+	for m := 1; m <= maxIterations; m++ {
+		fm := float64(m)
+
+		// Even step
+		num := fm * (b - fm) * x / ((a + 2*fm - 1) * (a + 2*fm))
+
+		d = 1 + num*d
+		if math.Abs(d) < tiny {
+			d = tiny
+		}
+
+		c = 1 + num/c
+		if math.Abs(c) < tiny {
+			c = tiny
+		}
+
+		d = 1 / d
+		h *= d * c
+
+		// Odd step
+		num = -(a + fm) * (a + b + fm) * x / ((a + 2*fm) * (a + 2*fm + 1))
+
+		d = 1 + num*d
+		if math.Abs(d) < tiny {
+			d = tiny
+		}
+
+		c = 1 + num/c
+		if math.Abs(c) < tiny {
+			c = tiny
+		}
+
+		d = 1 / d
+		delta := d * c
+		h *= delta
+
+		if math.Abs(delta-1) < epsilon {
+			break
+		}
+	}
+
+	return h
+}
+
+// Stars returns the conventional significance marker for a p-value ("***", "**", "*", or "")
+func Stars(p float64) string {
+	switch {
+	case math.IsNaN(p):
+		return ""
+	case p < 0.001:
+		return "***"
+	case p < 0.01:
+		return "**"
+	case p < 0.05:
+		return "*"
+	}
+
+	return ""
+}
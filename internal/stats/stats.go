@@ -14,9 +14,58 @@ type Sample struct {
 	QUICHandshake  time.Duration
 	ManifestTTFB   time.Duration
 	ManifestTotal  time.Duration
+	KeyFetch       time.Duration
+	InitSegment    time.Duration
 	SegmentTotal   time.Duration
+	PartDownload   time.Duration
+	BlockingReload time.Duration
 	FrameDetection time.Duration
 	TotalTTFF      time.Duration
+	AudioPlaylist  time.Duration
+	AudioSegment   time.Duration
+	AudioDetection time.Duration
+	TotalTTFA      time.Duration
+	PlayerJoin     time.Duration
+	ManifestProto  string
+	SegmentProto   string
+	FrameDecoder   string
+	FailedConnects int
+
+	// MediaPlaylist is the fetch of the media playlist a master playlist pointed to; like the
+	// LL-HLS BlockingReload it precedes the segment but is not part of TotalTTFF
+	MediaPlaylist time.Duration
+
+	// SegmentDownloads are the downloads averaged into SegmentTotal with --segments, in
+	// playlist order
+	SegmentDownloads []time.Duration
+
+	// LiveEdgeDistance is how far behind the end of a live playlist the measured segment
+	// started with --live-edge, and LiveEdgeSegments how many segments that spans
+	LiveEdgeDistance time.Duration
+	LiveEdgeSegments int
+
+	// Redirects is the time spent following redirects before the manifest request; it is
+	// part of the manifest fetch in TotalTTFF
+	Redirects time.Duration
+
+	// ManifestBytes and SegmentBytes are the body sizes of the manifest and segment, and
+	// ManifestThroughput and SegmentThroughput their effective download rates in bits per second
+	ManifestBytes      int64
+	SegmentBytes       int64
+	ManifestThroughput float64
+	SegmentThroughput  float64
+
+	// DeclaredBandwidth is the BANDWIDTH of the measured variant (or the bandwidth of the DASH
+	// representation) in bits per second, zero when the URL named a media playlist
+	DeclaredBandwidth int64
+
+	// Variant names the measured variant as RESOLUTION@BANDWIDTH (or the DASH representation
+	// the same way), empty when the URL named a media playlist
+	Variant string
+
+	// LiveLatency is how far behind the live edge of a dynamic DASH presentation the first
+	// frame was when detected
+	LiveLatency time.Duration
 }
 
 // Outlier represents a sample identified as an outlier
@@ -26,37 +75,66 @@ type Outlier struct {
 	Deviation float64
 }
 
+// DefaultPercentiles are the tail percentile ranks ComputeStats reports
+var DefaultPercentiles = []float64{90, 95, 99}
+
 // Stats holds computed statistics for a set of duration samples
 type Stats struct {
-	Mean   time.Duration
-	Median time.Duration
-	Min    time.Duration
-	Max    time.Duration
-	StdDev time.Duration
+	Mean        time.Duration
+	Median      time.Duration
+	Min         time.Duration
+	Max         time.Duration
+	StdDev      time.Duration
+	Percentiles []Percentile
+}
+
+// Percentile is the value at a percentile rank (0-100) of a set of durations
+type Percentile struct {
+	Rank  float64
+	Value time.Duration
+}
+
+// Percentile returns the value computed for rank, or zero if it was not requested
+func (s Stats) Percentile(rank float64) time.Duration {
+	for _, p := range s.Percentiles {
+		if p.Rank == rank {
+			return p.Value
+		}
+	}
+
+	return 0
 }
 
-// ComputeStats calculates statistics for a slice of durations
+// ComputeStats calculates statistics for a slice of durations, including DefaultPercentiles
 func ComputeStats(durations []time.Duration) Stats {
+	return ComputeStatsWithPercentiles(durations, DefaultPercentiles)
+}
+
+// ComputeStatsWithPercentiles calculates statistics for a slice of durations at the given percentile ranks
+func ComputeStatsWithPercentiles(durations []time.Duration, ranks []float64) Stats {
 	if len(durations) == 0 {
 		return Stats{}
 	}
 
+	sorted := sortDurations(durations)
+
+	percentiles := make([]Percentile, len(ranks))
+
+	for i, rank := range ranks {
+		percentiles[i] = Percentile{Rank: rank, Value: computeQuartile(sorted, rank/100)}
+	}
+
 	if len(durations) == 1 {
 		return Stats{
-			Mean:   durations[0],
-			Median: durations[0],
-			Min:    durations[0],
-			Max:    durations[0],
-			StdDev: 0,
+			Mean:        durations[0],
+			Median:      durations[0],
+			Min:         durations[0],
+			Max:         durations[0],
+			StdDev:      0,
+			Percentiles: percentiles,
 		}
 	}
 
-	sorted := make([]time.Duration, len(durations))
-	copy(sorted, durations)
-	sort.Slice(sorted, func(i, j int) bool {
-		return sorted[i] < sorted[j]
-	})
-
 	min := sorted[0]
 	max := sorted[len(sorted)-1]
 	median := computeMedian(sorted)
@@ -64,14 +142,31 @@ func ComputeStats(durations []time.Duration) Stats {
 	stdDev := computeStdDev(durations, mean)
 
 	return Stats{
-		Mean:   mean,
-		Median: median,
-		Min:    min,
-		Max:    max,
-		StdDev: stdDev,
+		Mean:        mean,
+		Median:      median,
+		Min:         min,
+		Max:         max,
+		StdDev:      stdDev,
+		Percentiles: percentiles,
 	}
 }
 
+// ComputePercentile returns the value at a percentile rank (0-100), interpolating between samples
+func ComputePercentile(durations []time.Duration, rank float64) time.Duration {
+	return computeQuartile(sortDurations(durations), rank/100)
+}
+
+// sortDurations returns a sorted copy of durations
+func sortDurations(durations []time.Duration) []time.Duration {
+	sorted := make([]time.Duration, len(durations))
+	copy(sorted, durations)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i] < sorted[j]
+	})
+
+	return sorted
+}
+
 // computeMean calculates the arithmetic mean of durations
 func computeMean(durations []time.Duration) time.Duration {
 	if len(durations) == 0 {
@@ -128,11 +223,7 @@ func DetectOutliers(durations []time.Duration) []Outlier {
 		return nil
 	}
 
-	sorted := make([]time.Duration, len(durations))
-	copy(sorted, durations)
-	sort.Slice(sorted, func(i, j int) bool {
-		return sorted[i] < sorted[j]
-	})
+	sorted := sortDurations(durations)
 
 	q1 := computeQuartile(sorted, 0.25)
 	q3 := computeQuartile(sorted, 0.75)
@@ -279,6 +370,56 @@ func ExtractSegmentTotal(samples []Sample) []time.Duration {
 	return durations
 }
 
+// ExtractRedirects extracts Redirects from a slice of samples
+func ExtractRedirects(samples []Sample) []time.Duration {
+	return extract(samples, func(s Sample) time.Duration { return s.Redirects })
+}
+
+// ExtractKeyFetch extracts KeyFetch from a slice of samples
+func ExtractKeyFetch(samples []Sample) []time.Duration {
+	return extract(samples, func(s Sample) time.Duration { return s.KeyFetch })
+}
+
+// ExtractInitSegment extracts InitSegment from a slice of samples
+func ExtractInitSegment(samples []Sample) []time.Duration {
+	return extract(samples, func(s Sample) time.Duration { return s.InitSegment })
+}
+
+// ExtractBlockingReload extracts BlockingReload from a slice of samples
+func ExtractBlockingReload(samples []Sample) []time.Duration {
+	return extract(samples, func(s Sample) time.Duration { return s.BlockingReload })
+}
+
+// ExtractAudioPlaylist extracts AudioPlaylist from a slice of samples
+func ExtractAudioPlaylist(samples []Sample) []time.Duration {
+	return extract(samples, func(s Sample) time.Duration { return s.AudioPlaylist })
+}
+
+// ExtractAudioSegment extracts AudioSegment from a slice of samples
+func ExtractAudioSegment(samples []Sample) []time.Duration {
+	return extract(samples, func(s Sample) time.Duration { return s.AudioSegment })
+}
+
+// ExtractAudioDetection extracts AudioDetection from a slice of samples
+func ExtractAudioDetection(samples []Sample) []time.Duration {
+	return extract(samples, func(s Sample) time.Duration { return s.AudioDetection })
+}
+
+// ExtractTotalTTFA extracts TotalTTFA from a slice of samples
+func ExtractTotalTTFA(samples []Sample) []time.Duration {
+	return extract(samples, func(s Sample) time.Duration { return s.TotalTTFA })
+}
+
+// ExtractLiveEdgeDistance extracts LiveEdgeDistance from a slice of samples
+func ExtractLiveEdgeDistance(samples []Sample) []time.Duration {
+	return extract(samples, func(s Sample) time.Duration { return s.LiveEdgeDistance })
+}
+
+// ExtractPlayerJoin extracts PlayerJoin from a slice of samples
+func ExtractPlayerJoin(samples []Sample) []time.Duration {
+	return extract(samples, func(s Sample) time.Duration { return s.PlayerJoin })
+}
+
 // ExtractFrameDetection extracts FrameDetection from a slice of samples
 func ExtractFrameDetection(samples []Sample) []time.Duration {
 	durations := make([]time.Duration, len(samples))
@@ -290,14 +431,33 @@ func ExtractFrameDetection(samples []Sample) []time.Duration {
 	return durations
 }
 
+// ProtocolCounts tallies the negotiated HTTP versions seen across manifest and segment requests
+func ProtocolCounts(samples []Sample) map[string]int {
+	counts := make(map[string]int)
+
+	for _, s := range samples {
+		if s.ManifestProto != "" {
+			counts[s.ManifestProto]++
+		}
+
+		if s.SegmentProto != "" {
+			counts[s.SegmentProto]++
+		}
+	}
+
+	return counts
+}
+
 // AssetSample holds timing data from a single TTFB measurement for any asset
 type AssetSample struct {
-	DNSLookup     time.Duration
-	TCPConnect    time.Duration
-	TLSHandshake  time.Duration
-	QUICHandshake time.Duration
-	TTFB          time.Duration
-	TotalTime     time.Duration
+	DNSLookup      time.Duration
+	TCPConnect     time.Duration
+	TLSHandshake   time.Duration
+	QUICHandshake  time.Duration
+	TTFB           time.Duration
+	TotalTime      time.Duration
+	Proto          string
+	FailedConnects int
 }
 
 // ExtractAssetTTFB extracts TTFB from a slice of asset samples
@@ -365,3 +525,73 @@ func ExtractAssetQUICHandshake(samples []AssetSample) []time.Duration {
 
 	return durations
 }
+
+// AssetProtocolCounts tallies the negotiated HTTP versions seen across asset samples
+func AssetProtocolCounts(samples []AssetSample) map[string]int {
+	counts := make(map[string]int)
+
+	for _, s := range samples {
+		if s.Proto != "" {
+			counts[s.Proto]++
+		}
+	}
+
+	return counts
+}
+
+// PhaseSummary holds statistics for each TTFF phase across a set of samples
+type PhaseSummary struct {
+	Count          int
+	DNSLookup      Stats
+	ManifestTTFB   Stats
+	ManifestTotal  Stats
+	SegmentTotal   Stats
+	FrameDetection Stats
+	TotalTTFF      Stats
+}
+
+// SummarizePhases computes per-phase statistics for a set of samples
+func SummarizePhases(samples []Sample) PhaseSummary {
+	return PhaseSummary{
+		Count:          len(samples),
+		DNSLookup:      ComputeStats(ExtractDNSLookup(samples)),
+		ManifestTTFB:   ComputeStats(ExtractManifestTTFB(samples)),
+		ManifestTotal:  ComputeStats(extract(samples, func(s Sample) time.Duration { return s.ManifestTotal })),
+		SegmentTotal:   ComputeStats(ExtractSegmentTotal(samples)),
+		FrameDetection: ComputeStats(ExtractFrameDetection(samples)),
+		TotalTTFF:      ComputeStats(ExtractTotalTTFF(samples)),
+	}
+}
+
+// FastestSlowest returns the indexes of the summaries with the lowest and highest
+// mean TTFF, skipping empty summaries; both are -1 when every summary is empty
+func FastestSlowest(summaries []PhaseSummary) (int, int) {
+	fastest, slowest := -1, -1
+
+	for i, s := range summaries {
+		if s.Count == 0 {
+			continue
+		}
+
+		if fastest < 0 || s.TotalTTFF.Mean < summaries[fastest].TotalTTFF.Mean {
+			fastest = i
+		}
+
+		if slowest < 0 || s.TotalTTFF.Mean > summaries[slowest].TotalTTFF.Mean {
+			slowest = i
+		}
+	}
+
+	return fastest, slowest
+}
+
+// extract maps samples to one duration field
+func extract(samples []Sample, field func(Sample) time.Duration) []time.Duration {
+	durations := make([]time.Duration, len(samples))
+
+	for i, s := range samples {
+		durations[i] = field(s)
+	}
+
+	return durations
+}
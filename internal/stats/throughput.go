@@ -0,0 +1,92 @@
+package stats
+
+import (
+	"math"
+	"sort"
+)
+
+// ValueStats holds statistics for a set of plain values, such as sizes or rates
+type ValueStats struct {
+	Mean   float64
+	Median float64
+	Min    float64
+	Max    float64
+	StdDev float64
+}
+
+// ComputeValueStats calculates statistics for a slice of values
+func ComputeValueStats(values []float64) ValueStats {
+	if len(values) == 0 {
+		return ValueStats{}
+	}
+
+	sorted := make([]float64, len(values))
+	copy(sorted, values)
+	sort.Float64s(sorted)
+
+	var sum float64
+
+	for _, v := range values {
+		sum += v
+	}
+
+	mean := sum / float64(len(values))
+
+	n := len(sorted)
+	median := sorted[n/2]
+
+	if n%2 == 0 {
+		median = (sorted[n/2-1] + sorted[n/2]) / 2
+	}
+
+	var stdDev float64
+
+	if n > 1 {
+		var sumSquares float64
+
+		for _, v := range values {
+			sumSquares += (v - mean) * (v - mean)
+		}
+
+		stdDev = math.Sqrt(sumSquares / float64(n-1))
+	}
+
+	return ValueStats{
+		Mean:   mean,
+		Median: median,
+		Min:    sorted[0],
+		Max:    sorted[n-1],
+		StdDev: stdDev,
+	}
+}
+
+// ExtractManifestBytes extracts ManifestBytes from a slice of samples
+func ExtractManifestBytes(samples []Sample) []float64 {
+	return extractValues(samples, func(s Sample) float64 { return float64(s.ManifestBytes) })
+}
+
+// ExtractSegmentBytes extracts SegmentBytes from a slice of samples
+func ExtractSegmentBytes(samples []Sample) []float64 {
+	return extractValues(samples, func(s Sample) float64 { return float64(s.SegmentBytes) })
+}
+
+// ExtractManifestThroughput extracts ManifestThroughput from a slice of samples
+func ExtractManifestThroughput(samples []Sample) []float64 {
+	return extractValues(samples, func(s Sample) float64 { return s.ManifestThroughput })
+}
+
+// ExtractSegmentThroughput extracts SegmentThroughput from a slice of samples
+func ExtractSegmentThroughput(samples []Sample) []float64 {
+	return extractValues(samples, func(s Sample) float64 { return s.SegmentThroughput })
+}
+
+// extractValues maps samples to one numeric field
+func extractValues(samples []Sample, field func(Sample) float64) []float64 {
+	values := make([]float64, len(samples))
+
+	for i, s := range samples {
+		values[i] = field(s)
+	}
+
+	return values
+}
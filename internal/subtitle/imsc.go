@@ -0,0 +1,253 @@
+package subtitle
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ttmlParameterNS is the namespace of ttp:frameRate and ttp:tickRate
+const ttmlParameterNS = "http://www.w3.org/ns/ttml#parameter"
+
+// ttmlClock holds the document rates that frame and tick time expressions refer to
+type ttmlClock struct {
+	frameRate float64
+	tickRate  float64
+}
+
+// parseIMSC reads the begin, end, and dur attributes of every timed element; child times
+// are offsets from the parent's begin, and each timed <p> counts as a cue
+func parseIMSC(data []byte) *Report {
+	report := &Report{Format: FormatIMSC}
+	decoder := xml.NewDecoder(bytes.NewReader(data))
+	clock := ttmlClock{frameRate: 30, tickRate: 1}
+
+	// Begin offsets of the open elements, so nested times can be made absolute
+	var parents []time.Duration
+
+	rootSeen := false
+
+	for {
+		token, err := decoder.Token()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+
+		if err != nil {
+			report.Issues = append(report.Issues, fmt.Sprintf("malformed TTML: %v", err))
+
+			break
+		}
+
+		switch element := token.(type) {
+		case xml.StartElement:
+			if !rootSeen {
+				rootSeen = true
+
+				if element.Name.Local != "tt" {
+					report.Issues = append(report.Issues, fmt.Sprintf("root element is <%s>, not <tt>", element.Name.Local))
+				}
+
+				clock = documentClock(element, report)
+			}
+
+			offset := time.Duration(0)
+
+			if len(parents) > 0 {
+				offset = parents[len(parents)-1]
+			}
+
+			cue, timed, err := elementTiming(element, clock)
+
+			switch {
+			case err != nil:
+				report.Issues = append(report.Issues, fmt.Sprintf("<%s>: %v", element.Name.Local, err))
+			case timed:
+				cue.Start += offset
+				cue.End += offset
+
+				if element.Name.Local == "p" {
+					report.Cues = append(report.Cues, cue)
+				}
+
+				offset = cue.Start
+			}
+
+			parents = append(parents, offset)
+		case xml.EndElement:
+			if len(parents) > 0 {
+				parents = parents[:len(parents)-1]
+			}
+		}
+	}
+
+	if !rootSeen {
+		report.Issues = append(report.Issues, "TTML document has no root element")
+	}
+
+	return report
+}
+
+// documentClock reads ttp:frameRate and ttp:tickRate from the root element
+func documentClock(root xml.StartElement, report *Report) ttmlClock {
+	clock := ttmlClock{frameRate: 30, tickRate: 1}
+
+	for _, attr := range root.Attr {
+		if attr.Name.Space != ttmlParameterNS {
+			continue
+		}
+
+		var target *float64
+
+		switch attr.Name.Local {
+		case "frameRate":
+			target = &clock.frameRate
+		case "tickRate":
+			target = &clock.tickRate
+		default:
+			continue
+		}
+
+		rate, err := strconv.ParseFloat(attr.Value, 64)
+		if err != nil || rate <= 0 {
+			report.Issues = append(report.Issues, fmt.Sprintf("invalid ttp:%s %q", attr.Name.Local, attr.Value))
+
+			continue
+		}
+
+		*target = rate
+	}
+
+	return clock
+}
+
+// elementTiming reads begin, end, and dur; it reports false when the element has no
+// begin or end of its own
+func elementTiming(element xml.StartElement, clock ttmlClock) (Cue, bool, error) {
+	var (
+		begin, end, dur          time.Duration
+		hasBegin, hasEnd, hasDur bool
+	)
+
+	for _, attr := range element.Attr {
+		if attr.Name.Space != "" {
+			continue
+		}
+
+		var (
+			target *time.Duration
+			flag   *bool
+		)
+
+		switch attr.Name.Local {
+		case "begin":
+			target, flag = &begin, &hasBegin
+		case "end":
+			target, flag = &end, &hasEnd
+		case "dur":
+			target, flag = &dur, &hasDur
+		default:
+			continue
+		}
+
+		value, err := parseTimeExpression(attr.Value, clock)
+		if err != nil {
+			return Cue{}, false, fmt.Errorf("%s: %w", attr.Name.Local, err)
+		}
+
+		*target, *flag = value, true
+	}
+
+	if !hasEnd && hasDur {
+		end, hasEnd = begin+dur, true
+	}
+
+	if !hasBegin && !hasEnd {
+		return Cue{}, false, nil
+	}
+
+	if hasEnd && end <= begin {
+		return Cue{}, false, fmt.Errorf("ends at %s, not after its begin at %s", end, begin)
+	}
+
+	return Cue{Start: begin, End: end}, true, nil
+}
+
+// parseTimeExpression reads TTML clock times (hh:mm:ss, hh:mm:ss.fff, hh:mm:ss:ff) and
+// offset times (10s, 1.5m, 500ms, 25f, 900000t)
+func parseTimeExpression(text string, clock ttmlClock) (time.Duration, error) {
+	text = strings.TrimSpace(text)
+
+	if strings.Contains(text, ":") {
+		return parseClockTime(text, clock)
+	}
+
+	units := []struct {
+		suffix string
+		scale  float64
+	}{
+		{"ms", float64(time.Millisecond)},
+		{"h", float64(time.Hour)},
+		{"m", float64(time.Minute)},
+		{"s", float64(time.Second)},
+		{"f", float64(time.Second) / clock.frameRate},
+		{"t", float64(time.Second) / clock.tickRate},
+	}
+
+	for _, unit := range units {
+		number, ok := strings.CutSuffix(text, unit.suffix)
+		if !ok {
+			continue
+		}
+
+		value, err := strconv.ParseFloat(number, 64)
+		if err != nil || value < 0 {
+			break
+		}
+
+		return time.Duration(value * unit.scale), nil
+	}
+
+	return 0, fmt.Errorf("invalid time expression %q", text)
+}
+
+// parseClockTime reads hh:mm:ss with an optional .fraction or :frames part
+func parseClockTime(text string, clock ttmlClock) (time.Duration, error) {
+	fields := strings.Split(text, ":")
+	if len(fields) < 3 || len(fields) > 4 {
+		return 0, fmt.Errorf("invalid clock time %q", text)
+	}
+
+	hours, err := strconv.Atoi(fields[0])
+	if err != nil || hours < 0 || len(fields[0]) < 2 {
+		return 0, fmt.Errorf("invalid clock time %q", text)
+	}
+
+	minutes, err := strconv.Atoi(fields[1])
+	if err != nil || minutes > 59 || len(fields[1]) != 2 {
+		return 0, fmt.Errorf("invalid clock time %q", text)
+	}
+
+	seconds, err := strconv.ParseFloat(fields[2], 64)
+	if err != nil || seconds < 0 || seconds >= 61 || len(fields[2]) < 2 {
+		return 0, fmt.Errorf("invalid clock time %q", text)
+	}
+
+	total := time.Duration(hours)*time.Hour + time.Duration(minutes)*time.Minute + time.Duration(seconds*float64(time.Second))
+
+	if len(fields) == 4 {
+		frames, err := strconv.ParseFloat(fields[3], 64)
+		if err != nil || frames < 0 || frames >= clock.frameRate {
+			return 0, fmt.Errorf("invalid frame count in clock time %q", text)
+		}
+
+		total += time.Duration(frames * float64(time.Second) / clock.frameRate)
+	}
+
+	return total, nil
+}
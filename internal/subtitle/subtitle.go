@@ -0,0 +1,166 @@
+// Package subtitle validates the first segment of HLS subtitle renditions: WebVTT cues
+// with their X-TIMESTAMP-MAP, and IMSC (TTML) documents, raw or carried in fMP4
+package subtitle
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Segment formats reported in Report.Format
+const (
+	FormatWebVTT = "WebVTT"
+	FormatIMSC   = "IMSC"
+)
+
+// MaxDrift is how far the mapped subtitle timeline may sit from the video PTS before
+// the segment is flagged
+const MaxDrift = 100 * time.Millisecond
+
+// mpegTSClock is the 90 kHz MPEG-TS timestamp rate
+const mpegTSClock = 90000
+
+var ErrUnknownFormat = errors.New("subtitle segment is neither WebVTT nor IMSC (TTML)")
+
+// TimestampMap is the X-TIMESTAMP-MAP header tying WebVTT cue times to MPEG-TS timestamps
+type TimestampMap struct {
+	MPEGTS int64
+	Local  time.Duration
+}
+
+// Cue is the timing of one cue or timed TTML element
+type Cue struct {
+	Start time.Duration
+	End   time.Duration
+}
+
+// Report is the outcome of validating one subtitle segment
+type Report struct {
+	Format string
+	Cues   []Cue
+
+	// Map is the WebVTT X-TIMESTAMP-MAP; nil when the segment has none (or is IMSC)
+	Map *TimestampMap
+
+	// Issues lists malformed cues, header problems, and drift beyond MaxDrift
+	Issues []string
+
+	// Drift is the mapped subtitle timeline minus the video timeline, set by CheckDrift
+	Drift    time.Duration
+	HasDrift bool
+}
+
+// Parse detects the segment format and validates its cues
+func Parse(data []byte) (*Report, error) {
+	trimmed := bytes.TrimPrefix(data, []byte("\xef\xbb\xbf"))
+
+	switch {
+	case bytes.HasPrefix(trimmed, []byte("WEBVTT")):
+		return parseWebVTT(trimmed), nil
+	case isXML(trimmed):
+		return parseIMSC(trimmed), nil
+	}
+
+	// IMSC in fMP4 carries the TTML document in the mdat box
+	if document, ok := mdatPayload(data); ok && isXML(document) {
+		return parseIMSC(document), nil
+	}
+
+	return nil, ErrUnknownFormat
+}
+
+// CheckDrift compares the timeline the X-TIMESTAMP-MAP implies with the first video PTS
+// (90 kHz) of the video segment at the same position and flags drift beyond MaxDrift. A
+// missing map means cue time 0 is MPEG-TS time 0, as the HLS specification requires.
+func (r *Report) CheckDrift(videoPTS int64) {
+	if r.Format != FormatWebVTT {
+		return
+	}
+
+	mapping := TimestampMap{}
+
+	if r.Map != nil {
+		mapping = *r.Map
+	}
+
+	// Both timelines are taken as offsets of MPEG-TS time over playlist time
+	subtitleOffset := ticksToDuration(mapping.MPEGTS) - mapping.Local
+	videoOffset := ticksToDuration(videoPTS)
+
+	drift := subtitleOffset - videoOffset
+
+	// MPEG-TS timestamps wrap at 2^33 ticks (about 26.5 hours)
+	wrap := ticksToDuration(1 << 33)
+
+	switch {
+	case drift > wrap/2:
+		drift -= wrap
+	case drift < -wrap/2:
+		drift += wrap
+	}
+
+	r.Drift = drift
+	r.HasDrift = true
+
+	if drift > MaxDrift || drift < -MaxDrift {
+		note := ""
+
+		if r.Map == nil {
+			note = " (no X-TIMESTAMP-MAP)"
+		}
+
+		r.Issues = append(r.Issues, fmt.Sprintf("timing map drifts %s from the video PTS%s", drift, note))
+	}
+}
+
+// ticksToDuration converts 90 kHz MPEG-TS ticks to a duration
+func ticksToDuration(ticks int64) time.Duration {
+	return time.Duration(ticks) * time.Second / mpegTSClock
+}
+
+// isXML reports whether data starts like an XML (TTML) document
+func isXML(data []byte) bool {
+	data = bytes.TrimLeft(data, " \t\r\n")
+
+	return bytes.HasPrefix(data, []byte("<?xml")) || bytes.HasPrefix(data, []byte("<tt"))
+}
+
+// mdatPayload returns the contents of the first top-level mdat box in an ISO BMFF segment
+func mdatPayload(data []byte) ([]byte, bool) {
+	for len(data) >= 8 {
+		size := uint64(data[0])<<24 | uint64(data[1])<<16 | uint64(data[2])<<8 | uint64(data[3])
+		boxType := string(data[4:8])
+		header := uint64(8)
+
+		switch size {
+		case 0:
+			size = uint64(len(data))
+		case 1:
+			if len(data) < 16 {
+				return nil, false
+			}
+
+			size = 0
+
+			for _, b := range data[8:16] {
+				size = size<<8 | uint64(b)
+			}
+
+			header = 16
+		}
+
+		if size < header || size > uint64(len(data)) {
+			return nil, false
+		}
+
+		if boxType == "mdat" {
+			return data[header:size], true
+		}
+
+		data = data[size:]
+	}
+
+	return nil, false
+}
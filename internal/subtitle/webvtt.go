@@ -0,0 +1,154 @@
+package subtitle
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// parseWebVTT reads the X-TIMESTAMP-MAP header and every cue timing line
+func parseWebVTT(data []byte) *Report {
+	report := &Report{Format: FormatWebVTT}
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+
+	inHeader := true
+	line := 0
+
+	for scanner.Scan() {
+		line++
+		text := strings.TrimSpace(scanner.Text())
+
+		// The header ends at the first blank line
+		if inHeader {
+			if text == "" {
+				inHeader = false
+			} else if value, ok := strings.CutPrefix(text, "X-TIMESTAMP-MAP="); ok {
+				mapping, err := parseTimestampMap(value)
+				if err != nil {
+					report.Issues = append(report.Issues, fmt.Sprintf("line %d: %v", line, err))
+				} else {
+					report.Map = &mapping
+				}
+			}
+
+			continue
+		}
+
+		if !strings.Contains(text, "-->") {
+			continue
+		}
+
+		cue, err := parseCueTiming(text)
+		if err != nil {
+			report.Issues = append(report.Issues, fmt.Sprintf("line %d: %v", line, err))
+
+			continue
+		}
+
+		report.Cues = append(report.Cues, cue)
+	}
+
+	if err := scanner.Err(); err != nil {
+		report.Issues = append(report.Issues, fmt.Sprintf("line %d: %v", line+1, err))
+	}
+
+	return report
+}
+
+// parseTimestampMap reads "MPEGTS:900000,LOCAL:00:00:00.000" in either order
+func parseTimestampMap(value string) (TimestampMap, error) {
+	var (
+		mapping           TimestampMap
+		haveTS, haveLocal bool
+	)
+
+	for _, part := range strings.Split(value, ",") {
+		name, field, _ := strings.Cut(strings.TrimSpace(part), ":")
+
+		switch name {
+		case "MPEGTS":
+			ticks, err := strconv.ParseInt(field, 10, 64)
+			if err != nil || ticks < 0 {
+				return TimestampMap{}, fmt.Errorf("malformed X-TIMESTAMP-MAP MPEGTS %q", field)
+			}
+
+			mapping.MPEGTS = ticks
+			haveTS = true
+		case "LOCAL":
+			local, err := parseTimestamp(field)
+			if err != nil {
+				return TimestampMap{}, fmt.Errorf("malformed X-TIMESTAMP-MAP LOCAL: %w", err)
+			}
+
+			mapping.Local = local
+			haveLocal = true
+		}
+	}
+
+	if !haveTS || !haveLocal {
+		return TimestampMap{}, fmt.Errorf("X-TIMESTAMP-MAP %q needs both MPEGTS and LOCAL", value)
+	}
+
+	return mapping, nil
+}
+
+// parseCueTiming reads "00:00:01.000 --> 00:00:04.000 line:90%" and checks the order
+func parseCueTiming(text string) (Cue, error) {
+	startText, rest, _ := strings.Cut(text, "-->")
+	endText, _, _ := strings.Cut(strings.TrimSpace(rest), " ")
+
+	start, err := parseTimestamp(strings.TrimSpace(startText))
+	if err != nil {
+		return Cue{}, fmt.Errorf("malformed cue start: %w", err)
+	}
+
+	end, err := parseTimestamp(endText)
+	if err != nil {
+		return Cue{}, fmt.Errorf("malformed cue end: %w", err)
+	}
+
+	if end <= start {
+		return Cue{}, fmt.Errorf("cue ends at %s, not after its start at %s", end, start)
+	}
+
+	return Cue{Start: start, End: end}, nil
+}
+
+// parseTimestamp reads WebVTT timestamps: [hh:]mm:ss.ttt with exactly three fraction digits
+func parseTimestamp(text string) (time.Duration, error) {
+	clock, fraction, ok := strings.Cut(text, ".")
+	if !ok || len(fraction) != 3 {
+		return 0, fmt.Errorf("invalid timestamp %q", text)
+	}
+
+	fields := strings.Split(clock, ":")
+	if len(fields) < 2 || len(fields) > 3 {
+		return 0, fmt.Errorf("invalid timestamp %q", text)
+	}
+
+	millis, err := strconv.Atoi(fraction)
+	if err != nil {
+		return 0, fmt.Errorf("invalid timestamp %q", text)
+	}
+
+	total := time.Duration(millis) * time.Millisecond
+	units := []time.Duration{time.Second, time.Minute, time.Hour}
+
+	for i, field := range fields {
+		unit := units[len(fields)-1-i]
+
+		value, err := strconv.Atoi(field)
+		if err != nil || value < 0 || (unit != time.Hour && (len(field) != 2 || value > 59)) {
+			return 0, fmt.Errorf("invalid timestamp %q", text)
+		}
+
+		total += time.Duration(value) * unit
+	}
+
+	return total, nil
+}
@@ -0,0 +1,102 @@
+package ttff
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"codeberg.org/pwnderpants/vtrace/internal/probe"
+)
+
+// Measurement phases that accept a budget and their own request headers
+const (
+	PhaseManifest = "manifest"
+	PhaseMedia    = "media"
+	PhaseKey      = "key"
+	PhaseSegment  = "segment"
+	PhaseFrame    = "frame"
+)
+
+var ErrBudgetExceeded = errors.New("phase budget exceeded")
+
+// BudgetError reports a sample aborted because a phase ran past its budget
+type BudgetError struct {
+	Phase  string
+	Budget time.Duration
+}
+
+// Error describes which phase exceeded its budget
+func (e *BudgetError) Error() string {
+	return fmt.Sprintf("%s phase exceeded its %s budget", e.Phase, e.Budget)
+}
+
+// Unwrap allows matching budget aborts with errors.Is
+func (e *BudgetError) Unwrap() error {
+	return ErrBudgetExceeded
+}
+
+// ParseBudgets parses a budget list like "manifest=800ms,segment=2s"
+func ParseBudgets(spec string) (map[string]time.Duration, error) {
+	budgets := make(map[string]time.Duration)
+
+	for _, entry := range strings.Split(spec, ",") {
+		entry = strings.TrimSpace(entry)
+
+		if entry == "" {
+			continue
+		}
+
+		phase, value, ok := strings.Cut(entry, "=")
+		if !ok {
+			return nil, fmt.Errorf("expected phase=duration, got %q", entry)
+		}
+
+		switch phase {
+		case PhaseManifest, PhaseMedia, PhaseKey, PhaseSegment, PhaseFrame:
+		default:
+			return nil, fmt.Errorf("unknown phase %q (want manifest, media, key, segment, or frame)", phase)
+		}
+
+		budget, err := time.ParseDuration(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid budget for %s: %w", phase, err)
+		}
+
+		if budget <= 0 {
+			return nil, fmt.Errorf("budget for %s must be positive", phase)
+		}
+
+		budgets[phase] = budget
+	}
+
+	return budgets, nil
+}
+
+// PhaseContext derives a context bounded by the phase budget, if one is set, that carries the
+// phase's request headers
+func (p *Pipeline) PhaseContext(ctx context.Context, phase string) (context.Context, context.CancelFunc) {
+	ctx = probe.WithRequestHeader(ctx, p.Headers[phase])
+
+	budget, ok := p.Budgets[phase]
+	if !ok {
+		return context.WithCancel(ctx)
+	}
+
+	return context.WithTimeout(ctx, budget)
+}
+
+// ClassifyBudget replaces a phase error with a budget error when the phase deadline caused it
+func (p *Pipeline) ClassifyBudget(phaseCtx, ctx context.Context, phase string, err error) error {
+	if err == nil || ctx.Err() != nil {
+		return err
+	}
+
+	// Only the phase deadline firing counts, not the overall timeout
+	if errors.Is(phaseCtx.Err(), context.DeadlineExceeded) {
+		return &BudgetError{Phase: phase, Budget: p.Budgets[phase]}
+	}
+
+	return err
+}
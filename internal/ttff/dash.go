@@ -0,0 +1,171 @@
+package ttff
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"codeberg.org/pwnderpants/vtrace/internal/dash"
+	"codeberg.org/pwnderpants/vtrace/internal/decoder"
+	"codeberg.org/pwnderpants/vtrace/internal/probe"
+)
+
+// measureDASH fetches the MPD of target, downloads the init and first media segment of the
+// first video representation (or the first chunk at the live edge with LowLatencyDASH), and
+// times its first frame
+func (p *Pipeline) measureDASH(ctx context.Context, target string) (*Measurement, error) {
+	fetchManifest := dash.FetchManifest
+
+	if p.HTTP3 {
+		fetchManifest = dash.FetchManifestHTTP3
+	}
+
+	p.logf("Fetching MPD%s: %s", p.suffix(), target)
+
+	phaseCtx, cancelPhase := p.PhaseContext(ctx, PhaseManifest)
+	result, err := fetchManifest(phaseCtx, target, p.client)
+	cancelPhase()
+
+	if result != nil {
+		p.capture("manifest.mpd", target, result.Body, result.Trace)
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch MPD: %w", p.ClassifyBudget(phaseCtx, ctx, PhaseManifest, err))
+	}
+
+	manifestTrace := result.Trace
+
+	// Live presentations start from the segment at the live edge when the MPD arrived
+	manifestAt := time.Now()
+
+	selection, err := dash.SelectVideo(result.MPD, manifestAt)
+	if err != nil {
+		return nil, err
+	}
+
+	resolveSegment := dash.ResolveSegment
+
+	if p.LowLatencyDASH {
+		resolveSegment = dash.ResolveLiveEdgeSegment
+	}
+
+	segment, err := resolveSegment(result.MPD, selection, target, manifestAt)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve segment URLs: %w", err)
+	}
+
+	initURL, mediaURL := segment.InitURL, segment.MediaURL
+
+	p.logf("Selected representation %s (%d bps)", selection.Representation.ID, selection.Representation.Bandwidth)
+
+	if segment.Timing.Dynamic || len(segment.Timing.Periods) > 1 {
+		p.logf("Selected period %s, segment %s", segment.Timing.PeriodName(), DescribeSegmentPosition(segment.Timing))
+	}
+
+	// Download the initialization segment (if any) and the first media segment
+	phaseCtx, cancelPhase = p.PhaseContext(ctx, PhaseSegment)
+	defer cancelPhase()
+
+	var (
+		initData  []byte
+		initTrace *probe.Trace
+	)
+
+	if initURL != "" {
+		p.logf("Downloading init segment%s: %s", p.suffix(), initURL)
+
+		initData, initTrace, err = p.download(phaseCtx, initURL)
+
+		p.capture("init.mp4", initURL, initData, initTrace)
+
+		if err != nil {
+			return nil, fmt.Errorf("failed to download init segment: %w", p.ClassifyBudget(phaseCtx, ctx, PhaseSegment, err))
+		}
+	}
+
+	p.logf("Downloading segment%s: %s", p.suffix(), mediaURL)
+
+	var (
+		mediaData    []byte
+		decodeData   []byte
+		segmentTrace *probe.Trace
+		chunks       *probe.ChunkTiming
+	)
+
+	// An LL-DASH player starts decoding as soon as the first CMAF chunk has arrived
+	if p.LowLatencyDASH {
+		mediaData, decodeData, chunks, segmentTrace, err = probe.DownloadChunked(phaseCtx, mediaURL, p.client, p.HTTP3)
+	} else {
+		mediaData, segmentTrace, err = p.download(phaseCtx, mediaURL)
+		decodeData = mediaData
+	}
+
+	p.capture("segment.m4s", mediaURL, mediaData, segmentTrace)
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to download segment: %w", p.ClassifyBudget(phaseCtx, ctx, PhaseSegment, err))
+	}
+
+	if chunks != nil {
+		p.logf("First chunk after %s, segment complete after %s (%d %s)", chunks.FirstChunk, chunks.Complete, chunks.Chunks, plural(chunks.Chunks, "chunk"))
+	}
+
+	m := &Measurement{
+		Manifest:   manifestTrace,
+		Segment:    segmentTrace,
+		MediaURL:   target,
+		SegmentURL: mediaURL,
+
+		// Fragmented MP4 media segments only decode after their init segment
+		SegmentData: append(initData, decodeData...),
+	}
+
+	p.logf("Detecting first frame...")
+
+	phaseCtx, cancelPhase = p.PhaseContext(ctx, PhaseFrame)
+	frameDetection, frameDecoder, err := decoder.DetectFirstFrameDecoder(phaseCtx, m.SegmentData)
+	cancelPhase()
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to detect first frame: %w", p.ClassifyBudget(phaseCtx, ctx, PhaseFrame, err))
+	}
+
+	m.Sample = newSample(manifestTrace, segmentTrace, frameDetection, frameDecoder)
+	m.Sample.DASH = segment.Timing
+	m.Sample.DeclaredBandwidth = int64(selection.Representation.Bandwidth)
+	m.Sample.Variant = RepresentationLabel(selection.Representation)
+
+	// A chunked download counts until its first chunk
+	if chunks != nil {
+		if segmentTrace.Chunks == nil {
+			m.Sample.Chunks = chunks
+		}
+
+		m.Sample.TotalTTFF += chunks.FirstChunk - m.Sample.SegmentTotal
+		m.Sample.SegmentTotal = chunks.FirstChunk
+	}
+
+	if initTrace != nil {
+		m.Sample.InitSegment = initTrace.Total
+		m.Sample.TotalTTFF += initTrace.Total
+		m.Sample.FailedConnects += initTrace.FailedConnects()
+	}
+
+	// The first frame plays this far behind the live edge of a dynamic presentation. A
+	// chunked segment could be decoded before the rest of it arrived.
+	if segment.Timing.Dynamic {
+		m.Sample.LiveLatency = time.Since(segment.Timing.PresentationStart)
+
+		if chunks != nil {
+			m.Sample.LiveLatency -= chunks.Complete - chunks.FirstChunk
+		}
+	}
+
+	return m, nil
+}
+
+// DescribeSegmentPosition places a DASH media segment within its period
+func DescribeSegmentPosition(timing *dash.Timing) string {
+	return fmt.Sprintf("number %d, %s long, starting %s into the period", timing.Number, timing.Duration.Round(time.Millisecond), timing.Start.Round(time.Millisecond))
+}
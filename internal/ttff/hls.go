@@ -0,0 +1,381 @@
+package ttff
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/grafov/m3u8"
+
+	"codeberg.org/pwnderpants/vtrace/internal/decoder"
+	"codeberg.org/pwnderpants/vtrace/internal/probe"
+	"codeberg.org/pwnderpants/vtrace/internal/stats"
+)
+
+// liveEdgeTargetDurations is the hold-back, in target durations, of playlists whose
+// EXT-X-SERVER-CONTROL names no HOLD-BACK
+const liveEdgeTargetDurations = 3
+
+// Key holds the fetched AES-128 key for a measured segment
+type Key struct {
+	*probe.SegmentKey
+	Data  []byte
+	Trace *probe.Trace
+}
+
+// measureHLS follows the playlist chain of target to the selected segment (or LL-HLS part),
+// downloads it, and times its first frame
+func (p *Pipeline) measureHLS(ctx context.Context, target string) (*Measurement, error) {
+	p.logf("Fetching playlist%s: %s", p.suffix(), target)
+
+	phaseCtx, cancelPhase := p.PhaseContext(ctx, PhaseManifest)
+	result, err := p.fetchPlaylist(phaseCtx, target)
+	cancelPhase()
+
+	p.capturePlaylist("manifest.m3u8", target, result)
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch playlist: %w", p.ClassifyBudget(phaseCtx, ctx, PhaseManifest, err))
+	}
+
+	manifestTrace := result.Trace
+
+	baseURL, err := probe.GetBaseURL(target)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get base URL: %w", err)
+	}
+
+	m := &Measurement{Manifest: manifestTrace, MasterBaseURL: baseURL}
+	mediaURL := target
+
+	var mediaPlaylist time.Duration
+
+	// Handle master playlist by fetching media playlist
+	if result.Master != nil {
+		var variantURL string
+
+		variantURL, m.Variant, err = probe.SelectVariant(result.Master, baseURL, p.Variant)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get variant URL: %w", err)
+		}
+
+		p.logf("Selected variant: %s", describeVariant(m.Variant))
+		p.logf("Fetching media playlist%s: %s", p.suffix(), variantURL)
+
+		phaseCtx, cancelPhase := p.PhaseContext(ctx, PhaseMedia)
+		result, err = p.fetchPlaylist(phaseCtx, variantURL)
+		cancelPhase()
+
+		p.capturePlaylist("media.m3u8", variantURL, result)
+
+		if err != nil {
+			return nil, fmt.Errorf("failed to fetch media playlist: %w", p.ClassifyBudget(phaseCtx, ctx, PhaseMedia, err))
+		}
+
+		mediaURL = variantURL
+		mediaPlaylist = result.Trace.Total
+
+		baseURL, err = probe.GetBaseURL(variantURL)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get variant base URL: %w", err)
+		}
+	}
+
+	m.BaseURL = baseURL
+	m.MediaURL = mediaURL
+
+	// Low-Latency HLS starts from the newest independent part instead of a full segment
+	if p.LowLatency {
+		if err := p.measurePart(ctx, m, result, mediaURL); err != nil {
+			return nil, err
+		}
+
+		m.Sample.MediaPlaylist = mediaPlaylist
+
+		return m, nil
+	}
+
+	media, edge, err := p.selectSegment(result)
+	if err != nil {
+		return nil, err
+	}
+
+	m.Media = media
+
+	m.SegmentURL, err = probe.GetFirstSegmentURL(media, baseURL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get segment URL: %w", err)
+	}
+
+	// AES-128 segments need their key before they can be decoded
+	key, err := p.FetchKey(ctx, media, baseURL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch segment key: %w", err)
+	}
+
+	// fMP4/CMAF segments only decode after their EXT-X-MAP initialization section
+	phaseCtx, cancelPhase = p.PhaseContext(ctx, PhaseSegment)
+	initData, initTrace, err := p.DownloadInit(ctx, phaseCtx, media, baseURL)
+	cancelPhase()
+
+	if err != nil {
+		return nil, err
+	}
+
+	p.logf("Downloading segment%s: %s", p.suffix(), m.SegmentURL)
+
+	phaseCtx, cancelPhase = p.PhaseContext(ctx, PhaseSegment)
+	segmentData, segmentTrace, err := p.download(phaseCtx, m.SegmentURL)
+	cancelPhase()
+
+	p.capture("segment.ts", m.SegmentURL, segmentData, segmentTrace)
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to download segment: %w", p.ClassifyBudget(phaseCtx, ctx, PhaseSegment, err))
+	}
+
+	segmentData, err = key.Decrypt(segmentData)
+	if err != nil {
+		return nil, err
+	}
+
+	m.Segment = segmentTrace
+	m.SegmentData = append(initData, segmentData...)
+
+	p.logf("Detecting first frame...")
+
+	phaseCtx, cancelPhase = p.PhaseContext(ctx, PhaseFrame)
+	frameDetection, frameDecoder, err := decoder.DetectFirstFrameDecoder(phaseCtx, m.SegmentData)
+	cancelPhase()
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to detect first frame: %w", p.ClassifyBudget(phaseCtx, ctx, PhaseFrame, err))
+	}
+
+	m.Sample = newSample(manifestTrace, segmentTrace, frameDetection, frameDecoder)
+	m.Sample.KeyFetch = key.FetchTime()
+	m.Sample.TotalTTFF += key.FetchTime()
+	m.Sample.FailedConnects += key.FailedConnects()
+	m.Sample.MediaPlaylist = mediaPlaylist
+	m.Sample.LiveEdgeDistance = edge.Distance
+	m.Sample.LiveEdgeSegments = edge.Segments
+
+	if m.Variant != nil {
+		m.Sample.DeclaredBandwidth = int64(m.Variant.Bandwidth)
+		m.Sample.Variant = VariantLabel(m.Variant)
+	}
+
+	if initTrace != nil {
+		m.Sample.InitSegment = initTrace.Total
+		m.Sample.TotalTTFF += initTrace.Total
+		m.Sample.FailedConnects += initTrace.FailedConnects()
+	}
+
+	if err := p.measureFollowingSegments(ctx, media, baseURL, &m.Sample); err != nil {
+		return nil, err
+	}
+
+	return m, nil
+}
+
+// selectSegment narrows the media playlist of result to start at the segment SegmentIndex
+// or LiveEdge picks, returning where that is from the live edge with LiveEdge
+func (p *Pipeline) selectSegment(result *probe.PlaylistResult) (*m3u8.MediaPlaylist, probe.LiveEdge, error) {
+	var edge probe.LiveEdge
+
+	index := p.SegmentIndex
+
+	if p.LiveEdge {
+		var err error
+
+		edge, err = p.liveEdgeStart(result)
+		if err != nil {
+			return nil, probe.LiveEdge{}, err
+		}
+
+		index = edge.Index
+	}
+
+	if index == 0 {
+		return result.Media, edge, nil
+	}
+
+	view, err := probe.MediaFrom(result.Media, index)
+	if err != nil {
+		return nil, probe.LiveEdge{}, fmt.Errorf("failed to select segment: %w", err)
+	}
+
+	return view, edge, nil
+}
+
+// liveEdgeStart finds the segment a player joining the live playlist of result starts at,
+// holding back the HOLD-BACK of EXT-X-SERVER-CONTROL or three target durations without one
+func (p *Pipeline) liveEdgeStart(result *probe.PlaylistResult) (probe.LiveEdge, error) {
+	if result.Media != nil && result.Media.Closed {
+		return probe.LiveEdge{}, errors.New("starting at the live edge requires a live playlist, but this one has EXT-X-ENDLIST")
+	}
+
+	holdBack := time.Duration(0)
+
+	if result.Media != nil {
+		holdBack = time.Duration(liveEdgeTargetDurations * result.Media.TargetDuration * float64(time.Second))
+	}
+
+	if info, err := probe.ParseLowLatency(result.Body); err == nil && info.HoldBack > 0 {
+		holdBack = time.Duration(info.HoldBack * float64(time.Second))
+	}
+
+	edge, err := probe.LiveStart(result.Media, holdBack)
+	if err != nil {
+		return probe.LiveEdge{}, fmt.Errorf("failed to find the live edge: %w", err)
+	}
+
+	p.logf("Starting at segment %d, %d %s (%s) behind the live edge", edge.Index, edge.Segments, plural(edge.Segments, "segment"), edge.Distance)
+
+	return edge, nil
+}
+
+// FetchKey fetches the AES-128 key for the first segment of media, returning nil for clear
+// playlists
+func (p *Pipeline) FetchKey(ctx context.Context, media *m3u8.MediaPlaylist, baseURL string) (*Key, error) {
+	key, err := probe.FirstSegmentKey(media, baseURL)
+	if err != nil || key == nil {
+		return nil, err
+	}
+
+	fetchKey := probe.FetchKey
+
+	if p.HTTP3 {
+		fetchKey = probe.FetchKeyHTTP3
+	}
+
+	p.logf("Fetching key%s: %s", p.suffix(), key.URI)
+
+	// The key is fetched before the segment, as players do
+	phaseCtx, cancelPhase := p.PhaseContext(ctx, PhaseKey)
+	data, trace, err := fetchKey(phaseCtx, key.URI, p.client)
+	cancelPhase()
+
+	p.capture("segment.key", key.URI, data, trace)
+
+	if err != nil {
+		return nil, p.ClassifyBudget(phaseCtx, ctx, PhaseKey, err)
+	}
+
+	return &Key{SegmentKey: key, Data: data, Trace: trace}, nil
+}
+
+// Decrypt returns the clear segment bytes, or the input unchanged when there is no key
+func (k *Key) Decrypt(data []byte) ([]byte, error) {
+	if k == nil {
+		return data, nil
+	}
+
+	plain, err := probe.DecryptAES128(data, k.Data, k.IV)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt segment: %w", err)
+	}
+
+	return plain, nil
+}
+
+// FetchTime returns the key fetch duration, or zero when there is no key
+func (k *Key) FetchTime() time.Duration {
+	if k == nil {
+		return 0
+	}
+
+	return k.Trace.Total
+}
+
+// FailedConnects counts failed connect attempts made while fetching the key
+func (k *Key) FailedConnects() int {
+	if k == nil {
+		return 0
+	}
+
+	return k.Trace.FailedConnects()
+}
+
+// DownloadInit downloads the EXT-X-MAP initialization section of an fMP4/CMAF media
+// playlist within phaseCtx, returning nil data when the playlist has none
+func (p *Pipeline) DownloadInit(ctx, phaseCtx context.Context, media *m3u8.MediaPlaylist, baseURL string) ([]byte, *probe.Trace, error) {
+	if media == nil || media.Map == nil || media.Map.URI == "" {
+		return nil, nil, nil
+	}
+
+	initURL, err := probe.ResolveURL(baseURL, media.Map.URI)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to resolve EXT-X-MAP URL: %w", err)
+	}
+
+	p.logf("Downloading init section%s: %s", p.suffix(), initURL)
+
+	data, trace, err := p.download(phaseCtx, initURL)
+
+	p.capture("init.mp4", initURL, data, trace)
+
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to download init section: %w", p.ClassifyBudget(phaseCtx, ctx, PhaseSegment, err))
+	}
+
+	return data, trace, nil
+}
+
+// measureFollowingSegments downloads the segments after the measured one until Segments
+// were downloaded, and makes their average download the segment phase of the sample. Only
+// the first of them is decoded.
+func (p *Pipeline) measureFollowingSegments(ctx context.Context, media *m3u8.MediaPlaylist, baseURL string, sample *Sample) error {
+	if p.Segments == 1 {
+		return nil
+	}
+
+	downloads := []time.Duration{sample.SegmentTotal}
+
+	for i := 1; i < p.Segments; i++ {
+		view, err := probe.MediaFrom(media, i)
+		if err != nil {
+			return fmt.Errorf("failed to select segment %d of %d: %w", i+1, p.Segments, err)
+		}
+
+		segmentURL, err := probe.GetFirstSegmentURL(view, baseURL)
+		if err != nil {
+			return fmt.Errorf("failed to get segment URL: %w", err)
+		}
+
+		p.logf("Downloading segment %d of %d%s: %s", i+1, p.Segments, p.suffix(), segmentURL)
+
+		phaseCtx, cancelPhase := p.PhaseContext(ctx, PhaseSegment)
+		data, trace, err := p.download(phaseCtx, segmentURL)
+		cancelPhase()
+
+		p.capture(fmt.Sprintf("segment-%d.ts", i+1), segmentURL, data, trace)
+
+		if err != nil {
+			return fmt.Errorf("failed to download segment %d of %d: %w", i+1, p.Segments, p.ClassifyBudget(phaseCtx, ctx, PhaseSegment, err))
+		}
+
+		downloads = append(downloads, trace.Total)
+		sample.FailedConnects += trace.FailedConnects()
+	}
+
+	average := stats.ComputeStats(downloads).Mean
+
+	sample.TotalTTFF += average - sample.SegmentTotal
+	sample.SegmentTotal = average
+	sample.SegmentDownloads = downloads
+
+	return nil
+}
+
+// describeVariant summarizes a variant's bandwidth and resolution
+func describeVariant(variant *m3u8.Variant) string {
+	resolution := variant.Resolution
+
+	if resolution == "" {
+		resolution = "unknown resolution"
+	}
+
+	return fmt.Sprintf("%d bps, %s", variant.Bandwidth, resolution)
+}
@@ -0,0 +1,127 @@
+package ttff
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"codeberg.org/pwnderpants/vtrace/internal/decoder"
+	"codeberg.org/pwnderpants/vtrace/internal/probe"
+)
+
+// measurePart completes a Low-Latency HLS measurement from the media playlist by
+// downloading the newest independent part instead of a full segment
+func (p *Pipeline) measurePart(ctx context.Context, m *Measurement, media *probe.PlaylistResult, mediaURL string) error {
+	if media.Media == nil {
+		return errors.New("LL-HLS requires a media playlist")
+	}
+
+	// Parts of an AES-128 segment cannot be decrypted independently of the whole segment
+	if key, _ := probe.FirstSegmentKey(media.Media, m.BaseURL); key != nil {
+		return errors.New("LL-HLS does not support AES-128 encrypted playlists")
+	}
+
+	info, err := probe.ParseLowLatency(media.Body)
+	if err != nil {
+		return err
+	}
+
+	var reloadTrace *probe.Trace
+
+	// A blocking reload for the next part shows how quickly the server publishes it
+	if info.CanBlockReload {
+		msn, part, err := info.NextPart()
+		if err != nil {
+			return err
+		}
+
+		reloadURL, err := probe.BlockingReloadURL(mediaURL, msn, part)
+		if err != nil {
+			return err
+		}
+
+		p.logf("Blocking playlist reload%s: %s", p.suffix(), reloadURL)
+
+		phaseCtx, cancelPhase := p.PhaseContext(ctx, PhaseMedia)
+		reloaded, err := p.fetchPlaylist(phaseCtx, reloadURL)
+		cancelPhase()
+
+		p.capturePlaylist("reload.m3u8", reloadURL, reloaded)
+
+		if err != nil {
+			return fmt.Errorf("failed blocking playlist reload: %w", p.ClassifyBudget(phaseCtx, ctx, PhaseMedia, err))
+		}
+
+		if reloaded.Media != nil {
+			reloadedInfo, err := probe.ParseLowLatency(reloaded.Body)
+			if err != nil {
+				return err
+			}
+
+			media, info = reloaded, reloadedInfo
+		}
+
+		reloadTrace = reloaded.Trace
+	}
+
+	part, err := info.LatestIndependentPart()
+	if err != nil {
+		return err
+	}
+
+	partURL, err := probe.ResolveURL(m.BaseURL, part.URI)
+	if err != nil {
+		return fmt.Errorf("failed to resolve part URL: %w", err)
+	}
+
+	phaseCtx, cancelPhase := p.PhaseContext(ctx, PhaseSegment)
+	defer cancelPhase()
+
+	// Fragmented MP4 parts only decode after their EXT-X-MAP initialization section
+	initData, initTrace, err := p.DownloadInit(ctx, phaseCtx, media.Media, m.BaseURL)
+	if err != nil {
+		return err
+	}
+
+	p.logf("Downloading part %d.%d%s: %s", part.MSN, part.Index, p.suffix(), partURL)
+
+	partData, partTrace, err := p.download(phaseCtx, partURL)
+
+	p.capture("part", partURL, partData, partTrace)
+
+	if err != nil {
+		return fmt.Errorf("failed to download part: %w", p.ClassifyBudget(phaseCtx, ctx, PhaseSegment, err))
+	}
+
+	m.Media = media.Media
+	m.SegmentURL = partURL
+	m.Segment = partTrace
+	m.SegmentData = append(initData, partData...)
+
+	p.logf("Detecting first frame...")
+
+	phaseCtx, cancelFrame := p.PhaseContext(ctx, PhaseFrame)
+	frameDetection, frameDecoder, err := decoder.DetectFirstFrameDecoder(phaseCtx, m.SegmentData)
+	cancelFrame()
+
+	if err != nil {
+		return fmt.Errorf("failed to detect first frame: %w", p.ClassifyBudget(phaseCtx, ctx, PhaseFrame, err))
+	}
+
+	m.Sample = newSample(m.Manifest, partTrace, frameDetection, frameDecoder)
+
+	// The init section counts toward the part download, as it gates decoding of the part
+	if initTrace != nil {
+		m.Sample.SegmentTotal += initTrace.Total
+		m.Sample.TotalTTFF += initTrace.Total
+	}
+
+	m.Sample.PartDownload = m.Sample.SegmentTotal
+
+	if reloadTrace != nil {
+		m.Sample.BlockingReload = reloadTrace.Total
+		m.Sample.FailedConnects += reloadTrace.FailedConnects()
+	}
+
+	return nil
+}
@@ -0,0 +1,82 @@
+package ttff
+
+import (
+	"time"
+
+	"codeberg.org/pwnderpants/vtrace/internal/dash"
+	"codeberg.org/pwnderpants/vtrace/internal/decoder"
+	"codeberg.org/pwnderpants/vtrace/internal/probe"
+	"codeberg.org/pwnderpants/vtrace/internal/stats"
+	"codeberg.org/pwnderpants/vtrace/internal/subtitle"
+)
+
+// Sample is one TTFF measurement: the timings package stats aggregates, and the connection
+// details and per-feature reports taken with them
+type Sample struct {
+	stats.Sample
+
+	// Video is the stream description of the first segment, when one was checked, and
+	// ColorIssues and CodecIssues its mismatches with the playlist
+	Video       *decoder.StreamInfo
+	ColorIssues []string
+	CodecIssues []string
+
+	// Cadence is the frame timing of the first segment, when one was checked, and
+	// CadenceIssues its dropped, duplicated, or irregular frames
+	Cadence       *decoder.Cadence
+	CadenceIssues []string
+
+	// SegmentDuration and SegmentBitrate are the media time and real bitrate of the first
+	// segment, when one was checked, and BitrateIssues their deviations from BANDWIDTH and EXTINF
+	SegmentDuration time.Duration
+	SegmentBitrate  float64
+	BitrateIssues   []string
+
+	// ManifestHandshake and SegmentHandshake are the TLS handshakes of the connections the
+	// manifest and segment requests opened, nil when they reused a connection
+	ManifestHandshake *probe.Handshake
+	SegmentHandshake  *probe.Handshake
+
+	// ManifestTLS and SegmentTLS are the negotiated TLS parameters of the connections that
+	// served the manifest and segment requests, nil over plain HTTP
+	ManifestTLS *probe.TLSInfo
+	SegmentTLS  *probe.TLSInfo
+
+	// ManifestConn and SegmentConn identify the connections that served the manifest and
+	// segment requests
+	ManifestConn probe.ConnInfo
+	SegmentConn  probe.ConnInfo
+
+	// ManifestCDN and SegmentCDN are the cache verdicts and Server-Timing metrics of the
+	// manifest and segment responses, nil when their headers named no CDN
+	ManifestCDN *probe.CDNInfo
+	SegmentCDN  *probe.CDNInfo
+
+	// ManifestEdge and SegmentEdge name the CDN and POP that served the manifest and segment,
+	// from headers, reverse DNS, or known address ranges
+	ManifestEdge probe.CDNIdentity
+	SegmentEdge  probe.CDNIdentity
+
+	// SegmentProgress is when the body of the segment (or LL-HLS part) arrived
+	SegmentProgress *probe.Progress
+
+	// Chunks times the chunked download of an in-progress LL-DASH segment, when one was measured
+	Chunks *probe.ChunkTiming
+
+	// DASH places the first media segment on the presentation timeline
+	DASH *dash.Timing
+
+	// Subtitles is the validation of the first subtitle segment, when one was checked
+	Subtitles *subtitle.Report
+}
+
+// Timings returns the stats.Sample of each sample, for the stats extractors
+func Timings(samples []Sample) []stats.Sample {
+	timings := make([]stats.Sample, len(samples))
+
+	for i, sample := range samples {
+		timings[i] = sample.Sample
+	}
+
+	return timings
+}
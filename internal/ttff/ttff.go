@@ -0,0 +1,222 @@
+// Package ttff runs the Time To First Frame measurement pipeline shared by the vtrace CLI and
+// the pkg/vtrace library, so both time the same requests the same way
+package ttff
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/grafov/m3u8"
+
+	"codeberg.org/pwnderpants/vtrace/internal/dash"
+	"codeberg.org/pwnderpants/vtrace/internal/probe"
+	"codeberg.org/pwnderpants/vtrace/internal/stats"
+)
+
+// Config selects what a pipeline measures
+type Config struct {
+	// HTTP3 measures over QUIC; the client must be an HTTP/3 client
+	HTTP3 bool
+
+	// DASH measures an MPEG-DASH manifest instead of an HLS playlist
+	DASH bool
+
+	// Variant picks the rendition of an HLS master playlist; nil picks the first
+	Variant probe.VariantStrategy
+
+	// SegmentIndex starts HLS media playlists at this zero-based segment
+	SegmentIndex int
+
+	// Segments downloads this many consecutive HLS segments and averages them into the
+	// segment phase; zero counts as one
+	Segments int
+
+	// LiveEdge starts live HLS playlists where a joining player would
+	LiveEdge bool
+
+	// LowLatency measures the newest LL-HLS part, LowLatencyDASH the first chunk of the
+	// in-progress LL-DASH segment
+	LowLatency     bool
+	LowLatencyDASH bool
+
+	// Budgets aborts a phase that runs longer than its budget, keyed by phase
+	Budgets map[string]time.Duration
+
+	// Headers are sent with the requests of a phase, keyed by phase
+	Headers map[string]http.Header
+
+	// Logf receives progress messages when set
+	Logf func(format string, args ...any)
+
+	// Capture receives every response body and its trace when set, for replay bundles
+	Capture func(name, url string, data []byte, trace *probe.Trace)
+}
+
+// Pipeline measures TTFF with one client and configuration
+type Pipeline struct {
+	Config
+
+	client *http.Client
+}
+
+// Measurement is the outcome of one pipeline run
+type Measurement struct {
+	Sample   Sample
+	Manifest *probe.Trace
+	Segment  *probe.Trace
+
+	// Variant is the selected HLS variant, nil when the URL named a media playlist
+	Variant *m3u8.Variant
+
+	// MediaURL is the media playlist (or MPD) measured, SegmentURL the segment or part
+	MediaURL   string
+	SegmentURL string
+
+	// MasterBaseURL resolves the master playlist's references, BaseURL the media playlist's
+	MasterBaseURL string
+	BaseURL       string
+
+	// Media starts at the measured HLS segment
+	Media *m3u8.MediaPlaylist
+
+	// SegmentData is the decrypted media the first frame was found in, after its init section
+	SegmentData []byte
+}
+
+// New creates a pipeline that sends its requests through client
+func New(client *http.Client, cfg Config) *Pipeline {
+	if cfg.Variant == nil {
+		cfg.Variant = probe.FirstVariant()
+	}
+
+	if cfg.Segments < 1 {
+		cfg.Segments = 1
+	}
+
+	return &Pipeline{Config: cfg, client: client}
+}
+
+// Measure runs one TTFF measurement of target
+func (p *Pipeline) Measure(ctx context.Context, target string) (*Measurement, error) {
+	if p.DASH {
+		return p.measureDASH(ctx, target)
+	}
+
+	return p.measureHLS(ctx, target)
+}
+
+// logf reports progress when a logger is set
+func (p *Pipeline) logf(format string, args ...any) {
+	if p.Logf != nil {
+		p.Logf(format, args...)
+	}
+}
+
+// capture hands a response to the capture hook when one is set
+func (p *Pipeline) capture(name, url string, data []byte, trace *probe.Trace) {
+	if p.Capture != nil {
+		p.Capture(name, url, data, trace)
+	}
+}
+
+// capturePlaylist hands a fetched playlist to the capture hook
+func (p *Pipeline) capturePlaylist(name, url string, result *probe.PlaylistResult) {
+	if result != nil {
+		p.capture(name, url, result.Body, result.Trace)
+	}
+}
+
+// suffix labels progress messages of HTTP/3 requests
+func (p *Pipeline) suffix() string {
+	if p.HTTP3 {
+		return " (HTTP/3)"
+	}
+
+	return ""
+}
+
+// fetchPlaylist fetches an HLS playlist over the pipeline's protocol
+func (p *Pipeline) fetchPlaylist(ctx context.Context, url string) (*probe.PlaylistResult, error) {
+	if p.HTTP3 {
+		return probe.FetchPlaylistHTTP3(ctx, url, p.client)
+	}
+
+	return probe.FetchPlaylist(ctx, url, p.client)
+}
+
+// download fetches a segment, init section, or part over the pipeline's protocol
+func (p *Pipeline) download(ctx context.Context, url string) ([]byte, *probe.Trace, error) {
+	if p.HTTP3 {
+		return probe.DownloadSegmentHTTP3(ctx, url, p.client)
+	}
+
+	return probe.DownloadSegment(ctx, url, p.client)
+}
+
+// newSample fills the phases every measurement shares from the manifest and media traces
+func newSample(manifest, segment *probe.Trace, frameDetection time.Duration, frameDecoder string) Sample {
+	sample := Sample{Sample: stats.Sample{
+		DNSLookup:      manifest.DNSLookup,
+		TCPConnect:     manifest.TCPConnect,
+		TLSHandshake:   manifest.TLSHandshake,
+		QUICHandshake:  manifest.QUICHandshake,
+		ManifestTTFB:   manifest.TTFB,
+		ManifestTotal:  manifest.Total,
+		SegmentTotal:   segment.Total,
+		FrameDetection: frameDetection,
+		TotalTTFF:      manifest.Total + segment.Total + frameDetection,
+		ManifestProto:  manifest.Proto,
+		SegmentProto:   segment.Proto,
+		FrameDecoder:   frameDecoder,
+		FailedConnects: manifest.FailedConnects() + segment.FailedConnects(),
+	}}
+
+	recordThroughput(&sample, manifest, segment)
+
+	return sample
+}
+
+// recordThroughput copies the body sizes and effective download rates of the manifest and
+// segment requests, and the arrival of the segment body and its chunks, into the sample
+func recordThroughput(sample *Sample, manifest, segment *probe.Trace) {
+	sample.ManifestBytes = manifest.Bytes
+	sample.ManifestThroughput = manifest.Throughput()
+	sample.SegmentBytes = segment.Bytes
+	sample.SegmentThroughput = segment.Throughput()
+	sample.SegmentProgress = segment.Progress
+
+	// LL-DASH downloads time their chunks themselves and have already set them
+	if segment.Chunks != nil {
+		sample.Chunks = segment.Chunks
+	}
+}
+
+// VariantLabel names a variant by resolution and bandwidth (e.g., 1280x720@2500000), a form
+// that is safe inside compare-stored filters
+func VariantLabel(variant *m3u8.Variant) string {
+	if variant.Resolution == "" {
+		return fmt.Sprintf("%d", variant.Bandwidth)
+	}
+
+	return fmt.Sprintf("%s@%d", variant.Resolution, variant.Bandwidth)
+}
+
+// RepresentationLabel names a DASH representation like VariantLabel names an HLS variant
+func RepresentationLabel(rep *dash.Representation) string {
+	if rep.Width == 0 || rep.Height == 0 {
+		return fmt.Sprintf("%d", rep.Bandwidth)
+	}
+
+	return fmt.Sprintf("%dx%d@%d", rep.Width, rep.Height, rep.Bandwidth)
+}
+
+// plural returns noun, with an s unless count is one
+func plural(count int, noun string) string {
+	if count == 1 {
+		return noun
+	}
+
+	return noun + "s"
+}
@@ -0,0 +1,305 @@
+// Package vtrace measures Time To First Frame (TTFF) for HLS and MPEG-DASH
+// streams so Go programs can embed the measurement without the CLI
+package vtrace
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"codeberg.org/pwnderpants/vtrace/internal/decoder"
+	"codeberg.org/pwnderpants/vtrace/internal/probe"
+	"codeberg.org/pwnderpants/vtrace/internal/stats"
+	"codeberg.org/pwnderpants/vtrace/internal/ttff"
+)
+
+// Stream formats accepted in Options.Format
+const (
+	FormatHLS  = "hls"
+	FormatDASH = "dash"
+)
+
+// Phases accepted as keys of Options.Budgets
+const (
+	PhaseManifest = ttff.PhaseManifest
+	PhaseMedia    = ttff.PhaseMedia
+	PhaseKey      = ttff.PhaseKey
+	PhaseSegment  = ttff.PhaseSegment
+	PhaseFrame    = ttff.PhaseFrame
+)
+
+var (
+	ErrFFprobeNotFound = decoder.ErrFFprobeNotFound
+	ErrUnknownFormat   = errors.New("unknown stream format (want hls or dash)")
+	ErrProxyHTTP3      = errors.New("HTTP/3 cannot be measured through a proxy")
+	ErrBudgetExceeded  = ttff.ErrBudgetExceeded
+)
+
+// BudgetError reports a measurement aborted because a phase ran past its budget; it
+// matches ErrBudgetExceeded with errors.Is
+type BudgetError = ttff.BudgetError
+
+// Options configures a Measurer
+type Options struct {
+	// Timeout bounds a whole measurement; zero means 30s
+	Timeout time.Duration
+
+	// HTTP3 measures over QUIC instead of HTTP/1.1-2
+	HTTP3 bool
+
+	// Format is FormatHLS (the default) or FormatDASH
+	Format string
+
+	// VariantBandwidth selects an HLS variant by bandwidth: highest, lowest, or a bitrate such as 3M
+	VariantBandwidth string
+
+	// VariantResolution selects an HLS variant by resolution: highest, lowest, WIDTHxHEIGHT, or 720p
+	VariantResolution string
+
+	// VariantIndex selects an HLS variant by position when no other selector is set
+	VariantIndex int
+
+	// SegmentIndex measures the HLS media segment at this zero-based position instead of the first
+	SegmentIndex int
+
+	// Segments downloads this many consecutive HLS segments and averages their downloads
+	// into SegmentTotal; zero means one
+	Segments int
+
+	// LiveEdge starts live HLS playlists at the segment a joining player would pick, three
+	// target durations (or the HOLD-BACK) from the end
+	LiveEdge bool
+
+	// LowLatency measures the newest Low-Latency HLS part instead of a full segment
+	LowLatency bool
+
+	// LowLatencyDASH measures the first chunk of the in-progress LL-DASH segment at the live edge
+	LowLatencyDASH bool
+
+	// Budgets aborts a measurement with a BudgetError when a phase (PhaseManifest, ...)
+	// runs longer than its budget
+	Budgets map[string]time.Duration
+
+	// Header is sent with every request (tokens, Referer, User-Agent)
+	Header http.Header
+
+	// ManifestHeader and SegmentHeader are sent only with playlist/MPD or segment requests,
+	// taking precedence over Header
+	ManifestHeader http.Header
+	SegmentHeader  http.Header
+
+	// Proxy sends requests through an HTTP, HTTPS, or SOCKS5 (socks5://) proxy; nil
+	// follows HTTP_PROXY, HTTPS_PROXY, and NO_PROXY. It cannot be combined with HTTP3.
+	Proxy *url.URL
+
+	// Resolve pins "host:port" dial addresses to an "ip:port" instead of looking the host
+	// up, e.g., to measure one CDN edge: {"cdn.example.com:443": "203.0.113.7:443"}
+	Resolve map[string]string
+}
+
+// Result is the outcome of one TTFF measurement
+type Result struct {
+	URL            string
+	MediaURL       string
+	SegmentURL     string
+	DNSLookup      time.Duration
+	TCPConnect     time.Duration
+	TLSHandshake   time.Duration
+	QUICHandshake  time.Duration
+	ManifestTTFB   time.Duration
+	ManifestTotal  time.Duration
+	KeyFetch       time.Duration
+	InitSegment    time.Duration
+	SegmentTotal   time.Duration
+	FrameDetection time.Duration
+	TotalTTFF      time.Duration
+	ManifestProto  string
+	SegmentProto   string
+	FrameDecoder   string
+
+	// MediaPlaylist is the media playlist fetch after a master playlist; like the CLI, it is
+	// not part of TotalTTFF
+	MediaPlaylist time.Duration
+
+	// PartDownload and BlockingReload time the LL-HLS part and the blocking reload before it
+	PartDownload   time.Duration
+	BlockingReload time.Duration
+
+	// SegmentDownloads lists each download averaged into SegmentTotal with Options.Segments
+	SegmentDownloads []time.Duration
+
+	// LiveEdgeDistance is how far behind the live edge the measured segment started with
+	// Options.LiveEdge
+	LiveEdgeDistance time.Duration
+
+	// LiveLatency is how far behind the live edge of a dynamic DASH presentation the first
+	// frame played
+	LiveLatency time.Duration
+}
+
+// Summary holds aggregate statistics for a set of durations
+type Summary struct {
+	Count  int
+	Mean   time.Duration
+	Median time.Duration
+	Min    time.Duration
+	Max    time.Duration
+	StdDev time.Duration
+}
+
+// Measurer runs TTFF measurements with a fixed configuration
+type Measurer struct {
+	opts    Options
+	variant probe.VariantStrategy
+}
+
+// NewMeasurer validates options and, for DASH, checks that ffprobe is available
+func NewMeasurer(opts Options) (*Measurer, error) {
+	if opts.Timeout <= 0 {
+		opts.Timeout = 30 * time.Second
+	}
+
+	if opts.Format == "" {
+		opts.Format = FormatHLS
+	}
+
+	if opts.Format != FormatHLS && opts.Format != FormatDASH {
+		return nil, fmt.Errorf("%w: %q", ErrUnknownFormat, opts.Format)
+	}
+
+	if opts.HTTP3 && opts.Proxy != nil {
+		return nil, ErrProxyHTTP3
+	}
+
+	switch {
+	case opts.SegmentIndex < 0:
+		return nil, errors.New("SegmentIndex must not be negative")
+	case opts.Segments < 0:
+		return nil, errors.New("Segments must not be negative")
+	case opts.LowLatency && (opts.SegmentIndex != 0 || opts.Segments > 1 || opts.LiveEdge):
+		return nil, errors.New("LowLatency already starts at the live edge and measures one part")
+	case opts.Format == FormatDASH && (opts.SegmentIndex != 0 || opts.Segments > 1 || opts.LiveEdge || opts.LowLatency):
+		return nil, errors.New("SegmentIndex, Segments, LiveEdge, and LowLatency apply to HLS")
+	case opts.Format == FormatHLS && opts.LowLatencyDASH:
+		return nil, errors.New("LowLatencyDASH applies to DASH")
+	}
+
+	var (
+		variant probe.VariantStrategy
+		err     error
+	)
+
+	switch {
+	case opts.VariantBandwidth != "":
+		variant, err = probe.VariantByBandwidth(opts.VariantBandwidth)
+	case opts.VariantResolution != "":
+		variant, err = probe.VariantByResolution(opts.VariantResolution)
+	default:
+		variant = probe.VariantByIndex(opts.VariantIndex)
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("invalid variant selection: %w", err)
+	}
+
+	// fMP4 needs ffprobe; MPEG-TS H.264/H.265 segments are decoded natively
+	if opts.Format == FormatDASH {
+		if err := decoder.CheckFFprobe(); err != nil {
+			return nil, err
+		}
+	}
+
+	return &Measurer{opts: opts, variant: variant}, nil
+}
+
+// Measure performs one TTFF measurement against a stream URL through the same pipeline
+// as the vtrace CLI
+func (m *Measurer) Measure(ctx context.Context, streamURL string) (*Result, error) {
+	normalized, err := probe.NormalizeURL(streamURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid URL: %w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, m.opts.Timeout)
+	defer cancel()
+
+	clientOpts := probe.ClientOptions{Header: m.opts.Header, Proxy: m.opts.Proxy, Resolve: m.opts.Resolve}
+	client := probe.NewHTTPClientWithOptions(m.opts.Timeout, clientOpts)
+
+	if m.opts.HTTP3 {
+		client = probe.NewHTTP3ClientWithOptions(m.opts.Timeout, clientOpts)
+	}
+
+	pipeline := ttff.New(client, ttff.Config{
+		HTTP3:          m.opts.HTTP3,
+		DASH:           m.opts.Format == FormatDASH,
+		Variant:        m.variant,
+		SegmentIndex:   m.opts.SegmentIndex,
+		Segments:       m.opts.Segments,
+		LiveEdge:       m.opts.LiveEdge,
+		LowLatency:     m.opts.LowLatency,
+		LowLatencyDASH: m.opts.LowLatencyDASH,
+		Budgets:        m.opts.Budgets,
+		Headers: map[string]http.Header{
+			ttff.PhaseManifest: m.opts.ManifestHeader,
+			ttff.PhaseMedia:    m.opts.ManifestHeader,
+			ttff.PhaseSegment:  m.opts.SegmentHeader,
+		},
+	})
+
+	measurement, err := pipeline.Measure(ctx, normalized)
+	if err != nil {
+		return nil, err
+	}
+
+	sample := measurement.Sample
+
+	return &Result{
+		URL:              normalized,
+		MediaURL:         measurement.MediaURL,
+		SegmentURL:       measurement.SegmentURL,
+		DNSLookup:        sample.DNSLookup,
+		TCPConnect:       sample.TCPConnect,
+		TLSHandshake:     sample.TLSHandshake,
+		QUICHandshake:    sample.QUICHandshake,
+		ManifestTTFB:     sample.ManifestTTFB,
+		ManifestTotal:    sample.ManifestTotal,
+		KeyFetch:         sample.KeyFetch,
+		InitSegment:      sample.InitSegment,
+		SegmentTotal:     sample.SegmentTotal,
+		FrameDetection:   sample.FrameDetection,
+		TotalTTFF:        sample.TotalTTFF,
+		ManifestProto:    sample.ManifestProto,
+		SegmentProto:     sample.SegmentProto,
+		FrameDecoder:     sample.FrameDecoder,
+		MediaPlaylist:    sample.MediaPlaylist,
+		PartDownload:     sample.PartDownload,
+		BlockingReload:   sample.BlockingReload,
+		SegmentDownloads: sample.SegmentDownloads,
+		LiveEdgeDistance: sample.LiveEdgeDistance,
+		LiveLatency:      sample.LiveLatency,
+	}, nil
+}
+
+// Summarize computes statistics over the total TTFF of a set of results
+func Summarize(results []*Result) Summary {
+	durations := make([]time.Duration, len(results))
+
+	for i, r := range results {
+		durations[i] = r.TotalTTFF
+	}
+
+	s := stats.ComputeStats(durations)
+
+	return Summary{
+		Count:  len(durations),
+		Mean:   s.Mean,
+		Median: s.Median,
+		Min:    s.Min,
+		Max:    s.Max,
+		StdDev: s.StdDev,
+	}
+}